@@ -0,0 +1,140 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// serviceTimeAlpha is the weight of each report added in the moving
+	// mean of how long adding them takes.
+	serviceTimeAlpha = 0.1
+	minRetryAfter    = time.Second
+	maxRetryAfter    = time.Minute
+)
+
+var (
+	reportsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "scope",
+		Name:      "reports_queued",
+		Help:      "Number of reports waiting to be added.",
+	})
+	reportsOverloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "reports_overloaded_total",
+		Help:      "Total count of reports turned away as the app was overloaded.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(reportsQueued)
+	prometheus.MustRegister(reportsOverloaded)
+}
+
+// overloadRejection is the error of reports turned away by admission
+// control, with how long the probe should wait before sending another.
+type overloadRejection struct {
+	retryAfter time.Duration
+}
+
+func (r overloadRejection) Error() string {
+	return fmt.Sprintf("app overloaded, retry after %s", r.retryAfter)
+}
+
+// retryAfterSeconds is the Retry-After header of the rejection.
+func (r overloadRejection) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(r.retryAfter.Seconds())))
+}
+
+// AdmissionControl bounds how many reports are added at once, queueing
+// those over the bound, and turning reports away once the queue is full,
+// so an overloaded app degrades by dropping reports rather than running
+// out of memory with them. Reports turned away come with a hint of how
+// long the queue would take to drain, for probes to back off by.
+//
+// A nil AdmissionControl admits everything.
+type AdmissionControl struct {
+	slots    chan struct{}
+	maxQueue int64
+	queued   int64 // atomically
+
+	mtx         sync.Mutex
+	serviceTime time.Duration // moving mean of how long adding reports takes
+}
+
+// NewAdmissionControl makes an AdmissionControl adding up to maxInFlight
+// reports at once, and queueing up to maxQueue more.
+func NewAdmissionControl(maxInFlight, maxQueue int) *AdmissionControl {
+	return &AdmissionControl{
+		slots:    make(chan struct{}, maxInFlight),
+		maxQueue: int64(maxQueue),
+	}
+}
+
+// admit waits for a report to be added, returning the func to call once
+// it has been, or an overloadRejection if the queue is full.
+func (a *AdmissionControl) admit(ctx context.Context) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return a.release(time.Now()), nil
+	default:
+	}
+
+	queued := atomic.AddInt64(&a.queued, 1)
+	defer func() { reportsQueued.Set(float64(atomic.AddInt64(&a.queued, -1))) }()
+	if queued > a.maxQueue {
+		reportsOverloaded.Inc()
+		return nil, overloadRejection{retryAfter: a.retryAfter(queued)}
+	}
+	reportsQueued.Set(float64(queued))
+	select {
+	case a.slots <- struct{}{}:
+		return a.release(time.Now()), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *AdmissionControl) release(start time.Time) func() {
+	return func() {
+		<-a.slots
+		took := time.Since(start)
+		a.mtx.Lock()
+		defer a.mtx.Unlock()
+		if a.serviceTime == 0 {
+			a.serviceTime = took
+		} else {
+			a.serviceTime += time.Duration(serviceTimeAlpha * float64(took-a.serviceTime))
+		}
+	}
+}
+
+func (a *AdmissionControl) queuedReports() int64 {
+	return atomic.LoadInt64(&a.queued)
+}
+
+// retryAfter estimates how long the queue of depth queued takes to
+// drain.
+func (a *AdmissionControl) retryAfter(queued int64) time.Duration {
+	a.mtx.Lock()
+	serviceTime := a.serviceTime
+	a.mtx.Unlock()
+	retryAfter := time.Duration(queued) * serviceTime / time.Duration(cap(a.slots))
+	switch {
+	case retryAfter < minRetryAfter:
+		return minRetryAfter
+	case retryAfter > maxRetryAfter:
+		return maxRetryAfter
+	}
+	return retryAfter
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+func TestAdmissionControl(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		admission = NewAdmissionControl(1, 1)
+	)
+	release, err := admission.admit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next report queues, until the first is added
+	queued := make(chan func())
+	go func() {
+		release, err := admission.admit(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		queued <- release
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for admission.queuedReports() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("report never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// And the queue being full, the one after is turned away
+	_, err = admission.admit(ctx)
+	rejection, ok := err.(overloadRejection)
+	if !ok {
+		t.Fatalf("Expected an overloadRejection, got %v", err)
+	}
+	if rejection.retryAfter < minRetryAfter {
+		t.Errorf("Expected to retry after at least %s, got %s", minRetryAfter, rejection.retryAfter)
+	}
+
+	// Over HTTP, with a 429
+	router := mux.NewRouter()
+	RegisterReportPostHandler(NewCollector(time.Minute), nil, admission, ReportLimits{}, router)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/report", strings.NewReader("")))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected a 429, retrying after 1s, got %d, %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	release()
+	(<-queued)()
+	if release, err = admission.admit(ctx); err != nil {
+		t.Errorf("Expected reports to be admitted again, got %v", err)
+	}
+	release()
+
+	// A nil AdmissionControl admits everything
+	var none *AdmissionControl
+	if release, err := none.admit(ctx); err != nil {
+		t.Error(err)
+	} else {
+		release()
+	}
+}
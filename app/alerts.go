@@ -0,0 +1,634 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+const (
+	alertTimeout         = 30 * time.Second
+	alertNotifierTimeout = 5 * time.Second
+
+	// PagerDutyEventsURL is where PagerDuty notifiers send events, unless
+	// they are given another URL.
+	PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// ErrAlertRuleNotFound is returned for rules the Alerter doesn't have.
+var ErrAlertRuleNotFound = errors.New("alerting rule not found")
+
+// AlertRule is a condition over the nodes of a topology, as rendered with
+// the given options, which raises alerts on the nodes it holds for.
+//
+// Nodes are selected with Query, in the search language of the UI. Rules
+// with Increase alert on the selected nodes whose field went up by more than
+// a threshold, as "restarts > 5 in 10m". Rules with Edge alert on the edges
+// between nodes, as from one namespace to another, instead.
+type AlertRule struct {
+	ID              string              `json:"id"`
+	Name            string              `json:"name"`
+	TopologyID      string              `json:"topologyId"`
+	TopologyOptions map[string][]string `json:"topologyOptions,omitempty"`
+	Query           string              `json:"query,omitempty"`
+	Increase        *AlertIncrease      `json:"increase,omitempty"`
+	Edge            *AlertEdge          `json:"edge,omitempty"`
+	// For is how long the condition must hold before alerts fire, as 5m.
+	For    string          `json:"for,omitempty"`
+	Notify []AlertNotifier `json:"notify,omitempty"`
+}
+
+// AlertIncrease is the condition of a field of nodes, a metric or numeric
+// metadata named by its ID or label, going up by more than Threshold over
+// Window, as 10m.
+type AlertIncrease struct {
+	Field     string  `json:"field"`
+	Threshold float64 `json:"threshold"`
+	Window    string  `json:"window"`
+}
+
+// AlertEdge is the condition of there being an edge from a node matching
+// the From query to one matching the To query.
+type AlertEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AlertNotifier is where to notify of alerts firing and resolving: a
+// "webhook" URL, which alerts are POSTed to as JSON, a "slack" incoming
+// webhook URL, or "pagerduty", with the routing key of an Events API v2
+// integration.
+type AlertNotifier struct {
+	Type       string `json:"type"`
+	URL        string `json:"url,omitempty"`
+	RoutingKey string `json:"routingKey,omitempty"`
+}
+
+// Alert is a rule holding for a node, or for an edge from it.
+type Alert struct {
+	RuleID     string `json:"ruleId"`
+	RuleName   string `json:"ruleName"`
+	TopologyID string `json:"topologyId"`
+	NodeID     string `json:"nodeId"`
+	NodeLabel  string `json:"nodeLabel"`
+	// AdjacentID and AdjacentLabel are of the other end of edges.
+	AdjacentID    string `json:"adjacentId,omitempty"`
+	AdjacentLabel string `json:"adjacentLabel,omitempty"`
+	// Value is the increase of the field, for Increase rules.
+	Value   float64   `json:"value,omitempty"`
+	Summary string    `json:"summary"`
+	Since   time.Time `json:"since"`
+	Firing  bool      `json:"firing"`
+}
+
+// alertRule is an AlertRule, parsed.
+type alertRule struct {
+	AlertRule
+	query    detailed.Search
+	from, to detailed.Search
+	duration time.Duration // For
+	window   time.Duration // of Increase
+}
+
+func parseAlertRule(rule AlertRule) (alertRule, error) {
+	parsed := alertRule{AlertRule: rule}
+	if rule.Name == "" || rule.TopologyID == "" {
+		return parsed, fmt.Errorf("alerting rules need a name and a topologyId")
+	}
+	if _, ok := topologyRegistry.get(rule.TopologyID); !ok {
+		return parsed, fmt.Errorf("no such topology: %s", rule.TopologyID)
+	}
+	if rule.Increase != nil && rule.Edge != nil {
+		return parsed, fmt.Errorf("alerting rules are on either an increase or an edge")
+	}
+	var err error
+	if parsed.query, err = detailed.ParseSearch(rule.Query); err != nil {
+		return parsed, fmt.Errorf("query: %v", err)
+	}
+	if rule.For != "" {
+		if parsed.duration, err = time.ParseDuration(rule.For); err != nil {
+			return parsed, fmt.Errorf("for: %v", err)
+		}
+	}
+	if rule.Increase != nil {
+		if rule.Increase.Field == "" {
+			return parsed, fmt.Errorf("increase: a field is needed")
+		}
+		if parsed.window, err = time.ParseDuration(rule.Increase.Window); err != nil || parsed.window <= 0 {
+			return parsed, fmt.Errorf("increase: a window is needed, as 10m")
+		}
+	}
+	if rule.Edge != nil {
+		if parsed.from, err = detailed.ParseSearch(rule.Edge.From); err != nil {
+			return parsed, fmt.Errorf("edge from: %v", err)
+		}
+		if parsed.to, err = detailed.ParseSearch(rule.Edge.To); err != nil {
+			return parsed, fmt.Errorf("edge to: %v", err)
+		}
+	}
+	for _, n := range rule.Notify {
+		switch n.Type {
+		case "webhook", "slack":
+			if n.URL == "" {
+				return parsed, fmt.Errorf("%s notifiers need a url", n.Type)
+			}
+		case "pagerduty":
+			if n.RoutingKey == "" {
+				return parsed, fmt.Errorf("pagerduty notifiers need a routingKey")
+			}
+		default:
+			return parsed, fmt.Errorf("unknown notifier type: %q", n.Type)
+		}
+	}
+	return parsed, nil
+}
+
+// alertSample is a value of the field of an Increase rule for a node.
+type alertSample struct {
+	timestamp time.Time
+	value     float64
+}
+
+// Alerter evaluates alerting rules against the latest report of a Reporter
+// every interval, notifying of the alerts firing and resolving. Rules are
+// kept in memory and, if path isn't empty, in a JSON file there.
+type Alerter struct {
+	reporter Reporter
+	path     string
+	client   *http.Client
+	quit     chan struct{}
+
+	mtx     sync.Mutex
+	rules   map[string]alertRule
+	alerts  map[string]Alert         // by rule ID, node ID and adjacent ID
+	samples map[string][]alertSample // by rule ID and node ID, oldest first
+}
+
+// NewAlerter makes a new Alerter, loading the rules at path, if it isn't
+// empty, and starts evaluating them.
+func NewAlerter(reporter Reporter, path string, interval time.Duration) (*Alerter, error) {
+	a := &Alerter{
+		reporter: reporter,
+		path:     path,
+		client:   &http.Client{Timeout: alertNotifierTimeout},
+		quit:     make(chan struct{}),
+		rules:    map[string]alertRule{},
+		alerts:   map[string]Alert{},
+		samples:  map[string][]alertSample{},
+	}
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	go a.loop(interval)
+	return a, nil
+}
+
+// Stop stops evaluating rules.
+func (a *Alerter) Stop() {
+	close(a.quit)
+}
+
+func (a *Alerter) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+			if err := a.Evaluate(ctx, mtime.Now()); err != nil {
+				log.Errorf("Error evaluating alerting rules: %v", err)
+			}
+			cancel()
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+func (a *Alerter) load() error {
+	if a.path == "" {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var rules []AlertRule
+	if err := json.Unmarshal(buf, &rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		parsed, err := parseAlertRule(rule)
+		if err != nil {
+			return fmt.Errorf("alerting rule %s: %v", rule.ID, err)
+		}
+		a.rules[rule.ID] = parsed
+	}
+	return nil
+}
+
+// save writes the rules to the file, if there is one. a.mtx must be held.
+func (a *Alerter) save() error {
+	if a.path == "" {
+		return nil
+	}
+	buf, err := json.Marshal(a.sortedRules())
+	if err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+func (a *Alerter) sortedRules() []AlertRule {
+	rules := []AlertRule{}
+	for _, rule := range a.rules {
+		rules = append(rules, rule.AlertRule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Rules returns the rules, by name.
+func (a *Alerter) Rules() []AlertRule {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.sortedRules()
+}
+
+// Rule returns the rule with the ID.
+func (a *Alerter) Rule(id string) (AlertRule, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	rule, ok := a.rules[id]
+	if !ok {
+		return AlertRule{}, ErrAlertRuleNotFound
+	}
+	return rule.AlertRule, nil
+}
+
+// PutRule adds the rule, or replaces the one with its ID, dropping the
+// alerts of the rule replaced.
+func (a *Alerter) PutRule(rule AlertRule) error {
+	parsed, err := parseAlertRule(rule)
+	if err != nil {
+		return err
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.dropAlerts(rule.ID)
+	a.rules[rule.ID] = parsed
+	return a.save()
+}
+
+// DeleteRule deletes the rule with the ID, resolving its alerts.
+func (a *Alerter) DeleteRule(id string) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if _, ok := a.rules[id]; !ok {
+		return ErrAlertRuleNotFound
+	}
+	a.dropAlerts(id)
+	delete(a.rules, id)
+	return a.save()
+}
+
+// dropAlerts resolves the alerts of the rule, and forgets its samples.
+// a.mtx must be held.
+func (a *Alerter) dropAlerts(ruleID string) {
+	prefix := ruleID + "/"
+	for key, alert := range a.alerts {
+		if strings.HasPrefix(key, prefix) {
+			if alert.Firing {
+				a.notify(a.rules[ruleID], alert, true)
+			}
+			delete(a.alerts, key)
+		}
+	}
+	for key := range a.samples {
+		if strings.HasPrefix(key, prefix) {
+			delete(a.samples, key)
+		}
+	}
+}
+
+// Alerts returns the firing alerts, newest first.
+func (a *Alerter) Alerts() []Alert {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	alerts := []Alert{}
+	for _, alert := range a.alerts {
+		if alert.Firing {
+			alerts = append(alerts, alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Since.After(alerts[j].Since) })
+	return alerts
+}
+
+// annotate sets the alerts firing on the nodes of the topology, by rule
+// name. Alerts on edges are on the nodes they come from.
+func (a *Alerter) annotate(topologyID string, nodes detailed.NodeSummaries) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for _, alert := range a.alerts {
+		if !alert.Firing || alert.TopologyID != topologyID {
+			continue
+		}
+		node, ok := nodes[alert.NodeID]
+		if !ok {
+			continue
+		}
+		node.Alerts = append(node.Alerts, alert.RuleName)
+		sort.Strings(node.Alerts)
+		nodes[alert.NodeID] = node
+	}
+}
+
+// Evaluate evaluates the rules against the report at now, firing the
+// alerts which have held for long enough and resolving the others.
+func (a *Alerter) Evaluate(ctx context.Context, now time.Time) error {
+	rpt, err := a.reporter.Report(ctx, now)
+	if err != nil {
+		return err
+	}
+	rc := RenderContextForReporter(a.reporter, rpt)
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for _, rule := range a.rules {
+		renderer, filter, err := topologyRegistry.RendererForTopology(ctx, rule.TopologyID, url.Values(rule.TopologyOptions), rpt)
+		if err != nil {
+			log.Errorf("Error rendering %s for alerting rule %s: %v", rule.TopologyID, rule.Name, err)
+			continue
+		}
+		nodes := detailed.Summaries(rc, render.Render(rpt, renderer, filter).Nodes)
+		a.update(rule, a.conditions(rule, nodes, now), now)
+	}
+	return nil
+}
+
+// conditions returns the alerts the rule holds for, by key.
+func (a *Alerter) conditions(rule alertRule, nodes detailed.NodeSummaries, now time.Time) map[string]Alert {
+	result := map[string]Alert{}
+	add := func(from detailed.NodeSummary, to *detailed.NodeSummary, value float64, summary string) {
+		alert := Alert{
+			RuleID:     rule.ID,
+			RuleName:   rule.Name,
+			TopologyID: rule.TopologyID,
+			NodeID:     from.ID,
+			NodeLabel:  from.Label,
+			Value:      value,
+			Summary:    summary,
+		}
+		if to != nil {
+			alert.AdjacentID, alert.AdjacentLabel = to.ID, to.Label
+		}
+		result[rule.ID+"/"+alert.NodeID+"/"+alert.AdjacentID] = alert
+	}
+
+	switch {
+	case rule.Edge != nil:
+		for _, node := range nodes {
+			if !rule.query.Match(node) || !rule.from.Match(node) {
+				continue
+			}
+			for _, id := range node.Adjacency {
+				to, ok := nodes[id]
+				if ok && rule.to.Match(to) {
+					add(node, &to, 0, fmt.Sprintf("%s: %s -> %s", rule.Name, node.Label, to.Label))
+				}
+			}
+		}
+
+	case rule.Increase != nil:
+		seen := map[string]bool{}
+		for _, node := range nodes {
+			value, ok := detailed.NodeField(node, rule.Increase.Field)
+			if !ok || !rule.query.Match(node) {
+				continue
+			}
+			key := rule.ID + "/" + node.ID
+			seen[key] = true
+			samples := append(a.samples[key], alertSample{now, value})
+			for len(samples) > 1 && samples[0].timestamp.Before(now.Add(-rule.window)) {
+				samples = samples[1:]
+			}
+			a.samples[key] = samples
+			if increase := value - samples[0].value; increase > rule.Increase.Threshold {
+				add(node, nil, increase, fmt.Sprintf("%s: %s %s up by %v in %s", rule.Name, node.Label, rule.Increase.Field, increase, rule.Increase.Window))
+			}
+		}
+		for key := range a.samples {
+			if strings.HasPrefix(key, rule.ID+"/") && !seen[key] {
+				delete(a.samples, key)
+			}
+		}
+
+	default:
+		for _, node := range nodes {
+			if rule.query.Match(node) {
+				add(node, nil, 0, fmt.Sprintf("%s: %s", rule.Name, node.Label))
+			}
+		}
+	}
+	return result
+}
+
+// update fires and resolves the alerts of the rule, given those it holds
+// for now. a.mtx must be held.
+func (a *Alerter) update(rule alertRule, conditions map[string]Alert, now time.Time) {
+	prefix := rule.ID + "/"
+	for key, alert := range a.alerts {
+		if _, ok := conditions[key]; !ok && strings.HasPrefix(key, prefix) {
+			if alert.Firing {
+				a.notify(rule, alert, true)
+			}
+			delete(a.alerts, key)
+		}
+	}
+	for key, alert := range conditions {
+		alert.Since = now
+		if old, ok := a.alerts[key]; ok {
+			alert.Since, alert.Firing = old.Since, old.Firing
+		}
+		if !alert.Firing && now.Sub(alert.Since) >= rule.duration {
+			alert.Firing = true
+			a.notify(rule, alert, false)
+		}
+		a.alerts[key] = alert
+	}
+}
+
+// notify sends the alert, firing or resolved, to the notifiers of the rule.
+func (a *Alerter) notify(rule alertRule, alert Alert, resolved bool) {
+	status := "firing"
+	if resolved {
+		status = "resolved"
+	}
+	log.Infof("Alert %s: %s", status, alert.Summary)
+	for _, n := range rule.Notify {
+		go a.send(n, alert, status)
+	}
+}
+
+func (a *Alerter) send(n AlertNotifier, alert Alert, status string) {
+	var body interface{}
+	target := n.URL
+	switch n.Type {
+	case "webhook":
+		body = struct {
+			Status string `json:"status"`
+			Alert  Alert  `json:"alert"`
+		}{status, alert}
+	case "slack":
+		body = map[string]string{"text": fmt.Sprintf("[%s] %s", strings.ToUpper(status), alert.Summary)}
+	case "pagerduty":
+		action := "trigger"
+		if status == "resolved" {
+			action = "resolve"
+		}
+		if target == "" {
+			target = PagerDutyEventsURL
+		}
+		body = map[string]interface{}{
+			"routing_key":  n.RoutingKey,
+			"event_action": action,
+			"dedup_key":    alert.RuleID + "/" + alert.NodeID + "/" + alert.AdjacentID,
+			"payload": map[string]interface{}{
+				"summary":        alert.Summary,
+				"source":         alert.NodeLabel,
+				"severity":       "warning",
+				"custom_details": alert,
+			},
+		}
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		log.Errorf("Alert: cannot encode notification: %v", err)
+		return
+	}
+	resp, err := a.client.Post(target, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		log.Errorf("Alert: cannot notify %s: %v", n.Type, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Errorf("Alert: %s responded with %s", n.Type, resp.Status)
+	}
+}
+
+// RegisterAlertRoutes registers the routes for managing alerting rules, and
+// listing the alerts firing, with a http mux.
+func RegisterAlertRoutes(router *mux.Router, alerter *Alerter) {
+	router.Methods("GET").Path("/api/alerts").
+		HandlerFunc(requestContextDecorator(handleListAlerts(alerter)))
+	router.Methods("GET").Path("/api/alerts/rules").
+		HandlerFunc(requestContextDecorator(handleListAlertRules(alerter)))
+	router.Methods("POST").Path("/api/alerts/rules").
+		HandlerFunc(requestContextDecorator(handlePutAlertRule(alerter, true)))
+	router.Methods("GET").Path("/api/alerts/rules/{id}").
+		HandlerFunc(requestContextDecorator(handleGetAlertRule(alerter)))
+	router.Methods("PUT").Path("/api/alerts/rules/{id}").
+		HandlerFunc(requestContextDecorator(handlePutAlertRule(alerter, false)))
+	router.Methods("DELETE").Path("/api/alerts/rules/{id}").
+		HandlerFunc(requestContextDecorator(handleDeleteAlertRule(alerter)))
+}
+
+func respondWithAlertError(w http.ResponseWriter, err error) {
+	if err == ErrAlertRuleNotFound {
+		respondWith(w, http.StatusNotFound, err)
+		return
+	}
+	respondWith(w, http.StatusInternalServerError, err)
+}
+
+func handleListAlerts(alerter *Alerter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, alerter.Alerts())
+	}
+}
+
+func handleListAlertRules(alerter *Alerter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, alerter.Rules())
+	}
+}
+
+func handleGetAlertRule(alerter *Alerter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		rule, err := alerter.Rule(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithAlertError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, rule)
+	}
+}
+
+// handlePutAlertRule creates rules, given create, or else replaces them.
+func handlePutAlertRule(alerter *Alerter, create bool) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var rule AlertRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		status := http.StatusOK
+		if create {
+			rule.ID = strconv.FormatInt(rand.Int63(), 16)
+			status = http.StatusCreated
+		} else {
+			old, err := alerter.Rule(mux.Vars(r)["id"])
+			if err != nil {
+				respondWithAlertError(w, err)
+				return
+			}
+			rule.ID = old.ID
+		}
+		if _, err := parseAlertRule(rule); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := alerter.PutRule(rule); err != nil {
+			respondWithAlertError(w, err)
+			return
+		}
+		respondWith(w, status, rule)
+	}
+}
+
+func handleDeleteAlertRule(alerter *Alerter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := alerter.DeleteRule(mux.Vars(r)["id"]); err != nil {
+			respondWithAlertError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
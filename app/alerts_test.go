@@ -0,0 +1,145 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+// restartingReporter serves the fixture, with the client container restarted
+// the given number of times.
+type restartingReporter struct {
+	app.StaticCollector
+	mtx      sync.Mutex
+	restarts int
+}
+
+func (r *restartingReporter) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	rpt := fixture.Report.Copy()
+	rpt.Container.Nodes[fixture.ClientContainerNodeID] = rpt.Container.Nodes[fixture.ClientContainerNodeID].
+		WithLatests(map[string]string{docker.ContainerRestartCount: strconv.Itoa(r.restarts)})
+	return rpt, nil
+}
+
+func (r *restartingReporter) restart(n int) {
+	r.mtx.Lock()
+	r.restarts = n
+	r.mtx.Unlock()
+}
+
+func TestAlerter(t *testing.T) {
+	notifications := make(chan map[string]interface{}, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification map[string]interface{}
+		body, _ := ioutil.ReadAll(r.Body)
+		ok(t, json.Unmarshal(body, &notification))
+		notifications <- notification
+	}))
+	defer webhook.Close()
+	notified := func() (string, string) {
+		select {
+		case n := <-notifications:
+			return n["status"].(string), n["alert"].(map[string]interface{})["ruleName"].(string)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a notification")
+		}
+		return "", ""
+	}
+
+	reporter := &restartingReporter{StaticCollector: app.StaticCollector(fixture.Report), restarts: 1}
+	alerter, err := app.NewAlerter(reporter, "", time.Hour)
+	ok(t, err)
+	defer alerter.Stop()
+
+	router := mux.NewRouter()
+	app.RegisterAlertRoutes(router, alerter)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: reporter, Alerter: alerter}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	res, _ := checkRequest(t, ts, "POST", "/api/alerts/rules", []byte(`{"name": "foo", "topologyId": "foo"}`))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = checkRequest(t, ts, "POST", "/api/alerts/rules", []byte(`{"name": "foo", "topologyId": "containers", "query": "cpu >"}`))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+
+	notify := `"notify": [{"type": "webhook", "url": "` + webhook.URL + `"}]`
+	for _, rule := range []string{
+		`{"name": "restarts", "topologyId": "containers", "query": "label:client",
+		  "increase": {"field": "Restart #", "threshold": 5, "window": "10m"}, ` + notify + `}`,
+		`{"name": "client to server", "topologyId": "containers",
+		  "edge": {"from": "label:client", "to": "label:server"}, ` + notify + `}`,
+		`{"name": "server", "topologyId": "containers", "query": "image:image/server", "for": "1m"}`,
+	} {
+		res, _ := checkRequest(t, ts, "POST", "/api/alerts/rules", []byte(rule))
+		equals(t, http.StatusCreated, res.StatusCode)
+	}
+	var rules []app.AlertRule
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/alerts/rules"), &rules))
+	equals(t, 3, len(rules))
+
+	firing := func() []string {
+		var alerts []app.Alert
+		ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/alerts"), &alerts))
+		names := []string{}
+		for _, alert := range alerts {
+			names = append(names, alert.RuleName)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// Edges alert right away; the server, only once it has matched for a
+	// minute.
+	start := time.Now()
+	ok(t, alerter.Evaluate(context.Background(), start))
+	equals(t, []string{"client to server"}, firing())
+	status, name := notified()
+	equals(t, "firing", status)
+	equals(t, "client to server", name)
+
+	reporter.restart(10)
+	ok(t, alerter.Evaluate(context.Background(), start.Add(2*time.Minute)))
+	equals(t, []string{"client to server", "restarts", "server"}, firing())
+	status, name = notified()
+	equals(t, "firing", status)
+	equals(t, "restarts", name)
+
+	// Firing alerts are overlaid on the nodes of the topology
+	var topology app.APITopology
+	ok(t, codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers"), &codec.JsonHandle{}).Decode(&topology))
+	equals(t, []string{"client to server", "restarts"}, topology.Nodes[fixture.ClientContainerNodeID].Alerts)
+	equals(t, []string{"server"}, topology.Nodes[fixture.ServerContainerNodeID].Alerts)
+
+	// Restarts drop out of the window
+	ok(t, alerter.Evaluate(context.Background(), start.Add(15*time.Minute)))
+	equals(t, []string{"client to server", "server"}, firing())
+	status, name = notified()
+	equals(t, "resolved", status)
+	equals(t, "restarts", name)
+
+	for _, rule := range rules {
+		res, _ := checkRequest(t, ts, "DELETE", "/api/alerts/rules/"+rule.ID, nil)
+		equals(t, http.StatusNoContent, res.StatusCode)
+	}
+	equals(t, []string{}, firing())
+	status, name = notified()
+	equals(t, "resolved", status)
+	equals(t, "client to server", name)
+}
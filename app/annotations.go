@@ -0,0 +1,369 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// ErrAnnotationNotFound is returned by AnnotationStores asked for
+// annotations they don't have.
+var ErrAnnotationNotFound = errors.New("annotation not found")
+
+// AnnotationStore keeps the annotations users leave on nodes and edges.
+type AnnotationStore interface {
+	// List returns the annotations of the user making the request.
+	List(ctx context.Context) ([]detailed.Annotation, error)
+	Get(ctx context.Context, id string) (detailed.Annotation, error)
+	// Put adds the annotation, or replaces the one with its ID.
+	Put(ctx context.Context, annotation detailed.Annotation) error
+	Delete(ctx context.Context, id string) error
+}
+
+// NewMemoryAnnotationStore makes an AnnotationStore keeping annotations in
+// memory, for as long as the app runs. userIDer identifies the user of a
+// request.
+func NewMemoryAnnotationStore(userIDer func(context.Context) (string, error)) AnnotationStore {
+	return &memoryAnnotationStore{userIDer: userIDer, annotations: map[string]map[string]detailed.Annotation{}}
+}
+
+type memoryAnnotationStore struct {
+	userIDer func(context.Context) (string, error)
+
+	sync.Mutex
+	annotations map[string]map[string]detailed.Annotation // by user ID, then annotation ID
+}
+
+func (s *memoryAnnotationStore) List(ctx context.Context) ([]detailed.Annotation, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	annotations := []detailed.Annotation{}
+	for _, annotation := range s.annotations[userID] {
+		annotations = append(annotations, annotation)
+	}
+	return annotations, nil
+}
+
+func (s *memoryAnnotationStore) Get(ctx context.Context, id string) (detailed.Annotation, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return detailed.Annotation{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	annotation, ok := s.annotations[userID][id]
+	if !ok {
+		return detailed.Annotation{}, ErrAnnotationNotFound
+	}
+	return annotation, nil
+}
+
+func (s *memoryAnnotationStore) Put(ctx context.Context, annotation detailed.Annotation) error {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.annotations[userID] == nil {
+		s.annotations[userID] = map[string]detailed.Annotation{}
+	}
+	s.annotations[userID][annotation.ID] = annotation
+	return nil
+}
+
+func (s *memoryAnnotationStore) Delete(ctx context.Context, id string) error {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.annotations[userID][id]; !ok {
+		return ErrAnnotationNotFound
+	}
+	delete(s.annotations[userID], id)
+	return nil
+}
+
+// NewFileAnnotationStore makes an AnnotationStore keeping the annotations
+// of each user in a JSON file in dir. userIDer identifies the user of a
+// request.
+func NewFileAnnotationStore(userIDer func(context.Context) (string, error), dir string) (AnnotationStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileAnnotationStore{userIDer: userIDer, dir: dir}, nil
+}
+
+// fileAnnotationStore keeps annotations in a file per user, as there are
+// many more of them than of views, and they are all read on every render.
+type fileAnnotationStore struct {
+	userIDer func(context.Context) (string, error)
+	dir      string
+
+	sync.Mutex // serialises the updates of files
+}
+
+func (s *fileAnnotationStore) path(ctx context.Context) (string, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return filepath.Join(s.dir, "annotations.json"), nil
+	}
+	return filepath.Join(s.dir, "annotations-"+url.PathEscape(userID)+".json"), nil
+}
+
+// read returns the annotations in the file at path, by ID.
+func (s *fileAnnotationStore) read(path string) (map[string]detailed.Annotation, error) {
+	annotations := map[string]detailed.Annotation{}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return annotations, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return annotations, json.Unmarshal(buf, &annotations)
+}
+
+func (s *fileAnnotationStore) write(path string, annotations map[string]detailed.Annotation) error {
+	buf, err := json.Marshal(annotations)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so annotations are never read half
+	// written
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *fileAnnotationStore) List(ctx context.Context) ([]detailed.Annotation, error) {
+	path, err := s.path(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID, err := s.read(path)
+	if err != nil {
+		return nil, err
+	}
+	annotations := []detailed.Annotation{}
+	for _, annotation := range byID {
+		annotations = append(annotations, annotation)
+	}
+	return annotations, nil
+}
+
+func (s *fileAnnotationStore) Get(ctx context.Context, id string) (detailed.Annotation, error) {
+	path, err := s.path(ctx)
+	if err != nil {
+		return detailed.Annotation{}, err
+	}
+	annotations, err := s.read(path)
+	if err != nil {
+		return detailed.Annotation{}, err
+	}
+	annotation, ok := annotations[id]
+	if !ok {
+		return detailed.Annotation{}, ErrAnnotationNotFound
+	}
+	return annotation, nil
+}
+
+func (s *fileAnnotationStore) Put(ctx context.Context, annotation detailed.Annotation) error {
+	path, err := s.path(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	annotations, err := s.read(path)
+	if err != nil {
+		return err
+	}
+	annotations[annotation.ID] = annotation
+	return s.write(path, annotations)
+}
+
+func (s *fileAnnotationStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	annotations, err := s.read(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := annotations[id]; !ok {
+		return ErrAnnotationNotFound
+	}
+	delete(annotations, id)
+	return s.write(path, annotations)
+}
+
+// annotate adds the annotations of the user making the request to the
+// nodes of the topology, if there is somewhere to get them from.
+func annotate(ctx context.Context, annotations AnnotationStore, topologyID string, nodes detailed.NodeSummaries) {
+	if annotations == nil {
+		return
+	}
+	list, err := annotations.List(ctx)
+	if err != nil {
+		log.Warnf("Error getting annotations: %v", err)
+		return
+	}
+	detailed.Annotate(topologyID, nodes, list)
+}
+
+// RegisterAnnotationRoutes registers the routes for annotating nodes and
+// edges with a http mux.
+func RegisterAnnotationRoutes(router *mux.Router, annotations AnnotationStore) {
+	router.Methods("GET").Path("/api/annotations").
+		HandlerFunc(requestContextDecorator(handleListAnnotations(annotations)))
+	router.Methods("POST").Path("/api/annotations").
+		HandlerFunc(requestContextDecorator(handlePutAnnotation(annotations, true)))
+	router.Methods("GET").Path("/api/annotations/{id}").
+		HandlerFunc(requestContextDecorator(handleGetAnnotation(annotations)))
+	router.Methods("PUT").Path("/api/annotations/{id}").
+		HandlerFunc(requestContextDecorator(handlePutAnnotation(annotations, false)))
+	router.Methods("DELETE").Path("/api/annotations/{id}").
+		HandlerFunc(requestContextDecorator(handleDeleteAnnotation(annotations)))
+}
+
+func respondWithAnnotationError(w http.ResponseWriter, err error) {
+	if err == ErrAnnotationNotFound {
+		respondWith(w, http.StatusNotFound, err)
+		return
+	}
+	respondWith(w, http.StatusInternalServerError, err)
+}
+
+// handleListAnnotations lists annotations, oldest first, of the topology
+// and node given by the topologyId and nodeId parameters, if they are.
+// Annotations on edges are of the nodes at both ends.
+func handleListAnnotations(annotations AnnotationStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		list, err := annotations.List(ctx)
+		if err != nil {
+			respondWithAnnotationError(w, err)
+			return
+		}
+		var (
+			topologyID = r.FormValue("topologyId")
+			nodeID     = r.FormValue("nodeId")
+			result     = []detailed.Annotation{}
+		)
+		for _, annotation := range list {
+			if topologyID != "" && annotation.TopologyID != topologyID {
+				continue
+			}
+			if nodeID != "" && annotation.NodeID != nodeID && annotation.AdjacentID != nodeID {
+				continue
+			}
+			result = append(result, annotation)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Created.Before(result[j].Created) })
+		respondWith(w, http.StatusOK, result)
+	}
+}
+
+func handleGetAnnotation(annotations AnnotationStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		annotation, err := annotations.Get(ctx, mux.Vars(r)["id"])
+		if err != nil {
+			respondWithAnnotationError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, annotation)
+	}
+}
+
+func validateAnnotation(annotation detailed.Annotation) error {
+	if annotation.TopologyID == "" || annotation.NodeID == "" || annotation.Text == "" {
+		return fmt.Errorf("annotations need a topologyId, a nodeId and text")
+	}
+	switch annotation.Severity {
+	case "", detailed.SeverityInfo, detailed.SeverityWarning, detailed.SeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity: %q", annotation.Severity)
+	}
+	for _, link := range annotation.Links {
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("links must be http or https URLs: %q", link)
+		}
+	}
+	return nil
+}
+
+// handlePutAnnotation creates annotations, given create, or else replaces
+// them.
+func handlePutAnnotation(annotations AnnotationStore, create bool) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var annotation detailed.Annotation
+		if err := json.NewDecoder(r.Body).Decode(&annotation); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := validateAnnotation(annotation); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+
+		now := mtime.Now()
+		status := http.StatusOK
+		if create {
+			annotation.ID = strconv.FormatInt(rand.Int63(), 16)
+			annotation.Created = now
+			status = http.StatusCreated
+		} else {
+			old, err := annotations.Get(ctx, mux.Vars(r)["id"])
+			if err != nil {
+				respondWithAnnotationError(w, err)
+				return
+			}
+			annotation.ID, annotation.Created = old.ID, old.Created
+		}
+		annotation.Updated = now
+		if err := annotations.Put(ctx, annotation); err != nil {
+			respondWithAnnotationError(w, err)
+			return
+		}
+		respondWith(w, status, annotation)
+	}
+}
+
+func handleDeleteAnnotation(annotations AnnotationStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := annotations.Delete(ctx, mux.Vars(r)["id"]); err != nil {
+			respondWithAnnotationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
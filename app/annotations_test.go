@@ -0,0 +1,126 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	fileStore, err := app.NewFileAnnotationStore(noUserID, dir)
+	ok(t, err)
+
+	for name, store := range map[string]app.AnnotationStore{
+		"memory": app.NewMemoryAnnotationStore(noUserID),
+		"file":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) { testAnnotations(t, store) })
+	}
+}
+
+func testAnnotations(t *testing.T, store app.AnnotationStore) {
+	router := mux.NewRouter()
+	app.RegisterAnnotationRoutes(router, store)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: app.StaticCollector(fixture.Report), Annotations: store}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	decode := func(body []byte, v interface{}) {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("JSON parse error: %s: %s", err, body)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"topologyId": "containers", "nodeId": "foo"}`,
+		`{"topologyId": "containers", "nodeId": "foo", "text": "bar", "severity": "dire"}`,
+		`{"topologyId": "containers", "nodeId": "foo", "text": "bar", "links": ["javascript:alert(1)"]}`,
+	} {
+		res, _ := checkRequest(t, ts, "POST", "/api/annotations", []byte(invalid))
+		equals(t, http.StatusBadRequest, res.StatusCode)
+	}
+
+	post := func(annotation detailed.Annotation) detailed.Annotation {
+		buf, err := json.Marshal(annotation)
+		ok(t, err)
+		res, body := checkRequest(t, ts, "POST", "/api/annotations", buf)
+		equals(t, http.StatusCreated, res.StatusCode)
+		var created detailed.Annotation
+		decode(body, &created)
+		return created
+	}
+	node := post(detailed.Annotation{
+		TopologyID: "containers",
+		NodeID:     fixture.ServerContainerNodeID,
+		Text:       "restarted to pick up new certs",
+		Links:      []string{"https://example.com/incidents/42"},
+		Severity:   detailed.SeverityInfo,
+	})
+	edge := post(detailed.Annotation{
+		TopologyID: "containers",
+		NodeID:     fixture.ClientContainerNodeID,
+		AdjacentID: fixture.ServerContainerNodeID,
+		Text:       "slow since the deploy",
+		Severity:   detailed.SeverityWarning,
+	})
+	// There is no edge the other way, so this isn't shown
+	post(detailed.Annotation{
+		TopologyID: "containers",
+		NodeID:     fixture.ServerContainerNodeID,
+		AdjacentID: fixture.ClientContainerNodeID,
+		Text:       "not there",
+	})
+
+	res, body := checkRequest(t, ts, "PUT", "/api/annotations/"+edge.ID, []byte(`{
+		"topologyId": "containers",
+		"nodeId": "`+fixture.ClientContainerNodeID+`",
+		"adjacentId": "`+fixture.ServerContainerNodeID+`",
+		"text": "slow since the deploy, rolled back",
+		"severity": "critical"
+	}`))
+	equals(t, http.StatusOK, res.StatusCode)
+	var updated detailed.Annotation
+	decode(body, &updated)
+	equals(t, edge.ID, updated.ID)
+	equals(t, true, updated.Created.Equal(edge.Created))
+
+	var annotations []detailed.Annotation
+	decode(getRawJSON(t, ts, "/api/annotations?topologyId=containers&nodeId="+url.QueryEscape(fixture.ClientContainerNodeID)), &annotations)
+	equals(t, 2, len(annotations))
+
+	// Annotations are merged into the topology
+	var topology app.APITopology
+	ok(t, codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers"), &codec.JsonHandle{}).Decode(&topology))
+	server := topology.Nodes[fixture.ServerContainerNodeID].Annotations
+	equals(t, 1, len(server))
+	equals(t, node.ID, server[0].ID)
+	equals(t, node.Links, server[0].Links)
+	client := topology.Nodes[fixture.ClientContainerNodeID].Annotations
+	equals(t, 1, len(client))
+	equals(t, detailed.SeverityCritical, client[0].Severity)
+
+	// And into node details
+	var details app.APINode
+	ok(t, codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers/"+fixture.ServerContainerNodeID), &codec.JsonHandle{}).Decode(&details))
+	equals(t, 1, len(details.Node.Annotations))
+
+	res, _ = checkRequest(t, ts, "DELETE", "/api/annotations/"+node.ID, nil)
+	equals(t, http.StatusNoContent, res.StatusCode)
+	is404(t, ts, "/api/annotations/"+node.ID)
+	res, _ = checkRequest(t, ts, "PUT", "/api/annotations/"+node.ID, []byte(`{"topologyId": "hosts", "nodeId": "foo", "text": "bar"}`))
+	equals(t, http.StatusNotFound, res.StatusCode)
+}
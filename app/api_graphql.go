@@ -0,0 +1,468 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// The GraphQL API is a read-only view of the rendered topologies, for
+// tooling to ask precisely what it needs of them. Its schema is:
+//
+//   type Query {
+//     topologies(timestamp: String): [Topology]
+//     topology(id: String!, timestamp: String, options: TopologyOptions): Topology
+//   }
+//   type Topology {
+//     id: String
+//     name: String
+//     rank: Int
+//     subTopologies: [Topology]
+//     stats: Stats            # nodeCount, nonpseudoNodeCount, edgeCount, filteredNodes
+//     nodes(search: String): [Node]
+//     node(id: String!): Node
+//     edges: [Edge]           # source: Node, target: Node
+//   }
+//   type Node {
+//     id, label, labelMinor, rank, shape: String
+//     stack, pseudo: Boolean
+//     metadata(id: String): [Metadata]   # id, label, value, dataType, priority
+//     metrics(id: String): [Metric]      # id, label, format, group, value, min, max
+//     parents(topologyId: String): [Parent]  # id, label, topologyId
+//     adjacency: [Node]
+//   }
+//
+// Timestamps are RFC3339, and default to now. The options of a topology
+// are those of /api/topology/{topology}, as an object of strings (or lists
+// of them, for label), such as {namespace: "default", search: "nginx"}.
+
+// GraphQLRequest is a query to the GraphQL API.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is returned by the GraphQL API.
+type GraphQLResponse struct {
+	Data   gqlResult      `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError is an error answering a query to the GraphQL API.
+type GraphQLError struct {
+	Message string `json:"message"`
+}
+
+func graphQLErrorResponse(err error) GraphQLResponse {
+	return GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}
+}
+
+// handleGraphQL returns a handler for the GraphQL API. Queries are taken
+// as the query parameters of GETs, or JSON, or plain GraphQL, POSTed.
+func (r *Registry) handleGraphQL(rep Reporter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		request, err := readGraphQLRequest(req)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, graphQLErrorResponse(err))
+			return
+		}
+		selections, err := gqlParse(request.Query, request.OperationName, request.Variables)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, graphQLErrorResponse(err))
+			return
+		}
+		query := &gqlQuery{ctx: ctx, rep: rep, registry: r, reports: map[time.Time]report.Report{}}
+		data, err := gqlExecute(query, selections)
+		if err != nil {
+			respondWith(w, http.StatusOK, graphQLErrorResponse(err))
+			return
+		}
+		respondWith(w, http.StatusOK, GraphQLResponse{Data: data})
+	}
+}
+
+func readGraphQLRequest(req *http.Request) (GraphQLRequest, error) {
+	var request GraphQLRequest
+	if req.Method == "GET" {
+		values := req.URL.Query()
+		request.Query = values.Get("query")
+		request.OperationName = values.Get("operationName")
+		if variables := values.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return request, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+		return request, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return request, err
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/graphql") {
+		request.Query = string(body)
+	} else if err := json.Unmarshal(body, &request); err != nil {
+		return request, err
+	}
+	return request, nil
+}
+
+// gqlQuery is the root of the GraphQL API. The reports it is asked for are
+// kept for the rest of the query.
+type gqlQuery struct {
+	ctx      context.Context
+	rep      Reporter
+	registry *Registry
+	reports  map[time.Time]report.Report
+}
+
+func (q *gqlQuery) typeName() string { return "Query" }
+
+func (q *gqlQuery) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "topologies":
+		ctx, rpt, rc, err := q.report(args)
+		if err != nil {
+			return nil, err
+		}
+		var topologies []gqlObject
+		q.registry.walk(func(desc APITopologyDesc) {
+			topologies = append(topologies, q.topology(ctx, desc, rpt, rc, nil))
+		})
+		var plugins []string
+		for name := range rpt.PluginTopologies {
+			if _, ok := q.registry.get(name); !ok && rpt.IsPluginTopology(name) {
+				plugins = append(plugins, name)
+			}
+		}
+		sort.Strings(plugins)
+		for _, name := range plugins {
+			desc, _ := q.registry.getForReport(name, rpt)
+			topologies = append(topologies, q.topology(ctx, desc, rpt, rc, nil))
+		}
+		return topologies, nil
+	case "topology":
+		id, err := stringArg(args, "id", true)
+		if err != nil {
+			return nil, err
+		}
+		options, err := optionsArg(args, "options")
+		if err != nil {
+			return nil, err
+		}
+		ctx, rpt, rc, err := q.report(args)
+		if err != nil {
+			return nil, err
+		}
+		desc, ok := q.registry.getForReport(id, rpt)
+		if !ok {
+			return nil, nil
+		}
+		return q.topology(ctx, desc, rpt, rc, options), nil
+	}
+	return nil, errUnknownField
+}
+
+// report returns the report at the timestamp argument, with the context to
+// render it in.
+func (q *gqlQuery) report(args map[string]interface{}) (context.Context, report.Report, detailed.RenderContext, error) {
+	ctx, timestamp := q.ctx, mtime.Now()
+	if s, err := stringArg(args, "timestamp", false); err != nil {
+		return ctx, report.Report{}, detailed.RenderContext{}, err
+	} else if s != "" {
+		if timestamp, err = time.Parse(time.RFC3339, s); err != nil {
+			return ctx, report.Report{}, detailed.RenderContext{}, fmt.Errorf("invalid timestamp: %v", err)
+		}
+		ctx = historicContext(ctx)
+	}
+	rpt, ok := q.reports[timestamp]
+	if !ok {
+		var err error
+		if rpt, err = q.rep.Report(q.ctx, timestamp); err != nil {
+			return ctx, rpt, detailed.RenderContext{}, err
+		}
+		q.reports[timestamp] = rpt
+	}
+	return ctx, rpt, RenderContextForReporter(q.rep, rpt), nil
+}
+
+func (q *gqlQuery) topology(ctx context.Context, desc APITopologyDesc, rpt report.Report, rc detailed.RenderContext, options url.Values) *gqlTopology {
+	return &gqlTopology{ctx: ctx, registry: q.registry, desc: desc, rpt: rpt, rc: rc, options: options}
+}
+
+// gqlTopology is a topology, rendered as it is first asked for its nodes.
+type gqlTopology struct {
+	ctx      context.Context
+	registry *Registry
+	desc     APITopologyDesc
+	rpt      report.Report
+	rc       detailed.RenderContext
+	options  url.Values
+
+	rendered bool
+	nodes    detailed.NodeSummaries
+	stats    topologyStats
+}
+
+func (t *gqlTopology) typeName() string { return "Topology" }
+
+func (t *gqlTopology) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return t.desc.id, nil
+	case "name":
+		return t.desc.Name, nil
+	case "rank":
+		return t.desc.Rank, nil
+	case "subTopologies":
+		var topologies []gqlObject
+		for _, sub := range t.desc.SubTopologies {
+			topologies = append(topologies, &gqlTopology{ctx: t.ctx, registry: t.registry, desc: sub, rpt: t.rpt, rc: t.rc, options: t.options})
+		}
+		return topologies, nil
+	}
+
+	if err := t.render(); err != nil {
+		return nil, err
+	}
+	switch name {
+	case "stats":
+		return gqlFields{name: "Stats", fields: map[string]interface{}{
+			"nodeCount":          t.stats.NodeCount,
+			"nonpseudoNodeCount": t.stats.NonpseudoNodeCount,
+			"edgeCount":          t.stats.EdgeCount,
+			"filteredNodes":      t.stats.FilteredNodes,
+		}}, nil
+	case "nodes":
+		search, err := stringArg(args, "search", false)
+		if err != nil {
+			return nil, err
+		}
+		query, err := detailed.ParseSearch(search)
+		if err != nil {
+			return nil, err
+		}
+		var nodes []gqlObject
+		for _, id := range t.nodeIDs() {
+			if summary := t.nodes[id]; query.Match(summary) {
+				nodes = append(nodes, &gqlNode{summary: summary, topology: t})
+			}
+		}
+		return nodes, nil
+	case "node":
+		id, err := stringArg(args, "id", true)
+		if err != nil {
+			return nil, err
+		}
+		return t.node(id), nil
+	case "edges":
+		var edges []gqlObject
+		for _, id := range t.nodeIDs() {
+			for _, adjacent := range t.nodes[id].Adjacency {
+				if target := t.node(adjacent); target != nil {
+					edges = append(edges, gqlFields{name: "Edge", fields: map[string]interface{}{
+						"source": t.node(id),
+						"target": target,
+					}})
+				}
+			}
+		}
+		return edges, nil
+	}
+	return nil, errUnknownField
+}
+
+func (t *gqlTopology) render() error {
+	if t.rendered {
+		return nil
+	}
+	renderer, filter, err := t.registry.RendererForTopology(t.ctx, t.desc.id, t.options, t.rpt)
+	if err != nil {
+		return err
+	}
+	query, err := parseTopologyQuery(t.options)
+	if err != nil {
+		return err
+	}
+	transformer := query.transformer(t.rc, filter)
+	t.nodes = query.apply(detailed.Summaries(t.rc, render.Render(t.rpt, renderer, transformer).Nodes))
+	t.stats = computeStats(t.rpt, renderer, transformer)
+	t.rendered = true
+	return nil
+}
+
+func (t *gqlTopology) nodeIDs() []string {
+	ids := make([]string, 0, len(t.nodes))
+	for id := range t.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// node returns the node with the id, or nil if there is none.
+func (t *gqlTopology) node(id string) gqlObject {
+	summary, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+	return &gqlNode{summary: summary, topology: t}
+}
+
+// gqlNode is a node of a rendered topology.
+type gqlNode struct {
+	summary  detailed.NodeSummary
+	topology *gqlTopology
+}
+
+func (n *gqlNode) typeName() string { return "Node" }
+
+func (n *gqlNode) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return n.summary.ID, nil
+	case "label":
+		return n.summary.Label, nil
+	case "labelMinor":
+		return n.summary.LabelMinor, nil
+	case "rank":
+		return n.summary.Rank, nil
+	case "shape":
+		return n.summary.Shape, nil
+	case "stack":
+		return n.summary.Stack, nil
+	case "pseudo":
+		return n.summary.Pseudo, nil
+	case "metadata":
+		id, err := stringArg(args, "id", false)
+		if err != nil {
+			return nil, err
+		}
+		var rows []gqlObject
+		for _, row := range n.summary.Metadata {
+			if id == "" || row.ID == id {
+				rows = append(rows, gqlFields{name: "Metadata", fields: map[string]interface{}{
+					"id":       row.ID,
+					"label":    row.Label,
+					"value":    row.Value,
+					"dataType": row.Datatype,
+					"priority": row.Priority,
+				}})
+			}
+		}
+		return rows, nil
+	case "metrics":
+		id, err := stringArg(args, "id", false)
+		if err != nil {
+			return nil, err
+		}
+		var rows []gqlObject
+		for _, row := range n.summary.Metrics {
+			if id != "" && row.ID != id {
+				continue
+			}
+			fields := map[string]interface{}{
+				"id":     row.ID,
+				"label":  row.Label,
+				"format": row.Format,
+				"group":  row.Group,
+				"value":  nil,
+				"min":    nil,
+				"max":    nil,
+			}
+			if !row.ValueEmpty {
+				fields["value"] = row.Value
+			}
+			if row.Metric != nil {
+				fields["min"], fields["max"] = row.Metric.Min, row.Metric.Max
+			}
+			rows = append(rows, gqlFields{name: "Metric", fields: fields})
+		}
+		return rows, nil
+	case "parents":
+		topologyID, err := stringArg(args, "topologyId", false)
+		if err != nil {
+			return nil, err
+		}
+		var parents []gqlObject
+		for _, parent := range n.summary.Parents {
+			if topologyID == "" || parent.TopologyID == topologyID {
+				parents = append(parents, gqlFields{name: "Parent", fields: map[string]interface{}{
+					"id":         parent.ID,
+					"label":      parent.Label,
+					"topologyId": parent.TopologyID,
+				}})
+			}
+		}
+		return parents, nil
+	case "adjacency":
+		var nodes []gqlObject
+		for _, id := range n.summary.Adjacency {
+			if node := n.topology.node(id); node != nil {
+				nodes = append(nodes, node)
+			}
+		}
+		return nodes, nil
+	}
+	return nil, errUnknownField
+}
+
+// stringArg returns the string argument name, or "" if it isn't given and
+// isn't required.
+func stringArg(args map[string]interface{}, name string, required bool) (string, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		if required {
+			return "", fmt.Errorf("argument %q is required", name)
+		}
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+	return s, nil
+}
+
+// optionsArg returns the topology options argument name as url.Values.
+func optionsArg(args map[string]interface{}, name string) (url.Values, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	options, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("argument %q must be an object", name)
+	}
+	values := url.Values{}
+	for key, option := range options {
+		switch option := option.(type) {
+		case string:
+			values.Add(key, option)
+		case []interface{}:
+			for _, o := range option {
+				s, ok := o.(string)
+				if !ok {
+					return nil, fmt.Errorf("option %q must be a string or a list of them", key)
+				}
+				values.Add(key, s)
+			}
+		default:
+			return nil, fmt.Errorf("option %q must be a string or a list of them", key)
+		}
+	}
+	return values, nil
+}
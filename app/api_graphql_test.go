@@ -0,0 +1,66 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPIGraphQL(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	query := func(q string, variables map[string]interface{}) map[string]interface{} {
+		body, err := json.Marshal(map[string]interface{}{"query": q, "variables": variables})
+		ok(t, err)
+		res, body := checkRequest(t, ts, "POST", "/api/graphql", body)
+		equals(t, 200, res.StatusCode)
+		var response map[string]interface{}
+		ok(t, json.Unmarshal(body, &response))
+		return response
+	}
+
+	response := query(`query Containers($id: String!) {
+		topology(id: "containers") {
+			name
+			server: node(id: $id) {
+				label
+				metadata(id: "docker_image_name") { value }
+				adjacency { id }
+			}
+		}
+	}`, map[string]interface{}{"id": fixture.ServerContainerNodeID})
+	if errs, found := response["errors"]; found {
+		t.Fatal(errs)
+	}
+	topology := response["data"].(map[string]interface{})["topology"].(map[string]interface{})
+	equals(t, "Containers", topology["name"])
+	server := topology["server"].(map[string]interface{})
+	equals(t, "server", server["label"])
+	equals(t, []interface{}{map[string]interface{}{"value": fixture.ServerContainerImageName}}, server["metadata"])
+	equals(t, []interface{}{}, server["adjacency"])
+
+	// Nodes can be searched as in the UI
+	response = query(`{ topology(id: "containers", options: {search: "image:image/server"}) { nodes { id } } }`, nil)
+	nodes := response["data"].(map[string]interface{})["topology"].(map[string]interface{})["nodes"].([]interface{})
+	equals(t, 1, len(nodes))
+	equals(t, fixture.ServerContainerNodeID, nodes[0].(map[string]interface{})["id"])
+
+	// Unknown topologies are null
+	response = query(`{ topology(id: "foo") { name } }`, nil)
+	equals(t, map[string]interface{}{"topology": nil}, response["data"])
+
+	// Unknown fields are errors
+	response = query(`{ topologies { foo } }`, nil)
+	if _, found := response["errors"]; !found {
+		t.Errorf("Expected errors, have %v", response)
+	}
+
+	// As are queries which don't parse
+	is400(t, ts, "/api/graphql?query="+url.QueryEscape("{ topologies { name }"))
+	is400(t, ts, "/api/graphql?query="+url.QueryEscape("mutation { foo }"))
+
+	getRawJSON(t, ts, "/api/graphql?query="+url.QueryEscape("{ topologies { id name stats { nodeCount } } }"))
+}
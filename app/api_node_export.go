@@ -0,0 +1,88 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/weaveworks/scope/render/detailed"
+)
+
+// tableExporters serialise the tables of the details of nodes, by format.
+var tableExporters = map[string]struct {
+	contentType string
+	export      func(detailed.ExportedTable) ([]byte, error)
+}{
+	"csv":    {"text/csv; charset=utf-8", exportCSV},
+	"ndjson": {"application/x-ndjson", exportNDJSON},
+}
+
+// exportNodeTable serves the table of the details of the node in the
+// export parameter, as CSV, the default, or NDJSON, in the format
+// parameter.
+func exportNodeTable(node detailed.Node, w http.ResponseWriter, r *http.Request) {
+	id := r.Form.Get("export")
+	format := r.Form.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	exporter, ok := tableExporters[format]
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("unknown format %q: expected csv or ndjson", format))
+		return
+	}
+	table, ok := node.ExportTable(id)
+	if !ok {
+		respondWith(w, http.StatusNotFound, fmt.Errorf("node %s has no table %q", node.ID, id))
+		return
+	}
+	buf, err := exporter.export(table)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", exporter.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+"."+format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
+
+// exportCSV writes a header of the labels of the columns, then a record
+// per row.
+func exportCSV(table detailed.ExportedTable) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	record := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		record[i] = c.Label
+	}
+	writer.Write(record)
+	for _, row := range table.Rows {
+		for i, c := range table.Columns {
+			record[i] = row[c.ID]
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// exportNDJSON writes an object per row, of its values by column ID.
+func exportNDJSON(table detailed.ExportedTable) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, row := range table.Rows {
+		object := make(map[string]string, len(table.Columns))
+		for _, c := range table.Columns {
+			if value, ok := row[c.ID]; ok {
+				object[c.ID] = value
+			}
+		}
+		if err := encoder.Encode(object); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
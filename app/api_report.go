@@ -2,11 +2,14 @@ package app
 
 import (
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/plugins"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -62,3 +65,58 @@ func makeProbeHandler(rep Reporter) CtxHandlerFunc {
 		respondWith(w, http.StatusOK, result)
 	}
 }
+
+type pluginDesc struct {
+	ProbeID    string         `json:"probeId"`
+	Hostname   string         `json:"hostname"`
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	APIVersion string         `json:"apiVersion,omitempty"`
+	Errors     map[string]int `json:"errors"`
+}
+
+type pluginDescsByProbe []pluginDesc
+
+func (p pluginDescsByProbe) Len() int      { return len(p) }
+func (p pluginDescsByProbe) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p pluginDescsByProbe) Less(i, j int) bool {
+	return p[i].ProbeID < p[j].ProbeID || (p[i].ProbeID == p[j].ProbeID && p[i].ID < p[j].ID)
+}
+
+// Plugins handler, listing the plugins of each probe with their status and
+// how often they failed, by kind of error.
+func makePluginsHandler(rep Reporter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		rpt, err := rep.Report(ctx, time.Now())
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		template := plugins.PluginsTableTemplates[plugins.PluginsTablePrefix]
+		result := []pluginDesc{}
+		for _, n := range rpt.Host.Nodes {
+			id, _ := n.Latest.Lookup(report.ControlProbeID)
+			hostname, _ := n.Latest.Lookup(host.HostName)
+			for _, row := range n.ExtractMulticolumnTable(template) {
+				desc := pluginDesc{
+					ProbeID:    id,
+					Hostname:   hostname,
+					ID:         row.ID,
+					Status:     row.Entries[plugins.PluginStatus],
+					APIVersion: row.Entries[plugins.PluginAPIVersion],
+					Errors:     map[string]int{},
+				}
+				for kind, key := range map[string]string{
+					plugins.ErrorTimeout:     plugins.PluginTimeouts,
+					plugins.ErrorMalformed:   plugins.PluginMalformed,
+					plugins.ErrorUnavailable: plugins.PluginUnavailable,
+				} {
+					desc.Errors[kind], _ = strconv.Atoi(row.Entries[key])
+				}
+				result = append(result, desc)
+			}
+		}
+		sort.Sort(pluginDescsByProbe(result))
+		respondWith(w, http.StatusOK, result)
+	}
+}
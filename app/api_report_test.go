@@ -1,6 +1,7 @@
 package app_test
 
 import (
+	"encoding/json"
 	"net/http/httptest"
 	"testing"
 
@@ -8,8 +9,11 @@ import (
 	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/plugins"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
+	"github.com/weaveworks/scope/test/reflect"
 )
 
 func topologyServer() *httptest.Server {
@@ -33,3 +37,46 @@ func TestAPIReport(t *testing.T) {
 		t.Fatalf("JSON parse error: %s", err)
 	}
 }
+
+func TestAPIPlugins(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Host = rpt.Host.WithTableTemplates(plugins.PluginsTableTemplates)
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("host1"), map[string]string{
+		report.ControlProbeID: "probe1",
+		host.HostName:         "host1",
+	}).AddPrefixMulticolumnTable(plugins.PluginsTablePrefix, []report.Row{{
+		ID: "iowait",
+		Entries: map[string]string{
+			plugins.PluginStatus:      "disabled: timeout",
+			plugins.PluginAPIVersion:  "1",
+			plugins.PluginTimeouts:    "3",
+			plugins.PluginMalformed:   "0",
+			plugins.PluginUnavailable: "1",
+		},
+	}}))
+
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var have []map[string]interface{}
+	if err := json.Unmarshal(getRawJSON(t, ts, "/api/plugins"), &have); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	want := []map[string]interface{}{{
+		"probeId":    "probe1",
+		"hostname":   "host1",
+		"id":         "iowait",
+		"status":     "disabled: timeout",
+		"apiVersion": "1",
+		"errors": map[string]interface{}{
+			plugins.ErrorTimeout:     3.0,
+			plugins.ErrorMalformed:   0.0,
+			plugins.ErrorUnavailable: 1.0,
+		},
+	}}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
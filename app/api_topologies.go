@@ -11,11 +11,16 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"golang.org/x/net/context"
 
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -30,11 +35,28 @@ const (
 	podsID                 = "pods"
 	kubeControllersID      = "kube-controllers"
 	servicesID             = "services"
+	namespacesID           = "namespaces"
 	hostsID                = "hosts"
+	clustersID             = "clusters"
+	zonesID                = "zones"
+	gpusID                 = "gpus"
+	scopeProbesID          = "scope-probes"
 	weaveID                = "weave"
+	cniID                  = "cni"
+	wireguardID            = "wireguard"
 	ecsTasksID             = "ecs-tasks"
 	ecsServicesID          = "ecs-services"
 	swarmServicesID        = "swarm-services"
+	nomadJobsID            = "nomad-jobs"
+	nomadTaskGroupsID      = "nomad-task-groups"
+	nomadAllocationsID     = "nomad-allocations"
+
+	// Plugin topologies are listed after the built-in ones
+	pluginTopologyRank = 5
+
+	// groupByParam is the render option grouping the nodes of a topology
+	// by the value of a metadata or label key, e.g. ?group_by=team
+	groupByParam = "group_by"
 )
 
 var (
@@ -137,7 +159,9 @@ func MakeAPITopologyOption(value string, label string, filterFunc render.FilterF
 // Registry is a threadsafe store of the available topologies
 type Registry struct {
 	sync.RWMutex
-	items map[string]APITopologyDesc
+	items     map[string]APITopologyDesc
+	anomalies map[string]*render.AnomalyDetector // by topology ID
+	userIDer  func(context.Context) (string, error)
 }
 
 // MakeRegistry returns a new Registry
@@ -205,7 +229,7 @@ func MakeRegistry() *Registry {
 		},
 		APITopologyDesc{
 			id:       containersID,
-			renderer: render.ContainerWithImageNameRenderer,
+			renderer: render.ContainerWithSidecarsCollapsedRenderer,
 			Name:     "Containers",
 			Rank:     2,
 			Options:  containerFilters,
@@ -248,6 +272,13 @@ func MakeRegistry() *Registry {
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          namespacesID,
+			parent:      podsID,
+			renderer:    render.NamespaceRenderer,
+			Name:        "namespaces",
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:          ecsTasksID,
 			renderer:    render.ECSTaskRenderer,
@@ -272,6 +303,30 @@ func MakeRegistry() *Registry {
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          nomadJobsID,
+			renderer:    render.NomadJobRenderer,
+			Name:        "Jobs",
+			Rank:        3,
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          nomadTaskGroupsID,
+			parent:      nomadJobsID,
+			renderer:    render.NomadTaskGroupRenderer,
+			Name:        "task groups",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          nomadAllocationsID,
+			parent:      nomadJobsID,
+			renderer:    render.NomadAllocationRenderer,
+			Name:        "allocations",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:       hostsID,
 			renderer: render.HostRenderer,
@@ -284,6 +339,48 @@ func MakeRegistry() *Registry {
 			renderer: render.WeaveRenderer,
 			Name:     "Weave Net",
 		},
+		APITopologyDesc{
+			id:          cniID,
+			parent:      hostsID,
+			renderer:    render.CNIRenderer,
+			Name:        "CNI",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          wireguardID,
+			parent:      hostsID,
+			renderer:    render.WireGuardRenderer,
+			Name:        "WireGuard",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          clustersID,
+			parent:      hostsID,
+			renderer:    render.ClusterRenderer,
+			Name:        "by cluster",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          zonesID,
+			parent:      hostsID,
+			renderer:    render.ZoneRenderer,
+			Name:        "by zone",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          gpusID,
+			parent:      hostsID,
+			renderer:    render.GPURenderer,
+			Name:        "GPUs",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          scopeProbesID,
+			parent:      hostsID,
+			renderer:    render.ScopeProbeRenderer,
+			Name:        "Scope probes",
+			HideIfEmpty: true,
+		},
 	)
 
 	return registry
@@ -397,6 +494,20 @@ func deserializeTimestamp(timestamp string) time.Time {
 	return time.Now()
 }
 
+type historicCtxKey struct{}
+
+// historicContext marks ctx as for rendering a report of the past, rather
+// than the live one.
+func historicContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, historicCtxKey{}, true)
+}
+
+// isHistoric tells whether ctx is for rendering a report of the past.
+func isHistoric(ctx context.Context) bool {
+	historic, _ := ctx.Value(historicCtxKey{}).(bool)
+	return historic
+}
+
 // AddContainerFilters adds to the default Registry (topologyRegistry)'s containerFilters
 func AddContainerFilters(newFilters ...APITopologyOption) {
 	topologyRegistry.AddContainerFilters(newFilters...)
@@ -416,6 +527,45 @@ func (r *Registry) AddContainerFilters(newFilters ...APITopologyOption) {
 	}
 }
 
+// EnableAnomalies has the default Registry (topologyRegistry) detect
+// anomalies in its topologies
+func EnableAnomalies(sigma float64, userIDer func(context.Context) (string, error)) {
+	topologyRegistry.EnableAnomalies(sigma, userIDer)
+}
+
+// EnableAnomalies marks the nodes of the topologies of this Registry which
+// deviate by more than sigma standard deviations from their baselines, with
+// a render.AnomalyDetector per topology. Each user, as told by userIDer,
+// keeps baselines of their own, and only live reports are folded into them.
+func (r *Registry) EnableAnomalies(sigma float64, userIDer func(context.Context) (string, error)) {
+	r.Lock()
+	defer r.Unlock()
+	r.anomalies = map[string]*render.AnomalyDetector{}
+	for id := range r.items {
+		r.anomalies[id] = render.NewAnomalyDetector(sigma)
+	}
+	r.userIDer = userIDer
+}
+
+// baseRenderer returns the renderer of topology, detecting anomalies
+// against the baselines of the user of ctx if anomalies are enabled.
+func (r *Registry) baseRenderer(ctx context.Context, topology APITopologyDesc) render.Renderer {
+	r.RLock()
+	detector, ok := r.anomalies[topology.id]
+	userIDer := r.userIDer
+	r.RUnlock()
+	if !ok {
+		return topology.renderer
+	}
+	// Without a user, as rendering in the background, there are no
+	// baselines to compare with
+	userID, err := userIDer(ctx)
+	if err != nil {
+		return topology.renderer
+	}
+	return detector.Detect(topology.renderer, userID, !isHistoric(ctx))
+}
+
 // Add inserts a topologyDesc to the Registry's items map
 func (r *Registry) Add(ts ...APITopologyDesc) {
 	r.Lock()
@@ -441,6 +591,35 @@ func (r *Registry) get(name string) (APITopologyDesc, bool) {
 	return t, ok
 }
 
+// getForReport is get, falling back on the plugin topologies of rpt.
+func (r *Registry) getForReport(name string, rpt report.Report) (APITopologyDesc, bool) {
+	if t, ok := r.get(name); ok {
+		return t, true
+	}
+	if !rpt.IsPluginTopology(name) {
+		return APITopologyDesc{}, false
+	}
+	topology, _ := rpt.Topology(name)
+	return pluginTopologyDesc(name, topology), true
+}
+
+// pluginTopologyDesc describes a topology some plugin reports. It is served
+// under its name, for as long as the plugin reports it.
+func pluginTopologyDesc(name string, topology report.Topology) APITopologyDesc {
+	label := topology.LabelPlural
+	if label == "" {
+		label = name
+	}
+	return APITopologyDesc{
+		id:          name,
+		renderer:    render.TopologySelector(name),
+		Name:        strings.Title(label),
+		Rank:        pluginTopologyRank,
+		HideIfEmpty: true,
+		URL:         apiTopologyURL + name,
+	}
+}
+
 func (r *Registry) walk(f func(APITopologyDesc)) {
 	r.RLock()
 	defer r.RUnlock()
@@ -466,23 +645,43 @@ func (r *Registry) makeTopologyList(rep Reporter) CtxHandlerFunc {
 			respondWith(w, http.StatusInternalServerError, err)
 			return
 		}
-		respondWith(w, http.StatusOK, r.renderTopologies(report, req))
+		if req.URL.Query().Get("timestamp") != "" {
+			ctx = historicContext(ctx)
+		}
+		respondWith(w, http.StatusOK, r.renderTopologies(ctx, report, req))
 	}
 }
 
-func (r *Registry) renderTopologies(rpt report.Report, req *http.Request) []APITopologyDesc {
+func (r *Registry) renderTopologies(ctx context.Context, rpt report.Report, req *http.Request) []APITopologyDesc {
 	topologies := []APITopologyDesc{}
 	req.ParseForm()
 	r.walk(func(desc APITopologyDesc) {
-		renderer, filter, _ := r.RendererForTopology(desc.id, req.Form, rpt)
-		desc.Stats = computeStats(rpt, renderer, filter)
-		for i, sub := range desc.SubTopologies {
-			renderer, filter, _ := r.RendererForTopology(sub.id, req.Form, rpt)
-			desc.SubTopologies[i].Stats = computeStats(rpt, renderer, filter)
-		}
+		// Copied, as the stats of the sub-topologies are filled in below
+		desc.SubTopologies = append([]APITopologyDesc(nil), desc.SubTopologies...)
 		topologies = append(topologies, desc)
 	})
-	return updateFilters(rpt, topologies)
+	// Topologies are independent of one another, so rendered in parallel
+	render.Parallel(len(topologies), func(i int) {
+		desc := &topologies[i]
+		renderer, filter, _ := r.RendererForTopology(ctx, desc.id, req.Form, rpt)
+		desc.Stats = computeStats(rpt, renderer, filter)
+		render.Parallel(len(desc.SubTopologies), func(j int) {
+			sub := &desc.SubTopologies[j]
+			renderer, filter, _ := r.RendererForTopology(ctx, sub.id, req.Form, rpt)
+			sub.Stats = computeStats(rpt, renderer, filter)
+		})
+	})
+	pluginTopologies := []APITopologyDesc{}
+	for name, topology := range rpt.PluginTopologies {
+		if _, ok := r.get(name); ok || !rpt.IsPluginTopology(name) {
+			continue // shadowed
+		}
+		desc := pluginTopologyDesc(name, topology)
+		desc.Stats = computeStats(rpt, desc.renderer, render.FilterUnconnectedPseudo)
+		pluginTopologies = append(pluginTopologies, desc)
+	}
+	sort.Sort(byName(pluginTopologies))
+	return updateFilters(rpt, append(topologies, pluginTopologies...))
 }
 
 func computeStats(rpt report.Report, renderer render.Renderer, transformer render.Transformer) topologyStats {
@@ -508,16 +707,17 @@ func computeStats(rpt report.Report, renderer render.Renderer, transformer rende
 }
 
 // RendererForTopology ..
-func (r *Registry) RendererForTopology(topologyID string, values url.Values, rpt report.Report) (render.Renderer, render.Transformer, error) {
-	topology, ok := r.get(topologyID)
+func (r *Registry) RendererForTopology(ctx context.Context, topologyID string, values url.Values, rpt report.Report) (render.Renderer, render.Transformer, error) {
+	topology, ok := r.getForReport(topologyID, rpt)
 	if !ok {
 		return nil, nil, fmt.Errorf("topology not found: %s", topologyID)
 	}
 	topology = updateFilters(rpt, []APITopologyDesc{topology})[0]
+	renderer := r.baseRenderer(ctx, topology)
 
 	if len(values) == 0 {
 		// if no options where provided, only apply base filter
-		return topology.renderer, render.FilterUnconnectedPseudo, nil
+		return renderer, render.FilterUnconnectedPseudo, nil
 	}
 
 	var filters []render.FilterFunc
@@ -527,10 +727,17 @@ func (r *Registry) RendererForTopology(topologyID string, values url.Values, rpt
 			filters = append(filters, filter)
 		}
 	}
+	var transformer render.Transformer = render.FilterUnconnectedPseudo
 	if len(filters) > 0 {
-		return topology.renderer, render.Transformers([]render.Transformer{render.ComposeFilterFuncs(filters...), render.FilterUnconnectedPseudo}), nil
+		transformer = render.Transformers([]render.Transformer{render.ComposeFilterFuncs(filters...), render.FilterUnconnectedPseudo})
+	}
+
+	// Grouping is of the nodes the filters leave, so they needn't make
+	// sense of groups
+	if key := values.Get(groupByParam); key != "" {
+		return render.GroupBy(key, render.CustomRenderer{RenderFunc: transformer.Transform, Renderer: renderer}), render.Transformers{}, nil
 	}
-	return topology.renderer, render.FilterUnconnectedPseudo, nil
+	return renderer, transformer, nil
 }
 
 type reporterHandler func(context.Context, Reporter, http.ResponseWriter, *http.Request)
@@ -547,21 +754,79 @@ func (r *Registry) captureRenderer(rep Reporter, f rendererHandler) CtxHandlerFu
 			topologyID = mux.Vars(req)["topology"]
 			timestamp  = deserializeTimestamp(req.URL.Query().Get("timestamp"))
 		)
-		if _, ok := r.get(topologyID); !ok {
-			http.NotFound(w, req)
-			return
-		}
+		parent, _ := opentracing.GlobalTracer().Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+		span, ctx := opentracing.StartSpanFromContext(ctx, "app.topology", ext.RPCServerOption(parent))
+		span.SetTag("topology", topologyID)
+		defer span.Finish()
 		rpt, err := rep.Report(ctx, timestamp)
 		if err != nil {
+			tracing.SetError(span, err)
 			respondWith(w, http.StatusInternalServerError, err)
 			return
 		}
+		if _, ok := r.getForReport(topologyID, rpt); !ok {
+			http.NotFound(w, req)
+			return
+		}
 		req.ParseForm()
-		renderer, filter, err := r.RendererForTopology(topologyID, req.Form, rpt)
+		if req.URL.Query().Get("timestamp") != "" {
+			ctx = historicContext(ctx)
+		}
+		renderer, filter, err := r.RendererForTopology(ctx, topologyID, req.Form, rpt)
 		if err != nil {
 			respondWith(w, http.StatusInternalServerError, err)
 			return
 		}
-		f(ctx, renderer, filter, RenderContextForReporter(rep, rpt), w, req)
+		renderSpan, renderCtx := opentracing.StartSpanFromContext(ctx, "app.render")
+		f(renderCtx, renderer, filter, RenderContextForReporter(rep, rpt), w, req)
+		renderSpan.Finish()
+	}
+}
+
+// captureChanges returns a handler for what changed in a topology between
+// the times "from" and "to" (now, if not given), rendered as the
+// topology is.
+func (r *Registry) captureChanges(rep Reporter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		var (
+			topologyID = mux.Vars(req)["topology"]
+			query      = req.URL.Query()
+			to         = mtime.Now()
+		)
+		from, err := time.Parse(time.RFC3339, query.Get("from"))
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("invalid from: %v", err))
+			return
+		}
+		if s := query.Get("to"); s != "" {
+			if to, err = time.Parse(time.RFC3339, s); err != nil {
+				respondWith(w, http.StatusBadRequest, fmt.Errorf("invalid to: %v", err))
+				return
+			}
+		}
+		req.ParseForm()
+		// Neither end is the live report, as "to" may be in the past
+		ctx = historicContext(ctx)
+
+		var summaries [2]detailed.NodeSummaries
+		for i, timestamp := range []time.Time{from, to} {
+			rpt, err := rep.Report(ctx, timestamp)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			if _, ok := r.getForReport(topologyID, rpt); !ok {
+				http.NotFound(w, req)
+				return
+			}
+			renderer, filter, err := r.RendererForTopology(ctx, topologyID, req.Form, rpt)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			rc := RenderContextForReporter(rep, rpt)
+			summaries[i] = detailed.Summaries(rc, render.Render(rpt, renderer, filter).Nodes)
+		}
+		respondWith(w, http.StatusOK, detailed.TopoChanges(from, to, summaries[0], summaries[1]))
 	}
 }
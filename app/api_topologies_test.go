@@ -2,6 +2,7 @@ package app_test
 
 import (
 	"bytes"
+	"fmt"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -9,12 +10,14 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/detailed"
@@ -41,7 +44,7 @@ func TestAPITopology(t *testing.T) {
 	if err := decoder.Decode(&topologies); err != nil {
 		t.Fatalf("JSON parse error: %s", err)
 	}
-	equals(t, 6, len(topologies))
+	equals(t, 7, len(topologies))
 
 	for _, topology := range topologies {
 		is200(t, ts, topology.URL)
@@ -50,8 +53,8 @@ func TestAPITopology(t *testing.T) {
 			is200(t, ts, subTopology.URL)
 		}
 
-		// TODO: add ECS nodes in report fixture
-		if topology.Name == "Tasks" || topology.Name == "services" {
+		// TODO: add ECS and Nomad nodes in report fixture
+		if topology.Name == "Tasks" || topology.Name == "services" || topology.Name == "Jobs" {
 			continue
 		}
 
@@ -109,7 +112,7 @@ func TestRendererForTopologyWithFiltering(t *testing.T) {
 	urlvalues.Set(systemGroupID, customAPITopologyOptionFilterID)
 	urlvalues.Set("stopped", "running")
 	urlvalues.Set("pseudo", "hide")
-	renderer, filter, err := topologyRegistry.RendererForTopology("containers", urlvalues, fixture.Report)
+	renderer, filter, err := topologyRegistry.RendererForTopology(context.Background(), "containers", urlvalues, fixture.Report)
 	if err != nil {
 		t.Fatalf("Topology Registry Report error: %s", err)
 	}
@@ -140,7 +143,7 @@ func TestRendererForTopologyNoFiltering(t *testing.T) {
 	urlvalues.Set(systemGroupID, customAPITopologyOptionFilterID)
 	urlvalues.Set("stopped", "running")
 	urlvalues.Set("pseudo", "hide")
-	renderer, filter, err := topologyRegistry.RendererForTopology("containers", urlvalues, fixture.Report)
+	renderer, filter, err := topologyRegistry.RendererForTopology(context.Background(), "containers", urlvalues, fixture.Report)
 	if err != nil {
 		t.Fatalf("Topology Registry Report error: %s", err)
 	}
@@ -178,7 +181,7 @@ func getTestContainerLabelFilterTopologySummary(t *testing.T, exclude bool) (det
 	urlvalues.Set(systemGroupID, customAPITopologyOptionFilterID)
 	urlvalues.Set("stopped", "running")
 	urlvalues.Set("pseudo", "hide")
-	renderer, filter, err := topologyRegistry.RendererForTopology("containers", urlvalues, fixture.Report)
+	renderer, filter, err := topologyRegistry.RendererForTopology(context.Background(), "containers", urlvalues, fixture.Report)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +192,7 @@ func getTestContainerLabelFilterTopologySummary(t *testing.T, exclude bool) (det
 func TestAPITopologyAddsKubernetes(t *testing.T) {
 	router := mux.NewRouter()
 	c := app.NewCollector(1 * time.Minute)
-	app.RegisterReportPostHandler(c, router)
+	app.RegisterReportPostHandler(c, nil, nil, app.ReportLimits{}, router)
 	app.RegisterTopologyRoutes(router, c, map[string]bool{"foo_capability": true})
 	ts := httptest.NewServer(router)
 	defer ts.Close()
@@ -201,7 +204,7 @@ func TestAPITopologyAddsKubernetes(t *testing.T) {
 	if err := decoder.Decode(&topologies); err != nil {
 		t.Fatalf("JSON parse error: %s", err)
 	}
-	equals(t, 6, len(topologies))
+	equals(t, 7, len(topologies))
 
 	// Enable the kubernetes topologies
 	rpt := report.MakeReport()
@@ -235,7 +238,7 @@ func TestAPITopologyAddsKubernetes(t *testing.T) {
 	if err := decoder.Decode(&topologies); err != nil {
 		t.Fatalf("JSON parse error: %s", err)
 	}
-	equals(t, 6, len(topologies))
+	equals(t, 7, len(topologies))
 
 	found := false
 	for _, topology := range topologies {
@@ -248,3 +251,82 @@ func TestAPITopologyAddsKubernetes(t *testing.T) {
 		t.Error("Could not find pods topology")
 	}
 }
+
+func TestAPITopologyAddsPluginTopologies(t *testing.T) {
+	router := mux.NewRouter()
+	c := app.NewCollector(1 * time.Minute)
+	app.RegisterReportPostHandler(c, nil, nil, app.ReportLimits{}, router)
+	app.RegisterTopologyRoutes(router, c, map[string]bool{"foo_capability": true})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	is404(t, ts, "/api/topology/queue")
+
+	rpt := report.MakeReport()
+	rpt.PluginTopologies = map[string]report.Topology{
+		"queue": report.MakeTopology().WithLabel("queue", "queues").
+			AddNode(report.MakeNodeWith("orders", map[string]string{detailed.PluginNodeLabel: "Orders"}).WithTopology("queue")),
+	}
+	buf := &bytes.Buffer{}
+	encoder := codec.NewEncoder(buf, &codec.MsgpackHandle{})
+	if err := encoder.Encode(rpt); err != nil {
+		t.Fatalf("Msgpack encoding error: %s", err)
+	}
+	checkRequest(t, ts, "POST", "/api/report", buf.Bytes())
+
+	body := getRawJSON(t, ts, "/api/topology")
+	var topologies []app.APITopologyDesc
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&topologies); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	equals(t, 8, len(topologies))
+	queues := topologies[len(topologies)-1]
+	equals(t, "Queues", queues.Name)
+	equals(t, "/api/topology/queue", queues.URL)
+	equals(t, 1, queues.Stats.NodeCount)
+
+	body = getRawJSON(t, ts, "/api/topology/queue")
+	var topology app.APITopology
+	decoder = codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&topology); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	equals(t, "Orders", topology.Nodes["orders"].Label)
+}
+
+type userCtxKey struct{}
+
+func TestRegistryEnableAnomalies(t *testing.T) {
+	topologyRegistry := app.MakeRegistry()
+	topologyRegistry.EnableAnomalies(3, func(ctx context.Context) (string, error) {
+		return ctx.Value(userCtxKey{}).(string), nil
+	})
+
+	summarise := func(user string, window int, memory float64) detailed.NodeSummary {
+		rpt := fixture.Report.Copy()
+		rpt.ID = fmt.Sprintf("%s-%d", user, window)
+		node := rpt.Host.Nodes[fixture.ClientHostNodeID]
+		rpt.Host.Nodes[fixture.ClientHostNodeID] = node.WithMetric(host.MemoryUsage, report.MakeSingletonMetric(fixture.Now, memory))
+		ctx := context.WithValue(context.Background(), userCtxKey{}, user)
+		renderer, filter, err := topologyRegistry.RendererForTopology(ctx, "hosts", url.Values{}, rpt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return detailed.Summaries(detailed.RenderContext{Report: rpt}, render.Render(rpt, renderer, filter).Nodes)[fixture.ClientHostNodeID]
+	}
+	for window := 0; window < 6; window++ {
+		if summary := summarise("alice", window, 1000); len(summary.Anomalies) > 0 {
+			t.Fatalf("Expected no anomalies in window %d, got %v", window, summary.Anomalies)
+		}
+	}
+	summary := summarise("alice", 6, 5000)
+	equals(t, []string{render.AnomalyMemory}, summary.Anomalies)
+
+	// Baselines are of each user's own reports
+	for window := 0; window < 7; window++ {
+		if summary := summarise("bob", window, 5000); len(summary.Anomalies) > 0 {
+			t.Fatalf("Expected no anomalies for bob in window %d, got %v", window, summary.Anomalies)
+		}
+	}
+}
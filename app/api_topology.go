@@ -1,13 +1,20 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/weaveworks/common/mtime"
 	"golang.org/x/net/context"
 
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/detailed"
@@ -20,7 +27,11 @@ const (
 
 // APITopology is returned by the /api/topology/{name} handler.
 type APITopology struct {
-	Nodes detailed.NodeSummaries `json:"nodes"`
+	Nodes  detailed.NodeSummaries `json:"nodes"`
+	Layout detailed.Layout        `json:"layout,omitempty"`
+	// Cursor is where the next page of nodes starts, when the nodes were
+	// limited and there are more.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 // APINode is returned by the /api/topology/{name}/{id} handler.
@@ -33,37 +44,123 @@ func RenderContextForReporter(rep Reporter, r report.Report) detailed.RenderCont
 	rc := detailed.RenderContext{Report: r}
 	if wrep, ok := rep.(WebReporter); ok {
 		rc.MetricsGraphURL = wrep.MetricsGraphURL
+		rc.Traces = wrep.Traces
 	}
 	return rc
 }
 
 type rendererHandler func(context.Context, render.Renderer, render.Transformer, detailed.RenderContext, http.ResponseWriter, *http.Request)
 
-// Full topology.
-func handleTopology(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
-	respondWith(w, http.StatusOK, APITopology{
-		Nodes: detailed.Summaries(rc, render.Render(rc.Report, renderer, transformer).Nodes),
-	})
+// Full topology. Nodes are marked with the alerts firing on them, and the
+// annotations users left on them, if the reporter has somewhere to get them
+// from.
+func makeTopologyHandler(rep Reporter) rendererHandler {
+	var (
+		alerter     *Alerter
+		annotations AnnotationStore
+	)
+	if wrep, ok := rep.(WebReporter); ok {
+		alerter, annotations = wrep.Alerter, wrep.Annotations
+	}
+	return func(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+		query, err := parseTopologyQuery(r.Form)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		topologyID := mux.Vars(r)["topology"]
+		rendered := render.Render(rc.Report, renderer, query.transformer(rc, transformer)).Nodes
+		nodes := detailed.Summaries(rc, rendered)
+		if alerter != nil {
+			alerter.annotate(topologyID, nodes)
+		}
+		annotate(ctx, annotations, topologyID, nodes)
+		nodes, cursor := query.truncate(nodes)
+		nodes = query.bundle(query.apply(query.scale(nodes)), rendered)
+		respondWith(w, http.StatusOK, APITopology{Nodes: nodes, Layout: query.layout(nodes), Cursor: cursor})
+	}
+}
+
+// Individual nodes. The history of their metrics is backfilled, and their
+// annotations added, if the reporter has somewhere to get them from.
+func makeNodeHandler(rep Reporter) rendererHandler {
+	var (
+		history     MetricsHistory
+		annotations AnnotationStore
+	)
+	if wrep, ok := rep.(WebReporter); ok {
+		history, annotations = wrep.MetricsHistory, wrep.Annotations
+	}
+	return func(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+		handleNode(ctx, history, annotations, renderer, transformer, rc, w, r)
+	}
 }
 
-// Individual nodes.
-func handleNode(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+// The connections tables of nodes are paged, sorted and filtered as asked
+// for with connections_ query parameters, as by handleConnections, and the
+// history of their metrics is that of the start, end and step parameters,
+// as parsed by parseMetricsRange. Given export, only that table of the
+// node is served, as by exportNodeTable.
+func handleNode(ctx context.Context, history MetricsHistory, annotations AnnotationStore, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
 	var (
 		vars       = mux.Vars(r)
 		topologyID = vars["topology"]
 		nodeID     = vars["id"]
 	)
-	// We must not lose the node during filtering. We achieve that by
-	// (1) rendering the report with the base renderer, without
-	// filtering, which gives us the node (if it exists at all), and
-	// then (2) applying the filter separately to that result.  If the
-	// node is lost in the second step, we simply put it back.
-	nodes := renderer.Render(rc.Report)
-	node, ok := nodes.Nodes[nodeID]
+	query, err := parseConnectionsQuery(r.Form, "connections_")
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	metricsRange, err := parseMetricsRange(r.Form, mtime.Now())
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	if !metricsRange.IsZero() && history == nil {
+		respondWith(w, http.StatusBadRequest, "there is no history of metrics to ask for")
+		return
+	}
+	node, nodes, ok := renderNode(renderer, transformer, rc, nodeID)
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
+	result := detailed.MakeNode(topologyID, rc, nodes, node)
+	if query != (detailed.ConnectionsQuery{}) {
+		for i, connections := range result.Connections {
+			result.Connections[i] = connections.Query(query)
+		}
+	}
+	if r.Form.Get("export") != "" {
+		exportNodeTable(result, w, r)
+		return
+	}
+	if history != nil {
+		if err := history.Backfill(ctx, node, &result, metricsRange); err != nil {
+			log.Warnf("Error backfilling metrics of %s: %v", nodeID, err)
+		}
+	}
+	if annotations != nil {
+		summaries := detailed.NodeSummaries{nodeID: result.NodeSummary}
+		annotate(ctx, annotations, topologyID, summaries)
+		result.NodeSummary = summaries[nodeID]
+	}
+	respondWith(w, http.StatusOK, APINode{Node: result})
+}
+
+// renderNode renders the node, and the nodes of the topology. We must not
+// lose the node during filtering. We achieve that by (1) rendering the
+// report with the base renderer, without filtering, which gives us the
+// node (if it exists at all), and then (2) applying the filter separately
+// to that result. If the node is lost in the second step, we simply put
+// it back.
+func renderNode(renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, nodeID string) (report.Node, report.Nodes, bool) {
+	nodes := renderer.Render(rc.Report)
+	node, ok := nodes.Nodes[nodeID]
+	if !ok {
+		return report.Node{}, nil, false
+	}
 	nodes = transformer.Transform(nodes)
 	if filteredNode, ok := nodes.Nodes[nodeID]; ok {
 		node = filteredNode
@@ -71,7 +168,172 @@ func handleNode(ctx context.Context, renderer render.Renderer, transformer rende
 		nodes.Nodes[nodeID] = node
 		nodes.Filtered--
 	}
-	respondWith(w, http.StatusOK, APINode{Node: detailed.MakeNode(topologyID, rc, nodes.Nodes, node)})
+	return node, nodes.Nodes, true
+}
+
+// A connections table of a node, incoming or outgoing, on its own, paged,
+// sorted and filtered as asked for by the query parameters of
+// parseConnectionsQuery, for nodes with too many connections to send them
+// all with their details.
+func handleConnections(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+	var (
+		vars       = mux.Vars(r)
+		topologyID = vars["topology"]
+		nodeID     = vars["id"]
+		table      = vars["table"]
+	)
+	query, err := parseConnectionsQuery(r.Form, "")
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	node, nodes, ok := renderNode(renderer, transformer, rc, nodeID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	for _, connections := range detailed.MakeConnections(topologyID, rc, nodes, node) {
+		if connections.ID == table || connections.ID == table+"-connections" {
+			respondWith(w, http.StatusOK, connections.Query(query))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// The blast radius of a node, up to the depth parameter hops away, in the
+// topology as rendered: what may break if it does, and what it needs.
+func handleImpact(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+	nodeID := mux.Vars(r)["id"]
+	depth := detailed.DefaultImpactDepth
+	if value := r.Form.Get("depth"); value != "" {
+		var err error
+		if depth, err = strconv.Atoi(value); err != nil || depth < 1 || depth > detailed.MaxImpactDepth {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("invalid depth %q: expected 1 to %d", value, detailed.MaxImpactDepth))
+			return
+		}
+	}
+	_, nodes, ok := renderNode(renderer, transformer, rc, nodeID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	respondWith(w, http.StatusOK, detailed.MakeImpact(rc.Report, nodes, nodeID, depth))
+}
+
+// The paths from a node to the node of the to parameter, of the
+// to_topology parameter or the same topology, through the connections of
+// the nodes of the via parameter, processes by default, of at most the
+// max_length parameter connections.
+func handlePaths(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+	var (
+		vars       = mux.Vars(r)
+		topologyID = vars["topology"]
+		nodeID     = vars["id"]
+		toID       = r.Form.Get("to")
+		toTopology = r.Form.Get("to_topology")
+		via        = r.Form.Get("via")
+		maxLength  = detailed.DefaultPathLength
+	)
+	if toID == "" {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("missing to"))
+		return
+	}
+	if toTopology == "" {
+		toTopology = topologyID
+	}
+	if via == "" {
+		via = "processes"
+	}
+	if value := r.Form.Get("max_length"); value != "" {
+		var err error
+		if maxLength, err = strconv.Atoi(value); err != nil || maxLength < 1 || maxLength > detailed.MaxPathLength {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("invalid max_length %q: expected 1 to %d", value, detailed.MaxPathLength))
+			return
+		}
+	}
+
+	toRenderer, _, err := topologyRegistry.RendererForTopology(ctx, toTopology, nil, rc.Report)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	viaRenderer, viaTransformer, err := topologyRegistry.RendererForTopology(ctx, via, r.Form, rc.Report)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+
+	from, _, ok := renderNode(renderer, transformer, rc, nodeID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	to, ok := toRenderer.Render(rc.Report).Nodes[toID]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	nodes := viaTransformer.Transform(viaRenderer.Render(rc.Report)).Nodes
+	respondWith(w, http.StatusOK, detailed.MakePaths(rc.Report, nodes, from, to, via, maxLength))
+}
+
+// The matrix of the connections between the groups of the nodes of a
+// topology, as rendered, grouped by the by parameter, namespaces by
+// default, and to_by for the nodes they are to, optionally of only the
+// comma separated rows and columns parameters.
+func handleTraffic(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+	by := r.Form.Get("by")
+	if by == "" {
+		by = detailed.TrafficByNamespace
+	}
+	toBy := r.Form.Get("to_by")
+	if toBy == "" {
+		toBy = by
+	}
+	nodes := transformer.Transform(renderer.Render(rc.Report)).Nodes
+	matrix := detailed.MakeTrafficMatrix(rc.Report, nodes, by, toBy, splitList(r.Form.Get("rows")), splitList(r.Form.Get("columns")))
+	respondWith(w, http.StatusOK, matrix)
+}
+
+// splitList splits a comma separated list, leaving out empty items.
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// APIEdgeBundle is returned by the /api/topology/{name}/{id}/bundles/{bundle}
+// handler: the nodes the edges in a bundle go to.
+type APIEdgeBundle struct {
+	ID        string        `json:"id"`
+	Adjacency report.IDList `json:"adjacency"`
+}
+
+// The edges of a node in a bundle, as made by detailed.BundleEdges. As for
+// nodes, the node is found in the unfiltered topology.
+func handleEdgeBundle(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+	var (
+		vars     = mux.Vars(r)
+		nodeID   = vars["id"]
+		bundleID = vars["bundle"]
+	)
+	nodes := renderer.Render(rc.Report)
+	node, ok := nodes.Nodes[nodeID]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	adjacency, err := detailed.ExpandBundle(node, nodes.Nodes, bundleID)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	respondWith(w, http.StatusOK, APIEdgeBundle{ID: bundleID, Adjacency: adjacency})
 }
 
 // Websocket for the full topology.
@@ -93,6 +355,11 @@ func handleWebsocket(
 			return
 		}
 	}
+	query, err := parseTopologyQuery(r.Form)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
 
 	conn, err := xfer.Upgrade(w, r, nil)
 	if err != nil {
@@ -116,12 +383,21 @@ func handleWebsocket(
 
 	var (
 		previousTopo     detailed.NodeSummaries
+		previousLayout   detailed.Layout
 		tick             = time.Tick(loop)
 		wait             = make(chan struct{}, 1)
 		topologyID       = mux.Vars(r)["topology"]
 		startReportingAt = deserializeTimestamp(r.Form.Get("timestamp"))
 		channelOpenedAt  = time.Now()
+		alerter          *Alerter
+		annotations      AnnotationStore
 	)
+	if wrep, ok := rep.(WebReporter); ok {
+		alerter, annotations = wrep.Alerter, wrep.Annotations
+	}
+	if r.Form.Get("timestamp") != "" {
+		ctx = historicContext(ctx)
+	}
 
 	rep.WaitOn(ctx, wait)
 	defer rep.UnWait(ctx, wait)
@@ -135,19 +411,42 @@ func handleWebsocket(
 		// might be interested in implementing in the future.
 		timestampDelta := time.Since(channelOpenedAt)
 		reportTimestamp := startReportingAt.Add(timestampDelta)
-		re, err := rep.Report(ctx, reportTimestamp)
+		span, spanCtx := opentracing.StartSpanFromContext(ctx, "app.topology")
+		span.SetTag("topology", topologyID)
+		re, err := rep.Report(spanCtx, reportTimestamp)
 		if err != nil {
+			tracing.SetError(span, err)
+			span.Finish()
 			log.Errorf("Error generating report: %v", err)
 			return
 		}
-		renderer, filter, err := topologyRegistry.RendererForTopology(topologyID, r.Form, re)
+		renderer, filter, err := topologyRegistry.RendererForTopology(spanCtx, topologyID, r.Form, re)
 		if err != nil {
+			tracing.SetError(span, err)
+			span.Finish()
 			log.Errorf("Error generating report: %v", err)
 			return
 		}
-		newTopo := detailed.Summaries(RenderContextForReporter(rep, re), render.Render(re, renderer, filter).Nodes)
+		renderSpan, _ := opentracing.StartSpanFromContext(spanCtx, "app.render")
+		rc := RenderContextForReporter(rep, re)
+		rendered := render.Render(re, renderer, query.transformer(rc, filter)).Nodes
+		newTopo := detailed.Summaries(rc, rendered)
+		renderSpan.Finish()
+		span.Finish()
+		if alerter != nil {
+			alerter.annotate(topologyID, newTopo)
+		}
+		annotate(ctx, annotations, topologyID, newTopo)
+		newTopo, cursor := query.truncate(newTopo)
+		newTopo = query.bundle(query.apply(query.scale(newTopo)), rendered)
 		diff := detailed.TopoDiff(previousTopo, newTopo)
+		diff.Cursor = cursor
 		previousTopo = newTopo
+		// Layouts are cached, so unchanged ones are the same map
+		if layout := query.layout(newTopo); !reflect.DeepEqual(layout, previousLayout) {
+			diff.Layout = layout
+			previousLayout = layout
+		}
 
 		if err := conn.WriteJSON(diff); err != nil {
 			if !xfer.IsExpectedWSCloseError(err) {
@@ -0,0 +1,320 @@
+package app
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// topologyExport is a rendered topology, to be exported.
+type topologyExport struct {
+	TopologyID string
+	Name       string
+	Timestamp  time.Time
+	Nodes      []detailed.NodeSummary // by ID
+}
+
+// topologyExporters serialise rendered topologies, by format.
+var topologyExporters = map[string]struct {
+	contentType string
+	export      func(topologyExport) ([]byte, error)
+}{
+	"dot":    {"text/vnd.graphviz; charset=utf-8", exportDOT},
+	"gexf":   {"application/gexf+xml; charset=utf-8", exportGEXF},
+	"cypher": {"text/plain; charset=utf-8", exportCypher},
+	"svg":    {"image/svg+xml; charset=utf-8", exportSVG},
+	"html":   {"text/html; charset=utf-8", exportHTML},
+}
+
+// makeExportHandler serves the topology, as rendered and filtered for the
+// request, in the format parameter: GraphViz DOT, GEXF for Gephi, Cypher
+// statements creating it in Neo4j, or snapshots of the graph, as an SVG
+// image or a self-contained HTML page with the details of its nodes.
+// Nodes have their alerts and annotations, if the reporter has somewhere to
+// get them from.
+func makeExportHandler(rep Reporter) rendererHandler {
+	var (
+		alerter     *Alerter
+		annotations AnnotationStore
+	)
+	if wrep, ok := rep.(WebReporter); ok {
+		alerter, annotations = wrep.Alerter, wrep.Annotations
+	}
+	return func(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+		format := r.Form.Get("format")
+		exporter, ok := topologyExporters[format]
+		if !ok {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("unknown format %q: expected dot, gexf, cypher, svg or html", format))
+			return
+		}
+		query, err := parseTopologyQuery(r.Form)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		topologyID := mux.Vars(r)["topology"]
+		summaries := detailed.Summaries(rc, render.Render(rc.Report, renderer, query.transformer(rc, transformer)).Nodes)
+		if alerter != nil {
+			alerter.annotate(topologyID, summaries)
+		}
+		annotate(ctx, annotations, topologyID, summaries)
+		summaries, _ = query.truncate(summaries)
+		summaries = query.apply(query.scale(summaries))
+
+		export := topologyExport{
+			TopologyID: topologyID,
+			Name:       topologyID,
+			Timestamp:  deserializeTimestamp(r.Form.Get("timestamp")),
+			Nodes:      make([]detailed.NodeSummary, 0, len(summaries)),
+		}
+		if desc, ok := topologyRegistry.getForReport(topologyID, rc.Report); ok {
+			export.Name = desc.Name
+		}
+		for _, node := range summaries {
+			// Drop edges to nodes which aren't exported
+			adjacency := report.MakeIDList()
+			for _, id := range node.Adjacency {
+				if _, ok := summaries[id]; ok {
+					adjacency = adjacency.Add(id)
+				}
+			}
+			node.Adjacency = adjacency
+			export.Nodes = append(export.Nodes, node)
+		}
+		sort.Slice(export.Nodes, func(i, j int) bool { return export.Nodes[i].ID < export.Nodes[j].ID })
+
+		buf, err := exporter.export(export)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", exporter.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", topologyID+"."+format))
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	}
+}
+
+// dotShapes are the GraphViz shapes of those of nodes.
+var dotShapes = map[string]string{
+	report.Circle:   "circle",
+	report.Triangle: "triangle",
+	report.Square:   "box",
+	report.Pentagon: "pentagon",
+	report.Hexagon:  "hexagon",
+	report.Heptagon: "septagon",
+	report.Octagon:  "octagon",
+	report.Cloud:    "ellipse",
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func exportDOT(export topologyExport) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %s {\n", dotQuote(export.TopologyID))
+	for _, node := range export.Nodes {
+		label := node.Label
+		if node.LabelMinor != "" {
+			label += "\n" + node.LabelMinor
+		}
+		fmt.Fprintf(&buf, "\t%s [label=%s", dotQuote(node.ID), dotQuote(label))
+		if shape, ok := dotShapes[node.Shape]; ok {
+			fmt.Fprintf(&buf, ", shape=%s", shape)
+		}
+		if node.Stack {
+			buf.WriteString(", peripheries=2")
+		}
+		if node.Pseudo {
+			buf.WriteString(", style=dashed")
+		}
+		buf.WriteString("];\n")
+	}
+	for _, node := range export.Nodes {
+		for _, id := range node.Adjacency {
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", dotQuote(node.ID), dotQuote(id))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// GEXF 1.2, as read by Gephi.
+type (
+	gexfDocument struct {
+		XMLName xml.Name  `xml:"gexf"`
+		XMLNS   string    `xml:"xmlns,attr"`
+		Version string    `xml:"version,attr"`
+		Creator string    `xml:"meta>creator"`
+		Graph   gexfGraph `xml:"graph"`
+	}
+	gexfGraph struct {
+		DefaultEdgeType string         `xml:"defaultedgetype,attr"`
+		Mode            string         `xml:"mode,attr"`
+		Attributes      gexfAttributes `xml:"attributes"`
+		Nodes           []gexfNode     `xml:"nodes>node"`
+		Edges           []gexfEdge     `xml:"edges>edge"`
+	}
+	gexfAttributes struct {
+		Class      string          `xml:"class,attr"`
+		Attributes []gexfAttribute `xml:"attribute"`
+	}
+	gexfAttribute struct {
+		ID    string `xml:"id,attr"`
+		Title string `xml:"title,attr"`
+		Type  string `xml:"type,attr"`
+	}
+	gexfNode struct {
+		ID        string         `xml:"id,attr"`
+		Label     string         `xml:"label,attr"`
+		AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+	}
+	gexfAttValue struct {
+		For   string `xml:"for,attr"`
+		Value string `xml:"value,attr"`
+	}
+	gexfEdge struct {
+		ID     string `xml:"id,attr"`
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+	}
+)
+
+func exportGEXF(export topologyExport) ([]byte, error) {
+	doc := gexfDocument{
+		XMLNS:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Creator: "Weave Scope",
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Mode:            "static",
+			Attributes: gexfAttributes{
+				Class: "node",
+				Attributes: []gexfAttribute{
+					{ID: "labelMinor", Title: "Minor label", Type: "string"},
+					{ID: "rank", Title: "Rank", Type: "string"},
+					{ID: "shape", Title: "Shape", Type: "string"},
+					{ID: "pseudo", Title: "Pseudo", Type: "boolean"},
+				},
+			},
+			Nodes: []gexfNode{},
+			Edges: []gexfEdge{},
+		},
+	}
+
+	// Metadata and metrics are attributes too, declared as they are met
+	declared := map[string]bool{}
+	declare := func(id, title, typ string) {
+		if !declared[id] {
+			declared[id] = true
+			doc.Graph.Attributes.Attributes = append(doc.Graph.Attributes.Attributes, gexfAttribute{ID: id, Title: title, Type: typ})
+		}
+	}
+	for _, node := range export.Nodes {
+		n := gexfNode{
+			ID:    node.ID,
+			Label: node.Label,
+			AttValues: []gexfAttValue{
+				{For: "labelMinor", Value: node.LabelMinor},
+				{For: "rank", Value: node.Rank},
+				{For: "shape", Value: node.Shape},
+				{For: "pseudo", Value: strconv.FormatBool(node.Pseudo)},
+			},
+		}
+		for _, row := range node.Metadata {
+			declare(row.ID, row.Label, "string")
+			n.AttValues = append(n.AttValues, gexfAttValue{For: row.ID, Value: row.Value})
+		}
+		for _, row := range node.Metrics {
+			if row.ValueEmpty {
+				continue
+			}
+			declare(row.ID, row.Label, "double")
+			n.AttValues = append(n.AttValues, gexfAttValue{For: row.ID, Value: strconv.FormatFloat(row.Value, 'g', -1, 64)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, n)
+		for _, id := range node.Adjacency {
+			doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+				ID:     strconv.Itoa(len(doc.Graph.Edges)),
+				Source: node.ID,
+				Target: id,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+func cypherString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+func cypherName(s string) string {
+	return "`" + strings.Replace(s, "`", "``", -1) + "`"
+}
+
+// cypherLabel makes a node label of the topology ID, as Containers for
+// containers, or ContainersByImage for containers-by-image.
+func cypherLabel(topologyID string) string {
+	words := strings.FieldsFunc(topologyID, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return cypherName(strings.Join(words, ""))
+}
+
+// exportCypher returns statements creating the nodes, labelled Scope and by
+// topology, then their edges.
+func exportCypher(export topologyExport) ([]byte, error) {
+	var buf bytes.Buffer
+	label := cypherLabel(export.TopologyID)
+	for _, node := range export.Nodes {
+		properties := []string{
+			"id: " + cypherString(node.ID),
+			"label: " + cypherString(node.Label),
+			"labelMinor: " + cypherString(node.LabelMinor),
+			"rank: " + cypherString(node.Rank),
+			"shape: " + cypherString(node.Shape),
+			"pseudo: " + strconv.FormatBool(node.Pseudo),
+		}
+		for _, row := range node.Metadata {
+			properties = append(properties, cypherName(row.ID)+": "+cypherString(row.Value))
+		}
+		for _, row := range node.Metrics {
+			if !row.ValueEmpty {
+				properties = append(properties, cypherName(row.ID)+": "+strconv.FormatFloat(row.Value, 'g', -1, 64))
+			}
+		}
+		fmt.Fprintf(&buf, "CREATE (:Scope:%s {%s});\n", label, strings.Join(properties, ", "))
+	}
+	for _, node := range export.Nodes {
+		for _, id := range node.Adjacency {
+			fmt.Fprintf(&buf, "MATCH (a:Scope:%s {id: %s}), (b:Scope:%s {id: %s}) CREATE (a)-[:CONNECTS_TO]->(b);\n",
+				label, cypherString(node.ID), label, cypherString(id))
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,296 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// topologyQuery is what a client asks of the nodes of a topology, beyond
+// its options, so as not to be sent what it won't show:
+//
+//   - namespace=a,b: only nodes in these namespaces, as the namespace option
+//     of Kubernetes topologies, but for any topology.
+//   - label=key=value, any number of times: only nodes with all these Docker
+//     or Kubernetes labels.
+//   - search=query: only nodes matching the search query, as parsed by
+//     detailed.ParseSearch.
+//   - metadata=a,b and metrics=a,b: only send these metadata fields and
+//     metrics of nodes, by ID. Given empty, none are sent.
+//   - layout=force or layout=layered: also send where the nodes are placed
+//     by this layout, for graphs too big to lay out in browsers.
+//   - bundle=namespace, subnet or service: bundle the edges of nodes with
+//     more than bundle_threshold edges (detailed.DefaultBundleThreshold if
+//     not given) by the group of the nodes they go to.
+//   - anomalous=true: only nodes marked anomalous, when the app detects
+//     anomalies (see Registry.EnableAnomalies).
+//   - color_by=field and size_by=field: scale this metric or numeric
+//     metadata field of nodes, by ID or label, to color and size them by,
+//     into scale_buckets quantiles (detailed.DefaultScaleBuckets if not
+//     given).
+//   - limit=n: only the n nodes with the greatest sort_by field, a metric or
+//     numeric metadata field as for color_by, or the first n by ID, from
+//     the cursor on. The nodes left out are aggregated into a node of their
+//     own, and a cursor to the next n sent.
+type topologyQuery struct {
+	filter          render.FilterFunc // nil for all nodes
+	search          detailed.Search   // nil for all nodes
+	metadata        map[string]bool   // nil for all fields
+	metrics         map[string]bool   // nil for all metrics
+	layoutName      string            // "" for no layout
+	bundleBy        string            // "" for no bundling
+	bundleThreshold int
+	colorBy         string // "" for no coloring
+	sizeBy          string // "" for no sizing
+	scaleBuckets    int
+	limit           int // 0 for all nodes
+	sortBy          string
+	offset          int
+}
+
+func parseTopologyQuery(values url.Values) (topologyQuery, error) {
+	var (
+		query   topologyQuery
+		filters []render.FilterFunc
+	)
+	if namespaces := values.Get("namespace"); namespaces != "" {
+		var inNamespace []render.FilterFunc
+		for _, namespace := range strings.Split(namespaces, ",") {
+			inNamespace = append(inNamespace, render.IsNamespace(namespace))
+		}
+		filters = append(filters, render.AnyFilterFunc(render.IsPseudoTopology, render.AnyFilterFunc(inNamespace...)))
+	}
+	for _, label := range values["label"] {
+		if kv := strings.SplitN(label, "=", 2); len(kv) == 2 {
+			filters = append(filters, hasLabel(kv[0], kv[1]))
+		}
+	}
+	if anomalous, _ := strconv.ParseBool(values.Get("anomalous")); anomalous {
+		filters = append(filters, render.IsAnomalous)
+	}
+	if len(filters) > 0 {
+		query.filter = render.ComposeFilterFuncs(filters...)
+	}
+	if s := values.Get("search"); s != "" {
+		search, err := detailed.ParseSearch(s)
+		if err != nil {
+			return query, fmt.Errorf("invalid search: %v", err)
+		}
+		query.search = search
+	}
+	query.metadata = idSet(values, "metadata")
+	query.metrics = idSet(values, "metrics")
+	if layout := values.Get("layout"); layout != "" {
+		if err := detailed.CheckLayout(layout); err != nil {
+			return query, err
+		}
+		query.layoutName = layout
+	}
+	if by := values.Get("bundle"); by != "" {
+		if err := detailed.CheckBundleBy(by); err != nil {
+			return query, err
+		}
+		query.bundleBy = by
+		query.bundleThreshold = detailed.DefaultBundleThreshold
+		if s := values.Get("bundle_threshold"); s != "" {
+			threshold, err := strconv.Atoi(s)
+			if err != nil || threshold < 0 {
+				return query, fmt.Errorf("invalid bundle_threshold: %q", s)
+			}
+			query.bundleThreshold = threshold
+		}
+	}
+	query.colorBy = values.Get("color_by")
+	query.sizeBy = values.Get("size_by")
+	query.scaleBuckets = detailed.DefaultScaleBuckets
+	if s := values.Get("scale_buckets"); s != "" {
+		buckets, err := strconv.Atoi(s)
+		if err != nil || buckets <= 0 {
+			return query, fmt.Errorf("invalid scale_buckets: %q", s)
+		}
+		query.scaleBuckets = buckets
+	}
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %q", s)
+		}
+		query.limit = limit
+		query.sortBy = values.Get("sort_by")
+		if s := values.Get("cursor"); s != "" {
+			offset, err := strconv.Atoi(s)
+			if err != nil || offset < 0 {
+				return query, fmt.Errorf("invalid cursor: %q", s)
+			}
+			query.offset = offset
+		}
+	}
+	return query, nil
+}
+
+// parseConnectionsQuery parses what a client asks of connections tables,
+// from the query parameters with the prefix: filter=text, sort_by=count,
+// port or remote, order=asc or desc, and limit=n, from the cursor on.
+func parseConnectionsQuery(values url.Values, prefix string) (detailed.ConnectionsQuery, error) {
+	query := detailed.ConnectionsQuery{Filter: values.Get(prefix + "filter")}
+	if by := values.Get(prefix + "sort_by"); by != "" {
+		if err := detailed.CheckConnectionsSortBy(by); err != nil {
+			return query, err
+		}
+		query.SortBy = by
+	}
+	if order := values.Get(prefix + "order"); order != "" {
+		if err := detailed.CheckConnectionsOrder(order); err != nil {
+			return query, err
+		}
+		query.Order = order
+	}
+	if s := values.Get(prefix + "limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid %slimit: %q", prefix, s)
+		}
+		query.Limit = limit
+	}
+	if s := values.Get(prefix + "cursor"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return query, fmt.Errorf("invalid %scursor: %q", prefix, s)
+		}
+		query.Offset = offset
+	}
+	return query, nil
+}
+
+// idSet returns the comma separated IDs of the query parameter key, or nil
+// if there is no such parameter.
+func idSet(values url.Values, key string) map[string]bool {
+	if _, ok := values[key]; !ok {
+		return nil
+	}
+	ids := map[string]bool{}
+	for _, id := range strings.Split(values.Get(key), ",") {
+		if id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// hasLabel checks if the node has the Docker or Kubernetes label.
+func hasLabel(key, value string) render.FilterFunc {
+	return func(n report.Node) bool {
+		for _, prefix := range []string{docker.LabelPrefix, kubernetes.LabelPrefix} {
+			if v, ok := n.Latest.Lookup(prefix + key); ok && v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// transformer returns the filters and search of the query, followed by t.
+// Nodes are searched as they are summarised in rc.
+func (q topologyQuery) transformer(rc detailed.RenderContext, t render.Transformer) render.Transformer {
+	var filters []render.FilterFunc
+	if q.filter != nil {
+		filters = append(filters, q.filter)
+	}
+	if q.search != nil {
+		filters = append(filters, detailed.SearchFilter(rc, q.search))
+	}
+	if len(filters) == 0 {
+		return t
+	}
+	return render.Transformers([]render.Transformer{render.ComposeFilterFuncs(filters...), t})
+}
+
+// apply cuts the summaries to the fields asked for.
+func (q topologyQuery) apply(summaries detailed.NodeSummaries) detailed.NodeSummaries {
+	if q.metadata == nil && q.metrics == nil {
+		return summaries
+	}
+	result := make(detailed.NodeSummaries, len(summaries))
+	for id, summary := range summaries {
+		if q.metadata != nil {
+			var metadata []report.MetadataRow
+			for _, row := range summary.Metadata {
+				if q.metadata[row.ID] {
+					metadata = append(metadata, row)
+				}
+			}
+			summary.Metadata = metadata
+		}
+		if q.metrics != nil {
+			var metrics []report.MetricRow
+			for _, row := range summary.Metrics {
+				if q.metrics[row.ID] {
+					metrics = append(metrics, row)
+				}
+			}
+			summary.Metrics = metrics
+		}
+		result[id] = summary
+	}
+	return result
+}
+
+// layout places the summaries by the layout asked for, if any.
+func (q topologyQuery) layout(summaries detailed.NodeSummaries) detailed.Layout {
+	if q.layoutName == "" {
+		return nil
+	}
+	return detailed.MakeLayout(q.layoutName, summaries)
+}
+
+// bundle bundles the edges of the summaries as asked for, if at all. nodes
+// are the rendered nodes the summaries were made of.
+func (q topologyQuery) bundle(summaries detailed.NodeSummaries, nodes report.Nodes) detailed.NodeSummaries {
+	if q.bundleBy == "" {
+		return summaries
+	}
+	return detailed.BundleEdges(summaries, nodes, q.bundleBy, q.bundleThreshold)
+}
+
+// scale colors and sizes the summaries by the fields asked for, if any.
+// It must come before apply, which may cut the fields.
+func (q topologyQuery) scale(summaries detailed.NodeSummaries) detailed.NodeSummaries {
+	if q.colorBy == "" && q.sizeBy == "" {
+		return summaries
+	}
+	var colors, sizes map[string]detailed.ScaledValue
+	if q.colorBy != "" {
+		colors = detailed.Scale(summaries, q.colorBy, q.scaleBuckets)
+	}
+	if q.sizeBy != "" {
+		sizes = detailed.Scale(summaries, q.sizeBy, q.scaleBuckets)
+	}
+	result := make(detailed.NodeSummaries, len(summaries))
+	for id, summary := range summaries {
+		if color, ok := colors[id]; ok {
+			summary.Color = &color
+		}
+		if size, ok := sizes[id]; ok {
+			summary.Size = &size
+		}
+		result[id] = summary
+	}
+	return result
+}
+
+// truncate returns the page of the summaries asked for, if limited, and
+// the cursor to the next page. It must come before apply, which may cut
+// the field the summaries are ranked by.
+func (q topologyQuery) truncate(summaries detailed.NodeSummaries) (detailed.NodeSummaries, string) {
+	if q.limit == 0 {
+		return summaries, ""
+	}
+	return detailed.Truncate(summaries, q.sortBy, q.offset, q.limit)
+}
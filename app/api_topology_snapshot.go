@@ -0,0 +1,402 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Sizes of snapshots of the graph, in pixels.
+const (
+	snapshotNodeRadius  = 25
+	snapshotSpacingX    = 150
+	snapshotSpacingY    = 130
+	snapshotMargin      = 80
+	snapshotGridColumns = 8
+	snapshotLabelLength = 24
+)
+
+// snapshotLayout is where the nodes of a snapshot go.
+type snapshotLayout struct {
+	x, y          map[string]float64
+	width, height float64
+}
+
+// layoutSnapshot lays out the nodes as the UI does, roughly: nodes with
+// edges in layers, top to bottom along them, and those without in a grid
+// below.
+func layoutSnapshot(nodes []detailed.NodeSummary) snapshotLayout {
+	var (
+		byID      = map[string]detailed.NodeSummary{}
+		connected = map[string]bool{}
+		layout    = snapshotLayout{x: map[string]float64{}, y: map[string]float64{}}
+	)
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+	for _, node := range nodes {
+		for _, id := range node.Adjacency {
+			if id != node.ID {
+				connected[node.ID], connected[id] = true, true
+			}
+		}
+	}
+
+	// Drop the edges closing cycles, and order the rest topologically
+	var (
+		state = map[string]int{} // 1 while visiting, 2 once visited
+		order []string           // reversed
+		edges = map[string][]string{}
+		visit func(string)
+	)
+	visit = func(id string) {
+		state[id] = 1
+		for _, to := range byID[id].Adjacency {
+			if to == id || !connected[to] || state[to] == 1 {
+				continue
+			}
+			edges[id] = append(edges[id], to)
+			if state[to] == 0 {
+				visit(to)
+			}
+		}
+		state[id] = 2
+		order = append(order, id)
+	}
+	for _, node := range nodes {
+		if connected[node.ID] && state[node.ID] == 0 {
+			visit(node.ID)
+		}
+	}
+
+	// Nodes go a layer below the lowest of those with edges to them
+	layer := map[string]int{}
+	predecessors := map[string][]string{}
+	layers := [][]string{}
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		for len(layers) <= layer[id] {
+			layers = append(layers, nil)
+		}
+		layers[layer[id]] = append(layers[layer[id]], id)
+		for _, to := range edges[id] {
+			if layer[id]+1 > layer[to] {
+				layer[to] = layer[id] + 1
+			}
+			predecessors[to] = append(predecessors[to], id)
+		}
+	}
+
+	// Order each layer by the positions of the nodes above, to cut down on
+	// crossing edges
+	position := map[string]float64{}
+	widest := 0
+	for i, ids := range layers {
+		barycenter := map[string]float64{}
+		for _, id := range ids {
+			sum, count := 0.0, 0
+			for _, from := range predecessors[id] {
+				if layer[from] < i {
+					sum += position[from]
+					count++
+				}
+			}
+			if count > 0 {
+				barycenter[id] = sum / float64(count)
+			}
+		}
+		sort.SliceStable(ids, func(a, b int) bool {
+			if barycenter[ids[a]] != barycenter[ids[b]] {
+				return barycenter[ids[a]] < barycenter[ids[b]]
+			}
+			return ids[a] < ids[b]
+		})
+		for j, id := range ids {
+			position[id] = float64(j)
+		}
+		if len(ids) > widest {
+			widest = len(ids)
+		}
+	}
+
+	var unconnected []string
+	for _, node := range nodes {
+		if !connected[node.ID] {
+			unconnected = append(unconnected, node.ID)
+		}
+	}
+	if len(unconnected) > 0 && widest < snapshotGridColumns {
+		widest = snapshotGridColumns
+		if len(unconnected) < widest {
+			widest = len(unconnected)
+		}
+	}
+
+	for i, ids := range layers {
+		offset := float64(widest-len(ids)) / 2
+		for j, id := range ids {
+			layout.x[id] = snapshotMargin + (offset+float64(j))*snapshotSpacingX
+			layout.y[id] = snapshotMargin + float64(i)*snapshotSpacingY
+		}
+	}
+	columns := widest
+	if columns > snapshotGridColumns {
+		columns = snapshotGridColumns
+	}
+	for i, id := range unconnected {
+		layout.x[id] = snapshotMargin + float64(i%columns)*snapshotSpacingX
+		layout.y[id] = snapshotMargin + float64(len(layers)+i/columns)*snapshotSpacingY
+	}
+
+	rows := len(layers)
+	if len(unconnected) > 0 {
+		rows += (len(unconnected) + columns - 1) / columns
+	}
+	layout.width = 2*snapshotMargin + float64(widest-1)*snapshotSpacingX
+	layout.height = 2*snapshotMargin + float64(rows-1)*snapshotSpacingY
+	if widest == 0 {
+		layout.width = 2 * snapshotMargin
+	}
+	if rows == 0 {
+		layout.height = 2 * snapshotMargin
+	}
+	return layout
+}
+
+// snapshotColor returns the color of nodes as the UI picks it, from their
+// rank and label.
+func snapshotColor(node detailed.NodeSummary) string {
+	if node.Pseudo {
+		return "#b1b1cb"
+	}
+	const minHue, maxHue = 20.0, 330.0
+	degree := func(text string) float64 {
+		if len(text) > 2 {
+			text = text[:2]
+		}
+		text = strings.ToUpper(text)
+		const letters = 'Z' - 'A'
+		num := 0.0
+		for i := 0; i < len(text); i++ {
+			c := math.Max(math.Min(float64(text[i]), 'Z'), 'A')
+			num += math.Pow(letters, float64(len(text)-i-1)) * (c - 'A')
+		}
+		return minHue + num/math.Pow(letters, float64(len(text)))*(maxHue-minHue)
+	}
+	hue := degree(node.Rank)
+	if hue > 70 && hue < 150 { // skip green
+		hue += 80
+	}
+	lightness := 0.5
+	if node.Label != "" {
+		lightness = 0.5 + (degree(node.Label)-minHue)/(maxHue-minHue)*0.2
+	}
+	return fmt.Sprintf("hsl(%.0f, 60%%, %.0f%%)", hue, lightness*100)
+}
+
+// snapshotShape draws the shape of a node, centered on x, y.
+func snapshotShape(buf *bytes.Buffer, shape string, x, y float64, attrs string) {
+	const r = snapshotNodeRadius
+	polygon := func(sides int, rotation float64) {
+		points := make([]string, sides)
+		for i := range points {
+			angle := rotation + 2*math.Pi*float64(i)/float64(sides)
+			points[i] = fmt.Sprintf("%.1f,%.1f", x+r*math.Cos(angle), y+r*math.Sin(angle))
+		}
+		fmt.Fprintf(buf, `<polygon points="%s" %s/>`, strings.Join(points, " "), attrs)
+	}
+	switch shape {
+	case report.Triangle:
+		polygon(3, -math.Pi/2)
+	case report.Square:
+		fmt.Fprintf(buf, `<rect x="%.1f" y="%.1f" width="%d" height="%d" rx="4" %s/>`, x-r*0.9, y-r*0.9, int(r*1.8), int(r*1.8), attrs)
+	case report.Pentagon:
+		polygon(5, -math.Pi/2)
+	case report.Hexagon:
+		polygon(6, 0)
+	case report.Heptagon:
+		polygon(7, -math.Pi/2)
+	case report.Octagon:
+		polygon(8, math.Pi/8)
+	case report.Cloud:
+		fmt.Fprintf(buf, `<ellipse cx="%.1f" cy="%.1f" rx="%.1f" ry="%.1f" %s/>`, x, y, r*1.3, r*0.8, attrs)
+	default:
+		fmt.Fprintf(buf, `<circle cx="%.1f" cy="%.1f" r="%d" %s/>`, x, y, r, attrs)
+	}
+}
+
+func truncateLabel(label string) string {
+	if runes := []rune(label); len(runes) > snapshotLabelLength {
+		return string(runes[:snapshotLabelLength-1]) + "…"
+	}
+	return label
+}
+
+// snapshotSVG draws the graph of the topology. Nodes link to #node-<index>,
+// given link.
+func snapshotSVG(export topologyExport, link bool) []byte {
+	layout := layoutSnapshot(export.Nodes)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif">`,
+		layout.width, layout.height, layout.width, layout.height)
+	fmt.Fprintf(&buf, "\n<title>%s</title>\n", html.EscapeString(export.Name))
+	buf.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto">` +
+		`<path d="M 0 0 L 10 5 L 0 10 z" fill="#6e6e9c"/></marker></defs>` + "\n")
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#f8f8fb"/>`+"\n")
+
+	buf.WriteString(`<g class="edges">` + "\n")
+	for _, node := range export.Nodes {
+		for _, id := range node.Adjacency {
+			if id == node.ID {
+				continue
+			}
+			x1, y1, x2, y2 := layout.x[node.ID], layout.y[node.ID], layout.x[id], layout.y[id]
+			length := math.Hypot(x2-x1, y2-y1)
+			if length < 2*snapshotNodeRadius {
+				continue
+			}
+			dx, dy := (x2-x1)/length*(snapshotNodeRadius+4), (y2-y1)/length*(snapshotNodeRadius+4)
+			style := `stroke="#6e6e9c" stroke-opacity="0.6"`
+			if node.DegradedAdjacency.Contains(id) {
+				style = `stroke="rgb(215, 96, 84)" stroke-dasharray="4, 2"`
+			}
+			fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke-width="2" %s marker-end="url(#arrow)"/>`+"\n",
+				x1+dx, y1+dy, x2-dx, y2-dy, style)
+		}
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString(`<g class="nodes">` + "\n")
+	for i, node := range export.Nodes {
+		x, y := layout.x[node.ID], layout.y[node.ID]
+		if link {
+			fmt.Fprintf(&buf, `<a href="#node-%d">`, i)
+		}
+		fmt.Fprintf(&buf, `<g class="node"><title>%s</title>`, html.EscapeString(node.Label))
+		color := snapshotColor(node)
+		if len(node.Alerts) > 0 {
+			color = "rgb(215, 96, 84)"
+		}
+		attrs := fmt.Sprintf(`fill="#fff" stroke="%s" stroke-width="3"`, color)
+		if node.Pseudo {
+			attrs += ` stroke-dasharray="4, 3"`
+		}
+		if node.Stack {
+			snapshotShape(&buf, node.Shape, x+6, y-6, attrs)
+			snapshotShape(&buf, node.Shape, x+3, y-3, attrs)
+		}
+		snapshotShape(&buf, node.Shape, x, y, attrs)
+		label := truncateLabel(node.Label)
+		if len(node.Annotations) > 0 {
+			label += " ✎"
+		}
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="14" fill="#32324b">%s</text>`,
+			x, y+snapshotNodeRadius+20, html.EscapeString(label))
+		if node.LabelMinor != "" {
+			fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="12" fill="#8585a5">%s</text>`,
+				x, y+snapshotNodeRadius+36, html.EscapeString(truncateLabel(node.LabelMinor)))
+		}
+		buf.WriteString("</g>")
+		if link {
+			buf.WriteString("</a>")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("</g>\n</svg>\n")
+	return buf.Bytes()
+}
+
+func exportSVG(export topologyExport) ([]byte, error) {
+	return append([]byte(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"), snapshotSVG(export, false)...), nil
+}
+
+// formatSnapshotMetric formats the value of the metric as the UI does.
+func formatSnapshotMetric(row report.MetricRow) string {
+	number := func(value float64) string {
+		if value >= 0 && value < 1100 {
+			return fmt.Sprintf("%.2f", value)
+		}
+		for _, unit := range []struct {
+			suffix string
+			size   float64
+		}{{"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"k", 1e3}} {
+			if math.Abs(value) >= unit.size {
+				return fmt.Sprintf("%.1f%s", value/unit.size, unit.suffix)
+			}
+		}
+		return fmt.Sprintf("%.2f", value)
+	}
+	switch row.Format {
+	case report.FilesizeFormat:
+		units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+		value, i := row.Value, 0
+		for ; math.Abs(value) >= 1024 && i < len(units)-1; i++ {
+			value /= 1024
+		}
+		return fmt.Sprintf("%.1f %s", value, units[i])
+	case report.IntegerFormat:
+		if row.Value >= 0 && row.Value < 1100 {
+			return fmt.Sprintf("%.0f", row.Value)
+		}
+		return number(math.Floor(row.Value + 0.5))
+	case report.PercentFormat:
+		return number(row.Value) + "%"
+	}
+	return number(row.Value)
+}
+
+var snapshotTemplate = template.Must(template.New("snapshot").Funcs(template.FuncMap{
+	"metric": formatSnapshotMetric,
+	"join":   strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} at {{.Timestamp.UTC.Format "2006-01-02 15:04:05 MST"}}</title>
+<style>
+body { font-family: sans-serif; color: #32324b; margin: 2em; }
+h1 small, h2 small { color: #8585a5; font-weight: normal; }
+.graph { overflow: auto; border: 1px solid #e2e2ec; margin-bottom: 2em; }
+section { margin-bottom: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+th { color: #8585a5; font-weight: normal; }
+.alerts { color: rgb(215, 96, 84); }
+blockquote { border-left: 4px solid #8585a5; margin: 0.5em 0; padding: 0.2em 1em; }
+blockquote.warning { border-color: #ffa500; }
+blockquote.critical { border-color: rgb(215, 96, 84); }
+</style>
+</head>
+<body>
+<h1>{{.Name}} <small>at {{.Timestamp.UTC.Format "2006-01-02 15:04:05 MST"}}</small></h1>
+<div class="graph">{{.Graph}}</div>
+{{range $i, $node := .Nodes}}{{if not .Pseudo}}<section id="node-{{$i}}">
+<h2>{{.Label}} <small>{{.LabelMinor}}</small></h2>
+{{if .Alerts}}<p class="alerts">Alerting: {{join .Alerts ", "}}</p>
+{{end}}{{range .Annotations}}<blockquote class="{{.Severity}}">{{.Text}}{{if .Author}} <small>&mdash; {{.Author}}</small>{{end}}{{range .Links}}<br><a href="{{.}}">{{.}}</a>{{end}}</blockquote>
+{{end}}<table>
+{{range .Metadata}}<tr><th>{{.Label}}</th><td>{{.Value}}</td></tr>
+{{end}}{{range .Metrics}}{{if not .ValueEmpty}}<tr><th>{{.Label}}</th><td>{{metric .}}</td></tr>
+{{end}}{{end}}</table>
+</section>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// exportHTML makes a page with the graph of the topology, and the details
+// of its nodes, which needs nothing else to be viewed.
+func exportHTML(export topologyExport) ([]byte, error) {
+	var buf bytes.Buffer
+	err := snapshotTemplate.Execute(&buf, struct {
+		topologyExport
+		Graph template.HTML
+	}{export, template.HTML(snapshotSVG(export, true))})
+	return buf.Bytes(), err
+}
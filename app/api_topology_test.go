@@ -1,14 +1,22 @@
 package app_test
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/websocket"
 	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/detailed"
 	"github.com/weaveworks/scope/render/expected"
 	"github.com/weaveworks/scope/test/fixture"
@@ -117,7 +125,290 @@ func TestAPITopologyHosts(t *testing.T) {
 	}
 }
 
+func TestAPITopologyGroupBy(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	body := getRawJSON(t, ts, "/api/topology/containers?system=all&group_by="+fixture.TestLabelKey1)
+	var topo app.APITopology
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&topo); err != nil {
+		t.Fatal(err)
+	}
+	node, ok := topo.Nodes[fixture.ApplicationLabelValue1]
+	if !ok {
+		t.Fatalf("Expected a node for %s, got %v", fixture.ApplicationLabelValue1, topo.Nodes)
+	}
+	equals(t, fixture.ApplicationLabelValue1, node.Label)
+	equals(t, "1 container", node.LabelMinor)
+	if _, ok := topo.Nodes[render.MakePseudoNodeID(render.UngroupedID, fixture.TestLabelKey1)]; !ok {
+		t.Errorf("Expected the other containers to be ungrouped, got %v", topo.Nodes)
+	}
+}
+
+func TestAPITopologyLayout(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	body := getRawJSON(t, ts, "/api/topology/hosts?layout=layered")
+	var topo app.APITopology
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&topo); err != nil {
+		t.Fatal(err)
+	}
+	for id := range topo.Nodes {
+		if _, ok := topo.Layout[id]; !ok {
+			t.Errorf("Expected %s to be placed, got %v", id, topo.Layout)
+		}
+	}
+	res, _ := checkRequest(t, ts, "GET", "/api/topology/hosts?layout=circular", nil)
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPITopologyScales(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	body := getRawJSON(t, ts, "/api/topology/hosts?color_by=host_cpu_usage_percent&size_by=Memory&scale_buckets=2")
+	var topo app.APITopology
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&topo); err != nil {
+		t.Fatal(err)
+	}
+	client, server := topo.Nodes[fixture.ClientHostNodeID], topo.Nodes[fixture.ServerHostNodeID]
+	if client.Color == nil || server.Color == nil || client.Size == nil || server.Size == nil {
+		t.Fatalf("Expected the hosts colored and sized, got %v and %v", client, server)
+	}
+	equals(t, detailed.ScaledValue{Value: 0.07, Normalized: 0, Bucket: 0}, *client.Color)
+	equals(t, detailed.ScaledValue{Value: 0.12, Normalized: 1, Bucket: 1}, *server.Color)
+	equals(t, 1, server.Size.Bucket)
+	res, _ := checkRequest(t, ts, "GET", "/api/topology/hosts?color_by=cpu&scale_buckets=0", nil)
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPITopologyLimit(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	body := getRawJSON(t, ts, "/api/topology/hosts?limit=1&sort_by=host_cpu_usage_percent")
+	var topo app.APITopology
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&topo); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := topo.Nodes[fixture.ServerHostNodeID]; !ok || len(topo.Nodes) != 2 {
+		t.Errorf("Expected the server host and the other nodes, got %v", topo.Nodes)
+	}
+	if _, ok := topo.Nodes[detailed.OtherNodesID]; !ok {
+		t.Errorf("Expected the other nodes, got %v", topo.Nodes)
+	}
+	equals(t, "1", topo.Cursor)
+	res, _ := checkRequest(t, ts, "GET", "/api/topology/hosts?limit=1&cursor=-1", nil)
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPITopologyEdgeBundles(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	body := getRawJSON(t, ts, "/api/topology/containers/"+url.QueryEscape(fixture.ClientContainerNodeID)+
+		"/bundles/"+url.QueryEscape("namespace:"+fixture.KubernetesNamespace))
+	var bundle app.APIEdgeBundle
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&bundle); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, []string{fixture.ServerContainerNodeID}, []string(bundle.Adjacency))
+
+	is404(t, ts, "/api/topology/containers/foobar/bundles/namespace:default")
+	for _, path := range []string{
+		"/api/topology/containers/" + url.QueryEscape(fixture.ClientContainerNodeID) + "/bundles/rack:a",
+		"/api/topology/containers?bundle=rack",
+		"/api/topology/containers?bundle=namespace&bundle_threshold=lots",
+	} {
+		res, _ := checkRequest(t, ts, "GET", path, nil)
+		equals(t, http.StatusBadRequest, res.StatusCode)
+	}
+}
+
 // Basic websocket test
+func TestAPITopologyConnections(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	path := "/api/topology/containers/" + url.QueryEscape(fixture.ServerContainerNodeID) + "/connections/incoming"
+	get := func(query string) detailed.ConnectionsSummary {
+		body := getRawJSON(t, ts, path+query)
+		var connections detailed.ConnectionsSummary
+		decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+		if err := decoder.Decode(&connections); err != nil {
+			t.Fatal(err)
+		}
+		return connections
+	}
+
+	all := get("")
+	equals(t, "incoming-connections", all.ID)
+	if len(all.Connections) < 2 {
+		t.Fatalf("Expected connections from the client and the internet, got %v", all.Connections)
+	}
+	page := get("?sort_by=count&limit=1")
+	equals(t, len(all.Connections), page.Total)
+	equals(t, 1, len(page.Connections))
+	equals(t, "1", page.Cursor)
+	filtered := get("?filter=" + url.QueryEscape(fixture.ClientContainerName))
+	equals(t, 1, filtered.Total)
+	equals(t, fixture.ClientContainerNodeID, filtered.Connections[0].NodeID)
+
+	is404(t, ts, "/api/topology/containers/foobar/connections/incoming")
+	is404(t, ts, path[:len(path)-len("incoming")]+"sideways")
+	for _, query := range []string{"?sort_by=age", "?order=up", "?limit=0", "?cursor=-1"} {
+		res, _ := checkRequest(t, ts, "GET", path+query, nil)
+		equals(t, http.StatusBadRequest, res.StatusCode)
+	}
+	res, _ := checkRequest(t, ts, "GET", "/api/topology/containers/"+url.QueryEscape(fixture.ServerContainerNodeID)+"?connections_sort_by=age", nil)
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPITopologyImpact(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	path := "/api/topology/containers/" + url.QueryEscape(fixture.ServerContainerNodeID) + "/impact"
+	body := getRawJSON(t, ts, path+"?depth=2")
+	var impact detailed.Impact
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&impact); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, fixture.ServerContainerNodeID, impact.ID)
+	equals(t, 2, impact.Depth)
+	upstream := map[string]bool{}
+	for _, n := range impact.Upstream {
+		upstream[n.ID] = true
+	}
+	if !upstream[fixture.ClientContainerNodeID] {
+		t.Errorf("Expected the client upstream of the server, got %v", impact.Upstream)
+	}
+
+	is404(t, ts, "/api/topology/containers/foobar/impact")
+	for _, query := range []string{"?depth=0", "?depth=100", "?depth=deep"} {
+		res, _ := checkRequest(t, ts, "GET", path+query, nil)
+		equals(t, http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestAPITopologyPaths(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	get := func(path string) detailed.Paths {
+		body := getRawJSON(t, ts, path)
+		var paths detailed.Paths
+		if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&paths); err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+	lastOf := func(path detailed.Path) string {
+		return path.Nodes[len(path.Nodes)-1].ID
+	}
+
+	// From a container to another, through their processes
+	path := "/api/topology/containers/" + url.QueryEscape(fixture.ClientContainerNodeID) + "/paths"
+	paths := get(path + "?to=" + url.QueryEscape(fixture.ServerContainerNodeID))
+	equals(t, "processes", paths.Via)
+	if len(paths.Paths) == 0 {
+		t.Fatalf("Expected paths from the client to the server, got none")
+	}
+	for _, p := range paths.Paths {
+		equals(t, fixture.ServerProcessNodeID, lastOf(p))
+	}
+
+	// From a host to a container, across topologies, through containers
+	paths = get("/api/topology/hosts/" + url.QueryEscape(fixture.ClientHostNodeID) + "/paths?to_topology=containers&via=containers&to=" + url.QueryEscape(fixture.ServerContainerNodeID))
+	if len(paths.Paths) == 0 {
+		t.Fatalf("Expected paths from the client host to the server container, got none")
+	}
+	for _, p := range paths.Paths {
+		equals(t, fixture.ServerContainerNodeID, lastOf(p))
+	}
+
+	is404(t, ts, "/api/topology/containers/foobar/paths?to="+url.QueryEscape(fixture.ServerContainerNodeID))
+	is404(t, ts, path+"?to=foobar")
+	for _, query := range []string{"", "?to=x&max_length=0", "?to=x&max_length=100", "?to=x&via=nowhere", "?to=x&to_topology=nowhere"} {
+		res, _ := checkRequest(t, ts, "GET", path+query, nil)
+		equals(t, http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestAPITopologyTraffic(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	body := getRawJSON(t, ts, "/api/topology/containers/traffic?to_by="+fixture.TestLabelKey2+"&columns="+fixture.ApplicationLabelValue2)
+	var matrix detailed.TrafficMatrix
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&matrix); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, detailed.TrafficByNamespace, matrix.By)
+	equals(t, fixture.TestLabelKey2, matrix.ToBy)
+	equals(t, []string{fixture.ApplicationLabelValue2}, matrix.Columns)
+	if matrix.Total == 0 {
+		t.Errorf("Expected connections to %s, got %+v", fixture.ApplicationLabelValue2, matrix)
+	}
+	is404(t, ts, "/api/topology/foobar/traffic")
+}
+
+func TestAPITopologyNodeMetricsRange(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	path := "/api/topology/hosts/" + url.QueryEscape(fixture.ClientHostNodeID)
+	// There's no history of metrics to ask for
+	for _, query := range []string{"?start=1h", "?start=1h&step=1s", "?end=1h"} {
+		res, _ := checkRequest(t, ts, "GET", path+query, nil)
+		equals(t, http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestAPITopologyNodeExport(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	path := "/api/topology/containers/" + url.QueryEscape(fixture.ServerContainerNodeID)
+
+	res, body := checkRequest(t, ts, "GET", path+"?export=incoming-connections&connections_sort_by=count", nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	equals(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, []string{"Node", "Port", "Count"}, records[0])
+	if len(records) < 3 {
+		t.Errorf("Expected connections from the client and the internet, got %v", records)
+	}
+
+	res, body = checkRequest(t, ts, "GET", path+"?export=incoming-connections&format=ndjson&connections_filter="+fixture.ClientContainerName, nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	var row map[string]string
+	if err := json.Unmarshal(body, &row); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, fixture.ClientContainerName, row["node"])
+	equals(t, fixture.ServerPort, row["port"])
+
+	is404(t, ts, path+"?export=nothing")
+	is400(t, ts, path+"?export=incoming-connections&format=xls")
+}
+
+func TestAPITopologyChanges(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	is400(t, ts, "/api/topology/containers/changes")
+	is400(t, ts, "/api/topology/containers/changes?from=yesterday")
+	is404(t, ts, "/api/topology/foobar/changes?from=2017-07-14T02:40:00Z")
+
+	// The fixture is the same at any time, so nothing changed
+	body := getRawJSON(t, ts, "/api/topology/containers/changes?from=2017-07-14T02:40:00Z&to=2017-07-14T03:40:00Z")
+	var changes detailed.Changes
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&changes); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 0, len(changes.Added)+len(changes.Removed)+len(changes.Changed))
+	equals(t, 2017, changes.To.Year())
+}
+
 func TestAPITopologyWebsocket(t *testing.T) {
 	ts := topologyServer()
 	defer ts.Close()
@@ -153,3 +444,151 @@ func TestAPITopologyWebsocket(t *testing.T) {
 }
 
 func newu64(value uint64) *uint64 { return &value }
+
+func TestAPITopologyQuery(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	getTopology := func(query string) app.APITopology {
+		body := getRawJSON(t, ts, "/api/topology/containers?"+query)
+		var topo app.APITopology
+		decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+		if err := decoder.Decode(&topo); err != nil {
+			t.Fatal(err)
+		}
+		return topo
+	}
+
+	all := getTopology("")
+	if _, ok := all.Nodes[fixture.ClientContainerNodeID]; !ok {
+		t.Fatalf("Expected client container, have %v", all.Nodes)
+	}
+
+	topo := getTopology("label=foo1=bar1")
+	equals(t, 1, len(topo.Nodes))
+	if _, ok := topo.Nodes[fixture.ServerContainerNodeID]; !ok {
+		t.Errorf("Expected server container, have %v", topo.Nodes)
+	}
+
+	topo = getTopology("namespace=" + fixture.KubernetesNamespace)
+	if _, ok := topo.Nodes[fixture.ClientContainerNodeID]; !ok {
+		t.Errorf("Expected client container, have %v", topo.Nodes)
+	}
+	topo = getTopology("namespace=foo")
+	if _, ok := topo.Nodes[fixture.ClientContainerNodeID]; ok {
+		t.Errorf("Expected no client container, have %v", topo.Nodes)
+	}
+
+	topo = getTopology("search=" + url.QueryEscape("image:image/server"))
+	equals(t, 1, len(topo.Nodes))
+	if _, ok := topo.Nodes[fixture.ServerContainerNodeID]; !ok {
+		t.Errorf("Expected server container, have %v", topo.Nodes)
+	}
+
+	topo = getTopology("search=" + url.QueryEscape("image:image/server OR image:image/client"))
+	equals(t, 2, len(topo.Nodes))
+	is400(t, ts, "/api/topology/containers?search="+url.QueryEscape("cpu > lots"))
+
+	topo = getTopology("metadata=&metrics=docker_cpu_total_usage")
+	for id, node := range topo.Nodes {
+		equals(t, 0, len(node.Metadata))
+		equals(t, len(all.Nodes[id].Metrics) > 0, len(node.Metrics) > 0)
+		for _, metric := range node.Metrics {
+			equals(t, "docker_cpu_total_usage", metric.ID)
+		}
+	}
+}
+
+func TestAPITopologyExport(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	export := func(query string) (string, string) {
+		res, body := checkRequest(t, ts, "GET", "/api/topology/containers/export?"+query, nil)
+		equals(t, http.StatusOK, res.StatusCode)
+		return res.Header.Get("Content-Type"), string(body)
+	}
+	contains := func(s, substr string) {
+		if !strings.Contains(s, substr) {
+			t.Errorf("Expected %q in:\n%s", substr, s)
+		}
+	}
+	client, server := strconv.Quote(fixture.ClientContainerNodeID), strconv.Quote(fixture.ServerContainerNodeID)
+
+	contentType, dot := export("format=dot")
+	equals(t, "text/vnd.graphviz; charset=utf-8", contentType)
+	contains(dot, `digraph "containers" {`)
+	contains(dot, client+` -> `+server+`;`)
+
+	// Exports are filtered as the topology is
+	_, dot = export("format=dot&search=image:image/server")
+	contains(dot, server+` [label="server`)
+	if strings.Contains(dot, client) || strings.Contains(dot, "->") {
+		t.Errorf("Expected only the server, have:\n%s", dot)
+	}
+
+	_, gexf := export("format=gexf")
+	var doc struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>nodes>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"graph>edges>edge"`
+	}
+	ok(t, xml.Unmarshal([]byte(gexf), &doc))
+	found := false
+	for _, edge := range doc.Edges {
+		found = found || (edge.Source == fixture.ClientContainerNodeID && edge.Target == fixture.ServerContainerNodeID)
+	}
+	equals(t, true, found)
+
+	_, cypher := export("format=cypher")
+	contains(cypher, "CREATE (:Scope:`Containers` {id: '"+fixture.ServerContainerNodeID+"', label: 'server'")
+	contains(cypher, "MATCH (a:Scope:`Containers` {id: '"+fixture.ClientContainerNodeID+"'}), (b:Scope:`Containers` {id: '"+fixture.ServerContainerNodeID+"'}) CREATE (a)-[:CONNECTS_TO]->(b);")
+
+	res, _ := checkRequest(t, ts, "GET", "/api/topology/containers/export?format=png", nil)
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAPITopologySnapshot(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	res, body := checkRequest(t, ts, "GET", "/api/topology/containers/export?format=svg", nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	equals(t, "image/svg+xml; charset=utf-8", res.Header.Get("Content-Type"))
+	var svg struct {
+		XMLName xml.Name
+		Texts   []string `xml:"g>g>text"`
+		Lines   []struct {
+			X1 string `xml:"x1,attr"`
+		} `xml:"g>line"`
+	}
+	ok(t, xml.Unmarshal(body, &svg))
+	equals(t, "svg", svg.XMLName.Local)
+	found := false
+	for _, text := range svg.Texts {
+		found = found || text == "server"
+	}
+	equals(t, true, found)
+	if len(svg.Lines) == 0 {
+		t.Errorf("Expected edges, have:\n%s", body)
+	}
+
+	res, body = checkRequest(t, ts, "GET", "/api/topology/containers/export?format=html&timestamp=2017-01-02T03:04:05Z", nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	page := string(body)
+	for _, want := range []string{
+		"<h1>Containers <small>at 2017-01-02 03:04:05 UTC</small></h1>",
+		"<svg ",
+		`<a href="#node-`,
+		"<h2>server",
+		"<tr><th>Image</th><td>" + fixture.ServerContainerImageName + "</td></tr>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected %q in:\n%s", want, page)
+		}
+	}
+}
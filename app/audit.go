@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// Results of audited controls
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+
+	auditedControlPrefix = "kubernetes_"
+	auditWebhookTimeout  = 5 * time.Second
+)
+
+// AuditRecord describes a control executed against the Kubernetes API
+// through the app: who ran it, on what, when, and how it went.
+type AuditRecord struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	User       string            `json:"user,omitempty"`
+	Actor      string            `json:"actor,omitempty"` // who authenticated, in the standalone app
+	Role       string            `json:"role,omitempty"`
+	RemoteAddr string            `json:"remoteAddr,omitempty"`
+	ProbeID    string            `json:"probeID"`
+	NodeID     string            `json:"nodeID"`
+	Control    string            `json:"control"`
+	Args       map[string]string `json:"args,omitempty"`
+	Result     string            `json:"result"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// AuditLog keeps the audit records.
+type AuditLog interface {
+	Add(ctx context.Context, record AuditRecord)
+	// Records returns the records of the user making the request, most
+	// recent first.
+	Records(ctx context.Context) []AuditRecord
+}
+
+// NewAuditLog makes a new AuditLog, which keeps the last capacity records
+// in memory and, if webhookURL isn't empty, POSTs each of them there as
+// JSON. userIDer identifies the user of a request; records are only
+// visible to the user which made them.
+func NewAuditLog(userIDer func(context.Context) (string, error), capacity int, webhookURL string) AuditLog {
+	return &auditLog{
+		userIDer:   userIDer,
+		capacity:   capacity,
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: auditWebhookTimeout},
+	}
+}
+
+type auditLog struct {
+	userIDer   func(context.Context) (string, error)
+	capacity   int
+	webhookURL string
+	client     *http.Client
+
+	sync.Mutex
+	records []AuditRecord
+}
+
+func (a *auditLog) userID(ctx context.Context) string {
+	userID, err := a.userIDer(ctx)
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
+func (a *auditLog) Add(ctx context.Context, record AuditRecord) {
+	record.User = a.userID(ctx)
+	if request, ok := ctx.Value(RequestCtxKey).(*http.Request); ok && request != nil {
+		record.RemoteAddr = request.RemoteAddr
+		if identity, ok := requestIdentity(request); ok {
+			record.Actor, record.Role = identity.User, identity.Role
+		}
+	}
+	who := record.User
+	if record.Actor != "" {
+		who = record.Actor
+	}
+	log.Infof("Audit: %s ran %s on %s/%s: %s %s", who, record.Control, record.ProbeID, record.NodeID, record.Result, record.Error)
+
+	a.Lock()
+	a.records = append(a.records, record)
+	if len(a.records) > a.capacity {
+		a.records = a.records[len(a.records)-a.capacity:]
+	}
+	a.Unlock()
+
+	if a.webhookURL != "" {
+		go a.forward(record)
+	}
+}
+
+func (a *auditLog) forward(record AuditRecord) {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("Audit: cannot encode record: %v", err)
+		return
+	}
+	resp, err := a.client.Post(a.webhookURL, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		log.Errorf("Audit: cannot forward record to webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Errorf("Audit: webhook responded with %s", resp.Status)
+	}
+}
+
+func (a *auditLog) Records(ctx context.Context) []AuditRecord {
+	userID := a.userID(ctx)
+	a.Lock()
+	defer a.Unlock()
+	result := []AuditRecord{}
+	for i := len(a.records) - 1; i >= 0; i-- {
+		if a.records[i].User == userID {
+			result = append(result, a.records[i])
+		}
+	}
+	return result
+}
+
+// NewAuditingControlRouter wraps a ControlRouter, recording the Kubernetes
+// controls it handles in audit.
+func NewAuditingControlRouter(cr ControlRouter, audit AuditLog) ControlRouter {
+	return &auditingControlRouter{ControlRouter: cr, audit: audit}
+}
+
+type auditingControlRouter struct {
+	ControlRouter
+	audit AuditLog
+}
+
+func (a *auditingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	record := AuditRecord{
+		Timestamp: mtime.Now(),
+		ProbeID:   probeID,
+		NodeID:    req.NodeID,
+		Control:   req.Control,
+		Args:      req.ControlArgs,
+		Result:    AuditSuccess,
+	}
+	res, err := a.ControlRouter.Handle(ctx, probeID, req)
+	if !strings.HasPrefix(req.Control, auditedControlPrefix) {
+		return res, err
+	}
+	if err != nil {
+		record.Result, record.Error = AuditFailure, err.Error()
+	} else if res.Error != "" {
+		record.Result, record.Error = AuditFailure, res.Error
+	}
+	a.audit.Add(ctx, record)
+	return res, err
+}
+
+// RegisterAuditRoutes registers the audit route with a http mux.
+func RegisterAuditRoutes(router *mux.Router, audit AuditLog) {
+	router.
+		Methods("GET").
+		Path("/api/audit").
+		HandlerFunc(requestContextDecorator(handleAudit(audit)))
+}
+
+func handleAudit(audit AuditLog) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, audit.Records(ctx))
+	}
+}
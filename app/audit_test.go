@@ -0,0 +1,107 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func noUser(context.Context) (string, error) { return "", nil }
+
+func TestAuditingControlRouter(t *testing.T) {
+	webhook := make(chan app.AuditRecord, 1)
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record app.AuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Error(err)
+		}
+		webhook <- record
+	}))
+	defer webhookServer.Close()
+
+	audit := app.NewAuditLog(noUser, 10, webhookServer.URL)
+	cr := app.NewAuditingControlRouter(app.NewLocalControlRouter(), audit)
+	ctx := context.Background()
+	cr.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		if req.Control == "kubernetes_scale_up" {
+			return xfer.ResponseErrorf("no such deployment")
+		}
+		return xfer.Response{}
+	})
+	cr.Handle(ctx, "probe1", xfer.Request{NodeID: "pod1", Control: "kubernetes_delete_pod"})
+	cr.Handle(ctx, "probe1", xfer.Request{NodeID: "deployment1", Control: "kubernetes_scale_up"})
+	cr.Handle(ctx, "probe1", xfer.Request{NodeID: "container1", Control: "docker_stop_container"})
+
+	router := mux.NewRouter()
+	app.RegisterAuditRoutes(router, audit)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/api/audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var records []app.AuditRecord
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+
+	// Most recent first, and only Kubernetes controls
+	want := []struct{ nodeID, control, result, err string }{
+		{"deployment1", "kubernetes_scale_up", app.AuditFailure, "no such deployment"},
+		{"pod1", "kubernetes_delete_pod", app.AuditSuccess, ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %v", len(want), records)
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.ProbeID != "probe1" || r.NodeID != w.nodeID || r.Control != w.control || r.Result != w.result || r.Error != w.err {
+			t.Errorf("Expected record %d to be %v, got %v", i, w, r)
+		}
+	}
+
+	for i := 0; i < len(want); i++ {
+		select {
+		case r := <-webhook:
+			if r.ProbeID != "probe1" {
+				t.Errorf("Unexpected webhook record %v", r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for webhook")
+		}
+	}
+}
+
+func TestAuditLogPerUser(t *testing.T) {
+	type userKey struct{}
+	userIDer := func(ctx context.Context) (string, error) {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user, nil
+	}
+	audit := app.NewAuditLog(userIDer, 1, "")
+	alice := context.WithValue(context.Background(), userKey{}, "alice")
+	bob := context.WithValue(context.Background(), userKey{}, "bob")
+
+	audit.Add(alice, app.AuditRecord{Control: "kubernetes_delete_pod"})
+	if have := audit.Records(bob); len(have) != 0 {
+		t.Errorf("Expected bob not to see alice's records, got %v", have)
+	}
+	if have := audit.Records(alice); len(have) != 1 || have[0].User != "alice" {
+		t.Errorf("Expected alice to see her record, got %v", have)
+	}
+
+	// Only the last capacity records are kept
+	audit.Add(bob, app.AuditRecord{Control: "kubernetes_scale_up"})
+	if have := audit.Records(alice); len(have) != 0 {
+		t.Errorf("Expected alice's record to have been dropped, got %v", have)
+	}
+}
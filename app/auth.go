@@ -0,0 +1,598 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// Roles of users, each allowed what the ones before it are.
+const (
+	// RoleViewer can look at everything but recordings and the audit log,
+	// and join the terminals shared with them.
+	RoleViewer = "viewer"
+	// RoleOperator can also run controls, such as exec'ing into containers
+	// or deleting pods, and change views, annotations and alerting rules.
+	RoleOperator = "operator"
+	// RoleAdmin can also manage users, and see recordings and the audit
+	// log.
+	RoleAdmin = "admin"
+
+	probeAuthorizationPrefix = "Scope-Probe token="
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// Errors from authenticating and managing users.
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrLastAdmin       = errors.New("there must be an admin left")
+)
+
+// User is someone allowed to use the app, in a role. Password is only ever
+// given to the app, which keeps a hash of it.
+type User struct {
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"passwordHash,omitempty"`
+}
+
+// Identity is who made a request, and their role.
+type Identity struct {
+	User string `json:"user"`
+	Role string `json:"role"`
+	// LogoutURL is where users go to log out, if they can.
+	LogoutURL string `json:"logoutURL,omitempty"`
+}
+
+type identityCtxKey struct{}
+
+// requestIdentity returns who made the request, if they had to say.
+func requestIdentity(r *http.Request) (Identity, bool) {
+	identity, ok := r.Context().Value(identityCtxKey{}).(Identity)
+	return identity, ok
+}
+
+// UserStore keeps the users allowed to use the app, and their roles, in a
+// JSON file. Passwords found in the file in clear are hashed on loading.
+type UserStore struct {
+	path string
+
+	sync.Mutex
+	users    map[string]User
+	verified map[string][sha256.Size]byte // passwords known to be right, by user
+}
+
+// NewUserStore loads the users in the file at path, if there is one.
+func NewUserStore(path string) (*UserStore, error) {
+	s := &UserStore{path: path, users: map[string]User{}, verified: map[string][sha256.Size]byte{}}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(buf, &users); err != nil {
+		return nil, err
+	}
+	rehashed := false
+	for _, user := range users {
+		if err := validateUser(user); err != nil {
+			return nil, fmt.Errorf("user %q: %v", user.Name, err)
+		}
+		if user.Password != "" {
+			if user.PasswordHash, err = hashPassword(user.Password); err != nil {
+				return nil, err
+			}
+			user.Password = ""
+			rehashed = true
+		}
+		s.users[user.Name] = user
+	}
+	if rehashed {
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func validateUser(user User) error {
+	if user.Name == "" {
+		return fmt.Errorf("users need a name")
+	}
+	if _, ok := roleRanks[user.Role]; !ok {
+		return fmt.Errorf("unknown role %q: expected %s, %s or %s", user.Role, RoleViewer, RoleOperator, RoleAdmin)
+	}
+	return nil
+}
+
+// save writes the users to the file. s.Mutex must be held.
+func (s *UserStore) save() error {
+	buf, err := json.MarshalIndent(s.sortedUsers(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *UserStore) sortedUsers() []User {
+	users := []User{}
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// Users returns the users, by name, without their password hashes.
+func (s *UserStore) Users() []User {
+	s.Lock()
+	defer s.Unlock()
+	users := s.sortedUsers()
+	for i := range users {
+		users[i].PasswordHash = ""
+	}
+	return users
+}
+
+// User returns the user with the name, without their password hash.
+func (s *UserStore) User(name string) (User, error) {
+	s.Lock()
+	defer s.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	user.PasswordHash = ""
+	return user, nil
+}
+
+// Role returns the role of the user with the name.
+func (s *UserStore) Role(name string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	user, ok := s.users[name]
+	return user.Role, ok
+}
+
+// PutUser adds the user, or updates the one with their name, keeping their
+// password unless given a new one.
+func (s *UserStore) PutUser(user User) error {
+	if err := validateUser(user); err != nil {
+		return err
+	}
+	user.PasswordHash = ""
+	if user.Password != "" {
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password, user.PasswordHash = "", hash
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	old, ok := s.users[user.Name]
+	if ok && user.PasswordHash == "" {
+		user.PasswordHash = old.PasswordHash
+	}
+	if ok && old.Role == RoleAdmin && user.Role != RoleAdmin && s.admins() == 1 {
+		return ErrLastAdmin
+	}
+	s.users[user.Name] = user
+	delete(s.verified, user.Name)
+	if err := s.save(); err != nil {
+		if ok {
+			s.users[user.Name] = old
+		} else {
+			delete(s.users, user.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteUser deletes the user with the name.
+func (s *UserStore) DeleteUser(name string) error {
+	s.Lock()
+	defer s.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.Role == RoleAdmin && s.admins() == 1 {
+		return ErrLastAdmin
+	}
+	delete(s.users, name)
+	delete(s.verified, name)
+	if err := s.save(); err != nil {
+		s.users[name] = user
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) admins() int {
+	admins := 0
+	for _, user := range s.users {
+		if user.Role == RoleAdmin {
+			admins++
+		}
+	}
+	return admins
+}
+
+// CheckPassword tells whether the password is that of the user with the
+// name. As hashes are slow to check on purpose, and the UI makes requests
+// every second or so, passwords found right are remembered until the user
+// changes.
+func (s *UserStore) CheckPassword(name, password string) bool {
+	sum := sha256.Sum256([]byte(password))
+	s.Lock()
+	user, ok := s.users[name]
+	verified, known := s.verified[name]
+	s.Unlock()
+	if !ok || user.PasswordHash == "" {
+		return false
+	}
+	if known {
+		return subtle.ConstantTimeCompare(sum[:], verified[:]) == 1
+	}
+	if !checkPassword(user.PasswordHash, password) {
+		return false
+	}
+	s.Lock()
+	if s.users[name].PasswordHash == user.PasswordHash {
+		s.verified[name] = sum
+	}
+	s.Unlock()
+	return true
+}
+
+// Passwords are hashed with scrypt, as scrypt$<salt>$<key> in base64.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return "scrypt$" + base64.StdEncoding.EncodeToString(salt) + "$" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 || parts[0] != "scrypt" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
+// Authenticator identifies the users making requests.
+type Authenticator interface {
+	// Authenticate returns the name of the user making the request, or
+	// ErrUnauthenticated.
+	Authenticate(r *http.Request) (string, error)
+	// Challenge responds to requests of unauthenticated users, asking them
+	// to authenticate.
+	Challenge(w http.ResponseWriter, r *http.Request)
+	// RegisterRoutes registers the routes users go through to
+	// authenticate, which are open to anyone.
+	RegisterRoutes(router *mux.Router)
+	// LogoutURL returns where users go to log out, if they can.
+	LogoutURL() string
+}
+
+// NewStaticAuthenticator makes an Authenticator of the users in the store,
+// by HTTP basic authentication with their passwords.
+func NewStaticAuthenticator(users *UserStore) Authenticator {
+	return staticAuthenticator{users: users}
+}
+
+type staticAuthenticator struct {
+	users *UserStore
+}
+
+func (a staticAuthenticator) Authenticate(r *http.Request) (string, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok || !a.users.CheckPassword(name, password) {
+		return "", ErrUnauthenticated
+	}
+	return name, nil
+}
+
+func (a staticAuthenticator) Challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Weave Scope"`)
+	respondWith(w, http.StatusUnauthorized, ErrUnauthenticated)
+}
+
+func (a staticAuthenticator) RegisterRoutes(*mux.Router) {}
+
+// LogoutURL is empty, as browsers remember basic authentication.
+func (a staticAuthenticator) LogoutURL() string { return "" }
+
+// Authorizer lets users do what their roles allow them to, once
+// authenticated.
+type Authorizer struct {
+	authn       Authenticator
+	users       *UserStore
+	defaultRole string
+	probeToken  string
+	probeTokens *ProbeTokenStore
+	open        *mux.Router
+}
+
+// NewAuthorizer makes an Authorizer of the users authenticated by authn.
+// Their roles are those in users, or else defaultRole, if not empty.
+// Probes need to authenticate with probeToken, unless it is empty, or with
+// a token minted in probeTokens, if not nil, which mustn't be revoked.
+// Without either, probes can publish reports and take control requests,
+// but nothing else without authenticating as users, so they must be
+// authenticated otherwise, as by RequireProbeCertificates.
+func NewAuthorizer(authn Authenticator, users *UserStore, defaultRole, probeToken string, probeTokens *ProbeTokenStore) (*Authorizer, error) {
+	if _, ok := roleRanks[defaultRole]; !ok && defaultRole != "" {
+		return nil, fmt.Errorf("unknown role %q", defaultRole)
+	}
+	a := &Authorizer{
+		authn:       authn,
+		users:       users,
+		defaultRole: defaultRole,
+		probeToken:  probeToken,
+		probeTokens: probeTokens,
+		open:        mux.NewRouter(),
+	}
+	authn.RegisterRoutes(a.open)
+	return a, nil
+}
+
+// isProbe tells whether the request is from a probe, with the right token.
+// Without a token to check, no request is known to be from a probe.
+func (a *Authorizer) isProbe(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, probeAuthorizationPrefix) {
+		return false
+	}
+	value := strings.TrimPrefix(auth, probeAuthorizationPrefix)
+	if a.probeTokens != nil && isMintedProbeToken(value) {
+		_, err := a.probeTokens.Check(value)
+		return err == nil
+	}
+	return a.probeToken != "" && subtle.ConstantTimeCompare([]byte(value), []byte(a.probeToken)) == 1
+}
+
+// allowsProbe tells whether the request may publish reports and take
+// control requests: probes need the right token, if they are given any,
+// or else their client certificates were checked before.
+func (a *Authorizer) allowsProbe(r *http.Request) bool {
+	if a == nil || (a.probeToken == "" && a.probeTokens == nil) {
+		return true
+	}
+	return a.isProbe(r)
+}
+
+// isProbeRoute tells whether only probes use the route of the request.
+func isProbeRoute(r *http.Request) bool {
+	path := r.URL.Path
+	return (r.Method == "POST" && path == "/api/report") ||
+		(strings.HasPrefix(path, "/api/control/") && strings.HasSuffix(path, "/ws")) ||
+		(strings.HasPrefix(path, "/api/pipe/") && strings.HasSuffix(path, "/probe"))
+}
+
+// RequireProbeCertificates makes a handler refusing requests on probe
+// routes from clients which didn't present a certificate, so only probes
+// with certificates the server's TLS config verified can publish reports
+// and take control requests.
+func RequireProbeCertificates(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isProbeRoute(r) && !xfer.HasPeerCertificate(r.TLS) {
+			respondWith(w, http.StatusUnauthorized, fmt.Errorf("probes need a client certificate"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredRole returns the role the request needs: viewers only look,
+// operators run controls and change things, and admins manage users and
+// see what others did.
+func requiredRole(r *http.Request) string {
+	path := r.URL.Path
+	for _, prefix := range []string{"/api/users", "/api/audit", "/api/recordings", "/api/probe-tokens", "/debug/"} {
+		if strings.HasPrefix(path, prefix) {
+			return RoleAdmin
+		}
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return RoleViewer
+	}
+	// Closing a terminal joined with a token only leaves it, and the IDs of
+	// pipes are only given to operators
+	if r.Method == "DELETE" && strings.HasPrefix(path, "/api/pipe/") && strings.Count(path, "/") == 3 {
+		return RoleViewer
+	}
+	return RoleOperator
+}
+
+// Wrap makes a handler checking requests are allowed, before passing them
+// to next with the Identity of who made them.
+func (a *Authorizer) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		if a.open.Match(r, &match) {
+			a.open.ServeHTTP(w, r)
+			return
+		}
+
+		// Probes have their own token, or are trusted as before
+		if isProbeRoute(r) {
+			if !a.allowsProbe(r) {
+				respondWith(w, http.StatusUnauthorized, fmt.Errorf("probes need the right token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.isProbe(r) && (r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/pipe/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name, err := a.authn.Authenticate(r)
+		if err != nil {
+			a.authn.Challenge(w, r)
+			return
+		}
+		role, ok := a.users.Role(name)
+		if !ok {
+			role = a.defaultRole
+		}
+		if role == "" {
+			respondWith(w, http.StatusForbidden, fmt.Errorf("%s isn't allowed to use Scope", name))
+			return
+		}
+		if need := requiredRole(r); roleRanks[role] < roleRanks[need] {
+			log.Infof("Denied %s (%s) %s %s", name, role, r.Method, r.URL.Path)
+			respondWith(w, http.StatusForbidden, fmt.Errorf("%s needs to be %s, not %s", name, need, role))
+			return
+		}
+		ctx := context.WithValue(r.Context(), identityCtxKey{}, Identity{User: name, Role: role, LogoutURL: a.authn.LogoutURL()})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RegisterUserRoutes registers the routes for managing users, and finding
+// out who one is, with a http mux.
+func RegisterUserRoutes(router *mux.Router, users *UserStore) {
+	router.Methods("GET").Path("/api/whoami").
+		HandlerFunc(requestContextDecorator(handleWhoami))
+	router.Methods("GET").Path("/api/users").
+		HandlerFunc(requestContextDecorator(handleListUsers(users)))
+	router.Methods("GET").Path("/api/users/{name}").
+		HandlerFunc(requestContextDecorator(handleGetUser(users)))
+	router.Methods("PUT").Path("/api/users/{name}").
+		HandlerFunc(requestContextDecorator(handlePutUser(users)))
+	router.Methods("DELETE").Path("/api/users/{name}").
+		HandlerFunc(requestContextDecorator(handleDeleteUser(users)))
+}
+
+func respondWithUserError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUserNotFound:
+		respondWith(w, http.StatusNotFound, err)
+	case ErrLastAdmin:
+		respondWith(w, http.StatusConflict, err)
+	default:
+		respondWith(w, http.StatusInternalServerError, err)
+	}
+}
+
+func handleWhoami(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	identity, ok := requestIdentity(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	respondWith(w, http.StatusOK, identity)
+}
+
+func handleListUsers(users *UserStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, users.Users())
+	}
+}
+
+func handleGetUser(users *UserStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		user, err := users.User(mux.Vars(r)["name"])
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, user)
+	}
+}
+
+func handlePutUser(users *UserStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var user User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		user.Name = mux.Vars(r)["name"]
+		if err := validateUser(user); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := users.PutUser(user); err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+		user, err := users.User(user.Name)
+		if err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, user)
+	}
+}
+
+func handleDeleteUser(users *UserStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := users.DeleteUser(mux.Vars(r)["name"]); err != nil {
+			respondWithUserError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
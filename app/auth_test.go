@@ -0,0 +1,163 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/scope/app"
+)
+
+func TestAuthorizer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.json")
+	ok(t, ioutil.WriteFile(path, []byte(`[
+		{"name": "alice", "role": "admin", "password": "wonderland"},
+		{"name": "bob", "role": "operator", "password": "builder"},
+		{"name": "carol", "role": "viewer", "password": "singer"}
+	]`), 0600))
+	users, err := app.NewUserStore(path)
+	ok(t, err)
+	// Passwords are hashed on loading
+	buf, err := ioutil.ReadFile(path)
+	ok(t, err)
+	equals(t, false, strings.Contains(string(buf), "wonderland"))
+
+	authorizer, err := app.NewAuthorizer(app.NewStaticAuthenticator(users), users, "", "s3cr3t", nil)
+	ok(t, err)
+	router := mux.NewRouter()
+	app.RegisterUserRoutes(router, users)
+	router.Methods("GET").Path("/api/topology").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Methods("POST").Path("/api/control/{probeID}/{nodeID}/{control}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Methods("POST").Path("/api/report").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewServer(authorizer.Wrap(router))
+	defer ts.Close()
+
+	do := func(method, path, user, password, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		ok(t, err)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	for _, tc := range []struct {
+		method, path, user, password string
+		status                       int
+	}{
+		{"GET", "/api/topology", "", "", http.StatusUnauthorized},
+		{"GET", "/api/topology", "carol", "wrong", http.StatusUnauthorized},
+		{"GET", "/api/topology", "mallory", "singer", http.StatusUnauthorized},
+		{"GET", "/api/topology", "carol", "singer", http.StatusOK},
+		{"POST", "/api/control/probe1/node1/docker_exec_container", "carol", "singer", http.StatusForbidden},
+		{"POST", "/api/control/probe1/node1/docker_exec_container", "bob", "builder", http.StatusOK},
+		{"GET", "/api/users", "bob", "builder", http.StatusForbidden},
+		{"GET", "/api/users", "alice", "wonderland", http.StatusOK},
+		{"POST", "/api/report", "", "", http.StatusUnauthorized},
+	} {
+		res := do(tc.method, tc.path, tc.user, tc.password, "")
+		if res.StatusCode != tc.status {
+			t.Errorf("%s %s as %s: expected %d, got %d", tc.method, tc.path, tc.user, tc.status, res.StatusCode)
+		}
+	}
+	equals(t, `Basic realm="Weave Scope"`, do("GET", "/api/topology", "", "", "").Header.Get("WWW-Authenticate"))
+
+	// Probes authenticate with their token
+	req, err := http.NewRequest("POST", ts.URL+"/api/report", nil)
+	ok(t, err)
+	req.Header.Set("Authorization", "Scope-Probe token=s3cr3t")
+	res, err := http.DefaultClient.Do(req)
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusOK, res.StatusCode)
+
+	// Who am I?
+	req, err = http.NewRequest("GET", ts.URL+"/api/whoami", nil)
+	ok(t, err)
+	req.SetBasicAuth("bob", "builder")
+	res, err = http.DefaultClient.Do(req)
+	ok(t, err)
+	var identity app.Identity
+	ok(t, json.NewDecoder(res.Body).Decode(&identity))
+	res.Body.Close()
+	equals(t, app.Identity{User: "bob", Role: app.RoleOperator}, identity)
+
+	// Admins manage users
+	equals(t, http.StatusBadRequest, do("PUT", "/api/users/dave", "alice", "wonderland", `{"role": "superuser"}`).StatusCode)
+	equals(t, http.StatusOK, do("PUT", "/api/users/dave", "alice", "wonderland", `{"role": "operator", "password": "diver"}`).StatusCode)
+	equals(t, http.StatusOK, do("POST", "/api/control/probe1/node1/docker_exec_container", "dave", "diver", "").StatusCode)
+	equals(t, http.StatusOK, do("PUT", "/api/users/dave", "alice", "wonderland", `{"role": "viewer"}`).StatusCode)
+	equals(t, http.StatusForbidden, do("POST", "/api/control/probe1/node1/docker_exec_container", "dave", "diver", "").StatusCode)
+	equals(t, http.StatusConflict, do("DELETE", "/api/users/alice", "alice", "wonderland", "").StatusCode)
+	equals(t, http.StatusConflict, do("PUT", "/api/users/alice", "alice", "wonderland", `{"role": "viewer"}`).StatusCode)
+	equals(t, http.StatusNoContent, do("DELETE", "/api/users/carol", "alice", "wonderland", "").StatusCode)
+	equals(t, http.StatusUnauthorized, do("GET", "/api/topology", "carol", "singer", "").StatusCode)
+
+	// Users are kept, without their passwords shown
+	reloaded, err := app.NewUserStore(path)
+	ok(t, err)
+	equals(t, []app.User{
+		{Name: "alice", Role: app.RoleAdmin},
+		{Name: "bob", Role: app.RoleOperator},
+		{Name: "dave", Role: app.RoleViewer},
+	}, reloaded.Users())
+	equals(t, true, reloaded.CheckPassword("dave", "diver"))
+}
+
+func TestAuthorizerWithoutProbeToken(t *testing.T) {
+	users, err := app.NewUserStore("/nonexistent/users.json")
+	ok(t, err)
+	authorizer, err := app.NewAuthorizer(app.NewStaticAuthenticator(users), users, "", "", nil)
+	ok(t, err)
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/api").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Methods("POST").Path("/api/report").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewServer(authorizer.Wrap(router))
+	defer ts.Close()
+
+	// Probes are trusted to publish reports as before, but claiming to be
+	// one isn't enough to get past authentication
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"POST", "/api/report", http.StatusOK},
+		{"GET", "/api", http.StatusUnauthorized},
+	} {
+		req, err := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		ok(t, err)
+		req.Header.Set("Authorization", "Scope-Probe token=")
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		res.Body.Close()
+		equals(t, tc.status, res.StatusCode)
+	}
+}
+
+func TestRequireProbeCertificates(t *testing.T) {
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/api/topology").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Methods("POST").Path("/api/report").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewServer(app.RequireProbeCertificates(router))
+	defer ts.Close()
+
+	// Users don't need certificates, but probes do
+	res, _ := checkRequest(t, ts, "GET", "/api/topology", nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	res, _ = checkRequest(t, ts, "POST", "/api/report", nil)
+	equals(t, http.StatusUnauthorized, res.StatusCode)
+}
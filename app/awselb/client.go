@@ -0,0 +1,327 @@
+package awselb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// LoadBalancer describes the parts of a load balancer we care about: the
+// addresses it connects to its instances from, its listeners, and the
+// hostnames it is addressed by.
+type LoadBalancer struct {
+	Name      string
+	DNSName   string
+	Hostnames []string // of the DNS records aliasing DNSName, sorted
+	Addresses []string
+	Listeners []Listener
+
+	// interfaces is the name the network interfaces of the load balancer
+	// are described with: that of classic ELBs, and app/name/id or
+	// net/name/id of application and network load balancers.
+	interfaces string
+}
+
+// Listener forwards the connections to a port of a load balancer to a port
+// of its instances, or targets, so many of which are healthy, if known.
+type Listener struct {
+	Protocol     string
+	Port         int64
+	InstancePort int64
+	Healthy      int
+	Targets      int
+}
+
+func (l Listener) String() string {
+	if l.Targets == 0 {
+		return fmt.Sprintf("%s:%d->%d", l.Protocol, l.Port, l.InstancePort)
+	}
+	return fmt.Sprintf("%s:%d->%d (%d/%d healthy)", l.Protocol, l.Port, l.InstancePort, l.Healthy, l.Targets)
+}
+
+// Hostname returns the name the load balancer is best known by: the first
+// of the DNS records aliasing it, or else its own DNS name.
+func (lb LoadBalancer) Hostname() string {
+	if len(lb.Hostnames) > 0 {
+		return lb.Hostnames[0]
+	}
+	return lb.DNSName
+}
+
+// Client lists the load balancers of a region. We create an interface so
+// we can mock for testing.
+type Client interface {
+	LoadBalancers() ([]LoadBalancer, error)
+}
+
+type awsClient struct {
+	elb     *elb.ELB
+	elbv2   *elbv2
+	ec2     *ec2.EC2
+	route53 *route53.Route53
+}
+
+// NewClient makes a new Client of the load balancers of the region, or of
+// the region of the instance if empty.
+func NewClient(region string) (Client, error) {
+	sess := session.New()
+	if region == "" {
+		var err error
+		if region, err = ec2metadata.New(sess).Region(); err != nil {
+			return nil, err
+		}
+	}
+	config := &aws.Config{Region: aws.String(region)}
+	return &awsClient{
+		elb:     elb.New(sess, config),
+		elbv2:   newELBV2(sess, config),
+		ec2:     ec2.New(sess, config),
+		route53: route53.New(sess, config),
+	}, nil
+}
+
+// LoadBalancers implements Client. Load balancers are classic ELBs, and
+// application and network load balancers, whose addresses are those of the
+// network interfaces ELB creates for them. Hostnames are optional, as
+// reading Route53 may not be allowed.
+func (c *awsClient) LoadBalancers() ([]LoadBalancer, error) {
+	classic, err := c.classicLoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+	v2, err := c.v2LoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+	result := append(classic, v2...)
+
+	addresses, err := c.addresses()
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := c.aliases()
+	if err != nil {
+		log.Warnf("AWS ELB: cannot read the DNS records of load balancers: %v", err)
+	}
+	for i := range result {
+		result[i].Addresses = addresses[result[i].interfaces]
+		result[i].Hostnames = aliases[result[i].DNSName]
+		sort.Strings(result[i].Hostnames)
+	}
+	return result, nil
+}
+
+// classicLoadBalancers lists the classic ELBs, their listeners counting
+// the instances in service of all the instances of the load balancer.
+func (c *awsClient) classicLoadBalancers() ([]LoadBalancer, error) {
+	var result []LoadBalancer
+	err := c.elb.DescribeLoadBalancersPages(&elb.DescribeLoadBalancersInput{}, func(page *elb.DescribeLoadBalancersOutput, _ bool) bool {
+		for _, description := range page.LoadBalancerDescriptions {
+			lb := LoadBalancer{
+				Name:       aws.StringValue(description.LoadBalancerName),
+				DNSName:    normalizeHostname(aws.StringValue(description.DNSName)),
+				interfaces: aws.StringValue(description.LoadBalancerName),
+			}
+			for _, ld := range description.ListenerDescriptions {
+				if ld.Listener == nil {
+					continue
+				}
+				lb.Listeners = append(lb.Listeners, Listener{
+					Protocol:     aws.StringValue(ld.Listener.Protocol),
+					Port:         aws.Int64Value(ld.Listener.LoadBalancerPort),
+					InstancePort: aws.Int64Value(ld.Listener.InstancePort),
+				})
+			}
+			result = append(result, lb)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, lb := range result {
+		output, err := c.elb.DescribeInstanceHealth(&elb.DescribeInstanceHealthInput{LoadBalancerName: aws.String(lb.Name)})
+		if err != nil {
+			return nil, err
+		}
+		healthy := 0
+		for _, state := range output.InstanceStates {
+			if aws.StringValue(state.State) == "InService" {
+				healthy++
+			}
+		}
+		for j := range lb.Listeners {
+			result[i].Listeners[j].Healthy = healthy
+			result[i].Listeners[j].Targets = len(output.InstanceStates)
+		}
+	}
+	return result, nil
+}
+
+// v2LoadBalancers lists the application and network load balancers. Their
+// listeners forward to the ports of the targets of the target groups of
+// their default actions, a listener for each port, counting the healthy
+// targets on it.
+func (c *awsClient) v2LoadBalancers() ([]LoadBalancer, error) {
+	descriptions, err := c.elbv2.describeLoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+	var result []LoadBalancer
+	for _, description := range descriptions {
+		arn := aws.StringValue(description.LoadBalancerArn)
+		i := strings.Index(arn, ":loadbalancer/")
+		if i < 0 {
+			continue
+		}
+		lb := LoadBalancer{
+			Name:       aws.StringValue(description.LoadBalancerName),
+			DNSName:    normalizeHostname(aws.StringValue(description.DNSName)),
+			interfaces: arn[i+len(":loadbalancer/"):],
+		}
+		groups, err := c.elbv2.describeTargetGroups(description.LoadBalancerArn)
+		if err != nil {
+			return nil, err
+		}
+		ports := map[string]int64{}
+		targets := map[string][]*elbv2TargetHealthDescription{}
+		for _, group := range groups {
+			groupArn := aws.StringValue(group.TargetGroupArn)
+			ports[groupArn] = aws.Int64Value(group.Port)
+			if targets[groupArn], err = c.elbv2.describeTargetHealth(group.TargetGroupArn); err != nil {
+				return nil, err
+			}
+		}
+		listeners, err := c.elbv2.describeListeners(description.LoadBalancerArn)
+		if err != nil {
+			return nil, err
+		}
+		for _, listener := range listeners {
+			for _, action := range listener.DefaultActions {
+				groupArn := aws.StringValue(action.TargetGroupArn)
+				if aws.StringValue(action.Type) != "forward" || groupArn == "" {
+					continue
+				}
+				lb.Listeners = append(lb.Listeners, v2Listeners(listener, ports[groupArn], targets[groupArn])...)
+			}
+		}
+		result = append(result, lb)
+	}
+	return result, nil
+}
+
+// v2Listeners returns the listener forwarding to the targets, a listener
+// for each port of the targets, or of the target group if there are none.
+func v2Listeners(listener *elbv2Listener, groupPort int64, targets []*elbv2TargetHealthDescription) []Listener {
+	var (
+		result []Listener
+		index  = map[int64]int{}
+	)
+	for _, target := range targets {
+		port := groupPort
+		if target.Target != nil && target.Target.Port != nil {
+			port = aws.Int64Value(target.Target.Port)
+		}
+		i, ok := index[port]
+		if !ok {
+			i = len(result)
+			index[port] = i
+			result = append(result, Listener{
+				Protocol:     aws.StringValue(listener.Protocol),
+				Port:         aws.Int64Value(listener.Port),
+				InstancePort: port,
+			})
+		}
+		result[i].Targets++
+		if target.TargetHealth != nil && aws.StringValue(target.TargetHealth.State) == "healthy" {
+			result[i].Healthy++
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, Listener{
+			Protocol:     aws.StringValue(listener.Protocol),
+			Port:         aws.Int64Value(listener.Port),
+			InstancePort: groupPort,
+		})
+	}
+	return result
+}
+
+// addresses returns the addresses of the network interfaces ELB creates
+// for load balancers, by the name of the load balancer, as their
+// descriptions have it.
+func (c *awsClient) addresses() (map[string][]string, error) {
+	output, err := c.ec2.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("requester-id"),
+			Values: []*string{aws.String("amazon-elb")},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]string{}
+	for _, ni := range output.NetworkInterfaces {
+		name := strings.TrimPrefix(aws.StringValue(ni.Description), "ELB ")
+		for _, ip := range ni.PrivateIpAddresses {
+			result[name] = append(result[name], aws.StringValue(ip.PrivateIpAddress))
+			if ip.Association != nil && ip.Association.PublicIp != nil {
+				result[name] = append(result[name], aws.StringValue(ip.Association.PublicIp))
+			}
+		}
+	}
+	return result, nil
+}
+
+// aliases returns the names of the alias and CNAME records of all hosted
+// zones, by the DNS name they point at.
+func (c *awsClient) aliases() (map[string][]string, error) {
+	var zones []string
+	err := c.route53.ListHostedZonesPages(&route53.ListHostedZonesInput{}, func(page *route53.ListHostedZonesOutput, _ bool) bool {
+		for _, zone := range page.HostedZones {
+			zones = append(zones, aws.StringValue(zone.Id))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]string{}
+	for _, zone := range zones {
+		err := c.route53.ListResourceRecordSetsPages(&route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(zone)}, func(page *route53.ListResourceRecordSetsOutput, _ bool) bool {
+			for _, record := range page.ResourceRecordSets {
+				name := normalizeHostname(aws.StringValue(record.Name))
+				if record.AliasTarget != nil {
+					target := normalizeHostname(aws.StringValue(record.AliasTarget.DNSName))
+					result[target] = append(result[target], name)
+				} else if aws.StringValue(record.Type) == route53.RRTypeCname {
+					for _, value := range record.ResourceRecords {
+						target := normalizeHostname(aws.StringValue(value.Value))
+						result[target] = append(result[target], name)
+					}
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// normalizeHostname lowercases the hostname and strips the final dot of
+// DNS records, and the dualstack. prefix aliases of ELBs have.
+func normalizeHostname(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	return strings.TrimPrefix(hostname, "dualstack.")
+}
@@ -0,0 +1,81 @@
+package awselb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	lbArn    = "arn:aws:elasticloadbalancing:eu-west-1:123456789012:loadbalancer/net/api/50dc6c495c0c9188"
+	groupArn = "arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/api/73e2d6bc24d8a067"
+)
+
+var elbv2Responses = map[string]string{
+	"DescribeLoadBalancers": `<LoadBalancers><member>
+		<LoadBalancerArn>` + lbArn + `</LoadBalancerArn>
+		<LoadBalancerName>api</LoadBalancerName>
+		<DNSName>API-456.elb.eu-west-1.amazonaws.com</DNSName>
+		<Type>network</Type>
+	</member></LoadBalancers>`,
+	"DescribeTargetGroups": `<TargetGroups><member>
+		<TargetGroupArn>` + groupArn + `</TargetGroupArn>
+		<Port>8443</Port>
+	</member></TargetGroups>`,
+	"DescribeTargetHealth": `<TargetHealthDescriptions>
+		<member><Target><Id>i-1</Id><Port>8443</Port></Target><TargetHealth><State>healthy</State></TargetHealth></member>
+		<member><Target><Id>i-2</Id><Port>8443</Port></Target><TargetHealth><State>unhealthy</State></TargetHealth></member>
+		<member><Target><Id>i-3</Id><Port>9443</Port></Target><TargetHealth><State>healthy</State></TargetHealth></member>
+	</TargetHealthDescriptions>`,
+	"DescribeListeners": `<Listeners><member>
+		<Port>443</Port>
+		<Protocol>TLS</Protocol>
+		<DefaultActions><member><Type>forward</Type><TargetGroupArn>` + groupArn + `</TargetGroupArn></member></DefaultActions>
+	</member></Listeners>`,
+}
+
+func TestV2LoadBalancers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		action := r.Form.Get("Action")
+		response, ok := elbv2Responses[action]
+		if !ok || r.Form.Get("Version") != "2015-12-01" {
+			http.Error(w, "unexpected "+action, http.StatusBadRequest)
+			return
+		}
+		if action != "DescribeLoadBalancers" && r.Form.Get("LoadBalancerArn") != lbArn && r.Form.Get("TargetGroupArn") != groupArn {
+			http.Error(w, "unexpected load balancer", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "<%sResponse><%sResult>%s</%sResult></%sResponse>", action, action, response, action, action)
+	}))
+	defer server.Close()
+
+	c := &awsClient{elbv2: newELBV2(session.New(), &aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})}
+	have, err := c.v2LoadBalancers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LoadBalancer{{
+		Name:    "api",
+		DNSName: "api-456.elb.eu-west-1.amazonaws.com",
+		Listeners: []Listener{
+			{Protocol: "TLS", Port: 443, InstancePort: 8443, Healthy: 1, Targets: 2},
+			{Protocol: "TLS", Port: 443, InstancePort: 9443, Healthy: 1, Targets: 1},
+		},
+		interfaces: "net/api/50dc6c495c0c9188",
+	}}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
@@ -0,0 +1,216 @@
+package awselb
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+// elbv2 is a client of the parts of the Elastic Load Balancing API of
+// application and network load balancers we need, as the version of the
+// SDK we vendor predates them.
+type elbv2 struct {
+	*client.Client
+}
+
+func newELBV2(p client.ConfigProvider, cfgs ...*aws.Config) *elbv2 {
+	c := p.ClientConfig("elasticloadbalancing", cfgs...)
+	svc := &elbv2{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   "elasticloadbalancing",
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    "2015-12-01",
+			},
+			c.Handlers,
+		),
+	}
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBack(query.Build)
+	svc.Handlers.Unmarshal.PushBack(query.Unmarshal)
+	svc.Handlers.UnmarshalMeta.PushBack(query.UnmarshalMeta)
+	svc.Handlers.UnmarshalError.PushBack(query.UnmarshalError)
+	return svc
+}
+
+func (c *elbv2) send(name string, input, output interface{}) error {
+	op := &request.Operation{Name: name, HTTPMethod: "POST", HTTPPath: "/"}
+	return c.NewRequest(op, input, output).Send()
+}
+
+type elbv2DescribeLoadBalancersInput struct {
+	_ struct{} `type:"structure"`
+
+	Marker *string `type:"string"`
+}
+
+type elbv2DescribeLoadBalancersOutput struct {
+	_ struct{} `type:"structure"`
+
+	LoadBalancers []*elbv2LoadBalancer `type:"list"`
+	NextMarker    *string              `type:"string"`
+}
+
+type elbv2LoadBalancer struct {
+	_ struct{} `type:"structure"`
+
+	DNSName          *string `type:"string"`
+	LoadBalancerArn  *string `type:"string"`
+	LoadBalancerName *string `type:"string"`
+	Type             *string `type:"string"`
+}
+
+// describeLoadBalancers lists all the application and network load
+// balancers.
+func (c *elbv2) describeLoadBalancers() ([]*elbv2LoadBalancer, error) {
+	var (
+		result []*elbv2LoadBalancer
+		input  = &elbv2DescribeLoadBalancersInput{}
+	)
+	for {
+		output := &elbv2DescribeLoadBalancersOutput{}
+		if err := c.send("DescribeLoadBalancers", input, output); err != nil {
+			return nil, err
+		}
+		result = append(result, output.LoadBalancers...)
+		if aws.StringValue(output.NextMarker) == "" {
+			return result, nil
+		}
+		input.Marker = output.NextMarker
+	}
+}
+
+type elbv2DescribeListenersInput struct {
+	_ struct{} `type:"structure"`
+
+	LoadBalancerArn *string `type:"string"`
+	Marker          *string `type:"string"`
+}
+
+type elbv2DescribeListenersOutput struct {
+	_ struct{} `type:"structure"`
+
+	Listeners  []*elbv2Listener `type:"list"`
+	NextMarker *string          `type:"string"`
+}
+
+type elbv2Listener struct {
+	_ struct{} `type:"structure"`
+
+	DefaultActions []*elbv2Action `type:"list"`
+	Port           *int64         `type:"integer"`
+	Protocol       *string        `type:"string"`
+}
+
+type elbv2Action struct {
+	_ struct{} `type:"structure"`
+
+	TargetGroupArn *string `type:"string"`
+	Type           *string `type:"string"`
+}
+
+// describeListeners lists the listeners of the load balancer.
+func (c *elbv2) describeListeners(arn *string) ([]*elbv2Listener, error) {
+	var (
+		result []*elbv2Listener
+		input  = &elbv2DescribeListenersInput{LoadBalancerArn: arn}
+	)
+	for {
+		output := &elbv2DescribeListenersOutput{}
+		if err := c.send("DescribeListeners", input, output); err != nil {
+			return nil, err
+		}
+		result = append(result, output.Listeners...)
+		if aws.StringValue(output.NextMarker) == "" {
+			return result, nil
+		}
+		input.Marker = output.NextMarker
+	}
+}
+
+type elbv2DescribeTargetGroupsInput struct {
+	_ struct{} `type:"structure"`
+
+	LoadBalancerArn *string `type:"string"`
+	Marker          *string `type:"string"`
+}
+
+type elbv2DescribeTargetGroupsOutput struct {
+	_ struct{} `type:"structure"`
+
+	NextMarker   *string             `type:"string"`
+	TargetGroups []*elbv2TargetGroup `type:"list"`
+}
+
+type elbv2TargetGroup struct {
+	_ struct{} `type:"structure"`
+
+	Port           *int64  `type:"integer"`
+	TargetGroupArn *string `type:"string"`
+}
+
+// describeTargetGroups lists the target groups of the load balancer.
+func (c *elbv2) describeTargetGroups(arn *string) ([]*elbv2TargetGroup, error) {
+	var (
+		result []*elbv2TargetGroup
+		input  = &elbv2DescribeTargetGroupsInput{LoadBalancerArn: arn}
+	)
+	for {
+		output := &elbv2DescribeTargetGroupsOutput{}
+		if err := c.send("DescribeTargetGroups", input, output); err != nil {
+			return nil, err
+		}
+		result = append(result, output.TargetGroups...)
+		if aws.StringValue(output.NextMarker) == "" {
+			return result, nil
+		}
+		input.Marker = output.NextMarker
+	}
+}
+
+type elbv2DescribeTargetHealthInput struct {
+	_ struct{} `type:"structure"`
+
+	TargetGroupArn *string `type:"string" required:"true"`
+}
+
+type elbv2DescribeTargetHealthOutput struct {
+	_ struct{} `type:"structure"`
+
+	TargetHealthDescriptions []*elbv2TargetHealthDescription `type:"list"`
+}
+
+type elbv2TargetHealthDescription struct {
+	_ struct{} `type:"structure"`
+
+	Target       *elbv2Target       `type:"structure"`
+	TargetHealth *elbv2TargetHealth `type:"structure"`
+}
+
+type elbv2Target struct {
+	_ struct{} `type:"structure"`
+
+	ID   *string `locationName:"Id" type:"string"`
+	Port *int64  `type:"integer"`
+}
+
+type elbv2TargetHealth struct {
+	_ struct{} `type:"structure"`
+
+	State *string `type:"string"`
+}
+
+// describeTargetHealth lists the targets of the target group, with their
+// health.
+func (c *elbv2) describeTargetHealth(arn *string) ([]*elbv2TargetHealthDescription, error) {
+	output := &elbv2DescribeTargetHealthOutput{}
+	if err := c.send("DescribeTargetHealth", &elbv2DescribeTargetHealthInput{TargetGroupArn: arn}, output); err != nil {
+		return nil, err
+	}
+	return output.TargetHealthDescriptions, nil
+}
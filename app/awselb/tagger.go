@@ -0,0 +1,136 @@
+package awselb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest.
+const (
+	LoadBalancerName     = report.LoadBalancerName
+	LoadBalancerListener = report.LoadBalancerListener
+	LoadBalancerHostname = report.LoadBalancerHostname
+)
+
+// Tagger tags the remote endpoints of load balancers with their names,
+// the listeners their connections came through, and the hostnames they
+// are addressed by, so they are rendered as the load balancers rather
+// than the Internet. Load balancers are listed in the background, once
+// for the reports of all the probes, by the app they publish to.
+type Tagger struct {
+	client Client
+	quit   chan struct{}
+
+	sync.RWMutex
+	byAddress map[string]LoadBalancer
+}
+
+// NewTagger makes a new Tagger, listing the load balancers of client
+// every interval. Don't forget to Stop it.
+func NewTagger(client Client, interval time.Duration) *Tagger {
+	t := &Tagger{
+		client: client,
+		quit:   make(chan struct{}),
+	}
+	t.refresh()
+	go t.loop(interval)
+	return t
+}
+
+// Stop stops listing the load balancers.
+func (t *Tagger) Stop() {
+	close(t.quit)
+}
+
+func (t *Tagger) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.refresh()
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+func (t *Tagger) refresh() {
+	lbs, err := t.client.LoadBalancers()
+	if err != nil {
+		log.Warnf("AWS ELB: cannot list load balancers: %v", err)
+		return
+	}
+	byAddress := map[string]LoadBalancer{}
+	for _, lb := range lbs {
+		for _, addr := range lb.Addresses {
+			byAddress[addr] = lb
+		}
+	}
+	t.Lock()
+	t.byAddress = byAddress
+	t.Unlock()
+}
+
+// Tag tags the endpoints of the load balancers in the report, telling
+// whether there were any.
+func (t *Tagger) Tag(r report.Report) (report.Report, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	tagged := false
+	if len(t.byAddress) == 0 {
+		return r, tagged
+	}
+	for id, node := range r.Endpoint.Nodes {
+		// Load balancers are not on any host of ours
+		if _, ok := node.Latest.Lookup(report.HostNodeID); ok {
+			continue
+		}
+		_, addr, _, ok := report.ParseEndpointNodeID(id)
+		if !ok {
+			continue
+		}
+		lb, ok := t.byAddress[addr]
+		if !ok {
+			continue
+		}
+		latests := map[string]string{
+			LoadBalancerName:     lb.Name,
+			LoadBalancerHostname: lb.Hostname(),
+		}
+		if listeners := listenersOf(lb, node); listeners != "" {
+			latests[LoadBalancerListener] = listeners
+		}
+		r.Endpoint.Nodes[id] = node.WithLatests(latests)
+		tagged = true
+	}
+	return r, tagged
+}
+
+// listenersOf returns the listeners of lb forwarding to the ports the
+// endpoint connects to.
+func listenersOf(lb LoadBalancer, node report.Node) string {
+	var result []string
+	for _, adjacent := range node.Adjacency {
+		_, _, port, ok := report.ParseEndpointNodeID(adjacent)
+		if !ok {
+			continue
+		}
+		instancePort, err := strconv.ParseInt(port, 10, 64)
+		if err != nil {
+			continue
+		}
+		for _, l := range lb.Listeners {
+			if l.InstancePort == instancePort {
+				result = append(result, l.String())
+			}
+		}
+	}
+	return strings.Join(report.MakeStringSet(result...), ", ")
+}
@@ -0,0 +1,89 @@
+package awselb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/app/awselb"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockClient []awselb.LoadBalancer
+
+func (c mockClient) LoadBalancers() ([]awselb.LoadBalancer, error) {
+	return c, nil
+}
+
+func TestTagger(t *testing.T) {
+	client := mockClient{{
+		Name:      "shop",
+		DNSName:   "shop-123.eu-west-1.elb.amazonaws.com",
+		Hostnames: []string{"shop.example.com"},
+		Addresses: []string{"10.0.1.5"},
+		Listeners: []awselb.Listener{
+			{Protocol: "HTTPS", Port: 443, InstancePort: 8080},
+			{Protocol: "HTTP", Port: 80, InstancePort: 8080},
+			{Protocol: "TCP", Port: 22, InstancePort: 2222},
+		},
+	}, {
+		Name:      "api",
+		DNSName:   "api-456.elb.eu-west-1.amazonaws.com",
+		Addresses: []string{"10.0.1.6"},
+		Listeners: []awselb.Listener{
+			{Protocol: "TCP", Port: 443, InstancePort: 8443, Healthy: 1, Targets: 2},
+		},
+	}}
+	tagger := awselb.NewTagger(client, time.Hour)
+	defer tagger.Stop()
+
+	var (
+		now    = mtime.Now()
+		local  = report.MakeEndpointNodeID("host1", "", "10.0.2.7", "8080")
+		lb     = report.MakeEndpointNodeID("", "", "10.0.1.5", "41234")
+		nlb    = report.MakeEndpointNodeID("", "", "10.0.1.6", "41236")
+		api    = report.MakeEndpointNodeID("host1", "", "10.0.2.7", "8443")
+		remote = report.MakeEndpointNodeID("", "", "8.8.8.8", "41235")
+		rpt    = report.MakeReport()
+	)
+	rpt.Endpoint.AddNode(report.MakeNode(local).WithLatest(report.HostNodeID, now, report.MakeHostNodeID("host1")))
+	rpt.Endpoint.AddNode(report.MakeNode(lb).WithAdjacent(local))
+	rpt.Endpoint.AddNode(report.MakeNode(nlb).WithAdjacent(api))
+	rpt.Endpoint.AddNode(report.MakeNode(remote).WithAdjacent(local))
+
+	rpt, tagged := tagger.Tag(rpt)
+	if !tagged {
+		t.Fatal("Expected the report to be tagged")
+	}
+
+	node := rpt.Endpoint.Nodes[lb]
+	for key, want := range map[string]string{
+		awselb.LoadBalancerName:     "shop",
+		awselb.LoadBalancerListener: "HTTP:80->8080, HTTPS:443->8080",
+		awselb.LoadBalancerHostname: "shop.example.com",
+	} {
+		if have, _ := node.Latest.Lookup(key); have != want {
+			t.Errorf("Expected %s of %q, got %q", key, want, have)
+		}
+	}
+	if have, _ := rpt.Endpoint.Nodes[nlb].Latest.Lookup(awselb.LoadBalancerListener); have != "TCP:443->8443 (1/2 healthy)" {
+		t.Errorf("Expected the health of the targets of the listener, got %q", have)
+	}
+	for _, id := range []string{local, remote} {
+		if _, ok := rpt.Endpoint.Nodes[id].Latest.Lookup(awselb.LoadBalancerName); ok {
+			t.Errorf("Expected %s not to be a load balancer", id)
+		}
+	}
+}
+
+func TestHostname(t *testing.T) {
+	lb := awselb.LoadBalancer{DNSName: "shop-123.eu-west-1.elb.amazonaws.com"}
+	if have := lb.Hostname(); have != lb.DNSName {
+		t.Errorf("Expected the DNS name of the load balancer, got %q", have)
+	}
+	lb.Hostnames = []string{"a.example.com", "b.example.com"}
+	if have := lb.Hostname(); have != "a.example.com" {
+		t.Errorf("Expected the first alias of the load balancer, got %q", have)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"golang.org/x/net/context"
+
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/detailed"
 	"github.com/weaveworks/scope/report"
@@ -92,7 +94,7 @@ func benchmarkRender(b *testing.B, f func(report.Report)) {
 }
 
 func renderForTopology(b *testing.B, topologyID string, report report.Report) report.Nodes {
-	renderer, filter, err := topologyRegistry.RendererForTopology(topologyID, url.Values{}, report)
+	renderer, filter, err := topologyRegistry.RendererForTopology(context.Background(), topologyID, url.Values{}, report)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -107,7 +109,7 @@ func benchmarkRenderTopology(b *testing.B, topologyID string) {
 
 func BenchmarkRenderList(b *testing.B) {
 	benchmarkRender(b, func(report report.Report) {
-		topologyRegistry.renderTopologies(report, &http.Request{Form: url.Values{}})
+		topologyRegistry.renderTopologies(context.Background(), report, &http.Request{Form: url.Values{}})
 	})
 }
 
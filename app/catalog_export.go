@@ -0,0 +1,372 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Formats the service dependency graph is exported in.
+const (
+	CatalogFormatBackstage = "backstage"
+	CatalogFormatJSON      = "json"
+)
+
+const (
+	catalogExportTimeout = 30 * time.Second
+	// catalogAnnotation is the annotation of Backstage entities with the
+	// ID of the node they were made of.
+	catalogAnnotation = "scope.weave.works/node-id"
+)
+
+// The API topologies whose nodes are services.
+var catalogServiceTopologies = []string{servicesID, ecsServicesID, swarmServicesID}
+
+// ServiceDependencies is the graph of the services seen in a report, and
+// the services they connect to, in the generic JSON format.
+type ServiceDependencies struct {
+	Generated time.Time           `json:"generated"`
+	Services  []ServiceDependency `json:"services"`
+}
+
+// ServiceDependency is a service, and the services it was seen connecting
+// to, by ID. External services, as AWS S3, are services of their own with
+// External set, and depend on nothing.
+type ServiceDependency struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace,omitempty"`
+	TopologyID string   `json:"topologyId,omitempty"`
+	External   bool     `json:"external,omitempty"`
+	DependsOn  []string `json:"dependsOn"`
+}
+
+// MakeServiceDependencies makes the service dependency graph of the report.
+func MakeServiceDependencies(ctx context.Context, rpt report.Report, now time.Time) ServiceDependencies {
+	services := map[string]*ServiceDependency{}
+	for _, topologyID := range catalogServiceTopologies {
+		if _, ok := topologyRegistry.getForReport(topologyID, rpt); !ok {
+			continue
+		}
+		renderer, filter, err := topologyRegistry.RendererForTopology(ctx, topologyID, nil, rpt)
+		if err != nil {
+			continue
+		}
+		nodes := render.Render(rpt, renderer, filter).Nodes
+		for id, n := range nodes {
+			if n.Topology == render.Pseudo {
+				continue
+			}
+			summary, ok := detailed.MakeBasicNodeSummary(rpt, n)
+			if !ok {
+				continue
+			}
+			namespace, _ := render.NamespaceOf(n)
+			service := &ServiceDependency{ID: id, Name: summary.Label, Namespace: namespace, TopologyID: topologyID, DependsOn: []string{}}
+			for _, adjacent := range n.Adjacency {
+				to, ok := nodes[adjacent]
+				if !ok || adjacent == id {
+					continue
+				}
+				if to.Topology != render.Pseudo {
+					service.DependsOn = append(service.DependsOn, adjacent)
+				} else if strings.HasPrefix(adjacent, render.ServiceNodeIDPrefix) {
+					service.DependsOn = append(service.DependsOn, adjacent)
+					services[adjacent] = &ServiceDependency{
+						ID:        adjacent,
+						Name:      adjacent[len(render.ServiceNodeIDPrefix):],
+						External:  true,
+						DependsOn: []string{},
+					}
+				}
+			}
+			services[id] = service
+		}
+	}
+
+	result := ServiceDependencies{Generated: now, Services: []ServiceDependency{}}
+	for _, service := range services {
+		sort.Strings(service.DependsOn)
+		result.Services = append(result.Services, *service)
+	}
+	sort.Slice(result.Services, func(i, j int) bool { return result.Services[i].ID < result.Services[j].ID })
+	return result
+}
+
+// backstageEntity is an entity of a Backstage catalog-info file.
+type backstageEntity struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   backstageMetadata `yaml:"metadata"`
+	Spec       backstageSpec     `yaml:"spec"`
+}
+
+type backstageMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Title       string            `yaml:"title,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type backstageSpec struct {
+	Type      string   `yaml:"type"`
+	Lifecycle string   `yaml:"lifecycle,omitempty"`
+	Owner     string   `yaml:"owner"`
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+}
+
+var (
+	backstageInvalidName      = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+	backstageInvalidNamespace = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// backstageName makes a valid entity name of s: of at most 63 letters,
+// digits and [-_.], beginning and ending with a letter or digit.
+func backstageName(s string) string {
+	s = backstageInvalidName.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-_.")
+}
+
+func backstageNamespace(s string) string {
+	s = strings.Trim(backstageInvalidNamespace.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if s == "" {
+		return "default"
+	}
+	return s
+}
+
+// backstageScope returns the start of the entity references of a service,
+// up to its name, as in component:shop/.
+func backstageScope(service ServiceDependency) string {
+	if service.External {
+		return "resource:default/"
+	}
+	return "component:" + backstageNamespace(service.Namespace) + "/"
+}
+
+// backstageCandidate returns the name a service would have, in the round
+// of naming: its own, then that suffixed with its topology, and then with
+// a hash of its ID too.
+func backstageCandidate(service ServiceDependency, round int) string {
+	name := backstageName(service.Name)
+	if round == 0 {
+		return name
+	}
+	suffix := service.TopologyID
+	if service.External {
+		suffix = "external"
+	}
+	if round > 1 {
+		hash := fnv.New32a()
+		hash.Write([]byte(service.ID))
+		suffix = fmt.Sprintf("%s-%08x", suffix, hash.Sum32())
+	}
+	if room := 62 - len(suffix); len(name) > room {
+		name = name[:room]
+	}
+	return backstageName(name + "-" + suffix)
+}
+
+// backstageNames names the entities of the services, by ID. Names are
+// unique among those of the same kind and namespace: services whose own
+// names aren't, or are empty once made valid, are named by a later round
+// of backstageCandidate.
+func backstageNames(services []ServiceDependency) map[string]string {
+	var (
+		names = make(map[string]string, len(services))
+		taken = map[string]struct{}{}
+		left  = services
+	)
+	for round := 0; len(left) > 0; round++ {
+		byRef := map[string][]ServiceDependency{}
+		for _, service := range left {
+			scope := backstageScope(service)
+			ref := scope + backstageCandidate(service, round)
+			byRef[ref] = append(byRef[ref], service)
+		}
+		left = nil
+		for ref, services := range byRef {
+			_, clash := taken[ref]
+			if round < 2 && (clash || len(services) > 1 || strings.HasSuffix(ref, "/")) {
+				left = append(left, services...)
+				continue
+			}
+			taken[ref] = struct{}{}
+			for _, service := range services {
+				names[service.ID] = ref[strings.Index(ref, "/")+1:]
+			}
+		}
+	}
+	return names
+}
+
+// ExportBackstage writes the graph as Backstage catalog-info entities: a
+// Component per service, and a Resource per external service.
+func ExportBackstage(deps ServiceDependencies) ([]byte, error) {
+	names := backstageNames(deps.Services)
+	refs := make(map[string]string, len(deps.Services))
+	for _, service := range deps.Services {
+		refs[service.ID] = backstageScope(service) + names[service.ID]
+	}
+	var buf bytes.Buffer
+	for _, service := range deps.Services {
+		entity := backstageEntity{
+			APIVersion: "backstage.io/v1alpha1",
+			Kind:       "Component",
+			Metadata: backstageMetadata{
+				Name:        names[service.ID],
+				Namespace:   backstageNamespace(service.Namespace),
+				Title:       service.Name,
+				Annotations: map[string]string{catalogAnnotation: service.ID},
+			},
+			Spec: backstageSpec{Type: "service", Lifecycle: "production", Owner: "unknown"},
+		}
+		if service.External {
+			entity.Kind = "Resource"
+			entity.Metadata.Namespace = "default"
+			entity.Spec = backstageSpec{Type: "external-service", Owner: "unknown"}
+		}
+		for _, id := range service.DependsOn {
+			entity.Spec.DependsOn = append(entity.Spec.DependsOn, refs[id])
+		}
+		out, err := yaml.Marshal(entity)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("---\n")
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportJSON writes the graph in the generic JSON format.
+func ExportJSON(deps ServiceDependencies) ([]byte, error) {
+	return json.MarshalIndent(deps, "", "  ")
+}
+
+var catalogExporters = map[string]struct {
+	contentType string
+	export      func(ServiceDependencies) ([]byte, error)
+}{
+	CatalogFormatBackstage: {"application/yaml", ExportBackstage},
+	CatalogFormatJSON:      {"application/json", ExportJSON},
+}
+
+// CatalogExporter exports the service dependency graph seen in the latest
+// report of a Reporter on starting and every interval after, so service
+// catalogs stay in sync with what's running. It is written to a file, replaced each time, or
+// POSTed to an http(s) URL.
+type CatalogExporter struct {
+	reporter    Reporter
+	destination string
+	format      string
+	client      *http.Client
+	quit        chan struct{}
+	wait        sync.WaitGroup
+}
+
+// NewCatalogExporter makes a new CatalogExporter, and starts exporting.
+func NewCatalogExporter(reporter Reporter, destination, format string, interval time.Duration) (*CatalogExporter, error) {
+	if _, ok := catalogExporters[format]; !ok {
+		return nil, fmt.Errorf("unknown catalog format %q: expected %s or %s", format, CatalogFormatBackstage, CatalogFormatJSON)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid catalog export interval %s", interval)
+	}
+	e := &CatalogExporter{
+		reporter:    reporter,
+		destination: destination,
+		format:      format,
+		client:      &http.Client{Timeout: catalogExportTimeout},
+		quit:        make(chan struct{}),
+	}
+	e.wait.Add(1)
+	go e.loop(interval)
+	return e, nil
+}
+
+// Stop stops exporting, waiting for any export underway.
+func (e *CatalogExporter) Stop() {
+	close(e.quit)
+	e.wait.Wait()
+}
+
+func (e *CatalogExporter) loop(interval time.Duration) {
+	defer e.wait.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), catalogExportTimeout)
+		if err := e.Export(ctx, mtime.Now()); err != nil {
+			log.Errorf("Error exporting the service catalog: %v", err)
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+// Export exports the service dependency graph of the report at now. Until
+// a probe has reported, there's nothing to say of services, so nothing is
+// exported, rather than an empty graph.
+func (e *CatalogExporter) Export(ctx context.Context, now time.Time) error {
+	rpt, err := e.reporter.Report(ctx, now)
+	if err != nil {
+		return err
+	}
+	if len(rpt.Host.Nodes) == 0 {
+		return nil
+	}
+	exporter := catalogExporters[e.format]
+	buf, err := exporter.export(MakeServiceDependencies(ctx, rpt, now))
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(e.destination, "http://") || strings.HasPrefix(e.destination, "https://") {
+		req, err := http.NewRequest("POST", e.destination, bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", exporter.contentType)
+		resp, err := e.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%s: %s", e.destination, resp.Status)
+		}
+		return nil
+	}
+
+	tmp := e.destination + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.destination)
+}
@@ -0,0 +1,164 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+// catalogReport is the fixture, with the client pod in a frontend service
+// of its own.
+func catalogReport() report.Report {
+	rpt := fixture.Report.Copy()
+	frontendID := report.MakeServiceNodeID("frontend-uid")
+	rpt.Service.Nodes[frontendID] = report.MakeNodeWith(frontendID, map[string]string{
+		kubernetes.Name:      "frontend",
+		kubernetes.Namespace: fixture.KubernetesNamespace,
+	}).WithTopology(report.Service)
+	pod := rpt.Pod.Nodes[fixture.ClientPodNodeID]
+	rpt.Pod.Nodes[fixture.ClientPodNodeID] = pod.PruneParents().WithParents(pod.Parents.Delete(report.Service).
+		Add(report.Service, report.MakeStringSet(frontendID)))
+	return rpt
+}
+
+func TestMakeServiceDependencies(t *testing.T) {
+	now := time.Now()
+	deps := app.MakeServiceDependencies(context.Background(), catalogReport(), now)
+	equals(t, now, deps.Generated)
+	byName := map[string]app.ServiceDependency{}
+	for _, service := range deps.Services {
+		byName[service.Name] = service
+	}
+	frontend, ok := byName["frontend"]
+	if !ok {
+		t.Fatalf("Expected the frontend service, got %v", deps.Services)
+	}
+	equals(t, fixture.KubernetesNamespace, frontend.Namespace)
+	equals(t, "services", frontend.TopologyID)
+	equals(t, []string{fixture.ServiceNodeID}, frontend.DependsOn)
+	equals(t, []string{}, byName[fixture.ServiceName].DependsOn)
+}
+
+func TestExportBackstage(t *testing.T) {
+	buf, err := app.ExportBackstage(app.ServiceDependencies{Services: []app.ServiceDependency{
+		{ID: "a", Name: "cart service", Namespace: "Shop", DependsOn: []string{"b", "s3"}},
+		{ID: "b", Name: "payments", DependsOn: []string{}},
+		{ID: "s3", Name: "AWS S3", External: true, DependsOn: []string{}},
+	}})
+	ok(t, err)
+	have := string(buf)
+	for _, want := range []string{
+		"kind: Component\nmetadata:\n  name: cart-service\n  namespace: shop\n  title: cart service\n",
+		"  dependsOn:\n  - component:default/payments\n  - resource:default/AWS-S3\n",
+		"kind: Resource\n",
+		"scope.weave.works/node-id: s3\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("Expected %q in:\n%s", want, have)
+		}
+	}
+	equals(t, 3, strings.Count(have, "---\n"))
+}
+
+func TestExportBackstageNames(t *testing.T) {
+	buf, err := app.ExportBackstage(app.ServiceDependencies{Services: []app.ServiceDependency{
+		{ID: "a", Name: "cart", Namespace: "shop", TopologyID: "services", DependsOn: []string{}},
+		{ID: "b", Name: "cart", Namespace: "shop", TopologyID: "ecs-services", DependsOn: []string{}},
+		{ID: "c", Name: "cart", Namespace: "other", TopologyID: "services", DependsOn: []string{}},
+		{ID: "d", Name: "cart/api", Namespace: "shop", TopologyID: "services", DependsOn: []string{}},
+		{ID: "e", Name: "cart api", Namespace: "shop", TopologyID: "services", DependsOn: []string{}},
+		{ID: "f", Name: "カート", Namespace: "shop", TopologyID: "services", DependsOn: []string{"a", "b"}},
+	}})
+	ok(t, err)
+	have := string(buf)
+	for _, want := range []string{
+		// Names are only suffixed where they'd clash
+		"  name: cart-services\n  namespace: shop\n",
+		"  name: cart-ecs-services\n  namespace: shop\n",
+		"  name: cart\n  namespace: other\n",
+		// Then by a hash of their IDs, where they'd still clash
+		"  name: cart-api-services-",
+		// And empty names are named by their topology
+		"  name: services\n  namespace: shop\n",
+		"  dependsOn:\n  - component:shop/cart-services\n  - component:shop/cart-ecs-services\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("Expected %q in:\n%s", want, have)
+		}
+	}
+	names := map[string]bool{}
+	for _, line := range strings.Split(have, "\n") {
+		if strings.HasPrefix(line, "  name: ") {
+			names[line] = true
+		}
+	}
+	equals(t, 6, len(names))
+}
+
+func TestCatalogExporter(t *testing.T) {
+	ctx := context.Background()
+	collector := app.StaticCollector(catalogReport())
+
+	if _, err := app.NewCatalogExporter(collector, "catalog.txt", "xml", time.Hour); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if _, err := app.NewCatalogExporter(collector, "catalog.txt", app.CatalogFormatJSON, 0); err == nil {
+		t.Error("Expected an error for no interval")
+	}
+
+	// To a file, on starting
+	dir, err := ioutil.TempDir("", "catalog")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dependencies.json")
+	exporter, err := app.NewCatalogExporter(collector, path, app.CatalogFormatJSON, time.Hour)
+	ok(t, err)
+	defer exporter.Stop()
+	test.Poll(t, time.Second, true, func() interface{} {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	buf, err := ioutil.ReadFile(path)
+	ok(t, err)
+	var deps app.ServiceDependencies
+	ok(t, json.Unmarshal(buf, &deps))
+	equals(t, 2, len(deps.Services))
+
+	// But not before any probe has reported
+	empty := filepath.Join(dir, "empty.json")
+	exporter, err = app.NewCatalogExporter(app.StaticCollector(report.MakeReport()), empty, app.CatalogFormatJSON, time.Hour)
+	ok(t, err)
+	ok(t, exporter.Export(ctx, time.Now()))
+	exporter.Stop()
+	if _, err := os.Stat(empty); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be exported, got %v", err)
+	}
+
+	// To a URL
+	posted := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		posted <- r.Method + " " + r.Header.Get("Content-Type") + " " + string(body)
+	}))
+	defer server.Close()
+	exporter, err = app.NewCatalogExporter(collector, server.URL, app.CatalogFormatBackstage, time.Hour)
+	ok(t, err)
+	defer exporter.Stop()
+	if have := <-posted; !strings.HasPrefix(have, "POST application/yaml ---\napiVersion: backstage.io/v1alpha1\n") {
+		t.Errorf("Expected Backstage entities to be posted, got %q", have)
+	}
+}
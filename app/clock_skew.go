@@ -0,0 +1,123 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+// clockSkewAdder is an Adder which corrects reports from probes whose
+// clock is off. Reports are merged, and metrics windowed, on the
+// timestamps the probes put on them, so a host whose clock is ahead
+// would otherwise have its samples outlive the window, and one which is
+// behind would have them dropped straight away.
+type clockSkewAdder struct {
+	Adder
+	threshold time.Duration
+}
+
+// NewClockSkewAdder returns an Adder which measures the clock skew of the
+// probes, as the difference between the timestamp of their host and the
+// time we receive their report, and for hosts skewed by more than threshold,
+// flags the host and moves the metric samples of the report back in line
+// with our clock, before passing it on to the Adder. A threshold of zero
+// disables it.
+func NewClockSkewAdder(a Adder, threshold time.Duration) Adder {
+	if threshold <= 0 {
+		return a
+	}
+	return clockSkewAdder{Adder: a, threshold: threshold}
+}
+
+// Add implements Adder.
+func (c clockSkewAdder) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	skew, ok := clockSkew(rpt, mtime.Now())
+	if _, replayed := ReportReplayed(ctx); !ok || replayed || (skew <= c.threshold && skew >= -c.threshold) {
+		return c.Adder.Add(ctx, rpt, buf)
+	}
+
+	rpt = correctClockSkew(rpt, skew)
+	// buf must match the report, as some collectors store it
+	var corrected bytes.Buffer
+	if err := rpt.WriteBinary(&corrected, gzip.DefaultCompression); err != nil {
+		return err
+	}
+	return c.Adder.Add(ctx, rpt, corrected.Bytes())
+}
+
+// replayedCtxKey is the key of when a report a probe replayed was made,
+// in the context it's added with, for reports streamed rather than POSTed.
+const replayedCtxKey contextKey = contextKey("replayed")
+
+// ReportReplayed returns when the report added with ctx was made, if the
+// probe replayed it, so it's late rather than skewed.
+func ReportReplayed(ctx context.Context) (time.Time, bool) {
+	if made, ok := ctx.Value(replayedCtxKey).(time.Time); ok {
+		return made, true
+	}
+	r, ok := ctx.Value(RequestCtxKey).(*http.Request)
+	if !ok {
+		return time.Time{}, false
+	}
+	made, err := time.Parse(time.RFC3339Nano, r.Header.Get(xfer.ScopeReportReplayedHeader))
+	return made, err == nil
+}
+
+// ReportTime returns the time to keep the report added with ctx at: when
+// it was made, if the probe replayed it, so it fills the gap in the
+// history it was meant for, otherwise now.
+func ReportTime(ctx context.Context) time.Time {
+	now := mtime.Now()
+	if made, ok := ReportReplayed(ctx); ok && made.Before(now) {
+		return made
+	}
+	return now
+}
+
+// clockSkew returns how far ahead of now the host of a report is. The
+// report was made at most a publish interval ago, which is well under any
+// skew worth correcting.
+func clockSkew(rpt report.Report, now time.Time) (time.Duration, bool) {
+	for _, n := range rpt.Host.Nodes {
+		ts, ok := n.Latest.Lookup(host.Timestamp)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			continue
+		}
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+func correctClockSkew(rpt report.Report, skew time.Duration) report.Report {
+	rpt = rpt.Copy()
+	rpt.WalkTopologies(func(t *report.Topology) {
+		for id, n := range t.Nodes {
+			if len(n.Metrics) == 0 {
+				continue
+			}
+			metrics := make(report.Metrics, len(n.Metrics))
+			for key, metric := range n.Metrics {
+				metrics[key] = metric.Shift(-skew)
+			}
+			n.Metrics = metrics
+			t.Nodes[id] = n
+		}
+	})
+	for id, n := range rpt.Host.Nodes {
+		rpt.Host.Nodes[id] = n.WithLatest(host.ClockSkew, mtime.Now(), strconv.FormatFloat(skew.Seconds(), 'f', 1, 64))
+	}
+	return rpt
+}
@@ -0,0 +1,92 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+type recordingAdder struct {
+	reports []report.Report
+	bufs    [][]byte
+	times   []time.Time
+}
+
+func (r *recordingAdder) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	r.reports = append(r.reports, rpt)
+	r.bufs = append(r.bufs, buf)
+	r.times = append(r.times, app.ReportTime(ctx))
+	return nil
+}
+
+func TestClockSkewAdder(t *testing.T) {
+	now := time.Now().UTC()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	hostReport := func(hostTime time.Time) report.Report {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("foo"), map[string]string{
+			host.Timestamp: hostTime.Format(time.RFC3339Nano),
+		}).WithMetrics(report.Metrics{
+			host.CPUUsage: report.MakeSingletonMetric(hostTime, 50),
+		}))
+		return rpt
+	}
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name      string
+		skew      time.Duration
+		corrected bool
+		replayed  bool
+	}{
+		{"in sync", 2 * time.Second, false, false},
+		{"ahead", time.Minute, true, false},
+		{"behind", -time.Minute, true, false},
+		{"replayed", -time.Minute, false, true},
+	} {
+		adder := &recordingAdder{}
+		rpt := hostReport(now.Add(tc.skew))
+		ctx := ctx
+		if tc.replayed {
+			r := httptest.NewRequest("POST", "/api/report", nil)
+			r.Header.Set(xfer.ScopeReportReplayedHeader, now.Add(tc.skew).Format(time.RFC3339))
+			ctx = context.WithValue(ctx, app.RequestCtxKey, r)
+		}
+		if err := app.NewClockSkewAdder(adder, 10*time.Second).Add(ctx, rpt, []byte("original")); err != nil {
+			t.Fatal(err)
+		}
+
+		node := adder.reports[0].Host.Nodes[report.MakeHostNodeID("foo")]
+		skew, flagged := node.Latest.Lookup(host.ClockSkew)
+		sample, _ := node.Metrics[host.CPUUsage].LastSample()
+		if !tc.corrected {
+			if flagged {
+				t.Errorf("%s: expected no clock skew, got %s", tc.name, skew)
+			}
+			if !sample.Timestamp.Equal(now.Add(tc.skew)) || string(adder.bufs[0]) != "original" {
+				t.Errorf("%s: expected report to be passed on as is", tc.name)
+			}
+			continue
+		}
+		if want := strconv.FormatFloat(tc.skew.Seconds(), 'f', 1, 64); !flagged || skew != want {
+			t.Errorf("%s: expected clock skew %q, got %q", tc.name, want, skew)
+		}
+		if !sample.Timestamp.Equal(now) {
+			t.Errorf("%s: expected sample at %v, got %v", tc.name, now, sample.Timestamp)
+		}
+		if string(adder.bufs[0]) == "original" {
+			t.Errorf("%s: expected the corrected report to be re-encoded", tc.name)
+		}
+	}
+}
@@ -0,0 +1,624 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/memberlist"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+const (
+	// DefaultClusterGossipPort is the port app replicas gossip on.
+	DefaultClusterGossipPort = 7946
+	// DefaultClusterAPIPort is the port of the API app replicas forward
+	// controls and pipes to each other over.
+	DefaultClusterAPIPort = 4446
+
+	clusterJoinInterval = 10 * time.Second
+	clusterLeaveTimeout = 5 * time.Second
+)
+
+var (
+	clusterMembers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "scope",
+		Name:      "cluster_members",
+		Help:      "Number of app replicas in the cluster.",
+	})
+	clusterForwarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "cluster_forwarded_total",
+		Help:      "Total count of controls and pipes forwarded to other app replicas.",
+	}, []string{"kind"})
+)
+
+func init() {
+	prometheus.MustRegister(clusterMembers)
+	prometheus.MustRegister(clusterForwarded)
+}
+
+// ClusterConfig is the config of a Cluster.
+type ClusterConfig struct {
+	// Name of this replica in the cluster, the hostname if "".
+	Name string
+	// Peers are the gossip addresses of replicas to join, as host:port.
+	// Hostnames resolving to several replicas join them all.
+	Peers      []string
+	GossipPort int
+	APIPort    int
+	// AdvertiseAddr is the address other replicas reach this one on, a
+	// private one of its own if "". Gossip and the cluster API are only
+	// served on it.
+	AdvertiseAddr string
+	// Secret shared by the replicas, which their gossip is encrypted, and
+	// their cluster API calls authenticated, with.
+	Secret string
+}
+
+// Cluster is the replicas of a standalone app behind a load balancer,
+// which find each other by gossip, so controls and pipes reach the probes
+// whichever replica they come to. Replicas gossip which probes have their
+// control connection to them, and forward controls for a probe to the
+// replica it's connected to. Pipes are owned by a replica picked by their
+// ID, and bridged to it by the replicas either end comes to, so there's no
+// need for sticky sessions. Replicas share a secret, encrypting their
+// gossip, and authenticating their calls to each other's cluster API, which
+// is only served on their private address.
+type Cluster struct {
+	list       *memberlist.Memberlist
+	broadcasts *memberlist.TransmitLimitedQueue
+	apiPort    int
+	api        *mux.Router
+	apiToken   string // bearer token of cluster API calls
+	client     *http.Client
+	quit       chan struct{}
+
+	mtx     sync.Mutex
+	members int
+	probes  map[string]clusterProbe   // by ID, the replicas of the control connections of probes
+	mine    map[string]clusterHandler // by ID, the control handlers of probes connected to us
+}
+
+// clusterHandler is the control handler a probe registered with us, since
+// when.
+type clusterHandler struct {
+	id    int64
+	since time.Time
+}
+
+// clusterProbe is where a probe's control connection is: the address of the
+// cluster API of its replica, since when.
+type clusterProbe struct {
+	Addr  string
+	Since time.Time
+}
+
+// clusterMessage is what replicas gossip as probes connect and disconnect.
+type clusterMessage struct {
+	ProbeID   string
+	Addr      string
+	Since     time.Time
+	Connected bool
+}
+
+// NewCluster joins this app to the cluster of its peers, serving the
+// cluster API.
+func NewCluster(config ClusterConfig) (*Cluster, error) {
+	if config.Secret == "" {
+		return nil, errors.New("clustering apps needs a secret")
+	}
+	bindAddr := config.AdvertiseAddr
+	if bindAddr == "" {
+		ip, err := sockaddr.GetPrivateIP()
+		if err != nil {
+			return nil, err
+		}
+		if ip == "" {
+			return nil, errors.New("no private address to cluster apps on, and none advertised")
+		}
+		bindAddr = ip
+	}
+	if config.GossipPort == 0 {
+		config.GossipPort = DefaultClusterGossipPort
+	}
+	if config.APIPort == 0 {
+		config.APIPort = DefaultClusterAPIPort
+	}
+	c := &Cluster{
+		apiPort:  config.APIPort,
+		api:      mux.NewRouter(),
+		apiToken: hex.EncodeToString(clusterKey(config.Secret, "api")),
+		client:   &http.Client{},
+		quit:     make(chan struct{}),
+		probes:   map[string]clusterProbe{},
+		mine:     map[string]clusterHandler{},
+	}
+
+	mlConfig := memberlist.DefaultLANConfig()
+	if config.Name != "" {
+		mlConfig.Name = config.Name
+	}
+	mlConfig.BindAddr = bindAddr
+	mlConfig.BindPort = config.GossipPort
+	mlConfig.AdvertisePort = config.GossipPort
+	mlConfig.AdvertiseAddr = config.AdvertiseAddr
+	mlConfig.SecretKey = clusterKey(config.Secret, "gossip")
+	mlConfig.Delegate = clusterDelegate{c}
+	mlConfig.Events = clusterDelegate{c}
+	mlConfig.LogOutput = log.StandardLogger().WriterLevel(log.DebugLevel)
+	list, err := memberlist.Create(mlConfig)
+	if err != nil {
+		return nil, err
+	}
+	c.list = list
+	c.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes:       list.NumMembers,
+		RetransmitMult: mlConfig.RetransmitMult,
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(config.APIPort)))
+	if err != nil {
+		list.Shutdown()
+		return nil, err
+	}
+	go func() {
+		log.Infof("Serving the cluster API on %s", listener.Addr())
+		log.Infof("Cluster API terminated: %v", http.Serve(listener, c.authenticate(c.api)))
+	}()
+	go func() {
+		<-c.quit
+		listener.Close()
+	}()
+
+	go c.join(config.Peers)
+	return c, nil
+}
+
+// clusterKey derives the key of a purpose from the secret of the cluster,
+// so the gossip key and the API token don't give each other away.
+func clusterKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// authenticate only lets calls of other replicas, with the token of the
+// cluster, through to the cluster API, which passes on controls and pipes
+// they've already authorized.
+func (c *Cluster) authenticate(next http.Handler) http.Handler {
+	want := []byte("Bearer " + c.apiToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			respondWith(w, http.StatusUnauthorized, errors.New("cluster API calls need the token of the cluster"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiRequest makes a request of the cluster API of another replica.
+func (c *Cluster) apiRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	return req.WithContext(ctx), nil
+}
+
+// join joins the peers, retrying until one of them is reached, as replicas
+// scaled up together may not all be up yet.
+func (c *Cluster) join(peers []string) {
+	if len(peers) == 0 {
+		return
+	}
+	for {
+		n, err := c.list.Join(peers)
+		if n > 0 {
+			log.Infof("Joined the cluster of %d app replicas", c.list.NumMembers())
+			return
+		}
+		log.Warnf("Error joining the cluster of %v, retrying in %s: %v", peers, clusterJoinInterval, err)
+		select {
+		case <-time.After(clusterJoinInterval):
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Stop leaves the cluster.
+func (c *Cluster) Stop() {
+	close(c.quit)
+	if err := c.list.Leave(clusterLeaveTimeout); err != nil {
+		log.Warnf("Error leaving the cluster: %v", err)
+	}
+	c.list.Shutdown()
+}
+
+// apiAddr is the address of the cluster API of the node.
+func (c *Cluster) apiAddr(node *memberlist.Node) string {
+	port := c.apiPort
+	if p, err := strconv.Atoi(string(node.Meta)); err == nil {
+		port = p
+	}
+	return net.JoinHostPort(node.Addr.String(), strconv.Itoa(port))
+}
+
+func (c *Cluster) localAddr() string {
+	return c.apiAddr(c.list.LocalNode())
+}
+
+// probeAddr returns the address of the cluster API of the replica the probe
+// is connected to, if it's not us.
+func (c *Cluster) probeAddr(probeID string) (string, bool) {
+	c.mtx.Lock()
+	probe, ok := c.probes[probeID]
+	c.mtx.Unlock()
+	if !ok || probe.Addr == c.localAddr() {
+		return "", false
+	}
+	return probe.Addr, true
+}
+
+// pipeAddr returns the address of the cluster API of the replica owning the
+// pipe, if it's not us, picked by rendezvous hashing, so every replica picks
+// the same one, and only the pipes of replicas leaving move.
+func (c *Cluster) pipeAddr(pipeID string) (string, bool) {
+	var (
+		owner *memberlist.Node
+		max   uint32
+	)
+	for _, node := range c.list.Members() {
+		h := fnv.New32a()
+		h.Write([]byte(node.Name + "/" + pipeID))
+		if weight := h.Sum32(); owner == nil || weight > max || (weight == max && node.Name < owner.Name) {
+			owner, max = node, weight
+		}
+	}
+	if owner == nil || owner.Name == c.list.LocalNode().Name {
+		return "", false
+	}
+	return c.apiAddr(owner), true
+}
+
+// apply applies a message gossiped, keeping the latest connection of each
+// probe.
+func (c *Cluster) apply(msg clusterMessage) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	current, ok := c.probes[msg.ProbeID]
+	if msg.Connected {
+		if !ok || !current.Since.After(msg.Since) {
+			c.probes[msg.ProbeID] = clusterProbe{Addr: msg.Addr, Since: msg.Since}
+		}
+		return
+	}
+	if ok && current.Addr == msg.Addr && !current.Since.After(msg.Since) {
+		delete(c.probes, msg.ProbeID)
+	}
+}
+
+// announce gossips the probe connecting to, or disconnecting from, us.
+func (c *Cluster) announce(probeID string, since time.Time, connected bool) {
+	msg := clusterMessage{ProbeID: probeID, Addr: c.localAddr(), Since: since, Connected: connected}
+	c.apply(msg)
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		log.Errorf("Error encoding cluster message: %v", err)
+		return
+	}
+	c.broadcasts.QueueBroadcast(clusterBroadcast{probeID: probeID, msg: buf})
+}
+
+// clusterBroadcast is a clusterMessage to gossip. Those of a probe replace
+// the ones before.
+type clusterBroadcast struct {
+	probeID string
+	msg     []byte
+}
+
+func (b clusterBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	o, ok := other.(clusterBroadcast)
+	return ok && o.probeID == b.probeID
+}
+
+func (b clusterBroadcast) Message() []byte { return b.msg }
+
+func (b clusterBroadcast) Finished() {}
+
+// clusterDelegate gossips the probes of a Cluster.
+type clusterDelegate struct {
+	*Cluster
+}
+
+func (d clusterDelegate) NodeMeta(limit int) []byte {
+	return []byte(strconv.Itoa(d.apiPort))
+}
+
+func (d clusterDelegate) NotifyMsg(buf []byte) {
+	var msg clusterMessage
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		log.Warnf("Error decoding cluster message: %v", err)
+		return
+	}
+	d.apply(msg)
+}
+
+func (d clusterDelegate) GetBroadcasts(overhead, limit int) [][]byte {
+	return d.broadcasts.GetBroadcasts(overhead, limit)
+}
+
+// LocalState is the probes connected to us, for replicas to sync up with
+// what they missed.
+func (d clusterDelegate) LocalState(join bool) []byte {
+	d.mtx.Lock()
+	addr := d.localAddr()
+	var msgs []clusterMessage
+	for id, handler := range d.mine {
+		msgs = append(msgs, clusterMessage{ProbeID: id, Addr: addr, Since: handler.since, Connected: true})
+	}
+	d.mtx.Unlock()
+	buf, err := json.Marshal(msgs)
+	if err != nil {
+		log.Errorf("Error encoding cluster state: %v", err)
+	}
+	return buf
+}
+
+func (d clusterDelegate) MergeRemoteState(buf []byte, join bool) {
+	var msgs []clusterMessage
+	if err := json.Unmarshal(buf, &msgs); err != nil {
+		log.Warnf("Error decoding cluster state: %v", err)
+		return
+	}
+	for _, msg := range msgs {
+		d.apply(msg)
+	}
+}
+
+// NotifyJoin is called from within memberlist.Create, before d.list is
+// set, so we count members ourselves.
+func (d clusterDelegate) NotifyJoin(node *memberlist.Node) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.members++
+	clusterMembers.Set(float64(d.members))
+}
+
+// NotifyLeave forgets the probes of replicas which left.
+func (d clusterDelegate) NotifyLeave(node *memberlist.Node) {
+	addr := d.apiAddr(node)
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.members--
+	clusterMembers.Set(float64(d.members))
+	for id, probe := range d.probes {
+		if probe.Addr == addr {
+			delete(d.probes, id)
+		}
+	}
+}
+
+func (d clusterDelegate) NotifyUpdate(node *memberlist.Node) {}
+
+// ControlRouter returns a ControlRouter passing controls for probes
+// connected to other replicas on to them, and the rest to local.
+func (c *Cluster) ControlRouter(local ControlRouter) ControlRouter {
+	c.api.Methods("POST").Path("/private/api/cluster/control/{probeID}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var req xfer.Request
+			if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&req); err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			res, err := local.Handle(ctx, mux.Vars(r)["probeID"], req)
+			if err != nil {
+				respondWith(w, http.StatusNotFound, err)
+				return
+			}
+			respondWith(w, http.StatusOK, res)
+		}))
+	return &clusterControlRouter{ControlRouter: local, cluster: c}
+}
+
+type clusterControlRouter struct {
+	ControlRouter
+	cluster *Cluster
+}
+
+func (cr *clusterControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	addr, ok := cr.cluster.probeAddr(probeID)
+	if !ok {
+		return cr.ControlRouter.Handle(ctx, probeID, req)
+	}
+	clusterForwarded.WithLabelValues("control").Inc()
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, &codec.JsonHandle{}).Encode(req); err != nil {
+		return xfer.Response{}, err
+	}
+	httpReq, err := cr.cluster.apiRequest(ctx, "POST", fmt.Sprintf("http://%s/private/api/cluster/control/%s", addr, probeID), &buf)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	resp, err := cr.cluster.client.Do(httpReq)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		text, _ := ioutil.ReadAll(resp.Body)
+		return xfer.Response{}, fmt.Errorf("probe %s: %s", probeID, bytes.TrimSpace(text))
+	}
+	var res xfer.Response
+	err = codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&res)
+	return res, err
+}
+
+func (cr *clusterControlRouter) Register(ctx context.Context, probeID string, handler xfer.ControlHandlerFunc) (int64, error) {
+	id, err := cr.ControlRouter.Register(ctx, probeID, handler)
+	if err != nil {
+		return id, err
+	}
+	since := mtime.Now()
+	cr.cluster.mtx.Lock()
+	cr.cluster.mine[probeID] = clusterHandler{id: id, since: since}
+	cr.cluster.mtx.Unlock()
+	cr.cluster.announce(probeID, since, true)
+	return id, nil
+}
+
+func (cr *clusterControlRouter) Deregister(ctx context.Context, probeID string, id int64) error {
+	if err := cr.ControlRouter.Deregister(ctx, probeID, id); err != nil {
+		return err
+	}
+	// The probe might have reconnected in the mean time
+	cr.cluster.mtx.Lock()
+	handler, ok := cr.cluster.mine[probeID]
+	mine := ok && handler.id == id
+	if mine {
+		delete(cr.cluster.mine, probeID)
+	}
+	cr.cluster.mtx.Unlock()
+	if mine {
+		cr.cluster.announce(probeID, handler.since, false)
+	}
+	return nil
+}
+
+// PipeRouter returns a PipeRouter bridging the ends of pipes owned by other
+// replicas to them, and getting the rest from local.
+func (c *Cluster) PipeRouter(local PipeRouter) PipeRouter {
+	c.api.Methods("GET").Path("/private/api/cluster/pipe/{pipeID}/check").
+		HandlerFunc(requestContextDecorator(checkPipe(local)))
+	c.api.Methods("GET").Path("/private/api/cluster/pipe/{pipeID}/ui").
+		HandlerFunc(requestContextDecorator(handlePipeWs(local, UIEnd)))
+	c.api.Methods("GET").Path("/private/api/cluster/pipe/{pipeID}/probe").
+		HandlerFunc(requestContextDecorator(handlePipeWs(local, ProbeEnd)))
+	c.api.Methods("DELETE").Path("/private/api/cluster/pipe/{pipeID}").
+		HandlerFunc(requestContextDecorator(deletePipe(local)))
+	return &clusterPipeRouter{
+		PipeRouter: local,
+		cluster:    c,
+		bridges:    map[string]xfer.Pipe{},
+	}
+}
+
+type clusterPipeRouter struct {
+	PipeRouter
+	cluster *Cluster
+
+	mtx     sync.Mutex
+	bridges map[string]xfer.Pipe // by pipe ID and end
+}
+
+func (pr *clusterPipeRouter) Exists(ctx context.Context, id string) (bool, error) {
+	addr, ok := pr.cluster.pipeAddr(id)
+	if !ok {
+		return pr.PipeRouter.Exists(ctx, id)
+	}
+	req, err := pr.cluster.apiRequest(ctx, "GET", fmt.Sprintf("http://%s/private/api/cluster/pipe/%s/check", addr, id), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := pr.cluster.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("checking pipe %s: %s", id, resp.Status)
+}
+
+// Get bridges the end of pipes owned by other replicas to the same end of
+// the pipe on the owner.
+func (pr *clusterPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	addr, ok := pr.cluster.pipeAddr(id)
+	if !ok {
+		return pr.PipeRouter.Get(ctx, id, e)
+	}
+	clusterForwarded.WithLabelValues("pipe").Inc()
+	conn, _, err := xfer.DialWS(&websocket.Dialer{}, fmt.Sprintf("ws://%s/private/api/cluster/pipe/%s/%s", addr, id, e),
+		http.Header{"Authorization": []string{"Bearer " + pr.cluster.apiToken}})
+	if err != nil {
+		return nil, nil, err
+	}
+	bridge := xfer.NewPipe()
+	local, remote := bridge.Ends()
+	key := id + "/" + e.String()
+	pr.mtx.Lock()
+	if previous, ok := pr.bridges[key]; ok {
+		go previous.Close()
+	}
+	pr.bridges[key] = bridge
+	pr.mtx.Unlock()
+
+	go func() {
+		defer conn.Close()
+		defer bridge.Close()
+		if err := bridge.CopyToWebsocket(remote, conn); err != nil && err != io.EOF && !xfer.IsExpectedWSCloseError(err) {
+			log.Errorf("Error bridging pipe %s (%s) to %s: %v", id, e, addr, err)
+		}
+	}()
+	return bridge, local, nil
+}
+
+func (pr *clusterPipeRouter) Release(ctx context.Context, id string, e End) error {
+	key := id + "/" + e.String()
+	pr.mtx.Lock()
+	bridge, ok := pr.bridges[key]
+	delete(pr.bridges, key)
+	pr.mtx.Unlock()
+	if !ok {
+		return pr.PipeRouter.Release(ctx, id, e)
+	}
+	return bridge.Close()
+}
+
+func (pr *clusterPipeRouter) Delete(ctx context.Context, id string) error {
+	addr, ok := pr.cluster.pipeAddr(id)
+	if !ok {
+		return pr.PipeRouter.Delete(ctx, id)
+	}
+	req, err := pr.cluster.apiRequest(ctx, "DELETE", fmt.Sprintf("http://%s/private/api/cluster/pipe/%s", addr, id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := pr.cluster.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deleting pipe %s: %s", id, resp.Status)
+	}
+	return nil
+}
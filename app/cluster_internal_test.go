@@ -0,0 +1,79 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestClusterForwardsControls(t *testing.T) {
+	var (
+		clusters = make([]*Cluster, 2)
+		routers  = make([]ControlRouter, 2)
+	)
+	for i := range clusters {
+		c, err := NewCluster(ClusterConfig{
+			Name:          fmt.Sprintf("app-%d", i),
+			Peers:         []string{"127.0.0.1:17946"},
+			GossipPort:    17946 + i,
+			APIPort:       14446 + i,
+			AdvertiseAddr: "127.0.0.1",
+			Secret:        "secret",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Stop()
+		clusters[i] = c
+		routers[i] = c.ControlRouter(NewLocalControlRouter())
+	}
+	test.Poll(t, 5*time.Second, 2, func() interface{} {
+		return clusters[1].list.NumMembers()
+	})
+
+	ctx := context.Background()
+	id, err := routers[0].Register(ctx, "probe", func(req xfer.Request) xfer.Response {
+		return xfer.Response{Value: req.NodeID}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		_, ok := clusters[1].probeAddr("probe")
+		return ok
+	})
+	res, err := routers[1].Handle(ctx, "probe", xfer.Request{NodeID: "node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != "node" {
+		t.Errorf("forwarded control returned %v", res.Value)
+	}
+
+	// The cluster API only takes calls with the token of the cluster
+	url := fmt.Sprintf("http://%s/private/api/cluster/control/probe", clusters[0].localAddr())
+	resp, err := http.Post(url, "application/json", strings.NewReader(`{"NodeID": "node"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected an unauthenticated control to be refused, got %s", resp.Status)
+	}
+
+	// Once the probe disconnects, the other replica stops forwarding
+	if err := routers[0].Deregister(ctx, "probe", id); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 5*time.Second, false, func() interface{} {
+		_, ok := clusters[1].probeAddr("probe")
+		return ok
+	})
+}
@@ -4,14 +4,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/render/detailed"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -41,6 +44,10 @@ type Reporter interface {
 type WebReporter struct {
 	Reporter
 	MetricsGraphURL string
+	MetricsHistory  MetricsHistory
+	Traces          detailed.Traces
+	Alerter         *Alerter
+	Annotations     AnnotationStore
 }
 
 // Adder is something that can accept reports. It's a convenient interface for
@@ -111,12 +118,20 @@ func NewCollector(window time.Duration) Collector {
 	}
 }
 
-// Add adds a report to the collector's internal state. It implements Adder.
-func (c *collector) Add(_ context.Context, rpt report.Report, _ []byte) error {
+// Add adds a report to the collector's internal state, at the time it was
+// made, if replayed. It implements Adder.
+func (c *collector) Add(ctx context.Context, rpt report.Report, _ []byte) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
-	c.reports = append(c.reports, rpt)
-	c.timestamps = append(c.timestamps, mtime.Now())
+	// Keep the reports in time order, replayed ones among those made after.
+	timestamp := ReportTime(ctx)
+	i := sort.Search(len(c.timestamps), func(i int) bool { return c.timestamps[i].After(timestamp) })
+	c.reports = append(c.reports, report.Report{})
+	copy(c.reports[i+1:], c.reports[i:])
+	c.reports[i] = rpt
+	c.timestamps = append(c.timestamps, time.Time{})
+	copy(c.timestamps[i+1:], c.timestamps[i:])
+	c.timestamps[i] = timestamp
 
 	c.clean()
 	c.cached = nil
@@ -128,7 +143,9 @@ func (c *collector) Add(_ context.Context, rpt report.Report, _ []byte) error {
 
 // Report returns a merged report over all added reports. It implements
 // Reporter.
-func (c *collector) Report(_ context.Context, timestamp time.Time) (report.Report, error) {
+func (c *collector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "app.merge")
+	defer span.Finish()
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
@@ -137,6 +154,7 @@ func (c *collector) Report(_ context.Context, timestamp time.Time) (report.Repor
 	if c.cached != nil && len(c.reports) > 0 {
 		oldest := timestamp.Add(-c.window)
 		if c.timestamps[0].After(oldest) {
+			span.SetTag("cached", true)
 			return *c.cached, nil
 		}
 	}
@@ -149,6 +167,7 @@ func (c *collector) Report(_ context.Context, timestamp time.Time) (report.Repor
 	}
 
 	rpt := c.merger.Merge(c.reports)
+	span.SetTag("reports", len(c.reports))
 	c.cached = &rpt
 	return rpt, nil
 }
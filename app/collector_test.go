@@ -1,6 +1,7 @@
 package app_test
 
 import (
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/reflect"
 )
@@ -112,6 +114,50 @@ func TestCollectorExpire(t *testing.T) {
 	}
 }
 
+func TestCollectorReplayed(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	window := 10 * time.Second
+	c := app.NewCollector(window)
+	replayed := func(made time.Time) context.Context {
+		r := httptest.NewRequest("POST", "/api/report", nil)
+		r.Header.Set(xfer.ScopeReportReplayedHeader, made.Format(time.RFC3339Nano))
+		return context.WithValue(context.Background(), app.RequestCtxKey, r)
+	}
+
+	r1 := report.MakeReport()
+	r1.Endpoint.AddNode(report.MakeNode("foo"))
+	r2 := report.MakeReport()
+	r2.Endpoint.AddNode(report.MakeNode("bar"))
+	r3 := report.MakeReport()
+	r3.Endpoint.AddNode(report.MakeNode("baz"))
+
+	// Replayed reports are kept as of when they were made, so those older
+	// than the window are dropped, rather than shown as live
+	c.Add(context.Background(), r1, nil)
+	c.Add(replayed(now.Add(-window-time.Second)), r2, nil)
+	c.Add(replayed(now.Add(-5*time.Second)), r3, nil)
+	have, err := c.Report(context.Background(), mtime.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := report.MakeReport().Merge(r1).Merge(r3); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// And expire before those added since
+	mtime.NowForce(now.Add(6 * time.Second))
+	have, err = c.Report(context.Background(), mtime.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := report.MakeReport().Merge(r1); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
 func TestCollectorWait(t *testing.T) {
 	ctx := context.Background()
 	window := time.Millisecond
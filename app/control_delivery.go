@@ -0,0 +1,320 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+const (
+	// DefaultControlTimeout is how long controls are retried for before
+	// giving up, unless configured otherwise.
+	DefaultControlTimeout = 30 * time.Second
+
+	controlRetryInterval   = time.Second
+	controlStatusRetention = 10 * time.Minute
+)
+
+// The states of controls.
+const (
+	ControlPending      = "pending"      // not delivered yet, and being retried
+	ControlDelivered    = "delivered"    // answered by a probe too old to acknowledge it
+	ControlAcknowledged = "acknowledged" // answered by a probe acknowledging it
+	ControlFailed       = "failed"       // answered by a probe with an error, or not deliverable
+	ControlTimedOut     = "timed_out"    // not delivered before its timeout
+)
+
+var controlDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "scope",
+	Name:      "control_deliveries_total",
+	Help:      "Total count of controls, by the state they ended up in.",
+}, []string{"state"})
+
+func init() {
+	prometheus.MustRegister(controlDeliveries)
+}
+
+// ControlStatus is how the delivery of a control went, for the UI to
+// tell.
+type ControlStatus struct {
+	ID       string    `json:"id"`
+	ProbeID  string    `json:"probeID"`
+	NodeID   string    `json:"nodeID"`
+	Control  string    `json:"control"`
+	State    string    `json:"state"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+}
+
+// controlTimeout is the error of controls which weren't delivered in time.
+type controlTimeout struct {
+	control string
+	timeout time.Duration
+	err     error
+}
+
+func (t controlTimeout) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", t.control, t.timeout, t.err)
+}
+
+// ControlDelivery tracks the delivery of controls to probes, by their user
+// and ID, and configures how long they are retried for.
+type ControlDelivery struct {
+	userIDer func(context.Context) (string, error)
+	timeout  time.Duration
+	timeouts map[string]time.Duration
+
+	mtx      sync.Mutex
+	controls map[string]*deliveredControl // by user and ID
+}
+
+type deliveredControl struct {
+	status ControlStatus
+	done   chan struct{}
+	res    xfer.Response
+	err    error
+}
+
+// NewControlDelivery makes a ControlDelivery retrying controls for
+// timeout, or for those in timeouts, by name, for as long as it says.
+// userIDer identifies the user of a control; users only see the controls
+// they made.
+func NewControlDelivery(userIDer func(context.Context) (string, error), timeout time.Duration, timeouts map[string]time.Duration) *ControlDelivery {
+	if timeout <= 0 {
+		timeout = DefaultControlTimeout
+	}
+	return &ControlDelivery{
+		userIDer: userIDer,
+		timeout:  timeout,
+		timeouts: timeouts,
+		controls: map[string]*deliveredControl{},
+	}
+}
+
+// Timeout is how long the control is retried for.
+func (d *ControlDelivery) Timeout(control string) time.Duration {
+	if timeout, ok := d.timeouts[control]; ok {
+		return timeout
+	}
+	return d.timeout
+}
+
+// key is the key of the control with the ID of the user of ctx.
+func (d *ControlDelivery) key(ctx context.Context, id string) (string, error) {
+	userID, err := d.userIDer(ctx)
+	if err != nil {
+		return "", err
+	}
+	return userID + "/" + id, nil
+}
+
+// Status returns the status of the control with the ID, of the user of ctx.
+func (d *ControlDelivery) Status(ctx context.Context, id string) (ControlStatus, bool) {
+	key, err := d.key(ctx, id)
+	if err != nil {
+		return ControlStatus{}, false
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	c, ok := d.controls[key]
+	if !ok {
+		return ControlStatus{}, false
+	}
+	return c.status, true
+}
+
+// start starts delivering the request, unless it is a retry of one being,
+// or already, delivered, returning that one and false.
+func (d *ControlDelivery) start(ctx context.Context, probeID string, req xfer.Request) (*deliveredControl, bool, error) {
+	key, err := d.key(ctx, req.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	now := mtime.Now()
+	for id, c := range d.controls {
+		if c.status.State != ControlPending && now.Sub(c.status.Updated) > controlStatusRetention {
+			delete(d.controls, id)
+		}
+	}
+	if c, ok := d.controls[key]; ok && c.status.ProbeID == probeID && c.status.State != ControlTimedOut {
+		return c, false, nil
+	}
+	c := &deliveredControl{
+		status: ControlStatus{
+			ID:      req.ID,
+			ProbeID: probeID,
+			NodeID:  req.NodeID,
+			Control: req.Control,
+			State:   ControlPending,
+			Started: now,
+			Updated: now,
+		},
+		done: make(chan struct{}),
+	}
+	d.controls[key] = c
+	return c, true, nil
+}
+
+func (d *ControlDelivery) attempt(c *deliveredControl, err error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	c.status.Attempts++
+	c.status.Updated = mtime.Now()
+	if err != nil {
+		c.status.Error = err.Error()
+	}
+}
+
+func (d *ControlDelivery) finish(c *deliveredControl, res xfer.Response, err error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	switch {
+	case err != nil:
+		c.status.State = ControlFailed
+		if _, ok := err.(controlTimeout); ok {
+			c.status.State = ControlTimedOut
+		}
+		c.status.Error = err.Error()
+	case res.Error != "":
+		c.status.State = ControlFailed
+		c.status.Error = res.Error
+	case res.RequestID == c.status.ID:
+		c.status.State = ControlAcknowledged
+		c.status.Error = ""
+	default:
+		c.status.State = ControlDelivered
+		c.status.Error = ""
+	}
+	c.status.Updated = mtime.Now()
+	c.res, c.err = res, err
+	close(c.done)
+	controlDeliveries.WithLabelValues(c.status.State).Inc()
+}
+
+// NewDeliveringControlRouter wraps a ControlRouter, retrying controls
+// which were lost as the connection of their probe dropped, until it
+// reconnects, for as long as d says, with the same ID, so probes do them
+// once. Controls for probes which aren't connected to begin with fail
+// straight away. Retries of a control by the UI, by its ID, are answered
+// as the control was.
+func NewDeliveringControlRouter(cr ControlRouter, d *ControlDelivery) ControlRouter {
+	return &deliveringControlRouter{ControlRouter: cr, delivery: d}
+}
+
+type deliveringControlRouter struct {
+	ControlRouter
+	delivery *ControlDelivery
+}
+
+func (r *deliveringControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	if req.ID == "" {
+		req.ID = newControlID()
+	}
+	c, first, err := r.delivery.start(ctx, probeID, req)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	if !first {
+		select {
+		case <-c.done:
+			return c.res, c.err
+		case <-ctx.Done():
+			return xfer.Response{}, ctx.Err()
+		}
+	}
+
+	timeout := r.delivery.Timeout(req.Control)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dropped := false // whether the connection to the probe dropped
+	for {
+		res, err := r.handle(ctx, probeID, req)
+		if err == nil && undelivered(res) {
+			err = fmt.Errorf("%s", res.Error)
+			dropped = true
+		} else if err != nil && !dropped && ctx.Err() == nil {
+			// The probe isn't there to reconnect
+			r.delivery.attempt(c, err)
+			r.delivery.finish(c, xfer.Response{}, err)
+			return xfer.Response{}, err
+		}
+		r.delivery.attempt(c, err)
+		if err == nil {
+			r.delivery.finish(c, res, nil)
+			return res, nil
+		}
+		log.Debugf("Retrying %s on %s of probe %s: %v", req.Control, req.NodeID, probeID, err)
+		select {
+		case <-time.After(controlRetryInterval):
+		case <-ctx.Done():
+			err = controlTimeout{control: req.Control, timeout: timeout, err: err}
+			r.delivery.finish(c, xfer.Response{}, err)
+			return xfer.Response{}, err
+		}
+	}
+}
+
+// handle has the request handled, giving up on it once ctx is done, as
+// probes which dropped their connection may never answer.
+func (r *deliveringControlRouter) handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	type result struct {
+		res xfer.Response
+		err error
+	}
+	results := make(chan result, 1)
+	go func() {
+		res, err := r.ControlRouter.Handle(ctx, probeID, req)
+		results <- result{res, err}
+	}()
+	select {
+	case result := <-results:
+		return result.res, result.err
+	case <-ctx.Done():
+		return xfer.Response{}, ctx.Err()
+	}
+}
+
+// undelivered tells whether the response is the error of the connection
+// to the probe dropping before it answered, rather than the probe's.
+func undelivered(res xfer.Response) bool {
+	if res.Error != rpc.ErrShutdown.Error() && res.Error != io.ErrUnexpectedEOF.Error() {
+		return false
+	}
+	return reflect.DeepEqual(res, xfer.Response{Error: res.Error})
+}
+
+func newControlID() string {
+	return strconv.FormatInt(rand.Int63(), 16)
+}
+
+// RegisterControlDeliveryRoutes registers the routes of the statuses of
+// controls.
+func RegisterControlDeliveryRoutes(router *mux.Router, d *ControlDelivery) {
+	router.Methods("GET").Path("/api/control/status/{id}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			status, ok := d.Status(ctx, mux.Vars(r)["id"])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondWith(w, http.StatusOK, status)
+		}))
+}
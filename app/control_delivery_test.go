@@ -0,0 +1,94 @@
+package app_test
+
+import (
+	"net/rpc"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func TestControlDelivery(t *testing.T) {
+	type userKey struct{}
+	var (
+		alice    = context.WithValue(context.Background(), userKey{}, "alice")
+		bob      = context.WithValue(context.Background(), userKey{}, "bob")
+		local    = app.NewLocalControlRouter()
+		delivery = app.NewControlDelivery(func(ctx context.Context) (string, error) {
+			user, _ := ctx.Value(userKey{}).(string)
+			return user, nil
+		}, 5*time.Second, map[string]time.Duration{"slow": 100 * time.Millisecond})
+		cr    = app.NewDeliveringControlRouter(local, delivery)
+		calls = 0
+	)
+
+	// Controls for probes which aren't connected fail straight away
+	start := time.Now()
+	if _, err := cr.Handle(alice, "probe", xfer.Request{ID: "absent", NodeID: "node", Control: "fast"}); err == nil {
+		t.Fatal("expected control for a probe which isn't connected to fail")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("control for a probe which isn't connected took %s to fail", time.Since(start))
+	}
+	status, ok := delivery.Status(alice, "absent")
+	if !ok || status.State != app.ControlFailed || status.Attempts != 1 {
+		t.Errorf("control status %+v", status)
+	}
+
+	// Controls lost as the probe's connection drops are retried until it
+	// reconnects
+	var id int64
+	id, _ = local.Register(alice, "probe", func(req xfer.Request) xfer.Response {
+		local.Deregister(alice, "probe", id)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			local.Register(alice, "probe", func(req xfer.Request) xfer.Response {
+				calls++
+				return xfer.Response{Value: calls, RequestID: req.ID}
+			})
+		}()
+		return xfer.Response{Error: rpc.ErrShutdown.Error()}
+	})
+	res, err := cr.Handle(alice, "probe", xfer.Request{ID: "first", NodeID: "node", Control: "fast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 1 {
+		t.Errorf("control returned %v", res.Value)
+	}
+	status, ok = delivery.Status(alice, "first")
+	if !ok || status.State != app.ControlAcknowledged || status.Attempts != 2 {
+		t.Errorf("control status %+v", status)
+	}
+
+	// Retries of controls by the UI are answered as the first one was
+	res, err = cr.Handle(alice, "probe", xfer.Request{ID: "first", NodeID: "node", Control: "fast"})
+	if err != nil || res.Value != 1 || calls != 1 {
+		t.Errorf("retried control returned %v, %v after %d calls", res.Value, err, calls)
+	}
+
+	// But only for the user which made them
+	if _, ok := delivery.Status(bob, "first"); ok {
+		t.Error("expected bob not to see alice's control")
+	}
+	res, err = cr.Handle(bob, "probe", xfer.Request{ID: "first", NodeID: "node", Control: "fast"})
+	if err != nil || res.Value != 2 || calls != 2 {
+		t.Errorf("bob's control returned %v, %v after %d calls", res.Value, err, calls)
+	}
+
+	// Controls time out after their own timeout
+	local.Register(alice, "other probe", func(req xfer.Request) xfer.Response {
+		return xfer.Response{Error: rpc.ErrShutdown.Error()}
+	})
+	_, err = cr.Handle(alice, "other probe", xfer.Request{ID: "second", NodeID: "node", Control: "slow"})
+	if err == nil {
+		t.Fatal("expected control to time out")
+	}
+	status, ok = delivery.Status(alice, "second")
+	if !ok || status.State != app.ControlTimedOut {
+		t.Errorf("control status %+v", status)
+	}
+}
@@ -0,0 +1,224 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// jobRetention is how long jobs are kept after they are done.
+const jobRetention = time.Hour
+
+// JobStatus is how far along a job, a long running control, is.
+type JobStatus struct {
+	ID      string         `json:"id"`
+	ProbeID string         `json:"probeID"`
+	NodeID  string         `json:"nodeID"`
+	Control string         `json:"control"`
+	Message string         `json:"message,omitempty"`
+	Percent int            `json:"percent"`
+	Done    bool           `json:"done"`
+	Result  *xfer.Response `json:"result,omitempty"`
+	Started time.Time      `json:"started"`
+	Updated time.Time      `json:"updated"`
+
+	user string
+}
+
+// Jobs tracks the jobs probes run, by the progress they stream over their
+// pipes.
+type Jobs struct {
+	userIDer func(context.Context) (string, error)
+
+	mtx  sync.Mutex
+	jobs map[string]*JobStatus // by user and ID
+}
+
+// NewJobs makes a new Jobs. userIDer identifies the user of a job; users
+// only see the jobs they started.
+func NewJobs(userIDer func(context.Context) (string, error)) *Jobs {
+	return &Jobs{userIDer: userIDer, jobs: map[string]*JobStatus{}}
+}
+
+// Job returns the status of the job with the ID, of the user of ctx.
+func (j *Jobs) Job(ctx context.Context, id string) (JobStatus, bool) {
+	userID, err := j.userIDer(ctx)
+	if err != nil {
+		return JobStatus{}, false
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	job, ok := j.jobs[userID+"/"+id]
+	if !ok {
+		return JobStatus{}, false
+	}
+	return *job, true
+}
+
+// List returns the statuses of the jobs of the user of ctx, newest first.
+func (j *Jobs) List(ctx context.Context) ([]JobStatus, error) {
+	userID, err := j.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	result := []JobStatus{}
+	for _, job := range j.jobs {
+		if job.user == userID {
+			result = append(result, *job)
+		}
+	}
+	sort.Slice(result, func(i, k int) bool { return result[i].Started.After(result[k].Started) })
+	return result, nil
+}
+
+// start adds the job, of the user of ctx, unless it's been started
+// already, returning its key, status and whether it was added.
+func (j *Jobs) start(ctx context.Context, probeID string, req xfer.Request) (string, JobStatus, bool, error) {
+	userID, err := j.userIDer(ctx)
+	if err != nil {
+		return "", JobStatus{}, false, err
+	}
+	key := userID + "/" + req.ID
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	now := mtime.Now()
+	for id, job := range j.jobs {
+		if job.Done && now.Sub(job.Updated) > jobRetention {
+			delete(j.jobs, id)
+		}
+	}
+	if job, ok := j.jobs[key]; ok {
+		return key, *job, false, nil
+	}
+	job := &JobStatus{
+		ID:      req.ID,
+		ProbeID: probeID,
+		NodeID:  req.NodeID,
+		Control: req.Control,
+		Started: now,
+		Updated: now,
+		user:    userID,
+	}
+	j.jobs[key] = job
+	return key, *job, true, nil
+}
+
+func (j *Jobs) update(key string, update xfer.JobUpdate) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	job, ok := j.jobs[key]
+	if !ok || job.Done {
+		return
+	}
+	if update.Message != "" {
+		job.Message = update.Message
+	}
+	job.Percent = update.Percent
+	job.Result = update.Result
+	job.Done = update.Result != nil
+	job.Updated = mtime.Now()
+}
+
+// follow updates the job of the key with the progress its pipe streams,
+// until the pipe is closed.
+func (j *Jobs) follow(ctx context.Context, pr PipeRouter, key, pipeID string) {
+	defer pr.Delete(ctx, pipeID)
+	_, end, err := pr.Get(ctx, pipeID, UIEnd)
+	if err != nil {
+		log.Errorf("Error following job %s: %v", key, err)
+		j.update(key, xfer.JobUpdate{Result: &xfer.Response{Error: err.Error()}})
+		return
+	}
+	defer pr.Release(ctx, pipeID, UIEnd)
+
+	decoder := json.NewDecoder(end)
+	for {
+		var update xfer.JobUpdate
+		if err := decoder.Decode(&update); err != nil {
+			// Jobs end with their result, unless the probe went away
+			j.update(key, xfer.JobUpdate{Result: &xfer.Response{
+				Error: fmt.Sprintf("job ended without a result: %v", err),
+			}})
+			return
+		}
+		j.update(key, update)
+		if update.Result != nil {
+			return
+		}
+	}
+}
+
+// jobContext keeps the values of a request's context, such as who made
+// it, but not its cancellation, as jobs outlive the requests starting them.
+type jobContext struct {
+	context.Context
+}
+
+func (jobContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (jobContext) Done() <-chan struct{}       { return nil }
+func (jobContext) Err() error                  { return nil }
+
+// NewJobControlRouter wraps a ControlRouter, following the jobs controls
+// start in probes, rather than having the UI open their pipes, and
+// answering them with their status.
+func NewJobControlRouter(cr ControlRouter, pr PipeRouter, jobs *Jobs) ControlRouter {
+	return &jobControlRouter{ControlRouter: cr, pipes: pr, jobs: jobs}
+}
+
+type jobControlRouter struct {
+	ControlRouter
+	pipes PipeRouter
+	jobs  *Jobs
+}
+
+func (r *jobControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := r.ControlRouter.Handle(ctx, probeID, req)
+	if err != nil || !res.Job || res.Pipe == "" {
+		return res, err
+	}
+	if req.ID == "" {
+		req.ID = newControlID()
+	}
+	key, job, started, err := r.jobs.start(ctx, probeID, req)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	if started {
+		go r.jobs.follow(jobContext{ctx}, r.pipes, key, res.Pipe)
+	}
+	return xfer.Response{Job: true, Value: job}, nil
+}
+
+// RegisterJobRoutes registers the routes of the statuses of jobs.
+func RegisterJobRoutes(router *mux.Router, jobs *Jobs) {
+	router.Methods("GET").Path("/api/control/jobs").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			list, err := jobs.List(ctx)
+			if err != nil {
+				respondWith(w, http.StatusUnauthorized, err)
+				return
+			}
+			respondWith(w, http.StatusOK, list)
+		}))
+	router.Methods("GET").Path("/api/control/jobs/{id}").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			job, ok := jobs.Job(ctx, mux.Vars(r)["id"])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondWith(w, http.StatusOK, job)
+		}))
+}
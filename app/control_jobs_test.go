@@ -0,0 +1,70 @@
+package app_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestJobControlRouter(t *testing.T) {
+	type userKey struct{}
+	var (
+		ctx   = context.WithValue(context.Background(), userKey{}, "alice")
+		bob   = context.WithValue(context.Background(), userKey{}, "bob")
+		local = app.NewLocalControlRouter()
+		pr    = app.NewLocalPipeRouter()
+		jobs  = app.NewJobs(func(ctx context.Context) (string, error) {
+			user, _ := ctx.Value(userKey{}).(string)
+			return user, nil
+		})
+		cr = app.NewJobControlRouter(local, pr, jobs)
+	)
+	defer pr.Stop()
+
+	local.Register(ctx, "probe", func(req xfer.Request) xfer.Response {
+		_, end, err := pr.Get(ctx, "pipe", app.ProbeEnd)
+		if err != nil {
+			return xfer.ResponseError(err)
+		}
+		go func() {
+			encoder := json.NewEncoder(end)
+			encoder.Encode(xfer.JobUpdate{Message: "halfway", Percent: 50})
+			encoder.Encode(xfer.JobUpdate{Percent: 100, Result: &xfer.Response{Value: "done"}})
+			pr.Release(ctx, "pipe", app.ProbeEnd)
+		}()
+		return xfer.Response{Pipe: "pipe", Job: true}
+	})
+
+	res, err := cr.Handle(ctx, "probe", xfer.Request{ID: "job", NodeID: "node", Control: "drain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Job || res.Pipe != "" {
+		t.Fatalf("job returned %+v", res)
+	}
+	test.Poll(t, time.Second, true, func() interface{} {
+		job, _ := jobs.Job(ctx, "job")
+		return job.Done
+	})
+	job, _ := jobs.Job(ctx, "job")
+	if job.Percent != 100 || job.Message != "halfway" || job.Result == nil || job.Result.Value != "done" {
+		t.Errorf("job status %+v", job)
+	}
+	if list, err := jobs.List(ctx); err != nil || len(list) != 1 || list[0].ID != "job" {
+		t.Errorf("jobs %+v, %v", list, err)
+	}
+
+	// Users only see the jobs they started
+	if _, ok := jobs.Job(bob, "job"); ok {
+		t.Error("expected bob not to see alice's job")
+	}
+	if list, err := jobs.List(bob); err != nil || len(list) != 0 {
+		t.Errorf("bob's jobs %+v, %v", list, err)
+	}
+}
@@ -3,8 +3,10 @@ package app
 import (
 	"fmt"
 	"math/rand"
+	"reflect"
 	"sync"
 
+	log "github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/common/xfer"
@@ -67,3 +69,32 @@ func (l *localControlRouter) Deregister(_ context.Context, probeID string, id in
 	}
 	return nil
 }
+
+// NewVerifyingControlRouter wraps a ControlRouter, only passing on the
+// responses of probes signed by a key verifier has, and answering the
+// request they were sent.
+func NewVerifyingControlRouter(cr ControlRouter, verifier *xfer.Verifier) ControlRouter {
+	return &verifyingControlRouter{ControlRouter: cr, verifier: verifier}
+}
+
+type verifyingControlRouter struct {
+	ControlRouter
+	verifier *xfer.Verifier
+}
+
+func (v *verifyingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := v.ControlRouter.Handle(ctx, probeID, req)
+	if err != nil {
+		return res, err
+	}
+	// Errors reaching the probe come from this side, unsigned
+	if res.Error != "" && reflect.DeepEqual(res, xfer.Response{Error: res.Error}) {
+		return res, nil
+	}
+	verified, err := v.verifier.VerifyResponse(req, res)
+	if err != nil {
+		log.Warnf("Rejected response of probe %s to %s on %s: %v", probeID, req.Control, req.NodeID, err)
+		return xfer.Response{}, err
+	}
+	return verified, nil
+}
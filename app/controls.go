@@ -46,11 +46,23 @@ func handleControl(cr ControlRouter) CtxHandlerFunc {
 			}
 		}
 
+		// The UI retries controls with the same ID
+		id := r.Header.Get(xfer.ScopeControlIDHeader)
+		if id == "" {
+			id = newControlID()
+		}
+		w.Header().Set(xfer.ScopeControlIDHeader, id)
+
 		result, err := cr.Handle(ctx, probeID, xfer.Request{
+			ID:          id,
 			NodeID:      nodeID,
 			Control:     control,
 			ControlArgs: controlArgs,
 		})
+		if _, ok := err.(controlTimeout); ok {
+			respondWith(w, http.StatusGatewayTimeout, err.Error())
+			return
+		}
 		if err != nil {
 			respondWith(w, http.StatusBadRequest, err.Error())
 			return
@@ -1,6 +1,7 @@
 package app_test
 
 import (
+	"crypto/rand"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/ugorji/go/codec"
+	"golang.org/x/crypto/ed25519"
 
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/common/xfer"
@@ -77,3 +79,53 @@ func TestControl(t *testing.T) {
 		t.Fatalf("'%s' != 'foo'", response.Value)
 	}
 }
+
+func TestSignedControl(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := xfer.NewSigner(key)
+	router := mux.NewRouter()
+	verifier := xfer.NewVerifier(key.Public().(ed25519.PublicKey))
+	app.RegisterControlRoutes(router, app.NewVerifyingControlRouter(app.NewLocalControlRouter(), verifier))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	control := func(probeConfig appclient.ProbeConfig) (int, xfer.Response) {
+		controlHandler := xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+			return xfer.Response{Value: "foo"}
+		})
+		url, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := appclient.NewAppClient(probeConfig, url.Host, *url, controlHandler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.ControlConnection()
+		defer client.Stop()
+		time.Sleep(100 * time.Millisecond)
+
+		resp, err := http.Post(server.URL+"/api/control/"+probeConfig.ProbeID+"/nodeid/control", "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var response xfer.Response
+		if resp.StatusCode == http.StatusOK {
+			if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, response
+	}
+
+	if status, response := control(appclient.ProbeConfig{ProbeID: "signed", Signer: signer}); status != http.StatusOK || response.Value != "foo" {
+		t.Fatalf("Expected the signed response, got %d %v", status, response)
+	}
+	if status, _ := control(appclient.ProbeConfig{ProbeID: "unsigned"}); status != http.StatusBadRequest {
+		t.Fatalf("Expected the unsigned response to be rejected, got %d", status)
+	}
+}
@@ -0,0 +1,570 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The subset of GraphQL served by /api/graphql: queries of fields, with
+// aliases, arguments and variables. Fragments, directives, mutations,
+// subscriptions and introspection aren't supported.
+
+// gqlField is a field selected in a query.
+type gqlField struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []gqlField
+}
+
+// key is what the field is called in the response.
+func (f gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// errUnknownField is returned by gqlObjects asked for fields they don't
+// have.
+var errUnknownField = errors.New("unknown field")
+
+// A gqlObject is a value of an object type, whose fields are resolved as
+// they are selected.
+type gqlObject interface {
+	typeName() string
+	// field resolves the field name, given its arguments, to a scalar,
+	// a gqlObject, a []gqlObject, or nil.
+	field(name string, args map[string]interface{}) (interface{}, error)
+}
+
+// gqlFields is a gqlObject whose fields are known up front, and take no
+// arguments.
+type gqlFields struct {
+	name   string
+	fields map[string]interface{}
+}
+
+func (o gqlFields) typeName() string { return o.name }
+
+func (o gqlFields) field(name string, _ map[string]interface{}) (interface{}, error) {
+	value, ok := o.fields[name]
+	if !ok {
+		return nil, errUnknownField
+	}
+	return value, nil
+}
+
+// gqlResult is an object in a response, its fields in the order they were
+// selected.
+type gqlResult []gqlResultField
+
+type gqlResultField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler, keeping the fields in order.
+func (r gqlResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlExecute resolves the selections of obj.
+func gqlExecute(obj gqlObject, selections []gqlField) (gqlResult, error) {
+	result := make(gqlResult, 0, len(selections))
+	for _, f := range selections {
+		var value interface{}
+		if f.name == "__typename" {
+			value = obj.typeName()
+		} else {
+			resolved, err := obj.field(f.name, f.args)
+			if err == errUnknownField {
+				return nil, fmt.Errorf("cannot query field %q on type %q", f.name, obj.typeName())
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.key(), err)
+			}
+			if value, err = gqlComplete(f, resolved); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, gqlResultField{key: f.key(), value: value})
+	}
+	return result, nil
+}
+
+func gqlComplete(f gqlField, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch value := value.(type) {
+	case gqlObject:
+		if len(f.selections) == 0 {
+			return nil, fmt.Errorf("field %q of type %q must have a selection of subfields", f.name, value.typeName())
+		}
+		return gqlExecute(value, f.selections)
+	case []gqlObject:
+		list := make([]interface{}, 0, len(value))
+		for _, obj := range value {
+			completed, err := gqlComplete(f, obj)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, completed)
+		}
+		return list, nil
+	default:
+		if len(f.selections) > 0 {
+			return nil, fmt.Errorf("field %q has no subfields", f.name)
+		}
+		return value, nil
+	}
+}
+
+// gqlParse parses the query, returning the selections of the operation
+// named operationName, or of its only one. Variables are substituted into
+// arguments as they are parsed.
+func gqlParse(query, operationName string, variables map[string]interface{}) ([]gqlField, error) {
+	p := &gqlParser{lexer: gqlLexer{src: query}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var (
+		selections []gqlField
+		found      int
+	)
+	for p.tok.kind != gqlEOF {
+		name, fields, err := p.operation(variables)
+		if err != nil {
+			return nil, err
+		}
+		if operationName == "" || name == operationName {
+			selections = fields
+			found++
+		}
+	}
+	switch {
+	case found == 0 && operationName != "":
+		return nil, fmt.Errorf("no operation named %q", operationName)
+	case found == 0:
+		return nil, errors.New("no operation")
+	case found > 1:
+		return nil, errors.New("operationName is required with more than one operation")
+	}
+	return selections, nil
+}
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunctuator
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+}
+
+func (t gqlToken) String() string {
+	if t.kind == gqlEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.value)
+}
+
+type gqlLexer struct {
+	src string
+	pos int
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	// Skip whitespace, commas and comments
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+		} else {
+			break
+		}
+	}
+	if l.pos >= len(l.src) {
+		return gqlToken{kind: gqlEOF}, nil
+	}
+
+	start, c := l.pos, l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return gqlToken{kind: gqlPunctuator, value: "..."}, nil
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		l.pos++
+		return gqlToken{kind: gqlPunctuator, value: string(c)}, nil
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return gqlToken{kind: gqlName, value: l.src[start:l.pos]}, nil
+	case c == '-' || isDigit(c):
+		kind := gqlInt
+		for l.pos++; l.pos < len(l.src); l.pos++ {
+			c := l.src[l.pos]
+			if c == '.' || c == 'e' || c == 'E' || ((c == '-' || c == '+') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E')) {
+				kind = gqlFloat
+			} else if !isDigit(c) {
+				break
+			}
+		}
+		return gqlToken{kind: kind, value: l.src[start:l.pos]}, nil
+	case c == '"':
+		return l.string()
+	}
+	return gqlToken{}, fmt.Errorf("unexpected character %q at %d", c, l.pos)
+}
+
+func (l *gqlLexer) string() (gqlToken, error) {
+	var buf bytes.Buffer
+	for l.pos++; l.pos < len(l.src); {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return gqlToken{kind: gqlString, value: buf.String()}, nil
+		case c == '\n':
+			return gqlToken{}, errors.New("unterminated string")
+		case c == '\\' && l.pos+1 < len(l.src):
+			escaped := l.src[l.pos+1]
+			l.pos += 2
+			switch escaped {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					return gqlToken{}, errors.New("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return gqlToken{}, errors.New("invalid unicode escape")
+				}
+				buf.WriteRune(rune(r))
+				l.pos += 4
+			case '"', '\\', '/':
+				buf.WriteByte(escaped)
+			default:
+				return gqlToken{}, fmt.Errorf("invalid escape \\%c", escaped)
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			buf.WriteRune(r)
+			l.pos += size
+		}
+	}
+	return gqlToken{}, errors.New("unterminated string")
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+type gqlParser struct {
+	lexer gqlLexer
+	tok   gqlToken
+	vars  map[string]interface{} // of the operation being parsed
+}
+
+func (p *gqlParser) next() error {
+	tok, err := p.lexer.next()
+	p.tok = tok
+	return err
+}
+
+func (p *gqlParser) peek(kind gqlTokenKind, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *gqlParser) expect(kind gqlTokenKind, value string) error {
+	if !p.peek(kind, value) {
+		return fmt.Errorf("expected %q, found %s", value, p.tok)
+	}
+	return p.next()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.tok.kind != gqlName {
+		return "", fmt.Errorf("expected a name, found %s", p.tok)
+	}
+	name := p.tok.value
+	return name, p.next()
+}
+
+func (p *gqlParser) operation(variables map[string]interface{}) (string, []gqlField, error) {
+	var name string
+	p.vars = map[string]interface{}{}
+	if p.tok.kind == gqlName {
+		switch p.tok.value {
+		case "query":
+		case "mutation", "subscription":
+			return "", nil, fmt.Errorf("%ss are not supported", p.tok.value)
+		case "fragment":
+			return "", nil, errors.New("fragments are not supported")
+		default:
+			return "", nil, fmt.Errorf("unexpected %s", p.tok)
+		}
+		if err := p.next(); err != nil {
+			return "", nil, err
+		}
+		if p.tok.kind == gqlName {
+			name = p.tok.value
+			if err := p.next(); err != nil {
+				return "", nil, err
+			}
+		}
+		if p.peek(gqlPunctuator, "(") {
+			if err := p.variableDefinitions(variables); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	selections, err := p.selectionSet()
+	return name, selections, err
+}
+
+func (p *gqlParser) variableDefinitions(variables map[string]interface{}) error {
+	if err := p.expect(gqlPunctuator, "("); err != nil {
+		return err
+	}
+	for !p.peek(gqlPunctuator, ")") {
+		if err := p.expect(gqlPunctuator, "$"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(gqlPunctuator, ":"); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		var value interface{}
+		if p.peek(gqlPunctuator, "=") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if value, err = p.value(); err != nil {
+				return err
+			}
+		}
+		if given, ok := variables[name]; ok {
+			value = given
+		}
+		p.vars[name] = value
+	}
+	return p.next()
+}
+
+// typeRef skips over a type. Values are checked by the fields they are
+// given to instead.
+func (p *gqlParser) typeRef() error {
+	if p.peek(gqlPunctuator, "[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect(gqlPunctuator, "]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek(gqlPunctuator, "!") {
+		return p.next()
+	}
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlField, error) {
+	if err := p.expect(gqlPunctuator, "{"); err != nil {
+		return nil, err
+	}
+	var fields []gqlField
+	for !p.peek(gqlPunctuator, "}") {
+		switch {
+		case p.peek(gqlPunctuator, "..."):
+			return nil, errors.New("fragments are not supported")
+		case p.peek(gqlPunctuator, "@"):
+			return nil, errors.New("directives are not supported")
+		}
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty selection")
+	}
+	return fields, p.next()
+}
+
+func (p *gqlParser) field() (gqlField, error) {
+	var field gqlField
+	name, err := p.name()
+	if err != nil {
+		return field, err
+	}
+	if p.peek(gqlPunctuator, ":") {
+		if err := p.next(); err != nil {
+			return field, err
+		}
+		field.alias = name
+		if name, err = p.name(); err != nil {
+			return field, err
+		}
+	}
+	field.name = name
+	if p.peek(gqlPunctuator, "(") {
+		if field.args, err = p.arguments(); err != nil {
+			return field, err
+		}
+	}
+	if p.peek(gqlPunctuator, "@") {
+		return field, errors.New("directives are not supported")
+	}
+	if p.peek(gqlPunctuator, "{") {
+		if field.selections, err = p.selectionSet(); err != nil {
+			return field, err
+		}
+	}
+	return field, nil
+}
+
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	args, err := p.object("(", ")")
+	if err == nil && len(args) == 0 {
+		err = errors.New("empty arguments")
+	}
+	return args, err
+}
+
+func (p *gqlParser) object(open, close string) (map[string]interface{}, error) {
+	if err := p.expect(gqlPunctuator, open); err != nil {
+		return nil, err
+	}
+	object := map[string]interface{}{}
+	for !p.peek(gqlPunctuator, close) {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(gqlPunctuator, ":"); err != nil {
+			return nil, err
+		}
+		if object[name], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	return object, p.next()
+}
+
+func (p *gqlParser) value() (interface{}, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == gqlPunctuator && tok.value == "$":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		value, ok := p.vars[name]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", name)
+		}
+		return value, nil
+	case tok.kind == gqlPunctuator && tok.value == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek(gqlPunctuator, "]") {
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, p.next()
+	case tok.kind == gqlPunctuator && tok.value == "{":
+		return p.object("{", "}")
+	case tok.kind == gqlInt:
+		value, err := strconv.Atoi(tok.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %s", tok)
+		}
+		return value, p.next()
+	case tok.kind == gqlFloat:
+		value, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s", tok)
+		}
+		return value, p.next()
+	case tok.kind == gqlString:
+		return tok.value, p.next()
+	case tok.kind == gqlName:
+		var value interface{}
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+		default:
+			value = tok.value // enum values are taken as strings
+		}
+		return value, p.next()
+	}
+	return nil, fmt.Errorf("expected a value, found %s", tok)
+}
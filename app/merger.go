@@ -24,7 +24,7 @@ func (dumbMerger) Merge(reports []report.Report) report.Report {
 	rpt := report.MakeReport()
 	id := murmur3.New64()
 	for _, r := range reports {
-		rpt = rpt.Merge(r)
+		rpt.UnsafeMerge(r)
 		id.Write([]byte(r.ID))
 	}
 	rpt.ID = fmt.Sprintf("%x", id.Sum64())
@@ -48,15 +48,28 @@ func (smartMerger) Merge(reports []report.Report) report.Report {
 	case 1:
 		return reports[0]
 	}
-	c := make(chan report.Report, l)
+	// Reports merged here are merged into in place; the reports given
+	// are copied, once, to be merged into.
+	type merged struct {
+		report.Report
+		owned bool
+	}
+	c := make(chan merged, l)
 	for _, r := range reports {
-		c <- r
+		c <- merged{Report: r}
 	}
 	for ; l > 1; l-- {
 		left, right := <-c, <-c
 		go func() {
-			c <- left.Merge(right)
+			if !left.owned && right.owned {
+				left, right = right, left
+			}
+			if !left.owned {
+				left = merged{Report: left.Copy(), owned: true}
+			}
+			left.UnsafeMerge(right.Report)
+			c <- left
 		}()
 	}
-	return <-c
+	return (<-c).Report
 }
@@ -42,6 +42,13 @@ func TestMerger(t *testing.T) {
 		if have := merger.Merge(reports); !reflect.DeepEqual(have, want) {
 			t.Errorf("Bad merge: %s", test.Diff(have, want))
 		}
+
+		// The reports merged are not merged into
+		for _, r := range reports {
+			if len(r.Endpoint.Nodes) != 1 {
+				t.Errorf("Merged into report: %v", r.Endpoint.Nodes)
+			}
+		}
 	}
 }
 
@@ -0,0 +1,307 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/remoteread"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// historyPoints is about how many samples backfill adds to a metric.
+	historyPoints = 240
+	// minHistoryStep is the finest resolution of backfilled samples, that
+	// of a typical Prometheus scrape interval.
+	minHistoryStep = 15 * time.Second
+	// historyTimeout bounds how long node details wait on Prometheus.
+	historyTimeout = 5 * time.Second
+	// maxHistoryPoints bounds how many samples of a metric may be asked for.
+	maxHistoryPoints = 1000
+)
+
+// MetricsRange is the history of metrics asked for: from Start to End, a
+// sample every Step. The zero MetricsRange asks for the default history of
+// the MetricsHistory, up to now.
+type MetricsRange struct {
+	Start, End time.Time
+	Step       time.Duration
+}
+
+// IsZero tells whether the range is the default.
+func (r MetricsRange) IsZero() bool {
+	return r == MetricsRange{}
+}
+
+// historyStep is the step for about historyPoints samples over window.
+func historyStep(window time.Duration) time.Duration {
+	step := window / historyPoints
+	if step < minHistoryStep {
+		step = minHistoryStep
+	}
+	return step
+}
+
+// parseMetricsRange parses the history of metrics asked for with node
+// details: start and end, as RFC3339 times or durations before now, end
+// being now if not given, and step, the resolution, as a duration, enough
+// for about historyPoints samples if not given.
+func parseMetricsRange(values url.Values, now time.Time) (MetricsRange, error) {
+	var r MetricsRange
+	parseTime := func(key string) (time.Time, error) {
+		s := values.Get(key)
+		if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+			return now.Add(-d), nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s: %q: expected a time or a duration before now", key, s)
+		}
+		return t, nil
+	}
+	if values.Get("start") == "" {
+		if values.Get("end") != "" || values.Get("step") != "" {
+			return r, fmt.Errorf("start is needed with end and step")
+		}
+		return r, nil
+	}
+	var err error
+	if r.Start, err = parseTime("start"); err != nil {
+		return r, err
+	}
+	r.End = now
+	if values.Get("end") != "" {
+		if r.End, err = parseTime("end"); err != nil {
+			return r, err
+		}
+	}
+	if !r.Start.Before(r.End) {
+		return r, fmt.Errorf("start must be before end")
+	}
+	r.Step = historyStep(r.End.Sub(r.Start))
+	if s := values.Get("step"); s != "" {
+		if r.Step, err = time.ParseDuration(s); err != nil || r.Step <= 0 {
+			return r, fmt.Errorf("invalid step: %q", s)
+		}
+	}
+	if points := r.End.Sub(r.Start) / r.Step; points > maxHistoryPoints {
+		return r, fmt.Errorf("too many samples asked for: %d, of at most %d; use a longer step", points, maxHistoryPoints)
+	}
+	return r, nil
+}
+
+// MetricsHistory fills in the history of the metrics of a node, from before
+// the reports the app holds, over the range asked for.
+type MetricsHistory interface {
+	Backfill(ctx context.Context, n report.Node, node *detailed.Node, r MetricsRange) error
+}
+
+// PrometheusHistory is a MetricsHistory reading the series the metrics are
+// made of from a Prometheus, with its remote read API.
+type PrometheusHistory struct {
+	client *remoteread.Client
+	window time.Duration
+	step   time.Duration
+
+	mtx   sync.Mutex
+	cache map[detailed.HistoryQuery]cachedHistory
+}
+
+type cachedHistory struct {
+	samples []report.Sample
+	expires time.Time
+}
+
+// NewPrometheusHistory makes a new PrometheusHistory, reading a window of
+// history from the remote read endpoint at url.
+func NewPrometheusHistory(url string, window time.Duration) *PrometheusHistory {
+	return &PrometheusHistory{
+		client: remoteread.NewClient(url, historyTimeout),
+		window: window,
+		step:   historyStep(window),
+		cache:  map[detailed.HistoryQuery]cachedHistory{},
+	}
+}
+
+// Backfill implements MetricsHistory. Only the history of the default
+// range is cached.
+func (h *PrometheusHistory) Backfill(ctx context.Context, n report.Node, node *detailed.Node, r MetricsRange) error {
+	var (
+		now     = mtime.Now()
+		rows    = map[int]detailed.HistoryQuery{}
+		history = map[detailed.HistoryQuery][]report.Sample{}
+		missing []detailed.HistoryQuery
+		cached  = r.IsZero()
+	)
+	if cached {
+		r = MetricsRange{Start: now.Add(-h.window), End: now, Step: h.step}
+	}
+	h.mtx.Lock()
+	for q, c := range h.cache {
+		if !now.Before(c.expires) {
+			delete(h.cache, q)
+		}
+	}
+	for i, row := range node.Metrics {
+		q, ok := detailed.MetricHistoryQuery(node.NodeSummary, n, row.ID)
+		if !ok || row.Metric == nil {
+			continue
+		}
+		rows[i] = q
+		if _, ok := history[q]; ok {
+			continue
+		}
+		if c, ok := h.cache[q]; ok && cached {
+			history[q] = c.samples
+			continue
+		}
+		history[q] = nil
+		missing = append(missing, q)
+	}
+	h.mtx.Unlock()
+
+	if len(missing) > 0 {
+		start, end := r.Start, r.End
+		queries := make([]*remoteread.Query, 0, len(missing))
+		for _, q := range missing {
+			matchers, err := remoteread.ParseSelector(q.Series)
+			if err != nil {
+				return err
+			}
+			queries = append(queries, &remoteread.Query{
+				StartTimestampMs: timestampMs(start),
+				EndTimestampMs:   timestampMs(end),
+				Matchers:         matchers,
+			})
+		}
+		results, err := h.client.Read(ctx, queries...)
+		if err != nil {
+			return err
+		}
+		h.mtx.Lock()
+		for i, q := range missing {
+			history[q] = combineHistory(q, results[i].Timeseries, start, end, r.Step)
+			if cached {
+				h.cache[q] = cachedHistory{samples: history[q], expires: now.Add(h.step)}
+			}
+		}
+		h.mtx.Unlock()
+	}
+
+	for i, q := range rows {
+		node.Metrics[i].Metric = backfillMetric(*node.Metrics[i].Metric, history[q], r.End)
+	}
+	return nil
+}
+
+// backfillMetric returns a copy of m, up to end, with the samples of history
+// from before its first sample. The metric is shared with the report, so
+// it's copied.
+func backfillMetric(m report.Metric, history []report.Sample, end time.Time) *report.Metric {
+	current := m.Samples
+	for len(current) > 0 && current[len(current)-1].Timestamp.After(end) {
+		current = current[:len(current)-1]
+	}
+	var older []report.Sample
+	for _, s := range history {
+		if s.Timestamp.After(end) || (len(current) > 0 && !s.Timestamp.Before(current[0].Timestamp)) {
+			break
+		}
+		older = append(older, s)
+	}
+	if len(older) == 0 && len(current) == len(m.Samples) {
+		return &m
+	}
+	samples := make([]report.Sample, 0, len(older)+len(current))
+	samples = append(append(samples, older...), current...)
+	backfilled := report.MakeMetric(samples)
+	if m.Len() > 0 && m.Max > backfilled.Max {
+		// Keep any fixed maximum, e.g. the total memory of the host
+		backfilled = backfilled.WithMax(m.Max)
+	}
+	return &backfilled
+}
+
+// combineHistory turns the series selected by q into samples of the metric,
+// one per step between start and end, in the way the Prometheus query of the
+// metric would.
+func combineHistory(q detailed.HistoryQuery, series []*remoteread.TimeSeries, start, end time.Time, step time.Duration) []report.Sample {
+	buckets := int(end.Sub(start)/step) + 1
+	var (
+		sums   = make([]float64, buckets)
+		counts = make([]int, buckets)
+	)
+	bucket := func(ms int64) int {
+		return int(fromTimestampMs(ms).Sub(start) / step)
+	}
+	for _, ts := range series {
+		var (
+			values  = make([]float64, buckets)
+			weights = make([]float64, buckets)
+		)
+		for i, s := range ts.Samples {
+			b := bucket(s.Timestamp)
+			if b < 0 || b >= buckets {
+				continue
+			}
+			if !q.Rate {
+				values[b] += s.Value
+				weights[b]++
+				continue
+			}
+			if i == 0 {
+				continue
+			}
+			prev := ts.Samples[i-1]
+			if s.Timestamp <= prev.Timestamp {
+				continue
+			}
+			increase := s.Value - prev.Value
+			if increase < 0 {
+				// The counter was reset
+				increase = s.Value
+			}
+			values[b] += increase
+			weights[b] += float64(s.Timestamp-prev.Timestamp) / 1000
+		}
+		for b := range values {
+			if weights[b] > 0 {
+				sums[b] += values[b] / weights[b]
+				counts[b]++
+			}
+		}
+	}
+
+	var samples []report.Sample
+	for b := range sums {
+		if counts[b] == 0 {
+			continue
+		}
+		value := sums[b]
+		if q.Mean {
+			value /= float64(counts[b])
+		}
+		if q.Scale != 0 {
+			value *= q.Scale
+		}
+		samples = append(samples, report.Sample{
+			Timestamp: start.Add(time.Duration(b+1) * step),
+			Value:     value,
+		})
+	}
+	return samples
+}
+
+func timestampMs(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromTimestampMs(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
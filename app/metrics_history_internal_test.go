@@ -0,0 +1,173 @@
+package app
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/remoteread"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestCombineHistory(t *testing.T) {
+	var (
+		start = time.Unix(1000, 0)
+		end   = start.Add(time.Minute)
+		step  = 30 * time.Second
+		at    = func(d time.Duration) int64 { return timestampMs(start.Add(d)) }
+	)
+	series := []*remoteread.TimeSeries{
+		{Samples: []*remoteread.Sample{
+			{Timestamp: at(0), Value: 0},
+			{Timestamp: at(10 * time.Second), Value: 5},
+			{Timestamp: at(20 * time.Second), Value: 10},
+			{Timestamp: at(40 * time.Second), Value: 20},
+		}},
+		{Samples: []*remoteread.Sample{
+			{Timestamp: at(10 * time.Second), Value: 100},
+			// The counter was reset
+			{Timestamp: at(40 * time.Second), Value: 30},
+		}},
+	}
+
+	have := combineHistory(detailed.HistoryQuery{Rate: true, Mean: true, Scale: 100}, series, start, end, step)
+	want := []report.Sample{
+		{Timestamp: start.Add(30 * time.Second), Value: 50},
+		{Timestamp: start.Add(60 * time.Second), Value: 75},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+
+	have = combineHistory(detailed.HistoryQuery{}, series, start, end, step)
+	want = []report.Sample{
+		{Timestamp: start.Add(30 * time.Second), Value: 105},
+		{Timestamp: start.Add(60 * time.Second), Value: 50},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
+
+func TestBackfillMetric(t *testing.T) {
+	var (
+		t1 = time.Unix(1000, 0)
+		t2 = t1.Add(time.Minute)
+		t3 = t2.Add(time.Minute)
+	)
+	m := report.MakeMetric([]report.Sample{{Timestamp: t3, Value: 2}}).WithMax(10)
+	have := backfillMetric(m, []report.Sample{{Timestamp: t1, Value: 1}, {Timestamp: t2, Value: 3}, {Timestamp: t3, Value: 4}}, t3)
+	want := report.MakeMetric([]report.Sample{{Timestamp: t1, Value: 1}, {Timestamp: t2, Value: 3}, {Timestamp: t3, Value: 2}}).WithMax(10)
+	if !reflect.DeepEqual(want, *have) {
+		t.Errorf("Expected %v, got %v", want, *have)
+	}
+	if m.Len() != 1 {
+		t.Errorf("Expected the original metric to be left alone")
+	}
+
+	// Samples after the end are left out
+	have = backfillMetric(m, []report.Sample{{Timestamp: t1, Value: 1}, {Timestamp: t2, Value: 3}, {Timestamp: t3, Value: 4}}, t2)
+	want = report.MakeMetric([]report.Sample{{Timestamp: t1, Value: 1}, {Timestamp: t2, Value: 3}}).WithMax(10)
+	if !reflect.DeepEqual(want, *have) {
+		t.Errorf("Expected %v, got %v", want, *have)
+	}
+}
+
+func TestParseMetricsRange(t *testing.T) {
+	now := time.Unix(100000, 0)
+	for _, tc := range []struct {
+		query string
+		want  MetricsRange
+		err   bool
+	}{
+		{query: "", want: MetricsRange{}},
+		{query: "start=1h", want: MetricsRange{Start: now.Add(-time.Hour), End: now, Step: 15 * time.Second}},
+		{query: "start=24h&end=12h", want: MetricsRange{Start: now.Add(-24 * time.Hour), End: now.Add(-12 * time.Hour), Step: 3 * time.Minute}},
+		{query: "start=1970-01-02T03:00:00Z&end=1970-01-02T03:46:40Z&step=1m", want: MetricsRange{Start: time.Unix(97200, 0).UTC(), End: now.UTC(), Step: time.Minute}},
+		{query: "end=1h", err: true},
+		{query: "start=yesterday", err: true},
+		{query: "start=1h&end=2h", err: true},
+		{query: "start=1h&step=-1s", err: true},
+		{query: "start=24h&step=1s", err: true},
+	} {
+		values, _ := url.ParseQuery(tc.query)
+		have, err := parseMetricsRange(values, now)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tc.query, have)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+		} else if !reflect.DeepEqual(tc.want, have) {
+			t.Errorf("%s: expected %v, got %v", tc.query, tc.want, have)
+		}
+	}
+}
+
+// historicReporter has a report of a host with the CPU usage of the minute
+// of each time.
+type historicReporter struct {
+	Reporter
+	reports *int
+}
+
+func (r historicReporter) Report(_ context.Context, t time.Time) (report.Report, error) {
+	*r.reports++
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host1").WithTopology(report.Host).WithMetric("cpu",
+		report.MakeSingletonMetric(t.Add(-time.Second), float64(t.Minute()))))
+	return rpt, nil
+}
+
+func TestReportHistory(t *testing.T) {
+	var (
+		end   = time.Unix(3600, 0)
+		start = end.Add(-time.Hour)
+		now   = report.MakeSingletonMetric(end, 100)
+		n     = report.MakeNode("host1").WithTopology(report.Host)
+		node  = detailed.Node{NodeSummary: detailed.NodeSummary{Metrics: []report.MetricRow{{ID: "cpu", Metric: &now}}}}
+		reads = 0
+	)
+	h := NewReportHistory(func(context.Context) (string, error) { return "user", nil }, historicReporter{reports: &reads})
+	if err := h.Backfill(context.Background(), n, &node, MetricsRange{}); err != nil || node.Metrics[0].Metric != &now {
+		t.Fatalf("Expected no default history, got %v: %v", node.Metrics[0].Metric, err)
+	}
+	if err := h.Backfill(context.Background(), n, &node, MetricsRange{Start: start, End: end, Step: 20 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	want := report.MakeMetric([]report.Sample{
+		{Timestamp: start.Add(20 * time.Minute), Value: 20},
+		{Timestamp: start.Add(40 * time.Minute), Value: 40},
+		{Timestamp: end, Value: 100},
+	})
+	if have := *node.Metrics[0].Metric; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if reads != 3 {
+		t.Errorf("Expected 3 reports to be read, got %d", reads)
+	}
+
+	// Reports are read once, however many nodes are backfilled
+	node.Metrics[0].Metric = &now
+	if err := h.Backfill(context.Background(), n, &node, MetricsRange{Start: start, End: end, Step: 20 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 3 {
+		t.Errorf("Expected the reports to be cached, got %d reads", reads)
+	}
+
+	// However fine the step, only so many reports are read
+	reads = 0
+	if err := h.Backfill(context.Background(), n, &node, MetricsRange{Start: start.Add(-24 * time.Hour), End: end, Step: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if reads > reportHistoryPoints {
+		t.Errorf("Expected at most %d reports to be read, got %d", reportHistoryPoints, reads)
+	}
+}
@@ -112,10 +112,17 @@ type awsCollector struct {
 	s3        *S3Store
 	tableName string
 	merger    app.Merger
+	merged    *mergeCache
 	inProcess inProcessStore
 	memcache  *MemcacheClient
 	window    time.Duration
 
+	*natsShortcuts
+}
+
+// natsShortcuts are the shortcut reports of collectors, through NATS.
+type natsShortcuts struct {
+	userIDer    UserIDer
 	nats        *nats.Conn
 	waitersLock sync.Mutex
 	waiters     map[watchKey]*nats.Subscription
@@ -138,13 +145,9 @@ type watchKey struct {
 // NewAWSCollector the elastic reaper of souls
 // https://github.com/aws/aws-sdk-go/wiki/common-examples
 func NewAWSCollector(config AWSCollectorConfig) (AWSCollector, error) {
-	var nc *nats.Conn
-	if config.NatsHost != "" {
-		var err error
-		nc, err = nats.Connect(config.NatsHost)
-		if err != nil {
-			return nil, err
-		}
+	shortcuts, err := newNatsShortcuts(config.UserIDer, config.NatsHost)
+	if err != nil {
+		return nil, err
 	}
 
 	// (window * report rate) * number of hosts per user * number of users
@@ -155,11 +158,30 @@ func NewAWSCollector(config AWSCollectorConfig) (AWSCollector, error) {
 		userIDer:  config.UserIDer,
 		tableName: config.DynamoTable,
 		merger:    app.NewSmartMerger(),
+		merged:    newMergeCache(mergeCacheSize, config.Window),
 		inProcess: newInProcessStore(reportCacheSize, config.Window),
 		memcache:  config.MemcacheClient,
 		window:    config.Window,
-		nats:      nc,
-		waiters:   map[watchKey]*nats.Subscription{},
+
+		natsShortcuts: shortcuts,
+	}, nil
+}
+
+// newNatsShortcuts makes the shortcuts of a collector through the NATS
+// host, if any.
+func newNatsShortcuts(userIDer UserIDer, natsHost string) (*natsShortcuts, error) {
+	var nc *nats.Conn
+	if natsHost != "" {
+		var err error
+		nc, err = nats.Connect(natsHost)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &natsShortcuts{
+		userIDer: userIDer,
+		nats:     nc,
+		waiters:  map[watchKey]*nats.Subscription{},
 	}, nil
 }
 
@@ -277,22 +299,23 @@ func (c *awsCollector) getReportKeys(ctx context.Context, timestamp time.Time) (
 	if err != nil {
 		return nil, err
 	}
+	instance := shardInstance(ctx, userid)
 
 	// Queries will only every span 2 rows max.
 	var reportKeys []string
 	if rowStart != rowEnd {
-		reportKeys1, err := c.reportKeysInRange(ctx, userid, rowStart, start, end)
+		reportKeys1, err := c.reportKeysInRange(ctx, instance, rowStart, start, end)
 		if err != nil {
 			return nil, err
 		}
-		reportKeys2, err := c.reportKeysInRange(ctx, userid, rowEnd, start, end)
+		reportKeys2, err := c.reportKeysInRange(ctx, instance, rowEnd, start, end)
 		if err != nil {
 			return nil, err
 		}
 		reportKeys = append(reportKeys, reportKeys1...)
 		reportKeys = append(reportKeys, reportKeys2...)
 	} else {
-		if reportKeys, err = c.reportKeysInRange(ctx, userid, rowEnd, start, end); err != nil {
+		if reportKeys, err = c.reportKeysInRange(ctx, instance, rowEnd, start, end); err != nil {
 			return nil, err
 		}
 	}
@@ -301,13 +324,19 @@ func (c *awsCollector) getReportKeys(ctx context.Context, timestamp time.Time) (
 }
 
 func (c *awsCollector) getReports(ctx context.Context, reportKeys []string) ([]report.Report, error) {
-	missing := reportKeys
-
-	stores := []ReportStore{c.inProcess}
+	stores := []ReportStore{}
 	if c.memcache != nil {
 		stores = append(stores, c.memcache)
 	}
-	stores = append(stores, c.s3)
+	return getReports(ctx, c.inProcess, append(stores, c.s3), reportKeys)
+}
+
+// getReports fetches the reports of the keys from the in-process store, or
+// failing that, the first of the stores to have them, keeping them in the
+// in-process store.
+func getReports(ctx context.Context, inProcess inProcessStore, stores []ReportStore, reportKeys []string) ([]report.Report, error) {
+	missing := reportKeys
+	stores = append([]ReportStore{inProcess}, stores...)
 
 	var reports []report.Report
 	for _, store := range stores {
@@ -321,7 +350,7 @@ func (c *awsCollector) getReports(ctx context.Context, reportKeys []string) ([]r
 		}
 		for key, report := range found {
 			report = report.Upgrade()
-			c.inProcess.StoreReport(key, report)
+			inProcess.StoreReport(key, report)
 			reports = append(reports, report)
 		}
 		if len(missing) == 0 {
@@ -340,13 +369,14 @@ func (c *awsCollector) Report(ctx context.Context, timestamp time.Time) (report.
 	if err != nil {
 		return report.MakeReport(), err
 	}
-	log.Debugf("Fetching %d reports to %v", len(reportKeys), timestamp)
-	reports, err := c.getReports(ctx, reportKeys)
+	userid, err := c.userIDer(ctx)
 	if err != nil {
 		return report.MakeReport(), err
 	}
-
-	return c.merger.Merge(reports), nil
+	return c.merged.merge(userid, reportKeys, c.merger, func() ([]report.Report, error) {
+		log.Debugf("Fetching %d reports to %v", len(reportKeys), timestamp)
+		return c.getReports(ctx, reportKeys)
+	})
 }
 
 func (c *awsCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
@@ -422,7 +452,7 @@ func (c *awsCollector) Add(ctx context.Context, rep report.Report, buf []byte) e
 	}
 
 	// first, put the report on s3
-	rowKey, colKey := calculateDynamoKeys(userid, time.Now())
+	rowKey, colKey := calculateDynamoKeys(shardInstance(ctx, userid), app.ReportTime(ctx))
 	reportKey, err := calculateReportKey(rowKey, colKey)
 	if err != nil {
 		return err
@@ -433,6 +463,7 @@ func (c *awsCollector) Add(ctx context.Context, rep report.Report, buf []byte) e
 		return err
 	}
 	reportSizeHistogram.Observe(float64(reportSize))
+	c.merged.invalidate(userid)
 
 	// third, put it in memcache
 	if c.memcache != nil {
@@ -464,18 +495,26 @@ func (c *awsCollector) Add(ctx context.Context, rep report.Report, buf []byte) e
 		return err
 	}
 
-	if rep.Shortcut && c.nats != nil {
-		err := c.nats.Publish(userid, []byte(reportKey))
-		natsRequests.WithLabelValues("Publish", instrument.ErrorCode(err)).Add(1)
-		if err != nil {
-			log.Errorf("Error sending shortcut report: %v", err)
-		}
+	if rep.Shortcut {
+		c.publish(userid, reportKey)
 	}
 
 	return nil
 }
 
-func (c *awsCollector) WaitOn(ctx context.Context, waiter chan struct{}) {
+// publish publishes the shortcut report of the key to the user's waiters.
+func (c *natsShortcuts) publish(userid, reportKey string) {
+	if c.nats == nil {
+		return
+	}
+	err := c.nats.Publish(userid, []byte(reportKey))
+	natsRequests.WithLabelValues("Publish", instrument.ErrorCode(err)).Add(1)
+	if err != nil {
+		log.Errorf("Error sending shortcut report: %v", err)
+	}
+}
+
+func (c *natsShortcuts) WaitOn(ctx context.Context, waiter chan struct{}) {
 	userid, err := c.userIDer(ctx)
 	if err != nil {
 		log.Errorf("Error getting user id in WaitOn: %v", err)
@@ -516,7 +555,7 @@ func (c *awsCollector) WaitOn(ctx context.Context, waiter chan struct{}) {
 	}()
 }
 
-func (c *awsCollector) UnWait(ctx context.Context, waiter chan struct{}) {
+func (c *natsShortcuts) UnWait(ctx context.Context, waiter chan struct{}) {
 	userid, err := c.userIDer(ctx)
 	if err != nil {
 		log.Errorf("Error getting user id in WaitOn: %v", err)
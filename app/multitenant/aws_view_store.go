@@ -0,0 +1,221 @@
+package multitenant
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/instrument"
+	"github.com/weaveworks/scope/app"
+)
+
+const (
+	userField = "user"
+	idField   = "id"
+	viewField = "view"
+)
+
+// DynamoDBViewStore is an app.ViewStore keeping the views of each user in
+// a DynamoDB table, keyed by user and view ID.
+type DynamoDBViewStore struct {
+	userIDer  UserIDer
+	db        *dynamodb.DynamoDB
+	tableName string
+}
+
+// NewDynamoDBViewStore makes a new DynamoDBViewStore.
+func NewDynamoDBViewStore(config *aws.Config, tableName string, userIDer UserIDer) *DynamoDBViewStore {
+	return &DynamoDBViewStore{
+		userIDer:  userIDer,
+		db:        dynamodb.New(session.New(config)),
+		tableName: tableName,
+	}
+}
+
+// CreateTables creates the table for views, if it doesn't exist.
+func (s *DynamoDBViewStore) CreateTables() error {
+	resp, err := s.db.ListTables(&dynamodb.ListTablesInput{})
+	if err != nil {
+		return err
+	}
+	for _, name := range resp.TableNames {
+		if *name == s.tableName {
+			return nil
+		}
+	}
+
+	log.Infof("Creating table %s", s.tableName)
+	_, err = s.db.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String(s.tableName),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(userField),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String(idField),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(userField),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String(idField),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	})
+	return err
+}
+
+func (s *DynamoDBViewStore) key(ctx context.Context, id string) (map[string]*dynamodb.AttributeValue, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*dynamodb.AttributeValue{
+		userField: {S: aws.String(userID)},
+		idField:   {S: aws.String(id)},
+	}, nil
+}
+
+func consumedCapacity(method string, capacity *dynamodb.ConsumedCapacity) {
+	if capacity != nil && capacity.CapacityUnits != nil {
+		dynamoConsumedCapacity.WithLabelValues(method).Add(*capacity.CapacityUnits)
+	}
+}
+
+// List implements app.ViewStore.
+func (s *DynamoDBViewStore) List(ctx context.Context) ([]app.View, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	views := []app.View{}
+	err = instrument.TimeRequestHistogram(ctx, "DynamoDB.Query", dynamoRequestDuration, func(_ context.Context) error {
+		return s.db.QueryPages(&dynamodb.QueryInput{
+			TableName: aws.String(s.tableName),
+			KeyConditions: map[string]*dynamodb.Condition{
+				userField: {
+					AttributeValueList: []*dynamodb.AttributeValue{{S: aws.String(userID)}},
+					ComparisonOperator: aws.String("EQ"),
+				},
+			},
+			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		}, func(page *dynamodb.QueryOutput, _ bool) bool {
+			consumedCapacity("Query", page.ConsumedCapacity)
+			for _, item := range page.Items {
+				view, err := decodeView(item)
+				if err != nil {
+					log.Errorf("Error decoding view: %v", err)
+					continue
+				}
+				views = append(views, view)
+			}
+			return true
+		})
+	})
+	return views, err
+}
+
+// Get implements app.ViewStore.
+func (s *DynamoDBViewStore) Get(ctx context.Context, id string) (app.View, error) {
+	key, err := s.key(ctx, id)
+	if err != nil {
+		return app.View{}, err
+	}
+	var resp *dynamodb.GetItemOutput
+	err = instrument.TimeRequestHistogram(ctx, "DynamoDB.GetItem", dynamoRequestDuration, func(_ context.Context) error {
+		var err error
+		resp, err = s.db.GetItem(&dynamodb.GetItemInput{
+			TableName:              aws.String(s.tableName),
+			Key:                    key,
+			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		})
+		return err
+	})
+	if err != nil {
+		return app.View{}, err
+	}
+	consumedCapacity("GetItem", resp.ConsumedCapacity)
+	if len(resp.Item) == 0 {
+		return app.View{}, app.ErrViewNotFound
+	}
+	return decodeView(resp.Item)
+}
+
+func decodeView(item map[string]*dynamodb.AttributeValue) (app.View, error) {
+	var view app.View
+	if value := item[viewField]; value != nil && value.S != nil {
+		return view, json.Unmarshal([]byte(*value.S), &view)
+	}
+	return view, app.ErrViewNotFound
+}
+
+// Put implements app.ViewStore.
+func (s *DynamoDBViewStore) Put(ctx context.Context, view app.View) error {
+	item, err := s.key(ctx, view.ID)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+	item[viewField] = &dynamodb.AttributeValue{S: aws.String(string(buf))}
+	dynamoValueSize.WithLabelValues("PutItem").Add(float64(len(buf)))
+
+	var resp *dynamodb.PutItemOutput
+	err = instrument.TimeRequestHistogram(ctx, "DynamoDB.PutItem", dynamoRequestDuration, func(_ context.Context) error {
+		var err error
+		resp, err = s.db.PutItem(&dynamodb.PutItemInput{
+			TableName:              aws.String(s.tableName),
+			Item:                   item,
+			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	consumedCapacity("PutItem", resp.ConsumedCapacity)
+	return nil
+}
+
+// Delete implements app.ViewStore.
+func (s *DynamoDBViewStore) Delete(ctx context.Context, id string) error {
+	key, err := s.key(ctx, id)
+	if err != nil {
+		return err
+	}
+	var resp *dynamodb.DeleteItemOutput
+	err = instrument.TimeRequestHistogram(ctx, "DynamoDB.DeleteItem", dynamoRequestDuration, func(_ context.Context) error {
+		var err error
+		resp, err = s.db.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName:              aws.String(s.tableName),
+			Key:                    key,
+			ReturnValues:           aws.String(dynamodb.ReturnValueAllOld),
+			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	consumedCapacity("DeleteItem", resp.ConsumedCapacity)
+	if len(resp.Attributes) == 0 {
+		return app.ErrViewNotFound
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package multitenant
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/instrument"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+// DefaultCassandraTTL is how long reports are kept in Cassandra, unless
+// configured otherwise.
+const DefaultCassandraTTL = 24 * time.Hour
+
+var (
+	cassandraRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "scope",
+		Name:      "cassandra_request_duration_seconds",
+		Help:      "Time in seconds spent doing Cassandra requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status_code"})
+)
+
+func init() {
+	prometheus.MustRegister(cassandraRequestDuration)
+}
+
+// CassandraCollectorConfig has everything we need to make a Cassandra
+// collector.
+type CassandraCollectorConfig struct {
+	UserIDer    UserIDer
+	Hosts       []string
+	Keyspace    string
+	Table       string
+	Consistency gocql.Consistency
+	// TTL is how long reports are kept, DefaultCassandraTTL if 0.
+	TTL            time.Duration
+	NatsHost       string
+	MemcacheClient *MemcacheClient
+	Window         time.Duration
+}
+
+// cassandraCollector is a Collector keeping reports in Cassandra, or
+// anything speaking its protocol, as Scylla. Reports are rows of a
+// partition per user and hour, as in the AWS collector's DynamoDB table,
+// but hold the reports themselves, so there's no S3 to run too. Cassandra
+// expires them by their TTL.
+type cassandraCollector struct {
+	userIDer    UserIDer
+	session     *gocql.Session
+	table       string
+	consistency gocql.Consistency
+	ttl         time.Duration
+	merger      app.Merger
+	merged      *mergeCache
+	inProcess   inProcessStore
+	memcache    *MemcacheClient
+	window      time.Duration
+
+	*natsShortcuts
+}
+
+// NewCassandraCollector makes a Collector keeping reports in Cassandra, for
+// users not on AWS, reading and writing them at the consistency level
+// configured.
+func NewCassandraCollector(config CassandraCollectorConfig) (AWSCollector, error) {
+	shortcuts, err := newNatsShortcuts(config.UserIDer, config.NatsHost)
+	if err != nil {
+		return nil, err
+	}
+	cluster := gocql.NewCluster(config.Hosts...)
+	cluster.Keyspace = config.Keyspace
+	cluster.Consistency = config.Consistency
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = DefaultCassandraTTL
+	}
+	// (window * report rate) * number of hosts per user * number of users
+	reportCacheSize := (int(config.Window.Seconds()) / 3) * 10 * 5
+	return &cassandraCollector{
+		userIDer:    config.UserIDer,
+		session:     session,
+		table:       config.Table,
+		consistency: config.Consistency,
+		ttl:         ttl,
+		merger:      app.NewSmartMerger(),
+		merged:      newMergeCache(mergeCacheSize, config.Window),
+		inProcess:   newInProcessStore(reportCacheSize, config.Window),
+		memcache:    config.MemcacheClient,
+		window:      config.Window,
+
+		natsShortcuts: shortcuts,
+	}, nil
+}
+
+// CreateTables creates the table of reports in the keyspace, which must
+// exist, as only its operators know how it ought to be replicated.
+func (c *cassandraCollector) CreateTables() error {
+	log.Infof("Creating table %s", c.table)
+	return c.session.Query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		%s text,
+		%s bigint,
+		%s blob,
+		PRIMARY KEY (%s, %s)
+	) WITH CLUSTERING ORDER BY (%s DESC)
+	  AND default_time_to_live = %d`,
+		c.table, hourField, tsField, reportField, hourField, tsField, tsField, int64(c.ttl.Seconds()),
+	)).Exec()
+}
+
+func (c *cassandraCollector) query(ctx context.Context, stmt string, values ...interface{}) *gocql.Query {
+	return c.session.Query(stmt, values...).WithContext(ctx).Consistency(c.consistency)
+}
+
+// cassandraReportKey is the key of the report in the row at the timestamp,
+// in nanoseconds, as it's cached by.
+func cassandraReportKey(rowKey string, ts int64) string {
+	return fmt.Sprintf("%s/%d", rowKey, ts)
+}
+
+// parseCassandraReportKey returns the row and timestamp of the report of
+// the key.
+func parseCassandraReportKey(key string) (string, int64, error) {
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid report key %q", key)
+	}
+	ts, err := strconv.ParseInt(key[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid report key %q: %v", key, err)
+	}
+	return key[:i], ts, nil
+}
+
+// reportKeysInRange returns the keys of the reports in the row in the range.
+func (c *cassandraCollector) reportKeysInRange(ctx context.Context, userid string, row int64, start, end time.Time) ([]string, error) {
+	rowKey := fmt.Sprintf("%s-%s", userid, strconv.FormatInt(row, 10))
+	var result []string
+	err := instrument.TimeRequestHistogram(ctx, "Cassandra.Select", cassandraRequestDuration, func(ctx context.Context) error {
+		iter := c.query(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s = ? AND %s > ? AND %s <= ?`, tsField, c.table, hourField, tsField, tsField),
+			rowKey, start.UnixNano(), end.UnixNano()).Iter()
+		var ts int64
+		for iter.Scan(&ts) {
+			result = append(result, cassandraReportKey(rowKey, ts))
+		}
+		return iter.Close()
+	})
+	return result, err
+}
+
+// getReportKeys returns the keys of the reports in the window ending at
+// timestamp.
+func (c *cassandraCollector) getReportKeys(ctx context.Context, timestamp time.Time) ([]string, error) {
+	var (
+		end      = timestamp
+		start    = end.Add(-c.window)
+		rowStart = start.UnixNano() / time.Hour.Nanoseconds()
+		rowEnd   = end.UnixNano() / time.Hour.Nanoseconds()
+	)
+
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reportKeys []string
+	for row := rowStart; row <= rowEnd; row++ {
+		rowReportKeys, err := c.reportKeysInRange(ctx, shardInstance(ctx, userid), row, start, end)
+		if err != nil {
+			return nil, err
+		}
+		reportKeys = append(reportKeys, rowReportKeys...)
+	}
+	return reportKeys, nil
+}
+
+// FetchReports fetches the reports of the keys, a query per row.
+func (c *cassandraCollector) FetchReports(ctx context.Context, keys []string) (map[string]report.Report, []string, error) {
+	rows := map[string][]int64{}
+	for _, key := range keys {
+		rowKey, ts, err := parseCassandraReportKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows[rowKey] = append(rows[rowKey], ts)
+	}
+
+	reports := map[string]report.Report{}
+	for rowKey, tss := range rows {
+		err := instrument.TimeRequestHistogram(ctx, "Cassandra.Select", cassandraRequestDuration, func(ctx context.Context) error {
+			iter := c.query(ctx, fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s = ? AND %s IN ?`, tsField, reportField, c.table, hourField, tsField),
+				rowKey, tss).Iter()
+			var (
+				ts  int64
+				buf []byte
+			)
+			for iter.Scan(&ts, &buf) {
+				rpt, err := report.MakeFromBinary(bytes.NewReader(buf))
+				if err != nil {
+					iter.Close()
+					return err
+				}
+				reports[cassandraReportKey(rowKey, ts)] = *rpt
+			}
+			return iter.Close()
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Reports may have expired since their keys were read
+	var missing []string
+	for _, key := range keys {
+		if _, ok := reports[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return reports, missing, nil
+}
+
+func (c *cassandraCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	reportKeys, err := c.getReportKeys(ctx, timestamp)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	return c.merged.merge(userid, reportKeys, c.merger, func() ([]report.Report, error) {
+		log.Debugf("Fetching %d reports to %v", len(reportKeys), timestamp)
+		stores := []ReportStore{}
+		if c.memcache != nil {
+			stores = append(stores, c.memcache)
+		}
+		return getReports(ctx, c.inProcess, append(stores, c), reportKeys)
+	})
+}
+
+func (c *cassandraCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	reportKeys, err := c.getReportKeys(ctx, timestamp)
+	return len(reportKeys) > 0, err
+}
+
+func (c *cassandraCollector) HasHistoricReports() bool {
+	return true
+}
+
+func (c *cassandraCollector) Add(ctx context.Context, rep report.Report, buf []byte) error {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := app.ReportTime(ctx)
+	rowKey := fmt.Sprintf("%s-%s", shardInstance(ctx, userid), strconv.FormatInt(now.UnixNano()/time.Hour.Nanoseconds(), 10))
+	reportKey := cassandraReportKey(rowKey, now.UnixNano())
+	err = instrument.TimeRequestHistogram(ctx, "Cassandra.Insert", cassandraRequestDuration, func(ctx context.Context) error {
+		return c.query(ctx, fmt.Sprintf(`INSERT INTO %s (%s, %s, %s) VALUES (?, ?, ?) USING TTL ?`, c.table, hourField, tsField, reportField),
+			rowKey, now.UnixNano(), buf, int64(c.ttl.Seconds())).Exec()
+	})
+	if err != nil {
+		return err
+	}
+	reportSizeHistogram.Observe(float64(len(buf)))
+	c.merged.invalidate(userid)
+
+	if c.memcache != nil {
+		if _, err := c.memcache.StoreReportBytes(ctx, reportKey, buf); err != nil {
+			// Just an optimization, as in the AWS collector
+			log.Warningf("Could not store %v in memcache: %v", reportKey, err)
+		}
+	}
+
+	if rep.Shortcut {
+		c.publish(userid, reportKey)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package multitenant
+
+import (
+	"testing"
+)
+
+func TestCassandraReportKey(t *testing.T) {
+	key := cassandraReportKey("user/with/slashes-412345", 1484856000000000000)
+	rowKey, ts, err := parseCassandraReportKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowKey != "user/with/slashes-412345" || ts != 1484856000000000000 {
+		t.Errorf("got %q, %d", rowKey, ts)
+	}
+
+	for _, key := range []string{"", "row", "row/", "row/ts"} {
+		if _, _, err := parseCassandraReportKey(key); err == nil {
+			t.Errorf("expected an error parsing %q", key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package multitenant
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+// mergeCacheSize is how many merged reports collectors cache.
+const mergeCacheSize = 100
+
+var (
+	mergeCacheRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "merge_cache_requests_total",
+		Help:      "Total count of merged reports requested from the merge cache.",
+	})
+	mergeCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "merge_cache_hits_total",
+		Help:      "Total count of merged reports found in the merge cache.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(mergeCacheRequests)
+	prometheus.MustRegister(mergeCacheHits)
+}
+
+// mergeCache caches merged reports by the set of the keys of the reports
+// merged, so clients reading the same window don't fetch and merge the
+// same reports again. Merged reports of a user are dropped as reports of
+// theirs are added, as they would not be read again.
+type mergeCache struct {
+	cache gcache.Cache
+
+	mtx    sync.Mutex
+	byUser map[string]map[string]struct{} // keys of the merged reports of each user
+}
+
+func newMergeCache(size int, expiration time.Duration) *mergeCache {
+	return &mergeCache{
+		cache:  gcache.New(size).LRU().Expiration(expiration).Build(),
+		byUser: map[string]map[string]struct{}{},
+	}
+}
+
+// reportSetKey is the key of the merge of the reports of the keys, in any
+// order.
+func reportSetKey(keys []string) string {
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, key := range sorted {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// merge returns the merge of the reports of the keys, cached, or fetched
+// and merged by the merger.
+func (c *mergeCache) merge(userid string, keys []string, merger app.Merger, fetch func() ([]report.Report, error)) (report.Report, error) {
+	key := reportSetKey(keys)
+	mergeCacheRequests.Inc()
+	if value, err := c.cache.Get(key); err == nil {
+		mergeCacheHits.Inc()
+		return value.(report.Report), nil
+	}
+
+	reports, err := fetch()
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	merged := merger.Merge(reports)
+	c.cache.Set(key, merged)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.byUser[userid] == nil {
+		c.byUser[userid] = map[string]struct{}{}
+	}
+	c.byUser[userid][key] = struct{}{}
+	return merged, nil
+}
+
+// invalidate drops the merged reports of the user.
+func (c *mergeCache) invalidate(userid string) {
+	c.mtx.Lock()
+	keys := c.byUser[userid]
+	delete(c.byUser, userid)
+	c.mtx.Unlock()
+	for key := range keys {
+		c.cache.Remove(key)
+	}
+}
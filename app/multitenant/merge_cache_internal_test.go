@@ -0,0 +1,54 @@
+package multitenant
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestMergeCache(t *testing.T) {
+	var (
+		cache   = newMergeCache(10, time.Minute)
+		merger  = app.NewSmartMerger()
+		fetches = 0
+	)
+	merge := func(userid string, keys ...string) report.Report {
+		rpt, err := cache.merge(userid, keys, merger, func() ([]report.Report, error) {
+			fetches++
+			var reports []report.Report
+			for _, key := range keys {
+				rpt := report.MakeReport()
+				rpt.Host.AddNode(report.MakeNode(key))
+				reports = append(reports, rpt)
+			}
+			return reports, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rpt
+	}
+
+	if rpt := merge("user", "a", "b"); len(rpt.Host.Nodes) != 2 || fetches != 1 {
+		t.Fatalf("expected the 2 reports merged in a fetch, got %v in %d", rpt.Host.Nodes, fetches)
+	}
+	// The same reports, in any order, are merged once
+	if rpt := merge("user", "b", "a"); len(rpt.Host.Nodes) != 2 || fetches != 1 {
+		t.Errorf("expected the cached merge, got %v in %d fetches", rpt.Host.Nodes, fetches)
+	}
+	// Other reports aren't
+	if merge("user", "a", "b", "c"); fetches != 2 {
+		t.Errorf("expected another fetch for another set of reports, got %d", fetches)
+	}
+	// Reports added drop the merges of the user
+	cache.invalidate("other")
+	if merge("user", "a", "b"); fetches != 2 {
+		t.Errorf("expected the cached merge after invalidating another user, got %d fetches", fetches)
+	}
+	cache.invalidate("user")
+	if merge("user", "a", "b"); fetches != 3 {
+		t.Errorf("expected a fetch after invalidating, got %d", fetches)
+	}
+}
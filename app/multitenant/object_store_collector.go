@@ -0,0 +1,189 @@
+package multitenant
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+// DefaultObjectBucket is how long a time bucket of the reports in an object
+// store is, unless configured otherwise.
+const DefaultObjectBucket = time.Minute
+
+// ObjectStore is a store of reports, as gzipped msgpack, by key, which can
+// list its keys by prefix: an S3 bucket, or a GCS one through its
+// S3-compatible API.
+type ObjectStore interface {
+	ReportStore
+	StoreReportBytes(ctx context.Context, key string, buf []byte) (int, error)
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ObjectStoreCollectorConfig has everything we need to make an object store
+// collector.
+type ObjectStoreCollectorConfig struct {
+	UserIDer       UserIDer
+	Store          ObjectStore
+	Prefix         string
+	MemcacheClient *MemcacheClient
+	Window         time.Duration
+	// Bucket is how long a time bucket of reports is, DefaultObjectBucket
+	// if 0.
+	Bucket time.Duration
+}
+
+// objectStoreCollector is a Collector keeping reports in an object store
+// alone, without a database to index them, laid out in time buckets:
+//
+//	<prefix><user ID>/<bucket>/<timestamp>-<random>
+//
+// where bucket is the number of the time bucket since the epoch, and
+// timestamp in nanoseconds since the epoch. Reports of a window are found
+// by listing the buckets it spans, so lifecycle rules can expire reports by
+// age cheaply.
+type objectStoreCollector struct {
+	userIDer  UserIDer
+	store     ObjectStore
+	prefix    string
+	merger    app.Merger
+	merged    *mergeCache
+	inProcess inProcessStore
+	memcache  *MemcacheClient
+	window    time.Duration
+	bucket    time.Duration
+}
+
+// NewObjectStoreCollector makes a Collector keeping reports in an object
+// store, which is cheaper than DynamoDB for long-term deployments, at the
+// cost of listing keys to read reports. Shortcut reports aren't published
+// to other apps.
+func NewObjectStoreCollector(config ObjectStoreCollectorConfig) app.Collector {
+	bucket := config.Bucket
+	if bucket <= 0 {
+		bucket = DefaultObjectBucket
+	}
+	// (window * report rate) * number of hosts per user * number of users
+	reportCacheSize := (int(config.Window.Seconds()) / 3) * 10 * 5
+	return &objectStoreCollector{
+		userIDer:  config.UserIDer,
+		store:     config.Store,
+		prefix:    config.Prefix,
+		merger:    app.NewSmartMerger(),
+		merged:    newMergeCache(mergeCacheSize, config.Window),
+		inProcess: newInProcessStore(reportCacheSize, config.Window),
+		memcache:  config.MemcacheClient,
+		window:    config.Window,
+		bucket:    bucket,
+	}
+}
+
+func (c *objectStoreCollector) bucketPrefix(userid string, bucket int64) string {
+	return fmt.Sprintf("%s%s/%d/", c.prefix, url.PathEscape(userid), bucket)
+}
+
+func (c *objectStoreCollector) reportKey(userid string, t time.Time) string {
+	bucket := t.UnixNano() / c.bucket.Nanoseconds()
+	return fmt.Sprintf("%s%d-%x", c.bucketPrefix(userid, bucket), t.UnixNano(), rand.Int63())
+}
+
+// reportTime returns the time of the report of a key.
+func reportTime(key string) (time.Time, bool) {
+	name := key[strings.LastIndex(key, "/")+1:]
+	if i := strings.Index(name, "-"); i >= 0 {
+		name = name[:i]
+	}
+	ns, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// getReportKeys returns the keys of the reports in the window ending at
+// timestamp, listing the buckets it spans.
+func (c *objectStoreCollector) getReportKeys(ctx context.Context, timestamp time.Time) ([]string, error) {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		end   = timestamp
+		start = end.Add(-c.window)
+		keys  []string
+	)
+	for bucket := start.UnixNano() / c.bucket.Nanoseconds(); bucket <= end.UnixNano()/c.bucket.Nanoseconds(); bucket++ {
+		bucketKeys, err := c.store.ListKeys(ctx, c.bucketPrefix(shardInstance(ctx, userid), bucket))
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range bucketKeys {
+			if t, ok := reportTime(key); ok && t.After(start) && !t.After(end) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (c *objectStoreCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	reportKeys, err := c.getReportKeys(ctx, timestamp)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	return c.merged.merge(userid, reportKeys, c.merger, func() ([]report.Report, error) {
+		log.Debugf("Fetching %d reports to %v", len(reportKeys), timestamp)
+		stores := []ReportStore{}
+		if c.memcache != nil {
+			stores = append(stores, c.memcache)
+		}
+		return getReports(ctx, c.inProcess, append(stores, c.store), reportKeys)
+	})
+}
+
+func (c *objectStoreCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	reportKeys, err := c.getReportKeys(ctx, timestamp)
+	return len(reportKeys) > 0, err
+}
+
+func (c *objectStoreCollector) HasHistoricReports() bool {
+	return true
+}
+
+func (c *objectStoreCollector) Add(ctx context.Context, rep report.Report, buf []byte) error {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	reportKey := c.reportKey(shardInstance(ctx, userid), app.ReportTime(ctx))
+	reportSize, err := c.store.StoreReportBytes(ctx, reportKey, buf)
+	if err != nil {
+		return err
+	}
+	reportSizeHistogram.Observe(float64(reportSize))
+	c.merged.invalidate(userid)
+
+	if c.memcache != nil {
+		if _, err := c.memcache.StoreReportBytes(ctx, reportKey, buf); err != nil {
+			// Just an optimization, as in the AWS collector
+			log.Warningf("Could not store %v in memcache: %v", reportKey, err)
+		}
+	}
+	return nil
+}
+
+func (c *objectStoreCollector) WaitOn(context.Context, chan struct{}) {}
+
+func (c *objectStoreCollector) UnWait(context.Context, chan struct{}) {}
@@ -0,0 +1,105 @@
+package multitenant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/report"
+)
+
+type mockObjectStore struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *mockObjectStore) FetchReports(_ context.Context, keys []string) (map[string]report.Report, []string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	reports := map[string]report.Report{}
+	for _, key := range keys {
+		rpt, err := report.MakeFromBinary(bytes.NewReader(s.objects[key]))
+		if err != nil {
+			return nil, nil, err
+		}
+		reports[key] = *rpt
+	}
+	return reports, nil, nil
+}
+
+func (s *mockObjectStore) StoreReportBytes(_ context.Context, key string, buf []byte) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.objects[key] = buf
+	return len(buf), nil
+}
+
+func (s *mockObjectStore) ListKeys(_ context.Context, prefix string) ([]string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestObjectStoreCollector(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = &mockObjectStore{objects: map[string][]byte{}}
+		c     = NewObjectStoreCollector(ObjectStoreCollectorConfig{
+			UserIDer: NoopUserIDer,
+			Store:    store,
+			Prefix:   "reports/",
+			Window:   15 * time.Second,
+		})
+	)
+	for _, id := range []string{"a", "b"} {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode(id))
+		var buf bytes.Buffer
+		if err := rpt.WriteBinary(&buf, gzip.DefaultCompression); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add(ctx, rpt, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key := range store.objects {
+		if !strings.HasPrefix(key, "reports/") {
+			t.Errorf("report stored outside of the prefix: %q", key)
+		}
+		if _, ok := reportTime(key); !ok {
+			t.Errorf("no time in key %q", key)
+		}
+	}
+
+	rpt, err := c.Report(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Host.Nodes) != 2 {
+		t.Errorf("expected the 2 reports merged, got %v", rpt.Host.Nodes)
+	}
+	if has, err := c.HasReports(ctx, time.Now()); err != nil || !has {
+		t.Errorf("expected reports, got %v, %v", has, err)
+	}
+
+	// Reports after the timestamp, or before the window, aren't read
+	if has, err := c.HasReports(ctx, time.Now().Add(-time.Minute)); err != nil || has {
+		t.Errorf("expected no reports a minute ago, got %v, %v", has, err)
+	}
+	if has, err := c.HasReports(ctx, time.Now().Add(time.Minute)); err != nil || has {
+		t.Errorf("expected no reports in a minute, got %v, %v", has, err)
+	}
+}
@@ -0,0 +1,374 @@
+package multitenant
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/instrument"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// DefaultPostgresRetention is how long reports are kept in Postgres,
+	// unless configured otherwise.
+	DefaultPostgresRetention = 7 * 24 * time.Hour
+
+	// postgresPartition is how long a partition of the reports table
+	// holds reports of, and the layout of the dates naming them.
+	postgresPartition       = 24 * time.Hour
+	postgresPartitionLayout = "20060102"
+)
+
+var (
+	postgresRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "scope",
+		Name:      "postgres_request_duration_seconds",
+		Help:      "Time in seconds spent doing Postgres requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status_code"})
+)
+
+func init() {
+	prometheus.MustRegister(postgresRequestDuration)
+}
+
+// PostgresCollectorConfig has everything we need to make a Postgres
+// collector.
+type PostgresCollectorConfig struct {
+	UserIDer UserIDer
+	URL      string
+	Table    string
+	// Retention is how long reports are kept, DefaultPostgresRetention if
+	// 0.
+	Retention time.Duration
+	NatsHost  string
+	Window    time.Duration
+}
+
+// postgresCollector is a Collector keeping reports in Postgres, as the
+// gzipped msgpack probes publish, by instance (the user ID, and shard, if
+// sharded) and timestamp. The table is partitioned by day, so reading a
+// window only scans the partitions it spans, and expiring reports is
+// dropping the partitions past the retention. Timestamps are kept to the
+// microsecond, as Postgres does.
+type postgresCollector struct {
+	userIDer  UserIDer
+	db        *sql.DB
+	table     string
+	retention time.Duration
+	merger    app.Merger
+	merged    *mergeCache
+	inProcess inProcessStore
+	window    time.Duration
+
+	partitionsLock sync.Mutex
+	partitions     map[string]struct{} // days known to have a partition
+
+	*natsShortcuts
+}
+
+// NewPostgresCollector makes a Collector keeping reports in Postgres (10 or
+// later, for partitioning), for the durability of a database without a
+// NoSQL cluster to run.
+func NewPostgresCollector(config PostgresCollectorConfig) (AWSCollector, error) {
+	shortcuts, err := newNatsShortcuts(config.UserIDer, config.NatsHost)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	retention := config.Retention
+	if retention <= 0 {
+		retention = DefaultPostgresRetention
+	}
+	// (window * report rate) * number of hosts per user * number of users
+	reportCacheSize := (int(config.Window.Seconds()) / 3) * 10 * 5
+	return &postgresCollector{
+		userIDer:   config.UserIDer,
+		db:         db,
+		table:      config.Table,
+		retention:  retention,
+		merger:     app.NewSmartMerger(),
+		merged:     newMergeCache(mergeCacheSize, config.Window),
+		inProcess:  newInProcessStore(reportCacheSize, config.Window),
+		window:     config.Window,
+		partitions: map[string]struct{}{},
+
+		natsShortcuts: shortcuts,
+	}, nil
+}
+
+// CreateTables creates the partitioned table of reports, and its index.
+func (c *postgresCollector) CreateTables() error {
+	log.Infof("Creating table %s", c.table)
+	table := pq.QuoteIdentifier(c.table)
+	if _, err := c.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		instance text NOT NULL,
+		ts timestamptz NOT NULL,
+		report bytea NOT NULL
+	) PARTITION BY RANGE (ts)`, table)); err != nil {
+		return err
+	}
+	_, err := c.db.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (instance, ts)`,
+		pq.QuoteIdentifier(c.table+"_instance_ts"), table))
+	return err
+}
+
+func (c *postgresCollector) partitionName(day time.Time) string {
+	return c.table + "_" + day.Format(postgresPartitionLayout)
+}
+
+// postgresTimestamp quotes t as a literal, for statements which can't take
+// parameters, as partition bounds. RFC 3339 times have nothing to escape.
+func postgresTimestamp(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339) + "'"
+}
+
+// ensurePartition creates the partition of the day of t, if it wasn't
+// already, dropping those past the retention as the day changes.
+func (c *postgresCollector) ensurePartition(ctx context.Context, t time.Time) error {
+	day := t.UTC().Truncate(postgresPartition)
+	name := c.partitionName(day)
+
+	c.partitionsLock.Lock()
+	defer c.partitionsLock.Unlock()
+	if _, ok := c.partitions[name]; ok {
+		return nil
+	}
+	err := instrument.TimeRequestHistogram(ctx, "Postgres.CreatePartition", postgresRequestDuration, func(ctx context.Context) error {
+		_, err := c.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)`,
+			pq.QuoteIdentifier(name), pq.QuoteIdentifier(c.table),
+			postgresTimestamp(day), postgresTimestamp(day.Add(postgresPartition))))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.partitions = map[string]struct{}{name: {}}
+
+	if err := c.dropExpiredPartitions(ctx, t); err != nil {
+		// Just takes space, until the next day
+		log.Warningf("Error dropping expired partitions of %s: %v", c.table, err)
+	}
+	return nil
+}
+
+// dropExpiredPartitions drops the partitions of reports all past the
+// retention at now.
+func (c *postgresCollector) dropExpiredPartitions(ctx context.Context, now time.Time) error {
+	var partitions []string
+	err := instrument.TimeRequestHistogram(ctx, "Postgres.ListPartitions", postgresRequestDuration, func(ctx context.Context) error {
+		rows, err := c.db.QueryContext(ctx, `SELECT child.relname FROM pg_inherits
+			JOIN pg_class parent ON pg_inherits.inhparent = parent.oid
+			JOIN pg_class child ON pg_inherits.inhrelid = child.oid
+			WHERE parent.relname = $1`, c.table)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			partitions = append(partitions, name)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range partitions {
+		if !partitionExpired(c.table, name, now.Add(-c.retention)) {
+			continue
+		}
+		log.Infof("Dropping expired partition %s", name)
+		err := instrument.TimeRequestHistogram(ctx, "Postgres.DropPartition", postgresRequestDuration, func(ctx context.Context) error {
+			_, err := c.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, pq.QuoteIdentifier(name)))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitionExpired is whether the partition of the table named holds only
+// reports from before the oldest time kept. Tables not named as partitions
+// of the table never are.
+func partitionExpired(table, name string, oldest time.Time) bool {
+	if !strings.HasPrefix(name, table+"_") {
+		return false
+	}
+	day, err := time.Parse(postgresPartitionLayout, strings.TrimPrefix(name, table+"_"))
+	if err != nil {
+		return false
+	}
+	return !day.Add(postgresPartition).After(oldest)
+}
+
+// postgresReportKey is the key of the report of the instance at the
+// timestamp, in microseconds, as it's cached by.
+func postgresReportKey(instance string, ts time.Time) string {
+	return fmt.Sprintf("%s/%d", instance, ts.UnixNano()/int64(time.Microsecond))
+}
+
+// parsePostgresReportKey returns the instance and timestamp of the report
+// of the key.
+func parsePostgresReportKey(key string) (string, time.Time, error) {
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return "", time.Time{}, fmt.Errorf("invalid report key %q", key)
+	}
+	us, err := strconv.ParseInt(key[i+1:], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid report key %q: %v", key, err)
+	}
+	return key[:i], time.Unix(0, us*int64(time.Microsecond)), nil
+}
+
+// getReportKeys returns the keys of the reports in the window ending at
+// timestamp.
+func (c *postgresCollector) getReportKeys(ctx context.Context, timestamp time.Time) ([]string, error) {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	instance := shardInstance(ctx, userid)
+	var result []string
+	err = instrument.TimeRequestHistogram(ctx, "Postgres.SelectKeys", postgresRequestDuration, func(ctx context.Context) error {
+		rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`SELECT ts FROM %s WHERE instance = $1 AND ts > $2 AND ts <= $3`, pq.QuoteIdentifier(c.table)),
+			instance, timestamp.Add(-c.window), timestamp)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var ts time.Time
+			if err := rows.Scan(&ts); err != nil {
+				return err
+			}
+			result = append(result, postgresReportKey(instance, ts))
+		}
+		return rows.Err()
+	})
+	return result, err
+}
+
+// FetchReports fetches the reports of the keys, a query per instance.
+func (c *postgresCollector) FetchReports(ctx context.Context, keys []string) (map[string]report.Report, []string, error) {
+	instances := map[string][]string{}
+	for _, key := range keys {
+		instance, ts, err := parsePostgresReportKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		instances[instance] = append(instances[instance], ts.UTC().Format(time.RFC3339Nano))
+	}
+
+	reports := map[string]report.Report{}
+	for instance, tss := range instances {
+		err := instrument.TimeRequestHistogram(ctx, "Postgres.SelectReports", postgresRequestDuration, func(ctx context.Context) error {
+			rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`SELECT ts, report FROM %s WHERE instance = $1 AND ts = ANY($2::timestamptz[])`, pq.QuoteIdentifier(c.table)),
+				instance, pq.Array(tss))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var (
+					ts  time.Time
+					buf []byte
+				)
+				if err := rows.Scan(&ts, &buf); err != nil {
+					return err
+				}
+				rpt, err := report.MakeFromBytes(buf)
+				if err != nil {
+					return err
+				}
+				reports[postgresReportKey(instance, ts)] = *rpt
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Reports may have expired since their keys were read
+	var missing []string
+	for _, key := range keys {
+		if _, ok := reports[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return reports, missing, nil
+}
+
+func (c *postgresCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	reportKeys, err := c.getReportKeys(ctx, timestamp)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	return c.merged.merge(userid, reportKeys, c.merger, func() ([]report.Report, error) {
+		log.Debugf("Fetching %d reports to %v", len(reportKeys), timestamp)
+		return getReports(ctx, c.inProcess, []ReportStore{c}, reportKeys)
+	})
+}
+
+func (c *postgresCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	reportKeys, err := c.getReportKeys(ctx, timestamp)
+	return len(reportKeys) > 0, err
+}
+
+func (c *postgresCollector) HasHistoricReports() bool {
+	return true
+}
+
+func (c *postgresCollector) Add(ctx context.Context, rep report.Report, buf []byte) error {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+
+	instance := shardInstance(ctx, userid)
+	now := app.ReportTime(ctx).Truncate(time.Microsecond)
+	if err := c.ensurePartition(ctx, now); err != nil {
+		return err
+	}
+	err = instrument.TimeRequestHistogram(ctx, "Postgres.Insert", postgresRequestDuration, func(ctx context.Context) error {
+		_, err := c.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (instance, ts, report) VALUES ($1, $2, $3)`, pq.QuoteIdentifier(c.table)),
+			instance, now, buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	reportSizeHistogram.Observe(float64(len(buf)))
+	c.merged.invalidate(userid)
+
+	if rep.Shortcut {
+		c.publish(userid, postgresReportKey(instance, now))
+	}
+	return nil
+}
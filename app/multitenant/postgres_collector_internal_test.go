@@ -0,0 +1,42 @@
+package multitenant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostgresReportKey(t *testing.T) {
+	ts := time.Date(2017, 1, 19, 20, 0, 0, 123456000, time.UTC)
+	instance, got, err := parsePostgresReportKey(postgresReportKey("user/1", ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance != "user/1" || !got.Equal(ts) {
+		t.Errorf("got %q, %v", instance, got)
+	}
+
+	for _, key := range []string{"", "user", "user/", "user/ts"} {
+		if _, _, err := parsePostgresReportKey(key); err == nil {
+			t.Errorf("expected an error parsing %q", key)
+		}
+	}
+}
+
+func TestPartitionExpired(t *testing.T) {
+	oldest := time.Date(2017, 1, 19, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name    string
+		expired bool
+	}{
+		{"reports_20170117", true},
+		{"reports_20170118", true},
+		{"reports_20170119", false},
+		{"reports_20170120", false},
+		{"reports_instance_ts", false},
+		{"other_20170101", false},
+	} {
+		if expired := partitionExpired("reports", c.name, oldest); expired != c.expired {
+			t.Errorf("%s: expected expired %v, got %v", c.name, c.expired, expired)
+		}
+	}
+}
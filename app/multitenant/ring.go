@@ -0,0 +1,72 @@
+package multitenant
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// ringTokens is how many tokens each member has on a hashRing, so keys
+// spread evenly, and only the keys of a member move when it joins or
+// leaves.
+const ringTokens = 128
+
+// hashRing is a consistent hash ring of members, by their addresses.
+type hashRing struct {
+	tokens []uint32
+	owners map[uint32]string
+}
+
+func ringHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// newHashRing makes the ring of the members. Every replica makes the same
+// ring of the same members.
+func newHashRing(members []string) *hashRing {
+	r := &hashRing{owners: make(map[uint32]string, len(members)*ringTokens)}
+	sorted := append([]string{}, members...)
+	sort.Strings(sorted)
+	for _, member := range sorted {
+		for i := 0; i < ringTokens; i++ {
+			token := ringHash(member + "-" + strconv.Itoa(i))
+			if _, ok := r.owners[token]; ok {
+				continue // the first member sorted keeps a token both hash to
+			}
+			r.owners[token] = member
+			r.tokens = append(r.tokens, token)
+		}
+	}
+	sort.Slice(r.tokens, func(i, j int) bool { return r.tokens[i] < r.tokens[j] })
+	return r
+}
+
+// owner returns the member owning the key, the first clockwise of its
+// hash, or "" on an empty ring.
+func (r *hashRing) owner(key string) string {
+	if len(r.tokens) == 0 {
+		return ""
+	}
+	hash := ringHash(key)
+	i := sort.Search(len(r.tokens), func(i int) bool { return r.tokens[i] >= hash })
+	if i == len(r.tokens) {
+		i = 0
+	}
+	return r.owners[r.tokens[i]]
+}
+
+// members returns the members of the ring, sorted.
+func (r *hashRing) members() []string {
+	seen := map[string]struct{}{}
+	var result []string
+	for _, member := range r.owners {
+		if _, ok := seen[member]; !ok {
+			seen[member] = struct{}{}
+			result = append(result, member)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
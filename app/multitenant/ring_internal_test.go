@@ -0,0 +1,56 @@
+package multitenant
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	if owner := newHashRing(nil).owner("key"); owner != "" {
+		t.Errorf("expected no owner on an empty ring, got %q", owner)
+	}
+
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("user/host-%d", i))
+	}
+	owners := func(r *hashRing) map[string]string {
+		result := map[string]string{}
+		for _, key := range keys {
+			result[key] = r.owner(key)
+		}
+		return result
+	}
+
+	ring := newHashRing([]string{"a:4445", "b:4445", "c:4445"})
+	if want, have := []string{"a:4445", "b:4445", "c:4445"}, ring.members(); !reflect.DeepEqual(want, have) {
+		t.Errorf("expected members %v, got %v", want, have)
+	}
+	before := owners(ring)
+	counts := map[string]int{}
+	for _, owner := range before {
+		counts[owner]++
+	}
+	for member, count := range counts {
+		if count < 200 {
+			t.Errorf("%s owns only %d of %d keys", member, count, len(keys))
+		}
+	}
+
+	// Replicas make the same ring of the same members
+	if !reflect.DeepEqual(before, owners(newHashRing([]string{"c:4445", "a:4445", "b:4445"}))) {
+		t.Errorf("rings of the same members differ")
+	}
+
+	// Only the keys of a replica leaving move
+	after := owners(newHashRing([]string{"a:4445", "c:4445"}))
+	for _, key := range keys {
+		if before[key] != "b:4445" && before[key] != after[key] {
+			t.Errorf("%s moved from %s to %s", key, before[key], after[key])
+		}
+		if after[key] == "b:4445" {
+			t.Errorf("%s still owned by the replica which left", key)
+		}
+	}
+}
@@ -2,6 +2,11 @@ package multitenant
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -98,3 +103,90 @@ func (store *S3Store) StoreReportBytes(ctx context.Context, key string, buf []by
 	})
 	return len(buf), err
 }
+
+// ListKeys lists the keys of the objects under the prefix.
+func (store *S3Store) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := instrument.TimeRequestHistogram(ctx, "S3.List", s3RequestDuration, func(_ context.Context) error {
+		return store.s3.ListObjectsPages(&s3.ListObjectsInput{
+			Bucket: aws.String(store.bucketName),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsOutput, _ bool) bool {
+			for _, object := range page.Contents {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+			return true
+		})
+	})
+	return keys, err
+}
+
+// S3ReportStore is an app.ReportStore keeping snapshots of reports in S3,
+// under a prefix, keyed by the nanoseconds since the epoch they were taken
+// at.
+type S3ReportStore struct {
+	S3Store
+	prefix string
+}
+
+// NewS3ReportStore makes a new S3ReportStore.
+func NewS3ReportStore(config *aws.Config, bucketName, prefix string) *S3ReportStore {
+	return &S3ReportStore{
+		S3Store: NewS3Client(config, bucketName),
+		prefix:  prefix,
+	}
+}
+
+func (store *S3ReportStore) key(timestamp time.Time) string {
+	return fmt.Sprintf("%s%d", store.prefix, timestamp.UnixNano())
+}
+
+// Put implements app.ReportStore.
+func (store *S3ReportStore) Put(ctx context.Context, timestamp time.Time, rpt report.Report) error {
+	var buf bytes.Buffer
+	if err := rpt.WriteBinary(&buf, gzip.DefaultCompression); err != nil {
+		return err
+	}
+	_, err := store.StoreReportBytes(ctx, store.key(timestamp), buf.Bytes())
+	return err
+}
+
+// Get implements app.ReportStore.
+func (store *S3ReportStore) Get(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := store.fetchReport(ctx, store.key(timestamp))
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	return *rpt, nil
+}
+
+// Delete implements app.ReportStore.
+func (store *S3ReportStore) Delete(ctx context.Context, timestamp time.Time) error {
+	return instrument.TimeRequestHistogram(ctx, "S3.Delete", s3RequestDuration, func(_ context.Context) error {
+		_, err := store.s3.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(store.bucketName),
+			Key:    aws.String(store.key(timestamp)),
+		})
+		return err
+	})
+}
+
+// List implements app.ReportStore.
+func (store *S3ReportStore) List(ctx context.Context) ([]time.Time, error) {
+	var timestamps []time.Time
+	err := instrument.TimeRequestHistogram(ctx, "S3.List", s3RequestDuration, func(_ context.Context) error {
+		return store.s3.ListObjectsPages(&s3.ListObjectsInput{
+			Bucket: aws.String(store.bucketName),
+			Prefix: aws.String(store.prefix),
+		}, func(page *s3.ListObjectsOutput, _ bool) bool {
+			for _, object := range page.Contents {
+				ns, err := strconv.ParseInt(strings.TrimPrefix(aws.StringValue(object.Key), store.prefix), 10, 64)
+				if err == nil {
+					timestamps = append(timestamps, time.Unix(0, ns))
+				}
+			}
+			return true
+		})
+	})
+	return timestamps, err
+}
@@ -0,0 +1,545 @@
+package multitenant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/instrument"
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	shardHeartbeatInterval = 5 * time.Second
+	// shardHeartbeatTimeout is how long a replica is in the ring after
+	// its last heartbeat, so the others take over the shards of replicas
+	// which died without leaving.
+	shardHeartbeatTimeout = 30 * time.Second
+	shardRequestTimeout   = 5 * time.Second
+	// shardBuckets is how many shards the reports of an instance are kept
+	// in, in a store shared by the replicas.
+	shardBuckets = 16
+)
+
+var (
+	shardRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "scope",
+		Name:      "shard_request_duration_seconds",
+		Help:      "Time in seconds spent doing requests to other collector replicas.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status_code"})
+	shardRingMembers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "scope",
+		Name:      "shard_ring_members",
+		Help:      "Number of collector replicas in the ring sharding reports.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(shardRequestDuration)
+	prometheus.MustRegister(shardRingMembers)
+}
+
+// shardRingDesc is the description of the ring in consul: the replicas in
+// it, by address, and when they last heartbeat.
+type shardRingDesc struct {
+	Members map[string]time.Time `json:"members"`
+}
+
+// alive returns the addresses of the replicas which heartbeat recently.
+func (d *shardRingDesc) alive(now time.Time) []string {
+	var result []string
+	for addr, heartbeat := range d.Members {
+		if now.Sub(heartbeat) < shardHeartbeatTimeout {
+			result = append(result, addr)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+type contextKey string
+
+// shardCtxKey is the key of the shard of a report in the context collectors
+// add, and read, the reports of a shared store with.
+const shardCtxKey contextKey = "shard"
+
+// shardInstance returns the instance the collectors of a store shared by
+// replicas keep the reports of the user under: that of the shard of the
+// context, if any, so each replica reads only the shards it owns.
+func shardInstance(ctx context.Context, userid string) string {
+	if shard, ok := ctx.Value(shardCtxKey).(string); ok {
+		return userid + "/shard-" + shard
+	}
+	return userid
+}
+
+// ShardedCollector is a Collector sharding reports across the replicas of
+// the app, so no one replica has to merge all the reports of an instance.
+type ShardedCollector interface {
+	app.Collector
+	Stop()
+}
+
+// shardedCollector is a Collector sharding the reports of each instance by
+// host, on a consistent hash ring of the replicas in consul. Reports are
+// added to the local collector of the replica owning their shard,
+// forwarded there over the private API if that's another replica. Reading
+// a report coordinates the merge: every replica merges the reports of the
+// shards it has, and the reading replica merges those.
+//
+// As replicas join or leave, or stop heartbeating, the ring changes, and
+// reports of the shards which moved go to their new replicas. Reports
+// already added stay where they are, and are still merged, until they
+// leave the window.
+//
+// When the local collectors share a store, reports are kept in it by shard,
+// a bucket of their key, each replica adding those it's sent itself, and
+// every replica reads, and merges, only the shards it owns on the ring.
+// Shards which move are read from the store by their new replicas.
+type shardedCollector struct {
+	local     app.Collector
+	shared    bool
+	client    ConsulClient
+	key       string
+	advertise string // Address of this replica to advertise in consul
+	userIDer  UserIDer
+	http      *http.Client
+	server    *http.Server
+
+	mtx  sync.RWMutex
+	ring *hashRing
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// NewShardedCollector makes a Collector sharding reports across the
+// replicas in the ring at the key in consul, adding them to their local
+// collectors, which share a store if shared is set, and serving the private
+// API to the others at advertise.
+func NewShardedCollector(local app.Collector, shared bool, client ConsulClient, key, advertise string, userIDer UserIDer) ShardedCollector {
+	c := &shardedCollector{
+		local:     local,
+		shared:    shared,
+		client:    client,
+		key:       key,
+		advertise: advertise,
+		userIDer:  userIDer,
+		http:      &http.Client{Timeout: shardRequestTimeout},
+		ring:      newHashRing(nil),
+		quit:      make(chan struct{}),
+	}
+	c.server = &http.Server{Addr: advertise, Handler: c.privateAPI()}
+	c.wait.Add(2)
+	go c.heartbeat()
+	go c.watchRing()
+	go func() {
+		log.Infof("Serving private collector API on endpoint %s.", advertise)
+		log.Infof("Private collector API terminated: %v", c.server.ListenAndServe())
+	}()
+	return c
+}
+
+// Stop leaves the ring, so the other replicas take over the shards of
+// this one straight away.
+func (c *shardedCollector) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+	if err := c.updateRing(func(desc *shardRingDesc) {
+		delete(desc.Members, c.advertise)
+	}); err != nil {
+		log.Errorf("Error leaving the collector ring: %v", err)
+	}
+	c.server.Close()
+}
+
+func (c *shardedCollector) updateRing(f func(*shardRingDesc)) error {
+	return c.client.CAS(c.key, &shardRingDesc{}, func(in interface{}) (interface{}, bool, error) {
+		desc, ok := in.(*shardRingDesc)
+		if !ok || desc == nil {
+			desc = &shardRingDesc{}
+		}
+		if desc.Members == nil {
+			desc.Members = map[string]time.Time{}
+		}
+		f(desc)
+		// Forget replicas long gone
+		now := mtime.Now()
+		for addr, heartbeat := range desc.Members {
+			if now.Sub(heartbeat) > 2*shardHeartbeatTimeout {
+				delete(desc.Members, addr)
+			}
+		}
+		return desc, false, nil
+	})
+}
+
+func (c *shardedCollector) heartbeat() {
+	defer c.wait.Done()
+	ticker := time.NewTicker(shardHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.updateRing(func(desc *shardRingDesc) {
+			desc.Members[c.advertise] = mtime.Now()
+		}); err != nil {
+			log.Errorf("Error heartbeating to the collector ring: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// watchRing rebalances the shards as replicas join and leave the ring.
+func (c *shardedCollector) watchRing() {
+	defer c.wait.Done()
+	c.client.WatchPrefix(c.key, &shardRingDesc{}, c.quit, func(key string, value interface{}) bool {
+		if key != c.key {
+			return true
+		}
+		c.setMembers(value.(*shardRingDesc).alive(mtime.Now()))
+		return true
+	})
+}
+
+func (c *shardedCollector) setMembers(members []string) {
+	ring := newHashRing(members)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if old := c.ring.members(); !stringsEqual(old, members) {
+		log.Infof("Collector ring changed from %v to %v", old, members)
+	}
+	c.ring = ring
+	shardRingMembers.Set(float64(len(members)))
+}
+
+func (c *shardedCollector) getRing() *hashRing {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.ring
+}
+
+// shardKey is the key of the shard of the report of the user: the host it
+// is from, or failing that the probe it is from.
+func shardKey(ctx context.Context, userid string, rpt report.Report) string {
+	var hosts []string
+	for id := range rpt.Host.Nodes {
+		hosts = append(hosts, id)
+	}
+	if len(hosts) > 0 {
+		sort.Strings(hosts)
+		return userid + "/" + hosts[0]
+	}
+	if r, ok := ctx.Value(app.RequestCtxKey).(*http.Request); ok && r != nil {
+		return userid + "/" + r.Header.Get(xfer.ScopeProbeIDHeader)
+	}
+	return userid + "/"
+}
+
+// forwardedHeaders copies the headers of the request of the context, so
+// the other replica IDs the user as this one did.
+func forwardedHeaders(ctx context.Context) http.Header {
+	header := http.Header{}
+	if r, ok := ctx.Value(app.RequestCtxKey).(*http.Request); ok && r != nil {
+		for k, vs := range r.Header {
+			header[k] = append([]string{}, vs...)
+		}
+	}
+	header.Del("Content-Length")
+	header.Del("Accept-Encoding")
+	return header
+}
+
+// shardBucket returns the shard of the store shared by the replicas the
+// report of the key is kept in.
+func shardBucket(key string) string {
+	return strconv.Itoa(int(ringHash(key) % shardBuckets))
+}
+
+func (c *shardedCollector) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	if c.shared {
+		// Any replica can add to the shard in the store
+		return c.local.Add(context.WithValue(ctx, shardCtxKey, shardBucket(shardKey(ctx, userid, rpt))), rpt, buf)
+	}
+	owner := c.getRing().owner(shardKey(ctx, userid, rpt))
+	if owner == "" || owner == c.advertise {
+		return c.local.Add(ctx, rpt, buf)
+	}
+
+	return instrument.TimeRequestHistogram(ctx, "Shard.Add", shardRequestDuration, func(_ context.Context) error {
+		req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/private/api/report", owner), bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		req.Header = forwardedHeaders(ctx)
+		if made, ok := app.ReportReplayed(ctx); ok {
+			// Streamed reports have no header saying so
+			req.Header.Set(xfer.ScopeReportReplayedHeader, made.UTC().Format(time.RFC3339Nano))
+		}
+		req.Header.Set("Content-Type", report.MsgpackContentType)
+		req.Header.Set("Content-Encoding", report.GzipEncoding)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("Error adding report to %s: %s: %s", owner, resp.Status, body)
+		}
+		return nil
+	})
+}
+
+// remote requests the path of the other replica, for the user of the
+// context, returning the response body if it's OK, or nil if it's not
+// found.
+func (c *shardedCollector) remote(ctx context.Context, addr, path string, timestamp time.Time) ([]byte, error) {
+	var body []byte
+	err := instrument.TimeRequestHistogram(ctx, "Shard.Get", shardRequestDuration, func(_ context.Context) error {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s?timestamp=%d", addr, path, timestamp.UnixNano()), nil)
+		if err != nil {
+			return err
+		}
+		req.Header = forwardedHeaders(ctx)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			body, err = ioutil.ReadAll(resp.Body)
+			return err
+		case http.StatusNotFound:
+			return nil
+		}
+		return fmt.Errorf("Error getting %s from %s: %s", path, addr, resp.Status)
+	})
+	return body, err
+}
+
+// Report merges the reports each replica in the ring has merged of the
+// shards it has. Replicas which can't be reached are left out, rather
+// than failing the whole report.
+func (c *shardedCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	type result struct {
+		rpt report.Report
+		err error
+	}
+	var (
+		members = c.getRing().members()
+		results = make(chan result, len(members)+1)
+		pending = 1
+	)
+	go func() {
+		rpt, err := c.localReport(ctx, timestamp)
+		results <- result{rpt, err}
+	}()
+	for _, addr := range members {
+		if addr == c.advertise {
+			continue
+		}
+		pending++
+		go func(addr string) {
+			body, err := c.remote(ctx, addr, "/private/api/report", timestamp)
+			if err != nil || body == nil {
+				results <- result{report.MakeReport(), err}
+				return
+			}
+			rpt, err := report.MakeFromBytes(body)
+			if err != nil {
+				results <- result{report.MakeReport(), err}
+				return
+			}
+			results <- result{*rpt, nil}
+		}(addr)
+	}
+
+	merged := report.MakeReport()
+	var localErr error
+	for i := 0; i < pending; i++ {
+		r := <-results
+		if r.err != nil {
+			log.Warningf("Error getting report of a shard: %v", r.err)
+			localErr = r.err
+			continue
+		}
+		merged.UnsafeMerge(r.rpt)
+	}
+	if pending == 1 && localErr != nil {
+		return report.MakeReport(), localErr
+	}
+	return merged, nil
+}
+
+// localReport returns the merge of the reports of the shards of this
+// replica: those of its local collector, or of the shards it owns in the
+// shared store.
+func (c *shardedCollector) localReport(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	if !c.shared {
+		return c.local.Report(ctx, timestamp)
+	}
+	userid, err := c.userIDer(ctx)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	var (
+		ring   = c.getRing()
+		merged = report.MakeReport()
+	)
+	for i := 0; i < shardBuckets; i++ {
+		bucket := strconv.Itoa(i)
+		if owner := ring.owner(userid + "/" + bucket); owner != "" && owner != c.advertise {
+			continue
+		}
+		rpt, err := c.local.Report(context.WithValue(ctx, shardCtxKey, bucket), timestamp)
+		if err != nil {
+			return report.MakeReport(), err
+		}
+		merged.UnsafeMerge(rpt)
+	}
+	return merged, nil
+}
+
+func (c *shardedCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	if c.shared {
+		// The store has the shards of all the replicas
+		for i := 0; i < shardBuckets; i++ {
+			if has, err := c.local.HasReports(context.WithValue(ctx, shardCtxKey, strconv.Itoa(i)), timestamp); err != nil || has {
+				return has, err
+			}
+		}
+		return false, nil
+	}
+	if has, err := c.local.HasReports(ctx, timestamp); err != nil || has {
+		return has, err
+	}
+	for _, addr := range c.getRing().members() {
+		if addr == c.advertise {
+			continue
+		}
+		body, err := c.remote(ctx, addr, "/private/api/has_reports", timestamp)
+		if err != nil {
+			log.Warningf("Error checking reports of shards at %s: %v", addr, err)
+			continue
+		}
+		if body != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *shardedCollector) HasHistoricReports() bool {
+	return c.local.HasHistoricReports()
+}
+
+// WaitOn only waits on shortcut reports of the shards of this replica.
+func (c *shardedCollector) WaitOn(ctx context.Context, waiter chan struct{}) {
+	c.local.WaitOn(ctx, waiter)
+}
+
+func (c *shardedCollector) UnWait(ctx context.Context, waiter chan struct{}) {
+	c.local.UnWait(ctx, waiter)
+}
+
+func requestTimestamp(r *http.Request) (time.Time, error) {
+	ns, err := strconv.ParseInt(r.FormValue("timestamp"), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns), nil
+}
+
+func (c *shardedCollector) privateAPI() http.Handler {
+	router := mux.NewRouter()
+	router.Methods("POST").Path("/private/api/report").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(context.Background(), app.RequestCtxKey, r)
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rpt, err := report.MakeFromBytes(buf)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.local.Add(ctx, *rpt, buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	router.Methods("GET").Path("/private/api/report").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(context.Background(), app.RequestCtxKey, r)
+		timestamp, err := requestTimestamp(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rpt, err := c.localReport(ctx, timestamp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Gzipped msgpack, but not Content-Encoding, which the client
+		// would decompress
+		w.Header().Set("Content-Type", report.MsgpackContentType)
+		if err := rpt.WriteBinary(w, gzip.DefaultCompression); err != nil {
+			log.Errorf("Error writing report of shards: %v", err)
+		}
+	})
+	router.Methods("GET").Path("/private/api/has_reports").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(context.Background(), app.RequestCtxKey, r)
+		timestamp, err := requestTimestamp(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		has, err := c.local.HasReports(ctx, timestamp)
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case has:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	return router
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
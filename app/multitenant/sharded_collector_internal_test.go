@@ -0,0 +1,177 @@
+package multitenant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestShardedCollector(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		consul     = newMockConsulClient()
+		replicas   = 3
+		collectors []*shardedCollector
+	)
+	for i := 0; i < replicas; i++ {
+		c := NewShardedCollector(app.NewCollector(time.Minute), false, consul, "collectors", fmt.Sprintf("127.0.0.1:45%02d", i), NoopUserIDer)
+		defer c.Stop()
+		collectors = append(collectors, c.(*shardedCollector))
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for _, c := range collectors {
+		for len(c.getRing().members()) != replicas {
+			if time.Now().After(deadline) {
+				t.Fatalf("ring of %s never had all the replicas: %v", c.advertise, c.getRing().members())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	hosts := 10
+	for i := 0; i < hosts; i++ {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode(fmt.Sprintf("host-%d;<host>", i)))
+		var buf bytes.Buffer
+		if err := rpt.WriteBinary(&buf, gzip.DefaultCompression); err != nil {
+			t.Fatal(err)
+		}
+		if err := collectors[0].Add(ctx, rpt, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every replica has some shards, and merges all of them
+	for _, c := range collectors {
+		local, err := c.local.Report(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(local.Host.Nodes) == 0 || len(local.Host.Nodes) == hosts {
+			t.Errorf("%s has %d of the %d hosts", c.advertise, len(local.Host.Nodes), hosts)
+		}
+
+		rpt, err := c.Report(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rpt.Host.Nodes) != hosts {
+			t.Errorf("%s merged %d of the %d hosts", c.advertise, len(rpt.Host.Nodes), hosts)
+		}
+		if has, err := c.HasReports(ctx, time.Now()); err != nil || !has {
+			t.Errorf("%s: expected reports, got %v, %v", c.advertise, has, err)
+		}
+	}
+}
+
+// sharedStoreCollector is a collector of a store shared by replicas,
+// keeping the reports of each shard apart, and counting reads of them.
+type sharedStoreCollector struct {
+	sync.Mutex
+	shards map[string]app.Collector
+	reads  map[string]int
+}
+
+func (s *sharedStoreCollector) shard(ctx context.Context) (string, app.Collector) {
+	s.Lock()
+	defer s.Unlock()
+	instance := shardInstance(ctx, "")
+	if _, ok := s.shards[instance]; !ok {
+		s.shards[instance] = app.NewCollector(time.Minute)
+	}
+	return instance, s.shards[instance]
+}
+
+func (s *sharedStoreCollector) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	_, c := s.shard(ctx)
+	return c.Add(ctx, rpt, buf)
+}
+
+func (s *sharedStoreCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	instance, c := s.shard(ctx)
+	s.Lock()
+	s.reads[instance]++
+	s.Unlock()
+	return c.Report(ctx, timestamp)
+}
+
+func (s *sharedStoreCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	_, c := s.shard(ctx)
+	return c.HasReports(ctx, timestamp)
+}
+
+func (s *sharedStoreCollector) HasHistoricReports() bool              { return true }
+func (s *sharedStoreCollector) WaitOn(context.Context, chan struct{}) {}
+func (s *sharedStoreCollector) UnWait(context.Context, chan struct{}) {}
+
+func TestShardedCollectorSharedStore(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		consul     = newMockConsulClient()
+		store      = &sharedStoreCollector{shards: map[string]app.Collector{}, reads: map[string]int{}}
+		replicas   = 3
+		collectors []*shardedCollector
+	)
+	for i := 0; i < replicas; i++ {
+		c := NewShardedCollector(store, true, consul, "collectors", fmt.Sprintf("127.0.0.1:46%02d", i), NoopUserIDer)
+		defer c.Stop()
+		collectors = append(collectors, c.(*shardedCollector))
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for _, c := range collectors {
+		for len(c.getRing().members()) != replicas {
+			if time.Now().After(deadline) {
+				t.Fatalf("ring of %s never had all the replicas: %v", c.advertise, c.getRing().members())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	hosts := 10
+	for i := 0; i < hosts; i++ {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode(fmt.Sprintf("host-%d;<host>", i)))
+		var buf bytes.Buffer
+		if err := rpt.WriteBinary(&buf, gzip.DefaultCompression); err != nil {
+			t.Fatal(err)
+		}
+		if err := collectors[i%replicas].Add(ctx, rpt, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every shard is read once, by the replica owning it
+	for _, c := range collectors {
+		store.Lock()
+		store.reads = map[string]int{}
+		store.Unlock()
+		rpt, err := c.Report(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rpt.Host.Nodes) != hosts {
+			t.Errorf("%s merged %d of the %d hosts", c.advertise, len(rpt.Host.Nodes), hosts)
+		}
+		store.Lock()
+		if len(store.reads) != shardBuckets {
+			t.Errorf("%s read %d of the %d shards", c.advertise, len(store.reads), shardBuckets)
+		}
+		for instance, reads := range store.reads {
+			if reads != 1 {
+				t.Errorf("%s read %s %d times", c.advertise, instance, reads)
+			}
+		}
+		store.Unlock()
+		if has, err := c.HasReports(ctx, time.Now()); err != nil || !has {
+			t.Errorf("%s: expected reports, got %v, %v", c.advertise, has, err)
+		}
+	}
+}
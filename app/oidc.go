@@ -0,0 +1,310 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcSessionCookie = "scope_session"
+	oidcStateCookie   = "scope_oidc_state"
+	oidcStateTimeout  = 10 * time.Minute
+	oidcTimeout       = 10 * time.Second
+	oidcBearerTTL     = 1 * time.Minute
+)
+
+// OIDCConfig configures authenticating users with an OpenID Connect
+// provider.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // of the callback route, /oidc/callback
+	// Claim names users, as in the user store: email, sub or
+	// preferred_username, say.
+	Claim         string
+	SessionLength time.Duration
+	// SessionKey signs session cookies, so they outlive the app if set.
+	SessionKey string
+}
+
+// NewOIDCAuthenticator makes an Authenticator of the users of an OpenID
+// Connect provider, found through its discovery document. Users log in
+// through the provider, and are then known by a session cookie, signed
+// with the session key, or one the app makes up as it starts. API clients
+// can authenticate with access tokens of the provider as bearer tokens
+// instead.
+func NewOIDCAuthenticator(config OIDCConfig) (Authenticator, error) {
+	client := &http.Client{Timeout: oidcTimeout}
+	resp, err := client.Get(strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenID Connect discovery: %s", resp.Status)
+	}
+	var discovery struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("OpenID Connect provider at %s lacks endpoints", config.IssuerURL)
+	}
+
+	key := []byte(config.SessionKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &oidcAuthenticator{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+			Scopes: []string{"openid", "profile", "email"},
+		},
+		userinfoURL: discovery.UserinfoEndpoint,
+		key:         key,
+		bearers:     map[[sha256.Size]byte]oidcSession{},
+	}, nil
+}
+
+type oidcAuthenticator struct {
+	config      OIDCConfig
+	oauth2      oauth2.Config
+	userinfoURL string
+	key         []byte
+
+	sync.Mutex
+	bearers map[[sha256.Size]byte]oidcSession // users of bearer tokens, by hash
+}
+
+// sign returns the value, and a MAC of it, as a cookie value.
+func (a *oidcAuthenticator) sign(value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the value of a cookie made by sign, if it wasn't tampered
+// with.
+func (a *oidcAuthenticator) verify(cookie string) (string, bool) {
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 2 {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(value)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return "", false
+	}
+	return string(value), true
+}
+
+type oidcSession struct {
+	User    string    `json:"user"`
+	Expires time.Time `json:"expires"`
+}
+
+func (a *oidcAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return a.authenticateBearer(strings.TrimPrefix(auth, "Bearer "))
+	}
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return "", ErrUnauthenticated
+	}
+	value, ok := a.verify(cookie.Value)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	var session oidcSession
+	if err := json.Unmarshal([]byte(value), &session); err != nil || session.User == "" || mtime.Now().After(session.Expires) {
+		return "", ErrUnauthenticated
+	}
+	return session.User, nil
+}
+
+// authenticateBearer asks the provider who the access token is of, and
+// remembers for a little while, as API clients make many requests.
+func (a *oidcAuthenticator) authenticateBearer(accessToken string) (string, error) {
+	now := mtime.Now()
+	hash := sha256.Sum256([]byte(accessToken))
+	a.Lock()
+	session, ok := a.bearers[hash]
+	a.Unlock()
+	if ok && now.Before(session.Expires) {
+		return session.User, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	user, err := a.userinfo(ctx, &oauth2.Token{AccessToken: accessToken, TokenType: "Bearer"})
+	if err != nil {
+		log.Infof("Rejected bearer token: %v", err)
+		return "", ErrUnauthenticated
+	}
+	a.Lock()
+	defer a.Unlock()
+	for h, session := range a.bearers {
+		if now.After(session.Expires) {
+			delete(a.bearers, h)
+		}
+	}
+	a.bearers[hash] = oidcSession{User: user, Expires: now.Add(oidcBearerTTL)}
+	return user, nil
+}
+
+// Challenge sends browsers to log in, and refuses API requests.
+func (a *oidcAuthenticator) Challenge(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api") {
+		respondWith(w, http.StatusUnauthorized, ErrUnauthenticated)
+		return
+	}
+	http.Redirect(w, r, "/oidc/login?next="+r.URL.EscapedPath(), http.StatusFound)
+}
+
+func (a *oidcAuthenticator) RegisterRoutes(router *mux.Router) {
+	router.Methods("GET").Path("/oidc/login").HandlerFunc(a.handleLogin)
+	router.Methods("GET").Path("/oidc/callback").HandlerFunc(a.handleCallback)
+	router.Methods("GET", "POST").Path("/oidc/logout").HandlerFunc(a.handleLogout)
+}
+
+func (a *oidcAuthenticator) LogoutURL() string { return "/oidc/logout" }
+
+func (a *oidcAuthenticator) setCookie(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.config.RedirectURL, "https:"),
+	}
+	// http.Cookie only knows about SameSite in newer versions of Go
+	w.Header().Add("Set-Cookie", cookie.String()+"; SameSite=Lax")
+}
+
+// handleLogin sends users to the provider, remembering where they were
+// going, and a state to check the provider sends back.
+func (a *oidcAuthenticator) handleLogin(w http.ResponseWriter, r *http.Request) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	state := hex.EncodeToString(nonce)
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/"
+	}
+	a.setCookie(w, oidcStateCookie, a.sign(state+" "+next), oidcStateTimeout)
+	http.Redirect(w, r, a.oauth2.AuthCodeURL(state), http.StatusFound)
+}
+
+func (a *oidcAuthenticator) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("login expired, try again"))
+		return
+	}
+	value, ok := a.verify(cookie.Value)
+	parts := strings.SplitN(value, " ", 2)
+	if !ok || len(parts) != 2 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(r.FormValue("state"))) != 1 {
+		respondWith(w, http.StatusBadRequest, fmt.Errorf("login state mismatch, try again"))
+		return
+	}
+	a.setCookie(w, oidcStateCookie, "", -time.Second)
+	if errMsg := r.FormValue("error"); errMsg != "" {
+		respondWith(w, http.StatusUnauthorized, fmt.Errorf("login failed: %s", errMsg))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	token, err := a.oauth2.Exchange(ctx, r.FormValue("code"))
+	if err != nil {
+		respondWith(w, http.StatusUnauthorized, fmt.Errorf("login failed: %v", err))
+		return
+	}
+	user, err := a.userinfo(ctx, token)
+	if err != nil {
+		respondWith(w, http.StatusUnauthorized, fmt.Errorf("login failed: %v", err))
+		return
+	}
+	log.Infof("%s logged in", user)
+
+	session, err := json.Marshal(oidcSession{User: user, Expires: mtime.Now().Add(a.config.SessionLength)})
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.setCookie(w, oidcSessionCookie, a.sign(string(session)), a.config.SessionLength)
+	http.Redirect(w, r, parts[1], http.StatusFound)
+}
+
+// userinfo returns the claim naming the user the token is of, as the
+// provider tells: asking it means not having to check signed ID tokens.
+func (a *oidcAuthenticator) userinfo(ctx context.Context, token *oauth2.Token) (string, error) {
+	resp, err := a.oauth2.Client(ctx, token).Get(a.userinfoURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("userinfo: %s", resp.Status)
+	}
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return "", err
+	}
+	if verified, ok := claims["email_verified"].(bool); a.config.Claim == "email" && ok && !verified {
+		return "", fmt.Errorf("email isn't verified")
+	}
+	user, _ := claims[a.config.Claim].(string)
+	if user == "" {
+		return "", fmt.Errorf("no %s claim", a.config.Claim)
+	}
+	return user, nil
+}
+
+func (a *oidcAuthenticator) handleLogout(w http.ResponseWriter, r *http.Request) {
+	a.setCookie(w, oidcSessionCookie, "", -time.Second)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,175 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// fakeOIDCProvider logs in whoever it is asked to, with the code "code".
+func fakeOIDCProvider(t *testing.T, email string) *httptest.Server {
+	router := mux.NewRouter()
+	var provider *httptest.Server
+	router.Path("/.well-known/openid-configuration").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/authorize",
+			"token_endpoint":         provider.URL + "/token",
+			"userinfo_endpoint":      provider.URL + "/userinfo",
+		})
+	})
+	router.Path("/authorize").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirect, err := url.Parse(r.FormValue("redirect_uri"))
+		ok(t, err)
+		redirect.RawQuery = url.Values{"code": {"code"}, "state": {r.FormValue("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	router.Path("/token").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	router.Path("/userinfo").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            "1234",
+			"email":          email,
+			"email_verified": true,
+		})
+	})
+	provider = httptest.NewServer(router)
+	return provider
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	provider := fakeOIDCProvider(t, "alice@example.com")
+	defer provider.Close()
+
+	dir, err := ioutil.TempDir("", "users")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	users, err := app.NewUserStore(filepath.Join(dir, "users.json"))
+	ok(t, err)
+	ok(t, users.PutUser(app.User{Name: "alice@example.com", Role: app.RoleOperator}))
+	audit := app.NewAuditLog(noUser, 10, "")
+	cr := app.NewAuditingControlRouter(app.NewLocalControlRouter(), audit)
+	cr.Register(context.Background(), "probe1", func(req xfer.Request) xfer.Response { return xfer.Response{} })
+	router := mux.NewRouter()
+	app.RegisterUserRoutes(router, users)
+	app.RegisterControlRoutes(router, cr)
+	app.RegisterAuditRoutes(router, audit)
+	// The app needs to know its URL before it is wrapped
+	var wrapped http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { wrapped.ServeHTTP(w, r) }))
+	defer ts.Close()
+
+	authn, err := app.NewOIDCAuthenticator(app.OIDCConfig{
+		IssuerURL:     provider.URL,
+		ClientID:      "scope",
+		ClientSecret:  "secret",
+		RedirectURL:   ts.URL + "/oidc/callback",
+		Claim:         "email",
+		SessionLength: time.Hour,
+	})
+	ok(t, err)
+	authorizer, err := app.NewAuthorizer(authn, users, app.RoleViewer, "", nil)
+	ok(t, err)
+	wrapped = authorizer.Wrap(router)
+
+	jar, err := cookiejar.New(nil)
+	ok(t, err)
+	client := &http.Client{Jar: jar}
+
+	// API requests are refused until logged in
+	res, err := client.Get(ts.URL + "/api/whoami")
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusUnauthorized, res.StatusCode)
+
+	// Browsers are sent to log in, and back
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Path == "/" {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	res, err = client.Get(ts.URL + "/")
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusFound, res.StatusCode)
+	equals(t, "/", res.Header.Get("Location"))
+
+	// Then known as who the provider says, in the default role
+	res, err = client.Get(ts.URL + "/api/whoami")
+	ok(t, err)
+	var identity app.Identity
+	ok(t, json.NewDecoder(res.Body).Decode(&identity))
+	res.Body.Close()
+	equals(t, app.Identity{User: "alice@example.com", Role: app.RoleOperator, LogoutURL: "/oidc/logout"}, identity)
+
+	// Tampered sessions aren't
+	u, _ := url.Parse(ts.URL)
+	cookies := jar.Cookies(u)
+	equals(t, 1, len(cookies))
+	cookies[0].Value = "x" + cookies[0].Value
+	jar.SetCookies(u, cookies)
+	res, err = client.Get(ts.URL + "/api/whoami")
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusUnauthorized, res.StatusCode)
+
+	// API clients can use access tokens, and who they are is audited
+	bearer := func(method, path string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		ok(t, err)
+		req.Header.Set("Authorization", "Bearer token")
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		return res
+	}
+	res = bearer("POST", "/api/control/probe1/pod1/kubernetes_delete_pod")
+	res.Body.Close()
+	equals(t, http.StatusOK, res.StatusCode)
+	res = bearer("GET", "/api/audit")
+	equals(t, http.StatusForbidden, res.StatusCode)
+	res.Body.Close()
+	ok(t, users.PutUser(app.User{Name: "alice@example.com", Role: app.RoleAdmin}))
+	res = bearer("GET", "/api/audit")
+	var records []app.AuditRecord
+	ok(t, json.NewDecoder(res.Body).Decode(&records))
+	res.Body.Close()
+	equals(t, 1, len(records))
+	equals(t, "alice@example.com", records[0].Actor)
+	equals(t, app.RoleOperator, records[0].Role)
+
+	req, err := http.NewRequest("GET", ts.URL+"/api/whoami", nil)
+	ok(t, err)
+	req.Header.Set("Authorization", "Bearer forged")
+	res, err = http.DefaultClient.Do(req)
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusUnauthorized, res.StatusCode)
+}
@@ -0,0 +1,557 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// Modes in which users join pipes shared with them.
+const (
+	PipeReadOnly  = "read-only"
+	PipeReadWrite = "read-write"
+
+	// How much output a participant can fall behind by before being
+	// disconnected, rather than holding up the others.
+	pipeParticipantBacklog = 256
+)
+
+// ErrPipeShareNotFound is returned when asked for shares which aren't
+// there, or aren't the user's.
+var ErrPipeShareNotFound = errors.New("pipe share not found")
+
+// PipeShare lets others join a pipe, by connecting to the UI end of the
+// pipe with the token for an ID.
+type PipeShare struct {
+	Token   string    `json:"token"`
+	PipeID  string    `json:"pipeID"`
+	Mode    string    `json:"mode"`
+	User    string    `json:"user,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// PipeParticipant is someone connected to the UI end of a pipe.
+type PipeParticipant struct {
+	Name   string    `json:"name"`
+	Mode   string    `json:"mode"`
+	Owner  bool      `json:"owner,omitempty"`
+	Joined time.Time `json:"joined"`
+}
+
+// SharingPipeRouter wraps a PipeRouter, letting several people connect to
+// the UI end of pipes at once: everyone sees the output, and those who can
+// write type into the same terminal, for pair debugging.
+//
+// Whoever connects with the ID of the pipe owns it, and can share it in
+// either mode. Others connect with the token of a share, so the ID of the
+// pipe, which would let them write, is never given away. Tokens only work
+// for the user which shared the pipe.
+type SharingPipeRouter struct {
+	PipeRouter
+	userIDer func(context.Context) (string, error)
+
+	sync.Mutex
+	shares map[string]PipeShare   // by token
+	pipes  map[string]*sharedPipe // by pipe ID
+}
+
+// NewSharingPipeRouter makes a SharingPipeRouter sharing the pipes of pr.
+// userIDer identifies the user of a request.
+func NewSharingPipeRouter(pr PipeRouter, userIDer func(context.Context) (string, error)) *SharingPipeRouter {
+	return &SharingPipeRouter{
+		PipeRouter: pr,
+		userIDer:   userIDer,
+		shares:     map[string]PipeShare{},
+		pipes:      map[string]*sharedPipe{},
+	}
+}
+
+// resolve returns the ID of the pipe id is the token of a share of, and
+// the share, or else id.
+func (s *SharingPipeRouter) resolve(id string) (string, *PipeShare) {
+	s.Lock()
+	defer s.Unlock()
+	if share, ok := s.shares[id]; ok {
+		return share.PipeID, &share
+	}
+	return id, nil
+}
+
+// Exists tells whether the pipe with the ID, or shared with the token,
+// exists.
+func (s *SharingPipeRouter) Exists(ctx context.Context, id string) (bool, error) {
+	pipeID, _ := s.resolve(id)
+	return s.PipeRouter.Exists(ctx, pipeID)
+}
+
+// Get connects a participant to the UI end of the pipe with the ID, or
+// shared with the token, and anyone to its probe end. Participants leave
+// by closing the end they are given, which releases it.
+func (s *SharingPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	if e != UIEnd {
+		return s.PipeRouter.Get(ctx, id, e)
+	}
+	pipeID, share := s.resolve(id)
+	participant := PipeParticipant{
+		Name:   participantName(ctx),
+		Mode:   PipeReadWrite,
+		Owner:  true,
+		Joined: mtime.Now(),
+	}
+	if share != nil {
+		userID, err := s.userIDer(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if userID != share.User {
+			return nil, nil, fmt.Errorf("pipe %s isn't shared with %q", pipeID, userID)
+		}
+		participant.Mode, participant.Owner = share.Mode, false
+	}
+
+	pipe, endIO, err := s.PipeRouter.Get(ctx, pipeID, UIEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	shared, ok := s.pipes[pipeID]
+	if !ok {
+		shared = newSharedPipe(pipeID, endIO)
+		s.pipes[pipeID] = shared
+		go func() {
+			shared.broadcast()
+			s.Lock()
+			if s.pipes[pipeID] == shared {
+				delete(s.pipes, pipeID)
+			}
+			s.Unlock()
+		}()
+	}
+	var token string
+	if share != nil {
+		token = share.Token
+	}
+	release := func() {
+		if err := s.PipeRouter.Release(ctx, pipeID, UIEnd); err != nil {
+			log.Debugf("Error releasing pipe %s: %v", pipeID, err)
+		}
+	}
+	return pipe, shared.join(participant, token, release), nil
+}
+
+// Release releases the probe end of the pipe with the ID. Participants
+// release the UI end when they leave, as they may have joined with a
+// token since revoked.
+func (s *SharingPipeRouter) Release(ctx context.Context, id string, e End) error {
+	if e != UIEnd {
+		return s.PipeRouter.Release(ctx, id, e)
+	}
+	return nil
+}
+
+// Delete closes the pipe with the ID, but only disconnects from those
+// shared with tokens, as only owners can close pipes.
+func (s *SharingPipeRouter) Delete(ctx context.Context, id string) error {
+	pipeID, share := s.resolve(id)
+	if share != nil {
+		return nil
+	}
+	s.Lock()
+	for token, share := range s.shares {
+		if share.PipeID == pipeID {
+			delete(s.shares, token)
+		}
+	}
+	if shared, ok := s.pipes[pipeID]; ok {
+		shared.close()
+		delete(s.pipes, pipeID)
+	}
+	s.Unlock()
+	return s.PipeRouter.Delete(ctx, pipeID)
+}
+
+// Share shares the pipe with the ID in the mode.
+func (s *SharingPipeRouter) Share(ctx context.Context, pipeID, mode string) (PipeShare, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return PipeShare{}, err
+	}
+	token, err := newPipeShareToken()
+	if err != nil {
+		return PipeShare{}, err
+	}
+	share := PipeShare{
+		Token:   token,
+		PipeID:  pipeID,
+		Mode:    mode,
+		User:    userID,
+		Created: mtime.Now(),
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.shares[token] = share
+	return share, nil
+}
+
+// Shares returns the shares of the pipe with the ID, oldest first.
+func (s *SharingPipeRouter) Shares(ctx context.Context, pipeID string) ([]PipeShare, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	shares := []PipeShare{}
+	for _, share := range s.shares {
+		if share.PipeID == pipeID && share.User == userID {
+			shares = append(shares, share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Created.Before(shares[j].Created) })
+	return shares, nil
+}
+
+// Unshare revokes the share of the pipe with the ID, disconnecting those
+// who joined with it.
+func (s *SharingPipeRouter) Unshare(ctx context.Context, pipeID, token string) error {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	share, ok := s.shares[token]
+	if !ok || share.PipeID != pipeID || share.User != userID {
+		return ErrPipeShareNotFound
+	}
+	delete(s.shares, token)
+	if shared, ok := s.pipes[pipeID]; ok {
+		shared.kick(token)
+	}
+	return nil
+}
+
+// Participants returns who is connected to the UI end of the pipe with the
+// ID, or shared with the token, in the order they joined.
+func (s *SharingPipeRouter) Participants(ctx context.Context, id string) []PipeParticipant {
+	pipeID, _ := s.resolve(id)
+	s.Lock()
+	shared, ok := s.pipes[pipeID]
+	s.Unlock()
+	if !ok {
+		return []PipeParticipant{}
+	}
+	return shared.participants()
+}
+
+func newPipeShareToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "share-" + hex.EncodeToString(buf), nil
+}
+
+// participantName names participants by the name parameter of their
+// request, or else where they connect from.
+func participantName(ctx context.Context) string {
+	r, ok := ctx.Value(RequestCtxKey).(*http.Request)
+	if !ok || r == nil {
+		return ""
+	}
+	if name := r.FormValue("name"); name != "" {
+		return name
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// sharedPipe copies the output of the UI end of a pipe to all its
+// participants.
+type sharedPipe struct {
+	id    string
+	endIO io.ReadWriter
+
+	sync.Mutex
+	cond   *sync.Cond // signalled when participants join, or the pipe closes
+	joined []*participant
+	closed bool
+}
+
+func newSharedPipe(id string, endIO io.ReadWriter) *sharedPipe {
+	s := &sharedPipe{id: id, endIO: endIO}
+	s.cond = sync.NewCond(&s.Mutex)
+	return s
+}
+
+// broadcast copies the output of the pipe to the participants, until it
+// closes. Output waits for someone to connect, as it would without
+// sharing.
+func (s *sharedPipe) broadcast() {
+	buf := make([]byte, 1024)
+	for {
+		n, err := s.endIO.Read(buf)
+		if err != nil {
+			s.close()
+			return
+		}
+		data := append([]byte{}, buf[:n]...)
+
+		s.Lock()
+		for len(s.joined) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.Unlock()
+			return
+		}
+		for _, p := range s.joined {
+			select {
+			case p.out <- data:
+			default:
+				log.Warnf("Disconnecting %s from pipe %s, as they are too far behind", p.Name, s.id)
+				s.leave(p)
+			}
+		}
+		s.Unlock()
+	}
+}
+
+func (s *sharedPipe) join(info PipeParticipant, token string, release func()) *participant {
+	p := &participant{
+		PipeParticipant: info,
+		shared:          s,
+		token:           token,
+		release:         release,
+		out:             make(chan []byte, pipeParticipantBacklog),
+		in:              s.endIO,
+	}
+	if info.Mode == PipeReadOnly {
+		p.in = ioutil.Discard
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		close(p.out)
+		return p
+	}
+	s.joined = append(s.joined, p)
+	s.cond.Broadcast()
+	return p
+}
+
+// leave disconnects the participant; call with the lock held.
+func (s *sharedPipe) leave(p *participant) {
+	for i, joined := range s.joined {
+		if joined == p {
+			s.joined = append(s.joined[:i], s.joined[i+1:]...)
+			close(p.out)
+			return
+		}
+	}
+}
+
+// kick disconnects those who joined with the token.
+func (s *sharedPipe) kick(token string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, p := range append([]*participant{}, s.joined...) {
+		if p.token == token {
+			s.leave(p)
+		}
+	}
+}
+
+func (s *sharedPipe) close() {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, p := range s.joined {
+		close(p.out)
+	}
+	s.joined = nil
+	s.cond.Broadcast()
+}
+
+func (s *sharedPipe) participants() []PipeParticipant {
+	s.Lock()
+	defer s.Unlock()
+	participants := make([]PipeParticipant, 0, len(s.joined))
+	for _, p := range s.joined {
+		participants = append(participants, p.PipeParticipant)
+	}
+	return participants
+}
+
+// participant is the UI end of a shared pipe, as given to one of its
+// participants: reads are the output of the pipe, and writes go to it
+// unless they joined read-only.
+type participant struct {
+	PipeParticipant
+	shared  *sharedPipe
+	token   string
+	out     chan []byte
+	in      io.Writer
+	buf     []byte
+	release func()
+	closed  sync.Once
+}
+
+func (p *participant) Read(b []byte) (int, error) {
+	if len(p.buf) == 0 {
+		buf, ok := <-p.out
+		if !ok {
+			return 0, io.EOF
+		}
+		p.buf = buf
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+func (p *participant) Write(b []byte) (int, error) {
+	return p.in.Write(b)
+}
+
+// Close leaves the pipe, and releases the UI end taken for the
+// participant.
+func (p *participant) Close() error {
+	p.closed.Do(func() {
+		p.shared.Lock()
+		p.shared.leave(p)
+		p.shared.Unlock()
+		p.release()
+	})
+	return nil
+}
+
+// RegisterPipeSharingRoutes registers the routes for sharing pipes, and
+// seeing who is connected to them, with a http mux.
+func RegisterPipeSharingRoutes(router *mux.Router, s *SharingPipeRouter) {
+	router.Methods("GET").
+		Name("api_pipe_pipeid_participants").
+		Path("/api/pipe/{pipeID}/participants").
+		HandlerFunc(requestContextDecorator(handlePipeParticipants(s)))
+
+	router.Methods("GET").
+		Name("api_pipe_pipeid_shares").
+		Path("/api/pipe/{pipeID}/shares").
+		HandlerFunc(requestContextDecorator(handleListPipeShares(s)))
+
+	router.Methods("POST").
+		Name("api_pipe_pipeid_shares").
+		Path("/api/pipe/{pipeID}/shares").
+		HandlerFunc(requestContextDecorator(handleSharePipe(s)))
+
+	router.Methods("DELETE").
+		Name("api_pipe_pipeid_shares_token").
+		Path("/api/pipe/{pipeID}/shares/{token}").
+		HandlerFunc(requestContextDecorator(handleUnsharePipe(s)))
+}
+
+func handlePipeParticipants(s *SharingPipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, s.Participants(ctx, mux.Vars(r)["pipeID"]))
+	}
+}
+
+// ownedPipeID returns the ID of the pipe of the request, unless it is the
+// token of a share: only owners can manage shares.
+func ownedPipeID(s *SharingPipeRouter, w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["pipeID"]
+	if _, share := s.resolve(id); share != nil {
+		respondWith(w, http.StatusForbidden, fmt.Errorf("only the owner of a pipe can share it"))
+		return "", false
+	}
+	return id, true
+}
+
+func handleListPipeShares(s *SharingPipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pipeID, ok := ownedPipeID(s, w, r)
+		if !ok {
+			return
+		}
+		shares, err := s.Shares(ctx, pipeID)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWith(w, http.StatusOK, shares)
+	}
+}
+
+func handleSharePipe(s *SharingPipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pipeID, ok := ownedPipeID(s, w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Mode != PipeReadOnly && req.Mode != PipeReadWrite {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("mode must be %s or %s", PipeReadOnly, PipeReadWrite))
+			return
+		}
+		exists, err := s.Exists(ctx, pipeID)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		} else if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		share, err := s.Share(ctx, pipeID, req.Mode)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWith(w, http.StatusCreated, share)
+	}
+}
+
+func handleUnsharePipe(s *SharingPipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pipeID, ok := ownedPipeID(s, w, r)
+		if !ok {
+			return
+		}
+		err := s.Unshare(ctx, pipeID, mux.Vars(r)["token"])
+		if err == ErrPipeShareNotFound {
+			respondWith(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
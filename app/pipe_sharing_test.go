@@ -0,0 +1,165 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// countingPipeRouter counts the references to UI ends taken, and
+// released for real.
+type countingPipeRouter struct {
+	app.PipeRouter
+
+	sync.Mutex
+	got, released int
+}
+
+func (c *countingPipeRouter) Get(ctx context.Context, id string, e app.End) (xfer.Pipe, io.ReadWriter, error) {
+	if e == app.UIEnd {
+		c.Lock()
+		c.got++
+		c.Unlock()
+	}
+	return c.PipeRouter.Get(ctx, id, e)
+}
+
+func (c *countingPipeRouter) Release(ctx context.Context, id string, e app.End) error {
+	err := c.PipeRouter.Release(ctx, id, e)
+	if e == app.UIEnd && err == nil {
+		c.Lock()
+		c.released++
+		c.Unlock()
+	}
+	return err
+}
+
+func (c *countingPipeRouter) referenced() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.got - c.released
+}
+
+func TestSharingPipeRouter(t *testing.T) {
+	counting := &countingPipeRouter{PipeRouter: app.NewLocalPipeRouter()}
+	pr := app.NewSharingPipeRouter(counting, noUserID)
+	defer pr.Stop()
+	router := mux.NewRouter()
+	app.RegisterPipeRoutes(router, pr)
+	app.RegisterPipeSharingRoutes(router, pr)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	ctx := context.Background()
+	_, probe, err := pr.Get(ctx, "pipe1", app.ProbeEnd)
+	ok(t, err)
+	defer pr.Release(ctx, "pipe1", app.ProbeEnd)
+	input := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := probe.Read(buf)
+			if err != nil {
+				return
+			}
+			input <- string(buf[:n])
+		}
+	}()
+
+	share := func(mode string) app.PipeShare {
+		res, body := checkRequest(t, ts, "POST", "/api/pipe/pipe1/shares", []byte(`{"mode": "`+mode+`"}`))
+		equals(t, http.StatusCreated, res.StatusCode)
+		var share app.PipeShare
+		ok(t, json.Unmarshal(body, &share))
+		return share
+	}
+	viewer, pair := share(app.PipeReadOnly), share(app.PipeReadWrite)
+	res, _ := checkRequest(t, ts, "POST", "/api/pipe/pipe1/shares", []byte(`{"mode": "sudo"}`))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+	// Only owners can share pipes
+	res, _ = checkRequest(t, ts, "POST", "/api/pipe/"+viewer.Token+"/shares", []byte(`{"mode": "read-write"}`))
+	equals(t, http.StatusForbidden, res.StatusCode)
+
+	dial := func(id, name string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/pipe/" + id + "?name=" + name
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		ok(t, err)
+		return conn
+	}
+	owner := dial("pipe1", "owner")
+	alice := dial(viewer.Token, "alice")
+	bob := dial(pair.Token, "bob")
+	defer bob.Close()
+
+	var participants []app.PipeParticipant
+	for i := 0; i < 50 && len(participants) < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/pipe/"+viewer.Token+"/participants"), &participants))
+	}
+	equals(t, 3, len(participants))
+	equals(t, "owner", participants[0].Name)
+	equals(t, true, participants[0].Owner)
+	equals(t, app.PipeReadOnly, participants[1].Mode)
+	equals(t, app.PipeReadWrite, participants[2].Mode)
+
+	// Everyone sees the output
+	_, err = probe.Write([]byte("$ "))
+	ok(t, err)
+	for _, conn := range []*websocket.Conn{owner, alice, bob} {
+		_, buf, err := conn.ReadMessage()
+		ok(t, err)
+		equals(t, "$ ", string(buf))
+	}
+
+	// But only those who can write get to type
+	ok(t, alice.WriteMessage(websocket.BinaryMessage, []byte("rm -rf /\n")))
+	ok(t, bob.WriteMessage(websocket.BinaryMessage, []byte("ls\n")))
+	select {
+	case in := <-input:
+		equals(t, "ls\n", in)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for input")
+	}
+
+	// Revoking a share disconnects those who joined with it
+	res, _ = checkRequest(t, ts, "DELETE", "/api/pipe/pipe1/shares/"+pair.Token, nil)
+	equals(t, http.StatusNoContent, res.StatusCode)
+	bob.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = bob.ReadMessage()
+	equals(t, true, err != nil)
+	var shares []app.PipeShare
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/pipe/pipe1/shares"), &shares))
+	equals(t, 1, len(shares))
+	equals(t, viewer.Token, shares[0].Token)
+
+	// Those joining with tokens can't close the pipe
+	ok(t, pr.Delete(ctx, viewer.Token))
+	exists, err := pr.Exists(ctx, "pipe1")
+	ok(t, err)
+	equals(t, true, exists)
+	_, err = probe.Write([]byte("still here"))
+	ok(t, err)
+	_, buf, err := owner.ReadMessage()
+	ok(t, err)
+	equals(t, "still here", string(buf))
+
+	// Everyone leaving releases all the references they took to the pipe
+	owner.Close()
+	alice.Close()
+	for i := 0; i < 50 && counting.referenced() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	equals(t, 0, counting.referenced())
+}
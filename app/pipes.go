@@ -1,6 +1,7 @@
 package app
 
 import (
+	"io"
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
@@ -58,6 +59,9 @@ func handlePipeWs(pr PipeRouter, end End) CtxHandlerFunc {
 			return
 		}
 		defer pr.Release(ctx, id, end)
+		if closer, ok := endIO.(io.Closer); ok {
+			defer closer.Close()
+		}
 
 		conn, err := xfer.Upgrade(w, r, nil)
 		if err != nil {
@@ -66,7 +70,7 @@ func handlePipeWs(pr PipeRouter, end End) CtxHandlerFunc {
 		}
 		defer conn.Close()
 
-		if err := pipe.CopyToWebsocket(endIO, conn); err != nil && !xfer.IsExpectedWSCloseError(err) {
+		if err := pipe.CopyToWebsocket(endIO, conn); err != nil && err != io.EOF && !xfer.IsExpectedWSCloseError(err) {
 			log.Errorf("Error copying to pipe %s (%d) websocket: %v", id, end, err)
 		}
 	}
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// DefaultProbeStaleAfter is how long probes may go without reporting
+	// before they are stale, unless configured otherwise.
+	DefaultProbeStaleAfter = time.Minute
+
+	// probeHealthRetention is how long probes are kept after they were
+	// last heard from, so those which failed silently show up as stale.
+	probeHealthRetention = 24 * time.Hour
+)
+
+// ProbeHealth is how a probe is doing, as its reports tell.
+type ProbeHealth struct {
+	ID               string    `json:"id"`
+	Hostname         string    `json:"hostname,omitempty"`
+	Version          string    `json:"version,omitempty"`
+	Reporters        []string  `json:"reporters,omitempty"`
+	LastReport       time.Time `json:"lastReport"`
+	LastReportAge    float64   `json:"lastReportAgeSeconds"`
+	Stale            bool      `json:"stale"`
+	Reports          int       `json:"reports"`
+	RejectedReports  int       `json:"rejectedReports"`
+	LastRejection    string    `json:"lastRejection,omitempty"`
+	PublishErrors    int       `json:"publishErrors"`
+	LastPublishError string    `json:"lastPublishError,omitempty"`
+	DroppedReports   int       `json:"droppedReports"`
+	ClockSkew        float64   `json:"clockSkewSeconds"`
+}
+
+// ProbeFleetHealth sums up how the probes are doing.
+type ProbeFleetHealth struct {
+	Probes   int            `json:"probes"`
+	Healthy  int            `json:"healthy"`
+	Stale    int            `json:"stale"`
+	Erroring int            `json:"erroring"`
+	Versions map[string]int `json:"versions"`
+	Health   []ProbeHealth  `json:"health"`
+}
+
+// ProbeHealthTracker tracks the health of probes, by the reports they
+// post, so probes which fail silently can be told apart.
+type ProbeHealthTracker struct {
+	userIDer   func(context.Context) (string, error)
+	staleAfter time.Duration
+
+	mtx    sync.Mutex
+	probes map[string]*trackedProbe // by user and ID
+}
+
+type trackedProbe struct {
+	ProbeHealth
+	user string
+	seen time.Time // last reported, or had a report rejected
+}
+
+// NewProbeHealthTracker makes a new ProbeHealthTracker, reckoning probes
+// which haven't reported for staleAfter stale. userIDer identifies the
+// user probes report for; users only see the health of their own probes.
+func NewProbeHealthTracker(userIDer func(context.Context) (string, error), staleAfter time.Duration) *ProbeHealthTracker {
+	if staleAfter <= 0 {
+		staleAfter = DefaultProbeStaleAfter
+	}
+	return &ProbeHealthTracker{
+		userIDer:   userIDer,
+		staleAfter: staleAfter,
+		probes:     map[string]*trackedProbe{},
+	}
+}
+
+// Probe returns the health of the probe with the ID, of the user of ctx.
+func (t *ProbeHealthTracker) Probe(ctx context.Context, id string) (ProbeHealth, bool) {
+	userID, err := t.userIDer(ctx)
+	if err != nil {
+		return ProbeHealth{}, false
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	probe, ok := t.probes[userID+"/"+id]
+	if !ok {
+		return ProbeHealth{}, false
+	}
+	return t.health(probe, mtime.Now()), true
+}
+
+// Fleet returns the health of the probes of the user of ctx, the stalest
+// first.
+func (t *ProbeHealthTracker) Fleet(ctx context.Context) (ProbeFleetHealth, error) {
+	userID, err := t.userIDer(ctx)
+	if err != nil {
+		return ProbeFleetHealth{}, err
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	now := mtime.Now()
+	fleet := ProbeFleetHealth{Versions: map[string]int{}, Health: []ProbeHealth{}}
+	for key, probe := range t.probes {
+		if now.Sub(probe.seen) > probeHealthRetention {
+			delete(t.probes, key)
+			continue
+		}
+		if probe.user != userID {
+			continue
+		}
+		health := t.health(probe, now)
+		fleet.Probes++
+		switch {
+		case health.Stale:
+			fleet.Stale++
+		case health.PublishErrors > 0 || health.RejectedReports > 0:
+			fleet.Erroring++
+		default:
+			fleet.Healthy++
+		}
+		fleet.Versions[health.Version]++
+		fleet.Health = append(fleet.Health, health)
+	}
+	sort.Slice(fleet.Health, func(i, j int) bool {
+		if fleet.Health[i].LastReport.Equal(fleet.Health[j].LastReport) {
+			return fleet.Health[i].ID < fleet.Health[j].ID
+		}
+		return fleet.Health[i].LastReport.Before(fleet.Health[j].LastReport)
+	})
+	return fleet, nil
+}
+
+func (t *ProbeHealthTracker) health(probe *trackedProbe, now time.Time) ProbeHealth {
+	health := probe.ProbeHealth
+	if !health.LastReport.IsZero() {
+		age := now.Sub(health.LastReport)
+		health.LastReportAge = age.Seconds()
+		health.Stale = age > t.staleAfter
+	}
+	return health
+}
+
+func (t *ProbeHealthTracker) probe(userID, id string) *trackedProbe {
+	probe, ok := t.probes[userID+"/"+id]
+	if !ok {
+		probe = &trackedProbe{ProbeHealth: ProbeHealth{ID: id}, user: userID}
+		t.probes[userID+"/"+id] = probe
+	}
+	probe.seen = mtime.Now()
+	return probe
+}
+
+// reported records the report the probe of the user posted.
+func (t *ProbeHealthTracker) reported(userID, id string, rpt report.Report) {
+	now := mtime.Now()
+	skew, hasSkew := clockSkew(rpt, now)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	probe := t.probe(userID, id)
+	probe.LastReport = now
+	probe.Reports++
+	if hasSkew {
+		probe.ClockSkew = skew.Seconds()
+	}
+	node, ok := rpt.ScopeProbe.Nodes[report.MakeScopeProbeNodeID(id)]
+	if !ok {
+		// Probes too old to report themselves
+		return
+	}
+	if hostname, ok := node.Latest.Lookup(report.ScopeProbeHostname); ok {
+		probe.Hostname = hostname
+	}
+	if version, ok := node.Latest.Lookup(report.ScopeProbeVersion); ok {
+		probe.Version = version
+	}
+	if reporters, ok := node.Latest.Lookup(report.ScopeProbeReporters); ok {
+		probe.Reporters = strings.Split(reporters, ",")
+	}
+	probe.PublishErrors = latestInt(node, report.ScopeProbePublishErrors)
+	probe.DroppedReports = latestInt(node, report.ScopeProbeDroppedReports)
+	probe.LastPublishError, _ = node.Latest.Lookup(report.ScopeProbeLastPublishError)
+}
+
+// rejected records the report of the probe of the user being rejected.
+func (t *ProbeHealthTracker) rejected(userID, id string, err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	probe := t.probe(userID, id)
+	probe.RejectedReports++
+	probe.LastRejection = err.Error()
+}
+
+func latestInt(node report.Node, key string) int {
+	value, _ := node.Latest.Lookup(key)
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+// NewProbeHealthAdder returns an Adder which tracks the health of the
+// probes by the reports they post, and whether they are accepted, before
+// passing them on to the Adder.
+func NewProbeHealthAdder(a Adder, t *ProbeHealthTracker) Adder {
+	return probeHealthAdder{Adder: a, tracker: t}
+}
+
+type probeHealthAdder struct {
+	Adder
+	tracker *ProbeHealthTracker
+}
+
+// Add implements Adder.
+func (h probeHealthAdder) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	id := requestProbeID(ctx)
+	err := h.Adder.Add(ctx, rpt, buf)
+	if id == "" {
+		return err
+	}
+	userID, userErr := h.tracker.userIDer(ctx)
+	if userErr != nil {
+		return err
+	}
+	if err != nil {
+		h.tracker.rejected(userID, id, err)
+	} else {
+		h.tracker.reported(userID, id, rpt)
+	}
+	return err
+}
+
+// RegisterProbeHealthRoutes registers the routes of the health of probes.
+func RegisterProbeHealthRoutes(router *mux.Router, t *ProbeHealthTracker) {
+	router.Methods("GET").Path("/api/probes/health").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			fleet, err := t.Fleet(ctx)
+			if err != nil {
+				respondWith(w, http.StatusUnauthorized, err)
+				return
+			}
+			respondWith(w, http.StatusOK, fleet)
+		}))
+	router.Methods("GET").Path("/api/probes/{id}/health").
+		HandlerFunc(requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			health, ok := t.Probe(ctx, mux.Vars(r)["id"])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondWith(w, http.StatusOK, health)
+		}))
+}
@@ -0,0 +1,146 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+type rejectingAdder struct{}
+
+func (rejectingAdder) Add(context.Context, report.Report, []byte) error {
+	return fmt.Errorf("rejected")
+}
+
+func TestProbeHealth(t *testing.T) {
+	now := time.Now().UTC()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	probeCtx := func(user, id string) context.Context {
+		r := httptest.NewRequest("POST", "/api/report", nil)
+		r.Header.Set(xfer.ScopeProbeIDHeader, id)
+		r.Header.Set(userHeader, user)
+		return context.WithValue(context.Background(), app.RequestCtxKey, r)
+	}
+	userIDer := func(ctx context.Context) (string, error) {
+		r, ok := ctx.Value(app.RequestCtxKey).(*http.Request)
+		if !ok || r.Header.Get(userHeader) == "" {
+			return "", fmt.Errorf("no user")
+		}
+		return r.Header.Get(userHeader), nil
+	}
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("host"), map[string]string{
+		host.Timestamp: now.Add(3 * time.Second).Format(time.RFC3339Nano),
+	}))
+	rpt.ScopeProbe.AddNode(report.MakeNodeWith(report.MakeScopeProbeNodeID("good"), map[string]string{
+		report.ScopeProbeVersion:       "1.2.3",
+		report.ScopeProbeHostname:      "host",
+		report.ScopeProbeReporters:     "Host,Process",
+		report.ScopeProbePublishErrors: "2",
+	}))
+
+	tracker := app.NewProbeHealthTracker(userIDer, time.Minute)
+	if err := app.NewProbeHealthAdder(&recordingAdder{}, tracker).Add(probeCtx("alice", "good"), rpt, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.NewProbeHealthAdder(rejectingAdder{}, tracker).Add(probeCtx("alice", "bad"), rpt, nil); err == nil {
+		t.Fatal("expected the rejection to be passed on")
+	}
+	if err := app.NewProbeHealthAdder(&recordingAdder{}, tracker).Add(probeCtx("bob", "other"), rpt, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime.NowForce(now.Add(2 * time.Minute))
+	router := mux.NewRouter()
+	app.RegisterProbeHealthRoutes(router, tracker)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var health app.ProbeHealth
+	getJSON(t, server.URL+"/api/probes/good/health", "alice", &health)
+	want := app.ProbeHealth{
+		ID:            "good",
+		Hostname:      "host",
+		Version:       "1.2.3",
+		Reporters:     []string{"Host", "Process"},
+		LastReport:    now,
+		LastReportAge: 120,
+		Stale:         true,
+		Reports:       1,
+		PublishErrors: 2,
+		ClockSkew:     3,
+	}
+	if !health.LastReport.Equal(want.LastReport) {
+		t.Errorf("expected last report at %v, got %v", want.LastReport, health.LastReport)
+	}
+	health.LastReport = want.LastReport
+	if !reflect.DeepEqual(health, want) {
+		t.Errorf("expected %+v, got %+v", want, health)
+	}
+
+	var fleet app.ProbeFleetHealth
+	getJSON(t, server.URL+"/api/probes/health", "alice", &fleet)
+	if fleet.Probes != 2 || fleet.Stale != 1 || fleet.Erroring != 1 || fleet.Healthy != 0 {
+		t.Errorf("unexpected fleet health: %+v", fleet)
+	}
+	if len(fleet.Health) != 2 || fleet.Health[0].ID != "bad" || fleet.Health[0].RejectedReports != 1 {
+		t.Errorf("expected the probe which never reported first, got %+v", fleet.Health)
+	}
+
+	for _, path := range []string{"/api/probes/missing/health", "/api/probes/other/health"} {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Header.Set(userHeader, "alice")
+		if resp, err := http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for unknown probes, got %d", path, resp.StatusCode)
+		}
+	}
+
+	// Users only see their own probes
+	getJSON(t, server.URL+"/api/probes/health", "bob", &fleet)
+	if fleet.Probes != 1 || len(fleet.Health) != 1 || fleet.Health[0].ID != "other" {
+		t.Errorf("expected bob to only see their own probe, got %+v", fleet)
+	}
+	if resp, err := http.Get(server.URL + "/api/probes/health"); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a user, got %d", resp.StatusCode)
+	}
+}
+
+const userHeader = "X-Scope-User"
+
+func getJSON(t *testing.T, url, user string, v interface{}) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(userHeader, user)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,389 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+// Minted probe tokens look like probe-<id>.<secret>, which tells them apart
+// from service tokens.
+const probeTokenPrefix = "probe-"
+
+// Errors of the probe token store.
+var (
+	ErrProbeTokenNotFound = errors.New("probe token not found")
+)
+
+// ProbeToken is a token for probes on some hosts, or in some clusters, to
+// publish their reports with, until it expires or is revoked.
+type ProbeToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Hosts     []string   `json:"hosts,omitempty"`    // any if empty
+	Clusters  []string   `json:"clusters,omitempty"` // any if empty
+	Created   time.Time  `json:"created"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"` // never if nil
+	Revoked   bool       `json:"revoked"`
+	// Token is only ever shown when minted.
+	Token string `json:"token,omitempty"`
+}
+
+type storedProbeToken struct {
+	ProbeToken
+	Hash string `json:"hash"`
+}
+
+// probeTokenRejection is why reports published with a token were refused.
+type probeTokenRejection struct {
+	reason string
+}
+
+func (e probeTokenRejection) Error() string {
+	return "probe token rejected: " + e.reason
+}
+
+// ProbeTokenStore keeps the probe tokens minted through the API in a JSON
+// file, with the hashes of the tokens rather than the tokens themselves.
+type ProbeTokenStore struct {
+	path string
+
+	sync.Mutex
+	tokens map[string]storedProbeToken
+}
+
+// NewProbeTokenStore loads the probe tokens in the file at path, if there is
+// one.
+func NewProbeTokenStore(path string) (*ProbeTokenStore, error) {
+	s := &ProbeTokenStore{path: path, tokens: map[string]storedProbeToken{}}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var tokens []storedProbeToken
+	if err := json.Unmarshal(buf, &tokens); err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		s.tokens[token.ID] = token
+	}
+	return s, nil
+}
+
+// save writes the tokens to the file. s.Mutex must be held.
+func (s *ProbeTokenStore) save() error {
+	tokens := make([]storedProbeToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	buf, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func hashProbeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Mint makes a new token, with the name, scope and expiry of template, and
+// returns it with the token set.
+func (s *ProbeTokenStore) Mint(template ProbeToken) (ProbeToken, error) {
+	id, secret := make([]byte, 8), make([]byte, 20)
+	if _, err := rand.Read(id); err != nil {
+		return ProbeToken{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return ProbeToken{}, err
+	}
+	token := ProbeToken{
+		ID:        hex.EncodeToString(id),
+		Name:      template.Name,
+		Hosts:     template.Hosts,
+		Clusters:  template.Clusters,
+		Created:   mtime.Now(),
+		CreatedBy: template.CreatedBy,
+		Expires:   template.Expires,
+	}
+	value := probeTokenPrefix + token.ID + "." + hex.EncodeToString(secret)
+
+	s.Lock()
+	defer s.Unlock()
+	s.tokens[token.ID] = storedProbeToken{ProbeToken: token, Hash: hashProbeToken(value)}
+	if err := s.save(); err != nil {
+		delete(s.tokens, token.ID)
+		return ProbeToken{}, err
+	}
+	token.Token = value
+	return token, nil
+}
+
+// Tokens returns all the tokens, oldest first.
+func (s *ProbeTokenStore) Tokens() []ProbeToken {
+	s.Lock()
+	defer s.Unlock()
+	tokens := []ProbeToken{}
+	for _, token := range s.tokens {
+		tokens = append(tokens, token.ProbeToken)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	return tokens
+}
+
+// Token returns the token with the ID.
+func (s *ProbeTokenStore) Token(id string) (ProbeToken, error) {
+	s.Lock()
+	defer s.Unlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return ProbeToken{}, ErrProbeTokenNotFound
+	}
+	return token.ProbeToken, nil
+}
+
+// Revoke revokes the token with the ID, so reports published with it are
+// rejected from now on.
+func (s *ProbeTokenStore) Revoke(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return ErrProbeTokenNotFound
+	}
+	if token.Revoked {
+		return nil
+	}
+	token.Revoked = true
+	s.tokens[id] = token
+	if err := s.save(); err != nil {
+		token.Revoked = false
+		s.tokens[id] = token
+		return err
+	}
+	log.Infof("Revoked probe token %s (%s)", id, token.Name)
+	return nil
+}
+
+// Check returns the token of a minted value, if it is neither revoked nor
+// expired.
+func (s *ProbeTokenStore) Check(value string) (ProbeToken, error) {
+	parts := strings.SplitN(strings.TrimPrefix(value, probeTokenPrefix), ".", 2)
+	s.Lock()
+	token, ok := s.tokens[parts[0]]
+	s.Unlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashProbeToken(value))) != 1 {
+		return ProbeToken{}, probeTokenRejection{"unknown token"}
+	}
+	if token.Revoked {
+		return ProbeToken{}, probeTokenRejection{fmt.Sprintf("token %s is revoked", token.ID)}
+	}
+	if token.Expires != nil && mtime.Now().After(*token.Expires) {
+		return ProbeToken{}, probeTokenRejection{fmt.Sprintf("token %s expired at %s", token.ID, token.Expires.Format(time.RFC3339))}
+	}
+	return token.ProbeToken, nil
+}
+
+// isMintedProbeToken tells whether the value is one of ours, rather than a
+// service token.
+func isMintedProbeToken(value string) bool {
+	return strings.HasPrefix(value, probeTokenPrefix)
+}
+
+// requestProbeToken returns the token the probe of the request in ctx
+// authenticated with.
+func requestProbeToken(ctx context.Context) string {
+	r, ok := ctx.Value(RequestCtxKey).(*http.Request)
+	if !ok {
+		return ""
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, probeAuthorizationPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(auth, probeAuthorizationPrefix)
+}
+
+// probeTokenAdder is an Adder which rejects reports published with minted
+// tokens which are revoked, expired, or scoped to other hosts or clusters.
+type probeTokenAdder struct {
+	Adder
+	tokens *ProbeTokenStore
+}
+
+// NewProbeTokenAdder returns an Adder which checks the minted tokens reports
+// were published with, before passing them on to a. Reports published with
+// service tokens, or none, are passed on as before. A nil store disables it.
+func NewProbeTokenAdder(a Adder, tokens *ProbeTokenStore) Adder {
+	if tokens == nil {
+		return a
+	}
+	return probeTokenAdder{Adder: a, tokens: tokens}
+}
+
+// Add implements Adder.
+func (p probeTokenAdder) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	value := requestProbeToken(ctx)
+	if !isMintedProbeToken(value) {
+		return p.Adder.Add(ctx, rpt, buf)
+	}
+	token, err := p.tokens.Check(value)
+	if err != nil {
+		return err
+	}
+	if err := checkProbeTokenScope(token, rpt); err != nil {
+		return err
+	}
+	return p.Adder.Add(ctx, rpt, buf)
+}
+
+// checkProbeTokenScope checks the hosts of the report are ones the token is
+// for, and that the nodes of every other topology are on those hosts.
+func checkProbeTokenScope(token ProbeToken, rpt report.Report) error {
+	if len(rpt.Host.Nodes) == 0 {
+		return probeTokenRejection{fmt.Sprintf("token %s is only for reports with a host", token.ID)}
+	}
+	for _, n := range rpt.Host.Nodes {
+		if len(token.Hosts) > 0 {
+			name, _ := n.Latest.Lookup(host.HostName)
+			if !containsString(token.Hosts, name) {
+				return probeTokenRejection{fmt.Sprintf("token %s isn't for host %q", token.ID, name)}
+			}
+		}
+		if len(token.Clusters) > 0 {
+			cluster, _ := n.Latest.Lookup(host.ClusterName)
+			if !containsString(token.Clusters, cluster) {
+				return probeTokenRejection{fmt.Sprintf("token %s isn't for cluster %q", token.ID, cluster)}
+			}
+		}
+	}
+	var err error
+	rpt.WalkNamedTopologies(func(name string, t *report.Topology) {
+		for id, n := range t.Nodes {
+			if err != nil {
+				return
+			}
+			hostNodeIDs, _ := n.Parents.Lookup(report.Host)
+			if hostNodeID, ok := n.Latest.Lookup(report.HostNodeID); ok {
+				hostNodeIDs = hostNodeIDs.Merge(report.MakeStringSet(hostNodeID))
+			}
+			for _, hostNodeID := range hostNodeIDs {
+				if _, ok := rpt.Host.Nodes[hostNodeID]; !ok {
+					err = probeTokenRejection{fmt.Sprintf("token %s isn't for host %q of %s node %q", token.ID, hostNodeID, name, id)}
+					return
+				}
+			}
+		}
+	})
+	return err
+}
+
+func containsString(ss []string, s string) bool {
+	for _, candidate := range ss {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterProbeTokenRoutes registers the routes for minting, listing and
+// revoking probe tokens with a http mux.
+func RegisterProbeTokenRoutes(router *mux.Router, tokens *ProbeTokenStore) {
+	router.Methods("GET").Path("/api/probe-tokens").
+		HandlerFunc(requestContextDecorator(handleListProbeTokens(tokens)))
+	router.Methods("POST").Path("/api/probe-tokens").
+		HandlerFunc(requestContextDecorator(handleMintProbeToken(tokens)))
+	router.Methods("GET").Path("/api/probe-tokens/{id}").
+		HandlerFunc(requestContextDecorator(handleGetProbeToken(tokens)))
+	router.Methods("DELETE").Path("/api/probe-tokens/{id}").
+		HandlerFunc(requestContextDecorator(handleRevokeProbeToken(tokens)))
+}
+
+func respondWithProbeTokenError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrProbeTokenNotFound:
+		respondWith(w, http.StatusNotFound, err)
+	default:
+		respondWith(w, http.StatusInternalServerError, err)
+	}
+}
+
+func handleListProbeTokens(tokens *ProbeTokenStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, tokens.Tokens())
+	}
+}
+
+func handleMintProbeToken(tokens *ProbeTokenStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var template ProbeToken
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if template.Expires != nil && !template.Expires.After(mtime.Now()) {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("token would have expired already"))
+			return
+		}
+		template.CreatedBy = ""
+		if identity, ok := requestIdentity(r); ok {
+			template.CreatedBy = identity.User
+		}
+		token, err := tokens.Mint(template)
+		if err != nil {
+			respondWithProbeTokenError(w, err)
+			return
+		}
+		respondWith(w, http.StatusCreated, token)
+	}
+}
+
+func handleGetProbeToken(tokens *ProbeTokenStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		token, err := tokens.Token(mux.Vars(r)["id"])
+		if err != nil {
+			respondWithProbeTokenError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, token)
+	}
+}
+
+func handleRevokeProbeToken(tokens *ProbeTokenStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := tokens.Revoke(mux.Vars(r)["id"]); err != nil {
+			respondWithProbeTokenError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,132 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestProbeTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "probe-tokens")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "probe-tokens.json")
+	tokens, err := app.NewProbeTokenStore(path)
+	ok(t, err)
+	adder := &recordingAdder{}
+	router := mux.NewRouter()
+	app.RegisterProbeTokenRoutes(router, tokens)
+	app.RegisterReportPostHandler(app.NewProbeTokenAdder(adder, tokens), nil, nil, app.ReportLimits{}, router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	mint := func(body string) app.ProbeToken {
+		res, buf := checkRequest(t, ts, "POST", "/api/probe-tokens", []byte(body))
+		equals(t, http.StatusCreated, res.StatusCode)
+		var token app.ProbeToken
+		ok(t, json.Unmarshal(buf, &token))
+		return token
+	}
+	publishReport := func(token string, rpt report.Report) int {
+		var buf bytes.Buffer
+		ok(t, rpt.WriteBinary(&buf, gzip.DefaultCompression))
+		req, err := http.NewRequest("POST", ts.URL+"/api/report", &buf)
+		ok(t, err)
+		req.Header.Set("Content-Type", report.MsgpackContentType)
+		req.Header.Set("Content-Encoding", report.GzipEncoding)
+		if token != "" {
+			req.Header.Set("Authorization", "Scope-Probe token="+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	publish := func(token, hostName, clusterName string) int {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID(hostName), map[string]string{
+			host.HostName:    hostName,
+			host.ClusterName: clusterName,
+		}))
+		return publishReport(token, rpt)
+	}
+
+	web := mint(`{"name": "web", "hosts": ["web1", "web2"]}`)
+	prod := mint(`{"name": "prod", "clusters": ["prod"]}`)
+	equals(t, true, web.Token != "")
+
+	for _, tc := range []struct {
+		token, host, cluster string
+		status               int
+	}{
+		{web.Token, "web1", "", http.StatusOK},
+		{web.Token, "db1", "", http.StatusForbidden},
+		{prod.Token, "db1", "prod", http.StatusOK},
+		{prod.Token, "db1", "staging", http.StatusForbidden},
+		{prod.Token + "x", "db1", "prod", http.StatusForbidden},
+		// Service tokens, and no tokens, are for the authorizer to check
+		{"s3cr3t", "db1", "", http.StatusOK},
+		{"", "db1", "", http.StatusOK},
+	} {
+		if status := publish(tc.token, tc.host, tc.cluster); status != tc.status {
+			t.Errorf("%s on %s in %q: expected %d, got %d", tc.token, tc.host, tc.cluster, tc.status, status)
+		}
+	}
+	equals(t, 4, len(adder.reports))
+
+	// Nodes of other topologies must be on the hosts of the report, and
+	// there must be one
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("web1"), map[string]string{host.HostName: "web1"}))
+	rpt.Container.AddNode(report.MakeNodeWith("c1", map[string]string{report.HostNodeID: report.MakeHostNodeID("db1")}))
+	equals(t, http.StatusForbidden, publishReport(web.Token, rpt))
+	rpt = report.MakeReport()
+	rpt.Container.AddNode(report.MakeNodeWith("c1", map[string]string{report.HostNodeID: report.MakeHostNodeID("web1")}))
+	equals(t, http.StatusForbidden, publishReport(web.Token, rpt))
+	equals(t, 4, len(adder.reports))
+
+	// Tokens aren't shown again
+	var listed []app.ProbeToken
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/probe-tokens"), &listed))
+	equals(t, 2, len(listed))
+	equals(t, "web", listed[0].Name)
+	equals(t, "", listed[0].Token)
+
+	// Revoked tokens are rejected, and stay so
+	res, _ := checkRequest(t, ts, "DELETE", "/api/probe-tokens/"+web.ID, nil)
+	equals(t, http.StatusNoContent, res.StatusCode)
+	equals(t, http.StatusForbidden, publish(web.Token, "web1", ""))
+	res, _ = checkRequest(t, ts, "DELETE", "/api/probe-tokens/nonexistent", nil)
+	equals(t, http.StatusNotFound, res.StatusCode)
+	reloaded, err := app.NewProbeTokenStore(path)
+	ok(t, err)
+	_, err = reloaded.Check(web.Token)
+	equals(t, true, err != nil)
+	_, err = reloaded.Check(prod.Token)
+	ok(t, err)
+
+	// As are expired ones
+	expires := time.Now().Add(time.Hour)
+	shortLived, err := tokens.Mint(app.ProbeToken{Name: "short-lived", Expires: &expires})
+	ok(t, err)
+	equals(t, http.StatusOK, publish(shortLived.Token, "web1", ""))
+	mtime.NowForce(expires.Add(time.Second))
+	defer mtime.NowReset()
+	equals(t, http.StatusForbidden, publish(shortLived.Token, "web1", ""))
+	res, _ = checkRequest(t, ts, "POST", "/api/probe-tokens", []byte(`{"expires": "2000-01-01T00:00:00Z"}`))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,673 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// AsciicastContentType is the media type of asciicast recordings, as
+	// played by asciinema.
+	AsciicastContentType = "application/x-asciicast"
+
+	recordingDefaultWidth      = 80 // as the terminals of the UI
+	recordingDefaultHeight     = 24
+	recordingPendingTimeout    = pipeTimeout
+	recordingRetentionInterval = 1 * time.Hour
+)
+
+// recordedControls are the controls whose pipes are terminal sessions.
+var recordedControls = map[string]bool{
+	report.DockerAttachContainer: true,
+	report.DockerExecContainer:   true,
+}
+
+// ErrRecordingNotFound is returned when asked for recordings which aren't
+// there, or aren't the user's.
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// ErrRecordingActive is returned when deleting recordings of sessions which
+// haven't ended.
+var ErrRecordingActive = errors.New("recording in progress")
+
+// Recording describes a recorded terminal session.
+type Recording struct {
+	ID        string    `json:"id"` // of the pipe
+	User      string    `json:"user,omitempty"`
+	ProbeID   string    `json:"probeID"`
+	NodeID    string    `json:"nodeID"`
+	Control   string    `json:"control"`
+	Started   time.Time `json:"started"`
+	Duration  float64   `json:"duration"` // in seconds
+	Size      int64     `json:"size"`     // of the recording, in bytes
+	Truncated bool      `json:"truncated,omitempty"`
+	Active    bool      `json:"active,omitempty"`
+}
+
+// SessionRecorder records the terminal sessions of container attach and
+// exec pipes as asciicast v2 files, which asciinema can play, in a
+// directory per user. Recordings are deleted once older than the
+// retention.
+type SessionRecorder struct {
+	userIDer    func(context.Context) (string, error)
+	dir         string
+	retention   time.Duration
+	maxSize     int64
+	recordInput bool
+	quit        chan struct{}
+
+	sync.Mutex
+	pending  map[string]*session // by pipe ID, until the UI connects
+	sessions map[string]*session // by pipe ID
+}
+
+// NewSessionRecorder makes a SessionRecorder keeping recordings in dir for
+// retention (forever if 0). Recordings stop growing at maxSize bytes (if
+// not 0). Given recordInput, what users type is recorded too, passwords
+// included. userIDer identifies the user of a request.
+func NewSessionRecorder(userIDer func(context.Context) (string, error), dir string, retention time.Duration, maxSize int64, recordInput bool) (*SessionRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &SessionRecorder{
+		userIDer:    userIDer,
+		dir:         dir,
+		retention:   retention,
+		maxSize:     maxSize,
+		recordInput: recordInput,
+		quit:        make(chan struct{}),
+		pending:     map[string]*session{},
+		sessions:    map[string]*session{},
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Stop stops deleting old recordings, and finishes those in progress.
+func (s *SessionRecorder) Stop() {
+	close(s.quit)
+	s.Lock()
+	defer s.Unlock()
+	for id, sess := range s.sessions {
+		sess.finish()
+		delete(s.sessions, id)
+	}
+}
+
+func (s *SessionRecorder) loop() {
+	ticker := time.NewTicker(recordingRetentionInterval)
+	defer ticker.Stop()
+	for {
+		s.expire(mtime.Now())
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// expire forgets pipes the UI never connected to, and deletes recordings
+// which ended more than the retention ago.
+func (s *SessionRecorder) expire(now time.Time) {
+	s.Lock()
+	for id, sess := range s.pending {
+		if now.Sub(sess.recording.Started) >= recordingPendingTimeout {
+			delete(s.pending, id)
+		}
+	}
+	s.Unlock()
+
+	if s.retention <= 0 {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*", "*.json"))
+	if err != nil {
+		log.Errorf("Error listing recordings: %v", err)
+		return
+	}
+	for _, path := range paths {
+		recording, err := readRecording(path)
+		if err != nil {
+			log.Warnf("Error reading recording %s: %v", path, err)
+			continue
+		}
+		ended := recording.Started.Add(time.Duration(recording.Duration * float64(time.Second)))
+		if now.Sub(ended) < s.retention || s.active(recording.ID) {
+			continue
+		}
+		log.Infof("Deleting recording %s of %s", recording.ID, recording.User)
+		if err := removeRecording(strings.TrimSuffix(path, ".json")); err != nil {
+			log.Errorf("Error deleting recording %s: %v", path, err)
+		}
+	}
+}
+
+func (s *SessionRecorder) active(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.sessions[id]
+	return ok
+}
+
+// userDir is the directory of the recordings of the user making the
+// request.
+func (s *SessionRecorder) userDir(ctx context.Context) (string, string, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if userID == "" {
+		return userID, filepath.Join(s.dir, "local"), nil
+	}
+	return userID, filepath.Join(s.dir, "user-"+url.PathEscape(userID)), nil
+}
+
+// expect notes the pipe of a terminal session the UI is about to connect
+// to.
+func (s *SessionRecorder) expect(ctx context.Context, probeID string, req xfer.Request, res xfer.Response) {
+	userID, dir, err := s.userDir(ctx)
+	if err != nil {
+		log.Errorf("Error recording pipe %s: %v", res.Pipe, err)
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.pending[res.Pipe] = &session{
+		recording: Recording{
+			ID:      res.Pipe,
+			User:    userID,
+			ProbeID: probeID,
+			NodeID:  req.NodeID,
+			Control: req.Control,
+			Started: mtime.Now(),
+		},
+		path:    filepath.Join(dir, res.Pipe),
+		resize:  res.ResizeTTYControl,
+		width:   recordingDefaultWidth,
+		height:  recordingDefaultHeight,
+		maxSize: s.maxSize,
+	}
+}
+
+// resized records the terminal of the pipe being resized.
+func (s *SessionRecorder) resized(req xfer.Request) {
+	pipeID := req.ControlArgs["pipeID"]
+	s.Lock()
+	sess, ok := s.sessions[pipeID]
+	if !ok {
+		sess, ok = s.pending[pipeID]
+	}
+	s.Unlock()
+	if !ok || sess.resize != req.Control {
+		return
+	}
+	width, err := strconv.Atoi(req.ControlArgs["width"])
+	if err != nil {
+		return
+	}
+	height, err := strconv.Atoi(req.ControlArgs["height"])
+	if err != nil {
+		return
+	}
+	sess.resized(width, height)
+}
+
+// attach starts recording the pipe, if it is a terminal session, when the
+// UI connects to it, returning the end of the pipe to use instead.
+func (s *SessionRecorder) attach(id string, endIO io.ReadWriter) io.ReadWriter {
+	s.Lock()
+	defer s.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess, ok = s.pending[id]
+		if !ok {
+			return endIO
+		}
+		delete(s.pending, id)
+		if err := sess.start(); err != nil {
+			log.Errorf("Error recording pipe %s: %v", id, err)
+			return endIO
+		}
+		s.sessions[id] = sess
+	}
+	sess.refCount++
+	return recordingReadWriter{ReadWriter: endIO, session: sess, recordInput: s.recordInput}
+}
+
+// detach finishes the recording of the pipe once the UI has no more
+// connections to it, or when closing it.
+func (s *SessionRecorder) detach(id string, closing bool) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.pending, id)
+	sess, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+	sess.refCount--
+	if sess.refCount > 0 && !closing {
+		return
+	}
+	sess.finish()
+	delete(s.sessions, id)
+}
+
+// Recordings returns the recordings of the user making the request, most
+// recent first.
+func (s *SessionRecorder) Recordings(ctx context.Context) ([]Recording, error) {
+	_, dir, err := s.userDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	recordings := []Recording{}
+	for _, path := range paths {
+		recording, err := readRecording(path)
+		if err != nil {
+			log.Warnf("Error reading recording %s: %v", path, err)
+			continue
+		}
+		recording.Active = s.active(recording.ID)
+		recordings = append(recordings, recording)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].Started.After(recordings[j].Started) })
+	return recordings, nil
+}
+
+// path returns where the recording of the user making the request is,
+// without extension.
+func (s *SessionRecorder) path(ctx context.Context, id string) (string, error) {
+	_, dir, err := s.userDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return "", ErrRecordingNotFound
+	}
+	path := filepath.Join(dir, id)
+	if _, err := os.Stat(path + ".json"); os.IsNotExist(err) {
+		return "", ErrRecordingNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Recording returns the recording of the user making the request.
+func (s *SessionRecorder) Recording(ctx context.Context, id string) (Recording, error) {
+	path, err := s.path(ctx, id)
+	if err != nil {
+		return Recording{}, err
+	}
+	recording, err := readRecording(path + ".json")
+	if err != nil {
+		return Recording{}, err
+	}
+	recording.Active = s.active(id)
+	return recording, nil
+}
+
+// Cast opens the asciicast of the recording of the user making the
+// request.
+func (s *SessionRecorder) Cast(ctx context.Context, id string) (*os.File, error) {
+	path, err := s.path(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path + ".cast")
+}
+
+// Delete deletes the recording of the user making the request, unless it
+// is still being recorded.
+func (s *SessionRecorder) Delete(ctx context.Context, id string) error {
+	path, err := s.path(ctx, id)
+	if err != nil {
+		return err
+	}
+	if s.active(id) {
+		return ErrRecordingActive
+	}
+	return removeRecording(path)
+}
+
+func readRecording(path string) (Recording, error) {
+	var recording Recording
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return recording, err
+	}
+	return recording, json.Unmarshal(buf, &recording)
+}
+
+func removeRecording(path string) error {
+	if err := os.Remove(path + ".cast"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(path + ".json")
+}
+
+// session is a terminal session being recorded.
+type session struct {
+	recording Recording
+	path      string // without extension
+	resize    string // the control resizing the terminal
+	maxSize   int64
+	refCount  int // guarded by the SessionRecorder
+
+	sync.Mutex
+	width, height int
+	file          *os.File
+	partial       map[string][]byte // incomplete UTF-8 sequences, by event type
+}
+
+// start writes the metadata of the recording, and the header of the
+// asciicast.
+func (s *session) start() error {
+	s.Lock()
+	defer s.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	if err := s.writeMetadata(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path+".cast", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(struct {
+		Version   int    `json:"version"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Timestamp int64  `json:"timestamp"`
+		Title     string `json:"title"`
+	}{
+		Version:   2,
+		Width:     s.width,
+		Height:    s.height,
+		Timestamp: s.recording.Started.Unix(),
+		Title:     fmt.Sprintf("%s on %s", s.recording.Control, s.recording.NodeID),
+	})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.partial = map[string][]byte{}
+	s.write(append(header, '\n'))
+	return nil
+}
+
+func (s *session) writeMetadata() error {
+	buf, err := json.Marshal(s.recording)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".json.tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path+".json")
+}
+
+func (s *session) write(buf []byte) {
+	if s.file == nil || s.recording.Truncated {
+		return
+	}
+	if s.maxSize > 0 && s.recording.Size+int64(len(buf)) > s.maxSize {
+		log.Warnf("Recording %s reached %d bytes, truncating", s.recording.ID, s.maxSize)
+		s.recording.Truncated = true
+		return
+	}
+	n, err := s.file.Write(buf)
+	s.recording.Size += int64(n)
+	if err != nil {
+		log.Errorf("Error writing recording %s: %v", s.recording.ID, err)
+		s.recording.Truncated = true
+	}
+}
+
+// event records output ("o"), input ("i") or a resize ("r") of the
+// terminal.
+func (s *session) event(typ string, data []byte) {
+	s.Lock()
+	defer s.Unlock()
+	if s.file == nil {
+		return
+	}
+	// Hold back the start of characters split across reads, as asciicasts
+	// are JSON, and so UTF-8
+	data = append(s.partial[typ], data...)
+	data, s.partial[typ] = splitRunes(data)
+	if len(data) == 0 {
+		return
+	}
+	elapsed := mtime.Now().Sub(s.recording.Started).Seconds()
+	buf, err := json.Marshal([]interface{}{elapsed, typ, string(data)})
+	if err != nil {
+		return
+	}
+	s.write(append(buf, '\n'))
+}
+
+func (s *session) resized(width, height int) {
+	s.Lock()
+	started := s.file != nil
+	if !started {
+		s.width, s.height = width, height
+	}
+	s.Unlock()
+	if started {
+		s.event("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+	}
+}
+
+// finish closes the asciicast, and updates the metadata of the recording.
+func (s *session) finish() {
+	s.Lock()
+	defer s.Unlock()
+	if s.file == nil {
+		return
+	}
+	if err := s.file.Close(); err != nil {
+		log.Errorf("Error closing recording %s: %v", s.recording.ID, err)
+	}
+	s.file = nil
+	s.recording.Duration = mtime.Now().Sub(s.recording.Started).Seconds()
+	if err := s.writeMetadata(); err != nil {
+		log.Errorf("Error writing recording %s: %v", s.recording.ID, err)
+	}
+}
+
+// splitRunes splits buf after its last complete UTF-8 sequence.
+func splitRunes(buf []byte) ([]byte, []byte) {
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				return buf[:i], append([]byte{}, buf[i:]...)
+			}
+			break
+		}
+	}
+	return buf, nil
+}
+
+// recordingReadWriter records what goes through the UI end of a pipe:
+// reads are the output of the terminal, and writes what the user types.
+type recordingReadWriter struct {
+	io.ReadWriter
+	session     *session
+	recordInput bool
+}
+
+func (r recordingReadWriter) Read(p []byte) (int, error) {
+	n, err := r.ReadWriter.Read(p)
+	if n > 0 {
+		r.session.event("o", p[:n])
+	}
+	return n, err
+}
+
+func (r recordingReadWriter) Write(p []byte) (int, error) {
+	if r.recordInput {
+		r.session.event("i", p)
+	}
+	return r.ReadWriter.Write(p)
+}
+
+// NewRecordingControlRouter wraps a ControlRouter, telling rec about the
+// terminal sessions it opens, and their resizing.
+func NewRecordingControlRouter(cr ControlRouter, rec *SessionRecorder) ControlRouter {
+	return &recordingControlRouter{ControlRouter: cr, rec: rec}
+}
+
+type recordingControlRouter struct {
+	ControlRouter
+	rec *SessionRecorder
+}
+
+func (r *recordingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := r.ControlRouter.Handle(ctx, probeID, req)
+	if err != nil || res.Error != "" {
+		return res, err
+	}
+	if res.Pipe != "" && recordedControls[req.Control] {
+		r.rec.expect(ctx, probeID, req, res)
+	} else if _, ok := req.ControlArgs["pipeID"]; ok {
+		r.rec.resized(req)
+	}
+	return res, err
+}
+
+// NewRecordingPipeRouter wraps a PipeRouter, recording what goes through
+// the UI end of the terminal sessions rec has been told about.
+func NewRecordingPipeRouter(pr PipeRouter, rec *SessionRecorder) PipeRouter {
+	return &recordingPipeRouter{PipeRouter: pr, rec: rec}
+}
+
+type recordingPipeRouter struct {
+	PipeRouter
+	rec *SessionRecorder
+}
+
+func (r *recordingPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	pipe, endIO, err := r.PipeRouter.Get(ctx, id, e)
+	if err != nil || e != UIEnd {
+		return pipe, endIO, err
+	}
+	return pipe, r.rec.attach(id, endIO), nil
+}
+
+func (r *recordingPipeRouter) Release(ctx context.Context, id string, e End) error {
+	if e == UIEnd {
+		r.rec.detach(id, false)
+	}
+	return r.PipeRouter.Release(ctx, id, e)
+}
+
+func (r *recordingPipeRouter) Delete(ctx context.Context, id string) error {
+	r.rec.detach(id, true)
+	return r.PipeRouter.Delete(ctx, id)
+}
+
+// RegisterRecordingRoutes registers the routes for listing, replaying and
+// deleting recorded terminal sessions with a http mux.
+func RegisterRecordingRoutes(router *mux.Router, rec *SessionRecorder) {
+	router.Methods("GET").Path("/api/recordings").
+		HandlerFunc(requestContextDecorator(handleListRecordings(rec)))
+	router.Methods("GET").Path("/api/recordings/{id}").
+		HandlerFunc(requestContextDecorator(handleGetRecording(rec)))
+	router.Methods("GET").Path("/api/recordings/{id}/cast").
+		HandlerFunc(requestContextDecorator(handleGetRecordingCast(rec)))
+	router.Methods("DELETE").Path("/api/recordings/{id}").
+		HandlerFunc(requestContextDecorator(handleDeleteRecording(rec)))
+}
+
+func respondWithRecordingError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrRecordingNotFound:
+		respondWith(w, http.StatusNotFound, err)
+	case ErrRecordingActive:
+		respondWith(w, http.StatusConflict, err)
+	default:
+		respondWith(w, http.StatusInternalServerError, err)
+	}
+}
+
+func handleListRecordings(rec *SessionRecorder) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		recordings, err := rec.Recordings(ctx)
+		if err != nil {
+			respondWithRecordingError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, recordings)
+	}
+}
+
+func handleGetRecording(rec *SessionRecorder) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		recording, err := rec.Recording(ctx, mux.Vars(r)["id"])
+		if err != nil {
+			respondWithRecordingError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, recording)
+	}
+}
+
+// handleGetRecordingCast serves the asciicast of the recording, to be
+// played with asciinema or its web player.
+func handleGetRecordingCast(rec *SessionRecorder) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		file, err := rec.Cast(ctx, id)
+		if os.IsNotExist(err) {
+			err = ErrRecordingNotFound
+		}
+		if err != nil {
+			respondWithRecordingError(w, err)
+			return
+		}
+		defer file.Close()
+		w.Header().Set("Content-Type", AsciicastContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", id+".cast"))
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, file)
+	}
+}
+
+func handleDeleteRecording(rec *SessionRecorder) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := rec.Delete(ctx, mux.Vars(r)["id"]); err != nil {
+			respondWithRecordingError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
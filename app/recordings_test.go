@@ -0,0 +1,115 @@
+package app_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestSessionRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	rec, err := app.NewSessionRecorder(noUserID, dir, 0, 0, false)
+	ok(t, err)
+	defer rec.Stop()
+
+	ctx := context.Background()
+	cr := app.NewRecordingControlRouter(app.NewLocalControlRouter(), rec)
+	pr := app.NewRecordingPipeRouter(app.NewLocalPipeRouter(), rec)
+	defer pr.Stop()
+	cr.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		switch req.Control {
+		case report.DockerExecContainer:
+			return xfer.Response{Pipe: "pipe1", RawTTY: true, ResizeTTYControl: "docker_resize_exec_tty"}
+		case report.DockerAttachContainer:
+			return xfer.Response{Pipe: "pipe2", RawTTY: true}
+		}
+		return xfer.Response{}
+	})
+	resize := func(width, height string) {
+		_, err := cr.Handle(ctx, "probe1", xfer.Request{
+			NodeID:      "container1",
+			Control:     "docker_resize_exec_tty",
+			ControlArgs: map[string]string{"pipeID": "pipe1", "width": width, "height": height},
+		})
+		ok(t, err)
+	}
+	_, err = cr.Handle(ctx, "probe1", xfer.Request{NodeID: "container1", Control: report.DockerExecContainer})
+	ok(t, err)
+	// Resizing before the UI connects sets the size of the terminal
+	resize("100", "30")
+
+	_, ui, err := pr.Get(ctx, "pipe1", app.UIEnd)
+	ok(t, err)
+	_, probe, err := pr.Get(ctx, "pipe1", app.ProbeEnd)
+	ok(t, err)
+	go probe.Write([]byte("h\xc3"))
+	buf := make([]byte, 16)
+	n, err := ui.Read(buf)
+	ok(t, err)
+	equals(t, "h\xc3", string(buf[:n]))
+	go probe.Write([]byte("\xa9llo"))
+	n, err = ui.Read(buf)
+	ok(t, err)
+	equals(t, "\xa9llo", string(buf[:n]))
+	go ioutil.ReadAll(probe)
+	_, err = ui.Write([]byte("secret\n"))
+	ok(t, err)
+	resize("120", "40")
+	ok(t, pr.Release(ctx, "pipe1", app.UIEnd))
+
+	router := mux.NewRouter()
+	app.RegisterRecordingRoutes(router, rec)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var recordings []app.Recording
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/recordings"), &recordings))
+	equals(t, 1, len(recordings))
+	equals(t, "pipe1", recordings[0].ID)
+	equals(t, "container1", recordings[0].NodeID)
+	equals(t, report.DockerExecContainer, recordings[0].Control)
+	equals(t, false, recordings[0].Active)
+
+	res, body := checkRequest(t, ts, "GET", "/api/recordings/pipe1/cast", nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	equals(t, app.AsciicastContentType, res.Header.Get("Content-Type"))
+	equals(t, recordings[0].Size, int64(len(body)))
+	lines := bufio.NewScanner(bytes.NewReader(body))
+	lines.Scan()
+	var header struct {
+		Version, Width, Height int
+	}
+	ok(t, json.Unmarshal(lines.Bytes(), &header))
+	equals(t, 2, header.Version)
+	equals(t, 100, header.Width)
+	equals(t, 30, header.Height)
+	// Characters split across reads are recorded whole, and input isn't
+	// recorded
+	var events [][]string
+	for lines.Scan() {
+		var event []interface{}
+		ok(t, json.Unmarshal(lines.Bytes(), &event))
+		events = append(events, []string{event[1].(string), event[2].(string)})
+	}
+	equals(t, [][]string{{"o", "h"}, {"o", "éllo"}, {"r", "120x40"}}, events)
+
+	is404(t, ts, "/api/recordings/pipe2")
+	is404(t, ts, "/api/recordings/..")
+	res, _ = checkRequest(t, ts, "DELETE", "/api/recordings/pipe1", nil)
+	equals(t, http.StatusNoContent, res.StatusCode)
+	is404(t, ts, "/api/recordings/pipe1")
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// reportHistoryPoints bounds how many historic reports a backfill
+	// reads, however fine the step of its range.
+	reportHistoryPoints = 60
+	// reportHistoryCacheSize is how many historic reports the metrics of
+	// are kept, so backfilling node after node reads each report once.
+	reportHistoryCacheSize = 4 * reportHistoryPoints
+	// reportHistorySettled is how long after reports may still be added for
+	// a time, before which the metrics of the time are cached.
+	reportHistorySettled = time.Minute
+)
+
+// ReportHistory is a MetricsHistory reading the metrics of nodes from the
+// historic reports of a Reporter, a report per step. Only nodes of the
+// topologies of reports, as hosts, containers and processes are, have a
+// history. It has no default range, so node details are only backfilled
+// when asked to be.
+type ReportHistory struct {
+	userIDer func(context.Context) (string, error)
+	reporter Reporter
+	cache    gcache.Cache // of historicMetrics, by user, topology and time
+}
+
+// historicMetrics are the last samples of the metrics of the nodes of a
+// topology, as of a time, by node and metric ID.
+type historicMetrics map[string]map[string]report.Sample
+
+// NewReportHistory makes a new ReportHistory, reading the reports of
+// reporter, which should have historic reports, for the user userIDer
+// says asks for them.
+func NewReportHistory(userIDer func(context.Context) (string, error), reporter Reporter) *ReportHistory {
+	return &ReportHistory{
+		userIDer: userIDer,
+		reporter: reporter,
+		cache:    gcache.New(reportHistoryCacheSize).LRU().Build(),
+	}
+}
+
+// Backfill implements MetricsHistory. Reports are read at most every
+// historyStep of the range, however fine its step, and no more than
+// reportHistoryPoints of them, at times aligned to the step, so backfills
+// over the same range share them.
+func (h *ReportHistory) Backfill(ctx context.Context, n report.Node, node *detailed.Node, r MetricsRange) error {
+	if r.IsZero() {
+		return nil
+	}
+	window := r.End.Sub(r.Start)
+	if step := historyStep(window); r.Step < step {
+		r.Step = step
+	}
+	if step := (window + reportHistoryPoints - 1) / reportHistoryPoints; r.Step < step {
+		r.Step = step
+	}
+	userID, err := h.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	history := map[int][]report.Sample{}
+	for t := r.Start.Truncate(r.Step).Add(r.Step); !t.After(r.End); t = t.Add(r.Step) {
+		metrics, ok, err := h.metrics(ctx, userID, n.Topology, t)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		past, ok := metrics[n.ID]
+		if !ok {
+			continue
+		}
+		for i, row := range node.Metrics {
+			if row.Metric == nil {
+				continue
+			}
+			// Samples older than a step are those of another step
+			if s, ok := past[row.ID]; ok && t.Sub(s.Timestamp) < r.Step {
+				history[i] = append(history[i], report.Sample{Timestamp: t, Value: s.Value})
+			}
+		}
+	}
+
+	for i, row := range node.Metrics {
+		if row.Metric != nil {
+			node.Metrics[i].Metric = backfillMetric(*row.Metric, history[i], r.End)
+		}
+	}
+	return nil
+}
+
+// metrics returns the metrics of the nodes of the topology as of t, from
+// the cache if they've been read before, and whether the report has the
+// topology at all.
+func (h *ReportHistory) metrics(ctx context.Context, userID, topologyID string, t time.Time) (historicMetrics, bool, error) {
+	key := fmt.Sprintf("%s/%s/%d", userID, topologyID, t.UnixNano())
+	if cached, err := h.cache.Get(key); err == nil {
+		metrics, _ := cached.(historicMetrics)
+		return metrics, metrics != nil, nil
+	}
+	rpt, err := h.reporter.Report(ctx, t)
+	if err != nil {
+		return nil, false, err
+	}
+	var metrics historicMetrics
+	if topology, ok := rpt.Topology(topologyID); ok {
+		metrics = historicMetrics{}
+		for id, past := range topology.Nodes {
+			samples := map[string]report.Sample{}
+			for metricID, m := range past.Metrics {
+				if s, ok := m.LastSample(); ok {
+					samples[metricID] = s
+				}
+			}
+			metrics[id] = samples
+		}
+	}
+	if t.Before(mtime.Now().Add(-reportHistorySettled)) {
+		h.cache.Set(key, metrics)
+	}
+	return metrics, metrics != nil, nil
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/weaveworks/scope/common/tracing"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// reportStreamServer adds the reports streamed by probes to an Adder.
+type reportStreamServer struct {
+	adder      Adder
+	verifier   *xfer.Verifier
+	admission  *AdmissionControl
+	limits     ReportLimits
+	authorizer *Authorizer
+}
+
+// RegisterReportStream registers a report stream, adding the reports it
+// receives to a, with s, which must come from xfer.NewReportStreamServer.
+// If verifier is not nil, reports must be signed by a key it has. Reports
+// are admitted by admission, ending the stream with ResourceExhausted, and
+// a retry-after trailer, when it says the app is overloaded. Reports are
+// decompressed no further than the sizes of limits allow. If authorizer is
+// not nil, probes need the token it wants, as they do to POST reports.
+func RegisterReportStream(s *grpc.Server, a Adder, verifier *xfer.Verifier, admission *AdmissionControl, limits ReportLimits, authorizer *Authorizer) {
+	xfer.RegisterReportStreamServer(s, reportStreamServer{adder: a, verifier: verifier, admission: admission, limits: limits, authorizer: authorizer})
+}
+
+// Publish implements xfer.ReportStreamServer.
+func (s reportStreamServer) Publish(stream xfer.ReportStreamPublishServer) error {
+	ctx := reportStreamContext(stream.Context())
+	if r, _ := ctx.Value(RequestCtxKey).(*http.Request); !s.authorizer.allowsProbe(r) {
+		return grpc.Errorf(codes.Unauthenticated, "probes need the right token")
+	}
+	var (
+		previous *report.Report
+		reports  int
+	)
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&xfer.ReportStreamSummary{Reports: reports})
+		} else if err != nil {
+			return err
+		}
+		if s.verifier != nil {
+			if err := s.verifier.VerifyReport(msg.Report, msg.Signature); err != nil {
+				log.Warnf("Rejected streamed report: %v", err)
+				return grpc.Errorf(codes.Unauthenticated, "%v", err)
+			}
+		}
+		if err := s.add(ctx, stream, msg, &previous); err != nil {
+			return err
+		}
+		reports++
+	}
+}
+
+// add adds the report of the message, once admitted, keeping it as the
+// previous report deltas apply to, unless it's a shortcut.
+func (s reportStreamServer) add(ctx context.Context, stream xfer.ReportStreamPublishServer, msg *xfer.ReportMessage, previous **report.Report) (err error) {
+	parent, _ := opentracing.GlobalTracer().Extract(opentracing.TextMap, opentracing.TextMapCarrier(msg.Trace))
+	span, ctx := opentracing.StartSpanFromContext(ctx, "app.report", ext.RPCServerOption(parent))
+	if r, ok := ctx.Value(RequestCtxKey).(*http.Request); ok {
+		span.SetTag("probe", r.Header.Get(xfer.ScopeProbeIDHeader))
+	}
+	defer func() {
+		tracing.SetError(span, err)
+		span.Finish()
+	}()
+
+	release, err := s.admission.admit(ctx)
+	if err != nil {
+		if rejection, ok := err.(overloadRejection); ok {
+			stream.SetTrailer(metadata.Pairs(xfer.RetryAfterTrailer, rejection.retryAfterSeconds()))
+			return grpc.Errorf(codes.ResourceExhausted, "%v", err)
+		}
+		return grpc.Errorf(codes.Unavailable, "%v", err)
+	}
+	defer release()
+
+	if s.limits.MaxSize > 0 && len(msg.Report) > s.limits.MaxSize {
+		reportsRejected.WithLabelValues(rejectSize).Inc()
+		return grpc.Errorf(codes.InvalidArgument, "report is over the limit of %d bytes", s.limits.MaxSize)
+	}
+	decodeSpan, _ := opentracing.StartSpanFromContext(ctx, "app.decode")
+	rpt, buf, err := s.decode(msg, *previous)
+	tracing.SetError(decodeSpan, err)
+	decodeSpan.Finish()
+	if err != nil {
+		return err
+	}
+	// Shortcut reports are partial, so deltas don't apply to them
+	if !rpt.Shortcut {
+		*previous = rpt
+	}
+
+	if msg.Replayed != 0 {
+		ctx = context.WithValue(ctx, replayedCtxKey, time.Unix(0, msg.Replayed))
+	}
+	addSpan, addCtx := opentracing.StartSpanFromContext(ctx, "app.add")
+	err = s.adder.Add(addCtx, *rpt, buf)
+	tracing.SetError(addSpan, err)
+	addSpan.Finish()
+	if err != nil {
+		if _, ok := err.(probeTokenRejection); ok {
+			log.Warnf("Rejected report: %v", err)
+			return grpc.Errorf(codes.PermissionDenied, "%v", err)
+		}
+		if _, ok := err.(reportRejection); ok {
+			return grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		log.Errorf("Error Adding report: %v", err)
+		return grpc.Errorf(codes.Internal, "%v", err)
+	}
+	return nil
+}
+
+// decode decodes the report of the message, applying it to previous if
+// it's a delta, and returns it with buf, its encoding as gzipped msgpack.
+func (s reportStreamServer) decode(msg *xfer.ReportMessage, previous *report.Report) (rpt *report.Report, buf []byte, err error) {
+	buf = msg.Report
+	encoding := msg.Encoding
+	if encoding == "" {
+		encoding = report.GzipEncoding
+	}
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = report.MsgpackContentType
+	}
+	if msg.Delta {
+		if previous == nil {
+			return nil, nil, grpc.Errorf(codes.FailedPrecondition, "delta without a report to apply it to")
+		}
+		delta, err := report.MakeDeltaFromBytes(msg.Report, encoding, s.limits.MaxDecompressedSize)
+		if err != nil {
+			return nil, nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		applied := delta.Apply(*previous)
+		rpt = &applied
+	} else if rpt, err = report.MakeFromEncodedBytes(msg.Report, contentType, encoding, s.limits.MaxDecompressedSize); err != nil {
+		return nil, nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if msg.Delta || contentType != report.MsgpackContentType || encoding != report.GzipEncoding {
+		// buf must be gzipped msgpack matching the report, as some
+		// collectors store it
+		var encoded bytes.Buffer
+		if err := rpt.WriteBinary(&encoded, gzip.DefaultCompression); err != nil {
+			return nil, nil, err
+		}
+		buf = encoded.Bytes()
+	}
+	return rpt, buf, nil
+}
+
+// reportStreamContext makes a request context out of the metadata of a
+// stream, so that the Adder sees the headers the probe would have POSTed its
+// reports with.
+func reportStreamContext(ctx context.Context) context.Context {
+	r := &http.Request{Header: http.Header{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, vs := range md {
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+	}
+	return context.WithValue(ctx, RequestCtxKey, r)
+}
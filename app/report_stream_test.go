@@ -0,0 +1,212 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+func reportMessage(t *testing.T, rpt report.Report) *xfer.ReportMessage {
+	var buf bytes.Buffer
+	if err := rpt.WriteBinary(&buf, gzip.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	return &xfer.ReportMessage{Report: buf.Bytes()}
+}
+
+func deltaMessage(t *testing.T, delta report.Delta) *xfer.ReportMessage {
+	var buf bytes.Buffer
+	if err := delta.WriteEncoded(&buf, report.SnappyEncoding); err != nil {
+		t.Fatal(err)
+	}
+	return &xfer.ReportMessage{Report: buf.Bytes(), Encoding: report.SnappyEncoding, Delta: true}
+}
+
+func TestReportStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder := &recordingAdder{}
+	server := xfer.NewReportStreamServer()
+	app.RegisterReportStream(server, adder, nil, nil, app.ReportLimits{}, nil)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := xfer.DialReportStream(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	whole := report.MakeReport()
+	whole.Container.AddNode(report.MakeNode("a"))
+	whole.Container.AddNode(report.MakeNode("b"))
+	next := report.MakeReport()
+	next.Container.AddNode(report.MakeNode("b"))
+	next.Container.AddNode(report.MakeNode("c"))
+	shortcut := report.MakeReport()
+	shortcut.Container.AddNode(report.MakeNode("d"))
+	shortcut.Shortcut = true
+	delta := report.MakeDelta(whole, next)
+
+	stream, err := xfer.OpenReportStream(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []*xfer.ReportMessage{reportMessage(t, whole), reportMessage(t, shortcut), deltaMessage(t, delta)} {
+		if err := stream.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Reports != 3 || len(adder.reports) != 3 {
+		t.Fatalf("Expected 3 reports, got %d (added %d)", summary.Reports, len(adder.reports))
+	}
+	applied := adder.reports[2].Container.Nodes
+	if _, ok := applied["c"]; !ok || len(applied) != 2 {
+		t.Errorf("Expected the delta to be applied to the whole report before it, got %v", applied)
+	}
+	if added, err := report.MakeFromBytes(adder.bufs[2]); err != nil || len(added.Container.Nodes) != 2 {
+		t.Errorf("Expected the buffer added to match the report, got %v", err)
+	}
+
+	// Deltas need a report to apply to
+	stream, err = xfer.OpenReportStream(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(deltaMessage(t, delta))
+	if _, err := stream.CloseAndRecv(); grpc.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected a leading delta to be refused, got %v", err)
+	}
+
+	// Replayed reports are added as of when they were made
+	stream, err = xfer.OpenReportStream(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	made := time.Now().Add(-time.Minute)
+	msg := reportMessage(t, whole)
+	msg.Replayed = made.UnixNano()
+	stream.Send(msg)
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	if added := adder.times[len(adder.times)-1]; !added.Equal(made) {
+		t.Errorf("Expected the replayed report added as of %v, got %v", made, added)
+	}
+}
+
+func TestSignedReportStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := xfer.NewSigner(key)
+	adder := &recordingAdder{}
+	server := xfer.NewReportStreamServer()
+	app.RegisterReportStream(server, adder, xfer.NewVerifier(key.Public().(ed25519.PublicKey)), nil, app.ReportLimits{}, nil)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := xfer.DialReportStream(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	signed := reportMessage(t, report.MakeReport())
+	signed.Signature = signer.SignReport(signed.Report)
+	tampered := reportMessage(t, report.MakeReport())
+	tampered.Signature = signer.SignReport([]byte("another report"))
+	for _, tc := range []struct {
+		name string
+		msg  *xfer.ReportMessage
+		code codes.Code
+	}{
+		{"signed", signed, codes.OK},
+		{"unsigned", reportMessage(t, report.MakeReport()), codes.Unauthenticated},
+		{"tampered", tampered, codes.Unauthenticated},
+	} {
+		stream, err := xfer.OpenReportStream(context.Background(), conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(tc.msg)
+		if _, err := stream.CloseAndRecv(); grpc.Code(err) != tc.code {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.code, err)
+		}
+	}
+	if len(adder.reports) != 1 {
+		t.Errorf("Expected only the signed report to be added, got %d", len(adder.reports))
+	}
+}
+
+func TestAuthorizedReportStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := app.NewUserStore("/nonexistent/users.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := app.NewAuthorizer(app.NewStaticAuthenticator(users), users, "", "s3cr3t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder := &recordingAdder{}
+	server := xfer.NewReportStreamServer()
+	app.RegisterReportStream(server, adder, nil, nil, app.ReportLimits{}, authorizer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := xfer.DialReportStream(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, tc := range []struct {
+		name, authorization string
+		code                codes.Code
+	}{
+		{"no token", "", codes.Unauthenticated},
+		{"wrong token", "Scope-Probe token=guess", codes.Unauthenticated},
+		{"right token", "Scope-Probe token=s3cr3t", codes.OK},
+	} {
+		ctx := context.Background()
+		if tc.authorization != "" {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", tc.authorization))
+		}
+		stream, err := xfer.OpenReportStream(ctx, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(reportMessage(t, report.MakeReport()))
+		if _, err := stream.CloseAndRecv(); grpc.Code(err) != tc.code {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.code, err)
+		}
+	}
+}
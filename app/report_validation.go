@@ -0,0 +1,219 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// Why reports are rejected, and nodes dropped from them
+const (
+	rejectSize     = "size"
+	rejectQuota    = "quota"
+	dropTopology   = "topology"
+	dropInvalidID  = "invalid_id"
+	dropAdjacentID = "invalid_adjacent_id"
+)
+
+var (
+	reportsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "reports_rejected_total",
+		Help:      "Total count of reports rejected by validation, by reason.",
+	}, []string{"reason"})
+	nodesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scope",
+		Name:      "report_nodes_dropped_total",
+		Help:      "Total count of nodes, or adjacencies, dropped from reports by validation, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(reportsRejected)
+	prometheus.MustRegister(nodesDropped)
+}
+
+// ReportLimits are the limits reports published by probes are held to. Zero
+// values are no limit.
+type ReportLimits struct {
+	// MaxSize is the most bytes of a report, as published, and as gzipped
+	// msgpack.
+	MaxSize int
+	// MaxDecompressedSize is the most bytes a report may decompress to.
+	MaxDecompressedSize int
+	// MaxNodes is the most nodes of a report, so of the probe publishing
+	// it, as each report is all a probe has seen.
+	MaxNodes int
+	// MaxIDLength is the longest node ID.
+	MaxIDLength int
+	// Topologies are the only topologies reports may have nodes in, plugin
+	// topologies included.
+	Topologies []string
+}
+
+// reportRejection is why a report was refused.
+type reportRejection struct {
+	reason string
+	err    string
+}
+
+func (e reportRejection) Error() string {
+	return "report rejected: " + e.err
+}
+
+// validatingAdder is an Adder which holds reports to ReportLimits.
+type validatingAdder struct {
+	Adder
+	limits ReportLimits
+}
+
+// NewValidatingAdder returns an Adder which sanitizes reports, dropping the
+// nodes of topologies other than those of the limits, and those with
+// malformed IDs, and rejects those too big, or with more nodes than the
+// limits allow once sanitized, before passing them on to a. Nodes dropped
+// and reports rejected are counted in Prometheus metrics.
+func NewValidatingAdder(a Adder, limits ReportLimits) Adder {
+	return validatingAdder{Adder: a, limits: limits}
+}
+
+// Add implements Adder.
+func (v validatingAdder) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	if v.limits.MaxSize > 0 && len(buf) > v.limits.MaxSize {
+		return v.reject(ctx, rejectSize, fmt.Sprintf("%d bytes, over the limit of %d", len(buf), v.limits.MaxSize))
+	}
+	sanitized, dropped := sanitizeReport(rpt, v.limits)
+	if v.limits.MaxNodes > 0 {
+		var nodes int
+		sanitized.WalkTopologies(func(t *report.Topology) { nodes += len(t.Nodes) })
+		if nodes > v.limits.MaxNodes {
+			return v.reject(ctx, rejectQuota, fmt.Sprintf("%d nodes, over the quota of %d", nodes, v.limits.MaxNodes))
+		}
+	}
+	if dropped == 0 {
+		return v.Adder.Add(ctx, rpt, buf)
+	}
+	// buf must match the report, as some collectors store it
+	var encoded bytes.Buffer
+	if err := sanitized.WriteBinary(&encoded, gzip.DefaultCompression); err != nil {
+		return err
+	}
+	return v.Adder.Add(ctx, sanitized, encoded.Bytes())
+}
+
+func (v validatingAdder) reject(ctx context.Context, reason, err string) error {
+	reportsRejected.WithLabelValues(reason).Inc()
+	rejection := reportRejection{reason: reason, err: err}
+	log.Warnf("Rejected report of probe %q: %v", requestProbeID(ctx), rejection)
+	return rejection
+}
+
+// requestProbeID returns the ID of the probe of the request in ctx.
+func requestProbeID(ctx context.Context) string {
+	r, ok := ctx.Value(RequestCtxKey).(*http.Request)
+	if !ok {
+		return ""
+	}
+	return r.Header.Get(xfer.ScopeProbeIDHeader)
+}
+
+// sanitizeReport returns the report without the nodes the limits don't
+// allow, and the adjacencies to malformed IDs, and how many were dropped.
+// The report is only copied if there's something to drop.
+func sanitizeReport(rpt report.Report, limits ReportLimits) (report.Report, int) {
+	allowed := func(string) bool { return true }
+	if len(limits.Topologies) > 0 {
+		allowed = func(name string) bool { return containsString(limits.Topologies, name) }
+	}
+	var dirty bool
+	rpt.WalkNamedTopologies(func(name string, t *report.Topology) {
+		if dirty || len(t.Nodes) == 0 {
+			return
+		}
+		if !allowed(name) {
+			dirty = true
+			return
+		}
+		for id, n := range t.Nodes {
+			if !validNodeID(id, limits.MaxIDLength) || (n.ID != "" && n.ID != id) || !validIDs(n.Adjacency, limits.MaxIDLength) {
+				dirty = true
+				return
+			}
+		}
+	})
+	if !dirty {
+		return rpt, 0
+	}
+
+	var dropped int
+	drop := func(reason string, n int) {
+		nodesDropped.WithLabelValues(reason).Add(float64(n))
+		dropped += n
+	}
+	rpt = rpt.Copy()
+	rpt.WalkNamedTopologies(func(name string, t *report.Topology) {
+		if !allowed(name) {
+			drop(dropTopology, len(t.Nodes))
+			t.Nodes = report.Nodes{}
+			return
+		}
+		for id, n := range t.Nodes {
+			if !validNodeID(id, limits.MaxIDLength) || (n.ID != "" && n.ID != id) {
+				drop(dropInvalidID, 1)
+				delete(t.Nodes, id)
+				continue
+			}
+			if validIDs(n.Adjacency, limits.MaxIDLength) {
+				continue
+			}
+			var adjacency report.IDList
+			for _, adjacent := range n.Adjacency {
+				if validNodeID(adjacent, limits.MaxIDLength) {
+					adjacency = adjacency.Add(adjacent)
+				} else {
+					drop(dropAdjacentID, 1)
+				}
+			}
+			n.Adjacency = adjacency
+			t.Nodes[id] = n
+		}
+	})
+	for name, t := range rpt.PluginTopologies {
+		if len(t.Nodes) == 0 && !allowed(name) {
+			delete(rpt.PluginTopologies, name)
+		}
+	}
+	return rpt, dropped
+}
+
+// validNodeID checks the ID is one scope could have made: not empty, nor
+// longer than maxLength, if any, and of printable UTF-8.
+func validNodeID(id string, maxLength int) bool {
+	if id == "" || (maxLength > 0 && len(id) > maxLength) || !utf8.ValidString(id) {
+		return false
+	}
+	for _, r := range id {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func validIDs(ids report.IDList, maxLength int) bool {
+	for _, id := range ids {
+		if !validNodeID(id, maxLength) {
+			return false
+		}
+	}
+	return true
+}
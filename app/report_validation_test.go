@@ -0,0 +1,62 @@
+package app_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestValidatingAdder(t *testing.T) {
+	ctx := context.Background()
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID("foo")))
+	rpt.Container.AddNode(report.MakeNode(report.MakeContainerNodeID("abc")).WithAdjacent("bad\x00id"))
+	rpt.Container.AddNode(report.MakeNode("evil\nnode"))
+	rpt.Pod.AddNode(report.MakeNode(report.MakePodNodeID("uid")))
+
+	adder := &recordingAdder{}
+	limits := app.ReportLimits{MaxIDLength: 64, Topologies: []string{report.Host, report.Container}}
+	if err := app.NewValidatingAdder(adder, limits).Add(ctx, rpt, []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+	have := adder.reports[0]
+	if len(have.Host.Nodes) != 1 || len(have.Container.Nodes) != 1 || len(have.Pod.Nodes) != 0 {
+		t.Errorf("Expected the pod and malformed container dropped, got %v, %v, %v", have.Host.Nodes, have.Container.Nodes, have.Pod.Nodes)
+	}
+	if adjacency := have.Container.Nodes[report.MakeContainerNodeID("abc")].Adjacency; len(adjacency) != 0 {
+		t.Errorf("Expected the malformed adjacency dropped, got %v", adjacency)
+	}
+	if string(adder.bufs[0]) == "original" {
+		t.Error("Expected the sanitized report to be encoded again")
+	}
+	if len(rpt.Pod.Nodes) != 1 {
+		t.Error("Sanitizing must not modify the original report")
+	}
+
+	// Valid reports are passed on as they are
+	adder = &recordingAdder{}
+	valid := report.MakeReport()
+	valid.Host.AddNode(report.MakeNode(report.MakeHostNodeID("foo")))
+	if err := app.NewValidatingAdder(adder, limits).Add(ctx, valid, []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+	if string(adder.bufs[0]) != "original" {
+		t.Error("Expected a valid report to be passed on as it is")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		limits app.ReportLimits
+	}{
+		{"too big", app.ReportLimits{MaxSize: 4}},
+		{"over quota", app.ReportLimits{MaxNodes: 2}},
+	} {
+		adder := &recordingAdder{}
+		if err := app.NewValidatingAdder(adder, tc.limits).Add(ctx, rpt, []byte("original")); err == nil || len(adder.reports) != 0 {
+			t.Errorf("%s: expected the report to be rejected", tc.name)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -14,10 +14,12 @@ import (
 	"github.com/PuerkitoBio/ghost/handlers"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
-	"github.com/ugorji/go/codec"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/common/hostname"
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/report"
 )
@@ -28,6 +30,9 @@ var (
 
 	// UniqueID - set at runtime.
 	UniqueID = "0"
+
+	// ReportStreamPort - set at runtime, if the app serves a report stream.
+	ReportStreamPort = 0
 )
 
 // contextKey is a wrapper type for use in context.WithValue() to satisfy golint
@@ -99,62 +104,155 @@ func RegisterTopologyRoutes(router *mux.Router, r Reporter, capabilities map[str
 		gzipHandler(requestContextDecorator(topologyRegistry.makeTopologyList(r))))
 	get.
 		HandleFunc("/api/topology/{topology}",
-			gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleTopology)))).
+			gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, makeTopologyHandler(r))))).
 		Name("api_topology_topology")
 	get.
 		HandleFunc("/api/topology/{topology}/ws",
 			requestContextDecorator(captureReporter(r, handleWebsocket))). // NB not gzip!
 		Name("api_topology_topology_ws")
+	get.
+		HandleFunc("/api/topology/{topology}/changes",
+			gzipHandler(requestContextDecorator(topologyRegistry.captureChanges(r)))).
+		Name("api_topology_topology_changes")
+	get.
+		HandleFunc("/api/topology/{topology}/export",
+			gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, makeExportHandler(r))))).
+		Name("api_topology_topology_export")
+	get.
+		HandleFunc("/api/topology/{topology}/traffic",
+			gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleTraffic)))).
+		Name("api_topology_topology_traffic")
+	get.
+		MatcherFunc(URLMatcher("/api/topology/{topology}/{id}/bundles/{bundle}")).HandlerFunc(
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleEdgeBundle)))).
+		Name("api_topology_topology_id_bundle")
+	get.
+		MatcherFunc(URLMatcher("/api/topology/{topology}/{id}/connections/{table}")).HandlerFunc(
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleConnections)))).
+		Name("api_topology_topology_id_connections")
+	get.
+		MatcherFunc(URLMatcher("/api/topology/{topology}/{id}/impact")).HandlerFunc(
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleImpact)))).
+		Name("api_topology_topology_id_impact")
+	get.
+		MatcherFunc(URLMatcher("/api/topology/{topology}/{id}/paths")).HandlerFunc(
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handlePaths)))).
+		Name("api_topology_topology_id_paths")
 	get.
 		MatcherFunc(URLMatcher("/api/topology/{topology}/{id}")).HandlerFunc(
-		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleNode)))).
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, makeNodeHandler(r))))).
 		Name("api_topology_topology_id")
 	get.HandleFunc("/api/report",
 		gzipHandler(requestContextDecorator(makeRawReportHandler(r))))
 	get.HandleFunc("/api/probes",
 		gzipHandler(requestContextDecorator(makeProbeHandler(r))))
+	get.HandleFunc("/api/plugins",
+		gzipHandler(requestContextDecorator(makePluginsHandler(r))))
+	get.HandleFunc("/api/graphql",
+		gzipHandler(requestContextDecorator(topologyRegistry.handleGraphQL(r))))
+
+	post := router.Methods("POST").Subrouter()
+	post.HandleFunc("/api/graphql",
+		gzipHandler(requestContextDecorator(topologyRegistry.handleGraphQL(r))))
 }
 
-// RegisterReportPostHandler registers the handler for report submission
-func RegisterReportPostHandler(a Adder, router *mux.Router) {
+// reportContentTypes are the content types reports may be POSTed in.
+var reportContentTypes = []string{report.ProtobufContentType, report.MsgpackContentType, report.JSONContentType}
+
+// RegisterReportPostHandler registers the handler for report submission.
+// If verifier is not nil, reports must be signed by a key it has. Reports
+// are admitted by admission, before they are read, and turned away with 429s
+// when it says the app is overloaded. Reports are read, and decompressed, no
+// further than the sizes of limits allow.
+func RegisterReportPostHandler(a Adder, verifier *xfer.Verifier, admission *AdmissionControl, limits ReportLimits, router *mux.Router) {
 	post := router.Methods("POST").Subrouter()
 	post.HandleFunc("/api/report", requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		var (
-			rpt    report.Report
-			buf    bytes.Buffer
-			reader = io.TeeReader(r.Body, &buf)
-		)
-
-		gzipped := strings.Contains(r.Header.Get("Content-Encoding"), "gzip")
-		if !gzipped {
-			reader = io.TeeReader(r.Body, gzip.NewWriter(&buf))
+		parent, _ := opentracing.GlobalTracer().Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+		span, ctx := opentracing.StartSpanFromContext(ctx, "app.report", ext.RPCServerOption(parent))
+		span.SetTag("probe", r.Header.Get(xfer.ScopeProbeIDHeader))
+		defer span.Finish()
+
+		release, err := admission.admit(ctx)
+		if err != nil {
+			if rejection, ok := err.(overloadRejection); ok {
+				w.Header().Set("Retry-After", rejection.retryAfterSeconds())
+				respondWith(w, http.StatusTooManyRequests, err)
+				return
+			}
+			respondWith(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		defer release()
+
+		var encoding string
+		switch contentEncoding := r.Header.Get("Content-Encoding"); {
+		case strings.Contains(contentEncoding, report.GzipEncoding):
+			encoding = report.GzipEncoding
+		case strings.Contains(contentEncoding, report.SnappyEncoding):
+			encoding = report.SnappyEncoding
 		}
 
-		contentType := r.Header.Get("Content-Type")
-		isMsgpack := strings.HasPrefix(contentType, "application/msgpack")
-		var handle codec.Handle
-		switch {
-		case strings.HasPrefix(contentType, "application/json"):
-			handle = &codec.JsonHandle{}
-		case isMsgpack:
-			handle = &codec.MsgpackHandle{}
-		default:
-			respondWith(w, http.StatusBadRequest, fmt.Errorf("Unsupported Content-Type: %v", contentType))
+		var contentType string
+		for _, ct := range reportContentTypes {
+			if strings.HasPrefix(r.Header.Get("Content-Type"), ct) {
+				contentType = ct
+			}
+		}
+		if contentType == "" {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("Unsupported Content-Type: %v", r.Header.Get("Content-Type")))
 			return
 		}
 
-		if err := rpt.ReadBinary(reader, gzipped, handle); err != nil {
+		body := r.Body
+		if limits.MaxSize > 0 {
+			body = http.MaxBytesReader(w, body, int64(limits.MaxSize))
+		}
+		buf, err := ioutil.ReadAll(body)
+		if err != nil {
+			if limits.MaxSize > 0 && len(buf) == limits.MaxSize {
+				reportsRejected.WithLabelValues(rejectSize).Inc()
+				respondWith(w, http.StatusRequestEntityTooLarge, fmt.Errorf("report is over the limit of %d bytes", limits.MaxSize))
+				return
+			}
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if verifier != nil {
+			if err := verifier.VerifyReport(buf, r.Header.Get(xfer.ReportSignatureHeader)); err != nil {
+				respondWith(w, http.StatusUnauthorized, err)
+				return
+			}
+		}
+		decodeSpan, _ := opentracing.StartSpanFromContext(ctx, "app.decode")
+		rpt, err := report.MakeFromEncodedBytes(buf, contentType, encoding, limits.MaxDecompressedSize)
+		if err != nil {
+			tracing.SetError(decodeSpan, err)
+			decodeSpan.Finish()
 			respondWith(w, http.StatusBadRequest, err)
 			return
 		}
 
 		// a.Add(..., buf) assumes buf is gzip'd msgpack
-		if !isMsgpack {
-			buf = bytes.Buffer{}
-			rpt.WriteBinary(&buf, gzip.DefaultCompression)
+		if contentType != report.MsgpackContentType || encoding != report.GzipEncoding {
+			var encoded bytes.Buffer
+			rpt.WriteBinary(&encoded, gzip.DefaultCompression)
+			buf = encoded.Bytes()
 		}
+		decodeSpan.Finish()
 
-		if err := a.Add(ctx, rpt, buf.Bytes()); err != nil {
+		addSpan, addCtx := opentracing.StartSpanFromContext(ctx, "app.add")
+		err = a.Add(addCtx, *rpt, buf)
+		tracing.SetError(addSpan, err)
+		addSpan.Finish()
+		if err != nil {
+			if _, ok := err.(probeTokenRejection); ok {
+				respondWith(w, http.StatusForbidden, err)
+				return
+			}
+			if _, ok := err.(reportRejection); ok {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
 			log.Errorf("Error Adding report: %v", err)
 			respondWith(w, http.StatusInternalServerError, err)
 			return
@@ -180,7 +278,7 @@ func NewVersion(version, downloadURL string) {
 
 func apiHandler(rep Reporter, capabilities map[string]bool) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		report, err := rep.Report(ctx, time.Now())
+		rpt, err := rep.Report(ctx, time.Now())
 		if err != nil {
 			respondWith(w, http.StatusInternalServerError, err)
 			return
@@ -188,12 +286,17 @@ func apiHandler(rep Reporter, capabilities map[string]bool) CtxHandlerFunc {
 		newVersion.Lock()
 		defer newVersion.Unlock()
 		respondWith(w, http.StatusOK, xfer.Details{
-			ID:           UniqueID,
-			Version:      Version,
-			Hostname:     hostname.Get(),
-			Plugins:      report.Plugins,
-			Capabilities: capabilities,
-			NewVersion:   newVersion.NewVersionInfo,
+			ID:                 UniqueID,
+			Version:            Version,
+			Hostname:           hostname.Get(),
+			Plugins:            rpt.Plugins,
+			Capabilities:       capabilities,
+			ReportStreamPort:   ReportStreamPort,
+			ReportContentTypes: reportContentTypes,
+			ReportEncodings:    report.Encodings,
+			ReportVersion:      report.SchemaVersion,
+			ReportFeatures:     report.Features,
+			NewVersion:         newVersion.NewVersionInfo,
 		})
 	}
 }
@@ -2,6 +2,7 @@ package app_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
 )
 
@@ -40,10 +42,10 @@ func TestURLMatcher(t *testing.T) {
 }
 
 func TestReportPostHandler(t *testing.T) {
-	test := func(contentType string, encoder func(interface{}) ([]byte, error)) {
+	test := func(contentType, encoding string, encoder func(interface{}) ([]byte, error)) {
 		router := mux.NewRouter()
 		c := app.NewCollector(1 * time.Minute)
-		app.RegisterReportPostHandler(c, router)
+		app.RegisterReportPostHandler(c, nil, nil, app.ReportLimits{}, router)
 		ts := httptest.NewServer(router)
 		defer ts.Close()
 
@@ -57,6 +59,9 @@ func TestReportPostHandler(t *testing.T) {
 			t.Fatalf("Error posting report: %v", err)
 		}
 		req.Header.Set("Content-Type", contentType)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
@@ -83,14 +88,58 @@ func TestReportPostHandler(t *testing.T) {
 		}
 	}
 
-	test("application/json", func(v interface{}) ([]byte, error) {
+	test("application/json", "", func(v interface{}) ([]byte, error) {
 		buf := &bytes.Buffer{}
 		err := codec.NewEncoder(buf, &codec.JsonHandle{}).Encode(v)
 		return buf.Bytes(), err
 	})
-	test("application/msgpack", func(v interface{}) ([]byte, error) {
+	test("application/msgpack", "", func(v interface{}) ([]byte, error) {
 		buf := &bytes.Buffer{}
 		err := codec.NewEncoder(buf, &codec.MsgpackHandle{}).Encode(v)
 		return buf.Bytes(), err
 	})
+	test(report.ProtobufContentType, report.SnappyEncoding, func(v interface{}) ([]byte, error) {
+		buf := &bytes.Buffer{}
+		err := v.(report.Report).WriteEncoded(buf, report.ProtobufContentType, report.SnappyEncoding)
+		return buf.Bytes(), err
+	})
+}
+
+func TestReportPostHandlerLimits(t *testing.T) {
+	router := mux.NewRouter()
+	app.RegisterReportPostHandler(app.NewCollector(1*time.Minute), nil, nil, app.ReportLimits{MaxSize: 1024, MaxDecompressedSize: 4096}, router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(body []byte) int {
+		req, err := http.NewRequest("POST", ts.URL+"/api/report", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", report.MsgpackContentType)
+		req.Header.Set("Content-Encoding", report.GzipEncoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	gzipped := func(buf []byte) []byte {
+		var out bytes.Buffer
+		w := gzip.NewWriter(&out)
+		w.Write(buf)
+		w.Close()
+		return out.Bytes()
+	}
+
+	if status := post(make([]byte, 2048)); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a report over the size limit to be rejected, got %d", status)
+	}
+	// A little gzip decompresses to a lot
+	if body := gzipped(make([]byte, 1<<18)); len(body) > 1024 {
+		t.Fatalf("Expected a small bomb, got %d bytes", len(body))
+	} else if status := post(body); status != http.StatusBadRequest {
+		t.Errorf("Expected a report over the decompressed size limit to be rejected, got %d", status)
+	}
 }
@@ -0,0 +1,323 @@
+package app
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// snapshotTimeout bounds how long taking a snapshot may take.
+const snapshotTimeout = 30 * time.Second
+
+// A ReportStore keeps snapshots of merged reports, by when they were taken.
+type ReportStore interface {
+	Put(ctx context.Context, timestamp time.Time, rpt report.Report) error
+	Get(ctx context.Context, timestamp time.Time) (report.Report, error)
+	Delete(ctx context.Context, timestamp time.Time) error
+	// List returns when the snapshots in the store were taken.
+	List(ctx context.Context) ([]time.Time, error)
+}
+
+// DirReportStore is a ReportStore keeping snapshots as files in a
+// directory, named as the file collector replays them.
+type DirReportStore struct {
+	dir string
+}
+
+// NewDirReportStore makes a new DirReportStore, keeping snapshots in dir.
+func NewDirReportStore(dir string) (*DirReportStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirReportStore{dir: dir}, nil
+}
+
+func (s *DirReportStore) path(timestamp time.Time) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.msgpack.gz", timestamp.UnixNano()))
+}
+
+// Put implements ReportStore.
+func (s *DirReportStore) Put(_ context.Context, timestamp time.Time, rpt report.Report) error {
+	// Write to a temporary file first, so List never finds half a snapshot
+	tmp := filepath.Join(s.dir, ".snapshot.msgpack.gz")
+	if err := rpt.WriteToFile(tmp, gzip.DefaultCompression); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(timestamp))
+}
+
+// Get implements ReportStore.
+func (s *DirReportStore) Get(_ context.Context, timestamp time.Time) (report.Report, error) {
+	return report.MakeFromFile(s.path(timestamp))
+}
+
+// Delete implements ReportStore.
+func (s *DirReportStore) Delete(_ context.Context, timestamp time.Time) error {
+	return os.Remove(s.path(timestamp))
+}
+
+// List implements ReportStore.
+func (s *DirReportStore) List(context.Context) ([]time.Time, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var timestamps []time.Time
+	for _, f := range files {
+		if t, err := timestampFromFilepath(f.Name()); err == nil && !f.IsDir() {
+			timestamps = append(timestamps, t)
+		}
+	}
+	return timestamps, nil
+}
+
+// SnapshotPolicy says how often SnapshotCollectors take snapshots, and how
+// they compact them as they age.
+type SnapshotPolicy struct {
+	// Resolution is how often snapshots are taken.
+	Resolution time.Duration
+
+	// Snapshots older than DownsampleAfter are downsampled, and thinned to
+	// one every DownsampledResolution, taken to be at the start of it. 0
+	// leaves them be.
+	DownsampleAfter       time.Duration
+	DownsampledResolution time.Duration
+
+	// Retention is how long snapshots are kept. 0 keeps them forever.
+	Retention time.Duration
+
+	// CompactionInterval is how often snapshots are compacted.
+	CompactionInterval time.Duration
+}
+
+// SnapshotCollector is a Collector which snapshots the reports of another
+// into a ReportStore, and serves reports from before the window of the
+// other from them.
+type SnapshotCollector struct {
+	Collector
+	store  ReportStore
+	policy SnapshotPolicy
+	window time.Duration
+	quit   chan struct{}
+
+	mtx        sync.Mutex
+	timestamps []time.Time // of the snapshots in the store, oldest first
+	cached     *report.Report
+	cachedAt   time.Time
+}
+
+// NewSnapshotCollector makes a new SnapshotCollector, snapshotting the
+// reports of c, of the given window, into store.
+func NewSnapshotCollector(c Collector, store ReportStore, window time.Duration, policy SnapshotPolicy) (*SnapshotCollector, error) {
+	timestamps, err := store.List(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+	s := &SnapshotCollector{
+		Collector:  c,
+		store:      store,
+		policy:     policy,
+		window:     window,
+		quit:       make(chan struct{}),
+		timestamps: timestamps,
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Stop stops taking snapshots.
+func (s *SnapshotCollector) Stop() {
+	close(s.quit)
+}
+
+func (s *SnapshotCollector) loop() {
+	snapshotTicker := time.NewTicker(s.policy.Resolution)
+	defer snapshotTicker.Stop()
+	compactionTicker := time.NewTicker(s.policy.CompactionInterval)
+	defer compactionTicker.Stop()
+	for {
+		select {
+		case <-snapshotTicker.C:
+			if err := s.snapshot(); err != nil {
+				log.Errorf("Error taking report snapshot: %v", err)
+			}
+		case <-compactionTicker.C:
+			if err := s.compact(); err != nil {
+				log.Errorf("Error compacting report snapshots: %v", err)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *SnapshotCollector) snapshot() error {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	now := mtime.Now()
+	if ok, err := s.Collector.HasReports(ctx, now); err != nil || !ok {
+		return err
+	}
+	rpt, err := s.Collector.Report(ctx, now)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Put(ctx, now, rpt); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	s.timestamps = append(s.timestamps, now)
+	s.mtx.Unlock()
+	return nil
+}
+
+// live tells whether reports at timestamp are those the other collector
+// still has.
+func (s *SnapshotCollector) live(timestamp time.Time) bool {
+	return timestamp.After(mtime.Now().Add(-s.window))
+}
+
+// downsampled tells whether snapshots at timestamp have been downsampled.
+func (s *SnapshotCollector) downsampled(timestamp time.Time) bool {
+	return s.policy.DownsampleAfter > 0 && timestamp.Before(mtime.Now().Add(-s.policy.DownsampleAfter))
+}
+
+// snapshotAt returns when the snapshot of the reports at timestamp was
+// taken, if there is one. Snapshots stand for the resolution after them,
+// and twice that before the next is overdue, in case one was missed.
+func (s *SnapshotCollector) snapshotAt(timestamp time.Time) (time.Time, bool) {
+	resolution := s.policy.Resolution
+	if s.downsampled(timestamp) {
+		resolution = s.policy.DownsampledResolution
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	i := sort.Search(len(s.timestamps), func(i int) bool { return s.timestamps[i].After(timestamp) })
+	if i == 0 || timestamp.Sub(s.timestamps[i-1]) >= 2*resolution {
+		return time.Time{}, false
+	}
+	return s.timestamps[i-1], true
+}
+
+// compact deletes the snapshots older than the retention, and downsamples
+// those older than DownsampleAfter, keeping the first of each
+// DownsampledResolution. Downsampled snapshots are put at the start of
+// theirs, which is how they are told apart.
+func (s *SnapshotCollector) compact() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.policy.CompactionInterval)
+	defer cancel()
+
+	s.mtx.Lock()
+	timestamps := append([]time.Time{}, s.timestamps...)
+	s.mtx.Unlock()
+
+	var (
+		now     = mtime.Now()
+		deleted = map[time.Time]bool{}
+		added   []time.Time
+		buckets = map[time.Time]bool{}
+		err     error
+	)
+	for _, t := range timestamps {
+		switch {
+		case s.policy.Retention > 0 && t.Before(now.Add(-s.policy.Retention)):
+			err = s.store.Delete(ctx, t)
+		case s.downsampled(t):
+			bucket := t.Truncate(s.policy.DownsampledResolution)
+			if t.Equal(bucket) {
+				buckets[bucket] = true
+				continue
+			}
+			if !buckets[bucket] {
+				if err = s.downsample(ctx, t, bucket); err == nil {
+					buckets[bucket] = true
+					added = append(added, bucket)
+				}
+			}
+			if err == nil {
+				err = s.store.Delete(ctx, t)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			break
+		}
+		deleted[t] = true
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	kept := added
+	for _, t := range s.timestamps {
+		if !deleted[t] {
+			kept = append(kept, t)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Before(kept[j]) })
+	s.timestamps = kept
+	return err
+}
+
+func (s *SnapshotCollector) downsample(ctx context.Context, from, to time.Time) error {
+	rpt, err := s.store.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(ctx, to, rpt.Downsample())
+}
+
+// Report implements Reporter, from the snapshots for timestamps before the
+// window of the other collector.
+func (s *SnapshotCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	if s.live(timestamp) {
+		return s.Collector.Report(ctx, timestamp)
+	}
+	t, ok := s.snapshotAt(timestamp)
+	if !ok {
+		return report.MakeReport(), nil
+	}
+
+	s.mtx.Lock()
+	if s.cached != nil && s.cachedAt.Equal(t) {
+		defer s.mtx.Unlock()
+		return *s.cached, nil
+	}
+	s.mtx.Unlock()
+
+	rpt, err := s.store.Get(ctx, t)
+	if err != nil {
+		return rpt, err
+	}
+	s.mtx.Lock()
+	s.cached, s.cachedAt = &rpt, t
+	s.mtx.Unlock()
+	return rpt, nil
+}
+
+// HasReports implements Reporter.
+func (s *SnapshotCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	if s.live(timestamp) {
+		return s.Collector.HasReports(ctx, timestamp)
+	}
+	_, ok := s.snapshotAt(timestamp)
+	return ok, nil
+}
+
+// HasHistoricReports implements Reporter.
+func (s *SnapshotCollector) HasHistoricReports() bool {
+	return true
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestSnapshotCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDirReportStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	window := 15 * time.Second
+	resolution := time.Minute
+	start := time.Unix(1500000000, 0)
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	c := NewCollector(window)
+	s, err := NewSnapshotCollector(c, store, window, SnapshotPolicy{Resolution: resolution, CompactionInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(report.MakeNode("before"))
+	c.Add(ctx, rpt, nil)
+	if err := s.snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Travel forward, past the window, and check the past comes from the
+	// snapshot
+	mtime.NowForce(start.Add(resolution))
+	rpt = report.MakeReport()
+	rpt.Container.AddNode(report.MakeNode("after"))
+	c.Add(ctx, rpt, nil)
+
+	have, err := s.Report(ctx, start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Container.Nodes["before"]; !ok || len(have.Container.Nodes) != 1 {
+		t.Errorf("Expected the snapshot, got %v", have.Container.Nodes)
+	}
+	have, err = s.Report(ctx, mtime.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Container.Nodes["after"]; !ok || len(have.Container.Nodes) != 1 {
+		t.Errorf("Expected the live report, got %v", have.Container.Nodes)
+	}
+
+	// There's nothing from before the first snapshot
+	if ok, _ := s.HasReports(ctx, start.Add(-time.Second)); ok {
+		t.Errorf("Expected no reports from before the first snapshot")
+	}
+
+	// Snapshots outlive the app
+	s2, err := NewSnapshotCollector(NewCollector(window), store, window, SnapshotPolicy{Resolution: resolution, CompactionInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Stop()
+	if ok, err := s2.HasReports(ctx, start.Add(time.Second)); err != nil || !ok {
+		t.Errorf("Expected snapshots to be listed from the store")
+	}
+}
+
+func TestSnapshotCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDirReportStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	start := time.Unix(1500000000, 0).Truncate(time.Hour).Add(7 * time.Second)
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	// A snapshot every ten minutes, for five hours
+	c := NewCollector(time.Minute)
+	s, err := NewSnapshotCollector(c, store, time.Minute, SnapshotPolicy{
+		Resolution:            10 * time.Minute,
+		DownsampleAfter:       2 * time.Hour,
+		DownsampledResolution: time.Hour,
+		Retention:             4 * time.Hour,
+		CompactionInterval:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	for i := 1; i <= 30; i++ {
+		mtime.NowForce(start.Add(time.Duration(i) * 10 * time.Minute))
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode("host").WithMetrics(report.Metrics{
+			"load": report.MakeMetric([]report.Sample{{Timestamp: mtime.Now(), Value: 1}, {Timestamp: mtime.Now().Add(time.Second), Value: 2}}),
+		}))
+		c.Add(ctx, rpt, nil)
+		if err := s.snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Gone are the first hour, and one downsampled snapshot is left of
+	// each of the next two
+	now := mtime.Now()
+	timestamps, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 2+13, len(timestamps); want != have {
+		t.Errorf("Expected %d snapshots, got %d", want, have)
+	}
+	if ok, _ := s.HasReports(ctx, now.Add(-4*time.Hour-time.Minute)); ok {
+		t.Errorf("Expected snapshots past the retention to be gone")
+	}
+	rpt, err := s.Report(ctx, now.Add(-3*time.Hour+30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric := rpt.Host.Nodes["host"].Metrics["load"]; metric.Len() != 1 || metric.Max != 2 {
+		t.Errorf("Expected a downsampled snapshot, got %v", metric)
+	}
+	rpt, err = s.Report(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric := rpt.Host.Nodes["host"].Metrics["load"]; metric.Len() != 2 {
+		t.Errorf("Expected a snapshot as it was taken, got %v", metric)
+	}
+}
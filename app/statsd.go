@@ -0,0 +1,318 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// StatsdMetricPrefix prefixes the IDs of the metrics received over statsd
+	StatsdMetricPrefix = "statsd_"
+
+	// statsdInterval is the resolution of the samples made of statsd metrics
+	statsdInterval = time.Second
+	// maxStatsdSeries bounds the metrics kept, over all nodes.
+	maxStatsdSeries = 10000
+	// maxStatsdPacket is the largest UDP packet we read.
+	maxStatsdPacket = 65535
+	// statsdPriority puts statsd metrics after the CPU and memory ones.
+	statsdPriority = 20
+)
+
+// The tags a metric can be joined to a node by
+var (
+	statsdContainerTags = []string{"container_id", "container.id"}
+	statsdPodTags       = []string{"pod_uid", "k8s.pod.uid"}
+)
+
+// StatsdCollector is a Collector which listens for StatsD and DogStatsD
+// metrics, tagged with the container or pod they're about, and adds them to
+// the metrics of those nodes, in its reports.
+type StatsdCollector struct {
+	Collector
+	conn   net.PacketConn
+	window time.Duration
+
+	mtx    sync.Mutex
+	series map[statsdSeriesKey]*statsdSeries
+}
+
+type statsdSeriesKey struct {
+	topology, nodeID, name string
+}
+
+type statsdSeries struct {
+	kind    string
+	buckets []statsdBucket
+}
+
+// statsdBucket is what was received of a metric in a statsdInterval
+type statsdBucket struct {
+	t     time.Time
+	sum   float64
+	count float64
+	last  float64
+}
+
+// NewStatsdCollector makes a new StatsdCollector, listening on the UDP
+// address addr, and keeping a window of metrics.
+func NewStatsdCollector(c Collector, addr string, window time.Duration) (*StatsdCollector, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StatsdCollector{
+		Collector: c,
+		conn:      conn,
+		window:    window,
+		series:    map[statsdSeriesKey]*statsdSeries{},
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Stop stops listening.
+func (s *StatsdCollector) Stop() {
+	s.conn.Close()
+}
+
+func (s *StatsdCollector) loop() {
+	buf := make([]byte, maxStatsdPacket)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				log.Errorf("statsd: %v", err)
+			}
+			return
+		}
+		now := mtime.Now()
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if err := s.add(now, line); err != nil {
+				log.Debugf("statsd: %q: %v", line, err)
+			}
+		}
+	}
+}
+
+// add adds a line, of the form name:value|type[|@sample_rate][|#tag:value,...]
+func (s *StatsdCollector) add(now time.Time, line string) error {
+	m, err := parseStatsdLine(line)
+	if err != nil {
+		return err
+	}
+	var keys []statsdSeriesKey
+	for _, tag := range statsdContainerTags {
+		if id, ok := m.tags[tag]; ok {
+			keys = append(keys, statsdSeriesKey{report.Container, report.MakeContainerNodeID(id), m.name})
+			break
+		}
+	}
+	for _, tag := range statsdPodTags {
+		if uid, ok := m.tags[tag]; ok {
+			keys = append(keys, statsdSeriesKey{report.Pod, report.MakePodNodeID(uid), m.name})
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no container or pod tag")
+	}
+
+	t := now.Truncate(statsdInterval)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, key := range keys {
+		series, ok := s.series[key]
+		if !ok {
+			if len(s.series) >= maxStatsdSeries {
+				s.prune(now)
+				if len(s.series) >= maxStatsdSeries {
+					return fmt.Errorf("too many metrics")
+				}
+			}
+			series = &statsdSeries{kind: m.kind}
+			s.series[key] = series
+		}
+		series.add(t, m)
+	}
+	return nil
+}
+
+func (s *statsdSeries) add(t time.Time, m statsdMetric) {
+	var last float64
+	if len(s.buckets) > 0 {
+		last = s.buckets[len(s.buckets)-1].last
+	}
+	if len(s.buckets) == 0 || s.buckets[len(s.buckets)-1].t.Before(t) {
+		s.buckets = append(s.buckets, statsdBucket{t: t, last: last})
+	}
+	b := &s.buckets[len(s.buckets)-1]
+	switch m.kind {
+	case "c":
+		b.sum += m.value / m.sampleRate
+	case "g":
+		if m.delta {
+			b.last += m.value
+		} else {
+			b.last = m.value
+		}
+	default:
+		b.sum += m.value
+		b.count++
+	}
+}
+
+// prune forgets the metrics not received within the window.
+func (s *StatsdCollector) prune(now time.Time) {
+	cutoff := now.Add(-s.window)
+	for key, series := range s.series {
+		i := 0
+		for i < len(series.buckets) && series.buckets[i].t.Before(cutoff) {
+			i++
+		}
+		if i == len(series.buckets) {
+			delete(s.series, key)
+		} else if i > 0 {
+			// Gauges keep their value from before the window
+			if series.kind == "g" {
+				i--
+			}
+			series.buckets = series.buckets[i:]
+		}
+	}
+}
+
+// Report implements Reporter, adding the statsd metrics to the container and
+// pod nodes of the report.
+func (s *StatsdCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	rpt, err := s.Collector.Report(ctx, timestamp)
+	if err != nil {
+		return rpt, err
+	}
+
+	metrics := report.MakeReport()
+	s.mtx.Lock()
+	s.prune(mtime.Now())
+	for key, series := range s.series {
+		topology, _ := rpt.Topology(key.topology)
+		if _, ok := topology.Nodes[key.nodeID]; !ok {
+			continue
+		}
+		metric, ok := series.metric(timestamp.Add(-s.window), timestamp)
+		if !ok {
+			continue
+		}
+		id := StatsdMetricPrefix + key.name
+		extra := &metrics.Container
+		if key.topology == report.Pod {
+			extra = &metrics.Pod
+		}
+		extra.AddNode(report.MakeNode(key.nodeID).WithTopology(key.topology).WithMetrics(report.Metrics{id: metric}))
+		*extra = extra.WithMetricTemplates(report.MetricTemplates{
+			id: {ID: id, Label: key.name, Priority: statsdPriority},
+		})
+	}
+	s.mtx.Unlock()
+	return rpt.Merge(metrics), nil
+}
+
+// metric returns the samples of the series between from and to: the rate of
+// counters, the value of gauges, and the mean of timers and histograms.
+func (s *statsdSeries) metric(from, to time.Time) (report.Metric, bool) {
+	var samples []report.Sample
+	for _, b := range s.buckets {
+		if b.t.After(to) {
+			break
+		}
+		var value float64
+		switch {
+		case s.kind == "c":
+			value = b.sum / statsdInterval.Seconds()
+		case s.kind == "g":
+			value = b.last
+		case b.count > 0:
+			value = b.sum / b.count
+		default:
+			continue
+		}
+		t := b.t
+		if t.Before(from) {
+			if s.kind != "g" {
+				continue
+			}
+			// The value of a gauge holds until it changes
+			t = from
+		}
+		if len(samples) > 0 && !samples[len(samples)-1].Timestamp.Before(t) {
+			samples = samples[:len(samples)-1]
+		}
+		samples = append(samples, report.Sample{Timestamp: t, Value: value})
+	}
+	if len(samples) == 0 {
+		return report.Metric{}, false
+	}
+	return report.MakeMetric(samples), true
+}
+
+type statsdMetric struct {
+	name       string
+	value      float64
+	delta      bool
+	kind       string
+	sampleRate float64
+	tags       map[string]string
+}
+
+func parseStatsdLine(line string) (statsdMetric, error) {
+	m := statsdMetric{sampleRate: 1, tags: map[string]string{}}
+	i := strings.LastIndex(line[:strings.IndexByte(line+"|", '|')], ":")
+	if i <= 0 {
+		return m, fmt.Errorf("missing name")
+	}
+	m.name = line[:i]
+	fields := strings.Split(line[i+1:], "|")
+	if len(fields) < 2 {
+		return m, fmt.Errorf("missing type")
+	}
+	value := fields[0]
+	m.kind = fields[1]
+	switch m.kind {
+	case "c", "ms", "h", "d":
+	case "g":
+		m.delta = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	default:
+		return m, fmt.Errorf("unsupported type %q", m.kind)
+	}
+	var err error
+	if m.value, err = strconv.ParseFloat(value, 64); err != nil {
+		return m, err
+	}
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			if m.sampleRate, err = strconv.ParseFloat(field[1:], 64); err != nil || m.sampleRate <= 0 || m.sampleRate > 1 {
+				return m, fmt.Errorf("bad sample rate %q", field)
+			}
+		case strings.HasPrefix(field, "#"):
+			for _, tag := range strings.Split(field[1:], ",") {
+				if kv := strings.SplitN(tag, ":", 2); len(kv) == 2 {
+					m.tags[kv[0]] = kv[1]
+				}
+			}
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	have, err := parseStatsdLine("http.requests:2|c|@0.5|#container_id:abc,env:prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := statsdMetric{
+		name:       "http.requests",
+		value:      2,
+		kind:       "c",
+		sampleRate: 0.5,
+		tags:       map[string]string{"container_id": "abc", "env": "prod"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+
+	for _, line := range []string{"foo", "foo:1", "foo:1|x", "foo:bar|c", "foo:1|c|@2", ":1|c"} {
+		if _, err := parseStatsdLine(line); err == nil {
+			t.Errorf("Expected %q not to parse", line)
+		}
+	}
+}
+
+func TestStatsdCollector(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	s := &StatsdCollector{
+		Collector: StaticCollector(fixture.Report),
+		window:    15 * time.Second,
+		series:    map[statsdSeriesKey]*statsdSeries{},
+	}
+	for _, l := range []struct {
+		at   time.Duration
+		line string
+	}{
+		{-20 * time.Second, "queue.depth:7|g|#container_id:" + fixture.ServerContainerID},
+		{-2 * time.Second, "http.requests:1|c|#container_id:" + fixture.ServerContainerID},
+		{-2 * time.Second, "http.requests:1|c|@0.5|#container_id:" + fixture.ServerContainerID},
+		{-1 * time.Second, "queue.depth:+1|g|#container_id:" + fixture.ServerContainerID},
+		{-1 * time.Second, "http.latency:10|ms|#container_id:" + fixture.ServerContainerID},
+		{-1 * time.Second, "http.latency:20|ms|#container_id:" + fixture.ServerContainerID},
+		{-1 * time.Second, "http.requests:1|c|#container_id:gone"},
+	} {
+		if err := s.add(now.Add(l.at), l.line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.add(now, "untagged:1|c"); err == nil {
+		t.Errorf("Expected untagged metrics to be refused")
+	}
+
+	rpt, err := s.Report(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpt.Container.Nodes[fixture.ServerContainerNodeID]
+	for id, want := range map[string][]report.Sample{
+		"statsd_http.requests": {{Timestamp: now.Add(-2 * time.Second), Value: 3}},
+		"statsd_queue.depth":   {{Timestamp: now.Add(-15 * time.Second), Value: 7}, {Timestamp: now.Add(-1 * time.Second), Value: 8}},
+		"statsd_http.latency":  {{Timestamp: now.Add(-1 * time.Second), Value: 15}},
+	} {
+		have, ok := server.Metrics.Lookup(id)
+		if !ok {
+			t.Errorf("Expected metric %s", id)
+			continue
+		}
+		if !reflect.DeepEqual(want, have.Samples) {
+			t.Errorf("Expected %s to be %v, got %v", id, want, have.Samples)
+		}
+		if _, ok := rpt.Container.MetricTemplates[id]; !ok {
+			t.Errorf("Expected a template for %s", id)
+		}
+	}
+	if _, ok := rpt.Container.Nodes[report.MakeContainerNodeID("gone")]; ok {
+		t.Errorf("Expected no node for containers not in the report")
+	}
+	if _, ok := fixture.Report.Container.Nodes[fixture.ServerContainerNodeID].Metrics.Lookup("statsd_http.requests"); ok {
+		t.Errorf("Expected the report of the collector to be left alone")
+	}
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// ReportTagger tags the nodes of reports with what the app knows of them,
+// but their probes don't, reporting whether it tagged any.
+type ReportTagger interface {
+	Tag(report.Report) (report.Report, bool)
+}
+
+// TaggingCollector is a Collector which tags the reports added to another
+// as they come in, so what the app knows is only looked up once, rather
+// than by every probe.
+type TaggingCollector struct {
+	Collector
+	tagger ReportTagger
+}
+
+// NewTaggingCollector makes a new TaggingCollector, tagging the reports
+// added to c with tagger.
+func NewTaggingCollector(c Collector, tagger ReportTagger) *TaggingCollector {
+	return &TaggingCollector{Collector: c, tagger: tagger}
+}
+
+// Add implements Adder. The encoded report is re-encoded when it's tagged,
+// for the collectors which store it as it is.
+func (t *TaggingCollector) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	rpt, tagged := t.tagger.Tag(rpt)
+	if tagged {
+		var encoded bytes.Buffer
+		if err := rpt.WriteBinary(&encoded, gzip.DefaultCompression); err != nil {
+			return err
+		}
+		buf = encoded.Bytes()
+	}
+	return t.Collector.Add(ctx, rpt, buf)
+}
@@ -0,0 +1,73 @@
+package app_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/report"
+)
+
+type tagger map[string]string
+
+func (t tagger) Tag(rpt report.Report) (report.Report, bool) {
+	tagged := false
+	for id, node := range rpt.Endpoint.Nodes {
+		if name, ok := t[id]; ok {
+			rpt.Endpoint.Nodes[id] = node.WithLatests(map[string]string{report.LoadBalancerName: name})
+			tagged = true
+		}
+	}
+	return rpt, tagged
+}
+
+type bufCollector struct {
+	app.Collector
+	bufs [][]byte
+}
+
+func (c *bufCollector) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	c.bufs = append(c.bufs, buf)
+	return c.Collector.Add(ctx, rpt, buf)
+}
+
+func TestTaggingCollector(t *testing.T) {
+	ctx := context.Background()
+	inner := &bufCollector{Collector: app.NewCollector(time.Minute)}
+	c := app.NewTaggingCollector(inner, tagger{";10.0.1.5;80": "web"})
+
+	// Reports with nothing to tag are added as they came
+	untagged := report.MakeReport()
+	untagged.Endpoint.AddNode(report.MakeNode(";10.0.1.6;80"))
+	if err := c.Add(ctx, untagged, []byte("untouched")); err != nil {
+		t.Fatal(err)
+	}
+	if string(inner.bufs[0]) != "untouched" {
+		t.Errorf("untagged report re-encoded as %q", inner.bufs[0])
+	}
+
+	// Tagged reports are re-encoded, for collectors storing them
+	tagged := report.MakeReport()
+	tagged.Endpoint.AddNode(report.MakeNode(";10.0.1.5;80"))
+	if err := c.Add(ctx, tagged, []byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := report.MakeFromBinary(bytes.NewReader(inner.bufs[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := decoded.Endpoint.Nodes[";10.0.1.5;80"].Latest.Lookup(report.LoadBalancerName); name != "web" {
+		t.Errorf("encoded report has load balancer %q", name)
+	}
+
+	rpt, err := c.Report(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := rpt.Endpoint.Nodes[";10.0.1.5;80"].Latest.Lookup(report.LoadBalancerName); name != "web" {
+		t.Errorf("collected report has load balancer %q", name)
+	}
+}
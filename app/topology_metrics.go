@@ -0,0 +1,143 @@
+package app
+
+import (
+	"net/url"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+var (
+	topologyNodesDesc = prometheus.NewDesc(
+		"scope_topology_nodes",
+		"Number of nodes in a topology, as rendered with its default options.",
+		[]string{"topology", "pseudo"}, nil,
+	)
+	topologyEdgesDesc = prometheus.NewDesc(
+		"scope_topology_edges",
+		"Number of edges between the nodes of a topology, as rendered with its default options.",
+		[]string{"topology"}, nil,
+	)
+	serviceConnectionsDesc = prometheus.NewDesc(
+		"scope_service_connections",
+		"Number of connections from one Kubernetes service to another, or to a pseudo node.",
+		[]string{"source_namespace", "source", "destination_namespace", "destination"}, nil,
+	)
+	containerRestartsDesc = prometheus.NewDesc(
+		"scope_container_restarts_total",
+		"Number of times a container has been restarted.",
+		[]string{"container_id", "container_name"}, nil,
+	)
+)
+
+// TopologyMetrics is a prometheus.Collector exporting metrics of the world
+// as the app sees it, rendered from the latest report, so that alerts can be
+// built on it.
+type TopologyMetrics struct {
+	reporter Reporter
+	registry *Registry
+}
+
+// NewTopologyMetrics makes a new TopologyMetrics, rendering the reports of
+// reporter.
+func NewTopologyMetrics(reporter Reporter) *TopologyMetrics {
+	return &TopologyMetrics{
+		reporter: reporter,
+		registry: topologyRegistry,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (t *TopologyMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- topologyNodesDesc
+	ch <- topologyEdgesDesc
+	ch <- serviceConnectionsDesc
+	ch <- containerRestartsDesc
+}
+
+// Collect implements prometheus.Collector
+func (t *TopologyMetrics) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	rpt, err := t.reporter.Report(ctx, mtime.Now())
+	if err != nil {
+		log.Errorf("Error getting report for topology metrics: %v", err)
+		return
+	}
+	t.collectTopologies(ctx, rpt, ch)
+	t.collectServiceConnections(ctx, rpt, ch)
+	collectContainerRestarts(rpt, ch)
+}
+
+func (t *TopologyMetrics) collectTopologies(ctx context.Context, rpt report.Report, ch chan<- prometheus.Metric) {
+	collect := func(id string) {
+		renderer, filter, err := t.registry.RendererForTopology(ctx, id, url.Values{}, rpt)
+		if err != nil {
+			return
+		}
+		stats := computeStats(rpt, renderer, filter)
+		ch <- prometheus.MustNewConstMetric(topologyNodesDesc, prometheus.GaugeValue, float64(stats.NonpseudoNodeCount), id, "false")
+		ch <- prometheus.MustNewConstMetric(topologyNodesDesc, prometheus.GaugeValue, float64(stats.NodeCount-stats.NonpseudoNodeCount), id, "true")
+		ch <- prometheus.MustNewConstMetric(topologyEdgesDesc, prometheus.GaugeValue, float64(stats.EdgeCount), id)
+	}
+	t.registry.walk(func(desc APITopologyDesc) {
+		collect(desc.id)
+		for _, sub := range desc.SubTopologies {
+			collect(sub.id)
+		}
+	})
+}
+
+func (t *TopologyMetrics) collectServiceConnections(ctx context.Context, rpt report.Report, ch chan<- prometheus.Metric) {
+	renderer, filter, err := t.registry.RendererForTopology(ctx, servicesID, url.Values{}, rpt)
+	if err != nil {
+		return
+	}
+	// Pseudo nodes may share labels, so add up their connections
+	type pair struct{ source, destination serviceName }
+	counts := map[pair]int{}
+	nodes := render.Render(rpt, renderer, filter).Nodes
+	for _, n := range nodes {
+		for id, count := range detailed.OutgoingConnectionCounts(rpt, n, nodes) {
+			counts[pair{makeServiceName(rpt, n), makeServiceName(rpt, nodes[id])}] += count
+		}
+	}
+	for p, count := range counts {
+		ch <- prometheus.MustNewConstMetric(serviceConnectionsDesc, prometheus.GaugeValue, float64(count),
+			p.source.namespace, p.source.name, p.destination.namespace, p.destination.name)
+	}
+}
+
+// serviceName is the namespace and name of a service, or just the label of a
+// pseudo node.
+type serviceName struct{ namespace, name string }
+
+func makeServiceName(rpt report.Report, n report.Node) serviceName {
+	namespace, _ := n.Latest.Lookup(kubernetes.Namespace)
+	summary, _ := detailed.MakeBasicNodeSummary(rpt, n)
+	return serviceName{namespace, summary.Label}
+}
+
+func collectContainerRestarts(rpt report.Report, ch chan<- prometheus.Metric) {
+	for _, n := range rpt.Container.Nodes {
+		value, ok := n.Latest.Lookup(docker.ContainerRestartCount)
+		if !ok {
+			continue
+		}
+		restarts, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		id, _ := n.Latest.Lookup(docker.ContainerID)
+		name, _ := n.Latest.Lookup(docker.ContainerName)
+		ch <- prometheus.MustNewConstMetric(containerRestartsDesc, prometheus.CounterValue, float64(restarts), id, name)
+	}
+}
@@ -0,0 +1,69 @@
+package app_test
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+var fqNameRegexp = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+// collect returns the values of the metrics of c, by name and labels, e.g.
+// scope_topology_edges{topology="hosts"}
+func collect(t *testing.T, c prometheus.Collector) map[string]float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	result := map[string]float64{}
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		labels := []string{}
+		for _, l := range pb.Label {
+			labels = append(labels, l.GetName()+"=\""+l.GetValue()+"\"")
+		}
+		sort.Strings(labels)
+		key := fqNameRegexp.FindStringSubmatch(m.Desc().String())[1] + "{" + strings.Join(labels, ",") + "}"
+		if _, ok := result[key]; ok {
+			t.Errorf("Duplicate metric %s", key)
+		}
+		result[key] = pb.GetGauge().GetValue() + pb.GetCounter().GetValue()
+	}
+	return result
+}
+
+func TestTopologyMetrics(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	rpt.Container.Nodes[fixture.ServerContainerNodeID] = rpt.Container.Nodes[fixture.ServerContainerNodeID].
+		WithLatests(map[string]string{docker.ContainerRestartCount: "3"})
+
+	have := collect(t, app.NewTopologyMetrics(app.StaticCollector(rpt)))
+	for key, want := range map[string]float64{
+		`scope_topology_nodes{pseudo="false",topology="hosts"}`:      2,
+		`scope_topology_nodes{pseudo="false",topology="containers"}`: 2,
+		`scope_topology_edges{topology="hosts"}`:                     3,
+		`scope_container_restarts_total{container_id="` + fixture.ServerContainerID + `",container_name="` + fixture.ServerContainerName + `"}`: 3,
+	} {
+		if have[key] != want {
+			t.Errorf("Expected %s to be %v, got %v", key, want, have[key])
+		}
+	}
+	for key := range have {
+		if strings.HasPrefix(key, "scope_service_connections{") {
+			return
+		}
+	}
+	t.Errorf("Expected connections between services, got %v", have)
+}
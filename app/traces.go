@@ -0,0 +1,345 @@
+package app
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// maxTraceBody bounds the size of a batch of spans, uncompressed.
+	maxTraceBody = 16 * 1024 * 1024
+	// maxTraceSpans bounds the spans waiting for the other end of their request.
+	maxTraceSpans = 100000
+	// maxEdgeRequests bounds the requests kept per pair of resources.
+	maxEdgeRequests = 10000
+
+	// Span kinds, from the OpenTelemetry protocol
+	spanKindServer   = 2
+	spanKindClient   = 3
+	spanKindProducer = 4
+	spanKindConsumer = 5
+
+	servicePrefix = "service:"
+)
+
+// TraceStore joins the spans of traces, received over the OpenTelemetry
+// protocol, into requests between the containers, pods and services which
+// made and served them, and gives the rate and latency of those requests to
+// the edges between nodes.
+type TraceStore struct {
+	window time.Duration
+
+	mtx sync.Mutex
+	// Client spans, by trace and span ID, waiting for the span serving them
+	clients map[string]traceSpan
+	// Server spans, by trace and parent span ID, waiting for their client
+	servers  map[string]traceSpan
+	requests map[traceEdge][]traceRequest
+}
+
+// traceResource is what a span's resource can be joined to: the IDs of its
+// container and pod nodes, and its service.
+type traceResource struct {
+	container, pod, service string
+}
+
+type traceEdge struct {
+	from, to traceResource
+}
+
+type traceSpan struct {
+	resource   traceResource
+	start, end time.Time
+}
+
+type traceRequest struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// NewTraceStore makes a new TraceStore, giving the stats of the requests of
+// the last window.
+func NewTraceStore(window time.Duration) *TraceStore {
+	return &TraceStore{
+		window:   window,
+		clients:  map[string]traceSpan{},
+		servers:  map[string]traceSpan{},
+		requests: map[traceEdge][]traceRequest{},
+	}
+}
+
+// RegisterTraceRoutes registers the OTLP/HTTP endpoint for traces, taking
+// JSON encoded spans.
+func RegisterTraceRoutes(router *mux.Router, traces *TraceStore) {
+	router.Methods("POST").Path("/v1/traces").HandlerFunc(
+		requestContextDecorator(makeTraceHandler(traces)))
+}
+
+func makeTraceHandler(traces *TraceStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			respondWith(w, http.StatusUnsupportedMediaType, "only JSON encoded spans are supported")
+			return
+		}
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				respondWith(w, http.StatusBadRequest, err)
+				return
+			}
+			defer gzipReader.Close()
+			reader = gzipReader
+		}
+		var batch otlpTraces
+		if err := json.NewDecoder(io.LimitReader(reader, maxTraceBody)).Decode(&batch); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		traces.add(batch)
+		respondWith(w, http.StatusOK, struct{}{})
+	}
+}
+
+// add joins the spans of a batch with those already received.
+func (t *TraceStore) add(batch otlpTraces) {
+	now := mtime.Now()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.prune(now)
+	for _, rs := range batch.ResourceSpans {
+		resource, ok := rs.Resource.traceResource()
+		if !ok {
+			continue
+		}
+		for _, ss := range append(rs.ScopeSpans, rs.InstrumentationLibrarySpans...) {
+			for _, s := range ss.Spans {
+				span := traceSpan{
+					resource: resource,
+					start:    time.Unix(0, int64(s.StartTimeUnixNano)),
+					end:      time.Unix(0, int64(s.EndTimeUnixNano)),
+				}
+				switch s.Kind {
+				case spanKindClient, spanKindProducer:
+					key := s.TraceID + "/" + s.SpanID
+					if server, ok := t.servers[key]; ok {
+						delete(t.servers, key)
+						t.addRequest(span, server)
+					} else if len(t.clients) < maxTraceSpans {
+						t.clients[key] = span
+					}
+				case spanKindServer, spanKindConsumer:
+					if s.ParentSpanID == "" {
+						continue
+					}
+					key := s.TraceID + "/" + s.ParentSpanID
+					if client, ok := t.clients[key]; ok {
+						delete(t.clients, key)
+						t.addRequest(client, span)
+					} else if len(t.servers) < maxTraceSpans {
+						t.servers[key] = span
+					}
+				}
+			}
+		}
+	}
+}
+
+// addRequest records a request, taking as long as the client waited for it.
+func (t *TraceStore) addRequest(client, server traceSpan) {
+	if client.resource == server.resource {
+		return
+	}
+	edge := traceEdge{from: client.resource, to: server.resource}
+	requests := t.requests[edge]
+	if len(requests) >= maxEdgeRequests {
+		requests = requests[1:]
+	}
+	t.requests[edge] = append(requests, traceRequest{at: client.end, latency: client.end.Sub(client.start)})
+}
+
+// prune forgets the spans and requests from before the window.
+func (t *TraceStore) prune(now time.Time) {
+	cutoff := now.Add(-t.window)
+	for _, spans := range []map[string]traceSpan{t.clients, t.servers} {
+		for key, span := range spans {
+			if span.end.Before(cutoff) {
+				delete(spans, key)
+			}
+		}
+	}
+	for edge, requests := range t.requests {
+		// Requests are added as they end, which isn't quite in order
+		recent := requests[:0]
+		for _, r := range requests {
+			if !r.at.Before(cutoff) {
+				recent = append(recent, r)
+			}
+		}
+		if len(recent) == 0 {
+			delete(t.requests, edge)
+		} else {
+			t.requests[edge] = recent
+		}
+	}
+}
+
+// EdgeStats implements detailed.Traces
+func (t *TraceStore) EdgeStats(nodes report.Nodes) map[string]map[string]detailed.EdgeStats {
+	index := map[string][]string{}
+	for id, n := range nodes {
+		for _, identity := range nodeIdentities(n) {
+			index[identity] = append(index[identity], id)
+		}
+	}
+
+	type edge struct{ from, to string }
+	latencies := map[edge][]time.Duration{}
+	t.mtx.Lock()
+	t.prune(mtime.Now())
+	for e, requests := range t.requests {
+		for _, from := range e.from.matches(index) {
+			for _, to := range e.to.matches(index) {
+				if from == to || !nodes[from].Adjacency.Contains(to) {
+					continue
+				}
+				for _, r := range requests {
+					latencies[edge{from, to}] = append(latencies[edge{from, to}], r.latency)
+				}
+			}
+		}
+	}
+	t.mtx.Unlock()
+
+	result := map[string]map[string]detailed.EdgeStats{}
+	for e, ls := range latencies {
+		sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+		p99 := ls[int(math.Ceil(0.99*float64(len(ls))))-1]
+		if result[e.from] == nil {
+			result[e.from] = map[string]detailed.EdgeStats{}
+		}
+		result[e.from][e.to] = detailed.EdgeStats{
+			RequestRate: float64(len(ls)) / t.window.Seconds(),
+			LatencyP99:  float64(p99) / float64(time.Millisecond),
+		}
+	}
+	return result
+}
+
+// nodeIdentities returns what resources of spans can be joined to a rendered
+// node: it, and its children.
+func nodeIdentities(n report.Node) []string {
+	var identities []string
+	add := func(n report.Node) {
+		switch n.Topology {
+		case report.Container, report.Pod:
+			identities = append(identities, n.ID)
+		case report.Service:
+			namespace, _ := n.Latest.Lookup(kubernetes.Namespace)
+			name, _ := n.Latest.Lookup(kubernetes.Name)
+			identities = append(identities, servicePrefix+namespace+"/"+name)
+		}
+	}
+	add(n)
+	n.Children.ForEach(add)
+	return identities
+}
+
+// matches returns the IDs of the nodes in the index the resource joins to.
+func (r traceResource) matches(index map[string][]string) []string {
+	seen := map[string]struct{}{}
+	var result []string
+	for _, identity := range []string{r.container, r.pod, r.service} {
+		if identity == "" {
+			continue
+		}
+		for _, id := range index[identity] {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// The parts of the JSON encoding of the OpenTelemetry protocol we need. See
+// https://github.com/open-telemetry/opentelemetry-proto
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	// InstrumentationLibrarySpans is what ScopeSpans were, before v0.15.0
+	InstrumentationLibrarySpans []otlpScopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpScopeSpans struct {
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano otlpUint64 `json:"startTimeUnixNano"`
+	EndTimeUnixNano   otlpUint64 `json:"endTimeUnixNano"`
+}
+
+// otlpUint64 is a uint64, which JSON encodes as a string, but not always.
+type otlpUint64 uint64
+
+func (u *otlpUint64) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseUint(strings.Trim(string(b), `"`), 10, 64)
+	*u = otlpUint64(n)
+	return err
+}
+
+// traceResource joins a resource by its semantic conventions attributes.
+func (r otlpResource) traceResource() (traceResource, bool) {
+	attributes := map[string]string{}
+	for _, a := range r.Attributes {
+		attributes[a.Key] = a.Value.StringValue
+	}
+	var result traceResource
+	if id := attributes["container.id"]; id != "" {
+		result.container = report.MakeContainerNodeID(id)
+	}
+	if uid := attributes["k8s.pod.uid"]; uid != "" {
+		result.pod = report.MakePodNodeID(uid)
+	}
+	if name := attributes["service.name"]; name != "" {
+		result.service = servicePrefix + attributes["k8s.namespace.name"] + "/" + name
+	}
+	return result, result != traceResource{}
+}
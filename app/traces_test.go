@@ -0,0 +1,79 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+// otlpSpan is a batch of a span of the given kind, from the given container.
+func otlpSpan(containerID string, kind int, spanID, parentSpanID string, start, end time.Time) string {
+	return fmt.Sprintf(`{"resourceSpans": [{
+		"resource": {"attributes": [{"key": "container.id", "value": {"stringValue": %q}}]},
+		"scopeSpans": [{"spans": [{
+			"traceId": "0af7651916cd43dd8448eb211c80319c",
+			"spanId": %q,
+			"parentSpanId": %q,
+			"kind": %d,
+			"startTimeUnixNano": "%d",
+			"endTimeUnixNano": %d
+		}]}]
+	}]}`, containerID, spanID, parentSpanID, kind, start.UnixNano(), end.UnixNano())
+}
+
+func TestTraces(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	traces := app.NewTraceStore(time.Minute)
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTraceRoutes(router, traces)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: app.StaticCollector(fixture.Report), Traces: traces}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(contentType, body string) int {
+		resp, err := http.Post(ts.URL+"/v1/traces", contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post("application/x-protobuf", ""); status != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected protobuf to be refused, got %d", status)
+	}
+	// The server span of a request usually arrives before its client span
+	for _, batch := range []string{
+		otlpSpan(fixture.ServerContainerID, 2, "b7ad6b7169203331", "00f067aa0ba902b7", now.Add(-2*time.Second), now.Add(-1*time.Second)),
+		otlpSpan(fixture.ClientContainerID, 3, "00f067aa0ba902b7", "", now.Add(-3*time.Second), now.Add(-1*time.Second)),
+	} {
+		if status := post("application/json", batch); status != http.StatusOK {
+			t.Fatalf("Expected spans to be accepted, got %d", status)
+		}
+	}
+
+	var topology app.APITopology
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/topology/containers"), &codec.JsonHandle{}).Decode(&topology); err != nil {
+		t.Fatal(err)
+	}
+	have := topology.Nodes[fixture.ClientContainerNodeID].EdgeStats[fixture.ServerContainerNodeID]
+	if want := (detailed.EdgeStats{RequestRate: 1.0 / 60, LatencyP99: 2000}); have != want {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if len(topology.Nodes[fixture.ServerContainerNodeID].EdgeStats) != 0 {
+		t.Errorf("Expected no stats for the server's edges")
+	}
+}
@@ -0,0 +1,377 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/net/context"
+)
+
+// ErrViewNotFound is returned by ViewStores asked for views they don't
+// have.
+var ErrViewNotFound = errors.New("view not found")
+
+// View is a named view of the UI: a topology, with its options, searches
+// and pinned metric, for users to go back to and share. Its fields are
+// named as in the state of the UI.
+type View struct {
+	ID               string              `json:"id"`
+	Name             string              `json:"name"`
+	TopologyID       string              `json:"topologyId"`
+	TopologyOptions  map[string][]string `json:"topologyOptions,omitempty"`
+	SearchQuery      string              `json:"searchQuery,omitempty"`
+	PinnedSearches   []string            `json:"pinnedSearches,omitempty"`
+	PinnedMetricType string              `json:"pinnedMetricType,omitempty"`
+	Created          time.Time           `json:"created"`
+	Updated          time.Time           `json:"updated"`
+
+	// URL opens the UI in the view. It is only set on views served by the
+	// API.
+	URL string `json:"url,omitempty"`
+}
+
+// StateURL returns the URL of the UI in the view, as the UI puts its state
+// in its URL.
+func (v View) StateURL() string {
+	state := struct {
+		TopologyID       string                         `json:"topologyId"`
+		TopologyOptions  map[string]map[string][]string `json:"topologyOptions,omitempty"`
+		SearchQuery      string                         `json:"searchQuery,omitempty"`
+		PinnedSearches   []string                       `json:"pinnedSearches,omitempty"`
+		PinnedMetricType string                         `json:"pinnedMetricType,omitempty"`
+	}{
+		TopologyID:       v.TopologyID,
+		SearchQuery:      v.SearchQuery,
+		PinnedSearches:   v.PinnedSearches,
+		PinnedMetricType: v.PinnedMetricType,
+	}
+	if len(v.TopologyOptions) > 0 {
+		state.TopologyOptions = map[string]map[string][]string{v.TopologyID: v.TopologyOptions}
+	}
+	buf, _ := json.Marshal(state)
+	// As the UI does, as it can't route states with slashes in
+	return "/#!/state/" + strings.NewReplacer("%", "<PERCENT>", "/", "<SLASH>").Replace(string(buf))
+}
+
+// ViewStore keeps the views of users.
+type ViewStore interface {
+	// List returns the views of the user making the request.
+	List(ctx context.Context) ([]View, error)
+	Get(ctx context.Context, id string) (View, error)
+	// Put adds the view, or replaces the one with its ID.
+	Put(ctx context.Context, view View) error
+	Delete(ctx context.Context, id string) error
+}
+
+// NewMemoryViewStore makes a ViewStore keeping views in memory, for as
+// long as the app runs. userIDer identifies the user of a request.
+func NewMemoryViewStore(userIDer func(context.Context) (string, error)) ViewStore {
+	return &memoryViewStore{userIDer: userIDer, views: map[string]map[string]View{}}
+}
+
+type memoryViewStore struct {
+	userIDer func(context.Context) (string, error)
+
+	sync.Mutex
+	views map[string]map[string]View // by user ID, then view ID
+}
+
+func (s *memoryViewStore) List(ctx context.Context) ([]View, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	views := []View{}
+	for _, view := range s.views[userID] {
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+func (s *memoryViewStore) Get(ctx context.Context, id string) (View, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return View{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	view, ok := s.views[userID][id]
+	if !ok {
+		return View{}, ErrViewNotFound
+	}
+	return view, nil
+}
+
+func (s *memoryViewStore) Put(ctx context.Context, view View) error {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.views[userID] == nil {
+		s.views[userID] = map[string]View{}
+	}
+	s.views[userID][view.ID] = view
+	return nil
+}
+
+func (s *memoryViewStore) Delete(ctx context.Context, id string) error {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.views[userID][id]; !ok {
+		return ErrViewNotFound
+	}
+	delete(s.views[userID], id)
+	return nil
+}
+
+// NewFileViewStore makes a ViewStore keeping views as JSON files in dir,
+// in a directory per user other than the one with the empty ID. userIDer
+// identifies the user of a request.
+func NewFileViewStore(userIDer func(context.Context) (string, error), dir string) (ViewStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileViewStore{userIDer: userIDer, dir: dir}, nil
+}
+
+type fileViewStore struct {
+	userIDer func(context.Context) (string, error)
+	dir      string
+}
+
+func (s *fileViewStore) userDir(ctx context.Context) (string, error) {
+	userID, err := s.userIDer(ctx)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return s.dir, nil
+	}
+	return filepath.Join(s.dir, "user-"+url.PathEscape(userID)), nil
+}
+
+func (s *fileViewStore) path(ctx context.Context, id string) (string, error) {
+	dir, err := s.userDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, url.PathEscape(id)+".json"), nil
+}
+
+func (s *fileViewStore) List(ctx context.Context) ([]View, error) {
+	dir, err := s.userDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []View{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	views := []View{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		view, err := readView(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+func (s *fileViewStore) Get(ctx context.Context, id string) (View, error) {
+	path, err := s.path(ctx, id)
+	if err != nil {
+		return View{}, err
+	}
+	view, err := readView(path)
+	if os.IsNotExist(err) {
+		return View{}, ErrViewNotFound
+	}
+	return view, err
+}
+
+func readView(path string) (View, error) {
+	var view View
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return view, err
+	}
+	err = json.Unmarshal(buf, &view)
+	return view, err
+}
+
+func (s *fileViewStore) Put(ctx context.Context, view View) error {
+	path, err := s.path(ctx, view.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so views are never read half written
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *fileViewStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrViewNotFound
+	}
+	return err
+}
+
+// RegisterViewRoutes registers the routes for saving and sharing views
+// with a http mux. /views/{id} redirects to the UI, in the view.
+func RegisterViewRoutes(router *mux.Router, views ViewStore) {
+	router.Methods("GET").Path("/api/views").
+		HandlerFunc(requestContextDecorator(handleListViews(views)))
+	router.Methods("POST").Path("/api/views").
+		HandlerFunc(requestContextDecorator(handlePutView(views, true)))
+	router.Methods("GET").Path("/api/views/{id}").
+		HandlerFunc(requestContextDecorator(handleGetView(views)))
+	router.Methods("PUT").Path("/api/views/{id}").
+		HandlerFunc(requestContextDecorator(handlePutView(views, false)))
+	router.Methods("DELETE").Path("/api/views/{id}").
+		HandlerFunc(requestContextDecorator(handleDeleteView(views)))
+	router.Methods("GET").Path("/views/{id}").
+		HandlerFunc(requestContextDecorator(handleOpenView(views)))
+}
+
+// served returns the view, as served by the API.
+func served(view View) View {
+	view.URL = "/views/" + url.PathEscape(view.ID)
+	return view
+}
+
+func respondWithViewError(w http.ResponseWriter, err error) {
+	if err == ErrViewNotFound {
+		respondWith(w, http.StatusNotFound, err)
+		return
+	}
+	respondWith(w, http.StatusInternalServerError, err)
+}
+
+func handleListViews(views ViewStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		list, err := views.List(ctx)
+		if err != nil {
+			respondWithViewError(w, err)
+			return
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		for i := range list {
+			list[i] = served(list[i])
+		}
+		respondWith(w, http.StatusOK, list)
+	}
+}
+
+func handleGetView(views ViewStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		view, err := views.Get(ctx, mux.Vars(r)["id"])
+		if err != nil {
+			respondWithViewError(w, err)
+			return
+		}
+		respondWith(w, http.StatusOK, served(view))
+	}
+}
+
+// handlePutView creates views, given create, or else replaces them.
+func handlePutView(views ViewStore, create bool) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var view View
+		if err := json.NewDecoder(r.Body).Decode(&view); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		if view.Name == "" || view.TopologyID == "" {
+			respondWith(w, http.StatusBadRequest, fmt.Errorf("views need a name and a topologyId"))
+			return
+		}
+
+		now := mtime.Now()
+		status := http.StatusOK
+		if create {
+			view.ID = strconv.FormatInt(rand.Int63(), 16)
+			view.Created = now
+			status = http.StatusCreated
+		} else {
+			old, err := views.Get(ctx, mux.Vars(r)["id"])
+			if err != nil {
+				respondWithViewError(w, err)
+				return
+			}
+			view.ID, view.Created = old.ID, old.Created
+		}
+		view.Updated, view.URL = now, ""
+		if err := views.Put(ctx, view); err != nil {
+			respondWithViewError(w, err)
+			return
+		}
+		respondWith(w, status, served(view))
+	}
+}
+
+func handleDeleteView(views ViewStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := views.Delete(ctx, mux.Vars(r)["id"]); err != nil {
+			respondWithViewError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleOpenView(views ViewStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		view, err := views.Get(ctx, mux.Vars(r)["id"])
+		if err == ErrViewNotFound {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			respondWithViewError(w, err)
+			return
+		}
+		http.Redirect(w, r, view.StateURL(), http.StatusFound)
+	}
+}
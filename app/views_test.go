@@ -0,0 +1,102 @@
+package app_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+)
+
+func noUserID(context.Context) (string, error) { return "", nil }
+
+func TestViews(t *testing.T) {
+	dir, err := ioutil.TempDir("", "views")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	fileStore, err := app.NewFileViewStore(noUserID, dir)
+	ok(t, err)
+
+	for name, store := range map[string]app.ViewStore{
+		"memory": app.NewMemoryViewStore(noUserID),
+		"file":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) { testViews(t, store) })
+	}
+}
+
+func testViews(t *testing.T, store app.ViewStore) {
+	router := mux.NewRouter()
+	app.RegisterViewRoutes(router, store)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	decode := func(body []byte, v interface{}) {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("JSON parse error: %s: %s", err, body)
+		}
+	}
+
+	res, _ := checkRequest(t, ts, "POST", "/api/views", []byte(`{"name": "no topology"}`))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+
+	res, body := checkRequest(t, ts, "POST", "/api/views", []byte(`{
+		"name": "web",
+		"topologyId": "containers",
+		"topologyOptions": {"system": ["application"]},
+		"searchQuery": "cpu > 50"
+	}`))
+	equals(t, http.StatusCreated, res.StatusCode)
+	var created app.View
+	decode(body, &created)
+	equals(t, "web", created.Name)
+	equals(t, "/views/"+created.ID, created.URL)
+
+	res, body = checkRequest(t, ts, "PUT", "/api/views/"+created.ID, []byte(`{"name": "web servers", "topologyId": "containers"}`))
+	equals(t, http.StatusOK, res.StatusCode)
+	var updated app.View
+	decode(body, &updated)
+	equals(t, created.ID, updated.ID)
+	equals(t, true, updated.Created.Equal(created.Created))
+
+	res, _ = checkRequest(t, ts, "PUT", "/api/views/foo", []byte(`{"name": "foo", "topologyId": "hosts"}`))
+	equals(t, http.StatusNotFound, res.StatusCode)
+
+	var views []app.View
+	decode(getRawJSON(t, ts, "/api/views"), &views)
+	equals(t, 1, len(views))
+	equals(t, "web servers", views[0].Name)
+
+	var view app.View
+	decode(getRawJSON(t, ts, "/api/views/"+created.ID), &view)
+	equals(t, "web servers", view.Name)
+
+	// Views are shared by redirecting to the state of the UI
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(ts.URL + "/views/" + created.ID)
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusFound, res.StatusCode)
+	equals(t, `/#!/state/{"topologyId":"containers"}`, res.Header.Get("Location"))
+
+	res, _ = checkRequest(t, ts, "DELETE", "/api/views/"+created.ID, nil)
+	equals(t, http.StatusNoContent, res.StatusCode)
+	is404(t, ts, "/api/views/"+created.ID)
+	res, _ = checkRequest(t, ts, "DELETE", "/api/views/"+created.ID, nil)
+	equals(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestViewStateURL(t *testing.T) {
+	view := app.View{
+		TopologyID:      "pods",
+		TopologyOptions: map[string][]string{"namespace": {"kube/system"}},
+		SearchQuery:     "50%",
+	}
+	equals(t, `/#!/state/{"topologyId":"pods","topologyOptions":{"pods":{"namespace":["kube<SLASH>system"]}},"searchQuery":"50<PERCENT>"}`, view.StateURL())
+}
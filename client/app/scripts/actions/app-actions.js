@@ -535,6 +535,22 @@ export function receiveControlError(nodeId, err) {
   };
 }
 
+export function receiveControlJob(nodeId, job) {
+  return {
+    type: ActionTypes.RECEIVE_CONTROL_JOB,
+    nodeId,
+    job
+  };
+}
+
+export function receiveControlStatus(nodeId, status) {
+  return {
+    type: ActionTypes.RECEIVE_CONTROL_STATUS,
+    nodeId,
+    status
+  };
+}
+
 export function receiveControlSuccess(nodeId) {
   return {
     type: ActionTypes.DO_CONTROL_SUCCESS,
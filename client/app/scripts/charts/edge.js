@@ -5,6 +5,13 @@ import classNames from 'classnames';
 import { enterEdge, leaveEdge } from '../actions/app-actions';
 import { encodeIdAttribute, decodeIdAttribute } from '../utils/dom-utils';
 
+// Request rate and latency of an edge, from tracing
+function formatEdgeStats(stats) {
+  const rate = stats.get('requestRate').toFixed(1);
+  const p99 = Math.round(stats.get('latencyP99'));
+  return `${rate} req/s, p99 ${p99} ms`;
+}
+
 class Edge extends React.Component {
   constructor(props, context) {
     super(props, context);
@@ -14,10 +21,10 @@ class Edge extends React.Component {
 
   render() {
     const {
-      id, path, highlighted, focused, thickness, source, target
+      id, path, highlighted, focused, degraded, stats, thickness, source, target
     } = this.props;
     const shouldRenderMarker = (focused || highlighted) && (source !== target);
-    const className = classNames('edge', { highlighted });
+    const className = classNames('edge', { highlighted, degraded });
 
     return (
       <g
@@ -26,6 +33,7 @@ class Edge extends React.Component {
         onMouseEnter={this.handleMouseEnter}
         onMouseLeave={this.handleMouseLeave}
       >
+        {stats && <title>{formatEdgeStats(stats)}</title>}
         <path className="shadow" d={path} style={{ strokeWidth: 10 * thickness }} />
         <path
           className="link"
@@ -105,7 +105,7 @@ class Node extends React.Component {
   render() {
     const {
       focused, highlighted, networks, pseudo, rank, label, transform,
-      exportingGraph, showingNetworks, stack, id, metric
+      exportingGraph, showingNetworks, stack, id, metric, alerts, annotations
     } = this.props;
     const { hovered } = this.state;
 
@@ -113,7 +113,11 @@ class Node extends React.Component {
     const truncate = !focused && !hovered;
     const labelOffsetY = (showingNetworks && networks) ? 40 : 28;
 
-    const nodeClassName = classnames('node', { highlighted, hovered, pseudo });
+    const alerting = alerts && alerts.size > 0;
+    const annotated = annotations && annotations.size > 0;
+    const nodeClassName = classnames('node', {
+      highlighted, hovered, pseudo, alerting, annotated
+    });
     const labelClassName = classnames('node-label', { truncate });
     const labelMinorClassName = classnames('node-label-minor', { truncate });
 
@@ -162,6 +162,8 @@ class NodesChartElements extends React.Component {
         label={node.get('label')}
         labelMinor={node.get('labelMinor')}
         pseudo={node.get('pseudo')}
+        alerts={node.get('alerts')}
+        annotations={node.get('annotations')}
         rank={node.get('rank')}
         dx={node.get('x')}
         dy={node.get('y')}
@@ -183,6 +185,8 @@ class NodesChartElements extends React.Component {
         waypoints={edge.get('points')}
         highlighted={edge.get('highlighted')}
         focused={edge.get('focused')}
+        degraded={edge.get('degraded')}
+        stats={edge.get('stats')}
         scale={edge.get('scale')}
         isAnimated={isAnimated}
       />
@@ -3,6 +3,7 @@ import { connect } from 'react-redux';
 
 import Plugins from './plugins';
 import { trackAnalyticsEvent } from '../utils/tracking-utils';
+import { getIdentity } from '../utils/web-api-utils';
 import {
   clickDownloadGraph,
   clickForceRelayout,
@@ -18,6 +19,12 @@ class Footer extends React.Component {
 
     this.handleContrastClick = this.handleContrastClick.bind(this);
     this.handleRelayoutClick = this.handleRelayoutClick.bind(this);
+    this.state = { identity: null };
+  }
+
+  componentDidMount() {
+    // Not found unless users authenticate
+    getIdentity().then(identity => this.setState({ identity }), () => {});
   }
 
   handleContrastClick(ev) {
@@ -37,6 +44,7 @@ class Footer extends React.Component {
     const {
       hostname, version, versionUpdate, contrastMode
     } = this.props;
+    const { identity } = this.state;
 
     const otherContrastModeTitle = contrastMode
       ? 'Switch to normal contrast' : 'Switch to high contrast';
@@ -63,6 +71,10 @@ class Footer extends React.Component {
           {version || '...'}
           <span className="footer-label">on</span>
           {hostname}
+          {identity && <span className="footer-label">as</span>}
+          {identity && <span title={identity.role}>{identity.user}</span>}
+          {identity && identity.logoutURL &&
+            <a className="footer-label" href={identity.logoutURL}>Log out</a>}
         </div>
 
         <div className="footer-plugins">
@@ -164,7 +164,9 @@ class NodeDetails extends React.Component {
     } = this.props;
     const showControls = details.controls && details.controls.length > 0;
     const nodeColor = getNodeColorDark(details.rank, details.label, details.pseudo);
-    const {error, pending} = nodeControlStatus ? nodeControlStatus.toJS() : {};
+    const {
+      attempts, error, jobMessage, jobPercent, pending, retryError
+    } = nodeControlStatus ? nodeControlStatus.toJS() : {};
     const tools = this.renderTools();
     const styles = {
       controls: {
@@ -197,6 +199,10 @@ class NodeDetails extends React.Component {
               nodeId={this.props.nodeId}
               controls={details.controls}
               pending={pending}
+              attempts={attempts}
+              jobMessage={jobMessage}
+              jobPercent={jobPercent}
+              retryError={retryError}
               error={error} />
           </div>
         }
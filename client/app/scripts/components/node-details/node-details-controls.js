@@ -4,7 +4,7 @@ import { sortBy } from 'lodash';
 import NodeDetailsControlButton from './node-details-control-button';
 
 export default function NodeDetailsControls({
-  controls, error, nodeId, pending
+  attempts, controls, error, jobMessage, jobPercent, nodeId, pending, retryError
 }) {
   let spinnerClassName = 'fa fa-circle-o-notch fa-spin';
   if (pending) {
@@ -13,8 +13,25 @@ export default function NodeDetailsControls({
     spinnerClassName += ' node-details-controls-spinner hide';
   }
 
+  // Controls are retried while the probe reconnects, and jobs tell how far
+  // along they are
+  let statusMessage = null;
+  if (pending && jobPercent !== undefined) {
+    statusMessage = `${jobMessage || 'Running'} (${jobPercent || 0}%)`;
+  } else if (pending && attempts > 0) {
+    statusMessage = `Delivering, attempt ${attempts + 1}`;
+    if (retryError) {
+      statusMessage += `: ${retryError}`;
+    }
+  }
+
   return (
     <div className="node-details-controls">
+      {statusMessage &&
+        <div className="node-details-controls-error" title={statusMessage}>
+          <span className="node-details-controls-error-messages">{statusMessage}</span>
+        </div>
+      }
       {error &&
         <div className="node-details-controls-error" title={error}>
           <span className="node-details-controls-error-icon fa fa-warning" />
@@ -6,11 +6,19 @@ import Tooltip from './tooltip';
 
 
 const Plugin = ({
-  id, label, description, status
+  id, label, description, status, api_version: apiVersion
 }) => {
-  const error = status !== 'ok';
-  const className = classNames({ error });
-  const tip = (<span>Description: {description}<br />Status: {status}</span>);
+  // Plugins which report their own health keep working while unhealthy
+  const unhealthy = status && status.startsWith('unhealthy');
+  const error = status !== 'ok' && !unhealthy;
+  const className = classNames({ error, unhealthy });
+  const tip = (
+    <span>
+      Description: {description}<br />
+      {apiVersion && <span>API version: {apiVersion}<br /></span>}
+      Status: {status}
+    </span>
+  );
 
   // Inner span to hold styling so we don't effect the "before:content"
   return (
@@ -18,6 +26,7 @@ const Plugin = ({
       <Tooltip tip={tip}>
         <span className={className}>
           {error && <span className="plugins-plugin-icon fa fa-exclamation-circle" />}
+          {unhealthy && <span className="plugins-plugin-icon fa fa-exclamation-triangle" />}
           {label || id}
         </span>
       </Tooltip>
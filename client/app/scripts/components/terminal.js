@@ -9,7 +9,9 @@ import Term from 'xterm';
 import { clickCloseTerminal } from '../actions/app-actions';
 import { getNeutralColor } from '../utils/color-utils';
 import { setDocumentTitle } from '../utils/title-utils';
-import { getPipeStatus, doResizeTty, getWebsocketUrl, basePath } from '../utils/web-api-utils';
+import {
+  getPipeStatus, getPipeParticipants, sharePipe, doResizeTty, getWebsocketUrl, basePath
+} from '../utils/web-api-utils';
 
 const log = debug('scope:terminal');
 
@@ -21,6 +23,7 @@ const TIMES = '\u00D7';
 const MDASH = '\u2014';
 
 const reconnectTimerInterval = 2000;
+const participantsTimerInterval = 5000;
 
 
 function ab2str(buf) {
@@ -83,17 +86,22 @@ class Terminal extends React.Component {
 
     this.reconnectTimeout = null;
     this.resizeTimeout = null;
+    this.participantsTimeout = null;
 
     this.state = {
       connected: false,
       rows: DEFAULT_ROWS,
       cols: DEFAULT_COLS,
       characterWidth: 0,
-      characterHeight: 0
+      characterHeight: 0,
+      participants: []
     };
 
     this.handleCloseClick = this.handleCloseClick.bind(this);
     this.handlePopoutTerminal = this.handlePopoutTerminal.bind(this);
+    this.handleShareReadOnly = this.handleShare.bind(this, 'read-only');
+    this.handleShareReadWrite = this.handleShare.bind(this, 'read-write');
+    this.updateParticipants = this.updateParticipants.bind(this);
     this.saveInnerFlexRef = this.saveInnerFlexRef.bind(this);
     this.saveNodeRef = this.saveNodeRef.bind(this);
     this.handleResize = this.handleResize.bind(this);
@@ -182,6 +190,7 @@ class Terminal extends React.Component {
     });
 
     this.createWebsocket(this.term);
+    this.updateParticipants();
 
     const {characterWidth, characterHeight} = terminalCellSize(this.term.element);
 
@@ -203,6 +212,7 @@ class Terminal extends React.Component {
 
     clearTimeout(this.reconnectTimeout);
     clearTimeout(this.resizeTimeout);
+    clearTimeout(this.participantsTimeout);
 
     window.removeEventListener('resize', this.handleResizeDebounced);
 
@@ -248,6 +258,35 @@ class Terminal extends React.Component {
     openNewWindow(`${basePath(window.location.pathname)}/terminal.html#!/state/${paramString}`, bcr, minWidth);
   }
 
+  handleShare(mode, ev) {
+    ev.preventDefault();
+    sharePipe(this.getPipeId(), mode).then((share) => {
+      // Those joining get a terminal of their own, with the token for the pipe
+      const params = {
+        pipe: {id: share.token, raw: this.props.pipe.get('raw')},
+        title: this.props.title,
+        titleBarColor: this.props.titleBarColor,
+        statusBarColor: this.props.statusBarColor
+      };
+      const url = `${window.location.origin}${basePath(window.location.pathname)}`
+        + `/terminal.html#!/state/${encodeURIComponent(JSON.stringify(params))}`;
+      window.prompt(`Share this link to let others join ${mode}`, url);
+    });
+  }
+
+  // Polls who else is connected to the terminal
+  updateParticipants() {
+    getPipeParticipants(this.getPipeId()).then((participants) => {
+      if (this.isComponentMounted) {
+        this.setState({participants});
+      }
+    }).always(() => {
+      if (this.isComponentMounted) {
+        this.participantsTimeout = setTimeout(this.updateParticipants, participantsTimerInterval);
+      }
+    });
+  }
+
   handleResize() {
     // scrollbar === 16px
     const width = this.innerFlex.clientWidth - (2 * 8) - 16;
@@ -274,8 +313,25 @@ class Terminal extends React.Component {
 
   getTitle() {
     const nodeName = this.props.title || 'n/a';
+    const { participants } = this.state;
+    const others = participants.length > 1 ? ` (${participants.length} connected)` : '';
     return `Terminal ${nodeName} ${MDASH}
-      ${this.state.cols}${TIMES}${this.state.rows}`;
+      ${this.state.cols}${TIMES}${this.state.rows}${others}`;
+  }
+
+  getParticipantsIndicator() {
+    const { participants } = this.state;
+    if (participants.length < 2) {
+      return null;
+    }
+    const title = participants
+      .map(p => `${p.name || 'anonymous'} (${p.owner ? 'owner' : p.mode})`)
+      .join('\n');
+    return (
+      <span title={title} className="terminal-header-tools-item">
+        <span className="fa fa-users" /> {participants.length}
+      </span>
+    );
   }
 
   getTerminalHeader() {
@@ -286,6 +342,19 @@ class Terminal extends React.Component {
     return (
       <div className="terminal-header" style={style}>
         <div className="terminal-header-tools">
+          {this.getParticipantsIndicator()}
+          <span
+            title="Let others watch this terminal"
+            className="terminal-header-tools-item"
+            onClick={this.handleShareReadOnly}>
+          Share
+          </span>
+          <span
+            title="Let others type into this terminal too"
+            className="terminal-header-tools-item"
+            onClick={this.handleShareReadWrite}>
+          Pair
+          </span>
           <span
             title="Open in new browser window"
             className="terminal-header-tools-item"
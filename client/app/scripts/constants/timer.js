@@ -1,6 +1,7 @@
 /* Intervals in ms */
 export const API_REFRESH_INTERVAL = 30000;
 export const TOPOLOGY_REFRESH_INTERVAL = 5000;
+export const CONTROL_STATUS_INTERVAL = 1000;
 
 export const TOPOLOGY_LOADER_DELAY = 100;
 
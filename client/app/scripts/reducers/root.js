@@ -540,6 +540,28 @@ export function rootReducer(state = initialState, action) {
       return state;
     }
 
+    case ActionTypes.RECEIVE_CONTROL_JOB: {
+      // Only while the job is running
+      if (state.getIn(['controlStatus', action.nodeId, 'pending'])) {
+        state = state.mergeIn(['controlStatus', action.nodeId], makeMap({
+          jobMessage: action.job.message,
+          jobPercent: action.job.percent
+        }));
+      }
+      return state;
+    }
+
+    case ActionTypes.RECEIVE_CONTROL_STATUS: {
+      // Only while the control is being delivered
+      if (state.getIn(['controlStatus', action.nodeId, 'pending'])) {
+        state = state.mergeIn(['controlStatus', action.nodeId], makeMap({
+          attempts: action.status.attempts,
+          retryError: action.status.error
+        }));
+      }
+      return state;
+    }
+
     case ActionTypes.RECEIVE_ERROR: {
       if (state.get('errorUrl') !== null) {
         state = state.set('errorUrl', action.errorUrl);
@@ -10,22 +10,31 @@ describe('LayouterUtils', () => {
   describe('initEdgesFromNodes', () => {
     it('should return map of edges', () => {
       const input = fromJS({
-        a: { adjacency: ['b', 'c'] },
+        a: {
+          adjacency: ['b', 'c'],
+          degradedAdjacency: ['c'],
+          edgeStats: { b: { requestRate: 2, latencyP99: 30 } }
+        },
         b: { adjacency: ['a', 'b'] },
         c: {}
       });
       expect(initEdgesFromNodes(input).toJS()).toEqual({
         [edge('a', 'b')]: {
-          id: edge('a', 'b'), source: 'a', target: 'b', value: 1
+          id: edge('a', 'b'),
+          source: 'a',
+          target: 'b',
+          value: 1,
+          degraded: false,
+          stats: { requestRate: 2, latencyP99: 30 }
         },
         [edge('a', 'c')]: {
-          id: edge('a', 'c'), source: 'a', target: 'c', value: 1
+          id: edge('a', 'c'), source: 'a', target: 'c', value: 1, degraded: true
         },
         [edge('b', 'a')]: {
-          id: edge('b', 'a'), source: 'b', target: 'a', value: 1
+          id: edge('b', 'a'), source: 'b', target: 'a', value: 1, degraded: false
         },
         [edge('b', 'b')]: {
-          id: edge('b', 'b'), source: 'b', target: 'b', value: 1
+          id: edge('b', 'b'), source: 'b', target: 'b', value: 1, degraded: false
         },
       });
     });
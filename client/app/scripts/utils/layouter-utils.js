@@ -1,4 +1,4 @@
-import { Map as makeMap } from 'immutable';
+import { Map as makeMap, List as makeList } from 'immutable';
 
 import { EDGE_ID_SEPARATOR } from '../constants/naming';
 
@@ -18,6 +18,8 @@ export function initEdgesFromNodes(nodes) {
   let edges = makeMap();
 
   nodes.forEach((node, nodeId) => {
+    const degradedAdjacency = node.get('degradedAdjacency') || makeList();
+    const edgeStats = node.get('edgeStats') || makeMap();
     (node.get('adjacency') || []).forEach((adjacentId) => {
       const source = nodeId;
       const target = adjacentId;
@@ -26,9 +28,12 @@ export function initEdgesFromNodes(nodes) {
         // The direction source->target is important since dagre takes
         // directionality into account when calculating the layout.
         const edgeId = constructEdgeId(source, target);
-        const edge = makeMap({
-          id: edgeId, value: 1, source, target
+        let edge = makeMap({
+          id: edgeId, value: 1, source, target, degraded: degradedAdjacency.includes(target)
         });
+        if (edgeStats.has(target)) {
+          edge = edge.set('stats', edgeStats.get(target));
+        }
         edges = edges.set(edgeId, edge);
       }
     });
@@ -12,6 +12,7 @@ import { shownNodesSelector, shownResourceTopologyIdsSelector } from '../selecto
 const TOPOLOGY_DISPLAY_PRIORITY = [
   'ecs-services',
   'ecs-tasks',
+  'nomad-jobs',
   'kube-controllers',
   'services',
   'replica-sets',
@@ -6,8 +6,8 @@ import { Map as makeMap, List } from 'immutable';
 import {
   blurSearch, clearControlError, closeWebsocket, openWebsocket, receiveError,
   receiveApiDetails, receiveNodesDelta, receiveNodeDetails, receiveControlError,
-  receiveControlNodeRemoved, receiveControlPipe, receiveControlPipeStatus,
-  receiveControlSuccess, receiveTopologies, receiveNotFound,
+  receiveControlJob, receiveControlNodeRemoved, receiveControlPipe, receiveControlPipeStatus,
+  receiveControlStatus, receiveControlSuccess, receiveTopologies, receiveNotFound,
   receiveNodesForTopology, receiveNodes,
 } from '../actions/app-actions';
 
@@ -16,7 +16,9 @@ import { layersTopologyIdsSelector } from '../selectors/resource-view/layout';
 import { activeTopologyOptionsSelector } from '../selectors/topology';
 import { isPausedSelector } from '../selectors/time-travel';
 
-import { API_REFRESH_INTERVAL, TOPOLOGY_REFRESH_INTERVAL } from '../constants/timer';
+import {
+  API_REFRESH_INTERVAL, CONTROL_STATUS_INTERVAL, TOPOLOGY_REFRESH_INTERVAL
+} from '../constants/timer';
 
 const log = debug('scope:web-api-utils');
 
@@ -384,14 +386,72 @@ export function getApiDetails(dispatch) {
   });
 }
 
+function getControlStatus(nodeId, controlId, dispatch) {
+  const url = `${getApiPath()}/api/control/status/${encodeURIComponent(controlId)}`;
+  doRequest({
+    url,
+    success: (status) => {
+      dispatch(receiveControlStatus(nodeId, status));
+    },
+    error: (req) => {
+      log(`Error in control status request: ${req.responseText}`);
+    }
+  });
+}
+
+function failControl(nodeId, error, dispatch) {
+  dispatch(receiveControlError(nodeId, error));
+  controlErrorTimer = setTimeout(() => {
+    dispatch(clearControlError(nodeId));
+  }, 10000);
+}
+
+// followControlJob tells how far along the job a control started is,
+// until it's done.
+function followControlJob(nodeId, jobId, dispatch) {
+  const url = `${getApiPath()}/api/control/jobs/${encodeURIComponent(jobId)}`;
+  doRequest({
+    url,
+    success: (job) => {
+      if (!job.done) {
+        dispatch(receiveControlJob(nodeId, job));
+        setTimeout(() => {
+          followControlJob(nodeId, jobId, dispatch);
+        }, CONTROL_STATUS_INTERVAL);
+      } else if (job.result && job.result.error) {
+        failControl(nodeId, job.result.error, dispatch);
+      } else {
+        dispatch(receiveControlSuccess(nodeId));
+      }
+    },
+    error: (err) => {
+      failControl(nodeId, err.response, dispatch);
+    }
+  });
+}
+
 export function doControlRequest(nodeId, control, dispatch) {
   clearTimeout(controlErrorTimer);
   const url = `${getApiPath()}/api/control/${encodeURIComponent(control.probeId)}/`
     + `${encodeURIComponent(control.nodeId)}/${control.id}`;
+  // The app retries the control while its probe reconnects, telling how
+  // that goes by the ID of the control
+  const controlId = Math.random().toString(16).substr(2);
+  const statusTimer = setInterval(() => {
+    getControlStatus(nodeId, controlId, dispatch);
+  }, CONTROL_STATUS_INTERVAL);
   doRequest({
     method: 'POST',
     url,
+    headers: { 'X-Scope-Control-ID': controlId },
     success: (res) => {
+      clearInterval(statusTimer);
+      if (res && res.job) {
+        // Jobs carry on after the control, telling how far along they are
+        dispatch(receiveControlJob(nodeId, res.value));
+        followControlJob(nodeId, res.value.id, dispatch);
+        return;
+      }
       dispatch(receiveControlSuccess(nodeId));
       if (res) {
         if (res.pipe) {
@@ -412,10 +472,8 @@ export function doControlRequest(nodeId, control, dispatch) {
       }
     },
     error: (err) => {
-      dispatch(receiveControlError(nodeId, err.response));
-      controlErrorTimer = setTimeout(() => {
-        dispatch(clearControlError(nodeId));
-      }, 10000);
+      clearInterval(statusTimer);
+      failControl(nodeId, err.response, dispatch);
     }
   });
 }
@@ -452,6 +510,40 @@ export function deletePipe(pipeId, dispatch) {
 }
 
 
+// Who the user is, when they need to authenticate with the app
+export function getIdentity() {
+  return doRequest({
+    method: 'GET',
+    url: `${getApiPath()}/api/whoami`,
+  });
+}
+
+
+export function getPipeParticipants(pipeId) {
+  const url = `${getApiPath()}/api/pipe/${encodeURIComponent(pipeId)}/participants`;
+  return doRequest({
+    method: 'GET',
+    url,
+  })
+    .fail((err) => {
+      log(`Error getting pipe participants: ${err}`);
+    });
+}
+
+
+export function sharePipe(pipeId, mode) {
+  const url = `${getApiPath()}/api/pipe/${encodeURIComponent(pipeId)}/shares`;
+  return doRequest({
+    method: 'POST',
+    url,
+    data: JSON.stringify({mode}),
+  })
+    .fail((err) => {
+      log(`Error sharing pipe: ${err}`);
+    });
+}
+
+
 export function getPipeStatus(pipeId, dispatch) {
   const url = `${getApiPath()}/api/pipe/${encodeURIComponent(pipeId)}/check`;
   doRequest({
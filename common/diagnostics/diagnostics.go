@@ -0,0 +1,124 @@
+// Package diagnostics serves the runtime diagnostics of apps and probes:
+// pprof profiles, expvar variables, and goroutine and heap dumps, on an
+// admin listener only those with its token may use, to profile them in
+// production.
+package diagnostics
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The dumps which can be triggered, by name.
+var dumps = map[string]func(io.Writer) error{
+	"goroutine": func(w io.Writer) error {
+		return runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+	},
+	"heap": func(w io.Writer) error {
+		runtime.GC()
+		return runtimepprof.WriteHeapProfile(w)
+	},
+}
+
+// Handler returns the handler of the diagnostics, for requests with the
+// token, as a bearer token, or as the password of basic auth, which go
+// tool pprof sends from the URL. Dumps are written to files in dumpDir,
+// or sent back if it's empty.
+func Handler(token, dumpDir string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/dump/", func(w http.ResponseWriter, r *http.Request) {
+		handleDump(w, r, dumpDir)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="scope admin"`)
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe serves the diagnostics on addr.
+func ListenAndServe(addr, token, dumpDir string) error {
+	log.Infof("Serving diagnostics on %s", addr)
+	log.Infof("go tool pprof http://admin:<token>@%s/debug/pprof/{profile,heap,block}", addr)
+	return http.ListenAndServe(addr, Handler(token, dumpDir))
+}
+
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// handleDump triggers the dump named by the path, as in POST
+// /debug/dump/heap.
+func handleDump(w http.ResponseWriter, r *http.Request, dumpDir string) {
+	if r.Method != "POST" {
+		http.Error(w, "dumps are triggered with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	kind := strings.TrimPrefix(r.URL.Path, "/debug/dump/")
+	dump, ok := dumps[kind]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown dump %q: expected goroutine or heap", kind), http.StatusNotFound)
+		return
+	}
+
+	if dumpDir == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", kind+".dump"))
+		if err := dump(w); err != nil {
+			log.Errorf("Error dumping %s: %v", kind, err)
+		}
+		return
+	}
+
+	path := filepath.Join(dumpDir, fmt.Sprintf("%s-%d.dump", kind, time.Now().Unix()))
+	if err := writeDump(path, dump); err != nil {
+		log.Errorf("Error dumping %s: %v", kind, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Dumped %s to %s", kind, path)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"path": path})
+}
+
+func writeDump(path string, dump func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := dump(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,79 @@
+package diagnostics_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/scope/common/diagnostics"
+)
+
+func TestHandlerNeedsToken(t *testing.T) {
+	server := httptest.NewServer(diagnostics.Handler("secret", ""))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name   string
+		auth   func(*http.Request)
+		status int
+	}{
+		{"none", func(*http.Request) {}, http.StatusUnauthorized},
+		{"wrong", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", server.URL+"/debug/vars", nil)
+		tc.auth(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: want %d, have %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(diagnostics.Handler("secret", dir))
+	defer server.Close()
+
+	dump := func(kind string) *http.Response {
+		req, _ := http.NewRequest("POST", server.URL+"/debug/dump/"+kind, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := dump("goroutine")
+	defer resp.Body.Close()
+	var result struct{ Path string }
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(result.Path) != dir {
+		t.Errorf("want dump in %s, have %s", dir, result.Path)
+	}
+	if buf, err := ioutil.ReadFile(result.Path); err != nil || len(buf) == 0 {
+		t.Errorf("want goroutine dump, have %q: %v", buf, err)
+	}
+
+	unknown := dump("everything")
+	unknown.Body.Close()
+	if unknown.StatusCode != http.StatusNotFound {
+		t.Errorf("want unknown dumps not found, have %d", unknown.StatusCode)
+	}
+}
@@ -0,0 +1,164 @@
+package remoteread
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	metricNameLabel = "__name__"
+	// maxResponseLen bounds what is read of a response, compressed.
+	maxResponseLen = 32 * 1024 * 1024
+	// maxDecodedLen bounds what a response decompresses to.
+	maxDecodedLen = 64 * 1024 * 1024
+)
+
+// Client reads series from the remote read endpoint of a Prometheus, e.g.
+// http://prometheus:9090/api/v1/read
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient makes a new Client, giving up on requests after timeout.
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Read runs the queries, and returns their results, in the same order.
+func (c *Client) Read(ctx context.Context, queries ...*Query) ([]*QueryResult, error) {
+	body, err := proto.Marshal(&ReadRequest{Queries: queries})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(snappy.Encode(nil, body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+
+	resp, err := ctxhttp.Do(ctx, c.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("remote read: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	compressed, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseLen))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := snappy.DecodedLen(compressed); err != nil {
+		return nil, err
+	} else if n > maxDecodedLen {
+		return nil, fmt.Errorf("remote read: response decodes to %d bytes, more than %d", n, maxDecodedLen)
+	}
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+	var result ReadResponse
+	if err := proto.Unmarshal(buf, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Results) != len(queries) {
+		return nil, fmt.Errorf("remote read: %d results for %d queries", len(result.Results), len(queries))
+	}
+	return result.Results, nil
+}
+
+// ParseSelector parses a PromQL series selector, such as
+// container_memory_usage_bytes{name="foo",image=~"bar.*"}, into matchers.
+func ParseSelector(selector string) ([]*LabelMatcher, error) {
+	var matchers []*LabelMatcher
+	s := strings.TrimSpace(selector)
+	name := s
+	if i := strings.IndexByte(s, '{'); i >= 0 {
+		name, s = strings.TrimSpace(s[:i]), s[i+1:]
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("%q: missing closing brace", selector)
+		}
+		s = s[:len(s)-1]
+	} else {
+		s = ""
+	}
+	if name != "" {
+		matchers = append(matchers, &LabelMatcher{Type: MatchEqual, Name: metricNameLabel, Value: name})
+	}
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		i := strings.IndexAny(s, "=!")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q: expected a label matcher at %q", selector, s)
+		}
+		m := &LabelMatcher{Name: strings.TrimSpace(s[:i])}
+		s = s[i:]
+		for _, op := range []struct {
+			token string
+			typ   MatchType
+		}{{"=~", MatchRegexp}, {"!~", MatchNotRegexp}, {"!=", MatchNotEqual}, {"=", MatchEqual}} {
+			if strings.HasPrefix(s, op.token) {
+				m.Type, s = op.typ, strings.TrimSpace(s[len(op.token):])
+				break
+			}
+		}
+		value, err := quotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q: expected a quoted value at %q", selector, s)
+		}
+		if m.Value, err = strconv.Unquote(value); err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+		s = strings.TrimSpace(s[len(value):])
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if s != "" {
+			return nil, fmt.Errorf("%q: expected a comma at %q", selector, s)
+		}
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("%q: empty selector", selector)
+	}
+	return matchers, nil
+}
+
+// quotedPrefix returns the Go-quoted string s starts with, like
+// strconv.QuotedPrefix, which is too recent for us.
+func quotedPrefix(s string) (string, error) {
+	if s == "" || (s[0] != '"' && s[0] != '`') {
+		return "", strconv.ErrSyntax
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if s[0] == '"' {
+				i++
+			}
+		case s[0]:
+			if _, err := strconv.Unquote(s[:i+1]); err != nil {
+				return "", err
+			}
+			return s[:i+1], nil
+		}
+	}
+	return "", strconv.ErrSyntax
+}
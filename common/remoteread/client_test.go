@@ -0,0 +1,75 @@
+package remoteread
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestParseSelector(t *testing.T) {
+	have, err := ParseSelector(`container_memory_usage_bytes{pod_name=~"^foo-[^-]+$", namespace="default",name!="",image!~"a\"b"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*LabelMatcher{
+		{Type: MatchEqual, Name: metricNameLabel, Value: "container_memory_usage_bytes"},
+		{Type: MatchRegexp, Name: "pod_name", Value: "^foo-[^-]+$"},
+		{Type: MatchEqual, Name: "namespace", Value: "default"},
+		{Type: MatchNotEqual, Name: "name", Value: ""},
+		{Type: MatchNotRegexp, Name: "image", Value: `a"b`},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+
+	for _, selector := range []string{"", "{}", `foo{bar="baz"`, `foo{bar=baz}`, `foo{bar="baz" qux="quux"}`} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Errorf("Expected %q not to parse", selector)
+		}
+	}
+}
+
+func TestClientRead(t *testing.T) {
+	series := &TimeSeries{
+		Labels:  []*Label{{Name: "name", Value: "foo"}},
+		Samples: []*Sample{{Value: 1, Timestamp: 1000}, {Value: 2, Timestamp: 2000}},
+	}
+	var request ReadRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		buf, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proto.Unmarshal(buf, &request); err != nil {
+			t.Fatal(err)
+		}
+		buf, _ = proto.Marshal(&ReadResponse{Results: []*QueryResult{{Timeseries: []*TimeSeries{series}}}})
+		w.Write(snappy.Encode(nil, buf))
+	}))
+	defer ts.Close()
+
+	query := &Query{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers:         []*LabelMatcher{{Type: MatchRegexp, Name: "name", Value: "f.*"}},
+	}
+	have, err := NewClient(ts.URL, time.Second).Read(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*QueryResult{{Timeseries: []*TimeSeries{series}}}; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if want := (ReadRequest{Queries: []*Query{query}}); !reflect.DeepEqual(want, request) {
+		t.Errorf("Expected request %v, got %v", want, request)
+	}
+}
@@ -0,0 +1,97 @@
+package remoteread
+
+import proto "github.com/golang/protobuf/proto"
+
+// The messages of the Prometheus remote read API, from prompb/remote.proto
+// and prompb/types.proto, as protoc-gen-go would have them.
+
+// MatchType is the kind of match of a LabelMatcher.
+type MatchType int32
+
+// The kinds of match
+const (
+	MatchEqual     MatchType = 0
+	MatchNotEqual  MatchType = 1
+	MatchRegexp    MatchType = 2
+	MatchNotRegexp MatchType = 3
+)
+
+// ReadRequest asks for the series matching each of its queries.
+type ReadRequest struct {
+	Queries []*Query `protobuf:"bytes,1,rep,name=queries" json:"queries,omitempty"`
+}
+
+func (m *ReadRequest) Reset()         { *m = ReadRequest{} }
+func (m *ReadRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadRequest) ProtoMessage()    {}
+
+// ReadResponse has a result per query of the request, in the same order.
+type ReadResponse struct {
+	Results []*QueryResult `protobuf:"bytes,1,rep,name=results" json:"results,omitempty"`
+}
+
+func (m *ReadResponse) Reset()         { *m = ReadResponse{} }
+func (m *ReadResponse) String() string { return proto.CompactTextString(m) }
+func (*ReadResponse) ProtoMessage()    {}
+
+// Query selects the samples of the series matching all its matchers,
+// between its start and end.
+type Query struct {
+	StartTimestampMs int64           `protobuf:"varint,1,opt,name=start_timestamp_ms,json=startTimestampMs" json:"start_timestamp_ms,omitempty"`
+	EndTimestampMs   int64           `protobuf:"varint,2,opt,name=end_timestamp_ms,json=endTimestampMs" json:"end_timestamp_ms,omitempty"`
+	Matchers         []*LabelMatcher `protobuf:"bytes,3,rep,name=matchers" json:"matchers,omitempty"`
+}
+
+func (m *Query) Reset()         { *m = Query{} }
+func (m *Query) String() string { return proto.CompactTextString(m) }
+func (*Query) ProtoMessage()    {}
+
+// LabelMatcher matches the series with a label of the given value.
+type LabelMatcher struct {
+	Type  MatchType `protobuf:"varint,1,opt,name=type,enum=prometheus.LabelMatcher_Type" json:"type,omitempty"`
+	Name  string    `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Value string    `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *LabelMatcher) Reset()         { *m = LabelMatcher{} }
+func (m *LabelMatcher) String() string { return proto.CompactTextString(m) }
+func (*LabelMatcher) ProtoMessage()    {}
+
+// QueryResult is the series which matched a query.
+type QueryResult struct {
+	Timeseries []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries" json:"timeseries,omitempty"`
+}
+
+func (m *QueryResult) Reset()         { *m = QueryResult{} }
+func (m *QueryResult) String() string { return proto.CompactTextString(m) }
+func (*QueryResult) ProtoMessage()    {}
+
+// TimeSeries is the samples of a series, in order.
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples" json:"samples,omitempty"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+// Label is a label of a series.
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+// Sample is a value of a series, at a time in milliseconds.
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
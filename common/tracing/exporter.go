@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	exportInterval  = 5 * time.Second
+	exportBatchSize = 512
+	// exportQueueSize bounds the spans waiting to be exported, beyond which
+	// they are dropped rather than holding up the pipeline.
+	exportQueueSize = 4096
+	exportTimeout   = 10 * time.Second
+
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+	statusCodeError  = 2
+)
+
+// exporter exports spans in batches, over OTLP/HTTP as JSON.
+type exporter struct {
+	endpoint string
+	resource otlpResource
+	client   *http.Client
+
+	spans chan otlpSpan
+	quit  chan struct{}
+	done  sync.WaitGroup
+}
+
+func newExporter(endpoint string, resource map[string]string) *exporter {
+	e := &exporter{
+		endpoint: endpoint,
+		resource: otlpResource{Attributes: otlpAttributes(resource)},
+		client:   &http.Client{Timeout: exportTimeout},
+		spans:    make(chan otlpSpan, exportQueueSize),
+		quit:     make(chan struct{}),
+	}
+	e.done.Add(1)
+	go e.loop()
+	return e
+}
+
+// stop exports the spans left, and stops exporting.
+func (e *exporter) stop() {
+	close(e.quit)
+	e.done.Wait()
+}
+
+func (e *exporter) export(span otlpSpan) {
+	select {
+	case e.spans <- span:
+	default:
+		log.Debugf("Dropped span %s, as %d are waiting to be exported", span.Name, exportQueueSize)
+	}
+}
+
+func (e *exporter) loop() {
+	defer e.done.Done()
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	batch := []otlpSpan{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(batch); err != nil {
+			log.Warnf("Error exporting %d spans to %s: %v", len(batch), e.endpoint, err)
+		}
+		batch = []otlpSpan{}
+	}
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.quit:
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) post(spans []otlpSpan) error {
+	buf, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: e.resource,
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/weaveworks/scope"},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// The parts of the JSON encoding of the OpenTelemetry protocol we make. See
+// https://github.com/open-telemetry/opentelemetry-proto
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(attributes))
+	for key, value := range attributes {
+		result = append(result, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
@@ -0,0 +1,308 @@
+// Package tracing exports the opentracing spans of the report pipeline,
+// from probes generating and publishing reports to apps decoding, merging
+// and rendering them, as OpenTelemetry spans, over OTLP/HTTP as JSON. Spans
+// are only made once a Tracer is set as the opentracing global tracer;
+// until then tracing costs nothing.
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// TraceparentHeader carries the span a request is part of, across
+// processes, as W3C trace context has it.
+const TraceparentHeader = "traceparent"
+
+// Tracer is an opentracing.Tracer exporting the spans it makes.
+type Tracer struct {
+	exporter *exporter
+}
+
+// NewTracer makes a new Tracer, POSTing spans to endpoint, as in
+// http://otel-collector:4318/v1/traces, as those of the resource with the
+// attributes, such as service.name.
+func NewTracer(endpoint string, resource map[string]string) *Tracer {
+	return &Tracer{exporter: newExporter(endpoint, resource)}
+}
+
+// Close exports the spans left, and stops exporting.
+func (t *Tracer) Close() {
+	t.exporter.stop()
+}
+
+// SpanContext identifies a span, across processes. Baggage isn't carried.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid tells whether the SpanContext identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// ForeachBaggageItem implements opentracing.SpanContext.
+func (sc SpanContext) ForeachBaggageItem(func(k, v string) bool) {}
+
+// StartSpan implements opentracing.Tracer. The span is the child of the
+// first span it references, and is linked to the rest.
+func (t *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var options opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&options)
+	}
+	s := &span{
+		tracer: t,
+		name:   operationName,
+		start:  options.StartTime,
+		tags:   map[string]interface{}{},
+	}
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+	for k, v := range options.Tags {
+		s.tags[k] = v
+	}
+	for _, ref := range options.References {
+		sc, ok := ref.ReferencedContext.(SpanContext)
+		if !ok || !sc.IsValid() {
+			continue
+		}
+		if s.context.TraceID == [16]byte{} {
+			s.context.TraceID = sc.TraceID
+			s.parent = sc.SpanID
+		} else {
+			s.links = append(s.links, sc)
+		}
+	}
+	if s.context.TraceID == [16]byte{} {
+		rand.Read(s.context.TraceID[:])
+	}
+	rand.Read(s.context.SpanID[:])
+	return s
+}
+
+// Inject implements opentracing.Tracer, for the TextMap and HTTPHeaders
+// formats.
+func (t *Tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	sc, ok := sm.(SpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	if format != opentracing.TextMap && format != opentracing.HTTPHeaders {
+		return opentracing.ErrUnsupportedFormat
+	}
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	writer.Set(TraceparentHeader, fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:])))
+	return nil
+}
+
+// Extract implements opentracing.Tracer, for the TextMap and HTTPHeaders
+// formats.
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	if format != opentracing.TextMap && format != opentracing.HTTPHeaders {
+		return nil, opentracing.ErrUnsupportedFormat
+	}
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+	var traceparent string
+	reader.ForeachKey(func(key, val string) error {
+		if strings.ToLower(key) == TraceparentHeader {
+			traceparent = val
+		}
+		return nil
+	})
+	if traceparent == "" {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	if !sc.IsValid() {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	return sc, nil
+}
+
+// span is a stage of the pipeline being timed.
+type span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  [8]byte
+	links   []SpanContext
+	start   time.Time
+
+	mtx    sync.Mutex
+	name   string
+	tags   map[string]interface{}
+	events []otlpEvent
+}
+
+func (s *span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
+	end := opts.FinishTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	for _, record := range opts.LogRecords {
+		s.log(record.Timestamp, record.Fields)
+	}
+	for _, data := range opts.BulkLogData {
+		record := data.ToLogRecord()
+		s.log(record.Timestamp, record.Fields)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.tracer.exporter.export(s.otlpSpan(end))
+}
+
+func (s *span) Context() opentracing.SpanContext {
+	return s.context
+}
+
+func (s *span) SetOperationName(operationName string) opentracing.Span {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.name = operationName
+	return s
+}
+
+func (s *span) SetTag(key string, value interface{}) opentracing.Span {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.tags[key] = value
+	return s
+}
+
+func (s *span) LogFields(fields ...otlog.Field) {
+	s.log(time.Now(), fields)
+}
+
+func (s *span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := otlog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		fields = []otlog.Field{otlog.Error(err)}
+	}
+	s.log(time.Now(), fields)
+}
+
+func (s *span) SetBaggageItem(restrictedKey, value string) opentracing.Span { return s }
+
+func (s *span) BaggageItem(restrictedKey string) string { return "" }
+
+func (s *span) Tracer() opentracing.Tracer { return s.tracer }
+
+func (s *span) LogEvent(event string) {
+	s.Log(opentracing.LogData{Event: event})
+}
+
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.Log(opentracing.LogData{Event: event, Payload: payload})
+}
+
+func (s *span) Log(data opentracing.LogData) {
+	record := data.ToLogRecord()
+	s.log(record.Timestamp, record.Fields)
+}
+
+// log records the fields as an event of the span, named by the event field
+// if there is one.
+func (s *span) log(timestamp time.Time, fields []otlog.Field) {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	event := otlpEvent{TimeUnixNano: strconv.FormatInt(timestamp.UnixNano(), 10), Name: "log"}
+	attributes := map[string]string{}
+	for _, field := range fields {
+		if field.Key() == "event" {
+			event.Name = fmt.Sprint(field.Value())
+			continue
+		}
+		attributes[field.Key()] = fmt.Sprint(field.Value())
+	}
+	event.Attributes = otlpAttributes(attributes)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.events = append(s.events, event)
+}
+
+// otlpSpan returns the span, ended at end. s.mtx must be held.
+func (s *span) otlpSpan(end time.Time) otlpSpan {
+	attributes := map[string]string{}
+	for k, v := range s.tags {
+		attributes[k] = fmt.Sprint(v)
+	}
+	delete(attributes, string(ext.SpanKind))
+	delete(attributes, string(ext.Error))
+	result := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        otlpAttributes(attributes),
+		Events:            s.events,
+	}
+	switch s.tags[string(ext.SpanKind)] {
+	case ext.SpanKindRPCServerEnum, string(ext.SpanKindRPCServerEnum):
+		result.Kind = spanKindServer
+	case ext.SpanKindRPCClientEnum, string(ext.SpanKindRPCClientEnum):
+		result.Kind = spanKindClient
+	}
+	if s.parent != [8]byte{} {
+		result.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, link := range s.links {
+		result.Links = append(result.Links, otlpLink{
+			TraceID: hex.EncodeToString(link.TraceID[:]),
+			SpanID:  hex.EncodeToString(link.SpanID[:]),
+		})
+	}
+	if failed, _ := s.tags[string(ext.Error)].(bool); failed {
+		result.Status = &otlpStatus{Code: statusCodeError}
+		for _, event := range s.events {
+			for _, attribute := range event.Attributes {
+				if attribute.Key == "error" {
+					result.Status.Message = attribute.Value.StringValue
+				}
+			}
+		}
+	}
+	return result
+}
+
+// SetError marks the span as failed with err, if it isn't nil.
+func SetError(span opentracing.Span, err error) {
+	if err == nil {
+		return
+	}
+	ext.Error.Set(span, true)
+	span.LogFields(otlog.Error(err))
+}
@@ -0,0 +1,122 @@
+package tracing_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/tracing"
+)
+
+type span struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Links        []struct {
+		SpanID string `json:"spanId"`
+	} `json:"links"`
+	Status *struct {
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type collector struct {
+	mtx   sync.Mutex
+	spans map[string]span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var batch struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []span `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, rs := range batch.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans[s.Name] = s
+			}
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	c := &collector{spans: map[string]span{}}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	tracer := tracing.NewTracer(server.URL, map[string]string{"service.name": "test"})
+
+	// Reports made by a probe, published together, and added by an app
+	first := tracer.StartSpan("first")
+	first.Finish()
+	second := tracer.StartSpan("second")
+	second.Finish()
+	publish := tracer.StartSpan("publish", opentracing.FollowsFrom(first.Context()), opentracing.FollowsFrom(second.Context()))
+	header := http.Header{}
+	if err := tracer.Inject(publish.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {
+		t.Fatal(err)
+	}
+	publish.Finish()
+
+	parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opentracing.InitGlobalTracer(tracer)
+	defer opentracing.InitGlobalTracer(opentracing.NoopTracer{})
+	add, ctx := opentracing.StartSpanFromContext(context.Background(), "add", opentracing.ChildOf(parent))
+	merge, _ := opentracing.StartSpanFromContext(ctx, "merge")
+	tracing.SetError(merge, fmt.Errorf("broken"))
+	merge.Finish()
+	add.Finish()
+	tracer.Close()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.spans) != 5 {
+		t.Fatalf("expected 5 spans, got %v", c.spans)
+	}
+	root, child, grandchild := c.spans["publish"], c.spans["add"], c.spans["merge"]
+	if root.ParentSpanID != c.spans["first"].SpanID || child.ParentSpanID != root.SpanID || grandchild.ParentSpanID != child.SpanID {
+		t.Errorf("expected first > publish > add > merge, got %v", c.spans)
+	}
+	if len(root.Links) != 1 || root.Links[0].SpanID != c.spans["second"].SpanID {
+		t.Errorf("expected publish to be linked to the second report, got %v", root.Links)
+	}
+	if root.TraceID != c.spans["first"].TraceID || child.TraceID != root.TraceID || grandchild.TraceID != root.TraceID {
+		t.Errorf("expected one trace, got %v", c.spans)
+	}
+	if grandchild.Status == nil || grandchild.Status.Message != "broken" {
+		t.Errorf("expected merge to have failed, got %+v", grandchild.Status)
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	tracer := tracing.NewTracer("http://localhost:0", nil)
+	defer tracer.Close()
+	for _, value := range []string{"00-xyz-abc-01", "00-" + fmt.Sprintf("%064x", 1) + "-0000000000000001-01"} {
+		header := http.Header{}
+		header.Set(tracing.TraceparentHeader, value)
+		if _, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != opentracing.ErrSpanContextCorrupted {
+			t.Errorf("expected %q to be corrupted, got %v", value, err)
+		}
+	}
+	if _, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("expected no span, got %v", err)
+	}
+}
@@ -51,6 +51,7 @@ type Router struct {
 		Outbound bool
 		State    string
 		Info     string
+		Attrs    map[string]interface{}
 	}
 	Targets        []string
 	TrustedSubnets []string
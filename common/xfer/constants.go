@@ -12,6 +12,14 @@ const (
 
 	// ScopeProbeVersionHeader is the header we use to carry the probe's version.
 	ScopeProbeVersionHeader = "X-Scope-Probe-Version"
+
+	// ScopeReportReplayedHeader marks reports probes held on to while the
+	// app was unreachable, and publish late, with when they were made.
+	ScopeReportReplayedHeader = "X-Scope-Report-Replayed"
+
+	// ScopeControlIDHeader carries the ID of a control request, which the
+	// UI sets to retry it without doing it twice, and the app answers with.
+	ScopeControlIDHeader = "X-Scope-Control-ID"
 )
 
 // HistoricReportsCapability indicates whether reports older than the
@@ -26,6 +34,26 @@ type Details struct {
 	Plugins      PluginSpecs     `json:"plugins,omitempty"`
 	Capabilities map[string]bool `json:"capabilities,omitempty"`
 
+	// ReportStreamPort is the port of the app's report stream, if it has one.
+	ReportStreamPort int `json:"reportStreamPort,omitempty"`
+
+	// ReportContentTypes are the content types the app takes reports in.
+	// Apps which don't say take msgpack and JSON.
+	ReportContentTypes []string `json:"reportContentTypes,omitempty"`
+
+	// ReportEncodings are the encodings the app takes reports compressed
+	// with. Apps which don't say take gzip.
+	ReportEncodings []string `json:"reportEncodings,omitempty"`
+
+	// ReportVersion is the newest report schema version the app takes;
+	// it migrates older reports forward. Apps which don't say predate
+	// versioning.
+	ReportVersion int `json:"reportVersion,omitempty"`
+
+	// ReportFeatures are the report features the app takes, which probes
+	// leave out of reports for apps which don't list them.
+	ReportFeatures []string `json:"reportFeatures,omitempty"`
+
 	NewVersion *NewVersionInfo `json:"newVersion,omitempty"`
 }
 
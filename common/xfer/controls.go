@@ -13,6 +13,7 @@ var ErrInvalidMessage = fmt.Errorf("Invalid Message")
 // Request is the UI -> App -> Probe message type for control RPCs
 type Request struct {
 	AppID       string // filled in by the probe on receiving this request
+	ID          string // the same for retries, which probes do only once
 	NodeID      string
 	Control     string
 	ControlArgs map[string]string
@@ -27,9 +28,26 @@ type Response struct {
 	Pipe             string `json:"pipe,omitempty"`
 	RawTTY           bool   `json:"raw_tty,omitempty"`
 	ResizeTTYControl string `json:"resize_tty_control,omitempty"`
+	Job              bool   `json:"job,omitempty"` // Pipe streams JobUpdates, rather than a terminal
 
 	// Remove specific fields
 	RemovedNode string `json:"removedNode,omitempty"` // Set if node was removed
+
+	// RequestID acknowledges the request answered, by its ID.
+	RequestID string `json:"requestID,omitempty"`
+
+	// Signed responses carry the response, and the request it answers, in
+	// Signed, with its signature, instead of the fields above.
+	Signed    string `json:"signed,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// JobUpdate is what the pipes of jobs, long running controls, stream as
+// JSON: how far along the job is, and last, its result.
+type JobUpdate struct {
+	Message string    `json:"message,omitempty"`
+	Percent int       `json:"percent,omitempty"`
+	Result  *Response `json:"result,omitempty"` // set once the job is done
 }
 
 // Message is the unions of Request, Response and arbitrary Value.
@@ -0,0 +1,169 @@
+package xfer
+
+import (
+	"fmt"
+
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The report stream is a gRPC service, which apps may offer on a port of
+// their own, for probes to publish their reports on one long-lived stream,
+// rather than POSTing each of them. Every message carries a report the way
+// it would be POSTed to /api/report, in the content type (msgpack if none)
+// and compressed with the encoding (gzip if none) it names, which must be
+// ones the app takes. The first report of a stream is whole; further ones
+// may be deltas (report.Delta, as msgpack, likewise compressed), which the
+// app applies to the last report before them which isn't a shortcut.
+//
+// The messages themselves are msgpack, so there is no protobuf to generate.
+
+const (
+	reportStreamServiceName = "scope.ReportStream"
+
+	// MaxReportStreamMsgSize is the largest message the app accepts on a
+	// report stream.
+	MaxReportStreamMsgSize = 100 * 1024 * 1024
+
+	// RetryAfterTrailer is the trailer of streams the app ends as it is
+	// overloaded, with how many seconds probes should wait before sending
+	// reports again, as the Retry-After header of POSTed ones does.
+	RetryAfterTrailer = "retry-after"
+)
+
+// ReportMessage is a report streamed by a probe.
+type ReportMessage struct {
+	Report      []byte `json:"report"`
+	ContentType string `json:"contentType,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Delta       bool   `json:"delta,omitempty"`
+	// Signature of Report, as made by Signer.SignReport, if signed.
+	Signature string `json:"signature,omitempty"`
+	// Replayed is when the report was made, in Unix nanoseconds, if the
+	// probe replayed it, as ScopeReportReplayedHeader is for POSTed ones.
+	Replayed int64 `json:"replayed,omitempty"`
+	// Trace carries the span the report is published in, as opentracing
+	// TextMap carriers do.
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// ReportStreamSummary is sent by the app when the probe closes its stream.
+type ReportStreamSummary struct {
+	Reports int `json:"reports"`
+}
+
+// ReportStreamServer is the API apps serve.
+type ReportStreamServer interface {
+	Publish(ReportStreamPublishServer) error
+}
+
+// ReportStreamPublishServer is the app's end of a report stream.
+type ReportStreamPublishServer interface {
+	Recv() (*ReportMessage, error)
+	SendAndClose(*ReportStreamSummary) error
+	grpc.ServerStream
+}
+
+type reportStreamPublishServer struct {
+	grpc.ServerStream
+}
+
+func (s reportStreamPublishServer) Recv() (*ReportMessage, error) {
+	msg := &ReportMessage{}
+	if err := s.RecvMsg(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s reportStreamPublishServer) SendAndClose(summary *ReportStreamSummary) error {
+	return s.SendMsg(summary)
+}
+
+// ReportStreamPublishClient is the probe's end of a report stream.
+type ReportStreamPublishClient interface {
+	Send(*ReportMessage) error
+	CloseAndRecv() (*ReportStreamSummary, error)
+	grpc.ClientStream
+}
+
+type reportStreamPublishClient struct {
+	grpc.ClientStream
+}
+
+func (c reportStreamPublishClient) Send(msg *ReportMessage) error {
+	return c.SendMsg(msg)
+}
+
+func (c reportStreamPublishClient) CloseAndRecv() (*ReportStreamSummary, error) {
+	if err := c.CloseSend(); err != nil {
+		return nil, err
+	}
+	summary := &ReportStreamSummary{}
+	if err := c.RecvMsg(summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// NewReportStreamServer makes a gRPC server which speaks the encoding of the
+// report stream.
+func NewReportStreamServer(opts ...grpc.ServerOption) *grpc.Server {
+	return grpc.NewServer(append(opts,
+		grpc.CustomCodec(msgpackCodec{}),
+		grpc.MaxRecvMsgSize(MaxReportStreamMsgSize),
+	)...)
+}
+
+// RegisterReportStreamServer registers srv with s, which must come from
+// NewReportStreamServer.
+func RegisterReportStreamServer(s *grpc.Server, srv ReportStreamServer) {
+	s.RegisterService(&reportStreamServiceDesc, srv)
+}
+
+// DialReportStream connects to the report stream of an app.
+func DialReportStream(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr, append(opts, grpc.WithCodec(msgpackCodec{}))...)
+}
+
+// OpenReportStream opens a stream to publish reports on, over a connection
+// from DialReportStream.
+func OpenReportStream(ctx context.Context, conn *grpc.ClientConn) (ReportStreamPublishClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &reportStreamServiceDesc.Streams[0], conn, reportStreamMethod("Publish"))
+	if err != nil {
+		return nil, err
+	}
+	return reportStreamPublishClient{stream}, nil
+}
+
+var reportStreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: reportStreamServiceName,
+	HandlerType: (*ReportStreamServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Publish", Handler: publishHandler, ClientStreams: true},
+	},
+}
+
+func reportStreamMethod(name string) string {
+	return fmt.Sprintf("/%s/%s", reportStreamServiceName, name)
+}
+
+func publishHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReportStreamServer).Publish(reportStreamPublishServer{stream})
+}
+
+// msgpackCodec encodes messages the way reports are.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf []byte
+	err := codec.NewEncoderBytes(&buf, &codec.MsgpackHandle{}).Encode(v)
+	return buf, err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, &codec.MsgpackHandle{}).Decode(v)
+}
+
+func (msgpackCodec) String() string { return "msgpack" }
@@ -0,0 +1,264 @@
+package xfer
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ReportSignatureHeader carries the signature of a report POSTed by a
+// probe, as made by Signer.SignReport.
+const ReportSignatureHeader = "X-Scope-Report-Signature"
+
+// MaxReportSignatureAge is how long after signing a report apps still take
+// it, so that reports recorded off the network can't be replayed for long.
+const MaxReportSignatureAge = 10 * time.Minute
+
+// oidEd25519 identifies ed25519 keys in PKCS #8 and PKIX, as of RFC 8410.
+// crypto/x509 only knows them from Go 1.13, so we parse them ourselves.
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// pkcs8 is a PKCS #8 private key, as written by `openssl genpkey`.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue `asn1:"optional,tag:0"`
+	PublicKey  asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// pkixPublicKey is a PKIX public key, as written by `openssl pkey -pubout`.
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func parseEd25519PrivateKey(der []byte) (ed25519.PrivateKey, error) {
+	var key pkcs8
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, err
+	}
+	if !key.Algo.Algorithm.Equal(oidEd25519) {
+		return nil, fmt.Errorf("not an ed25519 key")
+	}
+	var seed []byte
+	if _, err := asn1.Unmarshal(key.PrivateKey, &seed); err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid ed25519 private key length %d", len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func parseEd25519PublicKey(der []byte) (ed25519.PublicKey, error) {
+	var key pkixPublicKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, err
+	}
+	if !key.Algo.Algorithm.Equal(oidEd25519) {
+		return nil, fmt.Errorf("not an ed25519 key")
+	}
+	if len(key.PublicKey.Bytes) != ed25519.PublicKeySize || key.PublicKey.BitLength != 8*ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key length %d", len(key.PublicKey.Bytes))
+	}
+	return ed25519.PublicKey(key.PublicKey.Bytes), nil
+}
+
+// Signer signs the reports and control responses of a probe with an
+// ed25519 key, so apps can tell nothing on the way tampered with them.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner makes a Signer signing with the key.
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key}
+}
+
+// LoadSigner makes a Signer of the ed25519 private key in the PEM file at
+// path, as written by `openssl genpkey -algorithm ed25519`.
+func LoadSigner(path string) (*Signer, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no private key in %s", path)
+	}
+	key, err := parseEd25519PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("the key in %s isn't an ed25519 key: %v", path, err)
+	}
+	return NewSigner(key), nil
+}
+
+// signedReport is what is signed of a report: the time of signing, and the
+// report as sent.
+func signedReport(signedAt int64, body []byte) []byte {
+	return append([]byte(strconv.FormatInt(signedAt, 10)+"\n"), body...)
+}
+
+// SignReport returns the signature of the body of a report, as it is sent,
+// in the form t=<unix time>,sig=<base64 signature>.
+func (s *Signer) SignReport(body []byte) string {
+	now := mtime.Now().Unix()
+	sig := ed25519.Sign(s.key, signedReport(now, body))
+	return fmt.Sprintf("t=%d,sig=%s", now, base64.StdEncoding.EncodeToString(sig))
+}
+
+// signedControl is what is signed of a control response: the request it
+// answers, so it can't be passed off as the answer to another, and the
+// response itself.
+type signedControl struct {
+	ID          string            `json:"id,omitempty"`
+	NodeID      string            `json:"nodeID"`
+	Control     string            `json:"control"`
+	ControlArgs map[string]string `json:"controlArgs,omitempty"`
+	Response    Response          `json:"response"`
+}
+
+// SignResponse returns the response to req as a signed envelope, which
+// Verifier.VerifyResponse opens.
+func (s *Signer) SignResponse(req Request, res Response) Response {
+	payload, err := json.Marshal(signedControl{
+		ID:          req.ID,
+		NodeID:      req.NodeID,
+		Control:     req.Control,
+		ControlArgs: req.ControlArgs,
+		Response:    res,
+	})
+	if err != nil {
+		return ResponseError(err)
+	}
+	return Response{
+		Signed:    base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+		RequestID: res.RequestID,
+	}
+}
+
+// Verifier checks the signatures of reports and control responses against
+// the public keys of the probes.
+type Verifier struct {
+	keys []ed25519.PublicKey
+}
+
+// NewVerifier makes a Verifier taking signatures by any of the keys.
+func NewVerifier(keys ...ed25519.PublicKey) *Verifier {
+	return &Verifier{keys: keys}
+}
+
+// LoadVerifier makes a Verifier of the ed25519 public keys in the PEM file
+// at path, as written by `openssl pkey -pubout`, one after the other.
+func LoadVerifier(path string) (*Verifier, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		block, buf = pem.Decode(buf)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := parseEd25519PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("a key in %s isn't an ed25519 key: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys in %s", path)
+	}
+	return NewVerifier(keys...), nil
+}
+
+func (v *Verifier) verify(message, sig []byte) bool {
+	for _, key := range v.keys {
+		if ed25519.Verify(key, message, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyReport checks the signature made by Signer.SignReport of the body of
+// a report, as received, and that it was made lately.
+func (v *Verifier) VerifyReport(body []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("report isn't signed")
+	}
+	var (
+		signedAt int64
+		sig      []byte
+		err      error
+	)
+	for _, field := range strings.Split(signature, ",") {
+		switch {
+		case strings.HasPrefix(field, "t="):
+			signedAt, err = strconv.ParseInt(strings.TrimPrefix(field, "t="), 10, 64)
+		case strings.HasPrefix(field, "sig="):
+			sig, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(field, "sig="))
+		}
+		if err != nil {
+			return fmt.Errorf("malformed report signature: %v", err)
+		}
+	}
+	if signedAt == 0 || sig == nil {
+		return fmt.Errorf("malformed report signature")
+	}
+	if !v.verify(signedReport(signedAt, body), sig) {
+		return fmt.Errorf("report signature doesn't match")
+	}
+	if age := mtime.Now().Sub(time.Unix(signedAt, 0)); age > MaxReportSignatureAge || age < -MaxReportSignatureAge {
+		return fmt.Errorf("report was signed %s ago", age)
+	}
+	return nil
+}
+
+// VerifyResponse opens a response signed by Signer.SignResponse, checking
+// the signature, and that it answers req.
+func (v *Verifier) VerifyResponse(req Request, res Response) (Response, error) {
+	if res.Signed == "" {
+		return Response{}, fmt.Errorf("control response isn't signed")
+	}
+	payload, err := base64.StdEncoding.DecodeString(res.Signed)
+	if err != nil {
+		return Response{}, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(res.Signature)
+	if err != nil {
+		return Response{}, err
+	}
+	if !v.verify(payload, sig) {
+		return Response{}, fmt.Errorf("control response signature doesn't match")
+	}
+	var signed signedControl
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return Response{}, err
+	}
+	// Probes predating request IDs don't sign them
+	if signed.ID != "" && signed.ID != req.ID ||
+		signed.NodeID != req.NodeID || signed.Control != req.Control ||
+		(len(signed.ControlArgs) > 0 || len(req.ControlArgs) > 0) && !reflect.DeepEqual(signed.ControlArgs, req.ControlArgs) {
+		return Response{}, fmt.Errorf("control response is for another request")
+	}
+	return signed.Response, nil
+}
@@ -0,0 +1,300 @@
+package xfer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultTLSReloadInterval is how often certificates are checked for
+// changes, if not configured.
+const DefaultTLSReloadInterval = 10 * time.Second
+
+// TLSConfig configures mutual TLS between probes and apps: the certificate
+// and key to present, and the CAs peers' certificates must be issued by.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string // PEM bundle; the system's CAs if empty
+	// PeerIDs are the SPIFFE IDs peers may have as URI SANs, or the trust
+	// domains (spiffe://example.org) whose IDs they may have. Any peer the
+	// CAs issued a certificate to if empty.
+	PeerIDs        []string
+	ReloadInterval time.Duration
+}
+
+// TLSCertificates keeps the certificate, key and CAs of a TLSConfig,
+// reloading them as they are rotated on disk, so the tls.Configs it makes
+// use the latest without restarting.
+type TLSCertificates struct {
+	config  TLSConfig
+	peerIDs []*url.URL
+	quit    chan struct{}
+
+	mtx      sync.RWMutex
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewTLSCertificates loads the files of config, and keeps checking them for
+// changes until stopped.
+func NewTLSCertificates(config TLSConfig) (*TLSCertificates, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("need both a certificate and a key")
+	}
+	if config.ReloadInterval <= 0 {
+		config.ReloadInterval = DefaultTLSReloadInterval
+	}
+	c := &TLSCertificates{
+		config:   config,
+		quit:     make(chan struct{}),
+		modTimes: map[string]time.Time{},
+	}
+	for _, id := range config.PeerIDs {
+		u, err := url.Parse(id)
+		if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+			return nil, fmt.Errorf("invalid SPIFFE ID or trust domain %q", id)
+		}
+		c.peerIDs = append(c.peerIDs, u)
+	}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	go c.loop()
+	return c, nil
+}
+
+// Stop stops checking for changes.
+func (c *TLSCertificates) Stop() {
+	close(c.quit)
+}
+
+func (c *TLSCertificates) loop() {
+	ticker := time.NewTicker(c.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if reloaded, err := c.reload(); err != nil {
+				// Rotation may be halfway through writing the files
+				log.Warnf("Error reloading TLS certificates, keeping the previous ones: %v", err)
+			} else if reloaded {
+				log.Infof("Reloaded TLS certificates")
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// reload loads the files again, if any of them changed since last time.
+func (c *TLSCertificates) reload() (bool, error) {
+	modTimes := map[string]time.Time{}
+	changed := false
+	for _, path := range []string{c.config.CertFile, c.config.KeyFile, c.config.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		modTimes[path] = info.ModTime()
+		c.mtx.RLock()
+		if last, ok := c.modTimes[path]; !ok || !last.Equal(info.ModTime()) {
+			changed = true
+		}
+		c.mtx.RUnlock()
+	}
+	if !changed {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if c.config.CertFile != "" {
+		loaded, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+		if err != nil {
+			return false, err
+		}
+		cert = &loaded
+	}
+	var roots *x509.CertPool
+	if c.config.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.config.CAFile)
+		if err != nil {
+			return false, err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no CA certificates in %s", c.config.CAFile)
+		}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.cert, c.roots, c.modTimes = cert, roots, modTimes
+	return true, nil
+}
+
+func (c *TLSCertificates) current() (*tls.Certificate, *x509.CertPool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.cert, c.roots
+}
+
+// verify checks the chain of a peer's certificate leads to the CAs, or
+// defaultRoots if there is no CA file, and that it has one of the peer IDs.
+// With no peer IDs, servers must have certificates for serverName.
+func (c *TLSCertificates) verify(rawCerts [][]byte, usage x509.ExtKeyUsage, serverName string, defaultRoots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	_, roots := c.current()
+	if roots == nil {
+		roots = defaultRoots
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	if len(c.peerIDs) == 0 {
+		opts.DNSName = serverName
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return err
+	}
+	if len(c.peerIDs) == 0 {
+		return nil
+	}
+	uris, err := certificateURIs(certs[0])
+	if err != nil {
+		return err
+	}
+	for _, uri := range uris {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+		for _, allowed := range c.peerIDs {
+			if uri.Host == allowed.Host && (strings.Trim(allowed.Path, "/") == "" || uri.Path == allowed.Path) {
+				return nil
+			}
+		}
+		return fmt.Errorf("peer %s isn't allowed", uri)
+	}
+	return fmt.Errorf("peer has no SPIFFE ID")
+}
+
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// uniformResourceIdentifierTag is the tag of URIs among the GeneralNames
+// of subject alternative names (RFC 5280, 4.2.1.6).
+const uniformResourceIdentifierTag = 6
+
+// certificateURIs returns the URIs among the subject alternative names of
+// the certificate, which crypto/x509 only parses in newer versions of Go.
+func certificateURIs(cert *x509.Certificate) ([]*url.URL, error) {
+	var uris []*url.URL
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var names asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return nil, err
+		} else if len(rest) != 0 || !names.IsCompound || names.Tag != asn1.TagSequence {
+			return nil, fmt.Errorf("invalid subject alternative names")
+		}
+		for rest := names.Bytes; len(rest) > 0; {
+			var name asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+				return nil, err
+			}
+			if name.Class != asn1.ClassContextSpecific || name.Tag != uniformResourceIdentifierTag {
+				continue
+			}
+			uri, err := url.Parse(string(name.Bytes))
+			if err != nil {
+				return nil, err
+			}
+			uris = append(uris, uri)
+		}
+	}
+	return uris, nil
+}
+
+// ServerConfig makes a tls.Config for apps. If requireClientCerts, all
+// clients must present certificates; otherwise they may, and those they do
+// present are verified all the same.
+func (c *TLSCertificates) ServerConfig(requireClientCerts bool) *tls.Config {
+	clientAuth := tls.RequestClientCert
+	if requireClientCerts {
+		clientAuth = tls.RequireAnyClientCert
+	}
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			if cert == nil {
+				return nil, fmt.Errorf("no certificate")
+			}
+			return cert, nil
+		},
+		ClientAuth: clientAuth,
+		// Verified here rather than with ClientCAs, which can't be reloaded
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 && !requireClientCerts {
+				return nil
+			}
+			return c.verify(rawCerts, x509.ExtKeyUsageClientAuth, "", nil)
+		},
+	}
+}
+
+// ClientConfig makes a tls.Config for probes connecting to serverName,
+// verifying apps' certificates with defaultRoots if there is no CA file.
+func (c *TLSCertificates) ClientConfig(serverName string, defaultRoots *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+		// Verified here rather than with RootCAs, which can't be reloaded,
+		// and by SPIFFE ID rather than hostname if asked
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verify(rawCerts, x509.ExtKeyUsageServerAuth, serverName, defaultRoots)
+		},
+	}
+}
+
+// HasPeerCertificate tells whether the peer of a connection presented a
+// certificate, which a TLSCertificates config will have verified.
+func HasPeerCertificate(state *tls.ConnectionState) bool {
+	return state != nil && len(state.PeerCertificates) > 0
+}
@@ -0,0 +1,197 @@
+package xfer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate for the SPIFFE ID, and its key, into dir.
+func (ca testCA) issue(t *testing.T, dir, name, spiffeID string, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// x509.Certificate only has URIs in newer versions of Go, so we write
+	// the subject alternative names ourselves
+	names, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: uniformResourceIdentifierTag, Bytes: []byte(spiffeID)},
+		{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: net.ParseIP("127.0.0.1").To4()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(time.Now().UnixNano()),
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{usage},
+		ExtraExtensions: []pkix.Extension{{Id: oidSubjectAltName, Value: names}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+var writes int
+
+// writeFile writes the file with a new modification time, so it is
+// reloaded however quickly it is rewritten.
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	writes++
+	modTime := time.Unix(int64(writes), 0)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.pem)
+	appCert, appKey := ca.issue(t, dir, "app", "spiffe://example.org/scope-app", x509.ExtKeyUsageServerAuth)
+	probeCert, probeKey := ca.issue(t, dir, "probe", "spiffe://example.org/ns/weave/scope-probe", x509.ExtKeyUsageClientAuth)
+
+	appCerts, err := NewTLSCertificates(TLSConfig{CertFile: appCert, KeyFile: appKey, CAFile: caFile, PeerIDs: []string{"spiffe://example.org"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appCerts.Stop()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasPeerCertificate(r.TLS) {
+			t.Error("Expected a client certificate")
+		}
+	}))
+	server.Listener = tls.NewListener(server.Listener, appCerts.ServerConfig(true))
+	server.Start()
+	defer server.Close()
+	serverURL := "https" + server.URL[len("http"):]
+
+	get := func(config TLSConfig) error {
+		probeCerts, err := NewTLSCertificates(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer probeCerts.Stop()
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: probeCerts.ClientConfig("127.0.0.1", nil)}}
+		resp, err := client.Get(serverURL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// Both ends verify each other
+	if err := get(TLSConfig{CertFile: probeCert, KeyFile: probeKey, CAFile: caFile, PeerIDs: []string{"spiffe://example.org/scope-app"}}); err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	// Probes check they talk to the right app
+	if err := get(TLSConfig{CertFile: probeCert, KeyFile: probeKey, CAFile: caFile, PeerIDs: []string{"spiffe://example.org/other-app"}}); err == nil {
+		t.Fatal("Expected the app to be refused for its SPIFFE ID")
+	}
+	if err := get(TLSConfig{CertFile: probeCert, KeyFile: probeKey, CAFile: caFile, PeerIDs: []string{"spiffe://example.com"}}); err == nil {
+		t.Fatal("Expected the app to be refused for its trust domain")
+	}
+	// And apps that probes have certificates
+	if err := get(TLSConfig{CAFile: caFile}); err == nil {
+		t.Fatal("Expected the probe to be refused without a certificate")
+	}
+	other := newTestCA(t)
+	otherCert, otherKey := other.issue(t, dir, "other", "spiffe://example.org/ns/weave/scope-probe", x509.ExtKeyUsageClientAuth)
+	if err := get(TLSConfig{CertFile: otherCert, KeyFile: otherKey, CAFile: caFile}); err == nil {
+		t.Fatal("Expected the probe to be refused for its CA")
+	}
+
+	// Rotating to the other CA takes once reloaded
+	writeFile(t, caFile, other.pem)
+	appCert, appKey = other.issue(t, dir, "app", "spiffe://example.org/scope-app", x509.ExtKeyUsageServerAuth)
+	if reloaded, err := appCerts.reload(); err != nil || !reloaded {
+		t.Fatalf("Expected to reload, got %v, %v", reloaded, err)
+	}
+	if err := get(TLSConfig{CertFile: otherCert, KeyFile: otherKey, CAFile: caFile}); err != nil {
+		t.Fatalf("Expected to connect after rotation, got %v", err)
+	}
+	if err := get(TLSConfig{CertFile: probeCert, KeyFile: probeKey}); err == nil {
+		t.Fatal("Expected the probe to be refused after rotation")
+	}
+	if reloaded, err := appCerts.reload(); err != nil || reloaded {
+		t.Fatalf("Expected nothing to reload, got %v, %v", reloaded, err)
+	}
+
+	// Bad rotations keep the previous certificates
+	writeFile(t, appCert, []byte("garbage"))
+	if _, err := appCerts.reload(); err == nil {
+		t.Fatal("Expected an error reloading a bad certificate")
+	}
+	if err := get(TLSConfig{CertFile: otherCert, KeyFile: otherKey, CAFile: caFile}); err != nil {
+		t.Fatalf("Expected to connect with the previous certificates, got %v", err)
+	}
+
+	if _, err := NewTLSCertificates(TLSConfig{PeerIDs: []string{"https://example.org"}}); err == nil {
+		t.Fatal("Expected an error for a non-SPIFFE ID")
+	}
+}
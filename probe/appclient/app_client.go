@@ -1,6 +1,7 @@
 package appclient
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,23 +9,57 @@ import (
 	"net/http"
 	"net/rpc"
 	"net/url"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/websocket"
 	"github.com/hashicorp/go-cleanhttp"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/ugorji/go/codec"
 
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
 )
 
 const (
 	httpClientTimeout = 12 * time.Second // a bit less than default app.window
 	initialBackoff    = 1 * time.Second
 	maxBackoff        = 60 * time.Second
+
+	// minPublishDelay is the least delay publishing reports backs off to,
+	// below which it's dropped as the app recovers.
+	minPublishDelay = 100 * time.Millisecond
 )
 
+// overloadedError is the error of reports the app turned away as it is
+// overloaded, with how long it asked probes to wait before the next.
+type overloadedError struct {
+	retryAfter time.Duration
+}
+
+func (e overloadedError) Error() string {
+	return fmt.Sprintf("app overloaded, retry after %s", e.retryAfter)
+}
+
+// parseRetryAfter parses a Retry-After header, or trailer, in seconds or
+// as a date, defaulting to initialBackoff.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return initialBackoff
+}
+
 // AppClient is a client to an app, dealing with report publishing, controls and pipes.
 type AppClient interface {
 	Details() (xfer.Details, error)
@@ -56,8 +91,18 @@ type appClient struct {
 	conns map[string]xfer.Websocket
 
 	// For publish
-	publishLoop sync.Once
-	readers     chan io.Reader
+	publishLoop      sync.Once
+	publications     chan Publication
+	reportStreamPort int
+	protobuf         bool          // whether the app takes protobuf reports
+	encoding         string        // to compress reports with, for the app
+	reportStream     *reportStream // only touched by the publish loop
+	publishDelay     time.Duration // between reports, as the app asks; only touched by the publish loop
+	publishFailing   bool          // whether the app is unreachable, so reports dropped are spilled
+	spill            *spillBuffer  // of reports which couldn't be published, if configured
+	spilled          bool          // whether there may be reports to replay
+	replaying        bool          // whether spilled reports are being replayed
+	filter           publishFilter // of what's published to the app, as its target says
 
 	// For controls
 	control xfer.ControlHandler
@@ -65,11 +110,23 @@ type appClient struct {
 
 // NewAppClient makes a new appClient.
 func NewAppClient(pc ProbeConfig, hostname string, target url.URL, control xfer.ControlHandler) (AppClient, error) {
+	filter, target, err := parsePublishFilter(target)
+	if err != nil {
+		return nil, err
+	}
 	httpTransport := pc.getHTTPTransport(hostname)
 	httpClient := cleanhttp.DefaultClient()
 	httpClient.Transport = httpTransport
 	httpClient.Timeout = httpClientTimeout
 
+	var spill *spillBuffer
+	if pc.SpillDir != "" {
+		spill, err = newSpillBuffer(filepath.Join(pc.SpillDir, url.PathEscape(target.Host)), pc.SpillBytes, pc.SpillMaxAge)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &appClient{
 		ProbeConfig: pc,
 		quit:        make(chan struct{}),
@@ -80,9 +137,12 @@ func NewAppClient(pc ProbeConfig, hostname string, target url.URL, control xfer.
 			TLSClientConfig:  httpTransport.TLSClientConfig,
 			HandshakeTimeout: httpClientTimeout,
 		},
-		conns:   map[string]xfer.Websocket{},
-		readers: make(chan io.Reader, 2),
-		control: control,
+		conns:        map[string]xfer.Websocket{},
+		publications: make(chan Publication, 2),
+		spill:        spill,
+		spilled:      spill != nil, // from before the probe restarted
+		filter:       filter,
+		control:      control,
 	}, nil
 }
 
@@ -167,7 +227,7 @@ func (c *appClient) ReTarget(target url.URL) {
 // Stop stops the appClient.
 func (c *appClient) Stop() {
 	c.mtx.Lock()
-	close(c.readers)
+	close(c.publications)
 	close(c.quit)
 	for _, conn := range c.conns {
 		conn.Close()
@@ -176,6 +236,7 @@ func (c *appClient) Stop() {
 	c.mtx.Unlock()
 
 	c.backgroundWait.Wait()
+	c.closeReportStream()
 	c.client.Transport.(*http.Transport).CloseIdleConnections()
 	return
 }
@@ -196,6 +257,21 @@ func (c *appClient) Details() (xfer.Details, error) {
 		return result, err
 	}
 	c.appID = result.ID
+	c.mtx.Lock()
+	c.reportStreamPort = result.ReportStreamPort
+	c.protobuf = false
+	for _, contentType := range result.ReportContentTypes {
+		if contentType == report.ProtobufContentType {
+			c.protobuf = true
+		}
+	}
+	c.encoding = report.GzipEncoding
+	for _, encoding := range result.ReportEncodings {
+		if encoding == c.ProbeConfig.Encoding {
+			c.encoding = encoding
+		}
+	}
+	c.mtx.Unlock()
 	return result, nil
 }
 
@@ -253,6 +329,9 @@ func (c *appClient) controlConnection() (bool, error) {
 		req.AppID = c.appID
 		var res xfer.Response
 		c.control.Handle(req, &res)
+		if c.Signer != nil {
+			res = c.Signer.SignResponse(req, res)
+		}
 		return res
 	}
 
@@ -280,15 +359,46 @@ func (c *appClient) ControlConnection() {
 	}()
 }
 
-func (c *appClient) publish(r io.Reader) error {
+func (c *appClient) publish(pub Publication) (err error) {
+	span := opentracing.StartSpan("probe.post", opentracing.ChildOf(pub.Trace), ext.SpanKindRPCClient)
+	span.SetTag("app", c.hostname)
+	defer func() {
+		tracing.SetError(span, err)
+		span.Finish()
+	}()
+
+	if c.useReportStream() {
+		return c.publishStream(pub, span.Context())
+	}
+	c.closeReportStream()
+
+	contentType, encoding, buf, err := c.serialise(pub)
+	if err != nil {
+		return err
+	}
+	return c.postReport(contentType, encoding, buf, time.Time{}, span.Context())
+}
+
+// postReport POSTs the report, serialised and compressed as the content
+// type and encoding say. Reports replayed from the spill buffer are marked
+// with when they were made. The app carries on the trace of the span.
+func (c *appClient) postReport(contentType, encoding string, buf []byte, replayed time.Time, span opentracing.SpanContext) error {
 	url := c.url("/api/report")
-	req, err := c.ProbeConfig.authorizedRequest("POST", url, r)
+	req, err := c.ProbeConfig.authorizedRequest("POST", url, bytes.NewReader(buf))
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Encoding", "gzip")
-	req.Header.Set("Content-Type", "application/msgpack")
-	// req.Header.Set("Content-Type", "application/binary") // TODO: we should use http.DetectContentType(..) on the gob'ed
+	req.Header.Set("Content-Encoding", encoding)
+	req.Header.Set("Content-Type", contentType)
+	if c.Signer != nil {
+		req.Header.Set(xfer.ReportSignatureHeader, c.Signer.SignReport(buf))
+	}
+	if !replayed.IsZero() {
+		req.Header.Set(xfer.ScopeReportReplayedHeader, replayed.UTC().Format(time.RFC3339Nano))
+	}
+	if span != nil {
+		opentracing.GlobalTracer().Inject(span, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+	}
 
 	// Make sure this request is cancelled when we stop the client
 	req.Cancel = c.quit
@@ -299,6 +409,9 @@ func (c *appClient) publish(r io.Reader) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return overloadedError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
 	if resp.StatusCode != http.StatusOK {
 		text, _ := ioutil.ReadAll(resp.Body)
 		return fmt.Errorf(resp.Status + ": " + string(text))
@@ -306,40 +419,209 @@ func (c *appClient) publish(r io.Reader) error {
 	return nil
 }
 
+// serialise serialises a whole report in the best content type the app
+// takes: protobuf, if it does, otherwise msgpack.
+func (c *appClient) serialise(pub Publication) (contentType, encoding string, buf []byte, err error) {
+	c.mtx.Lock()
+	protobuf := c.protobuf
+	c.mtx.Unlock()
+	encoding = c.reportEncoding()
+	if protobuf && pub.Protobuf != nil {
+		buf, err = pub.Protobuf(encoding)
+		return report.ProtobufContentType, encoding, buf, err
+	}
+	buf, err = pub.Whole(encoding)
+	return report.MsgpackContentType, encoding, buf, err
+}
+
+// reportEncoding is what to compress reports with: what the probe is
+// configured to, if the app takes it, otherwise gzip.
+func (c *appClient) reportEncoding() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.encoding == "" {
+		return report.GzipEncoding
+	}
+	return c.encoding
+}
+
 func (c *appClient) startPublishing() {
 	go func() {
 		log.Infof("Publish loop for %s starting", c.hostname)
 		defer log.Infof("Publish loop for %s exiting", c.hostname)
 		c.doWithBackoff("publish", func() (bool, error) {
-			r := <-c.readers
-			if r == nil {
+			// Wait before taking the report, so it's the latest
+			if c.publishDelay > 0 {
+				select {
+				case <-time.After(c.publishDelay):
+				case <-c.quit:
+					return true, nil
+				}
+			}
+			pub, ok := <-c.publications
+			if !ok {
 				return true, nil
 			}
-			return false, c.publish(r)
+			err := c.publish(pub)
+			c.adaptPublishDelay(err)
+			if _, ok := err.(overloadedError); ok {
+				log.Warnf("Publishing to %s: %v", c.hostname, err)
+				return false, nil
+			}
+			c.setPublishFailing(err != nil)
+			if err != nil {
+				c.spillPublication(pub)
+				return false, err
+			}
+			c.startReplay()
+			return false, nil
 		})
 	}()
 }
 
+func (c *appClient) setPublishFailing(failing bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.publishFailing = failing
+}
+
+// spillPublication keeps the report, if it's not a shortcut one, in the
+// spill buffer, to be replayed once the app is reachable again.
+func (c *appClient) spillPublication(pub Publication) {
+	if c.spill == nil || pub.Shortcut {
+		return
+	}
+	buf, err := pub.Whole(report.GzipEncoding)
+	if err == nil {
+		err = c.spill.spill(time.Now(), buf)
+	}
+	if err != nil {
+		log.Warnf("Spilling report to %s: %v", c.hostname, err)
+		return
+	}
+	c.mtx.Lock()
+	c.spilled = true
+	c.mtx.Unlock()
+}
+
+// startReplay replays the reports spilled while the app was unreachable,
+// as it is reachable again, in the background, so as not to hold up the
+// reports published meanwhile. Only one replay runs at a time.
+func (c *appClient) startReplay() {
+	c.mtx.Lock()
+	replay := c.spilled && !c.replaying
+	if replay {
+		c.spilled = false
+		c.replaying = true
+	}
+	c.mtx.Unlock()
+	if !replay || !c.retainGoroutine() {
+		return
+	}
+	go func() {
+		defer c.releaseGoroutine()
+		c.replaySpilled()
+	}()
+}
+
+// replaySpilled publishes the reports spilled while the app was
+// unreachable, marked with when they were made, so the app keeps them as
+// of then. They go down a report stream of their own, if the app has one,
+// otherwise they are POSTed.
+func (c *appClient) replaySpilled() {
+	var err error
+	if c.useReportStream() {
+		err = c.replayStream()
+	} else {
+		err = c.spill.replay(func(made time.Time, buf []byte) error {
+			return c.postReport(report.MsgpackContentType, report.GzipEncoding, buf, made, nil)
+		})
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.replaying = false
+	if err != nil {
+		log.Warnf("Replaying reports spilled for %s: %v", c.hostname, err)
+		c.spilled = true
+	}
+}
+
+// adaptPublishDelay backs the delay between reports off as the app says it
+// is overloaded, to at least as long as it asks, and halves it as reports
+// are taken again, so the interval of reports adapts to what the app can
+// take. Reports published in the meantime replace those queued.
+func (c *appClient) adaptPublishDelay(err error) {
+	if overloaded, ok := err.(overloadedError); ok {
+		c.publishDelay *= 2
+		if c.publishDelay < overloaded.retryAfter {
+			c.publishDelay = overloaded.retryAfter
+		}
+		if c.publishDelay > maxBackoff {
+			c.publishDelay = maxBackoff
+		}
+		return
+	}
+	if err == nil {
+		if c.publishDelay /= 2; c.publishDelay < minPublishDelay {
+			c.publishDelay = 0
+		}
+	}
+}
+
 // Publish implements Publisher
 func (c *appClient) Publish(r io.Reader, shortcut bool) error {
+	gzipped, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.PublishDelta(Publication{
+		Shortcut: shortcut,
+		Whole: serialiseOnce(func(w io.Writer, encoding string) error {
+			if encoding == report.GzipEncoding {
+				_, err := w.Write(gzipped)
+				return err
+			}
+			rpt, err := report.MakeFromBytes(gzipped)
+			if err != nil {
+				return err
+			}
+			return rpt.WriteEncoded(w, report.MsgpackContentType, encoding)
+		}),
+	})
+}
+
+// PublishDelta implements DeltaPublisher
+func (c *appClient) PublishDelta(pub Publication) error {
+	pub, due, err := c.filter.filter(pub, time.Now())
+	if err != nil || !due {
+		return err
+	}
 	// Lazily start the background publishing loop.
 	c.publishLoop.Do(c.startPublishing)
 	// enqueue report
 	select {
-	case c.readers <- r:
+	case c.publications <- pub:
 	default:
 		log.Warnf("Dropping report to %s", c.hostname)
-		if shortcut {
+		if pub.Shortcut {
 			return nil
 		}
-		// drop an old report to make way for new one
+		// drop an old report to make way for new one, keeping it if the
+		// app is unreachable
 		c.mtx.Lock()
-		defer c.mtx.Unlock()
+		var dropped *Publication
 		select {
-		case <-c.readers:
+		case old := <-c.publications:
+			if c.publishFailing {
+				dropped = &old
+			}
 		default:
 		}
-		c.readers <- r
+		c.publications <- pub
+		c.mtx.Unlock()
+		if dropped != nil {
+			c.spillPublication(*dropped)
+		}
 	}
 	return nil
 }
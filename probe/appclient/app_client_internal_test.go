@@ -3,11 +3,14 @@ package appclient
 import (
 	"compress/gzip"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -166,6 +169,44 @@ func TestAppClientDetails(t *testing.T) {
 	}
 }
 
+func TestAppClientNegotiation(t *testing.T) {
+	test := func(details xfer.Details, wantContentType, wantEncoding string) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			codec.NewEncoder(w, &codec.JsonHandle{}).Encode(details)
+		}))
+		defer s.Close()
+
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := NewAppClient(ProbeConfig{Encoding: report.SnappyEncoding}, u.Host, *u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Stop()
+		if _, err := p.Details(); err != nil {
+			t.Fatal(err)
+		}
+
+		serialise := func(encoding string) ([]byte, error) { return []byte(encoding), nil }
+		contentType, encoding, buf, err := p.(*appClient).serialise(Publication{Whole: serialise, Protobuf: serialise})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != wantContentType || encoding != wantEncoding || string(buf) != wantEncoding {
+			t.Errorf("Expected %s %s, got %s %s", wantContentType, wantEncoding, contentType, encoding)
+		}
+	}
+
+	// Apps which don't say what they take get what all apps do
+	test(xfer.Details{}, report.MsgpackContentType, report.GzipEncoding)
+	test(xfer.Details{
+		ReportContentTypes: []string{report.ProtobufContentType, report.MsgpackContentType},
+		ReportEncodings:    report.Encodings,
+	}, report.ProtobufContentType, report.SnappyEncoding)
+}
+
 // Make sure Stopping a client works even if the connection or the remote app
 // gets stuck for whatever reason.
 // See https://github.com/weaveworks/scope/issues/1576
@@ -225,3 +266,108 @@ func TestStop(t *testing.T) {
 	// Let the server go so that the test can end
 	close(stopHanging)
 }
+
+func TestAppClientOverloaded(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	c := p.(*appClient)
+
+	whole := func(string) ([]byte, error) { return []byte{}, nil }
+	err = c.publish(Publication{Whole: whole})
+	if want := (overloadedError{retryAfter: 3 * time.Second}); err != want {
+		t.Fatalf("Expected %v, got %v", want, err)
+	}
+
+	// The delay between reports backs off to at least what the app asks,
+	// and recovers as reports are taken again
+	c.adaptPublishDelay(err)
+	if c.publishDelay != 3*time.Second {
+		t.Errorf("Expected a delay of 3s, got %s", c.publishDelay)
+	}
+	c.adaptPublishDelay(err)
+	if c.publishDelay != 6*time.Second {
+		t.Errorf("Expected a delay of 6s, got %s", c.publishDelay)
+	}
+	for i := 0; i < 10; i++ {
+		c.adaptPublishDelay(nil)
+	}
+	if c.publishDelay != 0 {
+		t.Errorf("Expected no delay, got %s", c.publishDelay)
+	}
+}
+
+func TestAppClientSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mtx         sync.Mutex
+		unreachable = true
+		replayed    []string
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if unreachable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if made := r.Header.Get(xfer.ScopeReportReplayedHeader); made != "" {
+			buf, _ := ioutil.ReadAll(r.Body)
+			replayed = append(replayed, string(buf))
+		}
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{SpillDir: dir}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	c := p.(*appClient)
+
+	whole := func(buf string) func(string) ([]byte, error) {
+		return func(string) ([]byte, error) { return []byte(buf), nil }
+	}
+	// Reports the app doesn't take are spilled, but for shortcut ones
+	for _, pub := range []Publication{{Whole: whole("first")}, {Whole: whole("shortcut"), Shortcut: true}} {
+		if err := c.publish(pub); err == nil {
+			t.Fatal("Expected publishing to fail")
+		}
+		c.spillPublication(pub)
+	}
+
+	// And are replayed, once it does
+	mtx.Lock()
+	unreachable = false
+	mtx.Unlock()
+	if err := c.publish(Publication{Whole: whole("second")}); err != nil {
+		t.Fatal(err)
+	}
+	c.replaySpilled()
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want := []string{"first"}; !reflect.DeepEqual(want, replayed) {
+		t.Errorf("Expected %v replayed, got %v", want, replayed)
+	}
+}
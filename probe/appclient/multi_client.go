@@ -28,6 +28,7 @@ type multiClient struct {
 	sema       semaphore
 	clients    map[string]AppClient     // holds map from app id -> client
 	ids        map[string]report.IDList // holds map from hostname -> app ids
+	features   map[string][]string      // holds map from app id -> report features it takes
 	quit       chan struct{}
 	noControls bool
 }
@@ -62,6 +63,7 @@ func NewMultiAppClient(clientFactory ClientFactory, noControls bool) MultiAppCli
 		sema:       newSemaphore(maxConcurrentGET),
 		clients:    map[string]AppClient{},
 		ids:        map[string]report.IDList{},
+		features:   map[string][]string{},
 		quit:       make(chan struct{}),
 		noControls: noControls,
 	}
@@ -103,10 +105,14 @@ func (c *multiClient) Set(hostname string, urls []url.URL) {
 	hostIDs := report.MakeIDList()
 	for tuple := range clients {
 		hostIDs = hostIDs.Add(tuple.ID)
+		c.features[tuple.ID] = tuple.ReportFeatures
 		if client, ok := c.clients[tuple.ID]; ok {
 			client.ReTarget(tuple.AppClient.Target())
 		} else {
 			c.clients[tuple.ID] = tuple.AppClient
+			if tuple.ReportVersion < report.SchemaVersion {
+				log.Infof("App %s takes reports of version %d, older than ours (%d)", tuple.ID, tuple.ReportVersion, report.SchemaVersion)
+			}
 			if !c.noControls {
 				tuple.AppClient.ControlConnection()
 			}
@@ -123,6 +129,7 @@ func (c *multiClient) Set(hostname string, urls []url.URL) {
 		if !allReferencedIDs.Contains(id) {
 			client.Stop()
 			delete(c.clients, id)
+			delete(c.features, id)
 		}
 	}
 }
@@ -193,6 +200,58 @@ func (c *multiClient) Publish(r io.Reader, shortcut bool) error {
 	return nil
 }
 
+// PublishDelta implements DeltaPublisher, by passing the publication on to
+// the underlying publishers which take deltas, and publishing it whole to
+// the others.
+func (c *multiClient) PublishDelta(pub Publication) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	errs := []string{}
+	for _, c := range c.clients {
+		var err error
+		if dp, ok := c.(DeltaPublisher); ok {
+			err = dp.PublishDelta(pub)
+		} else {
+			var buf []byte
+			if buf, err = pub.Whole(report.GzipEncoding); err == nil {
+				err = c.Publish(bytes.NewReader(buf), pub.Shortcut)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ReportFeatures implements FeatureNegotiator: the report features every
+// app takes.
+func (c *multiClient) ReportFeatures() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if len(c.features) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, features := range c.features {
+		for _, feature := range features {
+			counts[feature]++
+		}
+	}
+	result := []string{}
+	for feature, count := range counts {
+		if count == len(c.features) {
+			result = append(result, feature)
+		}
+	}
+	return result
+}
+
 type semaphore chan struct{}
 
 func newSemaphore(n int) semaphore {
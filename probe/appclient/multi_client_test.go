@@ -12,14 +12,15 @@ import (
 )
 
 type mockClient struct {
-	id      string
-	count   int
-	stopped int
-	publish int
+	id       string
+	features []string
+	count    int
+	stopped  int
+	publish  int
 }
 
 func (c *mockClient) Details() (xfer.Details, error) {
-	return xfer.Details{ID: c.id}, nil
+	return xfer.Details{ID: c.id, ReportFeatures: c.features}, nil
 }
 
 func (c *mockClient) ControlConnection() {
@@ -114,3 +115,30 @@ func TestMultiClientPublish(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiClientReportFeatures(t *testing.T) {
+	var (
+		newer   = &mockClient{id: "newer", features: []string{"a", "b"}}
+		older   = &mockClient{id: "older", features: []string{"a"}}
+		factory = func(hostname string, url url.URL) (appclient.AppClient, error) {
+			if url.Host == "newer" {
+				return newer, nil
+			}
+			return older, nil
+		}
+	)
+	mp := appclient.NewMultiAppClient(factory, true)
+	defer mp.Stop()
+	fn := mp.(appclient.FeatureNegotiator)
+
+	mp.Set("a", []url.URL{{Host: "newer"}})
+	if have := fn.ReportFeatures(); len(have) != 2 {
+		t.Errorf("want [a b], have %v", have)
+	}
+
+	// Only features every app takes count
+	mp.Set("b", []url.URL{{Host: "older"}})
+	if have := fn.ReportFeatures(); len(have) != 1 || have[0] != "a" {
+		t.Errorf("want [a], have %v", have)
+	}
+}
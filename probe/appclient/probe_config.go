@@ -35,6 +35,18 @@ type ProbeConfig struct {
 	ProbeVersion string
 	ProbeID      string
 	Insecure     bool
+	ReportStream bool   // publish over the app's report stream, if it has one
+	Encoding     string // to compress reports with, for apps which take it
+	// TLS, if set, has the certificate probes present to apps, and the CAs
+	// and SPIFFE IDs apps' certificates are verified against.
+	TLS *xfer.TLSCertificates
+	// Signer, if set, signs reports and control responses.
+	Signer *xfer.Signer
+	// SpillDir, if set, is where reports which couldn't be published are
+	// kept, up to SpillBytes per app, to be replayed within SpillMaxAge.
+	SpillDir    string
+	SpillBytes  int64
+	SpillMaxAge time.Duration
 }
 
 func (pc ProbeConfig) authorizeHeaders(headers http.Header) {
@@ -57,7 +69,12 @@ func (pc ProbeConfig) getHTTPTransport(hostname string) *http.Transport {
 		Timeout:   dialTimeout,
 		KeepAlive: 30 * time.Second,
 	}).DialContext
-	if pc.Insecure {
+	if pc.TLS != nil {
+		transport.TLSClientConfig = pc.TLS.ClientConfig(hostname, certPool)
+		if pc.Insecure {
+			transport.TLSClientConfig.VerifyPeerCertificate = nil
+		}
+	} else if pc.Insecure {
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	} else {
 		transport.TLSClientConfig = &tls.Config{
@@ -0,0 +1,107 @@
+package appclient
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Query parameters of target URLs, configuring what is published to them.
+const (
+	intervalParam   = "interval"
+	topologiesParam = "topologies"
+)
+
+// publishFilter is what a probe publishes to one of its targets, as set by
+// the query of its URL: reports no more often than every interval, as in
+// ?interval=15s, and only the topologies listed, as in
+// ?topologies=host,container, so a central app can be sent less than one
+// next to the probe. The zero publishFilter publishes everything.
+type publishFilter struct {
+	interval   time.Duration
+	topologies []string
+
+	// only touched by PublishDelta
+	next        time.Time      // when the next report is due
+	previous    *report.Report // filtered, as last published
+	previousSeq uint64
+}
+
+// parsePublishFilter parses the publishFilter of the target, returning it
+// and the target without its parameters.
+func parsePublishFilter(target url.URL) (publishFilter, url.URL, error) {
+	var filter publishFilter
+	query := target.Query()
+	if value := query.Get(intervalParam); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			return filter, target, fmt.Errorf("invalid %s %q for %s", intervalParam, value, target.Host)
+		}
+		filter.interval = interval
+	}
+	if value := query.Get(topologiesParam); value != "" {
+		filter.topologies = strings.Split(value, ",")
+	}
+	query.Del(intervalParam)
+	query.Del(topologiesParam)
+	target.RawQuery = query.Encode()
+	return filter, target, nil
+}
+
+// due tells whether a report is due at now. Reports are due a tenth of the
+// interval early, so an interval the probe's divides still gets a report
+// every interval, rather than every other.
+func (f *publishFilter) due(now time.Time) bool {
+	if f.interval == 0 {
+		return true
+	}
+	if now.Add(f.interval / 10).Before(f.next) {
+		return false
+	}
+	f.next = now.Add(f.interval)
+	return true
+}
+
+// filter returns the publication with what's due to be published, and
+// whether anything is.
+func (f *publishFilter) filter(pub Publication, now time.Time) (Publication, bool, error) {
+	if !pub.Shortcut && !f.due(now) {
+		return pub, false, nil
+	}
+	if len(f.topologies) == 0 {
+		return pub, true, nil
+	}
+
+	rpt, err := pub.report()
+	if err != nil {
+		return pub, false, err
+	}
+	filtered := rpt.OnlyTopologies(f.topologies)
+	result := Publication{
+		Seq:      pub.Seq,
+		Shortcut: pub.Shortcut,
+		Report:   func() (report.Report, error) { return filtered, nil },
+		Whole: serialiseOnce(func(w io.Writer, encoding string) error {
+			return filtered.WriteEncoded(w, report.MsgpackContentType, encoding)
+		}),
+		Protobuf: serialiseOnce(func(w io.Writer, encoding string) error {
+			return filtered.WriteEncoded(w, report.ProtobufContentType, encoding)
+		}),
+	}
+	if !pub.Shortcut {
+		// Deltas are on the report filtered as it was last published
+		if pub.Delta != nil && f.previous != nil && pub.Seq == f.previousSeq+1 {
+			previous := *f.previous
+			result.Delta = serialiseOnce(func(w io.Writer, encoding string) error {
+				return report.MakeDelta(previous, filtered).WriteEncoded(w, encoding)
+			})
+		}
+		f.previous = &filtered
+		f.previousSeq = pub.Seq
+	}
+	return result, true, nil
+}
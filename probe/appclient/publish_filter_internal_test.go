@@ -0,0 +1,75 @@
+package appclient
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestParsePublishFilter(t *testing.T) {
+	target, _ := url.Parse("https://central.example.com/scope?interval=15s&topologies=host,container&org=foo")
+	filter, target2, err := parsePublishFilter(*target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.interval != 15*time.Second || !reflect.DeepEqual([]string{"host", "container"}, filter.topologies) {
+		t.Errorf("Unexpected filter: %+v", filter)
+	}
+	if want := "https://central.example.com/scope?org=foo"; target2.String() != want {
+		t.Errorf("Expected %s, got %s", want, target2.String())
+	}
+
+	if _, err := ParseTargets([]string{"localhost:4040?interval=often"}); err == nil {
+		t.Error("Expected an invalid interval to be an error")
+	}
+}
+
+func TestPublishFilter(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host1"))
+	rpt.Process.AddNode(report.MakeNode("process1"))
+	publication := func(seq uint64, delta bool) Publication {
+		pub := Publication{
+			Seq:    seq,
+			Report: func() (report.Report, error) { return rpt, nil },
+		}
+		if delta {
+			pub.Delta = func(string) ([]byte, error) { return nil, nil }
+		}
+		return pub
+	}
+
+	f := publishFilter{interval: 10 * time.Second, topologies: []string{report.Host}}
+	now := time.Now()
+	pub, due, err := f.filter(publication(1, false), now)
+	if err != nil || !due {
+		t.Fatalf("Expected the first report to be due, got %v, %v", due, err)
+	}
+	filtered, _ := pub.Report()
+	if len(filtered.Host.Nodes) != 1 || len(filtered.Process.Nodes) != 0 {
+		t.Errorf("Expected only the host topology, got %v", filtered)
+	}
+	if len(rpt.Process.Nodes) != 1 {
+		t.Error("Expected the report itself to be left alone")
+	}
+
+	// Reports are skipped until the interval is up, or nearly
+	if _, due, _ := f.filter(publication(2, true), now.Add(3*time.Second)); due {
+		t.Error("Expected the report not to be due")
+	}
+	pub, due, _ = f.filter(publication(3, true), now.Add(9500*time.Millisecond))
+	if !due {
+		t.Error("Expected the report to be due")
+	}
+	// And, not following on from the one published before, are whole
+	if pub.Delta != nil {
+		t.Error("Expected no delta on a report skipped")
+	}
+	pub, _, _ = f.filter(publication(4, true), now.Add(20*time.Second))
+	if pub.Delta == nil {
+		t.Error("Expected a delta on the report published before")
+	}
+}
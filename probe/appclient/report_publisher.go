@@ -3,14 +3,77 @@ package appclient
 import (
 	"bytes"
 	"compress/gzip"
+	"io"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/report"
 )
 
+// fullSyncInterval is how often publishers which take deltas get a whole
+// report anyway, in reports.
+const fullSyncInterval = 20
+
 // A ReportPublisher uses a buffer pool to serialise reports, which it
 // then passes to a publisher
 type ReportPublisher struct {
 	publisher  Publisher
 	noControls bool
+
+	// For publishers which take deltas
+	previous *report.Report
+	seq      uint64
+}
+
+// A DeltaPublisher is a Publisher which can publish reports as deltas on
+// the ones published before them.
+type DeltaPublisher interface {
+	Publisher
+	PublishDelta(Publication) error
+}
+
+// A FeatureNegotiator is a Publisher which knows the report features of
+// the apps it publishes to. Publishers which don't are sent reports with
+// node controls as older apps take them.
+type FeatureNegotiator interface {
+	ReportFeatures() []string
+}
+
+// A Publication is a report, which publishers serialise as they need it:
+// whole, or as a delta on the report published before it. Reports other
+// than shortcut ones are numbered by Seq, from 1, and those with a Delta can
+// be published as such to where report Seq-1 was. Whole is msgpack; apps
+// which take protobuf may be sent Protobuf instead, if there is one. All
+// of them are compressed with the encoding they are asked for. Report, if
+// set, is the report itself, for publishers which filter it. Trace is the
+// span of publishing it, if it's traced, which posting it to each app is
+// part of.
+type Publication struct {
+	Seq      uint64
+	Shortcut bool
+	Report   func() (report.Report, error)
+	Whole    func(encoding string) ([]byte, error)
+	Protobuf func(encoding string) ([]byte, error)
+	Delta    func(encoding string) ([]byte, error)
+	Trace    opentracing.SpanContext
+}
+
+// report returns the report of the publication, decoding it if need be.
+func (p Publication) report() (report.Report, error) {
+	if p.Report != nil {
+		return p.Report()
+	}
+	buf, err := p.Whole(report.GzipEncoding)
+	if err != nil {
+		return report.Report{}, err
+	}
+	rpt, err := report.MakeFromBytes(buf)
+	if err != nil {
+		return report.Report{}, err
+	}
+	return *rpt, nil
 }
 
 // NewReportPublisher creates a new report publisher
@@ -21,14 +84,80 @@ func NewReportPublisher(publisher Publisher, noControls bool) *ReportPublisher {
 	}
 }
 
-// Publish serialises and compresses a report, then passes it to a publisher
-func (p *ReportPublisher) Publish(r report.Report) error {
+// Publish serialises and compresses a report, then passes it to a
+// publisher. Publishing it follows from the spans of making the reports it
+// was merged from, in follows.
+func (p *ReportPublisher) Publish(r report.Report, follows ...opentracing.SpanContext) (err error) {
+	opts := []opentracing.StartSpanOption{}
+	for _, trace := range follows {
+		opts = append(opts, opentracing.FollowsFrom(trace))
+	}
+	span := opentracing.StartSpan("probe.publish", opts...)
+	defer func() {
+		tracing.SetError(span, err)
+		span.Finish()
+	}()
+
 	if p.noControls {
 		r.WalkTopologies(func(t *report.Topology) {
 			t.Controls = report.Controls{}
 		})
 	}
-	buf := &bytes.Buffer{}
-	r.WriteBinary(buf, gzip.DefaultCompression)
-	return p.publisher.Publish(buf, r.Shortcut)
+	if fn, ok := p.publisher.(FeatureNegotiator); ok {
+		r = r.ForFeatures(fn.ReportFeatures())
+	} else {
+		r = r.BackwardCompatible()
+	}
+	dp, ok := p.publisher.(DeltaPublisher)
+	if !ok {
+		buf := &bytes.Buffer{}
+		r.WriteBinary(buf, gzip.DefaultCompression)
+		return p.publisher.Publish(buf, r.Shortcut)
+	}
+
+	pub := Publication{
+		Trace:    span.Context(),
+		Shortcut: r.Shortcut,
+		Report:   func() (report.Report, error) { return r, nil },
+		Whole: serialiseOnce(func(w io.Writer, encoding string) error {
+			return r.WriteEncoded(w, report.MsgpackContentType, encoding)
+		}),
+		Protobuf: serialiseOnce(func(w io.Writer, encoding string) error {
+			return r.WriteEncoded(w, report.ProtobufContentType, encoding)
+		}),
+	}
+	if !r.Shortcut {
+		p.seq++
+		pub.Seq = p.seq
+		if p.previous != nil && p.seq%fullSyncInterval != 0 {
+			previous := *p.previous
+			pub.Delta = serialiseOnce(func(w io.Writer, encoding string) error {
+				return report.MakeDelta(previous, r).WriteEncoded(w, encoding)
+			})
+		}
+		p.previous = &r
+	}
+	return dp.PublishDelta(pub)
+}
+
+// serialiseOnce returns a function which serialises with write the first
+// time it's called for each encoding, for publishers to share.
+func serialiseOnce(write func(io.Writer, string) error) func(string) ([]byte, error) {
+	var (
+		mtx  sync.Mutex
+		bufs = map[string][]byte{}
+	)
+	return func(encoding string) ([]byte, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if buf, ok := bufs[encoding]; ok {
+			return buf, nil
+		}
+		var buf bytes.Buffer
+		if err := write(&buf, encoding); err != nil {
+			return nil, err
+		}
+		bufs[encoding] = buf.Bytes()
+		return buf.Bytes(), nil
+	}
 }
@@ -0,0 +1,65 @@
+package appclient
+
+import (
+	"io"
+	"testing"
+
+	"github.com/weaveworks/scope/report"
+)
+
+type recordingDeltaPublisher struct {
+	publications []Publication
+}
+
+func (p *recordingDeltaPublisher) Publish(io.Reader, bool) error { return nil }
+func (p *recordingDeltaPublisher) Stop()                         {}
+
+func (p *recordingDeltaPublisher) PublishDelta(pub Publication) error {
+	p.publications = append(p.publications, pub)
+	return nil
+}
+
+func TestReportPublisherDeltas(t *testing.T) {
+	publisher := &recordingDeltaPublisher{}
+	rp := NewReportPublisher(publisher, false)
+
+	shortcut := report.MakeReport()
+	shortcut.Shortcut = true
+	for i := 0; i < fullSyncInterval; i++ {
+		rpt := report.MakeReport()
+		rpt.Container.AddNode(report.MakeNode("a"))
+		if err := rp.Publish(rpt); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := rp.Publish(shortcut); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	pubs := publisher.publications
+	if pubs[0].Seq != 1 || pubs[0].Delta != nil {
+		t.Errorf("Expected the first report to be whole, got %d", pubs[0].Seq)
+	}
+	if !pubs[1].Shortcut || pubs[1].Seq != 0 || pubs[1].Delta != nil {
+		t.Errorf("Expected shortcut reports to be whole and unnumbered")
+	}
+	if pubs[2].Seq != 2 || pubs[2].Delta == nil {
+		t.Fatalf("Expected the second report to come with a delta")
+	}
+	buf, err := pubs[2].Delta(report.GzipEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := report.MakeDeltaFromBytes(buf, report.GzipEncoding, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta.Report.Container.Nodes) != 0 {
+		t.Errorf("Expected unchanged nodes to be left out of the delta, got %v", delta.Report.Container.Nodes)
+	}
+	if last := pubs[len(pubs)-1]; last.Seq != fullSyncInterval || last.Delta != nil {
+		t.Errorf("Expected a full sync every %d reports", fullSyncInterval)
+	}
+}
@@ -0,0 +1,192 @@
+package appclient
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// reportStream is an open stream to the report stream of an app.
+type reportStream struct {
+	target url.URL
+	conn   *grpc.ClientConn
+	stream xfer.ReportStreamPublishClient
+	cancel context.CancelFunc
+	seq    uint64 // of the report deltas apply to on the app, if any
+}
+
+// useReportStream is whether to publish over the report stream of the app,
+// rather than POSTing reports.
+func (c *appClient) useReportStream() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.ProbeConfig.ReportStream && c.reportStreamPort != 0
+}
+
+// openReportStream connects to the report stream of the app, on the host we
+// target, with the headers we would POST reports with.
+func (c *appClient) openReportStream() (*reportStream, error) {
+	c.mtx.Lock()
+	target, port := c.target, c.reportStreamPort
+	c.mtx.Unlock()
+
+	host, _, err := net.SplitHostPort(target.Host)
+	if err != nil {
+		host = target.Host
+	}
+	creds := grpc.WithInsecure()
+	if target.Scheme == "https" {
+		tlsConfig := c.client.Transport.(*http.Transport).TLSClientConfig
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig.Clone()))
+	}
+	conn, err := xfer.DialReportStream(net.JoinHostPort(host, strconv.Itoa(port)),
+		creds,
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, dialTimeout)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	c.ProbeConfig.authorizeHeaders(headers)
+	md := metadata.MD{}
+	for k, vs := range headers {
+		md[strings.ToLower(k)] = vs
+	}
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+	stream, err := xfer.OpenReportStream(ctx, conn)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+	return &reportStream{target: target, conn: conn, stream: stream, cancel: cancel}, nil
+}
+
+// publishStream sends a report down the report stream, opening it if need
+// be, as a delta if the app has the report before it. The stream is dropped
+// on errors, to be opened afresh, and sent a whole report, on the next one.
+func (c *appClient) publishStream(pub Publication, span opentracing.SpanContext) error {
+	var err error
+	if c.reportStream != nil && c.reportStream.target != c.Target() {
+		// We've been re-targeted
+		c.closeReportStream()
+	}
+	if c.reportStream == nil {
+		if c.reportStream, err = c.openReportStream(); err != nil {
+			return err
+		}
+	}
+	msg := &xfer.ReportMessage{}
+	if pub.Delta != nil && c.reportStream.seq != 0 && pub.Seq == c.reportStream.seq+1 {
+		msg.Delta = true
+		msg.Encoding = c.reportEncoding()
+		msg.Report, err = pub.Delta(msg.Encoding)
+	} else {
+		msg.ContentType, msg.Encoding, msg.Report, err = c.serialise(pub)
+	}
+	if err != nil {
+		return err
+	}
+	if c.Signer != nil {
+		msg.Signature = c.Signer.SignReport(msg.Report)
+	}
+	if span != nil {
+		msg.Trace = map[string]string{}
+		opentracing.GlobalTracer().Inject(span, opentracing.TextMap, opentracing.TextMapCarrier(msg.Trace))
+	}
+	err = c.reportStream.stream.Send(msg)
+	if err == io.EOF {
+		// The app ended the stream; its reason comes with the summary
+		if _, err = c.reportStream.stream.CloseAndRecv(); err == nil {
+			err = fmt.Errorf("report stream closed by the app")
+		}
+	}
+	if err != nil {
+		if grpc.Code(err) == codes.ResourceExhausted {
+			err = overloadedError{retryAfter: parseRetryAfter(trailer(c.reportStream.stream.Trailer(), xfer.RetryAfterTrailer))}
+		}
+		c.closeReportStream()
+		return err
+	}
+	// The app applies deltas to the last report which isn't a shortcut
+	if !pub.Shortcut {
+		c.reportStream.seq = pub.Seq
+	}
+	return nil
+}
+
+// replayStream sends the reports spilled while the app was unreachable down
+// a report stream of their own, leaving the one reports are published on,
+// and the report deltas apply to there, alone.
+func (c *appClient) replayStream() error {
+	stream, err := c.openReportStream()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stream.cancel()
+		stream.conn.Close()
+	}()
+	err = c.spill.replay(func(made time.Time, buf []byte) error {
+		if c.hasQuit() {
+			return fmt.Errorf("stopped")
+		}
+		msg := &xfer.ReportMessage{
+			Report:      buf,
+			ContentType: report.MsgpackContentType,
+			Encoding:    report.GzipEncoding,
+			Replayed:    made.UnixNano(),
+		}
+		if c.Signer != nil {
+			msg.Signature = c.Signer.SignReport(buf)
+		}
+		return stream.stream.Send(msg)
+	})
+	if err == nil || err == io.EOF {
+		// The app's reason for ending the stream, if it did, comes with
+		// the summary
+		if _, recvErr := stream.stream.CloseAndRecv(); recvErr != nil {
+			err = recvErr
+		} else if err == io.EOF {
+			err = fmt.Errorf("report stream closed by the app")
+		}
+	}
+	return err
+}
+
+// closeReportStream ends the report stream, if it is open.
+func (c *appClient) closeReportStream() {
+	if c.reportStream == nil {
+		return
+	}
+	c.reportStream.stream.CloseSend()
+	c.reportStream.cancel()
+	c.reportStream.conn.Close()
+	c.reportStream = nil
+}
+
+// trailer returns the first value of the key of the trailer, if any.
+func trailer(md metadata.MD, key string) string {
+	if values := md[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
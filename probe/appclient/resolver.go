@@ -1,6 +1,7 @@
 package appclient
 
 import (
+	"fmt"
 	"net"
 	"net/url"
 	"strconv"
@@ -15,6 +16,16 @@ import (
 
 const (
 	dnsPollInterval = 10 * time.Second
+
+	// SRVDiscovery is the Discovery of targets whose apps are found by the
+	// DNS SRV records of their name, as in srv+https://_scope._tcp.example.com
+	SRVDiscovery = "srv"
+	// KubernetesDiscovery is the Discovery of targets whose apps are found
+	// by the endpoints of a Kubernetes service, on a port by name or number,
+	// as in kubernetes+http://weave-scope-app.weave?port=app
+	KubernetesDiscovery = "kubernetes"
+
+	servicePortParam = "port"
 )
 
 // fastStartTicker is a ticker that 'ramps up' from 1 sec to duration.
@@ -55,24 +66,42 @@ type LookupIP func(host string) (ips []net.IP, err error)
 
 // Target is a parsed representation of the app location.
 type Target struct {
-	original string   // the original url string
-	url      *url.URL // the parsed url
-	hostname string   // the hostname (without port) from the url
-	port     int      // the port, or a sensible default
+	original  string   // the original url string
+	url       *url.URL // the parsed url
+	hostname  string   // the hostname (without port) from the url
+	port      int      // the port, or a sensible default
+	discovery string   // how apps are found, if not by the hostname's A records
+
+	// of targets with KubernetesDiscovery
+	service, namespace, servicePort string
 }
 
 func (t Target) String() string {
+	if t.discovery != "" {
+		return t.discovery + "://" + t.hostname
+	}
 	return net.JoinHostPort(t.hostname, strconv.Itoa(t.port))
 }
 
+// Discovery is how the apps of the target are found: SRVDiscovery,
+// KubernetesDiscovery, or "" for the A records of its hostname.
+func (t Target) Discovery() string {
+	return t.discovery
+}
+
 // ResolverConfig is the config for a resolver.
 type ResolverConfig struct {
 	Targets []Target
 	Set     func(string, []url.URL)
 
 	// Optional
-	Lookup LookupIP
-	Ticker func(time.Duration) <-chan time.Time
+	Lookup    LookupIP
+	LookupSRV func(name string) ([]*net.SRV, error)
+	Ticker    func(time.Duration) <-chan time.Time
+
+	// LookupService returns the addresses, as host:port, of the endpoints
+	// of Kubernetes services, for targets with KubernetesDiscovery.
+	LookupService func(namespace, name, port string) ([]string, error)
 }
 
 // NewResolver periodically resolves the targets, and calls the set
@@ -82,6 +111,12 @@ func NewResolver(config ResolverConfig) (Resolver, error) {
 	if config.Lookup == nil {
 		config.Lookup = net.LookupIP
 	}
+	if config.LookupSRV == nil {
+		config.LookupSRV = func(name string) ([]*net.SRV, error) {
+			_, addrs, err := net.LookupSRV("", "", name)
+			return addrs, err
+		}
+	}
 	if config.Ticker == nil {
 		config.Ticker = fastStartTicker
 	}
@@ -116,6 +151,34 @@ func LookupUsing(dnsServer string) func(host string) (ips []net.IP, err error) {
 	}
 }
 
+// LookupSRVUsing produces a function looking up SRV records with the given
+// DNS server.
+func LookupSRVUsing(dnsServer string) func(name string) ([]*net.SRV, error) {
+	client := dns.Client{
+		Net: "tcp",
+	}
+	return func(name string) ([]*net.SRV, error) {
+		m := &dns.Msg{}
+		m.SetQuestion(dns.Fqdn(name), dns.TypeSRV)
+		in, _, err := client.Exchange(m, dnsServer)
+		if err != nil {
+			return nil, err
+		}
+		result := []*net.SRV{}
+		for _, answer := range in.Answer {
+			if srv, ok := answer.(*dns.SRV); ok {
+				result = append(result, &net.SRV{
+					Target:   srv.Target,
+					Port:     srv.Port,
+					Priority: srv.Priority,
+					Weight:   srv.Weight,
+				})
+			}
+		}
+		return result, nil
+	}
+}
+
 func (r staticResolver) loop() {
 	r.resolve()
 	t := r.Ticker(dnsPollInterval)
@@ -138,6 +201,15 @@ func (r staticResolver) Stop() {
 func ParseTargets(urls []string) ([]Target, error) {
 	var targets []Target
 	for _, u := range urls {
+		if discovery, scheme, ok := discoveryScheme(u); ok {
+			target, err := parseDiscoveryTarget(u, discovery, scheme)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+			continue
+		}
+
 		// naked hostnames (such as "localhost") are interpreted as relative URLs
 		// so we add a scheme if u doesn't have one.
 		prefixAdded := false
@@ -153,6 +225,9 @@ func ParseTargets(urls []string) ([]Target, error) {
 		if err != nil {
 			return nil, err
 		}
+		if _, _, err := parsePublishFilter(*parsed); err != nil {
+			return nil, err
+		}
 
 		var hostname string
 		var port int
@@ -186,10 +261,66 @@ func ParseTargets(urls []string) ([]Target, error) {
 	return targets, nil
 }
 
+// discoveryScheme splits schemes like srv+https into how apps are
+// discovered and the scheme of their URLs, http by default.
+func discoveryScheme(u string) (discovery, scheme string, ok bool) {
+	i := strings.Index(u, "://")
+	if i < 0 {
+		return "", "", false
+	}
+	parts := strings.SplitN(u[:i], "+", 2)
+	if parts[0] != SRVDiscovery && parts[0] != KubernetesDiscovery {
+		return "", "", false
+	}
+	if len(parts) == 1 {
+		return parts[0], "http", true
+	}
+	return parts[0], parts[1], true
+}
+
+func parseDiscoveryTarget(u, discovery, scheme string) (Target, error) {
+	parsed, err := url.Parse(scheme + u[strings.Index(u, "://"):])
+	if err != nil {
+		return Target{}, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return Target{}, fmt.Errorf("invalid scheme %q of %s", parsed.Scheme, u)
+	}
+	if _, _, err := parsePublishFilter(*parsed); err != nil {
+		return Target{}, err
+	}
+	target := Target{
+		original:  u,
+		url:       parsed,
+		hostname:  parsed.Hostname(),
+		discovery: discovery,
+	}
+	if discovery == KubernetesDiscovery {
+		// service.namespace, in the default namespace if there's no namespace
+		parts := strings.SplitN(target.hostname, ".", 2)
+		target.service, target.namespace = parts[0], "default"
+		if len(parts) == 2 {
+			target.namespace = parts[1]
+		}
+		query := parsed.Query()
+		target.servicePort = query.Get(servicePortParam)
+		query.Del(servicePortParam)
+		parsed.RawQuery = query.Encode()
+	}
+	return target, nil
+}
+
 func (r staticResolver) resolve() {
 	for _, t := range r.Targets {
-		ips := r.resolveOne(t)
-		urls := makeURLs(t, ips)
+		var urls []url.URL
+		switch t.discovery {
+		case SRVDiscovery:
+			urls = r.resolveSRV(t)
+		case KubernetesDiscovery:
+			urls = r.resolveService(t)
+		default:
+			urls = makeURLs(t, r.resolveOne(t.hostname))
+		}
 		r.Set(t.hostname, urls)
 	}
 }
@@ -197,30 +328,79 @@ func (r staticResolver) resolve() {
 func makeURLs(t Target, ips []string) []url.URL {
 	result := []url.URL{}
 	for _, ip := range ips {
-		u := *t.url
-		u.Host = net.JoinHostPort(ip, strconv.Itoa(t.port))
-		result = append(result, u)
+		result = append(result, makeURL(t, net.JoinHostPort(ip, strconv.Itoa(t.port))))
+	}
+	return result
+}
+
+func makeURL(t Target, host string) url.URL {
+	u := *t.url
+	u.Host = host
+	return u
+}
+
+// resolveSRV returns the URLs of the targets of the SRV records of the
+// target, on their ports.
+func (r staticResolver) resolveSRV(t Target) []url.URL {
+	records, err := r.LookupSRV(t.hostname)
+	if !r.resolved(t.hostname, err) {
+		return []url.URL{}
+	}
+	result := []url.URL{}
+	for _, record := range records {
+		for _, ip := range r.resolveOne(strings.TrimSuffix(record.Target, ".")) {
+			result = append(result, makeURL(t, net.JoinHostPort(ip, strconv.Itoa(int(record.Port)))))
+		}
 	}
 	return result
 }
 
-func (r staticResolver) resolveOne(t Target) []string {
+// resolveService returns the URLs of the endpoints of the Kubernetes
+// service of the target.
+func (r staticResolver) resolveService(t Target) []url.URL {
+	var (
+		addrs []string
+		err   = fmt.Errorf("no Kubernetes API server to look services up in")
+	)
+	if r.LookupService != nil {
+		addrs, err = r.LookupService(t.namespace, t.service, t.servicePort)
+	}
+	if !r.resolved(t.hostname, err) {
+		return []url.URL{}
+	}
+	result := []url.URL{}
+	for _, addr := range addrs {
+		result = append(result, makeURL(t, addr))
+	}
+	return result
+}
+
+// resolved tells whether the name was resolved, logging the error if it
+// wasn't, once until it is again.
+func (r staticResolver) resolved(name string, err error) bool {
+	if err != nil {
+		if _, ok := r.failedResolutions[name]; !ok {
+			log.Warnf("Cannot resolve '%s': %v", name, err)
+			// Only log the error once
+			r.failedResolutions[name] = struct{}{}
+		}
+		return false
+	}
+	// Allow logging errors in future resolutions
+	delete(r.failedResolutions, name)
+	return true
+}
+
+func (r staticResolver) resolveOne(hostname string) []string {
 	var addrs []net.IP
-	if addr := net.ParseIP(t.hostname); addr != nil {
+	if addr := net.ParseIP(hostname); addr != nil {
 		addrs = []net.IP{addr}
 	} else {
 		var err error
-		addrs, err = r.Lookup(t.hostname)
-		if err != nil {
-			if _, ok := r.failedResolutions[t.hostname]; !ok {
-				log.Warnf("Cannot resolve '%s': %v", t.hostname, err)
-				// Only log the error once
-				r.failedResolutions[t.hostname] = struct{}{}
-			}
+		addrs, err = r.Lookup(hostname)
+		if !r.resolved(hostname, err) {
 			return []string{}
 		}
-		// Allow logging errors in future resolutions
-		delete(r.failedResolutions, t.hostname)
 	}
 	endpoints := make([]string, 0, len(addrs))
 	for _, addr := range addrs {
@@ -206,3 +206,77 @@ func makeIPs(addrs ...string) []net.IP {
 	}
 	return ips
 }
+
+func TestResolverDiscovery(t *testing.T) {
+	c := make(chan time.Time)
+	ticker := func(_ time.Duration) <-chan time.Time { return c }
+
+	lookupIP := func(host string) ([]net.IP, error) {
+		if host != "app1.example.com" {
+			return nil, fmt.Errorf("Not found")
+		}
+		return makeIPs("192.168.0.1", "192.168.0.2"), nil
+	}
+	lookupSRV := func(name string) ([]*net.SRV, error) {
+		if name != "_scope._tcp.example.com" {
+			return nil, fmt.Errorf("Not found")
+		}
+		return []*net.SRV{{Target: "app1.example.com.", Port: 4040}}, nil
+	}
+	lookupService := func(namespace, name, port string) ([]string, error) {
+		if namespace != "weave" || name != "weave-scope-app" || port != "app" {
+			return nil, fmt.Errorf("Not found")
+		}
+		return []string{"10.32.0.1:4040", "10.32.0.2:4040"}, nil
+	}
+
+	targets, err := ParseTargets([]string{"srv+https://_scope._tcp.example.com", "kubernetes://weave-scope-app.weave?port=app&interval=15s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[0].Discovery() != SRVDiscovery || targets[1].Discovery() != KubernetesDiscovery {
+		t.Fatalf("Unexpected discovery of targets: %v", targets)
+	}
+	if _, err := ParseTargets([]string{"srv+ftp://_scope._tcp.example.com"}); err == nil {
+		t.Error("Expected a scheme other than http(s) to be an error")
+	}
+
+	mtx := sync.Mutex{}
+	found := map[string][]url.URL{}
+	r, err := NewResolver(ResolverConfig{
+		Targets:       targets,
+		Lookup:        lookupIP,
+		LookupSRV:     lookupSRV,
+		LookupService: lookupService,
+		Ticker:        ticker,
+		Set: func(hostname string, urls []url.URL) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			found[hostname] = urls
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	expected := map[string][]url.URL{
+		"_scope._tcp.example.com": {
+			{Scheme: "https", Host: "192.168.0.1:4040"},
+			{Scheme: "https", Host: "192.168.0.2:4040"},
+		},
+		"weave-scope-app.weave": {
+			{Scheme: "http", Host: "10.32.0.1:4040", RawQuery: "interval=15s"},
+			{Scheme: "http", Host: "10.32.0.2:4040", RawQuery: "interval=15s"},
+		},
+	}
+	test.Poll(t, 200*time.Millisecond, expected, func() interface{} {
+		mtx.Lock()
+		defer mtx.Unlock()
+		result := map[string][]url.URL{}
+		for hostname, urls := range found {
+			result[hostname] = urls
+		}
+		return result
+	})
+}
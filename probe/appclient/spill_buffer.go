@@ -0,0 +1,164 @@
+package appclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultSpillBytes is how much of the disk a probe spills reports to,
+	// per app, unless configured otherwise.
+	DefaultSpillBytes = 64 * 1024 * 1024
+	// DefaultSpillMaxAge is how old spilled reports get before they are
+	// dropped rather than replayed, unless configured otherwise.
+	DefaultSpillMaxAge = 15 * time.Minute
+
+	spillSuffix = ".msgpack.gz"
+)
+
+// spillBuffer is a ring buffer on disk of the reports a probe couldn't
+// publish to an app, as gzipped msgpack files named by when they were
+// made, so they can be replayed once the app is reachable again, rather
+// than leaving a gap in its topologies. The oldest reports make way for
+// new ones once the buffer is full, and reports past their age are
+// dropped, as an app would not show them anyway.
+type spillBuffer struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mtx sync.Mutex
+}
+
+// newSpillBuffer makes a spillBuffer in dir, which holds on to the reports
+// spilled there before the probe was restarted.
+func newSpillBuffer(dir string, maxBytes int64, maxAge time.Duration) (*spillBuffer, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpillBytes
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultSpillMaxAge
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &spillBuffer{dir: dir, maxBytes: maxBytes, maxAge: maxAge}, nil
+}
+
+// spilledReport is a report in the buffer.
+type spilledReport struct {
+	path string
+	made time.Time
+	size int64
+}
+
+// reports returns the reports in the buffer, oldest first.
+func (s *spillBuffer) reports() ([]spilledReport, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []spilledReport
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, spillSuffix) {
+			continue
+		}
+		ns, err := strconv.ParseInt(strings.TrimSuffix(name, spillSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		result = append(result, spilledReport{
+			path: filepath.Join(s.dir, name),
+			made: time.Unix(0, ns),
+			size: info.Size(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].made.Before(result[j].made) })
+	return result, nil
+}
+
+// spill writes the report, made at the time, to the buffer, dropping the
+// oldest reports to make room for it.
+func (s *spillBuffer) spill(made time.Time, buf []byte) error {
+	if int64(len(buf)) > s.maxBytes {
+		return fmt.Errorf("report of %d bytes is too big to spill", len(buf))
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Write it whole, or not at all, as probes may be killed any time
+	path := filepath.Join(s.dir, strconv.FormatInt(made.UnixNano(), 10)+spillSuffix)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	reports, err := s.reports()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, r := range reports {
+		total += r.size
+	}
+	for _, r := range reports {
+		if total <= s.maxBytes {
+			break
+		}
+		log.Warnf("Spilled reports over %d bytes, dropping the one of %s", s.maxBytes, r.made)
+		if err := os.Remove(r.path); err != nil {
+			return err
+		}
+		total -= r.size
+	}
+	return nil
+}
+
+// replay passes the reports in the buffer to publish, oldest first,
+// dropping them once they are published, or too old. It stops at the
+// first report publish fails, leaving it for the next replay. Reports are
+// published without holding up those spilled meanwhile, which may drop
+// the oldest of them before they are replayed.
+func (s *spillBuffer) replay(publish func(made time.Time, buf []byte) error) error {
+	s.mtx.Lock()
+	reports, err := s.reports()
+	s.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+	oldest := time.Now().Add(-s.maxAge)
+	for _, r := range reports {
+		if r.made.Before(oldest) {
+			os.Remove(r.path)
+			continue
+		}
+		buf, err := ioutil.ReadFile(r.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := publish(r.made, buf); err != nil {
+			return err
+		}
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package appclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpillBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newSpillBuffer(dir, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, buf := range []string{"aaaa", "bbbb", "cccc"} {
+		if err := s.spill(now.Add(time.Duration(i)*time.Second), []byte(buf)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.spill(now, []byte("too big to spill")); err == nil {
+		t.Error("Expected a report over the buffer to not be spilled")
+	}
+
+	// The oldest report made way, and a failed publish stops the replay
+	var (
+		replayed    []string
+		unreachable = true
+	)
+	publish := func(made time.Time, buf []byte) error {
+		if string(buf) == "cccc" && unreachable {
+			unreachable = false
+			return fmt.Errorf("unreachable")
+		}
+		replayed = append(replayed, string(buf))
+		return nil
+	}
+	if err := s.replay(publish); err == nil {
+		t.Error("Expected the replay to fail")
+	}
+	if err := s.replay(publish); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bbbb", "cccc"}; !reflect.DeepEqual(want, replayed) {
+		t.Errorf("Expected %v replayed, got %v", want, replayed)
+	}
+
+	// Reports too old are dropped, rather than replayed
+	if err := s.spill(now.Add(-time.Hour), []byte("dddd")); err != nil {
+		t.Fatal(err)
+	}
+	replayed = nil
+	if err := s.replay(publish); err != nil {
+		t.Fatal(err)
+	}
+	if reports, _ := s.reports(); len(replayed) != 0 || len(reports) != 0 {
+		t.Errorf("Expected the old report dropped, got %v replayed, %d left", replayed, len(reports))
+	}
+}
@@ -0,0 +1,107 @@
+package awsecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const agentTimeout = 1 * time.Second
+
+// AgentContainer is a container of an AgentTask. Exported for test.
+type AgentContainer struct {
+	DockerID string `json:"DockerId"`
+	Name     string `json:"Name"`
+}
+
+// AgentTask is a task as described by the ECS agent introspection API.
+// Exported for test.
+type AgentTask struct {
+	Arn           string           `json:"Arn"`
+	DesiredStatus string           `json:"DesiredStatus"`
+	KnownStatus   string           `json:"KnownStatus"`
+	Family        string           `json:"Family"`
+	Containers    []AgentContainer `json:"Containers"`
+}
+
+// AgentInfo is what the ECS agent on this instance knows about. Exported
+// for test.
+type AgentInfo struct {
+	Cluster string
+	Tasks   []AgentTask
+}
+
+var agentHTTPClient = &http.Client{Timeout: agentTimeout}
+
+func getAgentJSON(url string, v interface{}) error {
+	resp, err := agentHTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GetAgentInfo queries the introspection API of the ECS agent at agentURL
+// (it's just exported for testing)
+var GetAgentInfo = func(agentURL string) (AgentInfo, error) {
+	var metadata struct {
+		Cluster string `json:"Cluster"`
+	}
+	if err := getAgentJSON(agentURL+"/v1/metadata", &metadata); err != nil {
+		return AgentInfo{}, err
+	}
+	var tasks struct {
+		Tasks []AgentTask `json:"Tasks"`
+	}
+	if err := getAgentJSON(agentURL+"/v1/tasks", &tasks); err != nil {
+		return AgentInfo{}, err
+	}
+	return AgentInfo{Cluster: metadata.Cluster, Tasks: tasks.Tasks}, nil
+}
+
+// addAgentInfo adds the tasks known to the agent to labelInfo, so that we
+// find the task of containers which lack the ECS labels. It returns the
+// agent's tasks by ARN.
+func addAgentInfo(rpt report.Report, labelInfo map[string]map[string]*TaskLabelInfo, info AgentInfo) map[string]AgentTask {
+	labelled := map[string]struct{}{}
+	for _, taskMap := range labelInfo {
+		for _, task := range taskMap {
+			for _, containerID := range task.ContainerIDs {
+				labelled[containerID] = struct{}{}
+			}
+		}
+	}
+
+	tasks := map[string]AgentTask{}
+	for _, agentTask := range info.Tasks {
+		tasks[agentTask.Arn] = agentTask
+		for _, c := range agentTask.Containers {
+			containerID := report.MakeContainerNodeID(c.DockerID)
+			if _, ok := labelled[containerID]; ok {
+				continue
+			}
+			if _, ok := rpt.Container.Nodes[containerID]; !ok {
+				continue
+			}
+			taskMap, ok := labelInfo[info.Cluster]
+			if !ok {
+				taskMap = map[string]*TaskLabelInfo{}
+				labelInfo[info.Cluster] = taskMap
+			}
+			task, ok := taskMap[agentTask.Arn]
+			if !ok {
+				task = &TaskLabelInfo{ContainerIDs: []string{}, Family: agentTask.Family}
+				taskMap[agentTask.Arn] = task
+			}
+			task.ContainerIDs = append(task.ContainerIDs, containerID)
+		}
+	}
+	return tasks
+}
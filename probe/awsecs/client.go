@@ -57,12 +57,28 @@ type EcsService struct {
 	ServiceName string
 	// The following values may be stale in a cached copy
 	DeploymentIDs     []string
+	Deployments       []EcsDeployment
 	DesiredCount      int64
 	PendingCount      int64
 	RunningCount      int64
 	TaskDefinitionARN string
 }
 
+// EcsDeployment describes a deployment of an ECS service: the PRIMARY one
+// runs the most recent task definition, while ACTIVE ones are being
+// drained in favour of it.
+// Exported for test.
+type EcsDeployment struct {
+	ID                string
+	Status            string
+	TaskDefinitionARN string
+	DesiredCount      int64
+	PendingCount      int64
+	RunningCount      int64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
 // EcsInfo is exported for test
 type EcsInfo struct {
 	Tasks          map[string]EcsTask
@@ -124,12 +140,24 @@ func newECSTask(task *ecs.Task) EcsTask {
 
 func newECSService(service *ecs.Service) EcsService {
 	deploymentIDs := make([]string, len(service.Deployments))
+	deployments := make([]EcsDeployment, len(service.Deployments))
 	for i, deployment := range service.Deployments {
 		deploymentIDs[i] = stringOrBlank(deployment.Id)
+		deployments[i] = EcsDeployment{
+			ID:                stringOrBlank(deployment.Id),
+			Status:            stringOrBlank(deployment.Status),
+			TaskDefinitionARN: stringOrBlank(deployment.TaskDefinition),
+			DesiredCount:      int64OrZero(deployment.DesiredCount),
+			PendingCount:      int64OrZero(deployment.PendingCount),
+			RunningCount:      int64OrZero(deployment.RunningCount),
+			CreatedAt:         timeOrZero(deployment.CreatedAt),
+			UpdatedAt:         timeOrZero(deployment.UpdatedAt),
+		}
 	}
 	return EcsService{
 		ServiceName:       stringOrBlank(service.ServiceName),
 		DeploymentIDs:     deploymentIDs,
+		Deployments:       deployments,
 		DesiredCount:      int64OrZero(service.DesiredCount),
 		PendingCount:      int64OrZero(service.PendingCount),
 		RunningCount:      int64OrZero(service.RunningCount),
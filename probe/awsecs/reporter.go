@@ -2,6 +2,7 @@ package awsecs
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -18,21 +19,54 @@ const (
 	TaskFamily          = report.ECSTaskFamily
 	ServiceDesiredCount = report.ECSServiceDesiredCount
 	ServiceRunningCount = report.ECSServiceRunningCount
+	ServicePendingCount = report.ECSServicePendingCount
+	ServiceDeployment   = report.ECSServiceDeployment
+	TaskKnownStatus     = report.ECSTaskKnownStatus
+	TaskDesiredStatus   = report.ECSTaskDesiredStatus
 	ScaleUp             = report.ECSScaleUp
 	ScaleDown           = report.ECSScaleDown
+
+	ServiceDeploymentsTablePrefix = "ecs_service_deployments_"
+)
+
+// Statuses of a service's deployments, as summarised in ServiceDeployment
+const (
+	DeploymentSteady     = "Steady"
+	DeploymentScaling    = "Scaling"
+	DeploymentRollingOut = "Rolling Out"
 )
 
 var (
 	taskMetadata = report.MetadataTemplates{
-		Cluster:    {ID: Cluster, Label: "Cluster", From: report.FromLatest, Priority: 0},
-		CreatedAt:  {ID: CreatedAt, Label: "Created At", From: report.FromLatest, Priority: 1, Datatype: report.DateTime},
-		TaskFamily: {ID: TaskFamily, Label: "Family", From: report.FromLatest, Priority: 2},
+		Cluster:           {ID: Cluster, Label: "Cluster", From: report.FromLatest, Priority: 0},
+		CreatedAt:         {ID: CreatedAt, Label: "Created At", From: report.FromLatest, Priority: 1, Datatype: report.DateTime},
+		TaskFamily:        {ID: TaskFamily, Label: "Family", From: report.FromLatest, Priority: 2},
+		TaskKnownStatus:   {ID: TaskKnownStatus, Label: "Status", From: report.FromLatest, Priority: 3},
+		TaskDesiredStatus: {ID: TaskDesiredStatus, Label: "Desired Status", From: report.FromLatest, Priority: 4},
 	}
 	serviceMetadata = report.MetadataTemplates{
 		Cluster:             {ID: Cluster, Label: "Cluster", From: report.FromLatest, Priority: 0},
 		CreatedAt:           {ID: CreatedAt, Label: "Created At", From: report.FromLatest, Priority: 1, Datatype: report.DateTime},
 		ServiceDesiredCount: {ID: ServiceDesiredCount, Label: "Desired Tasks", From: report.FromLatest, Priority: 2, Datatype: report.Number},
 		ServiceRunningCount: {ID: ServiceRunningCount, Label: "Running Tasks", From: report.FromLatest, Priority: 3, Datatype: report.Number},
+		ServicePendingCount: {ID: ServicePendingCount, Label: "Pending Tasks", From: report.FromLatest, Priority: 4, Datatype: report.Number},
+		ServiceDeployment:   {ID: ServiceDeployment, Label: "Deployment", From: report.FromLatest, Priority: 5},
+	}
+	serviceTables = report.TableTemplates{
+		ServiceDeploymentsTablePrefix: {
+			ID:     ServiceDeploymentsTablePrefix,
+			Label:  "Deployments",
+			Type:   report.MulticolumnTableType,
+			Prefix: ServiceDeploymentsTablePrefix,
+			Columns: []report.Column{
+				{ID: "status", Label: "Status"},
+				{ID: "task_definition", Label: "Task Definition"},
+				{ID: "desired", Label: "Desired", DataType: report.Number},
+				{ID: "pending", Label: "Pending", DataType: report.Number},
+				{ID: "running", Label: "Running", DataType: report.Number},
+				{ID: "updated", Label: "Updated", DataType: report.DateTime},
+			},
+		},
 	}
 )
 
@@ -90,10 +124,13 @@ type Reporter struct {
 	clusterRegion    string
 	handlerRegistry  *controls.HandlerRegistry
 	probeID          string
+	agentURL         string
 }
 
-// Make creates a new Reporter
-func Make(cacheSize int, cacheExpiry time.Duration, clusterRegion string, handlerRegistry *controls.HandlerRegistry, probeID string) Reporter {
+// Make creates a new Reporter. If agentURL isn't empty, the introspection
+// API of the ECS agent found there is used to find the tasks of containers
+// lacking the ECS docker labels.
+func Make(cacheSize int, cacheExpiry time.Duration, clusterRegion string, handlerRegistry *controls.HandlerRegistry, probeID string, agentURL string) Reporter {
 	r := Reporter{
 		ClientsByCluster: map[string]EcsClient{},
 		cacheSize:        cacheSize,
@@ -101,6 +138,7 @@ func Make(cacheSize int, cacheExpiry time.Duration, clusterRegion string, handle
 		clusterRegion:    clusterRegion,
 		handlerRegistry:  handlerRegistry,
 		probeID:          probeID,
+		agentURL:         strings.TrimSuffix(agentURL, "/"),
 	}
 
 	handlerRegistry.Batch(nil, map[string]xfer.ControlHandlerFunc{
@@ -130,6 +168,14 @@ func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
 	rpt = rpt.Copy()
 
 	clusterMap := GetLabelInfo(rpt)
+	agentTasks := map[string]AgentTask{}
+	if r.agentURL != "" {
+		if info, err := GetAgentInfo(r.agentURL); err != nil {
+			log.Debugf("Cannot query ECS agent: %v", err)
+		} else {
+			agentTasks = addAgentInfo(rpt, clusterMap, info)
+		}
+	}
 
 	for cluster, taskMap := range clusterMap {
 		log.Debugf("Fetching ECS info for cluster %v with %v tasks", cluster, len(taskMap))
@@ -154,8 +200,10 @@ func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
 				Cluster:               cluster,
 				ServiceDesiredCount:   fmt.Sprintf("%d", service.DesiredCount),
 				ServiceRunningCount:   fmt.Sprintf("%d", service.RunningCount),
+				ServicePendingCount:   fmt.Sprintf("%d", service.PendingCount),
+				ServiceDeployment:     deploymentStatus(service),
 				report.ControlProbeID: r.probeID,
-			}).WithLatestControls(map[string]report.NodeControlData{
+			}).AddPrefixMulticolumnTable(ServiceDeploymentsTablePrefix, deploymentRows(service)).WithLatestControls(map[string]report.NodeControlData{
 				ScaleUp: {Dead: false},
 				// We've decided for now to disable ScaleDown when only 1 task is desired,
 				// since scaling down to 0 would cause the service to disappear (#2085)
@@ -178,6 +226,12 @@ func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
 				Cluster:    cluster,
 				CreatedAt:  task.CreatedAt.Format(time.RFC3339Nano),
 			})
+			if agentTask, ok := agentTasks[taskArn]; ok {
+				node = node.WithLatests(map[string]string{
+					TaskKnownStatus:   agentTask.KnownStatus,
+					TaskDesiredStatus: agentTask.DesiredStatus,
+				})
+			}
 			rpt.ECSTask = rpt.ECSTask.AddNode(node)
 
 			// parents sets to merge into all matching container nodes
@@ -208,7 +262,7 @@ func (Reporter) Report() (report.Report, error) {
 	result := report.MakeReport()
 	taskTopology := report.MakeTopology().WithMetadataTemplates(taskMetadata)
 	result.ECSTask = result.ECSTask.Merge(taskTopology)
-	serviceTopology := report.MakeTopology().WithMetadataTemplates(serviceMetadata)
+	serviceTopology := report.MakeTopology().WithMetadataTemplates(serviceMetadata).WithTableTemplates(serviceTables)
 	serviceTopology.Controls.AddControls([]report.Control{
 		{
 			ID:    ScaleDown,
@@ -227,6 +281,47 @@ func (Reporter) Report() (report.Report, error) {
 	return result, nil
 }
 
+// deploymentStatus summarises the deployments of a service: it is rolling
+// out while an older deployment is still being replaced by the PRIMARY
+// one, and scaling while the tasks running don't match those desired.
+func deploymentStatus(service EcsService) string {
+	switch {
+	case len(service.Deployments) > 1:
+		return DeploymentRollingOut
+	case service.RunningCount != service.DesiredCount || service.PendingCount > 0:
+		return DeploymentScaling
+	default:
+		return DeploymentSteady
+	}
+}
+
+func deploymentRows(service EcsService) []report.Row {
+	rows := make([]report.Row, 0, len(service.Deployments))
+	for _, d := range service.Deployments {
+		rows = append(rows, report.Row{
+			ID: d.ID,
+			Entries: map[string]string{
+				"status":          d.Status,
+				"task_definition": taskDefinitionName(d.TaskDefinitionARN),
+				"desired":         fmt.Sprintf("%d", d.DesiredCount),
+				"pending":         fmt.Sprintf("%d", d.PendingCount),
+				"running":         fmt.Sprintf("%d", d.RunningCount),
+				"updated":         d.UpdatedAt.Format(time.RFC3339Nano),
+			},
+		})
+	}
+	return rows
+}
+
+// taskDefinitionName returns the family:revision part of a task
+// definition ARN.
+func taskDefinitionName(arn string) string {
+	if i := strings.LastIndex(arn, "/"); i >= 0 {
+		return arn[i+1:]
+	}
+	return arn
+}
+
 // Name needed for Tagger, Reporter
 func (r Reporter) Name() string {
 	return "awsecs"
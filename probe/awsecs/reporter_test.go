@@ -38,7 +38,7 @@ func getTestContainerNode() report.Node {
 
 func TestGetLabelInfo(t *testing.T) {
 	hr := controls.NewDefaultHandlerRegistry()
-	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id")
+	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id", "")
 	rpt, err := r.Report()
 	if err != nil {
 		t.Fatalf("Error making report: %v", err)
@@ -92,7 +92,7 @@ func (c mockEcsClient) ScaleService(serviceName string, amount int) error {
 
 func TestTagReport(t *testing.T) {
 	hr := controls.NewDefaultHandlerRegistry()
-	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id")
+	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id", "")
 
 	r.ClientsByCluster[testCluster] = newMockEcsClient(
 		t,
@@ -194,3 +194,91 @@ func TestTagReport(t *testing.T) {
 		}
 	}
 }
+
+func TestTagReportFromAgent(t *testing.T) {
+	oldGetAgentInfo := awsecs.GetAgentInfo
+	defer func() { awsecs.GetAgentInfo = oldGetAgentInfo }()
+	awsecs.GetAgentInfo = func(string) (awsecs.AgentInfo, error) {
+		return awsecs.AgentInfo{
+			Cluster: testCluster,
+			Tasks: []awsecs.AgentTask{{
+				Arn:           testTaskARN,
+				DesiredStatus: "RUNNING",
+				KnownStatus:   "PENDING",
+				Family:        testFamily,
+				Containers:    []awsecs.AgentContainer{{DockerID: testContainer, Name: "web"}},
+			}},
+		}, nil
+	}
+
+	hr := controls.NewDefaultHandlerRegistry()
+	r := awsecs.Make(1e6, time.Hour, "", hr, "test-probe-id", "http://localhost:51678")
+	r.ClientsByCluster[testCluster] = newMockEcsClient(
+		t,
+		[]string{testTaskARN},
+		awsecs.EcsInfo{
+			Tasks: map[string]awsecs.EcsTask{
+				testTaskARN: {TaskARN: testTaskARN, CreatedAt: testTaskCreatedAt},
+			},
+			Services: map[string]awsecs.EcsService{
+				testServiceName: {
+					ServiceName:  testServiceName,
+					DesiredCount: 2,
+					PendingCount: 1,
+					RunningCount: 2,
+					Deployments: []awsecs.EcsDeployment{
+						{ID: "ecs-svc/1", Status: "PRIMARY", TaskDefinitionARN: testTaskDefinitionARN, DesiredCount: 2, PendingCount: 1, RunningCount: 1},
+						{ID: "ecs-svc/2", Status: "ACTIVE", TaskDefinitionARN: testTaskDefinitionARN, DesiredCount: 0, RunningCount: 1},
+					},
+				},
+			},
+			TaskServiceMap: map[string]string{
+				testTaskARN: testServiceName,
+			},
+		},
+	)
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatalf("Error making report")
+	}
+	// No ECS labels on this container
+	rpt.Container = rpt.Container.AddNode(report.MakeNode(report.MakeContainerNodeID(testContainer)))
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatalf("Failed to tag: %v", err)
+	}
+
+	task, ok := rpt.ECSTask.Nodes[report.MakeECSTaskNodeID(testTaskARN)]
+	if !ok {
+		t.Fatalf("Result report did not contain task %v: %v", testTaskARN, rpt.ECSTask.Nodes)
+	}
+	if status, _ := task.Latest.Lookup(awsecs.TaskKnownStatus); status != "PENDING" {
+		t.Errorf("Expected task to be PENDING, got %q", status)
+	}
+	if status, _ := task.Latest.Lookup(awsecs.TaskDesiredStatus); status != "RUNNING" {
+		t.Errorf("Expected task to be desired RUNNING, got %q", status)
+	}
+
+	container := rpt.Container.Nodes[report.MakeContainerNodeID(testContainer)]
+	if parents, _ := container.Parents.Lookup(report.ECSTask); !parents.Contains(report.MakeECSTaskNodeID(testTaskARN)) {
+		t.Errorf("Expected container to be in task %v, got %v", testTaskARN, container.Parents)
+	}
+
+	service := rpt.ECSService.Nodes[report.MakeECSServiceNodeID(testCluster, testServiceName)]
+	if status, _ := service.Latest.Lookup(awsecs.ServiceDeployment); status != awsecs.DeploymentRollingOut {
+		t.Errorf("Expected service to be rolling out, got %q", status)
+	}
+	if pending, _ := service.Latest.Lookup(awsecs.ServicePendingCount); pending != "1" {
+		t.Errorf("Expected 1 pending task, got %q", pending)
+	}
+	rows := service.ExtractMulticolumnTable(rpt.ECSService.TableTemplates[awsecs.ServiceDeploymentsTablePrefix])
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 deployments, got %v", rows)
+	}
+	for _, row := range rows {
+		if row.ID == "ecs-svc/1" && (row.Entries["status"] != "PRIMARY" || row.Entries["task_definition"] != "deadbeef-dead-beef-dead-beefdeadbeef") {
+			t.Errorf("Unexpected primary deployment row: %v", row)
+		}
+	}
+}
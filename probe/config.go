@@ -0,0 +1,259 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+const (
+	// ConfigureControl is the control apps push config to probes with, as
+	// JSON in its "config" argument.
+	ConfigureControl = "probe_configure"
+
+	// Sources of config, the later overriding the earlier.
+	configFileSource = "file"
+	configAppSource  = "app"
+
+	configPollInterval = 10 * time.Second
+)
+
+var configSources = []string{configFileSource, configAppSource}
+
+// Config is what of a probe's configuration can change as it runs, by its
+// config file, or pushed from an app. What's left out is as flags have it.
+//
+// As JSON, intervals are durations like "15s":
+//
+//	{"spyInterval": "5s", "disabledReporters": ["Process"], "reporterIntervals": {"Docker": "1m"}, "topologies": ["host"]}
+type Config struct {
+	SpyInterval     time.Duration
+	PublishInterval time.Duration
+
+	// DisabledReporters are the names of reporters left out of reports.
+	DisabledReporters []string
+	// ReporterIntervals are how often the named reporters report, if less
+	// often than every SpyInterval, their last report standing in between.
+	ReporterIntervals map[string]time.Duration
+	// Topologies are the only topologies published, if any are.
+	Topologies []string
+}
+
+type configJSON struct {
+	SpyInterval       string            `json:"spyInterval,omitempty"`
+	PublishInterval   string            `json:"publishInterval,omitempty"`
+	DisabledReporters []string          `json:"disabledReporters,omitempty"`
+	ReporterIntervals map[string]string `json:"reporterIntervals,omitempty"`
+	Topologies        []string          `json:"topologies,omitempty"`
+}
+
+// ParseConfig parses the JSON of a Config.
+func ParseConfig(buf []byte) (Config, error) {
+	var (
+		raw    configJSON
+		config Config
+		err    error
+	)
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return config, err
+	}
+	if raw.SpyInterval != "" {
+		if config.SpyInterval, err = time.ParseDuration(raw.SpyInterval); err != nil || config.SpyInterval <= 0 {
+			return config, fmt.Errorf("invalid spyInterval %q", raw.SpyInterval)
+		}
+	}
+	if raw.PublishInterval != "" {
+		if config.PublishInterval, err = time.ParseDuration(raw.PublishInterval); err != nil || config.PublishInterval <= 0 {
+			return config, fmt.Errorf("invalid publishInterval %q", raw.PublishInterval)
+		}
+	}
+	config.DisabledReporters = raw.DisabledReporters
+	for name, value := range raw.ReporterIntervals {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return config, fmt.Errorf("invalid interval %q of reporter %s", value, name)
+		}
+		if config.ReporterIntervals == nil {
+			config.ReporterIntervals = map[string]time.Duration{}
+		}
+		config.ReporterIntervals[name] = interval
+	}
+	config.Topologies = raw.Topologies
+	return config, nil
+}
+
+// override returns the config with what other sets overridden.
+func (c Config) override(other Config) Config {
+	if other.SpyInterval != 0 {
+		c.SpyInterval = other.SpyInterval
+	}
+	if other.PublishInterval != 0 {
+		c.PublishInterval = other.PublishInterval
+	}
+	if other.DisabledReporters != nil {
+		c.DisabledReporters = other.DisabledReporters
+	}
+	if other.ReporterIntervals != nil {
+		c.ReporterIntervals = other.ReporterIntervals
+	}
+	if other.Topologies != nil {
+		c.Topologies = other.Topologies
+	}
+	return c
+}
+
+// configure applies the config from the source, on top of the flags, and
+// of the sources before it.
+func (p *Probe) configure(source string, config Config) {
+	p.mtx.Lock()
+	p.configs[source] = config
+	p.mtx.Unlock()
+	p.apply(source)
+}
+
+// ConfigureReporters disables the named reporters, and has those in
+// intervals report as often as it says, as flags configure them, unless
+// the config file, or an app, says otherwise.
+func (p *Probe) ConfigureReporters(disabled []string, intervals map[string]time.Duration) {
+	p.mtx.Lock()
+	p.flags.DisabledReporters = disabled
+	p.flags.ReporterIntervals = intervals
+	p.mtx.Unlock()
+	p.apply("flags")
+}
+
+// apply applies the config of the sources, as the source changed it.
+func (p *Probe) apply(source string) {
+	p.mtx.Lock()
+	effective := p.flags
+	for _, source := range configSources {
+		effective = effective.override(p.configs[source])
+	}
+	if p.fidelityReduced {
+		effective.SpyInterval *= cpuBudgetSpyIntervalFactor
+	}
+	p.config = effective
+	p.mtx.Unlock()
+
+	log.Infof("Applied probe config from %s: %+v", source, effective)
+	for _, reconfigured := range []chan struct{}{p.spyReconfigured, p.publishReconfigured} {
+		select {
+		case reconfigured <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Config returns the config the probe runs with.
+func (p *Probe) Config() Config {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.config
+}
+
+// enabledReporters returns the names of the reporters the config leaves
+// enabled. p.mtx must be held.
+func (p *Probe) enabledReporters() []string {
+	disabled := map[string]bool{}
+	for _, name := range p.config.DisabledReporters {
+		disabled[name] = true
+	}
+	names := []string{}
+	for _, rep := range p.reporters {
+		if !disabled[rep.Name()] {
+			names = append(names, rep.Name())
+		}
+	}
+	return names
+}
+
+// ConfigureControl applies the config an app pushes. Pushing no config
+// reverts what apps pushed before.
+func (p *Probe) ConfigureControl(req xfer.Request) xfer.Response {
+	var config Config
+	if buf := req.ControlArgs["config"]; buf != "" {
+		var err error
+		if config, err = ParseConfig([]byte(buf)); err != nil {
+			return xfer.ResponseError(err)
+		}
+	}
+	p.configure(configAppSource, config)
+	return xfer.Response{}
+}
+
+// ConfigFile watches a probe's config file, applying it as it changes.
+type ConfigFile struct {
+	path  string
+	probe *Probe
+	quit  chan struct{}
+
+	modTime time.Time
+	size    int64
+}
+
+// NewConfigFile applies the config file at path to the probe, and then
+// watches it, applying it again as it changes.
+func NewConfigFile(path string, p *Probe) (*ConfigFile, error) {
+	f := &ConfigFile{path: path, probe: p, quit: make(chan struct{})}
+	if err := f.apply(); err != nil {
+		return nil, err
+	}
+	go f.loop()
+	return f, nil
+}
+
+// Stop stops watching the config file.
+func (f *ConfigFile) Stop() {
+	close(f.quit)
+}
+
+func (f *ConfigFile) loop() {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// A broken config leaves the one before applied
+			if err := f.apply(); err != nil {
+				log.Errorf("Error applying probe config %s: %v", f.path, err)
+			}
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// apply applies the config file, if it changed since it last was.
+func (f *ConfigFile) apply() error {
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		// Removing the config file reverts it
+		if !f.modTime.IsZero() {
+			f.modTime, f.size = time.Time{}, 0
+			f.probe.configure(configFileSource, Config{})
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	config, err := ParseConfig(buf)
+	if err != nil {
+		return err
+	}
+	f.probe.configure(configFileSource, config)
+	return nil
+}
@@ -0,0 +1,120 @@
+package probe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"spyInterval": "5s", "disabledReporters": ["Mock"], "reporterIntervals": {"Docker": "1m"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		SpyInterval:       5 * time.Second,
+		DisabledReporters: []string{"Mock"},
+		ReporterIntervals: map[string]time.Duration{"Docker": time.Minute},
+	}
+	if !reflect.DeepEqual(want, config) {
+		t.Errorf("want %+v, have %+v", want, config)
+	}
+	for _, invalid := range []string{`{"spyInterval": "soon"}`, `{"publishInterval": "-1s"}`, `{"reporterIntervals": {"Docker": "0s"}}`, `[]`} {
+		if _, err := ParseConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "probe-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"spyInterval": "5s", "publishInterval": "10s"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(time.Second, 3*time.Second, nil, false)
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host"))
+	rpt.Container.AddNode(report.MakeNode("container"))
+	p.AddReporter(mockReporter{rpt})
+
+	// The config file overrides flags, and apps override the config file
+	configFile, err := NewConfigFile(path, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configFile.Stop()
+	res := p.ConfigureControl(xfer.Request{ControlArgs: map[string]string{
+		"config": `{"spyInterval": "2s", "topologies": ["host"]}`,
+	}})
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	want := Config{SpyInterval: 2 * time.Second, PublishInterval: 10 * time.Second, Topologies: []string{"host"}}
+	if have := p.Config(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+
+	// Removing the config file reverts it
+	os.Remove(path)
+	if err := configFile.apply(); err != nil {
+		t.Fatal(err)
+	}
+	want.PublishInterval = 3 * time.Second
+	if have := p.Config(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+
+	// Disabled reporters are left out of reports
+	if have := p.report(context.Background(), Config{DisabledReporters: []string{"Mock"}}); len(have.Host.Nodes) != 0 {
+		t.Errorf("disabled reporter reported %v", have.Host.Nodes)
+	}
+	if have := p.report(context.Background(), Config{}); len(have.Host.Nodes) != 1 {
+		t.Errorf("reporter reported %v", have.Host.Nodes)
+	}
+}
+
+type countingReporter struct {
+	name  string
+	count *int
+}
+
+func (r countingReporter) Name() string { return r.name }
+
+func (r countingReporter) Report() (report.Report, error) {
+	*r.count++
+	return report.MakeReport(), nil
+}
+
+func TestReporterIntervals(t *testing.T) {
+	var fast, slow int
+	p := New(time.Second, time.Second, nil, false)
+	p.AddReporter(countingReporter{"fast", &fast}, countingReporter{"slow", &slow})
+	p.ConfigureReporters(nil, map[string]time.Duration{"slow": time.Hour})
+
+	for i := 0; i < 3; i++ {
+		p.report(context.Background(), p.Config())
+	}
+	if fast != 3 || slow != 1 {
+		t.Errorf("fast reporter reported %d times, slow one %d times", fast, slow)
+	}
+
+	p.ConfigureReporters([]string{"fast"}, nil)
+	p.report(context.Background(), p.Config())
+	if fast != 3 || slow != 2 {
+		t.Errorf("fast reporter reported %d times, slow one %d times", fast, slow)
+	}
+}
@@ -2,6 +2,7 @@ package controls
 
 import (
 	"sync"
+	"time"
 
 	"github.com/weaveworks/scope/common/xfer"
 )
@@ -68,10 +69,24 @@ func (b *defaultBackend) Handler(control string) (xfer.ControlHandlerFunc, bool)
 	return handler, ok
 }
 
+// handledRetention is how long the responses to requests are kept, to
+// answer the app retrying them.
+const handledRetention = 10 * time.Minute
+
 // HandlerRegistry uses backend for storing and retrieving control
 // requests handlers.
 type HandlerRegistry struct {
 	backend HandlerRegistryBackend
+
+	mtx     sync.Mutex
+	handled map[string]*handledRequest // by request ID
+}
+
+// handledRequest is a request handled, or being handled, by ID.
+type handledRequest struct {
+	done chan struct{}
+	res  xfer.Response
+	at   time.Time
 }
 
 // NewDefaultHandlerRegistry creates a registry with a default
@@ -114,8 +129,43 @@ func (r *HandlerRegistry) Batch(toRemove []string, toAdd map[string]xfer.Control
 	}
 }
 
-// HandleControlRequest performs a control request.
+// HandleControlRequest performs a control request. Requests with an ID
+// are performed once, answering retries of them, as the app sends when a
+// connection drops before the response gets back, as the first one was
+// answered.
 func (r *HandlerRegistry) HandleControlRequest(req xfer.Request) xfer.Response {
+	if req.ID == "" {
+		return r.handle(req)
+	}
+
+	r.mtx.Lock()
+	if r.handled == nil {
+		r.handled = map[string]*handledRequest{}
+	}
+	now := time.Now()
+	for id, handled := range r.handled {
+		if now.Sub(handled.at) > handledRetention {
+			delete(r.handled, id)
+		}
+	}
+	handled, ok := r.handled[req.ID]
+	if !ok {
+		handled = &handledRequest{done: make(chan struct{}), at: now}
+		r.handled[req.ID] = handled
+	}
+	r.mtx.Unlock()
+
+	if ok {
+		<-handled.done
+		return handled.res
+	}
+	handled.res = r.handle(req)
+	handled.res.RequestID = req.ID
+	close(handled.done)
+	return handled.res
+}
+
+func (r *HandlerRegistry) handle(req xfer.Request) xfer.Response {
 	h, ok := r.handler(req.Control)
 	if !ok {
 		return xfer.ResponseErrorf("Control %q not recognised", req.Control)
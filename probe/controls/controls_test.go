@@ -1,6 +1,7 @@
 package controls_test
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -41,3 +42,73 @@ func TestControlsNotFound(t *testing.T) {
 		t.Fatal(test.Diff(want, have))
 	}
 }
+
+func TestControlsRetried(t *testing.T) {
+	registry := controls.NewDefaultHandlerRegistry()
+	calls := 0
+	registry.Register("foo", func(req xfer.Request) xfer.Response {
+		calls++
+		return xfer.Response{
+			Value: calls,
+		}
+	})
+	defer registry.Rm("foo")
+
+	want := xfer.Response{
+		Value:     1,
+		RequestID: "request",
+	}
+	for i := 0; i < 2; i++ {
+		have := registry.HandleControlRequest(xfer.Request{
+			ID:      "request",
+			Control: "foo",
+		})
+		if !reflect.DeepEqual(want, have) {
+			t.Fatal(test.Diff(want, have))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("retried control was done %d times", calls)
+	}
+}
+
+type mockPipeClient map[string]xfer.Pipe
+
+func (c mockPipeClient) PipeConnection(appID, id string, pipe xfer.Pipe) error {
+	c[id] = pipe
+	return nil
+}
+
+func (c mockPipeClient) PipeClose(appID, id string) error {
+	return nil
+}
+
+func TestJob(t *testing.T) {
+	pipes := mockPipeClient{}
+	handler := controls.Job(pipes, func(req xfer.Request, progress controls.Progress) xfer.Response {
+		progress("halfway", 50)
+		return xfer.Response{Value: "done"}
+	})
+	res := handler(xfer.Request{Control: "foo"})
+	if !res.Job || pipes[res.Pipe] == nil {
+		t.Fatalf("job returned %+v", res)
+	}
+
+	_, remote := pipes[res.Pipe].Ends()
+	decoder := json.NewDecoder(remote)
+	var have []xfer.JobUpdate
+	for {
+		var update xfer.JobUpdate
+		if err := decoder.Decode(&update); err != nil {
+			break
+		}
+		have = append(have, update)
+	}
+	want := []xfer.JobUpdate{
+		{Message: "halfway", Percent: 50},
+		{Percent: 100, Result: &xfer.Response{Value: "done"}},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Fatal(test.Diff(want, have))
+	}
+}
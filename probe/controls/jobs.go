@@ -0,0 +1,63 @@
+package controls
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// jobUpdatesQueued is how many progress updates of a job are queued for
+// its pipe, before they are dropped rather than holding the job up.
+const jobUpdatesQueued = 16
+
+// Progress tells how far along a job is, as a message and percentage.
+type Progress func(message string, percent int)
+
+// JobFunc is a long running control, like draining a node, which tells
+// how far along it is as it goes, and returns its result.
+type JobFunc func(req xfer.Request, progress Progress) xfer.Response
+
+// Job makes the handler of a control out of f, running it in the
+// background, and answering straight away with a pipe which streams its
+// progress, and then its result, as xfer.JobUpdates.
+func Job(pipes PipeClient, f JobFunc) xfer.ControlHandlerFunc {
+	return func(req xfer.Request) xfer.Response {
+		id, pipe, err := NewPipe(pipes, req.AppID)
+		if err != nil {
+			return xfer.ResponseError(err)
+		}
+
+		updates := make(chan xfer.JobUpdate, jobUpdatesQueued)
+		go func() {
+			defer pipe.Close()
+			local, _ := pipe.Ends()
+			encoder := json.NewEncoder(local)
+			var err error
+			for update := range updates {
+				// Carry on draining updates, so the job isn't held up
+				if err == nil {
+					err = encoder.Encode(update)
+				}
+			}
+			if err != nil {
+				log.Warnf("Error streaming progress of %s on %s: %v", req.Control, req.NodeID, err)
+			}
+		}()
+		go func() {
+			res := f(req, func(message string, percent int) {
+				select {
+				case updates <- xfer.JobUpdate{Message: message, Percent: percent}:
+				default:
+				}
+			})
+			updates <- xfer.JobUpdate{Percent: 100, Result: &res}
+			close(updates)
+		}()
+		return xfer.Response{
+			Pipe: id,
+			Job:  true,
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+)
+
+const (
+	// cpuBudgetSpyIntervalFactor is how much longer the spy interval is
+	// while the probe is over its CPU budget.
+	cpuBudgetSpyIntervalFactor = 3
+
+	// cpuBudgetRestoreFraction is the fraction of its CPU budget the probe
+	// has to get under before restoring detail, so it doesn't flap.
+	cpuBudgetRestoreFraction = 0.5
+)
+
+// cpuMeter measures the CPU the probe uses between measurements.
+type cpuMeter struct {
+	mtx     sync.Mutex
+	cpuTime time.Duration // as of the last measurement
+	at      time.Time
+}
+
+// usage returns the CPU the probe used since the last measurement, as a
+// percentage of one CPU.
+func (m *cpuMeter) usage(now time.Time) (float64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	cpuTime := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	lastTime, lastAt := m.cpuTime, m.at
+	m.cpuTime, m.at = cpuTime, now
+	if lastAt.IsZero() || !now.After(lastAt) {
+		return 0, false
+	}
+	return 100 * float64(cpuTime-lastTime) / float64(now.Sub(lastAt)), true
+}
+
+// CPUBudget is a Ticker which reduces the fidelity of the probe while it
+// uses more CPU than its budget: spying less often, and having reduce cut
+// down on what's gathered, until its usage subsides.
+type CPUBudget struct {
+	probe  *Probe
+	budget float64 // percent of one CPU
+	reduce func(bool)
+	usage  func(time.Time) (float64, bool)
+
+	mtx     sync.Mutex
+	reduced bool
+}
+
+// NewCPUBudget makes a new CPUBudget of budget percent of one CPU, calling
+// reduce as the probe goes over, and back under, it.
+func NewCPUBudget(p *Probe, budget float64, reduce func(bool)) *CPUBudget {
+	meter := &cpuMeter{}
+	return &CPUBudget{
+		probe:  p,
+		budget: budget,
+		reduce: reduce,
+		usage:  meter.usage,
+	}
+}
+
+// Name of this ticker, for metrics gathering
+func (*CPUBudget) Name() string { return "CPUBudget" }
+
+// Tick implements Ticker.
+func (b *CPUBudget) Tick() error {
+	usage, ok := b.usage(mtime.Now())
+	if !ok {
+		return nil
+	}
+
+	b.mtx.Lock()
+	reduced := b.reduced
+	switch {
+	case !reduced && usage > b.budget:
+		log.Warnf("Probe using %.1f%% CPU, over its budget of %.1f%%: reducing detail", usage, b.budget)
+		reduced = true
+	case reduced && usage < b.budget*cpuBudgetRestoreFraction:
+		log.Infof("Probe using %.1f%% CPU, well under its budget of %.1f%%: restoring detail", usage, b.budget)
+		reduced = false
+	}
+	changed := reduced != b.reduced
+	b.reduced = reduced
+	b.mtx.Unlock()
+
+	if changed {
+		b.reduce(reduced)
+		b.probe.reduceFidelity(reduced)
+	}
+	return nil
+}
+
+// reduceFidelity has the probe spy less often while reduced is set.
+func (p *Probe) reduceFidelity(reduced bool) {
+	p.mtx.Lock()
+	p.fidelityReduced = reduced
+	p.mtx.Unlock()
+	p.apply("CPU budget")
+}
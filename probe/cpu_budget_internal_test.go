@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCPUBudget(t *testing.T) {
+	p := New(time.Second, time.Second, nil, false)
+	var (
+		usage   float64
+		reduced []bool
+	)
+	b := NewCPUBudget(p, 10, func(reduce bool) { reduced = append(reduced, reduce) })
+	b.usage = func(time.Time) (float64, bool) { return usage, true }
+
+	for _, tc := range []struct {
+		usage       float64
+		reduced     bool
+		spyInterval time.Duration
+	}{
+		{5, false, time.Second},
+		{20, true, cpuBudgetSpyIntervalFactor * time.Second},
+		{7, true, cpuBudgetSpyIntervalFactor * time.Second}, // not far enough under budget
+		{4, false, time.Second},
+	} {
+		usage = tc.usage
+		if err := b.Tick(); err != nil {
+			t.Fatal(err)
+		}
+		if b.reduced != tc.reduced {
+			t.Errorf("at %.0f%%: want reduced %v, have %v", tc.usage, tc.reduced, b.reduced)
+		}
+		if have := p.Config().SpyInterval; have != tc.spyInterval {
+			t.Errorf("at %.0f%%: want spy interval %v, have %v", tc.usage, tc.spyInterval, have)
+		}
+	}
+	if len(reduced) != 2 || !reduced[0] || reduced[1] {
+		t.Errorf("want fidelity reduced then restored, have %v", reduced)
+	}
+}
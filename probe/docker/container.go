@@ -31,6 +31,7 @@ const (
 	ContainerUptime        = report.DockerContainerUptime
 	ContainerRestartCount  = report.DockerContainerRestartCount
 	ContainerNetworkMode   = report.DockerContainerNetworkMode
+	ContainerExitCode      = report.DockerContainerExitCode
 
 	NetworkRxDropped = "network_rx_dropped"
 	NetworkRxBytes   = "network_rx_bytes"
@@ -107,15 +108,18 @@ type container struct {
 	baseNode               report.Node
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
+	envFilter              *EnvFilter
 }
 
-// NewContainer creates a new Container
-func NewContainer(c *docker.Container, hostID string, noCommandLineArguments bool, noEnvironmentVariables bool) Container {
+// NewContainer creates a new Container. Its environment variables are
+// filtered by envFilter, if not nil.
+func NewContainer(c *docker.Container, hostID string, noCommandLineArguments bool, noEnvironmentVariables bool, envFilter *EnvFilter) Container {
 	result := &container{
 		container:              c,
 		hostID:                 hostID,
 		noCommandLineArguments: noCommandLineArguments,
 		noEnvironmentVariables: noEnvironmentVariables,
+		envFilter:              envFilter,
 	}
 	result.baseNode = result.getBaseNode()
 	return result
@@ -393,7 +397,7 @@ func (c *container) getBaseNode() report.Node {
 	)
 	result = result.AddPrefixPropertyList(LabelPrefix, c.container.Config.Labels)
 	if !c.noEnvironmentVariables {
-		result = result.AddPrefixPropertyList(EnvPrefix, c.env())
+		result = result.AddPrefixPropertyList(EnvPrefix, c.envFilter.Filter(c.env()))
 	}
 	return result
 }
@@ -411,6 +415,7 @@ func (c *container) controlsMap() map[string]report.NodeControlData {
 		ExecContainer:    {Dead: !running},
 		StartContainer:   {Dead: !stopped},
 		RemoveContainer:  {Dead: !stopped},
+		PullImage:        {},
 	}
 }
 
@@ -433,6 +438,8 @@ func (c *container) GetNode() report.Node {
 		latest[ContainerUptime] = strconv.Itoa(uptimeSeconds)
 		latest[ContainerRestartCount] = strconv.Itoa(c.container.RestartCount)
 		latest[ContainerNetworkMode] = networkMode
+	} else if !c.container.State.Running && !c.container.State.FinishedAt.IsZero() {
+		latest[ContainerExitCode] = strconv.Itoa(c.container.State.ExitCode)
 	}
 
 	result := c.baseNode.WithLatests(latest)
@@ -42,7 +42,7 @@ func TestContainer(t *testing.T) {
 	defer mtime.NowReset()
 
 	const hostID = "scope"
-	c := docker.NewContainer(container1, hostID, false, false)
+	c := docker.NewContainer(container1, hostID, false, false, nil)
 	s := newMockStatsGatherer()
 	err := c.StartGatheringStats(s)
 	if err != nil {
@@ -69,6 +69,7 @@ func TestContainer(t *testing.T) {
 			docker.ExecContainer:    {Dead: false},
 			docker.StartContainer:   {Dead: true},
 			docker.RemoveContainer:  {Dead: true},
+			docker.PullImage:        {Dead: false},
 		}
 		want := report.MakeNodeWith("ping;<container>", map[string]string{
 			"docker_container_command":     "ping foo.bar.local",
@@ -133,7 +134,7 @@ func TestContainer(t *testing.T) {
 
 func TestContainerHidingArgs(t *testing.T) {
 	const hostID = "scope"
-	c := docker.NewContainer(container1, hostID, true, false)
+	c := docker.NewContainer(container1, hostID, true, false, nil)
 	node := c.GetNode()
 	node.Latest.ForEach(func(k string, _ time.Time, v string) {
 		if strings.Contains(v, "foo.bar.local") {
@@ -144,7 +145,7 @@ func TestContainerHidingArgs(t *testing.T) {
 
 func TestContainerHidingEnv(t *testing.T) {
 	const hostID = "scope"
-	c := docker.NewContainer(container1, hostID, false, true)
+	c := docker.NewContainer(container1, hostID, false, true, nil)
 	node := c.GetNode()
 	node.Latest.ForEach(func(k string, _ time.Time, v string) {
 		if strings.Contains(v, "secret-bar") {
@@ -155,7 +156,7 @@ func TestContainerHidingEnv(t *testing.T) {
 
 func TestContainerHidingBoth(t *testing.T) {
 	const hostID = "scope"
-	c := docker.NewContainer(container1, hostID, true, true)
+	c := docker.NewContainer(container1, hostID, true, true, nil)
 	node := c.GetNode()
 	node.Latest.ForEach(func(k string, _ time.Time, v string) {
 		if strings.Contains(v, "foo.bar.local") {
@@ -166,3 +167,18 @@ func TestContainerHidingBoth(t *testing.T) {
 		}
 	})
 }
+
+func TestContainerFilteringEnv(t *testing.T) {
+	const hostID = "scope"
+	filter, err := docker.NewEnvFilter("", "FOO", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := docker.NewContainer(container1, hostID, false, false, filter)
+	node := c.GetNode()
+	node.Latest.ForEach(func(k string, _ time.Time, v string) {
+		if strings.Contains(v, "secret-bar") {
+			t.Errorf("Found denied environment variable in node")
+		}
+	})
+}
@@ -1,6 +1,11 @@
 package docker
 
 import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
 	docker_client "github.com/fsouza/go-dockerclient"
 
 	log "github.com/Sirupsen/logrus"
@@ -20,6 +25,7 @@ const (
 	RemoveContainer  = report.DockerRemoveContainer
 	AttachContainer  = report.DockerAttachContainer
 	ExecContainer    = report.DockerExecContainer
+	PullImage        = report.DockerPullImage
 	ResizeExecTTY    = "docker_resize_exec_tty"
 
 	waitTime = 10
@@ -182,6 +188,76 @@ func (r *registry) resizeExecTTY(pipeID string, height, width uint) xfer.Respons
 	return xfer.Response{}
 }
 
+// pullImage is a job, pulling the image the container was made from
+// afresh, as that can take minutes.
+func (r *registry) pullImage(containerID string, req xfer.Request) xfer.Response {
+	c, ok := r.GetContainer(containerID)
+	if !ok {
+		return xfer.ResponseErrorf("Not found: %s", containerID)
+	}
+	image := c.Container().Config.Image
+	opts := docker_client.PullImageOptions{Repository: image, RawJSONStream: true}
+	if !strings.Contains(image, "@") {
+		// Images by digest have no tag
+		opts.Repository, opts.Tag = docker_client.ParseRepositoryTag(image)
+	}
+	return controls.Job(r.pipes, func(req xfer.Request, progress controls.Progress) xfer.Response {
+		log.Infof("Pulling image %s of container %s", image, containerID)
+		reader, writer := io.Pipe()
+		followed := make(chan struct{})
+		go func() {
+			defer close(followed)
+			followPull(reader, progress)
+		}()
+		opts.OutputStream = writer
+		err := r.client.PullImage(opts, docker_client.AuthConfiguration{})
+		writer.Close()
+		<-followed
+		return xfer.ResponseError(err)
+	})(req)
+}
+
+// pullProgress is a message of the JSON stream of an image pull, for a
+// layer, if it has an ID.
+type pullProgress struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+// followPull tells the progress of an image pull, from its JSON stream,
+// as how much of the layers being downloaded is.
+func followPull(r io.Reader, progress controls.Progress) {
+	var (
+		decoder = json.NewDecoder(r)
+		current = map[string]int64{}
+		total   = map[string]int64{}
+	)
+	for {
+		var msg pullProgress
+		if err := decoder.Decode(&msg); err != nil {
+			io.Copy(ioutil.Discard, r)
+			return
+		}
+		if msg.ID != "" && msg.ProgressDetail.Total > 0 {
+			current[msg.ID], total[msg.ID] = msg.ProgressDetail.Current, msg.ProgressDetail.Total
+		}
+		var sumCurrent, sumTotal int64
+		for id := range total {
+			sumCurrent += current[id]
+			sumTotal += total[id]
+		}
+		percent := 0
+		if sumTotal > 0 {
+			percent = int(100 * sumCurrent / sumTotal)
+		}
+		progress(strings.TrimSpace(msg.ID+" "+msg.Status), percent)
+	}
+}
+
 func captureContainerID(f func(string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
 	return func(req xfer.Request) xfer.Response {
 		containerID, ok := report.ParseContainerNodeID(req.NodeID)
@@ -202,6 +278,7 @@ func (r *registry) registerControls() {
 		RemoveContainer:  captureContainerID(r.removeContainer),
 		AttachContainer:  captureContainerID(r.attachContainer),
 		ExecContainer:    captureContainerID(r.execContainer),
+		PullImage:        captureContainerID(r.pullImage),
 		ResizeExecTTY:    xfer.ResizeTTYControlWrapper(r.resizeExecTTY),
 	}
 	r.handlerRegistry.Batch(nil, controls)
@@ -217,6 +294,7 @@ func (r *registry) deregisterControls() {
 		RemoveContainer,
 		AttachContainer,
 		ExecContainer,
+		PullImage,
 		ResizeExecTTY,
 	}
 	r.handlerRegistry.Batch(controls, nil)
@@ -1,6 +1,7 @@
 package docker_test
 
 import (
+	"encoding/json"
 	"io"
 	"reflect"
 	"testing"
@@ -44,6 +45,58 @@ func TestControls(t *testing.T) {
 	})
 }
 
+func TestPullImage(t *testing.T) {
+	oldNewPipe := controls.NewPipe
+	defer func() { controls.NewPipe = oldNewPipe }()
+	pipe := xfer.NewPipe()
+	controls.NewPipe = func(_ controls.PipeClient, _ string) (string, xfer.Pipe, error) {
+		return "pipeid", pipe, nil
+	}
+
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		hr := controls.NewDefaultHandlerRegistry()
+		registry, _ := docker.NewRegistry(docker.RegistryOptions{
+			Interval:        10 * time.Second,
+			HandlerRegistry: hr,
+		})
+		defer registry.Stop()
+
+		test.Poll(t, 100*time.Millisecond, true, func() interface{} {
+			_, ok := registry.GetContainer("ping")
+			return ok
+		})
+
+		// Pulls are jobs, telling how much of the layers is downloaded
+		result := hr.HandleControlRequest(xfer.Request{
+			Control: docker.PullImage,
+			NodeID:  report.MakeContainerNodeID("ping"),
+		})
+		if !result.Job || result.Pipe != "pipeid" {
+			t.Fatalf("pull returned %+v", result)
+		}
+		_, remote := pipe.Ends()
+		decoder := json.NewDecoder(remote)
+		var have []xfer.JobUpdate
+		for {
+			var update xfer.JobUpdate
+			if err := decoder.Decode(&update); err != nil {
+				break
+			}
+			have = append(have, update)
+		}
+		want := []xfer.JobUpdate{
+			{Message: "latest Pulling from library/foo", Percent: 0},
+			{Message: "a Downloading", Percent: 25},
+			{Message: "b Downloading", Percent: 50},
+			{Percent: 100, Result: &xfer.Response{}},
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Error(commonTest.Diff(want, have))
+		}
+	})
+}
+
 type mockPipe struct{}
 
 func (mockPipe) Ends() (io.ReadWriter, io.ReadWriter)                { return nil, nil }
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MaskedValue stands for the values of environment variables which look
+// like secrets.
+const MaskedValue = "<masked>"
+
+var (
+	// secretNames are the names of environment variables whose values
+	// are secrets, as in DB_PASSWORD or GITHUB_TOKEN.
+	secretNames = regexp.MustCompile(`(?i)(PASS(WORD|WD|PHRASE)?|SECRET|TOKEN|CREDENTIALS?|PRIVATE|API_?KEY|ACCESS_?KEY|AUTH|SESSION|COOKIE|SALT|(^|_)KEY$)`)
+	// secretValues are values which are secrets whatever the variable:
+	// private keys, AWS access keys, JWTs, and GitHub and Slack tokens.
+	secretValues = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----|\bAKIA[0-9A-Z]{16}\b|^eyJ[\w-]+\.[\w-]+\.[\w-]+$|\bgh[pousr]_[A-Za-z0-9]{36}\b|\bxox[abprs]-[A-Za-z0-9-]+`)
+	// urlPasswords are the passwords of URLs, as in
+	// postgres://user:password@db/name, which are masked on their own.
+	urlPasswords = regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/:@\s]*:)[^/@\s]+@`)
+)
+
+// EnvFilter decides which environment variables of containers are
+// reported, and masks the values of those which look like secrets, before
+// they leave the probe. Variables are reported if their names match any of
+// the allowed patterns, or there are none, and none of the denied ones.
+type EnvFilter struct {
+	allow, deny []string
+	mask        bool
+}
+
+// NewEnvFilter makes a new EnvFilter, of the comma separated patterns of
+// the names of variables to allow and deny, as in "AWS_*,PATH", masking
+// secret-like values if mask is set.
+func NewEnvFilter(allow, deny string, mask bool) (*EnvFilter, error) {
+	f := &EnvFilter{mask: mask}
+	var err error
+	if f.allow, err = envPatterns(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = envPatterns(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func envPatterns(s string) ([]string, error) {
+	var result []string
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid environment variable pattern %q: %v", pattern, err)
+		}
+		result = append(result, pattern)
+	}
+	return result, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the environment variables to report, of env. A nil
+// EnvFilter reports them all as they are.
+func (f *EnvFilter) Filter(env map[string]string) map[string]string {
+	if f == nil {
+		return env
+	}
+	result := make(map[string]string, len(env))
+	for name, value := range env {
+		if (len(f.allow) > 0 && !matchesAny(f.allow, name)) || matchesAny(f.deny, name) {
+			continue
+		}
+		if f.mask {
+			value = maskSecret(name, value)
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// maskSecret returns the value of the variable, masked if it looks like a
+// secret.
+func maskSecret(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretNames.MatchString(name) || secretValues.MatchString(value) {
+		return MaskedValue
+	}
+	return urlPasswords.ReplaceAllString(value, "${1}"+MaskedValue+"@")
+}
@@ -2,6 +2,7 @@ package docker
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -9,6 +10,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/armon/go-radix"
 	docker_client "github.com/fsouza/go-dockerclient"
+	"github.com/weaveworks/common/mtime"
 
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
@@ -44,6 +46,7 @@ type Registry interface {
 	GetContainer(string) (Container, bool)
 	GetContainerByPrefix(string) (Container, bool)
 	GetContainerImage(string) (docker_client.APIImages, bool)
+	TakeTombstones() []report.Node
 }
 
 // ContainerUpdateWatcher is the type of functions that get called when containers are updated.
@@ -60,6 +63,8 @@ type registry struct {
 	handlerRegistry        *controls.HandlerRegistry
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
+	envFilter              *EnvFilter
+	shortLived             time.Duration
 
 	watchers        []ContainerUpdateWatcher
 	containers      *radix.Tree
@@ -67,8 +72,13 @@ type registry struct {
 	images          map[string]docker_client.APIImages
 	networks        []docker_client.Network
 	pipeIDToexecID  map[string]string
+	tombstones      map[string]report.Node
 }
 
+// maxTombstones bounds how many short-lived containers are buffered
+// between reports, should nothing take them.
+const maxTombstones = 1000
+
 // Client interface for mocking.
 type Client interface {
 	ListContainers(docker_client.ListContainersOptions) ([]docker_client.APIContainers, error)
@@ -89,6 +99,7 @@ type Client interface {
 	StartExecNonBlocking(string, docker_client.StartExecOptions) (docker_client.CloseWaiter, error)
 	Stats(docker_client.StatsOptions) error
 	ResizeExecTTY(id string, height, width int) error
+	PullImage(docker_client.PullImageOptions, docker_client.AuthConfiguration) error
 }
 
 func newDockerClient(endpoint string) (Client, error) {
@@ -108,6 +119,12 @@ type RegistryOptions struct {
 	DockerEndpoint         string
 	NoCommandLineArguments bool
 	NoEnvironmentVariables bool
+	// EnvFilter filters the environment variables of containers, if not nil
+	EnvFilter *EnvFilter
+	// ShortLived is how long containers live at most to be reported as
+	// tombstones once they exit, so those starting and exiting between
+	// reports are seen. Zero disables tombstones.
+	ShortLived time.Duration
 }
 
 // NewRegistry returns a usable Registry. Don't forget to Stop it.
@@ -122,6 +139,7 @@ func NewRegistry(options RegistryOptions) (Registry, error) {
 		containersByPID: map[int]Container{},
 		images:          map[string]docker_client.APIImages{},
 		pipeIDToexecID:  map[string]string{},
+		tombstones:      map[string]report.Node{},
 
 		client:          client,
 		pipes:           options.Pipes,
@@ -132,6 +150,8 @@ func NewRegistry(options RegistryOptions) (Registry, error) {
 		quit:            make(chan chan struct{}),
 		noCommandLineArguments: options.NoCommandLineArguments,
 		noEnvironmentVariables: options.NoEnvironmentVariables,
+		envFilter:              options.EnvFilter,
+		shortLived:             options.ShortLived,
 	}
 
 	r.registerControls()
@@ -305,6 +325,81 @@ func (r *registry) handleEvent(event *docker_client.APIEvents) {
 	case CreateEvent, RenameEvent, StartEvent, DieEvent, DestroyEvent, PauseEvent, UnpauseEvent, NetworkConnectEvent, NetworkDisconnectEvent:
 		r.updateContainerState(event.ID, stateAfterEvent(event.Status))
 	}
+	if event.Status == DieEvent {
+		r.recordTombstone(event)
+	}
+}
+
+// recordTombstone buffers an exited container node for the next report, if
+// the container of the die event lived less than shortLived, as it may be
+// removed before then.
+func (r *registry) recordTombstone(event *docker_client.APIEvents) {
+	if r.shortLived <= 0 {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if len(r.tombstones) >= maxTombstones {
+		return
+	}
+
+	exitCode := event.Actor.Attributes["exitCode"]
+	diedAt := mtime.Now()
+	if event.TimeNano != 0 {
+		diedAt = time.Unix(0, event.TimeNano)
+	} else if event.Time != 0 {
+		diedAt = time.Unix(event.Time, 0)
+	}
+
+	var node report.Node
+	if o, ok := r.containers.Get(event.ID); ok {
+		c := o.(Container)
+		state := c.Container().State
+		if !state.StartedAt.IsZero() && diedAt.Sub(state.StartedAt) >= r.shortLived {
+			return
+		}
+		if exitCode == "" {
+			exitCode = strconv.Itoa(state.ExitCode)
+		}
+		node = c.GetNode()
+	} else {
+		// The container is already gone, so all there is to go on are
+		// the attributes of the event.
+		node = report.MakeNodeWith(report.MakeContainerNodeID(event.ID), map[string]string{
+			ContainerID:   event.ID,
+			ContainerName: strings.TrimPrefix(event.Actor.Attributes["name"], "/"),
+		})
+		labels := map[string]string{}
+		for k, v := range event.Actor.Attributes {
+			switch k {
+			case "name", "image", "exitCode":
+			default:
+				labels[k] = v
+			}
+		}
+		node = node.AddPrefixPropertyList(LabelPrefix, labels)
+	}
+	if exitCode == "" {
+		exitCode = "0"
+	}
+	r.tombstones[event.ID] = node.WithLatests(map[string]string{
+		ContainerState:      StateExited,
+		ContainerStateHuman: fmt.Sprintf("Exited (%s)", exitCode),
+		ContainerExitCode:   exitCode,
+	})
+}
+
+// TakeTombstones returns the nodes of the short-lived containers which
+// exited since it was last called, and forgets them.
+func (r *registry) TakeTombstones() []report.Node {
+	r.Lock()
+	defer r.Unlock()
+	result := make([]report.Node, 0, len(r.tombstones))
+	for _, node := range r.tombstones {
+		result = append(result, node)
+	}
+	r.tombstones = map[string]report.Node{}
+	return result
 }
 
 func stateAfterEvent(event string) *string {
@@ -358,7 +453,7 @@ func (r *registry) updateContainerState(containerID string, intendedState *strin
 	o, ok := r.containers.Get(containerID)
 	var c Container
 	if !ok {
-		c = NewContainerStub(dockerContainer, r.hostID, r.noCommandLineArguments, r.noEnvironmentVariables)
+		c = NewContainerStub(dockerContainer, r.hostID, r.noCommandLineArguments, r.noEnvironmentVariables, r.envFilter)
 		r.containers.Insert(containerID, c)
 	} else {
 		c = o.(Container)
@@ -176,6 +176,13 @@ func (m *mockDockerClient) ResizeExecTTY(id string, height, width int) error {
 	return fmt.Errorf("resizeExecTTY")
 }
 
+func (m *mockDockerClient) PullImage(opts client.PullImageOptions, _ client.AuthConfiguration) error {
+	fmt.Fprint(opts.OutputStream, `{"status": "Pulling from library/foo", "id": "latest"}`)
+	fmt.Fprint(opts.OutputStream, `{"status": "Downloading", "id": "a", "progressDetail": {"current": 1, "total": 4}}`)
+	fmt.Fprint(opts.OutputStream, `{"status": "Downloading", "id": "b", "progressDetail": {"current": 3, "total": 4}}`)
+	return nil
+}
+
 type mockCloseWaiter struct{}
 
 func (mockCloseWaiter) Close() error { return nil }
@@ -305,7 +312,7 @@ func setupStubs(mdc *mockDockerClient, f func()) {
 		return mdc, nil
 	}
 
-	docker.NewContainerStub = func(c *client.Container, _ string, _ bool, _ bool) docker.Container {
+	docker.NewContainerStub = func(c *client.Container, _ string, _ bool, _ bool, _ *docker.EnvFilter) docker.Container {
 		return &mockContainer{c}
 	}
 
@@ -516,6 +523,64 @@ func TestRegistryDelete(t *testing.T) {
 	})
 }
 
+func TestRegistryTombstones(t *testing.T) {
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		registry, _ := docker.NewRegistry(docker.RegistryOptions{
+			Interval:        10 * time.Second,
+			HandlerRegistry: controls.NewDefaultHandlerRegistry(),
+			ShortLived:      time.Minute,
+		})
+		defer registry.Stop()
+		runtime.Gosched()
+
+		// A container which started and exited, and was removed, before
+		// being inspected.
+		mdc.send(&client.APIEvents{
+			Status:   docker.DieEvent,
+			ID:       "crashed",
+			TimeNano: time.Now().UnixNano(),
+			Actor: client.APIActor{
+				ID: "crashed",
+				Attributes: map[string]string{
+					"name":     "job",
+					"image":    "busybox",
+					"exitCode": "137",
+					"app":      "batch",
+				},
+			},
+		})
+
+		var tombstones []report.Node
+		test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+			tombstones = append(tombstones, registry.TakeTombstones()...)
+			return len(tombstones)
+		})
+		node := tombstones[0]
+		if node.ID != report.MakeContainerNodeID("crashed") {
+			t.Errorf("Expected the node of the container, got %s", node.ID)
+		}
+		for key, want := range map[string]string{
+			docker.ContainerName:       "job",
+			docker.ContainerState:      docker.StateExited,
+			docker.ContainerExitCode:   "137",
+			docker.LabelPrefix + "app": "batch",
+			docker.ContainerStateHuman: "Exited (137)",
+		} {
+			if have, _ := node.Latest.Lookup(key); have != want {
+				t.Errorf("Expected %s of %q, got %q", key, want, have)
+			}
+		}
+		if _, ok := node.Latest.Lookup(docker.LabelPrefix + "image"); ok {
+			t.Errorf("Expected the image not to be a label")
+		}
+
+		if have := registry.TakeTombstones(); len(have) != 0 {
+			t.Errorf("Expected tombstones to be taken once, got %v", have)
+		}
+	})
+}
+
 func TestDockerImageName(t *testing.T) {
 	for _, input := range []struct{ in, name string }{
 		{"foo/bar", "foo/bar"},
@@ -34,6 +34,7 @@ var (
 		ContainerStateHuman:   {ID: ContainerStateHuman, Label: "State", From: report.FromLatest, Priority: 3},
 		ContainerUptime:       {ID: ContainerUptime, Label: "Uptime", From: report.FromLatest, Priority: 4, Datatype: report.Duration},
 		ContainerRestartCount: {ID: ContainerRestartCount, Label: "Restart #", From: report.FromLatest, Priority: 5},
+		ContainerExitCode:     {ID: ContainerExitCode, Label: "Exit code", From: report.FromLatest, Priority: 5.5},
 		ContainerNetworks:     {ID: ContainerNetworks, Label: "Networks", From: report.FromSets, Priority: 6},
 		ContainerIPs:          {ID: ContainerIPs, Label: "IPs", From: report.FromSets, Priority: 7},
 		ContainerPorts:        {ID: ContainerPorts, Label: "Ports", From: report.FromSets, Priority: 8},
@@ -134,14 +135,38 @@ var (
 			Icon:  "fa-trash-o",
 			Rank:  8,
 		},
+		{
+			ID:    PullImage,
+			Human: "Pull image",
+			Icon:  "fa-download",
+			Rank:  9,
+		},
 	}
 
 	SwarmServiceMetadataTemplates = report.MetadataTemplates{
-		ServiceName:    {ID: ServiceName, Label: "Service Name", From: report.FromLatest, Priority: 0},
-		StackNamespace: {ID: StackNamespace, Label: "Stack Namespace", From: report.FromLatest, Priority: 1},
+		ServiceName:     {ID: ServiceName, Label: "Service Name", From: report.FromLatest, Priority: 0},
+		StackNamespace:  {ID: StackNamespace, Label: "Stack Namespace", From: report.FromLatest, Priority: 1},
+		ServiceMode:     {ID: ServiceMode, Label: "Mode", From: report.FromLatest, Priority: 2},
+		ServiceImage:    {ID: ServiceImage, Label: "Image", From: report.FromLatest, Priority: 3},
+		DesiredReplicas: {ID: DesiredReplicas, Label: "Desired Replicas", From: report.FromLatest, Priority: 4, Datatype: report.Number},
+		RunningReplicas: {ID: RunningReplicas, Label: "Running Replicas", From: report.FromLatest, Priority: 5, Datatype: report.Number},
 	}
 )
 
+// MetadataSchema describes the metadata keys of containers and services
+var MetadataSchema = report.MetadataSchema{
+	ContainerUptime:       {Type: report.Duration, Unit: "s"},
+	ContainerRestartCount: {Type: report.Number},
+	ContainerCreated:      {Type: report.DateTime},
+	ContainerID:           {Type: report.String, Truncate: 12},
+	DesiredReplicas:       {Type: report.Number},
+	RunningReplicas:       {Type: report.Number},
+}
+
+func init() {
+	report.RegisterMetadataSchema(MetadataSchema)
+}
+
 // Reporter generate Reports containing Container and ContainerImage topologies
 type Reporter struct {
 	registry Registry
@@ -262,6 +287,14 @@ func (r *Reporter) containerTopology(localAddrs []net.IP) report.Topology {
 		}
 	}
 
+	// Containers which started and exited since the last report, and may
+	// be gone already, are reported as exited.
+	for _, node := range r.registry.TakeTombstones() {
+		if _, ok := result.Nodes[node.ID]; !ok {
+			result.AddNode(node.WithLatests(metadata))
+		}
+	}
+
 	return result
 }
 
@@ -13,6 +13,7 @@ import (
 type mockRegistry struct {
 	containersByPID map[int]docker.Container
 	images          map[string]client.APIImages
+	tombstones      []report.Node
 	networks        []client.Network
 }
 
@@ -44,7 +45,14 @@ func (r *mockRegistry) WalkNetworks(f func(client.Network)) {
 
 func (r *mockRegistry) WatchContainerUpdates(_ docker.ContainerUpdateWatcher) {}
 
-func (r *mockRegistry) GetContainer(_ string) (docker.Container, bool) { return nil, false }
+func (r *mockRegistry) GetContainer(id string) (docker.Container, bool) {
+	for _, c := range r.containersByPID {
+		if c.ID() == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
 
 func (r *mockRegistry) GetContainerByPrefix(_ string) (docker.Container, bool) { return nil, false }
 
@@ -53,6 +61,12 @@ func (r *mockRegistry) GetContainerImage(id string) (client.APIImages, bool) {
 	return image, ok
 }
 
+func (r *mockRegistry) TakeTombstones() []report.Node {
+	result := r.tombstones
+	r.tombstones = nil
+	return result
+}
+
 var (
 	imageID              = "baz"
 	mockRegistryInstance = &mockRegistry{
@@ -147,3 +161,49 @@ func TestReporter(t *testing.T) {
 
 	}
 }
+
+func TestReporterTombstones(t *testing.T) {
+	tombstone := report.MakeNodeWith(report.MakeContainerNodeID("crashed"), map[string]string{
+		docker.ContainerID:       "crashed",
+		docker.ContainerState:    docker.StateExited,
+		docker.ContainerExitCode: "1",
+	})
+	registry := &mockRegistry{
+		containersByPID: map[int]docker.Container{
+			2: &mockContainer{container1},
+		},
+		tombstones: []report.Node{
+			tombstone,
+			// A container still known of is reported as it is.
+			report.MakeNodeWith(report.MakeContainerNodeID("ping"), map[string]string{
+				docker.ContainerState: docker.StateExited,
+			}),
+		},
+	}
+	rpt, err := docker.NewReporter(registry, "host1", "probe", nil).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, ok := rpt.Container.Nodes[tombstone.ID]
+	if !ok {
+		t.Fatalf("Expected report to have tombstone %q", tombstone.ID)
+	}
+	if have, _ := node.Latest.Lookup(docker.ContainerExitCode); have != "1" {
+		t.Errorf("Expected exit code 1, got %q", have)
+	}
+	if have, _ := node.Latest.Lookup(report.ControlProbeID); have != "probe" {
+		t.Errorf("Expected control probe ID, got %q", have)
+	}
+	if have, _ := rpt.Container.Nodes[report.MakeContainerNodeID("ping")].Latest.Lookup(docker.ContainerState); have == docker.StateExited {
+		t.Errorf("Expected the known container not to be replaced by its tombstone")
+	}
+
+	rpt, err = docker.NewReporter(registry, "host1", "probe", nil).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rpt.Container.Nodes[tombstone.ID]; ok {
+		t.Errorf("Expected tombstones to be reported once")
+	}
+}
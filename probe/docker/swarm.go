@@ -0,0 +1,167 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/engine-api/types/swarm"
+)
+
+const (
+	defaultDockerHost = "unix:///var/run/docker.sock"
+	// Swarm mode appeared in API version 1.24
+	swarmAPIVersion = "v1.24"
+	swarmTimeout    = 10 * time.Second
+)
+
+// SwarmInfo is the Swarm mode status of the local docker daemon.
+type SwarmInfo struct {
+	NodeID           string
+	LocalNodeState   string
+	ControlAvailable bool
+}
+
+// Manager reports whether the local daemon is a manager of an active
+// swarm, and so can tell us about services and tasks.
+func (i SwarmInfo) Manager() bool {
+	return i.LocalNodeState == "active" && i.ControlAvailable
+}
+
+// SwarmClient talks to the Swarm mode endpoints of the docker API, which
+// the vendored docker client predates. Exported for mocking.
+type SwarmClient interface {
+	Info() (SwarmInfo, error)
+	ListServices() ([]swarm.Service, error)
+	ListTasks() ([]swarm.Task, error)
+	ListNodes() ([]swarm.Node, error)
+	// ScaleService changes the number of replicas of a replicated service
+	// by amount.
+	ScaleService(serviceID string, amount int) error
+}
+
+// NewSwarmClientStub is used for testing
+var NewSwarmClientStub = newSwarmClient
+
+type swarmClient struct {
+	base       string
+	httpClient *http.Client
+}
+
+// newSwarmClient makes a SwarmClient for the docker daemon at endpoint, or
+// at $DOCKER_HOST if endpoint is empty. TLS isn't supported.
+func newSwarmClient(endpoint string) (SwarmClient, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("DOCKER_HOST")
+	}
+	if endpoint == "" {
+		endpoint = defaultDockerHost
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c := &swarmClient{httpClient: &http.Client{Timeout: swarmTimeout}}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		c.httpClient.Transport = &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.DialTimeout("unix", socket, swarmTimeout)
+			},
+		}
+		c.base = "http://docker/" + swarmAPIVersion
+	case "tcp", "http":
+		c.base = "http://" + u.Host + "/" + swarmAPIVersion
+	default:
+		return nil, fmt.Errorf("unsupported docker endpoint %q", endpoint)
+	}
+	return c, nil
+}
+
+func (c *swarmClient) do(method, path string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var message struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&message)
+		return fmt.Errorf("docker: %s %s: %s %s", method, path, resp.Status, message.Message)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *swarmClient) Info() (SwarmInfo, error) {
+	var info struct {
+		Swarm SwarmInfo
+	}
+	err := c.do("GET", "/info", nil, &info)
+	return info.Swarm, err
+}
+
+func (c *swarmClient) ListServices() ([]swarm.Service, error) {
+	var services []swarm.Service
+	err := c.do("GET", "/services", nil, &services)
+	return services, err
+}
+
+func (c *swarmClient) ListTasks() ([]swarm.Task, error) {
+	var tasks []swarm.Task
+	err := c.do("GET", "/tasks", nil, &tasks)
+	return tasks, err
+}
+
+func (c *swarmClient) ListNodes() ([]swarm.Node, error) {
+	var nodes []swarm.Node
+	err := c.do("GET", "/nodes", nil, &nodes)
+	return nodes, err
+}
+
+// ScaleService updates the service spec as we got it, rather than through
+// the vendored types, so we don't drop the fields they don't know about.
+func (c *swarmClient) ScaleService(serviceID string, amount int) error {
+	var service struct {
+		Version swarm.Version
+		Spec    map[string]interface{}
+	}
+	if err := c.do("GET", "/services/"+url.PathEscape(serviceID), nil, &service); err != nil {
+		return err
+	}
+	mode, _ := service.Spec["Mode"].(map[string]interface{})
+	replicated, ok := mode["Replicated"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("service %s is not replicated", serviceID)
+	}
+	replicas, _ := replicated["Replicas"].(float64)
+	if replicas+float64(amount) < 0 {
+		return fmt.Errorf("service %s has no replicas left", serviceID)
+	}
+	replicated["Replicas"] = int64(replicas) + int64(amount)
+	buf, err := json.Marshal(service.Spec)
+	if err != nil {
+		return err
+	}
+	path := "/services/" + url.PathEscape(serviceID) + "/update?version=" + strconv.FormatUint(service.Version.Index, 10)
+	return c.do("POST", path, bytes.NewReader(buf), nil)
+}
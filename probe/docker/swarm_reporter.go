@@ -0,0 +1,229 @@
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types/swarm"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// Swarm service metadata keys and controls
+const (
+	ServiceMode      = report.DockerServiceMode
+	ServiceImage     = report.DockerServiceImage
+	DesiredReplicas  = report.DockerServiceDesiredReplicas
+	RunningReplicas  = report.DockerServiceRunningReplicas
+	ServiceScaleUp   = report.DockerServiceScaleUp
+	ServiceScaleDown = report.DockerServiceScaleDown
+
+	StackNamespaceLabel     = "com.docker.stack.namespace"
+	ServiceTasksTablePrefix = "docker_service_task_"
+
+	replicatedMode = "replicated"
+	globalMode     = "global"
+)
+
+// Exposed for testing
+var (
+	SwarmServiceTableTemplates = report.TableTemplates{
+		ServiceTasksTablePrefix: {
+			ID:     ServiceTasksTablePrefix,
+			Label:  "Tasks",
+			Type:   report.MulticolumnTableType,
+			Prefix: ServiceTasksTablePrefix,
+			Columns: []report.Column{
+				{ID: "slot", Label: "Task"},
+				{ID: "node", Label: "Node"},
+				{ID: "desired_state", Label: "Desired State"},
+				{ID: "state", Label: "State"},
+				{ID: "error", Label: "Error"},
+			},
+		},
+	}
+
+	SwarmServiceControls = []report.Control{
+		{
+			ID:    ServiceScaleDown,
+			Human: "Scale Down",
+			Icon:  "fa-minus",
+			Rank:  0,
+		},
+		{
+			ID:    ServiceScaleUp,
+			Human: "Scale Up",
+			Icon:  "fa-plus",
+			Rank:  1,
+		},
+	}
+)
+
+// stackServiceName returns the stack of a service, and its name within the
+// stack: docker stack deploy prefixes the names of services with the stack.
+func stackServiceName(stackNamespace, serviceName string) (string, string) {
+	if stackNamespace == "" {
+		return DefaultNamespace, serviceName
+	}
+	return stackNamespace, strings.TrimPrefix(serviceName, stackNamespace+"_")
+}
+
+// SwarmReporter reports the services of a swarm, with the status of their
+// tasks, when the local docker daemon is a swarm manager. Containers are
+// tied to their services by the Tagger, on every node of the swarm.
+type SwarmReporter struct {
+	client          SwarmClient
+	probeID         string
+	handlerRegistry *controls.HandlerRegistry
+}
+
+// NewSwarmReporter makes a new SwarmReporter
+func NewSwarmReporter(client SwarmClient, probeID string, handlerRegistry *controls.HandlerRegistry) *SwarmReporter {
+	r := &SwarmReporter{
+		client:          client,
+		probeID:         probeID,
+		handlerRegistry: handlerRegistry,
+	}
+	r.handlerRegistry.Batch(nil, map[string]xfer.ControlHandlerFunc{
+		ServiceScaleUp:   captureServiceID(r.scaleUp),
+		ServiceScaleDown: captureServiceID(r.scaleDown),
+	})
+	return r
+}
+
+// Stop unregisters the controls.
+func (r *SwarmReporter) Stop() {
+	r.handlerRegistry.Batch([]string{ServiceScaleUp, ServiceScaleDown}, nil)
+}
+
+// Name of this reporter, for metrics gathering
+func (SwarmReporter) Name() string { return "Swarm" }
+
+// Report generates a Report containing the SwarmService topology
+func (r *SwarmReporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	topology := report.MakeTopology().
+		WithMetadataTemplates(SwarmServiceMetadataTemplates).
+		WithTableTemplates(SwarmServiceTableTemplates)
+	topology.Controls.AddControls(SwarmServiceControls)
+
+	info, err := r.client.Info()
+	if err != nil {
+		log.Errorf("Swarm: cannot get swarm status: %v", err)
+	}
+	if err != nil || !info.Manager() {
+		result.SwarmService = result.SwarmService.Merge(topology)
+		return result, nil
+	}
+
+	services, err := r.client.ListServices()
+	if err != nil {
+		return result, err
+	}
+	tasks, err := r.client.ListTasks()
+	if err != nil {
+		return result, err
+	}
+	nodes, err := r.client.ListNodes()
+	if err != nil {
+		return result, err
+	}
+	hostnames := map[string]string{}
+	for _, n := range nodes {
+		hostnames[n.ID] = n.Description.Hostname
+	}
+	serviceTasks := map[string][]swarm.Task{}
+	for _, t := range tasks {
+		serviceTasks[t.ServiceID] = append(serviceTasks[t.ServiceID], t)
+	}
+
+	for _, s := range services {
+		topology.AddNode(r.serviceNode(s, serviceTasks[s.ID], hostnames))
+	}
+	result.SwarmService = result.SwarmService.Merge(topology)
+	return result, nil
+}
+
+func (r *SwarmReporter) serviceNode(s swarm.Service, tasks []swarm.Task, hostnames map[string]string) report.Node {
+	stackNamespace, serviceName := stackServiceName(s.Spec.Labels[StackNamespaceLabel], s.Spec.Name)
+	mode, desired := globalMode, 0
+	if replicated := s.Spec.Mode.Replicated; replicated != nil {
+		mode = replicatedMode
+		if replicated.Replicas != nil {
+			desired = int(*replicated.Replicas)
+		}
+	}
+
+	var (
+		active, running int
+		rows            []report.Row
+	)
+	for _, t := range tasks {
+		// Tasks which were replaced are kept around for a while, as history
+		if t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		active++
+		if t.Status.State == swarm.TaskStateRunning {
+			running++
+		}
+		slot := fmt.Sprintf("%s.%d", serviceName, t.Slot)
+		if mode == globalMode {
+			// Global services have a task per node, rather than slots
+			slot = fmt.Sprintf("%s.%s", serviceName, hostnames[t.NodeID])
+		}
+		rows = append(rows, report.Row{
+			ID: t.ID,
+			Entries: map[string]string{
+				"slot":          slot,
+				"node":          hostnames[t.NodeID],
+				"desired_state": string(t.DesiredState),
+				"state":         string(t.Status.State),
+				"error":         t.Status.Err,
+			},
+		})
+	}
+	if mode == globalMode {
+		desired = active
+	}
+
+	return report.MakeNodeWith(report.MakeSwarmServiceNodeID(s.ID), map[string]string{
+		ServiceName:           serviceName,
+		StackNamespace:        stackNamespace,
+		ServiceMode:           mode,
+		ServiceImage:          s.Spec.TaskTemplate.ContainerSpec.Image,
+		DesiredReplicas:       strconv.Itoa(desired),
+		RunningReplicas:       strconv.Itoa(running),
+		report.ControlProbeID: r.probeID,
+	}).
+		AddPrefixMulticolumnTable(ServiceTasksTablePrefix, rows).
+		WithLatestControls(map[string]report.NodeControlData{
+			// Global services run a task on every node, there's nothing to scale
+			ServiceScaleUp:   {Dead: mode == globalMode},
+			ServiceScaleDown: {Dead: mode == globalMode || desired == 0},
+		})
+}
+
+func captureServiceID(f func(string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		serviceID, ok := report.ParseSwarmServiceNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		return f(serviceID, req)
+	}
+}
+
+func (r *SwarmReporter) scaleUp(serviceID string, _ xfer.Request) xfer.Response {
+	log.Infof("Scaling up service %s", serviceID)
+	return xfer.ResponseError(r.client.ScaleService(serviceID, 1))
+}
+
+func (r *SwarmReporter) scaleDown(serviceID string, _ xfer.Request) xfer.Response {
+	log.Infof("Scaling down service %s", serviceID)
+	return xfer.ResponseError(r.client.ScaleService(serviceID, -1))
+}
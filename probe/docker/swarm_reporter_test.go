@@ -0,0 +1,170 @@
+package docker_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/engine-api/types/swarm"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockSwarmClient struct {
+	info     docker.SwarmInfo
+	services []swarm.Service
+	tasks    []swarm.Task
+	nodes    []swarm.Node
+	scaled   map[string]int
+}
+
+func (c *mockSwarmClient) Info() (docker.SwarmInfo, error)        { return c.info, nil }
+func (c *mockSwarmClient) ListServices() ([]swarm.Service, error) { return c.services, nil }
+func (c *mockSwarmClient) ListTasks() ([]swarm.Task, error)       { return c.tasks, nil }
+func (c *mockSwarmClient) ListNodes() ([]swarm.Node, error)       { return c.nodes, nil }
+func (c *mockSwarmClient) ScaleService(serviceID string, amount int) error {
+	c.scaled[serviceID] += amount
+	return nil
+}
+
+func newMockSwarmClient() *mockSwarmClient {
+	replicas := uint64(3)
+	return &mockSwarmClient{
+		info: docker.SwarmInfo{NodeID: "node1", LocalNodeState: "active", ControlAvailable: true},
+		services: []swarm.Service{
+			{
+				ID: "web1",
+				Spec: swarm.ServiceSpec{
+					Annotations:  swarm.Annotations{Name: "shop_web", Labels: map[string]string{docker.StackNamespaceLabel: "shop"}},
+					TaskTemplate: swarm.TaskSpec{ContainerSpec: swarm.ContainerSpec{Image: "nginx:1.13"}},
+					Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+				},
+			},
+			{
+				ID: "agent1",
+				Spec: swarm.ServiceSpec{
+					Annotations: swarm.Annotations{Name: "agent"},
+					Mode:        swarm.ServiceMode{Global: &swarm.GlobalService{}},
+				},
+			},
+		},
+		tasks: []swarm.Task{
+			{ID: "t1", ServiceID: "web1", Slot: 1, NodeID: "node1", DesiredState: swarm.TaskStateRunning, Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+			{ID: "t2", ServiceID: "web1", Slot: 2, NodeID: "node2", DesiredState: swarm.TaskStateRunning, Status: swarm.TaskStatus{State: swarm.TaskStatePreparing}},
+			{ID: "t0", ServiceID: "web1", Slot: 2, NodeID: "node2", DesiredState: swarm.TaskStateShutdown, Status: swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "oom"}},
+			{ID: "t3", ServiceID: "agent1", NodeID: "node1", DesiredState: swarm.TaskStateRunning, Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+		},
+		nodes: []swarm.Node{
+			{ID: "node1", Description: swarm.NodeDescription{Hostname: "host1"}},
+			{ID: "node2", Description: swarm.NodeDescription{Hostname: "host2"}},
+		},
+		scaled: map[string]int{},
+	}
+}
+
+func TestSwarmReporter(t *testing.T) {
+	client := newMockSwarmClient()
+	hr := controls.NewDefaultHandlerRegistry()
+	reporter := docker.NewSwarmReporter(client, "probe1", hr)
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web, ok := rpt.SwarmService.Nodes[report.MakeSwarmServiceNodeID("web1")]
+	if !ok {
+		t.Fatalf("Expected service web1, got %v", rpt.SwarmService.Nodes)
+	}
+	for key, want := range map[string]string{
+		docker.ServiceName:     "web",
+		docker.StackNamespace:  "shop",
+		docker.ServiceMode:     "replicated",
+		docker.ServiceImage:    "nginx:1.13",
+		docker.DesiredReplicas: "3",
+		docker.RunningReplicas: "1",
+	} {
+		if have, _ := web.Latest.Lookup(key); have != want {
+			t.Errorf("Expected %s to be %q, got %q", key, want, have)
+		}
+	}
+	rows := web.ExtractMulticolumnTable(docker.SwarmServiceTableTemplates[docker.ServiceTasksTablePrefix])
+	if len(rows) != 2 {
+		t.Fatalf("Expected the two current tasks, got %v", rows)
+	}
+	if rows[1].ID != "t2" || rows[1].Entries["slot"] != "web.2" || rows[1].Entries["node"] != "host2" || rows[1].Entries["state"] != "preparing" {
+		t.Errorf("Unexpected task row: %v", rows[1])
+	}
+
+	agent := rpt.SwarmService.Nodes[report.MakeSwarmServiceNodeID("agent1")]
+	if desired, _ := agent.Latest.Lookup(docker.DesiredReplicas); desired != "1" {
+		t.Errorf("Expected a global service to desire a task per node, got %q", desired)
+	}
+	if scaleUp, _ := agent.LatestControls.Lookup(docker.ServiceScaleUp); !scaleUp.Dead {
+		t.Errorf("Expected a global service not to be scalable")
+	}
+
+	for _, control := range []string{docker.ServiceScaleUp, docker.ServiceScaleUp, docker.ServiceScaleDown} {
+		if res := hr.HandleControlRequest(xfer.Request{Control: control, NodeID: web.ID}); res.Error != "" {
+			t.Errorf("Unexpected error from %s: %s", control, res.Error)
+		}
+	}
+	if client.scaled["web1"] != 1 {
+		t.Errorf("Expected web1 to be scaled by 1, got %d", client.scaled["web1"])
+	}
+}
+
+func TestSwarmReporterWorker(t *testing.T) {
+	client := newMockSwarmClient()
+	client.info.ControlAvailable = false
+	reporter := docker.NewSwarmReporter(client, "probe1", controls.NewDefaultHandlerRegistry())
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.SwarmService.Nodes) != 0 {
+		t.Errorf("Expected workers not to report services, got %v", rpt.SwarmService.Nodes)
+	}
+}
+
+func TestSwarmClientScaleService(t *testing.T) {
+	var updated map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1.24/services/web1":
+			w.Write([]byte(`{"ID": "web1", "Version": {"Index": 42},
+				"Spec": {"Name": "web", "Mode": {"Replicated": {"Replicas": 3}}, "RollbackConfig": {"Parallelism": 1}}}`))
+		case r.Method == "POST" && r.URL.Path == "/v1.24/services/web1/update" && r.URL.Query().Get("version") == "42":
+			if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+				t.Error(err)
+			}
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := docker.NewSwarmClientStub("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ScaleService("web1", -1); err != nil {
+		t.Fatal(err)
+	}
+	replicas := updated["Mode"].(map[string]interface{})["Replicated"].(map[string]interface{})["Replicas"]
+	if replicas != 2.0 {
+		t.Errorf("Expected 2 replicas, got %v", replicas)
+	}
+	if _, ok := updated["RollbackConfig"]; !ok {
+		t.Errorf("Expected fields unknown to the vendored types to be kept, got %v", updated)
+	}
+}
@@ -2,7 +2,6 @@ package docker
 
 import (
 	"strconv"
-	"strings"
 
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
@@ -56,15 +55,8 @@ func (t *Tagger) Tag(r report.Report) (report.Report, error) {
 		if !ok {
 			continue
 		}
-		stackNamespace, ok := container.Latest.Lookup(LabelPrefix + "com.docker.stack.namespace")
-		if !ok {
-			stackNamespace = DefaultNamespace
-		} else {
-			prefix := stackNamespace + "_"
-			if strings.HasPrefix(serviceName, prefix) {
-				serviceName = serviceName[len(prefix):]
-			}
-		}
+		stackNamespace, _ := container.Latest.Lookup(LabelPrefix + StackNamespaceLabel)
+		stackNamespace, serviceName = stackServiceName(stackNamespace, serviceName)
 
 		nodeID := report.MakeSwarmServiceNodeID(serviceID)
 		node := report.MakeNodeWith(nodeID, map[string]string{
@@ -96,19 +88,27 @@ func (t *Tagger) tag(tree process.Tree, topology *report.Topology) {
 			candidate = int(pid)
 		)
 
-		t.registry.LockedPIDLookup(func(lookup func(int) Container) {
-			for {
-				c = lookup(candidate)
-				if c != nil {
-					break
-				}
-
-				candidate, err = tree.GetParent(candidate)
-				if err != nil {
-					break
+		// The cgroup of a process names its container, whatever namespaces
+		// it shares with the host, as processes of host-network pods do.
+		// Otherwise, look for the container of its nearest ancestor.
+		if id := tree.GetContainerID(candidate); id != "" {
+			c, _ = t.registry.GetContainer(id)
+		}
+		if c == nil {
+			t.registry.LockedPIDLookup(func(lookup func(int) Container) {
+				for {
+					c = lookup(candidate)
+					if c != nil {
+						break
+					}
+
+					candidate, err = tree.GetParent(candidate)
+					if err != nil {
+						break
+					}
 				}
-			}
-		})
+			})
+		}
 
 		if c == nil || ContainerIsStopped(c) || c.PID() == 1 {
 			continue
@@ -12,7 +12,8 @@ import (
 )
 
 type mockProcessTree struct {
-	parents map[int]int
+	parents    map[int]int
+	containers map[int]string
 }
 
 func (m *mockProcessTree) GetParent(pid int) (int, error) {
@@ -27,6 +28,10 @@ func (m *mockProcessTree) GetChildren(int) ([]int, error) {
 	panic("Not implemented")
 }
 
+func (m *mockProcessTree) GetContainerID(pid int) string {
+	return m.containers[pid]
+}
+
 func TestTagger(t *testing.T) {
 	mtime.NowForce(time.Now())
 	defer mtime.NowReset()
@@ -35,17 +40,21 @@ func TestTagger(t *testing.T) {
 	defer func() { docker.NewProcessTreeStub = oldProcessTree }()
 
 	docker.NewProcessTreeStub = func(_ process.Walker) (process.Tree, error) {
-		return &mockProcessTree{map[int]int{3: 2}}, nil
+		// 5 isn't a descendant of the container's process, but is in its
+		// cgroup, as processes of host-network pods may be
+		return &mockProcessTree{map[int]int{3: 2, 5: 1}, map[int]string{5: "ping"}}, nil
 	}
 
 	var (
 		pid1NodeID = report.MakeProcessNodeID("somehost.com", "2")
 		pid2NodeID = report.MakeProcessNodeID("somehost.com", "3")
+		pid3NodeID = report.MakeProcessNodeID("somehost.com", "5")
 	)
 
 	input := report.MakeReport()
 	input.Process.AddNode(report.MakeNodeWith(pid1NodeID, map[string]string{process.PID: "2"}))
 	input.Process.AddNode(report.MakeNodeWith(pid2NodeID, map[string]string{process.PID: "3"}))
+	input.Process.AddNode(report.MakeNodeWith(pid3NodeID, map[string]string{process.PID: "5"}))
 
 	have, err := docker.NewTagger(mockRegistryInstance, nil).Tag(input)
 	if err != nil {
@@ -53,7 +62,7 @@ func TestTagger(t *testing.T) {
 	}
 
 	// Processes should be tagged with their container ID, and parents
-	for _, nodeID := range []string{pid1NodeID, pid2NodeID} {
+	for _, nodeID := range []string{pid1NodeID, pid2NodeID, pid3NodeID} {
 		node, ok := have.Process.Nodes[nodeID]
 		if !ok {
 			t.Errorf("Expected process node %s, but not found", nodeID)
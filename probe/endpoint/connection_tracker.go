@@ -23,6 +23,7 @@ type connectionTrackerConfig struct {
 	ProcessCache *process.CachingWalker
 	Scanner      procspy.ConnectionScanner
 	DNSSnooper   *DNSSnooper
+	SampleSize   int
 }
 
 type connectionTracker struct {
@@ -33,6 +34,10 @@ type connectionTracker struct {
 
 	// time of the previous ebpf failure, or zero if it didn't fail
 	ebpfLastFailureTime time.Time
+
+	// sampler of the connections of the report being made, if they are
+	// sampled
+	sampler *connectionSampler
 }
 
 func newConnectionTracker(conf connectionTrackerConfig) connectionTracker {
@@ -82,9 +87,15 @@ func (t *connectionTracker) useProcfs() {
 	}
 }
 
-// ReportConnections calls trackers according to the configuration.
+// ReportConnections calls trackers according to the configuration. With a
+// SampleSize, only a sample of that many connections of each class is
+// reported, their source endpoints weighted by how many they stand for.
 func (t *connectionTracker) ReportConnections(rpt *report.Report) {
 	hostNodeID := report.MakeHostNodeID(t.conf.HostID)
+	if t.conf.SampleSize > 0 {
+		t.sampler = newConnectionSampler(t.conf.SampleSize, time.Now().UnixNano())
+		defer t.reportSampledConnections(rpt)
+	}
 
 	if t.ebpfTracker != nil {
 		if !t.ebpfTracker.isDead() {
@@ -213,6 +224,31 @@ func (t *connectionTracker) addConnection(rpt *report.Report, incoming bool, ft
 		ft = reverse(ft)
 		extraFromNode, extraToNode = extraToNode, extraFromNode
 	}
+	if t.sampler != nil {
+		t.sampler.add(sampledConnection{tuple: ft, namespaceID: namespaceID, extraFromNode: extraFromNode, extraToNode: extraToNode})
+		return
+	}
+	t.reportConnection(rpt, ft, namespaceID, extraFromNode, extraToNode)
+}
+
+// reportSampledConnections reports the connections sampled, weighting the
+// source endpoints of those standing for more than themselves.
+func (t *connectionTracker) reportSampledConnections(rpt *report.Report) {
+	sampler := t.sampler
+	t.sampler = nil
+	sampler.each(func(c sampledConnection, weight float64) {
+		extraFromNode := c.extraFromNode
+		if weight > 1 {
+			extraFromNode = map[string]string{SampleWeight: strconv.FormatFloat(weight, 'f', -1, 64)}
+			for k, v := range c.extraFromNode {
+				extraFromNode[k] = v
+			}
+		}
+		t.reportConnection(rpt, c.tuple, c.namespaceID, extraFromNode, c.extraToNode)
+	})
+}
+
+func (t *connectionTracker) reportConnection(rpt *report.Report, ft fourTuple, namespaceID string, extraFromNode, extraToNode map[string]string) {
 	var (
 		fromNode = t.makeEndpointNode(namespaceID, ft.fromAddr, ft.fromPort, extraFromNode)
 		toNode   = t.makeEndpointNode(namespaceID, ft.toAddr, ft.toPort, extraToNode)
@@ -75,6 +75,11 @@ func (br *backgroundReader) loop(walker process.Walker) {
 	for {
 		select {
 		case <-tickc:
+			if process.FidelityReduced() {
+				// Connections aren't matched to processes meanwhile
+				tickc = time.After(targetWalkTime)
+				continue
+			}
 			tickc = nil                      // turn off until the next loop
 			walkc = make(chan walkResult, 1) // turn on (need buffered so we don't leak performWalk)
 			begin = time.Now()               // reset counter
@@ -42,7 +42,7 @@ func (s *darwinScanner) Connections() (ConnIter, error) {
 	}
 	connections := parseDarwinNetstat(string(out))
 
-	if s.processes {
+	if s.processes && !process.FidelityReduced() {
 		out, err := exec.Command(
 			lsofBinary,
 			"-i",       // only Internet files
@@ -65,7 +65,7 @@ func (s *linuxScanner) Connections() (ConnIter, error) {
 	buf.Reset()
 
 	var procs map[uint64]*Proc
-	if s.r != nil {
+	if s.r != nil && !process.FidelityReduced() {
 		var err error
 		if procs, err = s.r.getWalkedProcPid(buf); err != nil {
 			return nil, err
@@ -14,6 +14,7 @@ const (
 	ReverseDNSNames = report.ReverseDNSNames
 	SnoopedDNSNames = report.SnoopedDNSNames
 	CopyOf          = report.CopyOf
+	SampleWeight    = report.SampleWeight
 )
 
 // ReporterConfig are the config options for the endpoint reporter.
@@ -29,6 +30,9 @@ type ReporterConfig struct {
 	ProcessCache *process.CachingWalker
 	Scanner      procspy.ConnectionScanner
 	DNSSnooper   *DNSSnooper
+	// SampleSize is how many connections of each source, destination
+	// and destination port to report, 0 for all.
+	SampleSize int
 }
 
 // Reporter generates Reports containing the Endpoint topology.
@@ -70,6 +74,7 @@ func NewReporter(conf ReporterConfig) *Reporter {
 			ProcessCache: conf.ProcessCache,
 			Scanner:      conf.Scanner,
 			DNSSnooper:   conf.DNSSnooper,
+			SampleSize:   conf.SampleSize,
 		}),
 		natMapper: makeNATMapper(newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, "--any-nat")),
 	}
@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"math/rand"
+)
+
+// connectionClass is what connections are sampled by: their addresses and
+// destination port, all the connections of a client to a server.
+type connectionClass struct {
+	namespaceID      string
+	fromAddr, toAddr string
+	toPort           uint16
+}
+
+// sampledConnection is a connection, as addConnection takes it, in the
+// direction it was made.
+type sampledConnection struct {
+	tuple                      fourTuple
+	namespaceID                string
+	extraFromNode, extraToNode map[string]string
+}
+
+// reservoir is a uniform sample of the connections of a class.
+type reservoir struct {
+	seen int
+	kept []sampledConnection
+	// keys of the connections seen, those kept by index in kept, so
+	// connections seen by more than one tracker are sampled once
+	keys map[string]int
+}
+
+// connectionSampler keeps a uniform sample of at most size connections of
+// each class, by reservoir sampling, so hosts with many connections to the
+// same servers don't report them all. The connections kept stand for
+// seen/kept connections each.
+type connectionSampler struct {
+	size    int
+	rand    *rand.Rand
+	classes map[connectionClass]*reservoir
+}
+
+func newConnectionSampler(size int, seed int64) *connectionSampler {
+	return &connectionSampler{
+		size:    size,
+		rand:    rand.New(rand.NewSource(seed)),
+		classes: map[connectionClass]*reservoir{},
+	}
+}
+
+func (s *connectionSampler) add(c sampledConnection) {
+	class := connectionClass{c.namespaceID, c.tuple.fromAddr, c.tuple.toAddr, c.tuple.toPort}
+	r, ok := s.classes[class]
+	if !ok {
+		r = &reservoir{keys: map[string]int{}}
+		s.classes[class] = r
+	}
+	key := c.tuple.String()
+	if i, ok := r.keys[key]; ok {
+		// The same connection, as another tracker saw it
+		if i >= 0 {
+			r.kept[i] = mergeSampledConnections(r.kept[i], c)
+		}
+		return
+	}
+	r.seen++
+	switch {
+	case len(r.kept) < s.size:
+		r.keys[key] = len(r.kept)
+		r.kept = append(r.kept, c)
+	default:
+		r.keys[key] = -1
+		if i := s.rand.Intn(r.seen); i < s.size {
+			r.keys[r.kept[i].tuple.String()] = -1
+			r.keys[key] = i
+			r.kept[i] = c
+		}
+	}
+}
+
+// each calls f with the connections kept, and how many each stands for.
+func (s *connectionSampler) each(f func(c sampledConnection, weight float64)) {
+	for _, r := range s.classes {
+		weight := float64(r.seen) / float64(len(r.kept))
+		for _, c := range r.kept {
+			f(c, weight)
+		}
+	}
+}
+
+func mergeSampledConnections(c, other sampledConnection) sampledConnection {
+	merge := func(a, b map[string]string) map[string]string {
+		if len(a) == 0 {
+			return b
+		}
+		result := make(map[string]string, len(a)+len(b))
+		for k, v := range b {
+			result[k] = v
+		}
+		for k, v := range a {
+			result[k] = v
+		}
+		return result
+	}
+	c.extraFromNode = merge(c.extraFromNode, other.extraFromNode)
+	c.extraToNode = merge(c.extraToNode, other.extraToNode)
+	return c
+}
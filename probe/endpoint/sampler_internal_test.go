@@ -0,0 +1,37 @@
+package endpoint
+
+import (
+	"testing"
+)
+
+func TestConnectionSampler(t *testing.T) {
+	s := newConnectionSampler(10, 1)
+	for port := uint16(40000); port < 40100; port++ {
+		s.add(sampledConnection{tuple: fourTuple{"10.0.0.1", "10.0.0.2", port, 80}})
+		// Seen again by another tracker, with its process
+		s.add(sampledConnection{tuple: fourTuple{"10.0.0.1", "10.0.0.2", port, 80}, extraFromNode: map[string]string{"pid": "1"}})
+	}
+	s.add(sampledConnection{tuple: fourTuple{"10.0.0.1", "10.0.0.3", 40000, 443}})
+
+	var (
+		kept    = map[string]int{}
+		weights = map[string]float64{}
+		pids    int
+	)
+	s.each(func(c sampledConnection, weight float64) {
+		kept[c.tuple.toAddr]++
+		weights[c.tuple.toAddr] = weight
+		if c.extraFromNode["pid"] == "1" {
+			pids++
+		}
+	})
+	if kept["10.0.0.2"] != 10 || weights["10.0.0.2"] != 10 {
+		t.Errorf("Expected 10 connections standing for 10 each, got %d standing for %v", kept["10.0.0.2"], weights["10.0.0.2"])
+	}
+	if kept["10.0.0.3"] != 1 || weights["10.0.0.3"] != 1 {
+		t.Errorf("Expected the connection of its own class kept as it is, got %d standing for %v", kept["10.0.0.3"], weights["10.0.0.3"])
+	}
+	if pids != 10 {
+		t.Errorf("Expected what all trackers saw of connections to be kept, got %d of 10 with their process", pids)
+	}
+}
@@ -0,0 +1,129 @@
+package gpu
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Client queries the NVIDIA Management Library for the GPUs of the host and
+// the processes using them.
+type Client interface {
+	GPUs() ([]GPU, error)
+	ComputeProcesses() ([]ComputeProcess, error)
+}
+
+// GPU is the state of a GPU. Readings the GPU doesn't support are negative.
+type GPU struct {
+	Index         int
+	UUID          string
+	Name          string
+	DriverVersion string
+	Utilization   float64 // percent
+	MemoryUsed    float64 // bytes
+	MemoryTotal   float64 // bytes
+	Temperature   float64 // degrees Celsius
+	PowerDraw     float64 // watts
+}
+
+// ComputeProcess is a process with a context on a GPU.
+type ComputeProcess struct {
+	GPUUUID    string
+	PID        int
+	MemoryUsed float64 // bytes
+}
+
+const mib = 1024 * 1024
+
+// nvidiaSMI queries NVML through nvidia-smi, which ships with the driver,
+// rather than linking against libnvidia-ml with cgo.
+type nvidiaSMI struct {
+	path string
+}
+
+// NewClient returns a Client which runs the nvidia-smi at path.
+func NewClient(path string) Client {
+	return nvidiaSMI{path: path}
+}
+
+func (c nvidiaSMI) query(args ...string) ([][]string, error) {
+	out, err := exec.Command(c.path, append(args, "--format=csv,noheader,nounits")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi: %v", err)
+	}
+	reader := csv.NewReader(strings.NewReader(string(out)))
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+func (c nvidiaSMI) GPUs() ([]GPU, error) {
+	records, err := c.query("--query-gpu=index,uuid,name,driver_version,utilization.gpu,memory.used,memory.total,temperature.gpu,power.draw")
+	if err != nil {
+		return nil, err
+	}
+	return parseGPUs(records)
+}
+
+func (c nvidiaSMI) ComputeProcesses() ([]ComputeProcess, error) {
+	records, err := c.query("--query-compute-apps=gpu_uuid,pid,used_memory")
+	if err != nil {
+		return nil, err
+	}
+	return parseComputeProcesses(records)
+}
+
+func parseGPUs(records [][]string) ([]GPU, error) {
+	gpus := make([]GPU, 0, len(records))
+	for _, record := range records {
+		if len(record) != 9 {
+			return nil, fmt.Errorf("nvidia-smi: unexpected GPU record %q", record)
+		}
+		index, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("nvidia-smi: invalid GPU index %q", record[0])
+		}
+		gpus = append(gpus, GPU{
+			Index:         index,
+			UUID:          record[1],
+			Name:          record[2],
+			DriverVersion: record[3],
+			Utilization:   reading(record[4], 1),
+			MemoryUsed:    reading(record[5], mib),
+			MemoryTotal:   reading(record[6], mib),
+			Temperature:   reading(record[7], 1),
+			PowerDraw:     reading(record[8], 1),
+		})
+	}
+	return gpus, nil
+}
+
+func parseComputeProcesses(records [][]string) ([]ComputeProcess, error) {
+	processes := make([]ComputeProcess, 0, len(records))
+	for _, record := range records {
+		if len(record) != 3 {
+			return nil, fmt.Errorf("nvidia-smi: unexpected process record %q", record)
+		}
+		pid, err := strconv.Atoi(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("nvidia-smi: invalid PID %q", record[1])
+		}
+		processes = append(processes, ComputeProcess{
+			GPUUUID:    record[0],
+			PID:        pid,
+			MemoryUsed: reading(record[2], mib),
+		})
+	}
+	return processes, nil
+}
+
+// reading parses a value from nvidia-smi, in units of scale; it prints
+// "[N/A]" or "[Not Supported]" for the readings a GPU doesn't have.
+func reading(s string, scale float64) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return -1
+	}
+	return v * scale
+}
@@ -0,0 +1,64 @@
+package gpu_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/gpu"
+)
+
+// fakeNvidiaSMI answers the queries of the client like nvidia-smi would.
+const fakeNvidiaSMI = `#!/bin/sh
+case "$1" in
+--query-gpu=*)
+	echo "0, GPU-1a2b, Tesla V100-SXM2-16GB, 418.67, 80, 1024, 16160, 61, [N/A]"
+	;;
+--query-compute-apps=*)
+	echo "GPU-1a2b, 4242, 1000"
+	;;
+esac
+`
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-smi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nvidia-smi")
+	if err := ioutil.WriteFile(path, []byte(fakeNvidiaSMI), 0755); err != nil {
+		t.Fatal(err)
+	}
+	client := gpu.NewClient(path)
+
+	gpus, err := client.GPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGPUs := []gpu.GPU{{
+		Index:         0,
+		UUID:          "GPU-1a2b",
+		Name:          "Tesla V100-SXM2-16GB",
+		DriverVersion: "418.67",
+		Utilization:   80,
+		MemoryUsed:    1024 * 1024 * 1024,
+		MemoryTotal:   16160 * 1024 * 1024,
+		Temperature:   61,
+		PowerDraw:     -1,
+	}}
+	if !reflect.DeepEqual(wantGPUs, gpus) {
+		t.Errorf("Expected %v, got %v", wantGPUs, gpus)
+	}
+
+	processes, err := client.ComputeProcesses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProcesses := []gpu.ComputeProcess{{GPUUUID: "GPU-1a2b", PID: 4242, MemoryUsed: 1000 * 1024 * 1024}}
+	if !reflect.DeepEqual(wantProcesses, processes) {
+		t.Errorf("Expected %v, got %v", wantProcesses, processes)
+	}
+}
@@ -0,0 +1,155 @@
+package gpu
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Index         = report.GPUIndex
+	Name          = report.GPUName
+	UUID          = report.GPUUUID
+	DriverVersion = report.GPUDriverVersion
+
+	Utilization = "gpu_utilization_percent"
+	MemoryUsage = "gpu_memory_usage_bytes"
+	Temperature = "gpu_temperature_celsius"
+	PowerDraw   = "gpu_power_watts"
+
+	// ProcessMemoryUsage is the GPU memory used by a process, across all
+	// the GPUs it uses.
+	ProcessMemoryUsage = "process_gpu_memory_usage_bytes"
+)
+
+// Exposed for testing
+var (
+	MetadataTemplates = report.MetadataTemplates{
+		Name:          {ID: Name, Label: "Model", From: report.FromLatest, Priority: 1},
+		Index:         {ID: Index, Label: "Index", From: report.FromLatest, Datatype: report.Number, Priority: 2},
+		UUID:          {ID: UUID, Label: "UUID", From: report.FromLatest, Priority: 3},
+		DriverVersion: {ID: DriverVersion, Label: "Driver Version", From: report.FromLatest, Priority: 4},
+	}
+
+	MetricTemplates = report.MetricTemplates{
+		Utilization: {ID: Utilization, Label: "Utilization", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage: {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		Temperature: {ID: Temperature, Label: "Temperature (°C)", Format: report.DefaultFormat, Priority: 3},
+		PowerDraw:   {ID: PowerDraw, Label: "Power (W)", Format: report.DefaultFormat, Priority: 4},
+	}
+
+	ProcessMetricTemplates = report.MetricTemplates{
+		ProcessMemoryUsage: {ID: ProcessMemoryUsage, Label: "GPU Memory", Format: report.FilesizeFormat, Priority: 4},
+	}
+)
+
+// Reporter implements Reporter and Tagger. It reports the GPUs of the host,
+// and makes them the parents of the processes using them and, once the
+// docker tagger has tied those to their containers, of the containers.
+type Reporter struct {
+	client Client
+	hostID string
+}
+
+// NewReporter makes a new Reporter
+func NewReporter(client Client, hostID string) *Reporter {
+	return &Reporter{client: client, hostID: hostID}
+}
+
+// Name of this reporter/tagger, for metrics gathering
+func (*Reporter) Name() string { return "GPU" }
+
+// Report implements Reporter.
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.GPU = result.GPU.
+		WithMetadataTemplates(MetadataTemplates).
+		WithMetricTemplates(MetricTemplates)
+	result.Process = result.Process.WithMetricTemplates(ProcessMetricTemplates)
+
+	gpus, err := r.client.GPUs()
+	if err != nil {
+		return result, err
+	}
+	processes, err := r.client.ComputeProcesses()
+	if err != nil {
+		// We can still report the GPUs
+		log.Warnf("GPU: cannot list processes using GPUs: %v", err)
+	}
+
+	now := mtime.Now()
+	hostNodeID := report.MakeHostNodeID(r.hostID)
+	for _, g := range gpus {
+		metrics := report.Metrics{}
+		if g.Utilization >= 0 {
+			metrics[Utilization] = report.MakeSingletonMetric(now, g.Utilization).WithMax(100)
+		}
+		if g.MemoryUsed >= 0 {
+			metrics[MemoryUsage] = report.MakeSingletonMetric(now, g.MemoryUsed).WithMax(g.MemoryTotal)
+		}
+		if g.Temperature >= 0 {
+			metrics[Temperature] = report.MakeSingletonMetric(now, g.Temperature)
+		}
+		if g.PowerDraw >= 0 {
+			metrics[PowerDraw] = report.MakeSingletonMetric(now, g.PowerDraw)
+		}
+		result.GPU.AddNode(
+			report.MakeNodeWith(report.MakeGPUNodeID(g.UUID), map[string]string{
+				Index:             strconv.Itoa(g.Index),
+				Name:              g.Name,
+				UUID:              g.UUID,
+				DriverVersion:     g.DriverVersion,
+				report.HostNodeID: hostNodeID,
+			}).
+				WithMetrics(metrics).
+				WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(hostNodeID))),
+		)
+	}
+
+	// A process may use several GPUs
+	gpuIDs := map[int][]string{}
+	memoryUsed := map[int]float64{}
+	for _, p := range processes {
+		gpuIDs[p.PID] = append(gpuIDs[p.PID], report.MakeGPUNodeID(p.GPUUUID))
+		if p.MemoryUsed >= 0 {
+			memoryUsed[p.PID] += p.MemoryUsed
+		}
+	}
+	for pid, ids := range gpuIDs {
+		node := report.MakeNode(report.MakeProcessNodeID(r.hostID, strconv.Itoa(pid))).
+			WithParents(report.MakeSets().Add(report.GPU, report.MakeStringSet(ids...)))
+		if used, ok := memoryUsed[pid]; ok {
+			node = node.WithMetric(ProcessMemoryUsage, report.MakeSingletonMetric(now, used))
+		}
+		result.Process.AddNode(node)
+	}
+	return result, nil
+}
+
+// Tag implements Tagger. It makes the GPUs of processes parents of their
+// containers too.
+func (r *Reporter) Tag(rpt report.Report) (report.Report, error) {
+	containerGPUs := map[string]report.StringSet{}
+	for _, n := range rpt.Process.Nodes {
+		gpuIDs, ok := n.Parents.Lookup(report.GPU)
+		if !ok {
+			continue
+		}
+		containerIDs, _ := n.Parents.Lookup(report.Container)
+		for _, containerID := range containerIDs {
+			containerGPUs[containerID] = containerGPUs[containerID].Merge(gpuIDs)
+		}
+	}
+	for containerID, gpuIDs := range containerGPUs {
+		container, ok := rpt.Container.Nodes[containerID]
+		if !ok {
+			continue
+		}
+		rpt.Container.Nodes[containerID] = container.WithParents(container.Parents.Add(report.GPU, gpuIDs))
+	}
+	return rpt, nil
+}
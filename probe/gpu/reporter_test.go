@@ -0,0 +1,83 @@
+package gpu_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/gpu"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	gpu0 = "GPU-1a2b3c4d-0000-0000-0000-000000000000"
+	gpu1 = "GPU-5e6f7a8b-1111-1111-1111-111111111111"
+)
+
+type mockClient struct {
+	gpus      []gpu.GPU
+	processes []gpu.ComputeProcess
+}
+
+func (c mockClient) GPUs() ([]gpu.GPU, error) { return c.gpus, nil }
+
+func (c mockClient) ComputeProcesses() ([]gpu.ComputeProcess, error) { return c.processes, nil }
+
+func TestReporter(t *testing.T) {
+	r := gpu.NewReporter(mockClient{
+		gpus: []gpu.GPU{
+			{Index: 0, UUID: gpu0, Name: "Tesla V100", Utilization: 80, MemoryUsed: 1024, MemoryTotal: 4096, Temperature: 60, PowerDraw: -1},
+			{Index: 1, UUID: gpu1, Name: "Tesla V100", Utilization: 0, MemoryUsed: 0, MemoryTotal: 4096, Temperature: 40, PowerDraw: 50},
+		},
+		processes: []gpu.ComputeProcess{
+			{GPUUUID: gpu0, PID: 42, MemoryUsed: 512},
+			{GPUUUID: gpu1, PID: 42, MemoryUsed: 256},
+			{GPUUUID: gpu0, PID: 43, MemoryUsed: -1},
+		},
+	}, "host1")
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpuID := report.MakeGPUNodeID(gpu0)
+	node, ok := rpt.GPU.Nodes[gpuID]
+	if !ok {
+		t.Fatalf("Expected GPU node %q, got %v", gpuID, rpt.GPU.Nodes)
+	}
+	if have, _ := node.Parents.Lookup(report.Host); !reflect.DeepEqual(report.MakeStringSet(report.MakeHostNodeID("host1")), have) {
+		t.Errorf("Expected GPU to be a child of its host, got %v", have)
+	}
+	if memory, ok := node.Metrics[gpu.MemoryUsage]; !ok || memory.Max != 4096 {
+		t.Errorf("Expected memory metric with a max of 4096, got %v", memory)
+	}
+	// Readings the GPU doesn't support are left out
+	if _, ok := node.Metrics[gpu.PowerDraw]; ok {
+		t.Errorf("Expected no power metric, got %v", node.Metrics)
+	}
+
+	process := rpt.Process.Nodes[report.MakeProcessNodeID("host1", "42")]
+	want := report.MakeStringSet(report.MakeGPUNodeID(gpu0), report.MakeGPUNodeID(gpu1))
+	if have, _ := process.Parents.Lookup(report.GPU); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected process to use %v, got %v", want, have)
+	}
+	if sample, ok := process.Metrics[gpu.ProcessMemoryUsage].LastSample(); !ok || sample.Value != 768 {
+		t.Errorf("Expected process to use 768 bytes of GPU memory, got %v", sample.Value)
+	}
+	if _, ok := rpt.Process.Nodes[report.MakeProcessNodeID("host1", "43")].Metrics[gpu.ProcessMemoryUsage]; ok {
+		t.Errorf("Expected no GPU memory metric for a process without the reading")
+	}
+
+	// The GPUs of processes become the GPUs of their containers
+	containerID := report.MakeContainerNodeID("c1")
+	rpt.Process.Nodes[report.MakeProcessNodeID("host1", "42")] = process.WithParents(
+		process.Parents.Add(report.Container, report.MakeStringSet(containerID)))
+	rpt.Container.AddNode(report.MakeNode(containerID))
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, _ := rpt.Container.Nodes[containerID].Parents.Lookup(report.GPU); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected container to use %v, got %v", want, have)
+	}
+}
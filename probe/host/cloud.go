@@ -0,0 +1,294 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	cloudMetadataTimeout = 1 * time.Second
+	cloudRefreshInterval = 10 * time.Minute
+)
+
+// Base URLs of the instance metadata services. Exposed for testing.
+var (
+	EC2MetadataURL   = "http://169.254.169.254"
+	GCEMetadataURL   = "http://metadata.google.internal"
+	AzureMetadataURL = "http://169.254.169.254"
+)
+
+// CloudMetadata describes the cloud instance a host runs on.
+type CloudMetadata struct {
+	Provider     string
+	Region       string
+	Zone         string
+	InstanceID   string
+	InstanceType string
+	Tags         map[string]string
+}
+
+type cloudProvider struct {
+	name  string
+	fetch func(*http.Client) (CloudMetadata, error)
+}
+
+var cloudProviders = []cloudProvider{
+	{"ec2", fetchEC2Metadata},
+	{"gce", fetchGCEMetadata},
+	{"azure", fetchAzureMetadata},
+}
+
+// CloudTagger tags the host node with the instance metadata of the cloud
+// it runs on, if any. The metadata services are only reachable from
+// within their cloud, so we find out which one we're in by asking each in
+// turn, in the background.
+type CloudTagger struct {
+	hostNodeID string
+	client     *http.Client
+	quit       chan struct{}
+
+	sync.RWMutex
+	metadata *CloudMetadata
+}
+
+// NewCloudTagger makes a new CloudTagger. Don't forget to Stop it.
+func NewCloudTagger(hostID string) *CloudTagger {
+	t := &CloudTagger{
+		hostNodeID: report.MakeHostNodeID(hostID),
+		client:     &http.Client{Timeout: cloudMetadataTimeout},
+		quit:       make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Name of this tagger, for metrics gathering
+func (*CloudTagger) Name() string { return "Cloud" }
+
+// Stop stops refreshing the metadata.
+func (t *CloudTagger) Stop() {
+	close(t.quit)
+}
+
+func (t *CloudTagger) loop() {
+	var provider cloudProvider
+	for _, p := range cloudProviders {
+		metadata, err := p.fetch(t.client)
+		if err != nil {
+			continue
+		}
+		log.Infof("Cloud: running on %s, in %s", p.name, metadata.Zone)
+		provider = p
+		t.set(metadata)
+		break
+	}
+	if provider.fetch == nil {
+		log.Infof("Cloud: no instance metadata service found")
+		return
+	}
+
+	// Tags may change while the instance runs
+	ticker := time.NewTicker(cloudRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if metadata, err := provider.fetch(t.client); err != nil {
+				log.Warnf("Cloud: cannot refresh %s instance metadata: %v", provider.name, err)
+			} else {
+				t.set(metadata)
+			}
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+func (t *CloudTagger) set(metadata CloudMetadata) {
+	t.Lock()
+	defer t.Unlock()
+	t.metadata = &metadata
+}
+
+// Tag implements Tagger.
+func (t *CloudTagger) Tag(r report.Report) (report.Report, error) {
+	t.RLock()
+	metadata := t.metadata
+	t.RUnlock()
+	if metadata == nil {
+		return r, nil
+	}
+	node, ok := r.Host.Nodes[t.hostNodeID]
+	if !ok {
+		return r, nil
+	}
+	node = node.WithLatests(map[string]string{
+		CloudProvider: metadata.Provider,
+		CloudRegion:   metadata.Region,
+		CloudZone:     metadata.Zone,
+		InstanceID:    metadata.InstanceID,
+		InstanceType:  metadata.InstanceType,
+	})
+	if len(metadata.Tags) > 0 {
+		tags := []string{}
+		for k, v := range metadata.Tags {
+			if v == "" {
+				tags = append(tags, k)
+			} else {
+				tags = append(tags, k+"="+v)
+			}
+		}
+		node = node.WithSet(CloudTags, report.MakeStringSet(tags...))
+	}
+	r.Host = r.Host.AddNode(node)
+	return r, nil
+}
+
+func getMetadata(client *http.Client, method, url string, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// fetchEC2Metadata uses IMDSv2, which needs a session token. Instance tags
+// are only there if the instance allows access to them.
+func fetchEC2Metadata(client *http.Client) (CloudMetadata, error) {
+	token, err := getMetadata(client, "PUT", EC2MetadataURL+"/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "300",
+	})
+	if err != nil {
+		return CloudMetadata{}, err
+	}
+	header := map[string]string{"X-aws-ec2-metadata-token": string(token)}
+	buf, err := getMetadata(client, "GET", EC2MetadataURL+"/latest/dynamic/instance-identity/document", header)
+	if err != nil {
+		return CloudMetadata{}, err
+	}
+	var document struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+	}
+	if err := json.Unmarshal(buf, &document); err != nil {
+		return CloudMetadata{}, err
+	}
+	metadata := CloudMetadata{
+		Provider:     "ec2",
+		Region:       document.Region,
+		Zone:         document.AvailabilityZone,
+		InstanceID:   document.InstanceID,
+		InstanceType: document.InstanceType,
+		Tags:         map[string]string{},
+	}
+	if keys, err := getMetadata(client, "GET", EC2MetadataURL+"/latest/meta-data/tags/instance", header); err == nil {
+		for _, key := range strings.Fields(string(keys)) {
+			if value, err := getMetadata(client, "GET", EC2MetadataURL+"/latest/meta-data/tags/instance/"+key, header); err == nil {
+				metadata.Tags[key] = string(value)
+			}
+		}
+	}
+	return metadata, nil
+}
+
+// fetchGCEMetadata reports the network tags of the instance. We leave its
+// attributes alone, as they hold things like startup scripts and ssh keys.
+func fetchGCEMetadata(client *http.Client) (CloudMetadata, error) {
+	buf, err := getMetadata(client, "GET", GCEMetadataURL+"/computeMetadata/v1/instance/?recursive=true", map[string]string{
+		"Metadata-Flavor": "Google",
+	})
+	if err != nil {
+		return CloudMetadata{}, err
+	}
+	var instance struct {
+		ID          json.Number `json:"id"`
+		MachineType string      `json:"machineType"` // projects/<project>/machineTypes/<type>
+		Zone        string      `json:"zone"`        // projects/<project>/zones/<zone>
+		Tags        []string    `json:"tags"`
+	}
+	if err := json.Unmarshal(buf, &instance); err != nil {
+		return CloudMetadata{}, err
+	}
+	zone := path.Base(instance.Zone)
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i >= 0 {
+		region = zone[:i]
+	}
+	metadata := CloudMetadata{
+		Provider:     "gce",
+		Region:       region,
+		Zone:         zone,
+		InstanceID:   instance.ID.String(),
+		InstanceType: path.Base(instance.MachineType),
+		Tags:         map[string]string{},
+	}
+	for _, tag := range instance.Tags {
+		metadata.Tags[tag] = ""
+	}
+	return metadata, nil
+}
+
+// fetchAzureMetadata names zones after their region, as Azure numbers the
+// availability zones of each region from 1.
+func fetchAzureMetadata(client *http.Client) (CloudMetadata, error) {
+	buf, err := getMetadata(client, "GET", AzureMetadataURL+"/metadata/instance?api-version=2021-02-01", map[string]string{
+		"Metadata": "true",
+	})
+	if err != nil {
+		return CloudMetadata{}, err
+	}
+	var instance struct {
+		Compute struct {
+			Location string `json:"location"`
+			Zone     string `json:"zone"`
+			VMID     string `json:"vmId"`
+			VMSize   string `json:"vmSize"`
+			TagsList []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"tagsList"`
+		} `json:"compute"`
+	}
+	if err := json.Unmarshal(buf, &instance); err != nil {
+		return CloudMetadata{}, err
+	}
+	compute := instance.Compute
+	metadata := CloudMetadata{
+		Provider:     "azure",
+		Region:       compute.Location,
+		Zone:         compute.Location,
+		InstanceID:   compute.VMID,
+		InstanceType: compute.VMSize,
+		Tags:         map[string]string{},
+	}
+	if compute.Zone != "" {
+		metadata.Zone = compute.Location + "-" + compute.Zone
+	}
+	for _, tag := range compute.TagsList {
+		metadata.Tags[tag.Name] = tag.Value
+	}
+	return metadata, nil
+}
@@ -0,0 +1,137 @@
+package host_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func withMetadataServers(ec2, gce, azure http.Handler, f func()) {
+	urls := []*string{&host.EC2MetadataURL, &host.GCEMetadataURL, &host.AzureMetadataURL}
+	old := []string{}
+	for i, handler := range []http.Handler{ec2, gce, azure} {
+		if handler == nil {
+			handler = http.NotFoundHandler()
+		}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		old = append(old, *urls[i])
+		*urls[i] = server.URL
+	}
+	defer func() {
+		for i, url := range old {
+			*urls[i] = url
+		}
+	}()
+	f()
+}
+
+func cloudTaggedHost(t *testing.T, tagger *host.CloudTagger, hostID string) report.Node {
+	var node report.Node
+	test.Poll(t, 2*time.Second, true, func() interface{} {
+		r := report.MakeReport()
+		r.Host.AddNode(report.MakeNode(report.MakeHostNodeID(hostID)))
+		r, _ = tagger.Tag(r)
+		node = r.Host.Nodes[report.MakeHostNodeID(hostID)]
+		_, ok := node.Latest.Lookup(host.CloudProvider)
+		return ok
+	})
+	return node
+}
+
+func checkLatests(t *testing.T, node report.Node, want map[string]string) {
+	for key, value := range want {
+		if have, ok := node.Latest.Lookup(key); !ok || have != value {
+			t.Errorf("Expected %s %q, got %q", key, value, have)
+		}
+	}
+}
+
+func TestCloudTaggerEC2(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprint(w, "token")
+	})
+	authed := func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			f(w, r)
+		}
+	}
+	mux.HandleFunc("/latest/dynamic/instance-identity/document", authed(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"region": "us-east-1", "availabilityZone": "us-east-1a", "instanceId": "i-0123", "instanceType": "m5.large"}`)
+	}))
+	mux.HandleFunc("/latest/meta-data/tags/instance", authed(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Name\nteam")
+	}))
+	mux.HandleFunc("/latest/meta-data/tags/instance/Name", authed(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "web-1")
+	}))
+	mux.HandleFunc("/latest/meta-data/tags/instance/team", authed(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "frontend")
+	}))
+
+	withMetadataServers(mux, nil, nil, func() {
+		tagger := host.NewCloudTagger("foo")
+		defer tagger.Stop()
+		node := cloudTaggedHost(t, tagger, "foo")
+		checkLatests(t, node, map[string]string{
+			host.CloudProvider: "ec2",
+			host.CloudRegion:   "us-east-1",
+			host.CloudZone:     "us-east-1a",
+			host.InstanceID:    "i-0123",
+			host.InstanceType:  "m5.large",
+		})
+		want := report.MakeStringSet("Name=web-1", "team=frontend")
+		if have, _ := node.Sets.Lookup(host.CloudTags); !reflect.DeepEqual(want, have) {
+			t.Errorf("Expected tags %v, got %v", want, have)
+		}
+	})
+}
+
+func TestCloudTaggerGCE(t *testing.T) {
+	gce := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{
+			"id": 4520031799277581759,
+			"machineType": "projects/123/machineTypes/n1-standard-1",
+			"zone": "projects/123/zones/europe-west1-b",
+			"tags": ["http-server"],
+			"attributes": {"ssh-keys": "secret"}
+		}`)
+	})
+
+	withMetadataServers(nil, gce, nil, func() {
+		tagger := host.NewCloudTagger("foo")
+		defer tagger.Stop()
+		node := cloudTaggedHost(t, tagger, "foo")
+		checkLatests(t, node, map[string]string{
+			host.CloudProvider: "gce",
+			host.CloudRegion:   "europe-west1",
+			host.CloudZone:     "europe-west1-b",
+			host.InstanceID:    "4520031799277581759",
+			host.InstanceType:  "n1-standard-1",
+		})
+		want := report.MakeStringSet("http-server")
+		if have, _ := node.Sets.Lookup(host.CloudTags); !reflect.DeepEqual(want, have) {
+			t.Errorf("Expected tags %v, got %v", want, have)
+		}
+	})
+}
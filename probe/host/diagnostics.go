@@ -0,0 +1,130 @@
+package host
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// DiagnosticControlPrefix prefixes the IDs of the controls which run
+// diagnostic commands, the rest of the ID being the name of the command.
+const DiagnosticControlPrefix = "host_diagnostic_"
+
+// DiagnosticCommand is a command operators allow to be run on hosts, to
+// diagnose them, e.g. "dmesg | tail -n 50".
+type DiagnosticCommand struct {
+	Name    string
+	Command string
+}
+
+// ParseDiagnosticCommand parses a diagnostic command specified as
+// name=command. The name is shown on the button running it.
+func ParseDiagnosticCommand(s string) (DiagnosticCommand, error) {
+	fields := strings.SplitN(s, "=", 2)
+	if len(fields) != 2 || fields[0] == "" || strings.TrimSpace(fields[1]) == "" {
+		return DiagnosticCommand{}, fmt.Errorf("invalid diagnostic command %q: expected name=command", s)
+	}
+	if strings.ContainsAny(fields[0], " \t") {
+		return DiagnosticCommand{}, fmt.Errorf("invalid diagnostic command %q: name cannot contain spaces", s)
+	}
+	return DiagnosticCommand{Name: fields[0], Command: fields[1]}, nil
+}
+
+// DiagnosticsReporter puts a control on the host for each allowed
+// diagnostic command, which runs the command in the host shell and streams
+// its output back through a pipe. Only the commands it was made with can
+// be run; the controls take no arguments.
+type DiagnosticsReporter struct {
+	hostID          string
+	commands        []DiagnosticCommand
+	hostShellCmd    []string
+	pipes           controls.PipeClient
+	handlerRegistry *controls.HandlerRegistry
+}
+
+// NewDiagnosticsReporter makes a new DiagnosticsReporter, and registers the
+// controls for commands.
+func NewDiagnosticsReporter(hostID string, commands []DiagnosticCommand, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry) *DiagnosticsReporter {
+	r := &DiagnosticsReporter{
+		hostID:          hostID,
+		commands:        commands,
+		hostShellCmd:    getHostShellCmd(),
+		pipes:           pipes,
+		handlerRegistry: handlerRegistry,
+	}
+	for _, c := range commands {
+		r.handlerRegistry.Register(DiagnosticControlPrefix+c.Name, r.runDiagnostic(c))
+	}
+	return r
+}
+
+// Name of this reporter, for metrics gathering
+func (*DiagnosticsReporter) Name() string { return "Diagnostics" }
+
+// Stop deregisters the controls.
+func (r *DiagnosticsReporter) Stop() {
+	for _, c := range r.commands {
+		r.handlerRegistry.Rm(DiagnosticControlPrefix + c.Name)
+	}
+}
+
+// Report implements Reporter.
+func (r *DiagnosticsReporter) Report() (report.Report, error) {
+	rep := report.MakeReport()
+	if len(r.commands) == 0 {
+		return rep, nil
+	}
+	ids := make([]string, 0, len(r.commands))
+	for i, c := range r.commands {
+		id := DiagnosticControlPrefix + c.Name
+		ids = append(ids, id)
+		rep.Host.Controls.AddControl(report.Control{
+			ID:    id,
+			Human: c.Name,
+			Icon:  "fa-stethoscope",
+			Rank:  i + 1,
+		})
+	}
+	rep.Host.AddNode(report.MakeNode(report.MakeHostNodeID(r.hostID)).WithLatestActiveControls(ids...))
+	return rep, nil
+}
+
+func (r *DiagnosticsReporter) runDiagnostic(c DiagnosticCommand) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		id, pipe, err := controls.NewPipe(r.pipes, req.AppID)
+		if err != nil {
+			return xfer.ResponseError(err)
+		}
+
+		local, _ := pipe.Ends()
+		args := append(append([]string{}, r.hostShellCmd...), "-c", c.Command)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = local
+		cmd.Stderr = local
+		if err := cmd.Start(); err != nil {
+			pipe.Close()
+			return xfer.ResponseError(err)
+		}
+
+		// Closing the pipe stops commands which don't exit by themselves,
+		// like dmesg -w
+		pipe.OnClose(func() {
+			cmd.Process.Kill()
+		})
+		go func() {
+			if err := cmd.Wait(); err != nil {
+				log.Warnf("Diagnostic command %q: %v", c.Name, err)
+			}
+			pipe.Close()
+		}()
+		return xfer.Response{
+			Pipe: id,
+		}
+	}
+}
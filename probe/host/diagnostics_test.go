@@ -0,0 +1,74 @@
+package host_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestParseDiagnosticCommand(t *testing.T) {
+	for _, tc := range []struct {
+		flag string
+		want host.DiagnosticCommand
+		ok   bool
+	}{
+		{"dmesg=dmesg | tail -n 50", host.DiagnosticCommand{Name: "dmesg", Command: "dmesg | tail -n 50"}, true},
+		{"sockets=ss -s", host.DiagnosticCommand{Name: "sockets", Command: "ss -s"}, true},
+		{"df -h", host.DiagnosticCommand{}, false},
+		{"=df -h", host.DiagnosticCommand{}, false},
+		{"disk usage=df -h", host.DiagnosticCommand{}, false},
+		{"df=", host.DiagnosticCommand{}, false},
+	} {
+		have, err := host.ParseDiagnosticCommand(tc.flag)
+		if (err == nil) != tc.ok || have != tc.want {
+			t.Errorf("%q: expected %v (ok=%v), got %v (%v)", tc.flag, tc.want, tc.ok, have, err)
+		}
+	}
+}
+
+func TestDiagnosticsReporter(t *testing.T) {
+	hr := controls.NewDefaultHandlerRegistry()
+	// Fail to open pipes, so the commands are never run
+	oldNewPipe := controls.NewPipe
+	defer func() { controls.NewPipe = oldNewPipe }()
+	controls.NewPipe = func(_ controls.PipeClient, _ string) (string, xfer.Pipe, error) {
+		return "", nil, fmt.Errorf("no pipes")
+	}
+	run := func(control string) string {
+		return hr.HandleControlRequest(xfer.Request{Control: control}).Error
+	}
+
+	r := host.NewDiagnosticsReporter("foo", []host.DiagnosticCommand{
+		{Name: "dmesg", Command: "dmesg | tail -n 50"},
+		{Name: "df", Command: "df -h"},
+	}, nil, hr)
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, ok := rpt.Host.Nodes[report.MakeHostNodeID("foo")]
+	if !ok {
+		t.Fatal("Expected host node")
+	}
+	for _, id := range []string{host.DiagnosticControlPrefix + "dmesg", host.DiagnosticControlPrefix + "df"} {
+		if _, ok := rpt.Host.Controls[id]; !ok {
+			t.Errorf("Expected control %q", id)
+		}
+		if _, ok := node.LatestControls.Lookup(id); !ok {
+			t.Errorf("Expected control %q to be active on the host", id)
+		}
+		if have := run(id); have != "no pipes" {
+			t.Errorf("Expected control %q to be registered, got %q", id, have)
+		}
+	}
+
+	r.Stop()
+	if have := run(host.DiagnosticControlPrefix + "dmesg"); have == "no pipes" {
+		t.Error("Expected controls to be deregistered")
+	}
+}
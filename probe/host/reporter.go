@@ -2,11 +2,14 @@ package host
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
@@ -23,7 +26,26 @@ const (
 	Load1         = "load1"
 	CPUUsage      = "host_cpu_usage_percent"
 	MemoryUsage   = "host_mem_usage_bytes"
+	DiskUsage     = "host_disk_usage_bytes"
+	DiskReadRate  = "host_disk_read_bytes_per_second"
+	DiskWriteRate = "host_disk_write_bytes_per_second"
+	NetworkRxRate = "host_network_rx_bytes_per_second"
+	NetworkTxRate = "host_network_tx_bytes_per_second"
 	ScopeVersion  = "host_scope_version"
+	ClusterName   = "host_cluster_name"
+	ExternalIPs   = "host_external_ips"
+	CloudProvider = "host_cloud_provider"
+	CloudRegion   = "host_cloud_region"
+	CloudZone     = "host_cloud_zone"
+	InstanceID    = "host_instance_id"
+	InstanceType  = "host_instance_type"
+	CloudTags     = "host_cloud_tags"
+	SELinux       = "host_selinux"
+	AppArmor      = "host_apparmor"
+	Sysctls       = "host_sysctls"
+	RebootNeeded  = "host_reboot_required"
+	// ClockSkew is set by the app, on hosts whose clock is off
+	ClockSkew = "host_clock_skew_seconds"
 )
 
 // Exposed for testing.
@@ -32,6 +54,12 @@ const (
 	ProcLoad    = "/proc/loadavg"
 	ProcStat    = "/proc/stat"
 	ProcMemInfo = "/proc/meminfo"
+	ProcMounts  = "/proc/mounts"
+	ProcDisks   = "/proc/diskstats"
+	ProcNetDev  = "/proc/net/dev"
+
+	MountsTablePrefix     = "host_mount_"
+	InterfacesTablePrefix = "host_nic_"
 )
 
 // Exposed for testing.
@@ -39,19 +67,79 @@ var (
 	MetadataTemplates = report.MetadataTemplates{
 		KernelVersion: {ID: KernelVersion, Label: "Kernel Version", From: report.FromLatest, Priority: 1},
 		Uptime:        {ID: Uptime, Label: "Uptime", From: report.FromLatest, Priority: 2, Datatype: report.Duration},
+		ClockSkew:     {ID: ClockSkew, Label: "Clock Skew (s)", From: report.FromLatest, Priority: 3, Datatype: report.Number},
+		RebootNeeded:  {ID: RebootNeeded, Label: "Reboot Required", From: report.FromLatest, Priority: 4},
+		SELinux:       {ID: SELinux, Label: "SELinux", From: report.FromLatest, Priority: 5},
+		AppArmor:      {ID: AppArmor, Label: "AppArmor", From: report.FromLatest, Priority: 6},
+		Sysctls:       {ID: Sysctls, Label: "Hardening Sysctls", From: report.FromSets, Priority: 7},
 		HostName:      {ID: HostName, Label: "Hostname", From: report.FromLatest, Priority: 11},
 		OS:            {ID: OS, Label: "OS", From: report.FromLatest, Priority: 12},
 		LocalNetworks: {ID: LocalNetworks, Label: "Local Networks", From: report.FromSets, Priority: 13},
 		ScopeVersion:  {ID: ScopeVersion, Label: "Scope Version", From: report.FromLatest, Priority: 14},
+		ClusterName:   {ID: ClusterName, Label: "Cluster", From: report.FromLatest, Priority: 15},
+		ExternalIPs:   {ID: ExternalIPs, Label: "External IPs", From: report.FromSets, Priority: 16},
+		CloudProvider: {ID: CloudProvider, Label: "Cloud", From: report.FromLatest, Priority: 17},
+		CloudRegion:   {ID: CloudRegion, Label: "Region", From: report.FromLatest, Priority: 18},
+		CloudZone:     {ID: CloudZone, Label: "Zone", From: report.FromLatest, Priority: 19},
+		InstanceType:  {ID: InstanceType, Label: "Instance Type", From: report.FromLatest, Priority: 20},
+		InstanceID:    {ID: InstanceID, Label: "Instance ID", From: report.FromLatest, Priority: 21},
+		CloudTags:     {ID: CloudTags, Label: "Cloud Tags", From: report.FromSets, Priority: 22},
 	}
 
 	MetricTemplates = report.MetricTemplates{
-		CPUUsage:    {ID: CPUUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
-		MemoryUsage: {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
-		Load1:       {ID: Load1, Label: "Load (1m)", Format: report.DefaultFormat, Group: "load", Priority: 11},
+		CPUUsage:      {ID: CPUUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage:   {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		DiskUsage:     {ID: DiskUsage, Label: "Disk", Format: report.FilesizeFormat, Priority: 3},
+		Load1:         {ID: Load1, Label: "Load (1m)", Format: report.DefaultFormat, Group: "load", Priority: 11},
+		DiskReadRate:  {ID: DiskReadRate, Label: "Disk Reads/s", Format: report.FilesizeFormat, Group: "disk", Priority: 12},
+		DiskWriteRate: {ID: DiskWriteRate, Label: "Disk Writes/s", Format: report.FilesizeFormat, Group: "disk", Priority: 13},
+		NetworkRxRate: {ID: NetworkRxRate, Label: "Network Rx/s", Format: report.FilesizeFormat, Group: "network", Priority: 14},
+		NetworkTxRate: {ID: NetworkTxRate, Label: "Network Tx/s", Format: report.FilesizeFormat, Group: "network", Priority: 15},
+	}
+
+	TableTemplates = report.TableTemplates{
+		MountsTablePrefix: {
+			ID:     MountsTablePrefix,
+			Label:  "Filesystems",
+			Type:   report.MulticolumnTableType,
+			Prefix: MountsTablePrefix,
+			Columns: []report.Column{
+				{ID: "mount_point", Label: "Mount"},
+				{ID: "device", Label: "Device"},
+				{ID: "fs_type", Label: "Type"},
+				{ID: "size", Label: "Size"},
+				{ID: "used", Label: "Used"},
+				{ID: "used_percent", Label: "Used %", DataType: report.Number},
+				{ID: "inodes_used_percent", Label: "Inodes Used %", DataType: report.Number},
+			},
+		},
+		InterfacesTablePrefix: {
+			ID:     InterfacesTablePrefix,
+			Label:  "Network Interfaces",
+			Type:   report.MulticolumnTableType,
+			Prefix: InterfacesTablePrefix,
+			Columns: []report.Column{
+				{ID: "name", Label: "Interface"},
+				{ID: "addresses", Label: "Addresses"},
+				{ID: "speed", Label: "Speed (Mb/s)", DataType: report.Number},
+				{ID: "rx", Label: "Rx/s"},
+				{ID: "tx", Label: "Tx/s"},
+				{ID: "utilization_percent", Label: "Utilization %", DataType: report.Number},
+			},
+		},
 	}
 )
 
+// MetadataSchema describes the metadata keys of hosts
+var MetadataSchema = report.MetadataSchema{
+	Uptime:    {Type: report.Duration, Unit: "s"},
+	ClockSkew: {Type: report.Number, Unit: "s"},
+}
+
+func init() {
+	report.RegisterMetadataSchema(MetadataSchema)
+}
+
 // Reporter generates Reports containing the host topology.
 type Reporter struct {
 	sync.RWMutex
@@ -59,6 +147,8 @@ type Reporter struct {
 	hostName        string
 	probeID         string
 	version         string
+	clusterName     string
+	externalIPs     []string
 	pipes           controls.PipeClient
 	hostShellCmd    []string
 	handlerRegistry *controls.HandlerRegistry
@@ -66,14 +156,18 @@ type Reporter struct {
 }
 
 // NewReporter returns a Reporter which produces a report containing host
-// topology for this host.
-func NewReporter(hostID, hostName, probeID, version string, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry) *Reporter {
+// topology for this host. clusterName and externalIPs identify the cluster
+// this host belongs to and the addresses other clusters see it connecting
+// from; both may be empty.
+func NewReporter(hostID, hostName, probeID, version, clusterName string, externalIPs []string, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry) *Reporter {
 	r := &Reporter{
 		hostID:          hostID,
 		hostName:        hostName,
 		probeID:         probeID,
 		pipes:           pipes,
 		version:         version,
+		clusterName:     clusterName,
+		externalIPs:     externalIPs,
 		hostShellCmd:    getHostShellCmd(),
 		handlerRegistry: handlerRegistry,
 		pipeIDToTTY:     map[string]uintptr{},
@@ -116,6 +210,7 @@ func (r *Reporter) Report() (report.Report, error) {
 
 	rep.Host = rep.Host.WithMetadataTemplates(MetadataTemplates)
 	rep.Host = rep.Host.WithMetricTemplates(MetricTemplates)
+	rep.Host = rep.Host.WithTableTemplates(TableTemplates)
 
 	now := mtime.Now()
 	metrics := GetLoad(now)
@@ -123,21 +218,67 @@ func (r *Reporter) Report() (report.Report, error) {
 	metrics[CPUUsage] = report.MakeSingletonMetric(now, cpuUsage).WithMax(max)
 	memoryUsage, max := GetMemoryUsageBytes()
 	metrics[MemoryUsage] = report.MakeSingletonMetric(now, memoryUsage).WithMax(max)
+	for key, metric := range GetDiskIO(now) {
+		metrics[key] = metric
+	}
+	mounts := GetMounts()
+	if len(mounts) > 0 {
+		var used, size uint64
+		for _, m := range mounts {
+			used += m.Used
+			size += m.Size
+		}
+		metrics[DiskUsage] = report.MakeSingletonMetric(now, float64(used)).WithMax(float64(size))
+	}
+	interfaces := GetInterfaces(now)
+	if rx, tx, ok := totalRates(interfaces); ok {
+		metrics[NetworkRxRate] = report.MakeSingletonMetric(now, rx)
+		metrics[NetworkTxRate] = report.MakeSingletonMetric(now, tx)
+	}
+
+	latests := map[string]string{
+		report.ControlProbeID: r.probeID,
+		Timestamp:             mtime.Now().UTC().Format(time.RFC3339Nano),
+		HostName:              r.hostName,
+		OS:                    runtime.GOOS,
+		KernelVersion:         kernel,
+		Uptime:                strconv.Itoa(int(uptime / time.Second)), // uptime in seconds
+		ScopeVersion:          r.version,
+	}
+	if r.clusterName != "" {
+		latests[ClusterName] = r.clusterName
+	}
+	posture := GetSecurityPosture()
+	if posture.SELinux != "" {
+		latests[SELinux] = posture.SELinux
+	}
+	if posture.AppArmor != "" {
+		latests[AppArmor] = posture.AppArmor
+	}
+	if posture.RebootRequired {
+		latests[RebootNeeded] = "yes"
+	} else {
+		latests[RebootNeeded] = "no"
+	}
+	sets := report.MakeSets().
+		Add(LocalNetworks, report.MakeStringSet(localCIDRs...))
+	if len(posture.Sysctls) > 0 {
+		sysctls := make([]string, 0, len(posture.Sysctls))
+		for name, value := range posture.Sysctls {
+			sysctls = append(sysctls, name+"="+value)
+		}
+		sets = sets.Add(Sysctls, report.MakeStringSet(sysctls...))
+	}
+	if len(r.externalIPs) > 0 {
+		sets = sets.Add(ExternalIPs, report.MakeStringSet(r.externalIPs...))
+	}
 
 	rep.Host.AddNode(
-		report.MakeNodeWith(report.MakeHostNodeID(r.hostID), map[string]string{
-			report.ControlProbeID: r.probeID,
-			Timestamp:             mtime.Now().UTC().Format(time.RFC3339Nano),
-			HostName:              r.hostName,
-			OS:                    runtime.GOOS,
-			KernelVersion:         kernel,
-			Uptime:                strconv.Itoa(int(uptime / time.Second)), // uptime in seconds
-			ScopeVersion:          r.version,
-		}).
-			WithSets(report.MakeSets().
-				Add(LocalNetworks, report.MakeStringSet(localCIDRs...)),
-			).
+		report.MakeNodeWith(report.MakeHostNodeID(r.hostID), latests).
+			WithSets(sets).
 			WithMetrics(metrics).
+			AddPrefixMulticolumnTable(MountsTablePrefix, mountRows(mounts)).
+			AddPrefixMulticolumnTable(InterfacesTablePrefix, interfaceRows(interfaces)).
 			WithLatestActiveControls(ExecHost),
 	)
 
@@ -150,6 +291,96 @@ func (r *Reporter) Report() (report.Report, error) {
 	return rep, nil
 }
 
+// Mount is a mounted filesystem, with its usage in bytes and inodes.
+type Mount struct {
+	MountPoint string
+	Device     string
+	FSType     string
+	Size       uint64
+	Used       uint64
+	Inodes     uint64
+	InodesUsed uint64
+}
+
+func mountRows(mounts []Mount) []report.Row {
+	rows := make([]report.Row, 0, len(mounts))
+	for _, m := range mounts {
+		rows = append(rows, report.Row{
+			ID: m.MountPoint,
+			Entries: map[string]string{
+				"mount_point":         m.MountPoint,
+				"device":              m.Device,
+				"fs_type":             m.FSType,
+				"size":                humanize.Bytes(m.Size),
+				"used":                humanize.Bytes(m.Used),
+				"used_percent":        percent(m.Used, m.Size),
+				"inodes_used_percent": percent(m.InodesUsed, m.Inodes),
+			},
+		})
+	}
+	return rows
+}
+
+// Interface is a network interface of the host. The rates, in bytes per
+// second, are only known from the second time the interfaces are listed.
+type Interface struct {
+	Name       string
+	Addresses  []string
+	Speed      uint64 // in Mb/s, zero if unknown
+	RatesKnown bool
+	RxRate     float64
+	TxRate     float64
+}
+
+func totalRates(interfaces []Interface) (float64, float64, bool) {
+	var (
+		rx, tx float64
+		known  bool
+	)
+	for _, i := range interfaces {
+		if i.RatesKnown {
+			rx += i.RxRate
+			tx += i.TxRate
+			known = true
+		}
+	}
+	return rx, tx, known
+}
+
+func interfaceRows(interfaces []Interface) []report.Row {
+	rows := make([]report.Row, 0, len(interfaces))
+	for _, i := range interfaces {
+		entries := map[string]string{
+			"name":      i.Name,
+			"addresses": strings.Join(i.Addresses, ", "),
+		}
+		if i.Speed > 0 {
+			entries["speed"] = strconv.FormatUint(i.Speed, 10)
+		}
+		if i.RatesKnown {
+			entries["rx"] = humanize.Bytes(uint64(i.RxRate))
+			entries["tx"] = humanize.Bytes(uint64(i.TxRate))
+			if i.Speed > 0 {
+				// Interfaces are full duplex, so the busier direction is
+				// the one which saturates first.
+				busiest := math.Max(i.RxRate, i.TxRate) * 8
+				entries["utilization_percent"] = strconv.FormatFloat(busiest*100/float64(i.Speed*1000000), 'f', 1, 64)
+			}
+		}
+		rows = append(rows, report.Row{ID: i.Name, Entries: entries})
+	}
+	return rows
+}
+
+// percent formats part as a percentage of total, which some filesystems
+// (e.g. btrfs, for inodes) report as zero.
+func percent(part, total uint64) string {
+	if total == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(part)*100/float64(total), 'f', 1, 64)
+}
+
 // Stop stops the reporter.
 func (r *Reporter) Stop() {
 	r.deregisterControls()
@@ -25,6 +25,18 @@ func TestReporter(t *testing.T) {
 			host.CPUUsage:    report.MakeSingletonMetric(timestamp, 30.0).WithMax(100.0),
 			host.MemoryUsage: report.MakeSingletonMetric(timestamp, 60.0).WithMax(100.0),
 		}
+		diskIO = report.Metrics{
+			host.DiskReadRate:  report.MakeSingletonMetric(timestamp, 4096.0),
+			host.DiskWriteRate: report.MakeSingletonMetric(timestamp, 8192.0),
+		}
+		mounts = []host.Mount{
+			{MountPoint: "/", Device: "/dev/sda1", FSType: "ext4", Size: 4000, Used: 1000, Inodes: 100, InodesUsed: 50},
+			{MountPoint: "/data", Device: "/dev/sdb", FSType: "btrfs", Size: 6000, Used: 3000},
+		}
+		interfaces = []host.Interface{
+			{Name: "eth0", Addresses: []string{"10.0.0.1/24"}, Speed: 1000, RatesKnown: true, RxRate: 100000000, TxRate: 25000000},
+			{Name: "docker0", Addresses: []string{"172.17.0.1/16"}, RatesKnown: true, RxRate: 1000, TxRate: 2000},
+		}
 		uptime      = "3600" // one hour
 		kernel      = "release version"
 		_, ipnet, _ = net.ParseCIDR(network)
@@ -40,6 +52,10 @@ func TestReporter(t *testing.T) {
 		oldGetCPUUsagePercent         = host.GetCPUUsagePercent
 		oldGetMemoryUsageBytes        = host.GetMemoryUsageBytes
 		oldGetLocalNetworks           = host.GetLocalNetworks
+		oldGetDiskIO                  = host.GetDiskIO
+		oldGetMounts                  = host.GetMounts
+		oldGetInterfaces              = host.GetInterfaces
+		oldGetSecurityPosture         = host.GetSecurityPosture
 	)
 	defer func() {
 		host.GetKernelReleaseAndVersion = oldGetKernelReleaseAndVersion
@@ -48,6 +64,10 @@ func TestReporter(t *testing.T) {
 		host.GetCPUUsagePercent = oldGetCPUUsagePercent
 		host.GetMemoryUsageBytes = oldGetMemoryUsageBytes
 		host.GetLocalNetworks = oldGetLocalNetworks
+		host.GetDiskIO = oldGetDiskIO
+		host.GetMounts = oldGetMounts
+		host.GetInterfaces = oldGetInterfaces
+		host.GetSecurityPosture = oldGetSecurityPosture
 	}()
 	host.GetKernelReleaseAndVersion = func() (string, string, error) { return release, version, nil }
 	host.GetLoad = func(time.Time) report.Metrics { return metrics }
@@ -55,9 +75,20 @@ func TestReporter(t *testing.T) {
 	host.GetCPUUsagePercent = func() (float64, float64) { return 30.0, 100.0 }
 	host.GetMemoryUsageBytes = func() (float64, float64) { return 60.0, 100.0 }
 	host.GetLocalNetworks = func() ([]*net.IPNet, error) { return []*net.IPNet{ipnet}, nil }
+	host.GetDiskIO = func(time.Time) report.Metrics { return diskIO }
+	host.GetMounts = func() []host.Mount { return mounts }
+	host.GetInterfaces = func(time.Time) []host.Interface { return interfaces }
+	host.GetSecurityPosture = func() host.SecurityPosture {
+		return host.SecurityPosture{
+			SELinux:        "enforcing",
+			AppArmor:       "disabled",
+			Sysctls:        map[string]string{"kernel.kptr_restrict": "1"},
+			RebootRequired: true,
+		}
+	}
 
 	hr := controls.NewDefaultHandlerRegistry()
-	rpt, err := host.NewReporter(hostID, hostname, "", "", nil, hr).Report()
+	rpt, err := host.NewReporter(hostID, hostname, "", "", "cluster-a", []string{"203.0.113.7"}, nil, hr).Report()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,6 +108,10 @@ func TestReporter(t *testing.T) {
 		{host.OS, runtime.GOOS},
 		{host.Uptime, uptime},
 		{host.KernelVersion, kernel},
+		{host.ClusterName, "cluster-a"},
+		{host.SELinux, "enforcing"},
+		{host.AppArmor, "disabled"},
+		{host.RebootNeeded, "yes"},
 	} {
 		if have, ok := node.Latest.Lookup(tuple.key); !ok || have != tuple.want {
 			t.Errorf("Expected %s %q, got %q", tuple.key, tuple.want, have)
@@ -88,7 +123,23 @@ func TestReporter(t *testing.T) {
 		t.Errorf("Expected host.LocalNetworks to include %q, got %q", network, have)
 	}
 
+	// Should have the external IPs
+	if have, ok := node.Sets.Lookup(host.ExternalIPs); !ok || !have.Contains("203.0.113.7") {
+		t.Errorf("Expected host.ExternalIPs to include %q, got %q", "203.0.113.7", have)
+	}
+
+	// Should have the hardening sysctls
+	if have, ok := node.Sets.Lookup(host.Sysctls); !ok || !have.Contains("kernel.kptr_restrict=1") {
+		t.Errorf("Expected host.Sysctls to include %q, got %q", "kernel.kptr_restrict=1", have)
+	}
+
 	// Should have metrics
+	for key, metric := range diskIO {
+		metrics[key] = metric
+	}
+	metrics[host.DiskUsage] = report.MakeSingletonMetric(timestamp, 4000.0).WithMax(10000.0)
+	metrics[host.NetworkRxRate] = report.MakeSingletonMetric(timestamp, 100001000.0)
+	metrics[host.NetworkTxRate] = report.MakeSingletonMetric(timestamp, 25002000.0)
 	for key, want := range metrics {
 		wantSample, _ := want.LastSample()
 		if metric, ok := node.Metrics[key]; !ok {
@@ -99,4 +150,43 @@ func TestReporter(t *testing.T) {
 			t.Errorf("Expected %s metric sample %f, got %f", key, wantSample.Value, sample.Value)
 		}
 	}
+
+	// Should have a row per filesystem
+	rows := node.ExtractMulticolumnTable(host.TableTemplates[host.MountsTablePrefix])
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 filesystems, got %v", rows)
+	}
+	for _, row := range rows {
+		switch row.ID {
+		case "/":
+			if have := row.Entries["used_percent"]; have != "25.0" {
+				t.Errorf("Expected / to be 25.0%% used, got %q", have)
+			}
+			if have := row.Entries["inodes_used_percent"]; have != "50.0" {
+				t.Errorf("Expected / to have 50.0%% of inodes used, got %q", have)
+			}
+		case "/data":
+			if have := row.Entries["inodes_used_percent"]; have != "" {
+				t.Errorf("Expected no inode usage for /data, got %q", have)
+			}
+		default:
+			t.Errorf("Unexpected filesystem %v", row)
+		}
+	}
+
+	// Should have a row per network interface, with its utilization when
+	// its speed is known
+	rows = node.ExtractMulticolumnTable(host.TableTemplates[host.InterfacesTablePrefix])
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 network interfaces, got %v", rows)
+	}
+	for _, row := range rows {
+		want := map[string]string{
+			"eth0":    "80.0",
+			"docker0": "",
+		}[row.ID]
+		if have := row.Entries["utilization_percent"]; have != want {
+			t.Errorf("Expected %s to be %q utilized, got %q", row.ID, want, have)
+		}
+	}
 }
@@ -0,0 +1,28 @@
+package host
+
+// SecurityPosture is the state of the security features of the kernel of a
+// host, which drifts between hosts as they are patched and rebooted at
+// different times.
+type SecurityPosture struct {
+	SELinux        string // "enforcing", "permissive" or "disabled"
+	AppArmor       string // "enabled" or "disabled"
+	Sysctls        map[string]string
+	RebootRequired bool
+}
+
+// hardeningSysctls are the sysctls which harden the kernel, as checked by
+// the usual benchmarks.
+var hardeningSysctls = []string{
+	"kernel.kptr_restrict",
+	"kernel.dmesg_restrict",
+	"kernel.randomize_va_space",
+	"kernel.yama.ptrace_scope",
+	"kernel.unprivileged_bpf_disabled",
+	"fs.protected_hardlinks",
+	"fs.protected_symlinks",
+	"fs.suid_dumpable",
+	"net.ipv4.conf.all.rp_filter",
+	"net.ipv4.conf.all.accept_redirects",
+	"net.ipv4.conf.all.send_redirects",
+	"net.ipv4.tcp_syncookies",
+}
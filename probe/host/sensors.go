@@ -0,0 +1,295 @@
+package host
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for the hardware sensor readings
+const (
+	CPUTemperature = "host_cpu_temperature_celsius"
+	PowerUsage     = "host_power_watts"
+
+	SensorsTablePrefix = "host_sensor_"
+)
+
+// Kinds of sensors
+const (
+	TemperatureSensor = "temperature"
+	FanSensor         = "fan"
+	PowerSensor       = "power"
+)
+
+// Exposed for testing.
+var (
+	HwmonRoot = "/sys/class/hwmon"
+
+	IPMITool = func() ([]byte, error) {
+		return exec.Command("ipmitool", "-c", "sdr", "list", "full").Output()
+	}
+
+	SensorMetricTemplates = report.MetricTemplates{
+		CPUTemperature: {ID: CPUTemperature, Label: "CPU Temperature (°C)", Format: report.DefaultFormat, Group: "sensors", Priority: 16},
+		PowerUsage:     {ID: PowerUsage, Label: "Power (W)", Format: report.DefaultFormat, Group: "sensors", Priority: 17},
+	}
+
+	SensorTableTemplates = report.TableTemplates{
+		SensorsTablePrefix: {
+			ID:     SensorsTablePrefix,
+			Label:  "Sensors",
+			Type:   report.MulticolumnTableType,
+			Prefix: SensorsTablePrefix,
+			Columns: []report.Column{
+				{ID: "source", Label: "Source"},
+				{ID: "sensor", Label: "Sensor"},
+				{ID: "kind", Label: "Kind"},
+				{ID: "value", Label: "Value", DataType: report.Number},
+				{ID: "unit", Label: "Unit"},
+			},
+		},
+	}
+)
+
+// hwmon chips which measure the temperature of CPU packages and cores
+var cpuTemperatureChips = map[string]struct{}{
+	"coretemp":    {},
+	"k10temp":     {},
+	"zenpower":    {},
+	"cpu_thermal": {},
+}
+
+var sensorUnits = map[string]string{
+	TemperatureSensor: "°C",
+	FanSensor:         "RPM",
+	PowerSensor:       "W",
+}
+
+// sensorReading is a reading of a hardware sensor.
+type sensorReading struct {
+	source string // the hwmon chip, or "ipmi"
+	label  string
+	kind   string
+	value  float64
+	cpu    bool
+}
+
+// SensorReporter reports the temperature, fan and power sensors of the host,
+// from the kernel's hwmon drivers and, optionally, from the BMC through
+// ipmitool. This is mostly useful on bare metal; virtual machines rarely have
+// any sensors.
+type SensorReporter struct {
+	hostNodeID string
+	ipmi       bool
+}
+
+// NewSensorReporter makes a new SensorReporter.
+func NewSensorReporter(hostID string, ipmi bool) *SensorReporter {
+	return &SensorReporter{
+		hostNodeID: report.MakeHostNodeID(hostID),
+		ipmi:       ipmi,
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*SensorReporter) Name() string { return "Sensors" }
+
+// Report implements Reporter.
+func (r *SensorReporter) Report() (report.Report, error) {
+	rep := report.MakeReport()
+	rep.Host = rep.Host.
+		WithMetricTemplates(SensorMetricTemplates).
+		WithTableTemplates(SensorTableTemplates)
+
+	sensors := hwmonSensors(HwmonRoot)
+	if r.ipmi {
+		ipmiSensors, err := getIPMISensors()
+		if err != nil {
+			log.Warnf("Sensors: cannot read IPMI sensors: %v", err)
+		}
+		sensors = append(sensors, ipmiSensors...)
+	}
+	if len(sensors) == 0 {
+		return rep, nil
+	}
+
+	now := mtime.Now()
+	metrics := report.Metrics{}
+	if temperature, ok := cpuTemperature(sensors); ok {
+		metrics[CPUTemperature] = report.MakeSingletonMetric(now, temperature)
+	}
+	if power, ok := powerUsage(sensors); ok {
+		metrics[PowerUsage] = report.MakeSingletonMetric(now, power)
+	}
+	rep.Host.AddNode(
+		report.MakeNode(r.hostNodeID).
+			WithMetrics(metrics).
+			AddPrefixMulticolumnTable(SensorsTablePrefix, sensorRows(sensors)),
+	)
+	return rep, nil
+}
+
+// cpuTemperature is the temperature of the hottest CPU sensor.
+func cpuTemperature(sensors []sensorReading) (float64, bool) {
+	var (
+		max   float64
+		found bool
+	)
+	for _, s := range sensors {
+		if s.kind == TemperatureSensor && s.cpu && (!found || s.value > max) {
+			max, found = s.value, true
+		}
+	}
+	return max, found
+}
+
+// powerUsage is the power drawn by the host. The BMC measures what the whole
+// machine draws, so we prefer it to hwmon, which may only see some
+// components, and never add up the two.
+func powerUsage(sensors []sensorReading) (float64, bool) {
+	var (
+		ipmi, hwmon           float64
+		foundIPMI, foundHwmon bool
+	)
+	for _, s := range sensors {
+		if s.kind != PowerSensor {
+			continue
+		}
+		if s.source == "ipmi" {
+			ipmi += s.value
+			foundIPMI = true
+		} else {
+			hwmon += s.value
+			foundHwmon = true
+		}
+	}
+	if foundIPMI {
+		return ipmi, true
+	}
+	return hwmon, foundHwmon
+}
+
+func sensorRows(sensors []sensorReading) []report.Row {
+	rows := make([]report.Row, 0, len(sensors))
+	for _, s := range sensors {
+		rows = append(rows, report.Row{
+			ID: s.source + "/" + s.label,
+			Entries: map[string]string{
+				"source": s.source,
+				"sensor": s.label,
+				"kind":   s.kind,
+				"value":  strconv.FormatFloat(s.value, 'f', 1, 64),
+				"unit":   sensorUnits[s.kind],
+			},
+		})
+	}
+	return rows
+}
+
+// hwmonSensors reads the sensors of every hwmon chip, as documented in
+// https://www.kernel.org/doc/Documentation/hwmon/sysfs-interface
+func hwmonSensors(root string) []sensorReading {
+	chips, err := filepath.Glob(filepath.Join(root, "hwmon*"))
+	if err != nil {
+		return nil
+	}
+	var sensors []sensorReading
+	for _, chip := range chips {
+		name := readSysfsString(filepath.Join(chip, "name"))
+		if name == "" {
+			name = filepath.Base(chip)
+		}
+		_, cpu := cpuTemperatureChips[name]
+		for _, sensor := range []struct {
+			kind, prefix string
+			scale        float64
+		}{
+			{TemperatureSensor, "temp", 1000}, // millidegrees Celsius
+			{FanSensor, "fan", 1},             // RPM
+			{PowerSensor, "power", 1000000},   // microwatts
+		} {
+			inputs, _ := filepath.Glob(filepath.Join(chip, sensor.prefix+"*_input"))
+			for _, input := range inputs {
+				value, err := strconv.ParseFloat(readSysfsString(input), 64)
+				if err != nil {
+					continue
+				}
+				channel := strings.TrimSuffix(filepath.Base(input), "_input")
+				label := readSysfsString(filepath.Join(chip, channel+"_label"))
+				if label == "" {
+					label = channel
+				}
+				sensors = append(sensors, sensorReading{
+					source: name,
+					label:  label,
+					kind:   sensor.kind,
+					value:  value / sensor.scale,
+					cpu:    cpu,
+				})
+			}
+		}
+	}
+	return sensors
+}
+
+func readSysfsString(path string) string {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// getIPMISensors reads the sensors of the BMC from the CSV output of
+// ipmitool, e.g. "CPU1 Temp,45,degrees C,ok". Sensors without a reading,
+// and those we don't know the unit of, are left out.
+func getIPMISensors() ([]sensorReading, error) {
+	out, err := IPMITool()
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(strings.NewReader(string(out)))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var sensors []sensorReading
+	for _, record := range records {
+		if len(record) < 3 {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			continue
+		}
+		var kind string
+		switch strings.TrimSpace(record[2]) {
+		case "degrees C":
+			kind = TemperatureSensor
+		case "RPM":
+			kind = FanSensor
+		case "Watts":
+			kind = PowerSensor
+		default:
+			continue
+		}
+		label := strings.TrimSpace(record[0])
+		sensors = append(sensors, sensorReading{
+			source: "ipmi",
+			label:  label,
+			kind:   kind,
+			value:  value,
+			cpu:    strings.Contains(strings.ToUpper(label), "CPU"),
+		})
+	}
+	return sensors, nil
+}
@@ -0,0 +1,83 @@
+package host_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+func writeHwmon(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSensorReporter(t *testing.T) {
+	root, err := ioutil.TempDir("", "hwmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeHwmon(t, root, map[string]string{
+		"hwmon0/name":         "coretemp",
+		"hwmon0/temp1_input":  "52000",
+		"hwmon0/temp1_label":  "Package id 0",
+		"hwmon0/temp2_input":  "61500",
+		"hwmon1/name":         "acpitz",
+		"hwmon1/temp1_input":  "80000",
+		"hwmon2/name":         "nct6775",
+		"hwmon2/fan1_input":   "1200",
+		"hwmon3/name":         "power_meter",
+		"hwmon3/power1_input": "150000000",
+	})
+
+	oldHwmonRoot, oldIPMITool := host.HwmonRoot, host.IPMITool
+	defer func() { host.HwmonRoot, host.IPMITool = oldHwmonRoot, oldIPMITool }()
+	host.HwmonRoot = root
+	host.IPMITool = func() ([]byte, error) {
+		return []byte("CPU1 Temp,45,degrees C,ok\nFAN1,3000,RPM,ok\nPwr Consumption,210,Watts,ok\nPS1 Status,0x01,discrete,ok\n"), nil
+	}
+
+	for _, tc := range []struct {
+		name               string
+		ipmi               bool
+		rows               int
+		temperature, power float64
+	}{
+		// The ACPI thermal zone isn't a CPU sensor, hot as it is
+		{"hwmon", false, 5, 61.5, 150},
+		// The BMC's power reading supersedes hwmon's
+		{"ipmi", true, 8, 61.5, 210},
+	} {
+		rpt, err := host.NewSensorReporter("foo", tc.ipmi).Report()
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, ok := rpt.Host.Nodes[report.MakeHostNodeID("foo")]
+		if !ok {
+			t.Fatalf("%s: expected host node", tc.name)
+		}
+		for key, want := range map[string]float64{
+			host.CPUTemperature: tc.temperature,
+			host.PowerUsage:     tc.power,
+		} {
+			if sample, ok := node.Metrics[key].LastSample(); !ok || sample.Value != want {
+				t.Errorf("%s: expected %s %v, got %v", tc.name, key, want, sample.Value)
+			}
+		}
+		rows := node.ExtractMulticolumnTable(host.SensorTableTemplates[host.SensorsTablePrefix])
+		if len(rows) != tc.rows {
+			t.Errorf("%s: expected %d sensors, got %v", tc.name, tc.rows, rows)
+		}
+	}
+}
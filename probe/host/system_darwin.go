@@ -84,3 +84,23 @@ var GetCPUUsagePercent = func() (float64, float64) {
 var GetMemoryUsageBytes = func() (float64, float64) {
 	return 0.0, 0.0
 }
+
+// GetDiskIO returns the disk read and write rates as metrics
+var GetDiskIO = func(now time.Time) report.Metrics {
+	return nil
+}
+
+// GetMounts returns the mounted filesystems
+var GetMounts = func() []Mount {
+	return nil
+}
+
+// GetInterfaces returns the network interfaces of the host
+var GetInterfaces = func(now time.Time) []Interface {
+	return nil
+}
+
+// GetSecurityPosture returns the state of the security features of the kernel
+var GetSecurityPosture = func() SecurityPosture {
+	return SecurityPosture{}
+}
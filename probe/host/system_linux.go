@@ -1,9 +1,13 @@
 package host
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +19,12 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-const kb = 1024
+const (
+	kb = 1024
+	// /proc/diskstats counts 512-byte sectors, whatever the device's own
+	// sector size.
+	sectorSize = 512
+)
 
 // Uname is swappable for mocking in tests.
 var Uname = unix.Uname
@@ -108,3 +117,221 @@ var GetMemoryUsageBytes = func() (float64, float64) {
 	used := meminfo.MemTotal - meminfo.MemFree - meminfo.Buffers - meminfo.Cached
 	return float64(used * kb), float64(meminfo.MemTotal * kb)
 }
+
+type diskStats struct {
+	sectorsRead, sectorsWritten uint64
+	at                          time.Time
+}
+
+var previousDiskStats diskStats
+
+// GetDiskIO returns the rates at which the disks of the host are read and
+// written, in bytes per second, as metrics. Only physical disks are counted,
+// so that IO through partitions, device mapper and loop devices isn't
+// counted twice. There is nothing to return until it has been called twice.
+var GetDiskIO = func(now time.Time) report.Metrics {
+	f, err := os.Open(ProcDisks)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	current := diskStats{at: now}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !physicalDisk(fields[2]) {
+			continue
+		}
+		read, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			continue
+		}
+		written, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+		current.sectorsRead += read
+		current.sectorsWritten += written
+	}
+
+	previous := previousDiskStats
+	previousDiskStats = current
+	elapsed := current.at.Sub(previous.at).Seconds()
+	if previous.at.IsZero() || elapsed <= 0 ||
+		current.sectorsRead < previous.sectorsRead || current.sectorsWritten < previous.sectorsWritten {
+		return nil
+	}
+	return report.Metrics{
+		DiskReadRate:  report.MakeSingletonMetric(now, float64((current.sectorsRead-previous.sectorsRead)*sectorSize)/elapsed),
+		DiskWriteRate: report.MakeSingletonMetric(now, float64((current.sectorsWritten-previous.sectorsWritten)*sectorSize)/elapsed),
+	}
+}
+
+// physicalDisk tells whole disks from partitions and virtual block devices:
+// only the former have both an entry in /sys/block and a backing device.
+func physicalDisk(name string) bool {
+	_, err := os.Stat("/sys/block/" + strings.Replace(name, "/", "!", -1) + "/device")
+	return err == nil
+}
+
+// GetMounts returns the filesystems mounted from block devices, once each
+// however many times they are bind mounted.
+var GetMounts = func() []Mount {
+	f, err := os.Open(ProcMounts)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var (
+		mounts  []Mount
+		devices = map[string]struct{}{}
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		if _, ok := devices[fields[0]]; ok {
+			continue
+		}
+		var stat unix.Statfs_t
+		if err := unix.Statfs(fields[1], &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		devices[fields[0]] = struct{}{}
+		mounts = append(mounts, Mount{
+			MountPoint: fields[1],
+			Device:     fields[0],
+			FSType:     fields[2],
+			Size:       stat.Blocks * uint64(stat.Bsize),
+			Used:       (stat.Blocks - stat.Bfree) * uint64(stat.Bsize),
+			Inodes:     stat.Files,
+			InodesUsed: stat.Files - stat.Ffree,
+		})
+	}
+	return mounts
+}
+
+type interfaceStats struct {
+	rxBytes, txBytes uint64
+	at               time.Time
+}
+
+var previousInterfaceStats = map[string]interfaceStats{}
+
+// GetInterfaces returns the network interfaces of the host, but for the
+// loopback, with their addresses, link speed and throughput, the latter
+// from the byte counters in /proc/net/dev.
+var GetInterfaces = func(now time.Time) []Interface {
+	f, err := os.Open(ProcNetDev)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var (
+		interfaces []Interface
+		current    = map[string]interfaceStats{}
+		scanner    = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		// e.g. "  eth0: 1234 10 0 0 0 0 0 0 5678 20 0 0 0 0 0 0"; the
+		// first two lines are headers, without a colon.
+		line := scanner.Text()
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[:colon])
+		fields := strings.Fields(line[colon+1:])
+		if name == "lo" || len(fields) < 9 {
+			continue
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			continue
+		}
+		stats := interfaceStats{rxBytes: rx, txBytes: tx, at: now}
+		current[name] = stats
+
+		i := Interface{Name: name, Speed: interfaceSpeed(name)}
+		if iface, err := net.InterfaceByName(name); err == nil {
+			if addrs, err := iface.Addrs(); err == nil {
+				for _, addr := range addrs {
+					i.Addresses = append(i.Addresses, addr.String())
+				}
+			}
+		}
+		previous, ok := previousInterfaceStats[name]
+		elapsed := now.Sub(previous.at).Seconds()
+		// Counters are reset when the interface is recreated
+		if ok && elapsed > 0 && rx >= previous.rxBytes && tx >= previous.txBytes {
+			i.RatesKnown = true
+			i.RxRate = float64(rx-previous.rxBytes) / elapsed
+			i.TxRate = float64(tx-previous.txBytes) / elapsed
+		}
+		interfaces = append(interfaces, i)
+	}
+	previousInterfaceStats = current
+	return interfaces
+}
+
+// interfaceSpeed returns the link speed of the interface in Mb/s. Virtual
+// interfaces, and those which are down, don't have one.
+func interfaceSpeed(name string) uint64 {
+	buf, err := ioutil.ReadFile("/sys/class/net/" + name + "/speed")
+	if err != nil {
+		return 0
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return uint64(speed)
+}
+
+// Roots of the files the security posture is read from. Exposed for testing.
+var (
+	SysRoot             = "/sys"
+	ProcSysRoot         = "/proc/sys"
+	RebootRequiredFiles = []string{"/var/run/reboot-required", "/run/reboot-required"}
+)
+
+// GetSecurityPosture returns the state of the security features of the
+// kernel. A reboot is required when the package manager says so, which
+// Debian and Ubuntu do by leaving a file behind after upgrading the kernel.
+var GetSecurityPosture = func() SecurityPosture {
+	posture := SecurityPosture{
+		SELinux:  "disabled",
+		AppArmor: "disabled",
+		Sysctls:  map[string]string{},
+	}
+	switch readSysfsString(filepath.Join(SysRoot, "fs/selinux/enforce")) {
+	case "1":
+		posture.SELinux = "enforcing"
+	case "0":
+		posture.SELinux = "permissive"
+	}
+	if readSysfsString(filepath.Join(SysRoot, "module/apparmor/parameters/enabled")) == "Y" {
+		posture.AppArmor = "enabled"
+	}
+	for _, name := range hardeningSysctls {
+		path := filepath.Join(ProcSysRoot, strings.Replace(name, ".", "/", -1))
+		if value := readSysfsString(path); value != "" {
+			posture.Sysctls[name] = value
+		}
+	}
+	for _, path := range RebootRequiredFiles {
+		if _, err := os.Stat(path); err == nil {
+			posture.RebootRequired = true
+		}
+	}
+	return posture
+}
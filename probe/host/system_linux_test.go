@@ -2,6 +2,10 @@ package host_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/weaveworks/scope/probe/host"
@@ -32,3 +36,42 @@ func TestUname(t *testing.T) {
 		t.Errorf("want %q, have %q", want, have)
 	}
 }
+
+func TestGetSecurityPosture(t *testing.T) {
+	root, err := ioutil.TempDir("", "security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeHwmon(t, root, map[string]string{
+		"sys/fs/selinux/enforce":                 "0",
+		"sys/module/apparmor/parameters/enabled": "Y",
+		"proc/sys/kernel/kptr_restrict":          "2",
+		"proc/sys/kernel/yama/ptrace_scope":      "1",
+		"proc/sys/net/ipv4/conf/all/rp_filter":   "1",
+		"var/run/reboot-required":                "*** System restart required ***",
+	})
+
+	oldSysRoot, oldProcSysRoot, oldRebootRequiredFiles := host.SysRoot, host.ProcSysRoot, host.RebootRequiredFiles
+	defer func() {
+		host.SysRoot, host.ProcSysRoot, host.RebootRequiredFiles = oldSysRoot, oldProcSysRoot, oldRebootRequiredFiles
+	}()
+	host.SysRoot = filepath.Join(root, "sys")
+	host.ProcSysRoot = filepath.Join(root, "proc/sys")
+	host.RebootRequiredFiles = []string{filepath.Join(root, "var/run/reboot-required")}
+
+	have := host.GetSecurityPosture()
+	want := host.SecurityPosture{
+		SELinux:  "permissive",
+		AppArmor: "enabled",
+		Sysctls: map[string]string{
+			"kernel.kptr_restrict":        "2",
+			"kernel.yama.ptrace_scope":    "1",
+			"net.ipv4.conf.all.rp_filter": "1",
+		},
+		RebootRequired: true,
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
@@ -0,0 +1,54 @@
+package kubernetes
+
+import (
+	"net"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// ServiceEndpoints returns the addresses, as host:port, of the ready
+// endpoints of a service on the port, by name or number, or the first port
+// if it's "".
+type ServiceEndpoints func(namespace, name, port string) ([]string, error)
+
+// NewServiceEndpoints returns the ServiceEndpoints of the services of the
+// API server the config targets, for probes to discover apps by, as they
+// are scaled up and down.
+func NewServiceEndpoints(config ClientConfig) (ServiceEndpoints, error) {
+	restConfig, err := restConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	c, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return func(namespace, name, port string) ([]string, error) {
+		endpoints, err := c.CoreV1().Endpoints(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return endpointAddresses(endpoints, port), nil
+	}, nil
+}
+
+func endpointAddresses(endpoints *apiv1.Endpoints, port string) []string {
+	var result []string
+	for _, subset := range endpoints.Subsets {
+		for i, p := range subset.Ports {
+			if port == "" && i > 0 {
+				break
+			}
+			if port != "" && p.Name != port && strconv.Itoa(int(p.Port)) != port {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				result = append(result, net.JoinHostPort(address.IP, strconv.Itoa(int(p.Port))))
+			}
+		}
+	}
+	return result
+}
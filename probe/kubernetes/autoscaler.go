@@ -0,0 +1,267 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/autoscaling"
+	apiautoscalingv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	ScaleTarget        = report.KubernetesScaleTarget
+	HPAMinReplicas     = report.KubernetesHPAMinReplicas
+	HPAMaxReplicas     = report.KubernetesHPAMaxReplicas
+	HPACurrentReplicas = report.KubernetesHPACurrentReplicas
+	HPADesiredReplicas = report.KubernetesHPADesiredReplicas
+	HPATargetMetrics   = report.KubernetesHPATargetMetrics
+	HPACurrentMetrics  = report.KubernetesHPACurrentMetrics
+	HPALastScaleTime   = report.KubernetesHPALastScaleTime
+	VPAUpdateMode      = report.KubernetesVPAUpdateMode
+	VPARecommendation  = report.KubernetesVPARecommendation
+
+	defaultVPAUpdateMode = "Auto"
+)
+
+// vpaGroupVersion is the API group of the VerticalPodAutoscaler custom
+// resource, which isn't part of the core Kubernetes API.
+var vpaGroupVersion = schema.GroupVersion{Group: "autoscaling.k8s.io", Version: "v1beta1"}
+
+// Autoscaler represents a Kubernetes Horizontal or Vertical Pod Autoscaler
+type Autoscaler interface {
+	Meta
+	// TargetKind and TargetName identify the workload being scaled,
+	// e.g. "Deployment" and "frontend".
+	TargetKind() string
+	TargetName() string
+	// GetNode returns the autoscaler node, with an edge to targetID if it
+	// is not empty.
+	GetNode(targetID string) report.Node
+	// TargetLatests returns the metadata to attach to the scaled workload.
+	TargetLatests() map[string]string
+}
+
+type horizontalPodAutoscaler struct {
+	*apiautoscalingv1.HorizontalPodAutoscaler
+	Meta
+}
+
+// NewHorizontalPodAutoscaler creates a new Horizontal Pod Autoscaler
+func NewHorizontalPodAutoscaler(hpa *apiautoscalingv1.HorizontalPodAutoscaler) Autoscaler {
+	return &horizontalPodAutoscaler{
+		HorizontalPodAutoscaler: hpa,
+		Meta:                    meta{hpa.ObjectMeta},
+	}
+}
+
+func (h *horizontalPodAutoscaler) TargetKind() string {
+	return h.Spec.ScaleTargetRef.Kind
+}
+
+func (h *horizontalPodAutoscaler) TargetName() string {
+	return h.Spec.ScaleTargetRef.Name
+}
+
+func (h *horizontalPodAutoscaler) GetNode(targetID string) report.Node {
+	latests := h.TargetLatests()
+	latests[NodeType] = "HorizontalPodAutoscaler"
+	latests[ScaleTarget] = h.TargetKind() + "/" + h.TargetName()
+	node := h.MetaNode(report.MakeAutoscalerNodeID(h.UID())).WithLatests(latests)
+	if targetID != "" {
+		node = node.WithAdjacent(targetID)
+	}
+	return node
+}
+
+func (h *horizontalPodAutoscaler) TargetLatests() map[string]string {
+	// Spec.MinReplicas can be omitted, and the pointer will be nil. It defaults to 1.
+	minReplicas := 1
+	if h.Spec.MinReplicas != nil {
+		minReplicas = int(*h.Spec.MinReplicas)
+	}
+	latests := map[string]string{
+		HPAMinReplicas:     fmt.Sprint(minReplicas),
+		HPAMaxReplicas:     fmt.Sprint(h.Spec.MaxReplicas),
+		HPACurrentReplicas: fmt.Sprint(h.Status.CurrentReplicas),
+		HPADesiredReplicas: fmt.Sprint(h.Status.DesiredReplicas),
+	}
+	if target := h.targetMetrics(); target != "" {
+		latests[HPATargetMetrics] = target
+	}
+	if current := h.currentMetrics(); current != "" {
+		latests[HPACurrentMetrics] = current
+	}
+	if h.Status.LastScaleTime != nil {
+		latests[HPALastScaleTime] = h.Status.LastScaleTime.Format(time.RFC3339Nano)
+	}
+	return latests
+}
+
+// targetMetrics describes what the autoscaler is aiming for. The v1 API
+// only knows about CPU utilization; any other metrics are carried in an
+// alpha annotation.
+func (h *horizontalPodAutoscaler) targetMetrics() string {
+	var specs []apiautoscalingv1.MetricSpec
+	if err := json.Unmarshal([]byte(h.Annotations[autoscaling.MetricSpecsAnnotation]), &specs); err != nil {
+		specs = nil
+	}
+	metrics := []string{}
+	if h.Spec.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, fmt.Sprintf("cpu: %d%%", *h.Spec.TargetCPUUtilizationPercentage))
+	}
+	for _, spec := range specs {
+		switch {
+		case spec.Resource != nil && spec.Resource.TargetAverageUtilization != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %d%%", spec.Resource.Name, *spec.Resource.TargetAverageUtilization))
+		case spec.Resource != nil && spec.Resource.TargetAverageValue != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %s", spec.Resource.Name, spec.Resource.TargetAverageValue.String()))
+		case spec.Pods != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %s", spec.Pods.MetricName, spec.Pods.TargetAverageValue.String()))
+		case spec.Object != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %s", spec.Object.MetricName, spec.Object.TargetValue.String()))
+		}
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// currentMetrics describes the last observed values of the target metrics.
+func (h *horizontalPodAutoscaler) currentMetrics() string {
+	var statuses []apiautoscalingv1.MetricStatus
+	if err := json.Unmarshal([]byte(h.Annotations[autoscaling.MetricStatusesAnnotation]), &statuses); err != nil {
+		statuses = nil
+	}
+	metrics := []string{}
+	if h.Status.CurrentCPUUtilizationPercentage != nil {
+		metrics = append(metrics, fmt.Sprintf("cpu: %d%%", *h.Status.CurrentCPUUtilizationPercentage))
+	}
+	for _, status := range statuses {
+		switch {
+		case status.Resource != nil && status.Resource.CurrentAverageUtilization != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %d%%", status.Resource.Name, *status.Resource.CurrentAverageUtilization))
+		case status.Resource != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %s", status.Resource.Name, status.Resource.CurrentAverageValue.String()))
+		case status.Pods != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %s", status.Pods.MetricName, status.Pods.CurrentAverageValue.String()))
+		case status.Object != nil:
+			metrics = append(metrics, fmt.Sprintf("%s: %s", status.Object.MetricName, status.Object.CurrentValue.String()))
+		}
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// vpaObject mirrors the parts of the VerticalPodAutoscaler custom resource
+// we are interested in. client-go doesn't ship with these types.
+type vpaObject struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		TargetRef    *apiautoscalingv1.CrossVersionObjectReference `json:"targetRef,omitempty"`
+		UpdatePolicy *struct {
+			UpdateMode string `json:"updateMode,omitempty"`
+		} `json:"updatePolicy,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Recommendation *struct {
+			ContainerRecommendations []vpaContainerRecommendation `json:"containerRecommendations,omitempty"`
+		} `json:"recommendation,omitempty"`
+	} `json:"status"`
+}
+
+type vpaContainerRecommendation struct {
+	ContainerName string             `json:"containerName,omitempty"`
+	Target        apiv1.ResourceList `json:"target,omitempty"`
+}
+
+type verticalPodAutoscaler struct {
+	*vpaObject
+	Meta
+}
+
+// NewVerticalPodAutoscaler creates a new Vertical Pod Autoscaler from the
+// unstructured custom resource.
+func NewVerticalPodAutoscaler(u *unstructured.Unstructured) (Autoscaler, error) {
+	buf, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var vpa vpaObject
+	if err := json.Unmarshal(buf, &vpa); err != nil {
+		return nil, err
+	}
+	return &verticalPodAutoscaler{
+		vpaObject: &vpa,
+		Meta:      meta{vpa.ObjectMeta},
+	}, nil
+}
+
+func (v *verticalPodAutoscaler) TargetKind() string {
+	if v.Spec.TargetRef == nil {
+		return ""
+	}
+	return v.Spec.TargetRef.Kind
+}
+
+func (v *verticalPodAutoscaler) TargetName() string {
+	if v.Spec.TargetRef == nil {
+		return ""
+	}
+	return v.Spec.TargetRef.Name
+}
+
+func (v *verticalPodAutoscaler) GetNode(targetID string) report.Node {
+	latests := v.TargetLatests()
+	latests[NodeType] = "VerticalPodAutoscaler"
+	if v.Spec.TargetRef != nil {
+		latests[ScaleTarget] = v.TargetKind() + "/" + v.TargetName()
+	}
+	node := v.MetaNode(report.MakeAutoscalerNodeID(v.UID())).WithLatests(latests)
+	if targetID != "" {
+		node = node.WithAdjacent(targetID)
+	}
+	return node
+}
+
+func (v *verticalPodAutoscaler) TargetLatests() map[string]string {
+	updateMode := defaultVPAUpdateMode
+	if v.Spec.UpdatePolicy != nil && v.Spec.UpdatePolicy.UpdateMode != "" {
+		updateMode = v.Spec.UpdatePolicy.UpdateMode
+	}
+	latests := map[string]string{
+		VPAUpdateMode: updateMode,
+	}
+	if v.Status.Recommendation != nil {
+		if recommendation := formatRecommendations(v.Status.Recommendation.ContainerRecommendations); recommendation != "" {
+			latests[VPARecommendation] = recommendation
+		}
+	}
+	return latests
+}
+
+// formatRecommendations renders the per-container resource targets, e.g.
+// "app: cpu=250m, memory=256Mi; sidecar: cpu=10m".
+func formatRecommendations(recommendations []vpaContainerRecommendation) string {
+	containers := []string{}
+	for _, r := range recommendations {
+		resources := []string{}
+		for name, quantity := range r.Target {
+			q := quantity
+			resources = append(resources, fmt.Sprintf("%s=%s", name, q.String()))
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		sort.Strings(resources)
+		containers = append(containers, r.ContainerName+": "+strings.Join(resources, ", "))
+	}
+	sort.Strings(containers)
+	return strings.Join(containers, "; ")
+}
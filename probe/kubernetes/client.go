@@ -11,15 +11,21 @@ import (
 	log "github.com/Sirupsen/logrus"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 	apiappsv1beta1 "k8s.io/client-go/pkg/apis/apps/v1beta1"
+	apiautoscalingv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
 	apibatchv1 "k8s.io/client-go/pkg/apis/batch/v1"
 	apibatchv2alpha1 "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 	apiextensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	apipolicyv1beta1 "k8s.io/client-go/pkg/apis/policy/v1beta1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
@@ -36,13 +42,25 @@ type Client interface {
 	WalkStatefulSets(f func(StatefulSet) error) error
 	WalkCronJobs(f func(CronJob) error) error
 	WalkNamespaces(f func(NamespaceResource) error) error
+	WalkAutoscalers(f func(Autoscaler) error) error
+	WalkResourceQuotas(f func(ResourceQuota) error) error
+	WalkLimitRanges(f func(LimitRange) error) error
+	WalkNodes(f func(NodeResource) error) error
 
 	WatchPods(f func(Event, Pod))
 
+	// LeaderElection returns whether leader election is enabled, and if so
+	// whether this probe watches cluster-scoped resources: it is the
+	// leader, or it just lost the lease and is handing over. The others
+	// only watch the pods on their node.
+	LeaderElection() (enabled, leader bool)
+
 	GetLogs(namespaceID, podID string, containerNames []string) (io.ReadCloser, error)
 	DeletePod(namespaceID, podID string) error
 	ScaleUp(resource, namespaceID, id string) error
 	ScaleDown(resource, namespaceID, id string) error
+	CordonNode(name string, unschedulable bool) error
+	DrainNode(name string, progress func(evicted, total int)) error
 }
 
 type client struct {
@@ -58,9 +76,30 @@ type client struct {
 	cronJobStore     cache.Store
 	nodeStore        cache.Store
 	namespaceStore   cache.Store
+	hpaStore         cache.Store
+	vpaStore         cache.Store
+	quotaStore       cache.Store
+	limitRangeStore  cache.Store
 
 	podWatchesMutex sync.Mutex
 	podWatches      []func(Event, Pod)
+
+	// When leader election is enabled, the cluster-scoped stores are only
+	// populated while we hold the lease, and for leaseHandover after we
+	// lose it, so there's no gap while the new leader catches up. The pods
+	// on our node are watched in localPodStore regardless.
+	elector         *LeaderElector
+	localPodStore   cache.Store
+	clusterMutex    sync.Mutex
+	clusterQuit     chan struct{}
+	handover        *time.Timer
+	clusterStores   []cache.Store
+	clusterWatchers []func(quit <-chan struct{})
+
+	// Separate from clusterMutex, since clearing the stores triggers the
+	// pod watches, which check it.
+	watchingMutex   sync.RWMutex
+	watchingCluster bool
 }
 
 // ClientConfig establishes the configuration for the kubernetes client
@@ -78,47 +117,54 @@ type ClientConfig struct {
 	Token                string
 	User                 string
 	Username             string
+
+	// LeaderElection makes the probes in the cluster elect one of them to
+	// watch cluster-scoped resources, through a Lease in LeaseNamespace
+	// held under Identity. The others only watch NodeName.
+	LeaderElection bool
+	LeaseNamespace string
+	Identity       string
+	NodeName       string
 }
 
-// NewClient returns a usable Client. Don't forget to Stop it.
-func NewClient(config ClientConfig) (Client, error) {
-	var restConfig *rest.Config
+// restConfigFor returns the config of the API server the config targets.
+func restConfigFor(config ClientConfig) (*rest.Config, error) {
 	if config.Server == "" && config.Kubeconfig == "" {
 		// If no API server address or kubeconfig was provided, assume we are running
 		// inside a pod. Try to connect to the API server through its
 		// Service environment variables, using the default Service
 		// Account Token.
-		var err error
-		if restConfig, err = rest.InClusterConfig(); err != nil {
-			return nil, err
-		}
-	} else {
-		var err error
-		restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			&clientcmd.ClientConfigLoadingRules{ExplicitPath: config.Kubeconfig},
-			&clientcmd.ConfigOverrides{
-				AuthInfo: clientcmdapi.AuthInfo{
-					ClientCertificate: config.ClientCertificate,
-					ClientKey:         config.ClientKey,
-					Token:             config.Token,
-					Username:          config.Username,
-					Password:          config.Password,
-				},
-				ClusterInfo: clientcmdapi.Cluster{
-					Server:                config.Server,
-					InsecureSkipTLSVerify: config.Insecure,
-					CertificateAuthority:  config.CertificateAuthority,
-				},
-				Context: clientcmdapi.Context{
-					Cluster:  config.Cluster,
-					AuthInfo: config.User,
-				},
-				CurrentContext: config.Context,
+		return rest.InClusterConfig()
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: config.Kubeconfig},
+		&clientcmd.ConfigOverrides{
+			AuthInfo: clientcmdapi.AuthInfo{
+				ClientCertificate: config.ClientCertificate,
+				ClientKey:         config.ClientKey,
+				Token:             config.Token,
+				Username:          config.Username,
+				Password:          config.Password,
 			},
-		).ClientConfig()
-		if err != nil {
-			return nil, err
-		}
+			ClusterInfo: clientcmdapi.Cluster{
+				Server:                config.Server,
+				InsecureSkipTLSVerify: config.Insecure,
+				CertificateAuthority:  config.CertificateAuthority,
+			},
+			Context: clientcmdapi.Context{
+				Cluster:  config.Cluster,
+				AuthInfo: config.User,
+			},
+			CurrentContext: config.Context,
+		},
+	).ClientConfig()
+}
+
+// NewClient returns a usable Client. Don't forget to Stop it.
+func NewClient(config ClientConfig) (Client, error) {
+	restConfig, err := restConfigFor(config)
+	if err != nil {
+		return nil, err
 	}
 	log.Infof("kubernetes: targeting api server %s", restConfig.Host)
 
@@ -133,17 +179,44 @@ func NewClient(config ClientConfig) (Client, error) {
 		client:       c,
 	}
 
-	podStore := NewEventStore(result.triggerPodWatches, cache.MetaNamespaceKeyFunc)
-	result.podStore = result.setupStore(c.CoreV1Client.RESTClient(), "pods", &apiv1.Pod{}, podStore)
-	result.serviceStore = result.setupStore(c.CoreV1Client.RESTClient(), "services", &apiv1.Service{}, nil)
-	result.nodeStore = result.setupStore(c.CoreV1Client.RESTClient(), "nodes", &apiv1.Node{}, nil)
+	if config.LeaderElection {
+		if result.elector, err = result.setupLeaderElector(restConfig, config.LeaseNamespace, config.Identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.elector != nil && config.NodeName != "" {
+		// Every probe watches, reports and gets events of the pods on its
+		// node, so they don't vanish while the lease changes hands. The
+		// leader watches all of them on top.
+		result.localPodStore = NewEventStore(result.triggerPodWatches, cache.MetaNamespaceKeyFunc)
+		result.watchStore(c.CoreV1Client.RESTClient(), "pods", &apiv1.Pod{}, fields.OneTermEqualSelector("spec.nodeName", config.NodeName), result.localPodStore)
+		result.podStore = result.setupStore(c.CoreV1Client.RESTClient(), "pods", &apiv1.Pod{}, nil)
+		result.nodeStore = result.watchStore(c.CoreV1Client.RESTClient(), "nodes", &apiv1.Node{}, fields.OneTermEqualSelector("metadata.name", config.NodeName), nil)
+	} else {
+		podStore := NewEventStore(result.triggerPodWatches, cache.MetaNamespaceKeyFunc)
+		result.podStore = result.setupStore(c.CoreV1Client.RESTClient(), "pods", &apiv1.Pod{}, podStore)
+		result.nodeStore = result.setupStore(c.CoreV1Client.RESTClient(), "nodes", &apiv1.Node{}, nil)
+	}
+	// Every probe tags its host with the service network, so they all
+	// watch services.
+	result.serviceStore = result.watchStore(c.CoreV1Client.RESTClient(), "services", &apiv1.Service{}, fields.Everything(), nil)
 	result.namespaceStore = result.setupStore(c.CoreV1Client.RESTClient(), "namespaces", &apiv1.Namespace{}, nil)
+	result.quotaStore = result.setupStore(c.CoreV1Client.RESTClient(), "resourcequotas", &apiv1.ResourceQuota{}, nil)
+	result.limitRangeStore = result.setupStore(c.CoreV1Client.RESTClient(), "limitranges", &apiv1.LimitRange{}, nil)
 	result.deploymentStore = result.setupStore(c.ExtensionsV1beta1Client.RESTClient(), "deployments", &apiextensionsv1beta1.Deployment{}, nil)
 	result.daemonSetStore = result.setupStore(c.ExtensionsV1beta1Client.RESTClient(), "daemonsets", &apiextensionsv1beta1.DaemonSet{}, nil)
 	result.jobStore = result.setupStore(c.BatchV1Client.RESTClient(), "jobs", &apibatchv1.Job{}, nil)
 	result.cronJobStore = result.setupStore(c.BatchV2alpha1Client.RESTClient(), "cronjobs", &apibatchv2alpha1.CronJob{}, nil)
 	result.statefulSetStore = result.setupStore(c.AppsV1beta1Client.RESTClient(), "statefulsets", &apiappsv1beta1.StatefulSet{}, nil)
+	result.hpaStore = result.setupStore(c.AutoscalingV1Client.RESTClient(), "horizontalpodautoscalers", &apiautoscalingv1.HorizontalPodAutoscaler{}, nil)
+	if result.vpaStore, err = result.setupVPAStore(restConfig); err != nil {
+		return nil, err
+	}
 
+	if result.elector != nil {
+		go result.elector.Run(result.quit)
+	}
 	return result, nil
 }
 
@@ -171,16 +244,153 @@ func (c *client) setupStore(kclient rest.Interface, resource string, itemType in
 	if store == nil {
 		store = cache.NewStore(cache.MetaNamespaceKeyFunc)
 	}
-	c.runReflectorUntil(cache.NewReflector(lw, itemType, store, c.resyncPeriod), kclient.APIVersion(), resource)
+	c.watchClusterScoped(cache.NewReflector(lw, itemType, store, c.resyncPeriod), store, kclient.APIVersion(), resource)
 	return store
 }
 
+// watchStore watches the resources matching selector whether we lead or
+// not, as the node this probe runs on.
+func (c *client) watchStore(kclient rest.Interface, resource string, itemType interface{}, selector fields.Selector, nonDefaultStore cache.Store) cache.Store {
+	lw := cache.NewListWatchFromClient(kclient, resource, metav1.NamespaceAll, selector)
+	store := nonDefaultStore
+	if store == nil {
+		store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	}
+	c.runReflectorUntil(cache.NewReflector(lw, itemType, store, c.resyncPeriod), kclient.APIVersion(), resource, c.quit)
+	return store
+}
+
+// setupLeaderElector elects a leader through a Lease. Leases are only in
+// newer Kubernetes versions, so like VPAs we use the dynamic client.
+func (c *client) setupLeaderElector(restConfig *rest.Config, namespace, identity string) (*LeaderElector, error) {
+	if ok, err := c.isResourceSupported(leaseGroupVersion, "leases"); err != nil {
+		return nil, err
+	} else if !ok {
+		log.Warnf("Kubernetes: leases are not supported by this Kubernetes version, disabling leader election")
+		return nil, nil
+	}
+	config := *restConfig
+	config.GroupVersion = &leaseGroupVersion
+	config.APIPath = "/apis"
+	dc, err := dynamic.NewClient(&config)
+	if err != nil {
+		return nil, err
+	}
+	leases := dc.Resource(&metav1.APIResource{Name: "leases", Namespaced: true}, namespace)
+	return NewLeaderElector(leases, namespace, identity, c.startClusterWatchers, c.stopClusterWatchers), nil
+}
+
+// watchClusterScoped runs the reflector straight away, unless leader
+// election is enabled, in which case it only runs while we lead.
+func (c *client) watchClusterScoped(r *cache.Reflector, store cache.Store, groupVersion schema.GroupVersion, resource string) {
+	if c.elector == nil {
+		c.runReflectorUntil(r, groupVersion, resource, c.quit)
+		return
+	}
+	c.clusterMutex.Lock()
+	defer c.clusterMutex.Unlock()
+	c.clusterStores = append(c.clusterStores, store)
+	c.clusterWatchers = append(c.clusterWatchers, func(quit <-chan struct{}) {
+		c.runReflectorUntil(r, groupVersion, resource, quit)
+	})
+}
+
+func (c *client) startClusterWatchers() {
+	c.clusterMutex.Lock()
+	defer c.clusterMutex.Unlock()
+	c.setWatchingCluster(true)
+	if c.handover != nil {
+		// We got the lease back while handing it over, so the reflectors
+		// are still running.
+		c.handover.Stop()
+		c.handover = nil
+		return
+	}
+	c.clusterQuit = make(chan struct{})
+	for _, watch := range c.clusterWatchers {
+		watch(c.clusterQuit)
+	}
+}
+
+// stopClusterWatchers keeps watching and reporting the cluster-scoped
+// resources for leaseHandover, while the new leader catches up, and then
+// stops the reflectors.
+func (c *client) stopClusterWatchers() {
+	c.clusterMutex.Lock()
+	defer c.clusterMutex.Unlock()
+	if c.clusterQuit == nil || c.handover != nil {
+		return
+	}
+	var handover *time.Timer
+	handover = time.AfterFunc(leaseHandover, func() { c.clearClusterWatchers(handover) })
+	c.handover = handover
+}
+
+// clearClusterWatchers stops the reflectors and empties their stores, so
+// that another probe taking over doesn't leave us with stale state.
+func (c *client) clearClusterWatchers(handover *time.Timer) {
+	c.clusterMutex.Lock()
+	defer c.clusterMutex.Unlock()
+	if c.handover != handover {
+		// We got the lease back meanwhile
+		return
+	}
+	c.handover = nil
+	c.setWatchingCluster(false)
+	close(c.clusterQuit)
+	c.clusterQuit = nil
+	for _, store := range c.clusterStores {
+		if err := store.Replace([]interface{}{}, ""); err != nil {
+			log.Warnf("Kubernetes: cannot clear store: %v", err)
+		}
+	}
+}
+
+func (c *client) setWatchingCluster(watching bool) {
+	c.watchingMutex.Lock()
+	defer c.watchingMutex.Unlock()
+	c.watchingCluster = watching
+}
+
+func (c *client) LeaderElection() (enabled, leader bool) {
+	if c.elector == nil {
+		return false, true
+	}
+	c.watchingMutex.RLock()
+	defer c.watchingMutex.RUnlock()
+	return true, c.watchingCluster
+}
+
+// setupVPAStore watches VerticalPodAutoscalers. They are a custom resource,
+// so we go through the dynamic client rather than a typed one.
+func (c *client) setupVPAStore(restConfig *rest.Config) (cache.Store, error) {
+	config := *restConfig
+	config.GroupVersion = &vpaGroupVersion
+	config.APIPath = "/apis"
+	dc, err := dynamic.NewClient(&config)
+	if err != nil {
+		return nil, err
+	}
+	rc := dc.Resource(&metav1.APIResource{Name: "verticalpodautoscalers", Namespaced: true}, metav1.NamespaceAll)
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return rc.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return rc.Watch(options)
+		},
+	}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	c.watchClusterScoped(cache.NewReflector(lw, &unstructured.Unstructured{}, store, c.resyncPeriod), store, vpaGroupVersion, "verticalpodautoscalers")
+	return store, nil
+}
+
 // runReflectorUntil runs cache.Reflector#ListAndWatch in an endless loop, after checking that the resource is supported by kubernetes.
 // Errors are logged and retried with exponential backoff.
-func (c *client) runReflectorUntil(r *cache.Reflector, groupVersion schema.GroupVersion, resource string) {
+func (c *client) runReflectorUntil(r *cache.Reflector, groupVersion schema.GroupVersion, resource string, quit <-chan struct{}) {
 	listAndWatch := func() (bool, error) {
 		select {
-		case <-c.quit:
+		case <-quit:
 			return true, nil
 		default:
 			ok, err := c.isResourceSupported(groupVersion, resource)
@@ -191,7 +401,7 @@ func (c *client) runReflectorUntil(r *cache.Reflector, groupVersion schema.Group
 				log.Infof("%v are not supported by this Kubernetes version", resource)
 				return true, nil
 			}
-			err = r.ListAndWatch(c.quit)
+			err = r.ListAndWatch(quit)
 			return false, err
 		}
 	}
@@ -207,6 +417,11 @@ func (c *client) WatchPods(f func(Event, Pod)) {
 }
 
 func (c *client) triggerPodWatches(e Event, pod interface{}) {
+	// Without a local pod store, don't report pods as deleted when we
+	// clear the store after losing the lease: the new leader reports them.
+	if _, leader := c.LeaderElection(); !leader && c.localPodStore == nil {
+		return
+	}
 	c.podWatchesMutex.Lock()
 	defer c.podWatchesMutex.Unlock()
 	for _, watch := range c.podWatches {
@@ -215,7 +430,11 @@ func (c *client) triggerPodWatches(e Event, pod interface{}) {
 }
 
 func (c *client) WalkPods(f func(Pod) error) error {
-	for _, m := range c.podStore.List() {
+	store := c.podStore
+	if _, leader := c.LeaderElection(); !leader && c.localPodStore != nil {
+		store = c.localPodStore
+	}
+	for _, m := range store.List() {
 		pod := m.(*apiv1.Pod)
 		if err := f(NewPod(pod)); err != nil {
 			return err
@@ -305,6 +524,61 @@ func (c *client) WalkNamespaces(f func(NamespaceResource) error) error {
 	return nil
 }
 
+func (c *client) WalkNodes(f func(NodeResource) error) error {
+	for _, m := range c.nodeStore.List() {
+		node := m.(*apiv1.Node)
+		if err := f(NewNode(node)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) WalkResourceQuotas(f func(ResourceQuota) error) error {
+	for _, m := range c.quotaStore.List() {
+		quota := m.(*apiv1.ResourceQuota)
+		if err := f(NewResourceQuota(quota)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) WalkLimitRanges(f func(LimitRange) error) error {
+	for _, m := range c.limitRangeStore.List() {
+		limitRange := m.(*apiv1.LimitRange)
+		if err := f(NewLimitRange(limitRange)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkAutoscalers calls f for each horizontal and vertical pod autoscaler
+func (c *client) WalkAutoscalers(f func(Autoscaler) error) error {
+	if c.hpaStore != nil {
+		for _, m := range c.hpaStore.List() {
+			hpa := m.(*apiautoscalingv1.HorizontalPodAutoscaler)
+			if err := f(NewHorizontalPodAutoscaler(hpa)); err != nil {
+				return err
+			}
+		}
+	}
+	if c.vpaStore != nil {
+		for _, m := range c.vpaStore.List() {
+			vpa, err := NewVerticalPodAutoscaler(m.(*unstructured.Unstructured))
+			if err != nil {
+				log.Warnf("Cannot parse VerticalPodAutoscaler: %v", err)
+				continue
+			}
+			if err := f(vpa); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *client) GetLogs(namespaceID, podID string, containerNames []string) (io.ReadCloser, error) {
 	readClosersWithLabel := map[io.ReadCloser]string{}
 	for _, container := range containerNames {
@@ -356,6 +630,70 @@ func (c *client) modifyScale(resource, namespace, id string, f func(*apiextensio
 	return err
 }
 
+// CordonNode marks the named node as (un)schedulable.
+func (c *client) CordonNode(name string, unschedulable bool) error {
+	node, err := c.client.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if node.Spec.Unschedulable == unschedulable {
+		return nil
+	}
+	node.Spec.Unschedulable = unschedulable
+	_, err = c.client.CoreV1().Nodes().Update(node)
+	return err
+}
+
+// DrainNode cordons the named node, and evicts all its pods, except
+// those managed by DaemonSets and mirror pods, which would just come
+// back, telling progress of each pod evicted.
+func (c *client) DrainNode(name string, progress func(evicted, total int)) error {
+	if err := c.CordonNode(name, true); err != nil {
+		return err
+	}
+	// List the pods from the API server rather than the pod store, which
+	// only has the pods of our node unless we are the leader.
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return err
+	}
+	var evictable []*apiv1.Pod
+	for i := range pods.Items {
+		if isEvictable(&pods.Items[i]) {
+			evictable = append(evictable, &pods.Items[i])
+		}
+	}
+	for i, pod := range evictable {
+		progress(i, len(evictable))
+		eviction := &apipolicyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		}
+		if err := c.client.CoreV1().Pods(pod.Namespace).Evict(eviction); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("cannot evict pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	progress(len(evictable), len(evictable))
+	return nil
+}
+
+// mirrorPodAnnotation marks the API server's copies of static pods, which
+// are managed by the kubelet itself.
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+func isEvictable(pod *apiv1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *client) Stop() {
 	close(c.quit)
 }
@@ -1,6 +1,7 @@
 package kubernetes
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 
@@ -15,6 +16,10 @@ const (
 	DeletePod = report.KubernetesDeletePod
 	ScaleUp   = report.KubernetesScaleUp
 	ScaleDown = report.KubernetesScaleDown
+
+	CordonNode   = report.KubernetesCordonNode
+	UncordonNode = report.KubernetesUncordonNode
+	DrainNode    = report.KubernetesDrainNode
 )
 
 // GetLogs is the control to get the logs for a kubernetes pod
@@ -105,12 +110,52 @@ func (r *Reporter) ScaleDown(req xfer.Request, namespace, id string) xfer.Respon
 	return xfer.ResponseError(r.client.ScaleDown(report.Deployment, namespace, id))
 }
 
+// CaptureNode is exported for testing
+func (r *Reporter) CaptureNode(f func(xfer.Request, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		hostID, ok := report.ParseHostNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		// Node controls can only act on the node this probe runs on
+		if hostID != r.hostID || r.nodeName == "" {
+			return xfer.ResponseErrorf("Node not found: %s", hostID)
+		}
+		return f(req, r.nodeName)
+	}
+}
+
+func (r *Reporter) cordonNode(req xfer.Request, name string) xfer.Response {
+	return xfer.ResponseError(r.client.CordonNode(name, true))
+}
+
+func (r *Reporter) uncordonNode(req xfer.Request, name string) xfer.Response {
+	return xfer.ResponseError(r.client.CordonNode(name, false))
+}
+
+// drainNode is a job, as evicting pods can take minutes.
+func (r *Reporter) drainNode(req xfer.Request, name string) xfer.Response {
+	return controls.Job(r.pipes, func(req xfer.Request, progress controls.Progress) xfer.Response {
+		return xfer.ResponseError(r.client.DrainNode(name, func(evicted, total int) {
+			percent := 100
+			if total > 0 {
+				percent = 100 * evicted / total
+			}
+			progress(fmt.Sprintf("Evicted %d of %d pods", evicted, total), percent)
+		}))
+	})(req)
+}
+
 func (r *Reporter) registerControls() {
 	controls := map[string]xfer.ControlHandlerFunc{
 		GetLogs:   r.CapturePod(r.GetLogs),
 		DeletePod: r.CapturePod(r.deletePod),
 		ScaleUp:   r.CaptureDeployment(r.ScaleUp),
 		ScaleDown: r.CaptureDeployment(r.ScaleDown),
+
+		CordonNode:   r.CaptureNode(r.cordonNode),
+		UncordonNode: r.CaptureNode(r.uncordonNode),
+		DrainNode:    r.CaptureNode(r.drainNode),
 	}
 	r.handlerRegistry.Batch(nil, controls)
 }
@@ -121,6 +166,9 @@ func (r *Reporter) deregisterControls() {
 		DeletePod,
 		ScaleUp,
 		ScaleDown,
+		CordonNode,
+		UncordonNode,
+		DrainNode,
 	}
 	r.handlerRegistry.Batch(controls, nil)
 }
@@ -23,6 +23,7 @@ const (
 type Deployment interface {
 	Meta
 	Selector() (labels.Selector, error)
+	SpreadConstraints() []SpreadConstraint
 	GetNode(probeID string) report.Node
 }
 
@@ -45,13 +46,17 @@ func (d *deployment) Selector() (labels.Selector, error) {
 	return selector, nil
 }
 
+func (d *deployment) SpreadConstraints() []SpreadConstraint {
+	return spreadConstraints(d.Annotations)
+}
+
 func (d *deployment) GetNode(probeID string) report.Node {
 	// Spec.Replicas can be omitted, and the pointer will be nil. It defaults to 1.
 	desiredReplicas := 1
 	if d.Spec.Replicas != nil {
 		desiredReplicas = int(*d.Spec.Replicas)
 	}
-	return d.MetaNode(report.MakeDeploymentNodeID(d.UID())).WithLatests(map[string]string{
+	latests := map[string]string{
 		ObservedGeneration:    fmt.Sprint(d.Status.ObservedGeneration),
 		DesiredReplicas:       fmt.Sprint(desiredReplicas),
 		Replicas:              fmt.Sprint(d.Status.Replicas),
@@ -61,5 +66,13 @@ func (d *deployment) GetNode(probeID string) report.Node {
 		Strategy:              string(d.Spec.Strategy.Type),
 		report.ControlProbeID: probeID,
 		NodeType:              "Deployment",
-	}).WithLatestActiveControls(ScaleUp, ScaleDown)
+	}
+	if affinity := describeAffinity(d.Spec.Template.Spec.Affinity); affinity != "" {
+		latests[Affinity] = affinity
+	}
+	if spread := describeSpreadConstraints(d.SpreadConstraints()); spread != "" {
+		latests[TopologySpread] = spread
+	}
+	return d.MetaNode(report.MakeDeploymentNodeID(d.UID())).WithLatests(latests).
+		WithLatestActiveControls(ScaleUp, ScaleDown)
 }
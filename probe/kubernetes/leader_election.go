@@ -0,0 +1,217 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/weaveworks/common/mtime"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	leaseName         = "weave-scope-probe"
+	leaseDuration     = 15 * time.Second
+	leaseRetryPeriod  = 5 * time.Second
+	leaseMicroTimeFmt = "2006-01-02T15:04:05.000000Z07:00"
+
+	// leaseHandover is how long a probe which lost the lease keeps
+	// reporting the cluster-scoped resources: long enough for the new
+	// leader to take the expired lease and list them.
+	leaseHandover = 2 * leaseDuration
+)
+
+// leaseGroupVersion is the API group of Leases. The vendored client-go
+// predates them, so we go through the dynamic client.
+var leaseGroupVersion = schema.GroupVersion{Group: "coordination.k8s.io", Version: "v1"}
+
+// LeaseClient is the subset of the dynamic resource client used to
+// manipulate the lease.
+type LeaseClient interface {
+	Get(name string) (*unstructured.Unstructured, error)
+	Create(obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Update(obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+}
+
+// leaseObject mirrors the coordination.k8s.io Lease resource.
+type leaseObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// LeaderElector uses a Lease to elect a single probe in the cluster to
+// watch cluster-scoped resources.
+type LeaderElector struct {
+	leases           LeaseClient
+	namespace        string
+	identity         string
+	onStartedLeading func()
+	onStoppedLeading func()
+
+	mtx     sync.Mutex
+	leading bool
+	renewed time.Time // when we last renewed the lease, if leading
+
+	// observed is the last lease record we saw, and when we saw it.
+	// Lease expiry is worked out against our own clock, so clock skew
+	// between probes doesn't matter.
+	observedHolder string
+	observedRenew  string
+	observedTime   time.Time
+}
+
+// NewLeaderElector makes a new LeaderElector. The callbacks are called
+// when this probe gains and loses the lease.
+func NewLeaderElector(leases LeaseClient, namespace, identity string, onStartedLeading, onStoppedLeading func()) *LeaderElector {
+	return &LeaderElector{
+		leases:           leases,
+		namespace:        namespace,
+		identity:         identity,
+		onStartedLeading: onStartedLeading,
+		onStoppedLeading: onStoppedLeading,
+	}
+}
+
+// IsLeader returns true if this probe holds the lease.
+func (e *LeaderElector) IsLeader() bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.leading
+}
+
+// Run tries to acquire or renew the lease periodically, until quit is
+// closed. The lease isn't released on exit; it just expires.
+func (e *LeaderElector) Run(quit <-chan struct{}) {
+	ticker := time.NewTicker(leaseRetryPeriod)
+	defer ticker.Stop()
+	for {
+		e.Tick()
+		select {
+		case <-quit:
+			e.setLeading(false, time.Time{})
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick makes a single attempt at acquiring or renewing the lease (it's
+// just exported for testing).
+func (e *LeaderElector) Tick() {
+	now := mtime.Now()
+	acquired, err := e.tryAcquireOrRenew(now)
+	if err != nil {
+		log.Warnf("Kubernetes: cannot acquire or renew lease %s/%s: %v", e.namespace, leaseName, err)
+	}
+	e.mtx.Lock()
+	renewed := e.renewed
+	e.mtx.Unlock()
+	switch {
+	case acquired:
+		e.setLeading(true, now)
+	case err != nil && e.IsLeader() && now.Sub(renewed) < leaseDuration:
+		// Hang on to leadership until our lease runs out; the API server
+		// may only be briefly unavailable.
+	default:
+		e.setLeading(false, time.Time{})
+	}
+}
+
+func (e *LeaderElector) setLeading(leading bool, renewed time.Time) {
+	e.mtx.Lock()
+	changed := e.leading != leading
+	e.leading = leading
+	e.renewed = renewed
+	e.mtx.Unlock()
+	if !changed {
+		return
+	}
+	if leading {
+		log.Infof("Kubernetes: acquired lease %s/%s, watching cluster-scoped resources", e.namespace, leaseName)
+		e.onStartedLeading()
+	} else {
+		log.Infof("Kubernetes: lost lease %s/%s, only reporting host-local data", e.namespace, leaseName)
+		e.onStoppedLeading()
+	}
+}
+
+func (e *LeaderElector) tryAcquireOrRenew(now time.Time) (bool, error) {
+	u, err := e.leases.Get(leaseName)
+	if apierrors.IsNotFound(err) {
+		lease := leaseObject{}
+		lease.APIVersion = leaseGroupVersion.String()
+		lease.Kind = "Lease"
+		lease.Name = leaseName
+		lease.Namespace = e.namespace
+		lease.Spec.AcquireTime = now.Format(leaseMicroTimeFmt)
+		e.hold(&lease, now)
+		if err := e.write(e.leases.Create, &lease); apierrors.IsAlreadyExists(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var lease leaseObject
+	if buf, err := u.MarshalJSON(); err != nil {
+		return false, err
+	} else if err := json.Unmarshal(buf, &lease); err != nil {
+		return false, err
+	}
+	if lease.Spec.HolderIdentity != e.observedHolder || lease.Spec.RenewTime != e.observedRenew {
+		e.observedHolder = lease.Spec.HolderIdentity
+		e.observedRenew = lease.Spec.RenewTime
+		e.observedTime = now
+	}
+
+	if lease.Spec.HolderIdentity != e.identity {
+		duration := time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second
+		if lease.Spec.HolderIdentity != "" && now.Sub(e.observedTime) < duration {
+			return false, nil
+		}
+		lease.Spec.AcquireTime = now.Format(leaseMicroTimeFmt)
+		lease.Spec.LeaseTransitions++
+	}
+	e.hold(&lease, now)
+	// The update carries the resourceVersion we read, so if another probe
+	// got there first we get a conflict.
+	if err := e.write(e.leases.Update, &lease); apierrors.IsConflict(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (e *LeaderElector) hold(lease *leaseObject, now time.Time) {
+	lease.Spec.HolderIdentity = e.identity
+	lease.Spec.LeaseDurationSeconds = int(leaseDuration / time.Second)
+	lease.Spec.RenewTime = now.Format(leaseMicroTimeFmt)
+}
+
+func (e *LeaderElector) write(f func(*unstructured.Unstructured) (*unstructured.Unstructured, error), lease *leaseObject) error {
+	buf, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(buf); err != nil {
+		return err
+	}
+	_, err = f(u)
+	return err
+}
@@ -0,0 +1,126 @@
+package kubernetes_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+)
+
+var leaseResource = schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}
+
+// mockLeases stores a single lease, and rejects stale updates like the API
+// server does.
+type mockLeases struct {
+	lease   *unstructured.Unstructured
+	version int
+}
+
+func (m *mockLeases) Get(name string) (*unstructured.Unstructured, error) {
+	if m.lease == nil {
+		return nil, apierrors.NewNotFound(leaseResource, name)
+	}
+	return copyLease(m.lease), nil
+}
+
+func (m *mockLeases) Create(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if m.lease != nil {
+		return nil, apierrors.NewAlreadyExists(leaseResource, obj.GetName())
+	}
+	return m.store(obj), nil
+}
+
+func (m *mockLeases) Update(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if m.lease == nil || obj.GetResourceVersion() != m.lease.GetResourceVersion() {
+		return nil, apierrors.NewConflict(leaseResource, obj.GetName(), nil)
+	}
+	return m.store(obj), nil
+}
+
+func (m *mockLeases) store(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	m.version++
+	m.lease = copyLease(obj)
+	m.lease.SetResourceVersion(strconv.Itoa(m.version))
+	return m.lease
+}
+
+func copyLease(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	buf, err := obj.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	result := &unstructured.Unstructured{}
+	if err := result.UnmarshalJSON(buf); err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (m *mockLeases) holder() string {
+	spec, _ := m.lease.Object["spec"].(map[string]interface{})
+	holder, _ := spec["holderIdentity"].(string)
+	return holder
+}
+
+func TestLeaderElector(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	leases := &mockLeases{}
+	events := map[string][]bool{}
+	elector := func(identity string) *kubernetes.LeaderElector {
+		return kubernetes.NewLeaderElector(leases, "weave", identity,
+			func() { events[identity] = append(events[identity], true) },
+			func() { events[identity] = append(events[identity], false) },
+		)
+	}
+	a, b := elector("a"), elector("b")
+
+	// The first probe creates the lease; the second has to wait
+	a.Tick()
+	b.Tick()
+	if !a.IsLeader() || b.IsLeader() || leases.holder() != "a" {
+		t.Fatalf("Expected a to lead, got a=%v b=%v holder=%q", a.IsLeader(), b.IsLeader(), leases.holder())
+	}
+
+	// The leader renews the lease, so the other probe keeps waiting
+	for i := 0; i < 5; i++ {
+		now = now.Add(5 * time.Second)
+		mtime.NowForce(now)
+		a.Tick()
+		b.Tick()
+	}
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("Expected a to still lead, got a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	// Once the leader stops renewing, the lease expires and the other
+	// probe takes over
+	for i := 0; i < 4; i++ {
+		now = now.Add(5 * time.Second)
+		mtime.NowForce(now)
+		b.Tick()
+	}
+	if !b.IsLeader() || leases.holder() != "b" {
+		t.Fatalf("Expected b to take over, got b=%v holder=%q", b.IsLeader(), leases.holder())
+	}
+
+	// The old leader notices it lost the lease
+	a.Tick()
+	if a.IsLeader() {
+		t.Errorf("Expected a to step down")
+	}
+	if have := events["a"]; len(have) != 2 || !have[0] || have[1] {
+		t.Errorf("Expected a to start then stop leading, got %v", have)
+	}
+	if have := events["b"]; len(have) != 1 || !have[0] {
+		t.Errorf("Expected b to start leading, got %v", have)
+	}
+}
@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// LimitRange represents a Kubernetes limit range
+type LimitRange interface {
+	Meta
+	// Describe summarises the constraints, e.g.
+	// "Container cpu: min=100m, max=2, default=500m".
+	Describe() string
+}
+
+type limitRange struct {
+	*apiv1.LimitRange
+	Meta
+}
+
+// NewLimitRange creates a new LimitRange
+func NewLimitRange(l *apiv1.LimitRange) LimitRange {
+	return &limitRange{LimitRange: l, Meta: meta{l.ObjectMeta}}
+}
+
+func (l *limitRange) Describe() string {
+	limits := []string{}
+	for _, item := range l.Spec.Limits {
+		names := map[apiv1.ResourceName]struct{}{}
+		for _, list := range []apiv1.ResourceList{item.Min, item.Max, item.Default, item.DefaultRequest} {
+			for name := range list {
+				names[name] = struct{}{}
+			}
+		}
+		sorted := []string{}
+		for name := range names {
+			sorted = append(sorted, string(name))
+		}
+		sort.Strings(sorted)
+		for _, name := range sorted {
+			constraints := []string{}
+			for _, c := range []struct {
+				label string
+				list  apiv1.ResourceList
+			}{
+				{"min", item.Min},
+				{"max", item.Max},
+				{"default", item.Default},
+				{"defaultRequest", item.DefaultRequest},
+			} {
+				if q, ok := c.list[apiv1.ResourceName(name)]; ok {
+					constraints = append(constraints, fmt.Sprintf("%s=%s", c.label, q.String()))
+				}
+			}
+			limits = append(limits, fmt.Sprintf("%s %s: %s", item.Type, name, strings.Join(constraints, ", ")))
+		}
+	}
+	return strings.Join(limits, "; ")
+}
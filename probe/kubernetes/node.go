@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"strconv"
+	"strings"
+
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	NodeConditions = report.KubernetesNodeConditions
+	NodeTaints     = report.KubernetesNodeTaints
+	NodeCordoned   = report.KubernetesNodeCordoned
+
+	// NodeNotReady is reported when the Ready condition isn't true.
+	NodeNotReady = "NotReady"
+
+	// The vendored API predates this condition.
+	nodePIDPressure apiv1.NodeConditionType = "PIDPressure"
+)
+
+// problemConditions are the node conditions which indicate a problem
+// when true.
+var problemConditions = []apiv1.NodeConditionType{
+	apiv1.NodeMemoryPressure,
+	apiv1.NodeDiskPressure,
+	nodePIDPressure,
+	apiv1.NodeOutOfDisk,
+	apiv1.NodeNetworkUnavailable,
+}
+
+// NodeResource represents a Kubernetes node
+// `Node` would be confused with report.Node
+type NodeResource interface {
+	Meta
+	Problems() []string
+	Taints() []string
+	Unschedulable() bool
+	GetNode(hostID string) report.Node
+}
+
+type node struct {
+	*apiv1.Node
+	Meta
+}
+
+// NewNode creates a new NodeResource
+func NewNode(n *apiv1.Node) NodeResource {
+	return &node{Node: n, Meta: meta{n.ObjectMeta}}
+}
+
+// Problems lists the conditions the node is suffering from, e.g.
+// MemoryPressure, or NotReady.
+func (n *node) Problems() []string {
+	status := map[apiv1.NodeConditionType]apiv1.ConditionStatus{}
+	for _, c := range n.Status.Conditions {
+		status[c.Type] = c.Status
+	}
+	problems := []string{}
+	if status[apiv1.NodeReady] != apiv1.ConditionTrue {
+		problems = append(problems, NodeNotReady)
+	}
+	for _, c := range problemConditions {
+		if status[c] == apiv1.ConditionTrue {
+			problems = append(problems, string(c))
+		}
+	}
+	return problems
+}
+
+// Taints lists the node taints, e.g. "dedicated=gpu:NoSchedule".
+func (n *node) Taints() []string {
+	taints := []string{}
+	for _, t := range n.Spec.Taints {
+		taint := t.Key
+		if t.Value != "" {
+			taint += "=" + t.Value
+		}
+		taints = append(taints, taint+":"+string(t.Effect))
+	}
+	return taints
+}
+
+func (n *node) Unschedulable() bool {
+	return n.Spec.Unschedulable
+}
+
+// GetNode returns the host node for hostID, annotated with the state of
+// the Kubernetes node running on it.
+func (n *node) GetNode(hostID string) report.Node {
+	conditions := "Ready"
+	if problems := n.Problems(); len(problems) > 0 {
+		conditions = strings.Join(problems, ", ")
+	}
+	latests := map[string]string{
+		NodeConditions: conditions,
+		NodeCordoned:   strconv.FormatBool(n.Unschedulable()),
+	}
+	if taints := n.Taints(); len(taints) > 0 {
+		latests[NodeTaints] = strings.Join(taints, ", ")
+	}
+	return report.MakeNodeWith(report.MakeHostNodeID(hostID), latests).
+		WithLatestControls(map[string]report.NodeControlData{
+			CordonNode:   {Dead: n.Unschedulable()},
+			UncordonNode: {Dead: !n.Unschedulable()},
+			DrainNode:    {},
+		})
+}
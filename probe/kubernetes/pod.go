@@ -25,6 +25,11 @@ type Pod interface {
 	GetNode(probeID string) report.Node
 	RestartCount() uint
 	ContainerNames() []string
+	IP() string
+	// SidecarProxy returns the name of the service mesh sidecar proxy
+	// container in this pod, if there is one.
+	SidecarProxy() string
+	Affinity() *apiv1.Affinity
 }
 
 type pod struct {
@@ -83,6 +88,14 @@ func (p *pod) GetNode(probeID string) report.Node {
 		latests[IsInHostNetwork] = "true"
 	}
 
+	if sidecar := p.SidecarProxy(); sidecar != "" {
+		latests[SidecarProxy] = sidecar
+	}
+
+	if affinity := describeAffinity(p.Affinity()); affinity != "" {
+		latests[Affinity] = affinity
+	}
+
 	return p.MetaNode(report.MakePodNodeID(p.UID())).WithLatests(latests).
 		WithParents(p.parents).
 		WithLatestActiveControls(GetLogs, DeletePod)
@@ -95,3 +108,20 @@ func (p *pod) ContainerNames() []string {
 	}
 	return containerNames
 }
+
+func (p *pod) IP() string {
+	return p.Status.PodIP
+}
+
+func (p *pod) Affinity() *apiv1.Affinity {
+	return p.Pod.Spec.Affinity
+}
+
+func (p *pod) SidecarProxy() string {
+	for _, c := range p.Pod.Spec.Containers {
+		if IsSidecarProxy(c.Name) {
+			return c.Name
+		}
+	}
+	return ""
+}
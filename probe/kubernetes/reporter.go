@@ -3,6 +3,7 @@ package kubernetes
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/labels"
@@ -34,7 +35,8 @@ var (
 		Namespace:        {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 5},
 		Created:          {ID: Created, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 6},
 		RestartCount:     {ID: RestartCount, Label: "Restart #", From: report.FromLatest, Priority: 7},
-	}
+		SidecarProxy:     {ID: SidecarProxy, Label: "Sidecar", From: report.FromLatest, Priority: 8},
+	}.Merge(SchedulingMetadataTemplates)
 
 	PodMetricTemplates = docker.ContainerMetricTemplates
 
@@ -56,7 +58,7 @@ var (
 		DesiredReplicas:    {ID: DesiredReplicas, Label: "Desired Replicas", From: report.FromLatest, Datatype: report.Number, Priority: 5},
 		report.Pod:         {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: report.Number, Priority: 6},
 		Strategy:           {ID: Strategy, Label: "Strategy", From: report.FromLatest, Priority: 7},
-	}
+	}.Merge(AutoscalingMetadataTemplates).Merge(SchedulingMetadataTemplates)
 
 	DeploymentMetricTemplates = PodMetricTemplates
 
@@ -77,7 +79,7 @@ var (
 		ObservedGeneration: {ID: ObservedGeneration, Label: "Observed Gen.", From: report.FromLatest, Datatype: report.Number, Priority: 4},
 		DesiredReplicas:    {ID: DesiredReplicas, Label: "Desired Replicas", From: report.FromLatest, Datatype: report.Number, Priority: 5},
 		report.Pod:         {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: report.Number, Priority: 6},
-	}
+	}.Merge(AutoscalingMetadataTemplates).Merge(SchedulingMetadataTemplates)
 
 	StatefulSetMetricTemplates = PodMetricTemplates
 
@@ -94,6 +96,54 @@ var (
 
 	CronJobMetricTemplates = PodMetricTemplates
 
+	// AutoscalingMetadataTemplates are shown on workloads targeted by an
+	// autoscaler, as well as on the autoscaler itself.
+	AutoscalingMetadataTemplates = report.MetadataTemplates{
+		HPAMinReplicas:     {ID: HPAMinReplicas, Label: "HPA Min Replicas", From: report.FromLatest, Datatype: report.Number, Priority: 10},
+		HPAMaxReplicas:     {ID: HPAMaxReplicas, Label: "HPA Max Replicas", From: report.FromLatest, Datatype: report.Number, Priority: 11},
+		HPACurrentReplicas: {ID: HPACurrentReplicas, Label: "HPA Current Replicas", From: report.FromLatest, Datatype: report.Number, Priority: 12},
+		HPADesiredReplicas: {ID: HPADesiredReplicas, Label: "HPA Desired Replicas", From: report.FromLatest, Datatype: report.Number, Priority: 13},
+		HPATargetMetrics:   {ID: HPATargetMetrics, Label: "HPA Target", From: report.FromLatest, Priority: 14},
+		HPACurrentMetrics:  {ID: HPACurrentMetrics, Label: "HPA Current", From: report.FromLatest, Priority: 15},
+		HPALastScaleTime:   {ID: HPALastScaleTime, Label: "HPA Last Scaled", From: report.FromLatest, Datatype: report.DateTime, Priority: 16},
+		VPAUpdateMode:      {ID: VPAUpdateMode, Label: "VPA Update Mode", From: report.FromLatest, Priority: 17},
+		VPARecommendation:  {ID: VPARecommendation, Label: "VPA Recommendation", From: report.FromLatest, Priority: 18},
+	}
+
+	// SchedulingMetadataTemplates are shown on pods and on the workloads
+	// which declare scheduling constraints.
+	SchedulingMetadataTemplates = report.MetadataTemplates{
+		Affinity:         {ID: Affinity, Label: "Affinity", From: report.FromLatest, Priority: 20},
+		TopologySpread:   {ID: TopologySpread, Label: "Topology Spread", From: report.FromLatest, Priority: 21},
+		PlacementWarning: {ID: PlacementWarning, Label: "Placement Warning", From: report.FromLatest, Priority: 22},
+	}
+
+	AutoscalerMetadataTemplates = report.MetadataTemplates{
+		NodeType:    {ID: NodeType, Label: "Type", From: report.FromLatest, Priority: 1},
+		Namespace:   {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		Created:     {ID: Created, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 3},
+		ScaleTarget: {ID: ScaleTarget, Label: "Target", From: report.FromLatest, Priority: 4},
+	}.Merge(AutoscalingMetadataTemplates)
+
+	NamespaceMetadataTemplates = report.MetadataTemplates{
+		Created:      {ID: Created, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 1},
+		QuotaWarning: {ID: QuotaWarning, Label: "Near Quota", From: report.FromLatest, Priority: 2},
+		LimitRanges:  {ID: LimitRanges, Label: "Limit Ranges", From: report.FromLatest, Priority: 3},
+	}
+
+	NamespaceMetricTemplates = report.MetricTemplates{
+		QuotaCPU:    {ID: QuotaCPU, Label: "CPU Quota", Format: report.DefaultFormat, Priority: 1},
+		QuotaMemory: {ID: QuotaMemory, Label: "Memory Quota", Format: report.FilesizeFormat, Priority: 2},
+	}
+
+	// NodeMetadataTemplates are shown on hosts which are Kubernetes nodes,
+	// after the host's own metadata.
+	NodeMetadataTemplates = report.MetadataTemplates{
+		NodeConditions: {ID: NodeConditions, Label: "Node Conditions", From: report.FromLatest, Priority: 17},
+		NodeCordoned:   {ID: NodeCordoned, Label: "Cordoned", From: report.FromLatest, Priority: 18},
+		NodeTaints:     {ID: NodeTaints, Label: "Taints", From: report.FromLatest, Priority: 19},
+	}
+
 	TableTemplates = report.TableTemplates{
 		LabelPrefix: {
 			ID:     LabelPrefix,
@@ -117,8 +167,43 @@ var (
 			Rank:  1,
 		},
 	}
+
+	NodeControls = []report.Control{
+		{
+			ID:    CordonNode,
+			Human: "Cordon",
+			Icon:  "fa-ban",
+			Rank:  1,
+		},
+		{
+			ID:    UncordonNode,
+			Human: "Uncordon",
+			Icon:  "fa-check-circle",
+			Rank:  1,
+		},
+		{
+			ID:    DrainNode,
+			Human: "Drain",
+			Icon:  "fa-sign-out",
+			Rank:  2,
+		},
+	}
 )
 
+// MetadataSchema describes the metadata keys of Kubernetes objects
+var MetadataSchema = report.MetadataSchema{
+	IP:                 {Type: report.IP},
+	PublicIP:           {Type: report.IP},
+	Created:            {Type: report.DateTime},
+	RestartCount:       {Type: report.Number},
+	ObservedGeneration: {Type: report.Number},
+	DesiredReplicas:    {Type: report.Number},
+}
+
+func init() {
+	report.RegisterMetadataSchema(MetadataSchema)
+}
+
 // Reporter generate Reports containing Container and ContainerImage topologies
 type Reporter struct {
 	client          Client
@@ -226,6 +311,11 @@ func (r *Reporter) Tag(rpt report.Report) (report.Report, error) {
 // Report generates a Report containing Container and ContainerImage topologies
 func (r *Reporter) Report() (report.Report, error) {
 	result := report.MakeReport()
+	if enabled, leader := r.client.LeaderElection(); enabled && !leader {
+		// The leader reports the cluster-wide state. We report the pods on
+		// our node, so they don't vanish while the lease changes hands.
+		return r.localReport()
+	}
 	serviceTopology, services, err := r.serviceTopology()
 	if err != nil {
 		return result, err
@@ -258,6 +348,17 @@ func (r *Reporter) Report() (report.Report, error) {
 	if err != nil {
 		return result, err
 	}
+	autoscalerTopology, autoscaledTopologies, err := r.autoscalerTopology(deployments, statefulSets)
+	if err != nil {
+		return result, err
+	}
+	placementWarnings, err := r.placementWarnings(deployments, statefulSets)
+	if err != nil {
+		return result, err
+	}
+	for _, t := range []*report.Topology{&podTopology, &deploymentTopology, &statefulSetTopology} {
+		*t = withPlacementWarnings(*t, placementWarnings)
+	}
 	result.Pod = result.Pod.Merge(podTopology)
 	result.Service = result.Service.Merge(serviceTopology)
 	result.Host = result.Host.Merge(hostTopology)
@@ -266,6 +367,26 @@ func (r *Reporter) Report() (report.Report, error) {
 	result.CronJob = result.CronJob.Merge(cronJobTopology)
 	result.Deployment = result.Deployment.Merge(deploymentTopology)
 	result.Namespace = result.Namespace.Merge(namespaceTopology)
+	result.Autoscaler = result.Autoscaler.Merge(autoscalerTopology)
+	result.Deployment = result.Deployment.Merge(autoscaledTopologies[report.Deployment])
+	result.StatefulSet = result.StatefulSet.Merge(autoscaledTopologies[report.StatefulSet])
+	return result, nil
+}
+
+// localReport generates a Report of the pods on our node, with their
+// services, and of our host, for when another probe reports the cluster.
+func (r *Reporter) localReport() (report.Report, error) {
+	result := report.MakeReport()
+	_, services, err := r.serviceTopology()
+	if err != nil {
+		return result, err
+	}
+	podTopology, err := r.podTopology(services, nil, nil, nil, nil)
+	if err != nil {
+		return result, err
+	}
+	result.Pod = result.Pod.Merge(podTopology)
+	result.Host = result.Host.Merge(r.hostTopology(services))
 	return result, nil
 }
 
@@ -304,13 +425,24 @@ func (r *Reporter) hostTopology(services []Service) report.Topology {
 			serviceIPs = append(serviceIPs, ip)
 		}
 	}
-	serviceNetwork := report.ContainingIPv4Network(serviceIPs)
-	if serviceNetwork == nil {
-		return report.MakeTopology()
+	result := report.MakeTopology()
+	if serviceNetwork := report.ContainingIPv4Network(serviceIPs); serviceNetwork != nil {
+		result.AddNode(
+			report.MakeNode(report.MakeHostNodeID(r.hostID)).
+				WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet(serviceNetwork.String()))))
+	}
+	if r.nodeName == "" {
+		return result
 	}
-	return report.MakeTopology().AddNode(
-		report.MakeNode(report.MakeHostNodeID(r.hostID)).
-			WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet(serviceNetwork.String()))))
+	r.client.WalkNodes(func(n NodeResource) error {
+		if n.Name() == r.nodeName {
+			result = result.WithMetadataTemplates(NodeMetadataTemplates)
+			result.Controls.AddControls(NodeControls)
+			result.AddNode(n.GetNode(r.hostID))
+		}
+		return nil
+	})
+	return result
 }
 
 func (r *Reporter) deploymentTopology(probeID string) (report.Topology, []Deployment, error) {
@@ -373,6 +505,43 @@ func (r *Reporter) cronJobTopology() (report.Topology, []CronJob, error) {
 	return result, cronJobs, err
 }
 
+// autoscalerTopology returns the autoscaler topology, with edges to the
+// workloads being scaled, plus partial deployment and statefulset
+// topologies carrying the autoscaling metadata of those workloads.
+func (r *Reporter) autoscalerTopology(deployments []Deployment, statefulSets []StatefulSet) (report.Topology, map[string]report.Topology, error) {
+	var (
+		result = report.MakeTopology().
+			WithMetadataTemplates(AutoscalerMetadataTemplates).
+			WithTableTemplates(TableTemplates)
+		autoscaled = map[string]report.Topology{
+			report.Deployment:  report.MakeTopology(),
+			report.StatefulSet: report.MakeTopology(),
+		}
+		// Autoscalers refer to their target by kind and name
+		targets = map[string]string{}
+	)
+	for _, d := range deployments {
+		targets["Deployment/"+d.Namespace()+"/"+d.Name()] = report.MakeDeploymentNodeID(d.UID())
+	}
+	for _, s := range statefulSets {
+		targets["StatefulSet/"+s.Namespace()+"/"+s.Name()] = report.MakeStatefulSetNodeID(s.UID())
+	}
+	err := r.client.WalkAutoscalers(func(a Autoscaler) error {
+		targetID := targets[a.TargetKind()+"/"+a.Namespace()+"/"+a.TargetName()]
+		result = result.AddNode(a.GetNode(targetID))
+		if targetID == "" {
+			return nil
+		}
+		topology := report.Deployment
+		if a.TargetKind() == "StatefulSet" {
+			topology = report.StatefulSet
+		}
+		autoscaled[topology] = autoscaled[topology].AddNode(report.MakeNodeWith(targetID, a.TargetLatests()))
+		return nil
+	})
+	return result, autoscaled, err
+}
+
 type labelledChild interface {
 	Labels() map[string]string
 	AddParent(string, string)
@@ -467,8 +636,12 @@ func (r *Reporter) podTopology(services []Service, deployments []Deployment, dae
 		}
 	}
 
+	// With leader election, the leader reports all the pods, on top of
+	// the ones the other probes report on their nodes.
+	leaderElection, leader := r.client.LeaderElection()
+	allPods := leaderElection && leader
 	var localPodUIDs map[string]struct{}
-	if r.nodeName == "" {
+	if r.nodeName == "" && !allPods {
 		// We don't know the node name: fall back to obtaining the local pods from kubelet
 		var err error
 		localPodUIDs, err = GetLocalPodUIDs(fmt.Sprintf("127.0.0.1:%d", r.kubeletPort))
@@ -478,7 +651,7 @@ func (r *Reporter) podTopology(services []Service, deployments []Deployment, dae
 	}
 	err := r.client.WalkPods(func(p Pod) error {
 		// filter out non-local pods: we only want to report local ones for performance reasons.
-		if r.nodeName != "" {
+		if r.nodeName != "" && !allPods {
 			if p.NodeName() != r.nodeName {
 				return nil
 			}
@@ -496,11 +669,145 @@ func (r *Reporter) podTopology(services []Service, deployments []Deployment, dae
 	return pods, err
 }
 
+// placementWarnings checks where pods actually run against the scheduling
+// constraints declared by them and their workloads. The warnings are keyed
+// by node ID.
+func (r *Reporter) placementWarnings(deployments []Deployment, statefulSets []StatefulSet) (map[string]string, error) {
+	p := placement{nodeLabels: map[string]map[string]string{}}
+	err := r.client.WalkNodes(func(n NodeResource) error {
+		p.nodeLabels[n.Name()] = n.Labels()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.client.WalkPods(func(pod Pod) error {
+		p.pods = append(p.pods, pod)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	for _, pod := range p.pods {
+		if warnings := p.affinityWarnings(pod); len(warnings) > 0 {
+			result[report.MakePodNodeID(pod.UID())] = strings.Join(warnings, "; ")
+		}
+	}
+	for _, d := range deployments {
+		selector, err := d.Selector()
+		if err != nil {
+			return nil, err
+		}
+		if warnings := p.spreadWarnings(d.Namespace(), selector, d.SpreadConstraints()); len(warnings) > 0 {
+			result[report.MakeDeploymentNodeID(d.UID())] = strings.Join(warnings, "; ")
+		}
+	}
+	for _, s := range statefulSets {
+		selector, err := s.Selector()
+		if err != nil {
+			return nil, err
+		}
+		if warnings := p.spreadWarnings(s.Namespace(), selector, s.SpreadConstraints()); len(warnings) > 0 {
+			result[report.MakeStatefulSetNodeID(s.UID())] = strings.Join(warnings, "; ")
+		}
+	}
+	return result, nil
+}
+
+func withPlacementWarnings(t report.Topology, warnings map[string]string) report.Topology {
+	now := mtime.Now()
+	for id, warning := range warnings {
+		if n, ok := t.Nodes[id]; ok {
+			t.Nodes[id] = n.WithLatest(PlacementWarning, now, warning)
+		}
+	}
+	return t
+}
+
 func (r *Reporter) namespaceTopology() (report.Topology, error) {
-	result := report.MakeTopology()
+	result := report.MakeTopology().
+		WithMetadataTemplates(NamespaceMetadataTemplates).
+		WithMetricTemplates(NamespaceMetricTemplates)
+	nodes := map[string]report.Node{} // namespace name -> node
 	err := r.client.WalkNamespaces(func(ns NamespaceResource) error {
-		result = result.AddNode(ns.GetNode())
+		nodes[ns.Name()] = ns.GetNode()
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// When there are several quotas in a namespace, the one closest to
+	// being exhausted is the one that matters.
+	now := mtime.Now()
+	err = r.client.WalkResourceQuotas(func(q ResourceQuota) error {
+		n, ok := nodes[q.Namespace()]
+		if !ok {
+			return nil
+		}
+		for resource, key := range quotaMetrics {
+			used, hard, ok := q.Utilization(resource)
+			if !ok || hard <= 0 {
+				continue
+			}
+			if existing, ok := n.Metrics[key]; ok && existing.Max > 0 {
+				if sample, ok := existing.LastSample(); ok && sample.Value/existing.Max >= used/hard {
+					continue
+				}
+			}
+			n = n.WithMetric(key, report.MakeSingletonMetric(now, used).WithMax(hard))
+		}
+		nodes[q.Namespace()] = n
 		return nil
 	})
-	return result, err
+	if err != nil {
+		return result, err
+	}
+
+	limitRanges := map[string][]string{}
+	err = r.client.WalkLimitRanges(func(l LimitRange) error {
+		if description := l.Describe(); description != "" {
+			limitRanges[l.Namespace()] = append(limitRanges[l.Namespace()], description)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for name, n := range nodes {
+		latests := map[string]string{}
+		if warning := quotaWarning(n); warning != "" {
+			latests[QuotaWarning] = warning
+		}
+		if descriptions, ok := limitRanges[name]; ok {
+			sort.Strings(descriptions)
+			latests[LimitRanges] = strings.Join(descriptions, "; ")
+		}
+		result = result.AddNode(n.WithLatests(latests))
+	}
+	return result, nil
+}
+
+// quotaWarning lists the resources whose usage is above
+// quotaWarningThreshold of their quota, e.g. "cpu: 95%, memory: 91%".
+func quotaWarning(n report.Node) string {
+	warnings := []string{}
+	for resource, key := range quotaMetrics {
+		metric, ok := n.Metrics[key]
+		if !ok || metric.Max <= 0 {
+			continue
+		}
+		sample, ok := metric.LastSample()
+		if !ok {
+			continue
+		}
+		if utilization := sample.Value / metric.Max; utilization >= quotaWarningThreshold {
+			warnings = append(warnings, fmt.Sprintf("%s: %.0f%%", resource, utilization*100))
+		}
+	}
+	sort.Strings(warnings)
+	return strings.Join(warnings, ", ")
 }
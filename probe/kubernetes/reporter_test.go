@@ -7,9 +7,13 @@ import (
 	"strings"
 	"testing"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
+	apiautoscalingv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	apiv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
@@ -111,9 +115,18 @@ func newMockClient() *mockClient {
 }
 
 type mockClient struct {
-	pods     []kubernetes.Pod
-	services []kubernetes.Service
-	logs     map[string]io.ReadCloser
+	pods        []kubernetes.Pod
+	services    []kubernetes.Service
+	deployments []kubernetes.Deployment
+	autoscalers []kubernetes.Autoscaler
+	namespaces  []kubernetes.NamespaceResource
+	quotas      []kubernetes.ResourceQuota
+	limitRanges []kubernetes.LimitRange
+	nodes       []kubernetes.NodeResource
+	logs        map[string]io.ReadCloser
+
+	leaderElection bool
+	leader         bool
 }
 
 func (c *mockClient) Stop() {}
@@ -143,12 +156,57 @@ func (c *mockClient) WalkCronJobs(f func(kubernetes.CronJob) error) error {
 	return nil
 }
 func (c *mockClient) WalkDeployments(f func(kubernetes.Deployment) error) error {
+	for _, deployment := range c.deployments {
+		if err := f(deployment); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (c *mockClient) WalkNamespaces(f func(kubernetes.NamespaceResource) error) error {
+	for _, namespace := range c.namespaces {
+		if err := f(namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkAutoscalers(f func(kubernetes.Autoscaler) error) error {
+	for _, autoscaler := range c.autoscalers {
+		if err := f(autoscaler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkResourceQuotas(f func(kubernetes.ResourceQuota) error) error {
+	for _, quota := range c.quotas {
+		if err := f(quota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkLimitRanges(f func(kubernetes.LimitRange) error) error {
+	for _, limitRange := range c.limitRanges {
+		if err := f(limitRange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkNodes(f func(kubernetes.NodeResource) error) error {
+	for _, node := range c.nodes {
+		if err := f(node); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (*mockClient) WatchPods(func(kubernetes.Event, kubernetes.Pod)) {}
+func (c *mockClient) LeaderElection() (bool, bool) {
+	return c.leaderElection, c.leader || !c.leaderElection
+}
 func (c *mockClient) GetLogs(namespaceID, podName string, _ []string) (io.ReadCloser, error) {
 	r, ok := c.logs[namespaceID+";"+podName]
 	if !ok {
@@ -165,6 +223,12 @@ func (c *mockClient) ScaleUp(resource, namespaceID, id string) error {
 func (c *mockClient) ScaleDown(resource, namespaceID, id string) error {
 	return nil
 }
+func (c *mockClient) CordonNode(name string, unschedulable bool) error {
+	return nil
+}
+func (c *mockClient) DrainNode(name string, progress func(evicted, total int)) error {
+	return nil
+}
 
 type mockPipeClient map[string]xfer.Pipe
 
@@ -248,6 +312,350 @@ func TestReporter(t *testing.T) {
 	}
 }
 
+func TestReporterAutoscalers(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{}, nil
+	}
+
+	var (
+		minReplicas   = int32(2)
+		targetCPU     = int32(80)
+		currentCPU    = int32(45)
+		deploymentUID = "deployment1234"
+		hpaUID        = "hpa1234"
+		vpaUID        = "vpa1234"
+	)
+	deployment := kubernetes.NewDeployment(&apiv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pong",
+			UID:       types.UID(deploymentUID),
+			Namespace: "ping",
+		},
+	})
+	hpa := kubernetes.NewHorizontalPodAutoscaler(&apiautoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pong-hpa",
+			UID:       types.UID(hpaUID),
+			Namespace: "ping",
+		},
+		Spec: apiautoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef:                 apiautoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "pong"},
+			MinReplicas:                    &minReplicas,
+			MaxReplicas:                    10,
+			TargetCPUUtilizationPercentage: &targetCPU,
+		},
+		Status: apiautoscalingv1.HorizontalPodAutoscalerStatus{
+			CurrentReplicas:                 3,
+			DesiredReplicas:                 4,
+			CurrentCPUUtilizationPercentage: &currentCPU,
+		},
+	})
+	vpa, err := kubernetes.NewVerticalPodAutoscaler(&unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "pong-vpa", "namespace": "ping", "uid": vpaUID},
+		"spec": map[string]interface{}{
+			"targetRef":    map[string]interface{}{"kind": "Deployment", "name": "pong"},
+			"updatePolicy": map[string]interface{}{"updateMode": "Off"},
+		},
+		"status": map[string]interface{}{
+			"recommendation": map[string]interface{}{
+				"containerRecommendations": []interface{}{
+					map[string]interface{}{
+						"containerName": "pong",
+						"target":        map[string]interface{}{"memory": "256Mi", "cpu": "250m"},
+					},
+				},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newMockClient()
+	client.deployments = []kubernetes.Deployment{deployment}
+	client.autoscalers = []kubernetes.Autoscaler{hpa, vpa}
+	hr := controls.NewDefaultHandlerRegistry()
+	rpt, _ := kubernetes.NewReporter(client, nil, "", "foo", nil, hr, "", 0).Report()
+
+	deploymentID := report.MakeDeploymentNodeID(deploymentUID)
+	for _, autoscalerID := range []string{report.MakeAutoscalerNodeID(hpaUID), report.MakeAutoscalerNodeID(vpaUID)} {
+		node, ok := rpt.Autoscaler.Nodes[autoscalerID]
+		if !ok {
+			t.Fatalf("Expected report to have autoscaler %q, but not found", autoscalerID)
+		}
+		if !node.Adjacency.Contains(deploymentID) {
+			t.Errorf("Expected autoscaler %s to have an edge to %q, got %v", autoscalerID, deploymentID, node.Adjacency)
+		}
+	}
+
+	node, ok := rpt.Deployment.Nodes[deploymentID]
+	if !ok {
+		t.Fatalf("Expected report to have deployment %q, but not found", deploymentID)
+	}
+	for k, want := range map[string]string{
+		kubernetes.Name:               "pong",
+		kubernetes.HPAMinReplicas:     "2",
+		kubernetes.HPAMaxReplicas:     "10",
+		kubernetes.HPACurrentReplicas: "3",
+		kubernetes.HPADesiredReplicas: "4",
+		kubernetes.HPATargetMetrics:   "cpu: 80%",
+		kubernetes.HPACurrentMetrics:  "cpu: 45%",
+		kubernetes.VPAUpdateMode:      "Off",
+		kubernetes.VPARecommendation:  "pong: cpu=250m, memory=256Mi",
+	} {
+		if have, ok := node.Latest.Lookup(k); !ok || have != want {
+			t.Errorf("Expected deployment %s latest %q: %q, got %q", deploymentID, k, want, have)
+		}
+	}
+}
+
+func TestReporterNamespaceQuotas(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{}, nil
+	}
+
+	namespaceUID := "namespace1234"
+	client := newMockClient()
+	client.namespaces = []kubernetes.NamespaceResource{
+		kubernetes.NewNamespace(&apiv1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "ping", UID: types.UID(namespaceUID)},
+		}),
+	}
+	client.quotas = []kubernetes.ResourceQuota{
+		kubernetes.NewResourceQuota(&apiv1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "ping"},
+			Status: apiv1.ResourceQuotaStatus{
+				Hard: apiv1.ResourceList{
+					apiv1.ResourceRequestsCPU:    resource.MustParse("2"),
+					apiv1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+				},
+				Used: apiv1.ResourceList{
+					apiv1.ResourceRequestsCPU:    resource.MustParse("1900m"),
+					apiv1.ResourceRequestsMemory: resource.MustParse("512Mi"),
+				},
+			},
+		}),
+	}
+	client.limitRanges = []kubernetes.LimitRange{
+		kubernetes.NewLimitRange(&apiv1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "ping"},
+			Spec: apiv1.LimitRangeSpec{
+				Limits: []apiv1.LimitRangeItem{{
+					Type:    apiv1.LimitTypeContainer,
+					Max:     apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")},
+					Default: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("500m")},
+				}},
+			},
+		}),
+	}
+	hr := controls.NewDefaultHandlerRegistry()
+	rpt, _ := kubernetes.NewReporter(client, nil, "", "foo", nil, hr, "", 0).Report()
+
+	node, ok := rpt.Namespace.Nodes[report.MakeNamespaceNodeID(namespaceUID)]
+	if !ok {
+		t.Fatalf("Expected report to have namespace %q, but not found", namespaceUID)
+	}
+	for k, want := range map[string]string{
+		kubernetes.QuotaWarning: "cpu: 95%",
+		kubernetes.LimitRanges:  "Container cpu: max=1, default=500m",
+	} {
+		if have, ok := node.Latest.Lookup(k); !ok || have != want {
+			t.Errorf("Expected namespace latest %q: %q, got %q", k, want, have)
+		}
+	}
+	for k, want := range map[string][2]float64{
+		kubernetes.QuotaCPU:    {1.9, 2},
+		kubernetes.QuotaMemory: {512 * 1024 * 1024, 1024 * 1024 * 1024},
+	} {
+		metric, ok := node.Metrics[k]
+		if !ok {
+			t.Errorf("Expected namespace metric %q, but not found", k)
+			continue
+		}
+		if sample, _ := metric.LastSample(); sample.Value != want[0] || metric.Max != want[1] {
+			t.Errorf("Expected namespace metric %q to be %v of %v, got %v of %v", k, want[0], want[1], sample.Value, metric.Max)
+		}
+	}
+}
+
+func TestReporterNodeConditions(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{}, nil
+	}
+
+	client := newMockClient()
+	client.nodes = []kubernetes.NodeResource{
+		kubernetes.NewNode(&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Spec: apiv1.NodeSpec{
+				Unschedulable: true,
+				Taints:        []apiv1.Taint{{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule}},
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue},
+					{Type: apiv1.NodeMemoryPressure, Status: apiv1.ConditionTrue},
+					{Type: apiv1.NodeDiskPressure, Status: apiv1.ConditionFalse},
+				},
+			},
+		}),
+		kubernetes.NewNode(&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+		}),
+	}
+	hr := controls.NewDefaultHandlerRegistry()
+	rpt, _ := kubernetes.NewReporter(client, nil, "", "foo", nil, hr, "node1", 0).Report()
+
+	node, ok := rpt.Host.Nodes[report.MakeHostNodeID("foo")]
+	if !ok {
+		t.Fatalf("Expected report to have host %q, but not found", "foo")
+	}
+	for k, want := range map[string]string{
+		kubernetes.NodeConditions: "MemoryPressure",
+		kubernetes.NodeCordoned:   "true",
+		kubernetes.NodeTaints:     "dedicated=gpu:NoSchedule",
+	} {
+		if have, ok := node.Latest.Lookup(k); !ok || have != want {
+			t.Errorf("Expected host latest %q: %q, got %q", k, want, have)
+		}
+	}
+	for control, dead := range map[string]bool{
+		kubernetes.CordonNode:   true,
+		kubernetes.UncordonNode: false,
+		kubernetes.DrainNode:    false,
+	} {
+		if have, ok := node.LatestControls.Lookup(control); !ok || have.Dead != dead {
+			t.Errorf("Expected host control %q to have dead=%v, got %v", control, dead, have)
+		}
+	}
+}
+
+func TestReporterPlacementWarnings(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{"web1": {}, "web2": {}, "web3": {}}, nil
+	}
+
+	const zone = "failure-domain.beta.kubernetes.io/zone"
+	const hostname = "kubernetes.io/hostname"
+	webSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	client := newMockClient()
+	client.nodes = []kubernetes.NodeResource{}
+	for name, z := range map[string]string{"node1": "a", "node2": "a", "node3": "b"} {
+		client.nodes = append(client.nodes, kubernetes.NewNode(&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zone: z, hostname: name}},
+		}))
+	}
+	client.pods = []kubernetes.Pod{}
+	for uid, node := range map[string]string{"web1": "node1", "web2": "node1", "web3": "node2"} {
+		spec := apiv1.PodSpec{NodeName: node}
+		if uid == "web1" {
+			spec.Affinity = &apiv1.Affinity{
+				PodAntiAffinity: &apiv1.PodAntiAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []apiv1.PodAffinityTerm{
+						{LabelSelector: webSelector, TopologyKey: hostname},
+					},
+				},
+			}
+		}
+		client.pods = append(client.pods, kubernetes.NewPod(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "ping", UID: types.UID(uid), Labels: map[string]string{"app": "web"}},
+			Spec:       spec,
+		}))
+	}
+	client.deployments = []kubernetes.Deployment{
+		kubernetes.NewDeployment(&apiv1beta1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: "ping",
+				UID:       types.UID("deployment1234"),
+				Annotations: map[string]string{
+					"kubectl.kubernetes.io/last-applied-configuration": `{"spec":{"template":{"spec":{"topologySpreadConstraints":[` +
+						`{"maxSkew":1,"topologyKey":"` + zone + `","whenUnsatisfiable":"ScheduleAnyway","labelSelector":{"matchLabels":{"app":"web"}}}]}}}}`,
+				},
+			},
+			Spec: apiv1beta1.DeploymentSpec{Selector: webSelector},
+		}),
+	}
+	hr := controls.NewDefaultHandlerRegistry()
+	rpt, _ := kubernetes.NewReporter(client, nil, "", "foo", nil, hr, "", 0).Report()
+
+	for id, want := range map[string]map[string]string{
+		report.MakePodNodeID("web1"): {
+			kubernetes.Affinity:         "apart from app=web per " + hostname,
+			kubernetes.PlacementWarning: "shares its " + hostname + " with web2",
+		},
+		report.MakeDeploymentNodeID("deployment1234"): {
+			kubernetes.TopologySpread:   zone + " max skew 1 (ScheduleAnyway)",
+			kubernetes.PlacementWarning: zone + " skew 3 exceeds 1",
+		},
+	} {
+		node, ok := rpt.Pod.Nodes[id]
+		if !ok {
+			node, ok = rpt.Deployment.Nodes[id]
+		}
+		if !ok {
+			t.Errorf("Expected report to have node %q, but not found", id)
+			continue
+		}
+		for k, v := range want {
+			if have, ok := node.Latest.Lookup(k); !ok || have != v {
+				t.Errorf("Expected %s latest %q: %q, got %q", id, k, v, have)
+			}
+		}
+	}
+	if warning, ok := rpt.Pod.Nodes[report.MakePodNodeID("web3")].Latest.Lookup(kubernetes.PlacementWarning); ok {
+		t.Errorf("Expected no placement warning on web3, got %q", warning)
+	}
+}
+
+func TestReporterLeaderElection(t *testing.T) {
+	client := newMockClient()
+	client.leaderElection = true
+	client.nodes = []kubernetes.NodeResource{
+		kubernetes.NewNode(&apiv1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}),
+	}
+	hr := controls.NewDefaultHandlerRegistry()
+
+	// Followers report the pods on their node, but not the cluster-wide state
+	follower := kubernetes.NewReporter(client, nil, "", "foo", nil, hr, nodeName, 0)
+	rpt, _ := follower.Report()
+	for _, uid := range []string{pod1UID, pod2UID} {
+		if _, ok := rpt.Pod.Nodes[report.MakePodNodeID(uid)]; !ok {
+			t.Errorf("Expected follower to report pod %q on its node", uid)
+		}
+	}
+	if len(rpt.Service.Nodes) != 0 {
+		t.Errorf("Expected follower not to report services, got %d", len(rpt.Service.Nodes))
+	}
+	if _, ok := rpt.Host.Nodes[report.MakeHostNodeID("foo")]; !ok {
+		t.Errorf("Expected follower to report its host")
+	}
+	other := kubernetes.NewReporter(client, nil, "", "bar", nil, hr, "node1", 0)
+	if rpt, _ := other.Report(); len(rpt.Pod.Nodes) != 0 {
+		t.Errorf("Expected follower not to report pods on other nodes, got %d", len(rpt.Pod.Nodes))
+	}
+
+	// The leader reports all pods, not just the ones on its node
+	client.leader = true
+	rpt, _ = other.Report()
+	for _, uid := range []string{pod1UID, pod2UID} {
+		if _, ok := rpt.Pod.Nodes[report.MakePodNodeID(uid)]; !ok {
+			t.Errorf("Expected leader to report pod %q", uid)
+		}
+	}
+	if _, ok := rpt.Service.Nodes[report.MakeServiceNodeID(serviceUID)]; !ok {
+		t.Errorf("Expected leader to report service %q", serviceUID)
+	}
+}
+
 func TestTagger(t *testing.T) {
 	rpt := report.MakeReport()
 	rpt.Container.AddNode(report.MakeNodeWith("container1", map[string]string{
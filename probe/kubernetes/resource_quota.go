@@ -0,0 +1,67 @@
+package kubernetes
+
+import (
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	QuotaCPU     = report.KubernetesQuotaCPU
+	QuotaMemory  = report.KubernetesQuotaMemory
+	QuotaWarning = report.KubernetesQuotaWarning
+	LimitRanges  = report.KubernetesLimitRanges
+
+	// Namespaces using more than this fraction of their CPU or memory
+	// quota are flagged.
+	quotaWarningThreshold = 0.9
+)
+
+// quotaMetrics maps the compute resources we track quotas for to the
+// namespace metrics reporting their utilization.
+var quotaMetrics = map[apiv1.ResourceName]string{
+	apiv1.ResourceCPU:    QuotaCPU,
+	apiv1.ResourceMemory: QuotaMemory,
+}
+
+// ResourceQuota represents a Kubernetes resource quota
+type ResourceQuota interface {
+	Meta
+	// Utilization returns the used amount and the hard limit of the given
+	// compute resource (cpu, in cores, or memory, in bytes).
+	Utilization(resource apiv1.ResourceName) (used, hard float64, ok bool)
+}
+
+type resourceQuota struct {
+	*apiv1.ResourceQuota
+	Meta
+}
+
+// NewResourceQuota creates a new ResourceQuota
+func NewResourceQuota(q *apiv1.ResourceQuota) ResourceQuota {
+	return &resourceQuota{ResourceQuota: q, Meta: meta{q.ObjectMeta}}
+}
+
+// quotaResourceNames lists, in order of preference, the quota entries
+// constraining each compute resource. A bare "cpu" or "memory" is the
+// same as a "requests." one.
+var quotaResourceNames = map[apiv1.ResourceName][]apiv1.ResourceName{
+	apiv1.ResourceCPU:    {apiv1.ResourceRequestsCPU, apiv1.ResourceCPU, apiv1.ResourceLimitsCPU},
+	apiv1.ResourceMemory: {apiv1.ResourceRequestsMemory, apiv1.ResourceMemory, apiv1.ResourceLimitsMemory},
+}
+
+func (q *resourceQuota) Utilization(resource apiv1.ResourceName) (float64, float64, bool) {
+	for _, name := range quotaResourceNames[resource] {
+		hard, ok := q.Status.Hard[name]
+		if !ok {
+			continue
+		}
+		used := q.Status.Used[name]
+		if resource == apiv1.ResourceCPU {
+			return float64(used.MilliValue()) / 1000, float64(hard.MilliValue()) / 1000, true
+		}
+		return float64(used.Value()), float64(hard.Value()), true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,232 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Affinity         = report.KubernetesAffinity
+	TopologySpread   = report.KubernetesTopologySpread
+	PlacementWarning = report.KubernetesPlacementWarning
+
+	lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// SpreadConstraint mirrors a topologySpreadConstraint of a pod spec, which
+// the vendored client-go predates.
+type SpreadConstraint struct {
+	MaxSkew           int                   `json:"maxSkew"`
+	TopologyKey       string                `json:"topologyKey"`
+	WhenUnsatisfiable string                `json:"whenUnsatisfiable"`
+	LabelSelector     *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+func (c SpreadConstraint) String() string {
+	return fmt.Sprintf("%s max skew %d (%s)", c.TopologyKey, c.MaxSkew, c.WhenUnsatisfiable)
+}
+
+// spreadConstraints reads the topology spread constraints of a workload's
+// pod template. The typed API drops them, so we look in the configuration
+// last applied by kubectl instead.
+func spreadConstraints(annotations map[string]string) []SpreadConstraint {
+	var applied struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					TopologySpreadConstraints []SpreadConstraint `json:"topologySpreadConstraints"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal([]byte(annotations[lastAppliedConfigAnnotation]), &applied); err != nil {
+		return nil
+	}
+	return applied.Spec.Template.Spec.TopologySpreadConstraints
+}
+
+func describeSpreadConstraints(constraints []SpreadConstraint) string {
+	result := []string{}
+	for _, c := range constraints {
+		result = append(result, c.String())
+	}
+	return strings.Join(result, "; ")
+}
+
+// describeAffinity summarises scheduling affinities, e.g.
+// "node zone In (a, b); apart from app=web per kubernetes.io/hostname".
+func describeAffinity(a *apiv1.Affinity) string {
+	if a == nil {
+		return ""
+	}
+	rules := []string{}
+	if na := a.NodeAffinity; na != nil {
+		if na.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+			for _, term := range na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+				rules = append(rules, "node "+describeNodeSelectorTerm(term))
+			}
+		}
+		for _, term := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+			rules = append(rules, "node "+describeNodeSelectorTerm(term.Preference)+" (preferred)")
+		}
+	}
+	if pa := a.PodAffinity; pa != nil {
+		rules = append(rules, describePodAffinityTerms("with", pa.RequiredDuringSchedulingIgnoredDuringExecution, pa.PreferredDuringSchedulingIgnoredDuringExecution)...)
+	}
+	if paa := a.PodAntiAffinity; paa != nil {
+		rules = append(rules, describePodAffinityTerms("apart from", paa.RequiredDuringSchedulingIgnoredDuringExecution, paa.PreferredDuringSchedulingIgnoredDuringExecution)...)
+	}
+	return strings.Join(rules, "; ")
+}
+
+func describeNodeSelectorTerm(term apiv1.NodeSelectorTerm) string {
+	requirements := []string{}
+	for _, r := range term.MatchExpressions {
+		requirement := r.Key + " " + string(r.Operator)
+		if len(r.Values) > 0 {
+			requirement += " (" + strings.Join(r.Values, ", ") + ")"
+		}
+		requirements = append(requirements, requirement)
+	}
+	return strings.Join(requirements, ", ")
+}
+
+func describePodAffinityTerms(relation string, required []apiv1.PodAffinityTerm, preferred []apiv1.WeightedPodAffinityTerm) []string {
+	rules := []string{}
+	for _, term := range required {
+		rules = append(rules, fmt.Sprintf("%s %s per %s", relation, metav1.FormatLabelSelector(term.LabelSelector), term.TopologyKey))
+	}
+	for _, term := range preferred {
+		rules = append(rules, fmt.Sprintf("%s %s per %s (preferred)", relation, metav1.FormatLabelSelector(term.PodAffinityTerm.LabelSelector), term.PodAffinityTerm.TopologyKey))
+	}
+	return rules
+}
+
+// placement is where pods actually ended up, against which we check the
+// constraints they declare.
+type placement struct {
+	nodeLabels map[string]map[string]string // node name -> labels
+	pods       []Pod
+}
+
+// domain returns the topology domain pod runs in, e.g. its zone.
+func (p placement) domain(pod Pod, topologyKey string) (string, bool) {
+	nodeLabels, ok := p.nodeLabels[pod.NodeName()]
+	if !ok {
+		return "", false
+	}
+	domain, ok := nodeLabels[topologyKey]
+	return domain, ok
+}
+
+// selected returns the other pods selected by term, and which of them
+// share pod's topology domain.
+func (p placement) selected(pod Pod, term apiv1.PodAffinityTerm) (all, colocated []Pod) {
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil {
+		return nil, nil
+	}
+	namespaces := map[string]struct{}{}
+	for _, namespace := range term.Namespaces {
+		namespaces[namespace] = struct{}{}
+	}
+	if len(namespaces) == 0 {
+		namespaces[pod.Namespace()] = struct{}{}
+	}
+	domain, hasDomain := p.domain(pod, term.TopologyKey)
+	for _, other := range p.pods {
+		if other.UID() == pod.UID() || other.NodeName() == "" {
+			continue
+		}
+		if _, ok := namespaces[other.Namespace()]; !ok || !selector.Matches(labels.Set(other.Labels())) {
+			continue
+		}
+		all = append(all, other)
+		if otherDomain, ok := p.domain(other, term.TopologyKey); ok && hasDomain && otherDomain == domain {
+			colocated = append(colocated, other)
+		}
+	}
+	return all, colocated
+}
+
+// affinityWarnings checks the placement of pod against its required pod
+// affinities and anti-affinities. Preferences aren't violations.
+func (p placement) affinityWarnings(pod Pod) []string {
+	a := pod.Affinity()
+	if a == nil || pod.NodeName() == "" {
+		return nil
+	}
+	warnings := []string{}
+	if a.PodAffinity != nil {
+		for _, term := range a.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			// With no matching pods anywhere, the first one is allowed to go
+			// wherever it likes.
+			if all, colocated := p.selected(pod, term); len(all) > 0 && len(colocated) == 0 {
+				warnings = append(warnings, fmt.Sprintf("no %s in its %s", metav1.FormatLabelSelector(term.LabelSelector), term.TopologyKey))
+			}
+		}
+	}
+	if a.PodAntiAffinity != nil {
+		for _, term := range a.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			_, colocated := p.selected(pod, term)
+			for _, other := range colocated {
+				warnings = append(warnings, fmt.Sprintf("shares its %s with %s", term.TopologyKey, other.Name()))
+			}
+		}
+	}
+	return warnings
+}
+
+// spreadWarnings checks the placement of a workload's pods against its
+// topology spread constraints. Every node carrying the topology key counts
+// as a domain, regardless of taints or node affinity.
+func (p placement) spreadWarnings(namespace string, selector labels.Selector, constraints []SpreadConstraint) []string {
+	warnings := []string{}
+	for _, c := range constraints {
+		constraintSelector := selector
+		if c.LabelSelector != nil {
+			var err error
+			if constraintSelector, err = metav1.LabelSelectorAsSelector(c.LabelSelector); err != nil {
+				continue
+			}
+		}
+		counts := map[string]int{}
+		for _, nodeLabels := range p.nodeLabels {
+			if domain, ok := nodeLabels[c.TopologyKey]; ok {
+				counts[domain] = 0
+			}
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		for _, pod := range p.pods {
+			if pod.Namespace() != namespace || !constraintSelector.Matches(labels.Set(pod.Labels())) {
+				continue
+			}
+			if domain, ok := p.domain(pod, c.TopologyKey); ok {
+				counts[domain]++
+			}
+		}
+		min, max := -1, 0
+		for _, count := range counts {
+			if min < 0 || count < min {
+				min = count
+			}
+			if count > max {
+				max = count
+			}
+		}
+		if skew := max - min; skew > c.MaxSkew {
+			warnings = append(warnings, fmt.Sprintf("%s skew %d exceeds %d", c.TopologyKey, skew, c.MaxSkew))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,255 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	SidecarProxy       = report.KubernetesSidecarProxy
+	SidecarRequestRate = "sidecar_request_rate"
+	SidecarErrorRate   = "sidecar_error_rate"
+	SidecarLatency     = "sidecar_latency"
+
+	sidecarScrapeTimeout = 1 * time.Second
+)
+
+// SidecarMetricTemplates describe the metrics scraped from service mesh
+// sidecar proxies.
+var SidecarMetricTemplates = report.MetricTemplates{
+	SidecarRequestRate: {ID: SidecarRequestRate, Label: "Requests/s", Format: report.DefaultFormat, Priority: 3},
+	SidecarErrorRate:   {ID: SidecarErrorRate, Label: "Error Rate", Format: report.PercentFormat, Priority: 4},
+	SidecarLatency:     {ID: SidecarLatency, Label: "Latency (ms)", Format: report.DefaultFormat, Priority: 5},
+}
+
+// sidecarProxy describes where a kind of sidecar proxy exposes its stats,
+// and which metrics to look at.
+type sidecarProxy struct {
+	port      int
+	path      string
+	requests  string // counter of requests
+	responses string // counter of responses, labelled so isError can classify them
+	latency   string // histogram of request latencies, in milliseconds
+	isError   func(labels map[string]string) bool
+}
+
+// sidecarProxies are keyed by the name of the container the service mesh
+// injects into pods.
+var sidecarProxies = map[string]sidecarProxy{
+	"istio-proxy": {
+		port:      15090,
+		path:      "/stats/prometheus",
+		requests:  "istio_requests_total",
+		responses: "istio_requests_total",
+		latency:   "istio_request_duration_milliseconds",
+		isError: func(labels map[string]string) bool {
+			return strings.HasPrefix(labels["response_code"], "5")
+		},
+	},
+	"linkerd-proxy": {
+		port:      4191,
+		path:      "/metrics",
+		requests:  "request_total",
+		responses: "response_total",
+		latency:   "response_latency_ms",
+		isError: func(labels map[string]string) bool {
+			return labels["classification"] == "failure"
+		},
+	},
+}
+
+// IsSidecarProxy returns true if containerName is the name of a service
+// mesh sidecar proxy container.
+func IsSidecarProxy(containerName string) bool {
+	_, ok := sidecarProxies[containerName]
+	return ok
+}
+
+// sidecarCounters are the cumulative totals read from a sidecar at a point
+// in time. Rates are worked out from the difference between two scrapes.
+type sidecarCounters struct {
+	timestamp    time.Time
+	requests     float64
+	errors       float64
+	latencySum   float64
+	latencyCount float64
+}
+
+// SidecarStatsReporter scrapes the stats endpoints of the service mesh
+// sidecars of the pods running on this node, and reports request rate,
+// error rate and latency metrics on those pods.
+type SidecarStatsReporter struct {
+	client   Client
+	nodeName string
+
+	sync.Mutex
+	last map[string]sidecarCounters // pod UID -> counters
+}
+
+// NewSidecarStatsReporter makes a new SidecarStatsReporter. If nodeName is
+// empty, the sidecars of all pods are scraped.
+func NewSidecarStatsReporter(client Client, nodeName string) *SidecarStatsReporter {
+	return &SidecarStatsReporter{
+		client:   client,
+		nodeName: nodeName,
+		last:     map[string]sidecarCounters{},
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*SidecarStatsReporter) Name() string { return "Sidecar" }
+
+// Report implements Reporter.
+func (r *SidecarStatsReporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.Pod = result.Pod.WithMetricTemplates(SidecarMetricTemplates)
+
+	type target struct {
+		uid   string
+		url   string
+		proxy sidecarProxy
+	}
+	targets := []target{}
+	err := r.client.WalkPods(func(p Pod) error {
+		if r.nodeName != "" && p.NodeName() != r.nodeName {
+			return nil
+		}
+		proxy, ok := sidecarProxies[p.SidecarProxy()]
+		if !ok || p.IP() == "" {
+			return nil
+		}
+		targets = append(targets, target{
+			uid:   p.UID(),
+			url:   fmt.Sprintf("http://%s:%d%s", p.IP(), proxy.port, proxy.path),
+			proxy: proxy,
+		})
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		scraped = map[string]sidecarCounters{}
+	)
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			counters, err := r.scrape(t.url, t.proxy)
+			if err != nil {
+				log.Debugf("Sidecar: cannot scrape %s: %v", t.url, err)
+				return
+			}
+			mtx.Lock()
+			scraped[t.uid] = counters
+			mtx.Unlock()
+		}(t)
+	}
+	wg.Wait()
+
+	r.Lock()
+	defer r.Unlock()
+	for uid, current := range scraped {
+		last, ok := r.last[uid]
+		if !ok {
+			continue
+		}
+		if metrics := sidecarMetrics(last, current); len(metrics) > 0 {
+			result.Pod.AddNode(report.MakeNode(report.MakePodNodeID(uid)).WithMetrics(metrics))
+		}
+	}
+	r.last = scraped
+	return result, nil
+}
+
+var sidecarHTTPClient = &http.Client{Timeout: sidecarScrapeTimeout}
+
+// GetSidecarStats fetches the Prometheus stats of a sidecar proxy (it's just exported for testing)
+var GetSidecarStats = func(url string) (io.ReadCloser, error) {
+	resp, err := sidecarHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (r *SidecarStatsReporter) scrape(url string, proxy sidecarProxy) (sidecarCounters, error) {
+	stats, err := GetSidecarStats(url)
+	if err != nil {
+		return sidecarCounters{}, err
+	}
+	defer stats.Close()
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(stats)
+	if err != nil {
+		return sidecarCounters{}, err
+	}
+	return parseSidecarCounters(families, proxy, mtime.Now()), nil
+}
+
+func parseSidecarCounters(families map[string]*dto.MetricFamily, proxy sidecarProxy, now time.Time) sidecarCounters {
+	result := sidecarCounters{timestamp: now}
+	if family, ok := families[proxy.requests]; ok {
+		for _, m := range family.Metric {
+			result.requests += m.GetCounter().GetValue()
+		}
+	}
+	if family, ok := families[proxy.responses]; ok {
+		for _, m := range family.Metric {
+			labels := map[string]string{}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if proxy.isError(labels) {
+				result.errors += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if family, ok := families[proxy.latency]; ok {
+		for _, m := range family.Metric {
+			result.latencySum += m.GetHistogram().GetSampleSum()
+			result.latencyCount += float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+	return result
+}
+
+// sidecarMetrics works out the rates between two scrapes. Counters going
+// backwards mean the proxy was restarted, in which case we skip a beat.
+func sidecarMetrics(last, current sidecarCounters) report.Metrics {
+	elapsed := current.timestamp.Sub(last.timestamp).Seconds()
+	requests := current.requests - last.requests
+	if elapsed <= 0 || requests < 0 || current.errors < last.errors || current.latencyCount < last.latencyCount {
+		return nil
+	}
+	metrics := report.Metrics{
+		SidecarRequestRate: report.MakeSingletonMetric(current.timestamp, requests/elapsed),
+	}
+	if requests > 0 {
+		errorRate := 100 * (current.errors - last.errors) / requests
+		metrics[SidecarErrorRate] = report.MakeSingletonMetric(current.timestamp, errorRate).WithMax(100)
+	}
+	if count := current.latencyCount - last.latencyCount; count > 0 {
+		metrics[SidecarLatency] = report.MakeSingletonMetric(current.timestamp, (current.latencySum-last.latencySum)/count)
+	}
+	return metrics
+}
@@ -0,0 +1,94 @@
+package kubernetes_test
+
+import (
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+func istioStats(requests, errors, latencySum, latencyCount int) string {
+	return strings.Join([]string{
+		"# TYPE istio_requests_total counter",
+		`istio_requests_total{response_code="200"} ` + strconv.Itoa(requests-errors),
+		`istio_requests_total{response_code="503"} ` + strconv.Itoa(errors),
+		"# TYPE istio_request_duration_milliseconds histogram",
+		`istio_request_duration_milliseconds_bucket{le="+Inf"} ` + strconv.Itoa(latencyCount),
+		"istio_request_duration_milliseconds_sum " + strconv.Itoa(latencySum),
+		"istio_request_duration_milliseconds_count " + strconv.Itoa(latencyCount),
+		"",
+	}, "\n")
+}
+
+func TestSidecarStatsReporter(t *testing.T) {
+	podUID := "meshed1234"
+	client := newMockClient()
+	client.pods = []kubernetes.Pod{
+		kubernetes.NewPod(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "meshed", Namespace: "ping", UID: types.UID(podUID)},
+			Spec: apiv1.PodSpec{
+				NodeName:   nodeName,
+				Containers: []apiv1.Container{{Name: "app"}, {Name: "istio-proxy"}},
+			},
+			Status: apiv1.PodStatus{PodIP: "10.0.0.5"},
+		}),
+		pod1, // no sidecar
+	}
+
+	oldGetSidecarStats := kubernetes.GetSidecarStats
+	defer func() { kubernetes.GetSidecarStats = oldGetSidecarStats }()
+	defer mtime.NowReset()
+
+	stats := ""
+	scraped := []string{}
+	kubernetes.GetSidecarStats = func(url string) (io.ReadCloser, error) {
+		scraped = append(scraped, url)
+		return ioutil.NopCloser(strings.NewReader(stats)), nil
+	}
+
+	reporter := kubernetes.NewSidecarStatsReporter(client, nodeName)
+	start := time.Now()
+	mtime.NowForce(start)
+	stats = istioStats(100, 0, 1000, 100)
+	if _, err := reporter.Report(); err != nil {
+		t.Fatal(err)
+	}
+	mtime.NowForce(start.Add(10 * time.Second))
+	stats = istioStats(300, 20, 6000, 300)
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"http://10.0.0.5:15090/stats/prometheus", "http://10.0.0.5:15090/stats/prometheus"}; strings.Join(scraped, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected to scrape %v, got %v", want, scraped)
+	}
+	node, ok := rpt.Pod.Nodes[report.MakePodNodeID(podUID)]
+	if !ok {
+		t.Fatalf("Expected report to have pod %q, but not found", podUID)
+	}
+	for key, want := range map[string]float64{
+		kubernetes.SidecarRequestRate: 20,
+		kubernetes.SidecarErrorRate:   10,
+		kubernetes.SidecarLatency:     25,
+	} {
+		metric, ok := node.Metrics[key]
+		if !ok {
+			t.Errorf("Expected metric %q, but not found", key)
+			continue
+		}
+		if sample, _ := metric.LastSample(); sample.Value != want {
+			t.Errorf("Expected metric %q to be %v, got %v", key, want, sample.Value)
+		}
+	}
+}
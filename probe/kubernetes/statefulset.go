@@ -14,6 +14,7 @@ import (
 type StatefulSet interface {
 	Meta
 	Selector() (labels.Selector, error)
+	SpreadConstraints() []SpreadConstraint
 	GetNode() report.Node
 }
 
@@ -38,6 +39,10 @@ func (s *statefulSet) Selector() (labels.Selector, error) {
 	return selector, nil
 }
 
+func (s *statefulSet) SpreadConstraints() []SpreadConstraint {
+	return spreadConstraints(s.Annotations)
+}
+
 func (s *statefulSet) GetNode() report.Node {
 	desiredReplicas := 1
 	if s.Spec.Replicas != nil {
@@ -51,5 +56,11 @@ func (s *statefulSet) GetNode() report.Node {
 	if s.Status.ObservedGeneration != nil {
 		latests[ObservedGeneration] = fmt.Sprint(*s.Status.ObservedGeneration)
 	}
+	if affinity := describeAffinity(s.Spec.Template.Spec.Affinity); affinity != "" {
+		latests[Affinity] = affinity
+	}
+	if spread := describeSpreadConstraints(s.SpreadConstraints()); spread != "" {
+		latests[TopologySpread] = spread
+	}
 	return s.MetaNode(report.MakeStatefulSetNodeID(s.UID())).WithLatests(latests)
 }
@@ -0,0 +1,137 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clientTimeout    = 5 * time.Second
+	defaultNamespace = "default"
+)
+
+// Client queries the HTTP API of the local Nomad agent.
+type Client interface {
+	// Allocations returns the allocations placed on the agent's node.
+	Allocations() ([]Allocation, error)
+}
+
+// Allocation mirrors the fields of a Nomad allocation we use.
+type Allocation struct {
+	ID            string
+	Name          string
+	Namespace     string
+	NodeName      string
+	JobID         string
+	TaskGroup     string
+	ClientStatus  string
+	DesiredStatus string
+	CreateTime    int64 // nanoseconds since the epoch
+	Job           *Job
+}
+
+// Job mirrors the fields of a Nomad job we use.
+type Job struct {
+	ID          string
+	Name        string
+	Namespace   string
+	Type        string
+	Status      string
+	Datacenters []string
+	TaskGroups  []TaskGroup
+}
+
+// TaskGroup mirrors the fields of a Nomad task group we use.
+type TaskGroup struct {
+	Name  string
+	Count int
+}
+
+// Terminal reports whether the allocation has stopped for good.
+func (a Allocation) Terminal() bool {
+	switch a.ClientStatus {
+	case "complete", "failed", "lost":
+		return true
+	}
+	return false
+}
+
+// namespace returns the namespace of the allocation; Nomad versions
+// without namespaces put everything in the default one.
+func (a Allocation) namespace() string {
+	if a.Namespace == "" {
+		return defaultNamespace
+	}
+	return a.Namespace
+}
+
+type client struct {
+	addr       string
+	httpClient *http.Client
+
+	sync.Mutex
+	nodeID string
+}
+
+// NewClient returns a Client for the Nomad agent at addr, e.g.
+// http://localhost:4646.
+func NewClient(addr string) Client {
+	return &client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		httpClient: &http.Client{Timeout: clientTimeout},
+	}
+}
+
+func (c *client) get(path string, v interface{}) error {
+	resp, err := c.httpClient.Get(c.addr + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nomad: GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// localNodeID returns the ID of the client node of the agent, which doesn't
+// change while the agent is running.
+func (c *client) localNodeID() (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.nodeID != "" {
+		return c.nodeID, nil
+	}
+	var self struct {
+		Stats struct {
+			Client struct {
+				NodeID string `json:"node_id"`
+			} `json:"client"`
+		} `json:"stats"`
+	}
+	if err := c.get("/v1/agent/self", &self); err != nil {
+		return "", err
+	}
+	if self.Stats.Client.NodeID == "" {
+		return "", fmt.Errorf("nomad: agent at %s is not running as a client", c.addr)
+	}
+	c.nodeID = self.Stats.Client.NodeID
+	return c.nodeID, nil
+}
+
+func (c *client) Allocations() ([]Allocation, error) {
+	nodeID, err := c.localNodeID()
+	if err != nil {
+		return nil, err
+	}
+	var allocations []Allocation
+	if err := c.get("/v1/node/"+url.PathEscape(nodeID)+"/allocations", &allocations); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
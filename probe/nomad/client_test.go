@@ -0,0 +1,38 @@
+package nomad_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/nomad"
+)
+
+func TestClientAllocations(t *testing.T) {
+	selfRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/agent/self", func(w http.ResponseWriter, r *http.Request) {
+		selfRequests++
+		w.Write([]byte(`{"stats": {"client": {"node_id": "node-1"}}}`))
+	})
+	mux.HandleFunc("/v1/node/node-1/allocations", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"ID": "alloc-1", "Name": "web.frontend[0]", "JobID": "web", "TaskGroup": "frontend",
+			"ClientStatus": "running", "Job": {"ID": "web", "Type": "service", "TaskGroups": [{"Name": "frontend", "Count": 2}]}}]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := nomad.NewClient(server.URL + "/")
+	for i := 0; i < 2; i++ {
+		allocations, err := client.Allocations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(allocations) != 1 || allocations[0].ID != "alloc-1" || allocations[0].Job == nil || allocations[0].Job.TaskGroups[0].Count != 2 {
+			t.Errorf("Unexpected allocations: %+v", allocations)
+		}
+	}
+	if selfRequests != 1 {
+		t.Errorf("Expected the node ID to be looked up once, got %d lookups", selfRequests)
+	}
+}
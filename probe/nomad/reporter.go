@@ -0,0 +1,177 @@
+package nomad
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Namespace      = report.NomadNamespace
+	JobID          = report.NomadJobID
+	JobType        = report.NomadJobType
+	JobStatus      = report.NomadJobStatus
+	Datacenters    = report.NomadDatacenters
+	TaskGroupName  = report.NomadTaskGroupName
+	TaskGroupCount = report.NomadTaskGroupCount
+	AllocationName = report.NomadAllocationName
+	ClientStatus   = report.NomadClientStatus
+	DesiredStatus  = report.NomadDesiredStatus
+	NodeName       = report.NomadNodeName
+	CreatedAt      = report.NomadCreatedAt
+
+	// AllocIDLabel is the docker label the Nomad docker driver puts on the
+	// containers of an allocation.
+	AllocIDLabel = "com.hashicorp.nomad.alloc_id"
+)
+
+var (
+	jobMetadata = report.MetadataTemplates{
+		JobID:       {ID: JobID, Label: "Job", From: report.FromLatest, Priority: 0},
+		Namespace:   {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 1},
+		JobType:     {ID: JobType, Label: "Type", From: report.FromLatest, Priority: 2},
+		JobStatus:   {ID: JobStatus, Label: "Status", From: report.FromLatest, Priority: 3},
+		Datacenters: {ID: Datacenters, Label: "Datacenters", From: report.FromLatest, Priority: 4},
+	}
+	taskGroupMetadata = report.MetadataTemplates{
+		TaskGroupName:  {ID: TaskGroupName, Label: "Task Group", From: report.FromLatest, Priority: 0},
+		JobID:          {ID: JobID, Label: "Job", From: report.FromLatest, Priority: 1},
+		Namespace:      {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		TaskGroupCount: {ID: TaskGroupCount, Label: "Desired Allocations", From: report.FromLatest, Priority: 3, Datatype: report.Number},
+	}
+	allocationMetadata = report.MetadataTemplates{
+		AllocationName: {ID: AllocationName, Label: "Name", From: report.FromLatest, Priority: 0},
+		Namespace:      {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 1},
+		ClientStatus:   {ID: ClientStatus, Label: "Status", From: report.FromLatest, Priority: 2},
+		DesiredStatus:  {ID: DesiredStatus, Label: "Desired Status", From: report.FromLatest, Priority: 3},
+		NodeName:       {ID: NodeName, Label: "Node", From: report.FromLatest, Priority: 4},
+		CreatedAt:      {ID: CreatedAt, Label: "Created At", From: report.FromLatest, Priority: 5, Datatype: report.DateTime},
+	}
+)
+
+// Reporter implements Tagger, Reporter
+type Reporter struct {
+	client Client
+}
+
+// NewReporter makes a new Reporter
+func NewReporter(client Client) Reporter {
+	return Reporter{client: client}
+}
+
+// Name needed for Tagger, Reporter
+func (Reporter) Name() string {
+	return "Nomad"
+}
+
+// Report needed for Reporter
+func (Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+	result.NomadJob = result.NomadJob.Merge(report.MakeTopology().WithMetadataTemplates(jobMetadata))
+	result.NomadTaskGroup = result.NomadTaskGroup.Merge(report.MakeTopology().WithMetadataTemplates(taskGroupMetadata))
+	result.NomadAllocation = result.NomadAllocation.Merge(report.MakeTopology().WithMetadataTemplates(allocationMetadata))
+	return result, nil
+}
+
+// Tag needed for Tagger. It adds the allocations running on this node, with
+// their task groups and jobs, and makes them the parents of their
+// containers.
+func (r Reporter) Tag(rpt report.Report) (report.Report, error) {
+	allocations, err := r.client.Allocations()
+	if err != nil {
+		log.Errorf("Nomad: cannot list allocations: %v", err)
+		return rpt, nil
+	}
+
+	rpt = rpt.Copy()
+	allocationContainers := containersByAllocation(rpt, allocations)
+	for _, a := range allocations {
+		if a.Terminal() {
+			continue
+		}
+		namespace := a.namespace()
+		jobID := report.MakeNomadJobNodeID(namespace, a.JobID)
+		taskGroupID := report.MakeNomadTaskGroupNodeID(namespace, a.JobID, a.TaskGroup)
+		allocationID := report.MakeNomadAllocationNodeID(a.ID)
+
+		job := report.MakeNodeWith(jobID, map[string]string{
+			JobID:     a.JobID,
+			Namespace: namespace,
+		})
+		taskGroup := report.MakeNodeWith(taskGroupID, map[string]string{
+			TaskGroupName: a.TaskGroup,
+			JobID:         a.JobID,
+			Namespace:     namespace,
+		}).WithParents(report.MakeSets().Add(report.NomadJob, report.MakeStringSet(jobID)))
+		if a.Job != nil {
+			job = job.WithLatests(map[string]string{
+				JobType:     a.Job.Type,
+				JobStatus:   a.Job.Status,
+				Datacenters: strings.Join(a.Job.Datacenters, ", "),
+			})
+			for _, tg := range a.Job.TaskGroups {
+				if tg.Name == a.TaskGroup {
+					taskGroup = taskGroup.WithLatests(map[string]string{TaskGroupCount: strconv.Itoa(tg.Count)})
+				}
+			}
+		}
+		rpt.NomadJob = rpt.NomadJob.AddNode(job)
+		rpt.NomadTaskGroup = rpt.NomadTaskGroup.AddNode(taskGroup)
+
+		latests := map[string]string{
+			AllocationName: a.Name,
+			Namespace:      namespace,
+			JobID:          a.JobID,
+			TaskGroupName:  a.TaskGroup,
+			ClientStatus:   a.ClientStatus,
+			DesiredStatus:  a.DesiredStatus,
+			NodeName:       a.NodeName,
+		}
+		if a.CreateTime != 0 {
+			latests[CreatedAt] = time.Unix(0, a.CreateTime).Format(time.RFC3339Nano)
+		}
+		parents := report.MakeSets().
+			Add(report.NomadTaskGroup, report.MakeStringSet(taskGroupID)).
+			Add(report.NomadJob, report.MakeStringSet(jobID))
+		rpt.NomadAllocation = rpt.NomadAllocation.AddNode(report.MakeNodeWith(allocationID, latests).WithParents(parents))
+
+		containerParents := parents.Add(report.NomadAllocation, report.MakeStringSet(allocationID))
+		for _, containerID := range allocationContainers[a.ID] {
+			rpt.Container.Nodes[containerID] = rpt.Container.Nodes[containerID].WithParents(containerParents)
+		}
+	}
+	return rpt, nil
+}
+
+// containersByAllocation finds the containers of each allocation, from the
+// label the docker driver puts on them or, failing that, from their name,
+// which the docker driver makes "<task>-<allocation ID>".
+func containersByAllocation(rpt report.Report, allocations []Allocation) map[string][]string {
+	known := map[string]struct{}{}
+	for _, a := range allocations {
+		known[a.ID] = struct{}{}
+	}
+	result := map[string][]string{}
+	for containerID, n := range rpt.Container.Nodes {
+		if allocID, ok := n.Latest.Lookup(docker.LabelPrefix + AllocIDLabel); ok {
+			if _, ok := known[allocID]; ok {
+				result[allocID] = append(result[allocID], containerID)
+			}
+			continue
+		}
+		name, _ := n.Latest.Lookup(docker.ContainerName)
+		for allocID := range known {
+			if strings.HasSuffix(name, "-"+allocID) {
+				result[allocID] = append(result[allocID], containerID)
+				break
+			}
+		}
+	}
+	return result
+}
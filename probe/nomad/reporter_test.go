@@ -0,0 +1,90 @@
+package nomad_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/nomad"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	testAllocID    = "5fd2b6a6-6e3c-9b4c-a1e7-5a3c8c3f5c2e"
+	testOldAllocID = "0a6f1b2c-3d4e-5f60-7182-93a4b5c6d7e8"
+)
+
+type mockClient struct {
+	allocations []nomad.Allocation
+}
+
+func (c mockClient) Allocations() ([]nomad.Allocation, error) {
+	return c.allocations, nil
+}
+
+func TestReporterTag(t *testing.T) {
+	job := &nomad.Job{
+		ID:          "web",
+		Type:        "service",
+		Status:      "running",
+		Datacenters: []string{"dc1", "dc2"},
+		TaskGroups:  []nomad.TaskGroup{{Name: "frontend", Count: 3}},
+	}
+	r := nomad.NewReporter(mockClient{allocations: []nomad.Allocation{
+		{ID: testAllocID, Name: "web.frontend[0]", JobID: "web", TaskGroup: "frontend", ClientStatus: "running", DesiredStatus: "run", NodeName: "node1", Job: job},
+		{ID: testOldAllocID, Name: "web.frontend[1]", JobID: "web", TaskGroup: "frontend", ClientStatus: "complete", DesiredStatus: "stop", Job: job},
+	}})
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labelled := report.MakeContainerNodeID("labelled")
+	named := report.MakeContainerNodeID("named")
+	other := report.MakeContainerNodeID("other")
+	rpt.Container.AddNode(report.MakeNodeWith(labelled, map[string]string{docker.LabelPrefix + nomad.AllocIDLabel: testAllocID}))
+	rpt.Container.AddNode(report.MakeNodeWith(named, map[string]string{docker.ContainerName: "nginx-" + testAllocID}))
+	rpt.Container.AddNode(report.MakeNodeWith(other, map[string]string{docker.ContainerName: "nginx-" + testOldAllocID}))
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocationID := report.MakeNomadAllocationNodeID(testAllocID)
+	taskGroupID := report.MakeNomadTaskGroupNodeID("default", "web", "frontend")
+	jobID := report.MakeNomadJobNodeID("default", "web")
+	if len(rpt.NomadAllocation.Nodes) != 1 {
+		t.Fatalf("Expected only the running allocation, got %v", rpt.NomadAllocation.Nodes)
+	}
+	allocation := rpt.NomadAllocation.Nodes[allocationID]
+	if status, _ := allocation.Latest.Lookup(nomad.ClientStatus); status != "running" {
+		t.Errorf("Expected allocation to be running, got %q", status)
+	}
+	if parents, _ := allocation.Parents.Lookup(report.NomadTaskGroup); !parents.Contains(taskGroupID) {
+		t.Errorf("Expected allocation to be in task group %s, got %v", taskGroupID, allocation.Parents)
+	}
+
+	taskGroup, ok := rpt.NomadTaskGroup.Nodes[taskGroupID]
+	if !ok {
+		t.Fatalf("Expected task group %s, got %v", taskGroupID, rpt.NomadTaskGroup.Nodes)
+	}
+	if count, _ := taskGroup.Latest.Lookup(nomad.TaskGroupCount); count != "3" {
+		t.Errorf("Expected a desired count of 3, got %q", count)
+	}
+	jobNode, ok := rpt.NomadJob.Nodes[jobID]
+	if !ok {
+		t.Fatalf("Expected job %s, got %v", jobID, rpt.NomadJob.Nodes)
+	}
+	if dcs, _ := jobNode.Latest.Lookup(nomad.Datacenters); dcs != "dc1, dc2" {
+		t.Errorf("Expected datacenters dc1, dc2, got %q", dcs)
+	}
+
+	for _, containerID := range []string{labelled, named} {
+		c := rpt.Container.Nodes[containerID]
+		if parents, _ := c.Parents.Lookup(report.NomadAllocation); !parents.Contains(allocationID) {
+			t.Errorf("Expected container %s to be in allocation %s, got %v", containerID, allocationID, c.Parents)
+		}
+	}
+	if c := rpt.Container.Nodes[other]; c.Parents.Size() != 0 {
+		t.Errorf("Expected container of a terminal allocation to have no parents, got %v", c.Parents)
+	}
+}
@@ -0,0 +1,130 @@
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node
+const (
+	CalicoIPPools       = "calico_ip_pools"
+	CalicoEncapsulation = "calico_encapsulation"
+)
+
+type calico struct {
+	path string
+}
+
+// NewCalico returns a CNI for calico, which runs the calicoctl at path to
+// list the IP pools, and the BGP sessions of the host.
+func NewCalico(path string) CNI {
+	return calico{path: path}
+}
+
+func (calico) Name() string   { return "calico" }
+func (calico) Prefix() string { return report.CalicoOverlayPeerPrefix }
+
+func (c calico) Peer() (CNIPeer, error) {
+	out, err := exec.Command(c.path, "get", "ippools", "-o", "json").Output()
+	if err != nil {
+		return CNIPeer{}, fmt.Errorf("calicoctl: %v", err)
+	}
+	pools, err := parseCalicoIPPools(out)
+	if err != nil {
+		return CNIPeer{}, err
+	}
+
+	peer := CNIPeer{Latests: map[string]string{}}
+	encapsulations := map[string]struct{}{}
+	for _, pool := range pools {
+		if pool.Spec.Disabled {
+			continue
+		}
+		peer.Subnets = append(peer.Subnets, pool.Spec.CIDR)
+		encapsulations[pool.encapsulation()] = struct{}{}
+	}
+	peer.Latests[CalicoIPPools] = strings.Join(peer.Subnets, ", ")
+	if len(encapsulations) == 1 {
+		for encapsulation := range encapsulations {
+			peer.Latests[CalicoEncapsulation] = encapsulation
+		}
+	} else if len(encapsulations) > 1 {
+		peer.Latests[CalicoEncapsulation] = "mixed"
+	}
+
+	// Without BIRD running there are no BGP sessions; the pools still tell
+	// us which addresses belong to pods.
+	if out, err := exec.Command(c.path, "node", "status").Output(); err == nil {
+		peer.Connections = parseCalicoNodeStatus(string(out))
+	}
+	return peer, nil
+}
+
+type calicoIPPool struct {
+	Spec struct {
+		CIDR      string `json:"cidr"`
+		IPIPMode  string `json:"ipipMode"`
+		VXLANMode string `json:"vxlanMode"`
+		Disabled  bool   `json:"disabled"`
+	} `json:"spec"`
+}
+
+func (p calicoIPPool) encapsulation() string {
+	switch {
+	case p.Spec.VXLANMode != "" && p.Spec.VXLANMode != "Never":
+		return "VXLAN"
+	case p.Spec.IPIPMode != "" && p.Spec.IPIPMode != "Never":
+		return "IPIP"
+	}
+	return "none"
+}
+
+// parseCalicoIPPools parses the output of calicoctl get ippools -o json,
+// which is a list of pools.
+func parseCalicoIPPools(out []byte) ([]calicoIPPool, error) {
+	var list struct {
+		Items []calicoIPPool `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("calicoctl: cannot parse IP pools: %v", err)
+	}
+	return list.Items, nil
+}
+
+// parseCalicoNodeStatus parses the BGP peers out of the tables printed by
+// calicoctl node status, e.g.
+//
+//	+--------------+-------------------+-------+----------+-------------+
+//	| PEER ADDRESS |     PEER TYPE     | STATE |  SINCE   |    INFO     |
+//	+--------------+-------------------+-------+----------+-------------+
+//	| 172.17.8.102 | node-to-node mesh | up    | 23:30:04 | Established |
+//	+--------------+-------------------+-------+----------+-------------+
+func parseCalicoNodeStatus(out string) []CNIConnection {
+	var connections []CNIConnection
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		fields := strings.Split(strings.Trim(line, "|"), "|")
+		if len(fields) != 5 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if fields[0] == "PEER ADDRESS" {
+			continue
+		}
+		connections = append(connections, CNIConnection{
+			Address: fields[0],
+			State:   fields[2],
+			Info:    fields[1] + ", " + fields[4],
+		})
+	}
+	return connections
+}
@@ -0,0 +1,120 @@
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node
+const (
+	CiliumEndpointCount  = "cilium_endpoint_count"
+	CiliumEndpointID     = "cilium_endpoint_id"
+	CiliumIdentity       = "cilium_identity"
+	CiliumIdentityLabels = "cilium_identity_labels"
+)
+
+// DefaultCiliumSocket is where the cilium agent serves its API.
+const DefaultCiliumSocket = "/var/run/cilium/cilium.sock"
+
+type cilium struct {
+	client *http.Client
+}
+
+// NewCilium returns a CNI for cilium, which asks the API of the agent on
+// socket for the allocation range of the host and its endpoints.
+func NewCilium(socket string) CNI {
+	return cilium{
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				Dial: func(_, _ string) (net.Conn, error) {
+					return net.Dial("unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (cilium) Name() string   { return "cilium" }
+func (cilium) Prefix() string { return report.CiliumOverlayPeerPrefix }
+
+type ciliumConfig struct {
+	Status struct {
+		Addressing struct {
+			IPv4 ciliumNodeAddressing `json:"ipv4"`
+			IPv6 ciliumNodeAddressing `json:"ipv6"`
+		} `json:"addressing"`
+	} `json:"status"`
+}
+
+type ciliumNodeAddressing struct {
+	Enabled    bool   `json:"enabled"`
+	AllocRange string `json:"alloc-range"`
+}
+
+type ciliumEndpoint struct {
+	ID     int64 `json:"id"`
+	Status struct {
+		Identity struct {
+			ID     int64    `json:"id"`
+			Labels []string `json:"labels"`
+		} `json:"identity"`
+		ExternalIdentifiers struct {
+			ContainerID string `json:"container-id"`
+		} `json:"external-identifiers"`
+	} `json:"status"`
+}
+
+func (c cilium) get(path string, v interface{}) error {
+	resp, err := c.client.Get("http://cilium/v1" + path)
+	if err != nil {
+		return fmt.Errorf("cilium: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cilium: %s: got %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c cilium) Peer() (CNIPeer, error) {
+	var config ciliumConfig
+	if err := c.get("/config", &config); err != nil {
+		return CNIPeer{}, err
+	}
+	var endpoints []ciliumEndpoint
+	if err := c.get("/endpoint", &endpoints); err != nil {
+		return CNIPeer{}, err
+	}
+
+	peer := CNIPeer{
+		Latests: map[string]string{
+			CiliumEndpointCount: strconv.Itoa(len(endpoints)),
+		},
+		Containers: map[string]map[string]string{},
+	}
+	for _, addressing := range []ciliumNodeAddressing{config.Status.Addressing.IPv4, config.Status.Addressing.IPv6} {
+		if addressing.Enabled && addressing.AllocRange != "" {
+			peer.Subnets = append(peer.Subnets, addressing.AllocRange)
+		}
+	}
+	for _, endpoint := range endpoints {
+		containerID := endpoint.Status.ExternalIdentifiers.ContainerID
+		if containerID == "" {
+			continue
+		}
+		peer.Containers[containerID] = map[string]string{
+			CiliumEndpointID:     strconv.FormatInt(endpoint.ID, 10),
+			CiliumIdentity:       strconv.FormatInt(endpoint.Status.Identity.ID, 10),
+			CiliumIdentityLabels: strings.Join(endpoint.Status.Identity.Labels, ", "),
+		}
+	}
+	return peer, nil
+}
@@ -0,0 +1,208 @@
+package overlay
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/common/backoff"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node
+const (
+	CNIPlugin           = "cni_plugin"
+	CNIPeerCount        = "cni_peer_count"
+	CNIPeerState        = "cni_peer_state"
+	CNIPeerInfo         = "cni_peer_info"
+	CNIPeerAddress      = "cni_peer_address"
+	CNIPeersTablePrefix = "cni_peers_table_"
+)
+
+var (
+	cniMetadata = report.MetadataTemplates{
+		CNIPlugin:    {ID: CNIPlugin, Label: "Plugin", From: report.FromLatest, Priority: 1},
+		CNIPeerCount: {ID: CNIPeerCount, Label: "Peers", From: report.FromLatest, Datatype: report.Number, Priority: 2},
+		// calico
+		CalicoIPPools:       {ID: CalicoIPPools, Label: "IP Pools", From: report.FromLatest, Priority: 3},
+		CalicoEncapsulation: {ID: CalicoEncapsulation, Label: "Encapsulation", From: report.FromLatest, Priority: 4},
+		// cilium
+		CiliumEndpointCount: {ID: CiliumEndpointCount, Label: "Endpoints", From: report.FromLatest, Datatype: report.Number, Priority: 3},
+		// flannel
+		FlannelSubnet:  {ID: FlannelSubnet, Label: "Subnet Lease", From: report.FromLatest, Priority: 3},
+		FlannelNetwork: {ID: FlannelNetwork, Label: "Network", From: report.FromLatest, Priority: 4},
+		FlannelMTU:     {ID: FlannelMTU, Label: "MTU", From: report.FromLatest, Datatype: report.Number, Priority: 5},
+		FlannelIPMasq:  {ID: FlannelIPMasq, Label: "IP Masquerade", From: report.FromLatest, Priority: 6},
+	}
+
+	cniContainerMetadata = report.MetadataTemplates{
+		CiliumIdentity:       {ID: CiliumIdentity, Label: "Cilium Identity", From: report.FromLatest, Priority: 19},
+		CiliumIdentityLabels: {ID: CiliumIdentityLabels, Label: "Cilium Labels", From: report.FromLatest, Priority: 20},
+		CiliumEndpointID:     {ID: CiliumEndpointID, Label: "Cilium Endpoint", From: report.FromLatest, Priority: 21},
+	}
+
+	cniTableTemplates = report.TableTemplates{
+		CNIPeersTablePrefix: {
+			ID:     CNIPeersTablePrefix,
+			Label:  "Peers",
+			Type:   report.MulticolumnTableType,
+			Prefix: CNIPeersTablePrefix,
+			Columns: []report.Column{
+				{ID: CNIPeerAddress, Label: "Peer"},
+				{ID: CNIPeerState, Label: "State"},
+				{ID: CNIPeerInfo, Label: "Info"},
+			},
+		},
+	}
+)
+
+// CNI is a container network plugin, which we can ask about its state on
+// this host.
+type CNI interface {
+	// Name of the plugin, e.g. "calico"
+	Name() string
+	// Prefix of the overlay node IDs of its peers
+	Prefix() string
+	// Peer returns the state of the plugin on this host
+	Peer() (CNIPeer, error)
+}
+
+// CNIPeer is the state of a CNI plugin on a host.
+type CNIPeer struct {
+	// Subnets are the CIDRs the plugin gives pods addresses from; those of
+	// this host where the plugin leases subnets to hosts, its pools
+	// otherwise.
+	Subnets []string
+	// Connections are the connections to other peers, for the plugins
+	// which route between hosts themselves, e.g. calico's BGP sessions.
+	Connections []CNIConnection
+	// Latests is plugin-specific metadata for the peer.
+	Latests map[string]string
+	// Containers is plugin-specific metadata for containers, by ID.
+	Containers map[string]map[string]string
+}
+
+// CNIConnection is a connection between two peers of a CNI plugin.
+type CNIConnection struct {
+	Address string
+	State   string
+	Info    string
+}
+
+// CNIReporter is both a Reporter and a Tagger. It reports the peer of a
+// CNI plugin on this host in the Overlay topology, with the subnets its
+// pods get addresses from, so that they map to this host rather than the
+// Internet, and puts what the plugin knows about containers on them.
+type CNIReporter struct {
+	cni    CNI
+	hostID string
+
+	mtx       sync.RWMutex
+	peerCache CNIPeer
+
+	backoff backoff.Interface
+}
+
+// NewCNIReporter returns a new CNIReporter for cni.
+func NewCNIReporter(hostID string, cni CNI) *CNIReporter {
+	r := &CNIReporter{
+		cni:    cni,
+		hostID: hostID,
+	}
+	r.backoff = backoff.New(r.peer, fmt.Sprintf("collecting %s status", cni.Name()))
+	r.backoff.SetInitialBackoff(10 * time.Second)
+	go r.backoff.Start()
+	return r
+}
+
+// Name of this reporter/tagger, for metrics gathering
+func (r *CNIReporter) Name() string { return "CNI (" + r.cni.Name() + ")" }
+
+// Stop gathering the state of the plugin.
+func (r *CNIReporter) Stop() {
+	r.backoff.Stop()
+}
+
+func (r *CNIReporter) peer() (bool, error) {
+	peer, err := r.cni.Peer()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if err != nil {
+		r.peerCache = CNIPeer{}
+	} else {
+		r.peerCache = peer
+	}
+	return false, err
+}
+
+// Tag implements Tagger.
+func (r *CNIReporter) Tag(rpt report.Report) (report.Report, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if len(r.peerCache.Containers) == 0 {
+		return rpt, nil
+	}
+	for id, node := range rpt.Container.Nodes {
+		containerID, ok := node.Latest.Lookup(docker.ContainerID)
+		if !ok {
+			continue
+		}
+		if latests, ok := r.peerCache.Containers[containerID]; ok {
+			rpt.Container.Nodes[id] = node.WithLatests(latests)
+		}
+	}
+	return rpt, nil
+}
+
+// Report implements Reporter.
+func (r *CNIReporter) Report() (report.Report, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	rpt := report.MakeReport()
+	rpt.Container = rpt.Container.WithMetadataTemplates(cniContainerMetadata)
+	rpt.Overlay = rpt.Overlay.WithMetadataTemplates(cniMetadata).WithTableTemplates(cniTableTemplates)
+	if len(r.peerCache.Subnets) == 0 {
+		// We haven't heard from the plugin
+		return rpt, nil
+	}
+
+	hostNodeID := report.MakeHostNodeID(r.hostID)
+	latests := map[string]string{
+		CNIPlugin:         r.cni.Name(),
+		report.HostNodeID: hostNodeID,
+	}
+	for k, v := range r.peerCache.Latests {
+		latests[k] = v
+	}
+	node := report.MakeNodeWith(report.MakeOverlayNodeID(r.cni.Prefix(), r.hostID), latests).
+		WithSet(host.LocalNetworks, report.MakeStringSet(r.peerCache.Subnets...)).
+		WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(hostNodeID)))
+	if len(r.peerCache.Connections) > 0 {
+		node = node.
+			WithLatests(map[string]string{CNIPeerCount: fmt.Sprintf("%d", len(r.peerCache.Connections))}).
+			AddPrefixMulticolumnTable(CNIPeersTablePrefix, cniPeerRows(r.peerCache.Connections))
+	}
+	rpt.Overlay.AddNode(node)
+	return rpt, nil
+}
+
+func cniPeerRows(connections []CNIConnection) []report.Row {
+	rows := make([]report.Row, 0, len(connections))
+	for _, conn := range connections {
+		rows = append(rows, report.Row{
+			ID: conn.Address,
+			Entries: map[string]string{
+				CNIPeerAddress: conn.Address,
+				CNIPeerState:   conn.State,
+				CNIPeerInfo:    conn.Info,
+			},
+		})
+	}
+	return rows
+}
@@ -0,0 +1,199 @@
+package overlay_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/overlay"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+// fakeCalicoctl answers like calicoctl would.
+const fakeCalicoctl = `#!/bin/sh
+case "$1" in
+get)
+	echo '{"kind": "IPPoolList", "items": [
+		{"spec": {"cidr": "192.168.0.0/16", "ipipMode": "Always", "vxlanMode": "Never"}},
+		{"spec": {"cidr": "10.10.0.0/16", "ipipMode": "Always", "disabled": true}}
+	]}'
+	;;
+node)
+	cat <<EOF
+Calico process is running.
+
+IPv4 BGP status
++--------------+-------------------+-------+----------+-------------+
+| PEER ADDRESS |     PEER TYPE     | STATE |  SINCE   |    INFO     |
++--------------+-------------------+-------+----------+-------------+
+| 172.17.8.102 | node-to-node mesh | up    | 23:30:04 | Established |
+| 172.17.8.103 | node-to-node mesh | start | 23:30:04 | Connect     |
++--------------+-------------------+-------+----------+-------------+
+
+IPv6 BGP status
+No IPv6 peers found.
+EOF
+	;;
+esac
+`
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cni")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCalico(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "calicoctl")
+	if err := ioutil.WriteFile(path, []byte(fakeCalicoctl), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := overlay.NewCalico(path).Peer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := overlay.CNIPeer{
+		// Disabled pools don't give out addresses any more
+		Subnets: []string{"192.168.0.0/16"},
+		Connections: []overlay.CNIConnection{
+			{Address: "172.17.8.102", State: "up", Info: "node-to-node mesh, Established"},
+			{Address: "172.17.8.103", State: "start", Info: "node-to-node mesh, Connect"},
+		},
+		Latests: map[string]string{
+			overlay.CalicoIPPools:       "192.168.0.0/16",
+			overlay.CalicoEncapsulation: "IPIP",
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
+
+func TestCilium(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "cilium.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/config", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"status": {"addressing": {"ipv4": {"enabled": true, "alloc-range": "10.0.1.0/24"}, "ipv6": {"enabled": false}}}}`))
+	})
+	mux.HandleFunc("/v1/endpoint", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`[
+			{"id": 1234, "status": {"identity": {"id": 5678, "labels": ["k8s:app=frontend", "k8s:io.kubernetes.pod.namespace=default"]}, "external-identifiers": {"container-id": "abcdef"}}},
+			{"id": 1, "status": {"identity": {"id": 1, "labels": ["reserved:host"]}}}
+		]`))
+	})
+	go http.Serve(listener, mux)
+	defer listener.Close()
+
+	have, err := overlay.NewCilium(socket).Peer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := overlay.CNIPeer{
+		Subnets: []string{"10.0.1.0/24"},
+		Latests: map[string]string{overlay.CiliumEndpointCount: "2"},
+		Containers: map[string]map[string]string{
+			"abcdef": {
+				overlay.CiliumEndpointID:     "1234",
+				overlay.CiliumIdentity:       "5678",
+				overlay.CiliumIdentityLabels: "k8s:app=frontend, k8s:io.kubernetes.pod.namespace=default",
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
+
+func TestFlannel(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subnet.env")
+	if err := ioutil.WriteFile(path, []byte("FLANNEL_NETWORK=10.244.0.0/16\nFLANNEL_SUBNET=10.244.1.1/24\nFLANNEL_MTU=1450\nFLANNEL_IPMASQ=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := overlay.NewFlannel(path).Peer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := overlay.CNIPeer{
+		Subnets: []string{"10.244.1.0/24"},
+		Latests: map[string]string{
+			overlay.FlannelSubnet:  "10.244.1.0/24",
+			overlay.FlannelNetwork: "10.244.0.0/16",
+			overlay.FlannelMTU:     "1450",
+			overlay.FlannelIPMasq:  "true",
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
+
+type mockCNI overlay.CNIPeer
+
+func (mockCNI) Name() string                     { return "mock" }
+func (mockCNI) Prefix() string                   { return report.CalicoOverlayPeerPrefix }
+func (m mockCNI) Peer() (overlay.CNIPeer, error) { return overlay.CNIPeer(m), nil }
+
+func TestCNIReporter(t *testing.T) {
+	r := overlay.NewCNIReporter(mockHostID, mockCNI{
+		Subnets:     []string{"192.168.0.0/16"},
+		Connections: []overlay.CNIConnection{{Address: "172.17.8.102", State: "up"}},
+		Containers:  map[string]map[string]string{"abcdef": {overlay.CiliumIdentity: "5678"}},
+	})
+	defer r.Stop()
+
+	nodeID := report.MakeOverlayNodeID(report.CalicoOverlayPeerPrefix, mockHostID)
+	test.Poll(t, 300*time.Millisecond, true, func() interface{} {
+		rpt, _ := r.Report()
+		_, ok := rpt.Overlay.Nodes[nodeID]
+		return ok
+	})
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rpt.Overlay.Nodes[nodeID]
+	if have, ok := node.Latest.Lookup(report.HostNodeID); !ok || have != report.MakeHostNodeID(mockHostID) {
+		t.Errorf("Expected host node ID %q, got %q", report.MakeHostNodeID(mockHostID), have)
+	}
+	if have, ok := node.Sets.Lookup(host.LocalNetworks); !ok || !reflect.DeepEqual(have, report.MakeStringSet("192.168.0.0/16")) {
+		t.Errorf("Expected local networks %v, got %v", []string{"192.168.0.0/16"}, have)
+	}
+	if have, ok := node.Latest.Lookup(overlay.CNIPeerCount); !ok || have != "1" {
+		t.Errorf("Expected 1 peer, got %q", have)
+	}
+
+	// Containers get what the plugin knows about them
+	rpt = report.MakeReport()
+	containerNodeID := report.MakeContainerNodeID("abcdef")
+	rpt.Container.AddNode(report.MakeNodeWith(containerNodeID, map[string]string{docker.ContainerID: "abcdef"}))
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, ok := rpt.Container.Nodes[containerNodeID].Latest.Lookup(overlay.CiliumIdentity); !ok || have != "5678" {
+		t.Errorf("Expected cilium identity %q, got %q", "5678", have)
+	}
+}
@@ -0,0 +1,82 @@
+package overlay
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node
+const (
+	FlannelNetwork = "flannel_network"
+	FlannelSubnet  = "flannel_subnet"
+	FlannelMTU     = "flannel_mtu"
+	FlannelIPMasq  = "flannel_ipmasq"
+)
+
+// DefaultFlannelSubnetFile is where flannel writes the subnet it leased
+// for the host.
+const DefaultFlannelSubnetFile = "/run/flannel/subnet.env"
+
+type flannel struct {
+	subnetFile string
+}
+
+// NewFlannel returns a CNI for flannel, which reads the subnet lease of the
+// host from subnetFile.
+func NewFlannel(subnetFile string) CNI {
+	return flannel{subnetFile: subnetFile}
+}
+
+func (flannel) Name() string   { return "flannel" }
+func (flannel) Prefix() string { return report.FlannelOverlayPeerPrefix }
+
+func (f flannel) Peer() (CNIPeer, error) {
+	buf, err := ioutil.ReadFile(f.subnetFile)
+	if err != nil {
+		return CNIPeer{}, err
+	}
+	env := parseEnvFile(string(buf))
+
+	// The lease is given as the address of the host's bridge in it
+	_, subnet, err := net.ParseCIDR(env["FLANNEL_SUBNET"])
+	if err != nil {
+		return CNIPeer{}, fmt.Errorf("flannel: invalid subnet lease %q", env["FLANNEL_SUBNET"])
+	}
+	latests := map[string]string{
+		FlannelSubnet: subnet.String(),
+	}
+	for key, name := range map[string]string{
+		FlannelNetwork: "FLANNEL_NETWORK",
+		FlannelMTU:     "FLANNEL_MTU",
+		FlannelIPMasq:  "FLANNEL_IPMASQ",
+	} {
+		if value, ok := env[name]; ok {
+			latests[key] = value
+		}
+	}
+	return CNIPeer{
+		Subnets: []string{subnet.String()},
+		Latests: latests,
+	}, nil
+}
+
+// parseEnvFile parses a file of KEY=value lines.
+func parseEnvFile(content string) map[string]string {
+	env := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		env[fields[0]] = strings.Trim(fields[1], `"`)
+	}
+	return env
+}
@@ -46,6 +46,11 @@ const (
 	WeaveConnectionsConnection             = "weave_connection_connection"
 	WeaveConnectionsState                  = "weave_connection_state"
 	WeaveConnectionsInfo                   = "weave_connection_info"
+	WeaveConnectionsMode                   = "weave_connection_mode"
+	WeaveEstablishedCount                  = "weave_established_count"
+	WeaveRetryingCount                     = "weave_retrying_count"
+	WeaveFastDPCount                       = "weave_fastdp_count"
+	WeaveSleeveCount                       = "weave_sleeve_count"
 	WeaveConnectionsTablePrefix            = "weave_connections_table_"
 	WeaveConnectionsMulticolumnTablePrefix = "weave_connections_multicolumn_table_"
 )
@@ -68,6 +73,11 @@ var (
 		WeaveConnectionCount: {ID: WeaveConnectionCount, Label: "Connections", From: report.FromLatest, Priority: 8},
 		WeavePeerCount:       {ID: WeavePeerCount, Label: "Peers", From: report.FromLatest, Priority: 7},
 		WeaveTrustedSubnets:  {ID: WeaveTrustedSubnets, Label: "Trusted Subnets", From: report.FromSets, Priority: 9},
+		// Connection health
+		WeaveEstablishedCount: {ID: WeaveEstablishedCount, Label: "Established", From: report.FromLatest, Datatype: report.Number, Priority: 10},
+		WeaveRetryingCount:    {ID: WeaveRetryingCount, Label: "Retrying", From: report.FromLatest, Datatype: report.Number, Priority: 11},
+		WeaveFastDPCount:      {ID: WeaveFastDPCount, Label: "Fast Datapath", From: report.FromLatest, Datatype: report.Number, Priority: 12},
+		WeaveSleeveCount:      {ID: WeaveSleeveCount, Label: "Sleeve", From: report.FromLatest, Datatype: report.Number, Priority: 13},
 	}
 
 	weaveTableTemplates = report.TableTemplates{
@@ -123,6 +133,10 @@ var (
 					ID:    WeaveConnectionsState,
 					Label: "State",
 				},
+				{
+					ID:    WeaveConnectionsMode,
+					Label: "Mode",
+				},
 				{
 					ID:    WeaveConnectionsInfo,
 					Label: "Info",
@@ -303,11 +317,19 @@ func (w *Weave) getPeerNode(peer weave.Peer) report.Node {
 		latests, node = w.addCurrentPeerInfo(latests, node)
 	}
 
+	degraded := report.MakeStringSet()
 	for _, conn := range peer.Connections {
 		if conn.Outbound {
-			node = node.WithAdjacent(report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, conn.Name))
+			id := report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, conn.Name)
+			node = node.WithAdjacent(id)
+			if !conn.Established {
+				degraded = degraded.Add(id)
+			}
 		}
 	}
+	if len(degraded) > 0 {
+		node = node.WithSet(report.DegradedAdjacency, degraded)
+	}
 
 	return node.WithLatests(latests)
 }
@@ -333,6 +355,25 @@ func (w *Weave) addCurrentPeerInfo(latests map[string]string, node report.Node)
 	latests[WeaveTargetCount] = fmt.Sprintf("%d", len(w.statusCache.Router.Targets))
 	latests[WeaveConnectionCount] = fmt.Sprintf("%d", len(w.statusCache.Router.Connections))
 	latests[WeavePeerCount] = fmt.Sprintf("%d", len(w.statusCache.Router.Peers))
+	var established, retrying, fastdp, sleeve int
+	for _, conn := range w.statusCache.Router.Connections {
+		switch conn.State {
+		case "established":
+			established++
+		case "retrying", "failed", "pending", "connecting":
+			retrying++
+		}
+		switch connectionMode(conn.Attrs, conn.Info) {
+		case "fastdp":
+			fastdp++
+		case "sleeve":
+			sleeve++
+		}
+	}
+	latests[WeaveEstablishedCount] = fmt.Sprintf("%d", established)
+	latests[WeaveRetryingCount] = fmt.Sprintf("%d", retrying)
+	latests[WeaveFastDPCount] = fmt.Sprintf("%d", fastdp)
+	latests[WeaveSleeveCount] = fmt.Sprintf("%d", sleeve)
 	node = node.WithSet(WeaveTrustedSubnets, report.MakeStringSet(w.statusCache.Router.TrustedSubnets...))
 	if w.statusCache.IPAM != nil {
 		latests[WeaveIPAMStatus] = getIPAMStatus(*w.statusCache.IPAM)
@@ -386,6 +427,7 @@ func getConnectionsTable(router weave.Router) []report.Row {
 			Entries: map[string]string{
 				WeaveConnectionsConnection: fmt.Sprintf("%s %s", arrow, conn.Address),
 				WeaveConnectionsState:      conn.State,
+				WeaveConnectionsMode:       connectionMode(conn.Attrs, conn.Info),
 				WeaveConnectionsInfo:       conn.Info,
 			},
 		})
@@ -393,6 +435,21 @@ func getConnectionsTable(router weave.Router) []report.Row {
 	return table
 }
 
+// connectionMode returns whether a connection goes through the fast
+// datapath or the slower sleeve, from its attributes, or from its info
+// for routers which don't report those.
+func connectionMode(attrs map[string]interface{}, info string) string {
+	if name, ok := attrs["name"].(string); ok {
+		return name
+	}
+	for _, field := range strings.Fields(info) {
+		if field == "fastdp" || field == "sleeve" {
+			return field
+		}
+	}
+	return ""
+}
+
 func getIPAMStatus(ipam weave.IPAM) string {
 	allIPAMOwnersUnreachable := func(ipam weave.IPAM) bool {
 		for _, entry := range ipam.Entries {
@@ -112,6 +112,21 @@ func TestOverlayTopology(t *testing.T) {
 		if have, ok := node.Latest.Lookup(overlay.WeavePluginDriver); !ok || have != weave.MockDriverName {
 			t.Errorf("Expected weave proxy address %q, got %q", weave.MockDriverName, have)
 		}
+		// Connection health
+		for key, want := range map[string]string{
+			overlay.WeaveEstablishedCount: "2",
+			overlay.WeaveRetryingCount:    "1",
+			overlay.WeaveFastDPCount:      "1",
+			overlay.WeaveSleeveCount:      "1",
+		} {
+			if have, ok := node.Latest.Lookup(key); !ok || have != want {
+				t.Errorf("Expected %s %q, got %q", key, want, have)
+			}
+		}
+		retryingPeerID := report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, weave.MockRetryingPeerName)
+		if have, ok := node.Sets.Lookup(report.DegradedAdjacency); !ok || !reflect.DeepEqual(have, report.MakeStringSet(retryingPeerID)) {
+			t.Errorf("Expected degraded adjacency %q, got %q", retryingPeerID, have)
+		}
 		// The mock data indicates ranges are owned by unreachable peers
 		if have, ok := node.Latest.Lookup(overlay.WeaveIPAMStatus); !ok || have != "all ranges owned by unreachable peers" {
 			t.Errorf("Expected weave IPAM status %q, got %q", "all ranges owned by unreachable peers", have)
@@ -0,0 +1,245 @@
+package overlay
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/weaveworks/common/backoff"
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node
+const (
+	WireGuardInterface        = "wireguard_interface"
+	WireGuardPublicKey        = "wireguard_public_key"
+	WireGuardListenPort       = "wireguard_listen_port"
+	WireGuardPeerCount        = "wireguard_peer_count"
+	WireGuardPeerEndpoint     = "wireguard_peer_endpoint"
+	WireGuardPeerAllowedIPs   = "wireguard_peer_allowed_ips"
+	WireGuardPeerHandshake    = "wireguard_peer_handshake"
+	WireGuardPeerReceived     = "wireguard_peer_received"
+	WireGuardPeerSent         = "wireguard_peer_sent"
+	WireGuardPeersTablePrefix = "wireguard_peers_table_"
+)
+
+// WireGuardStaleHandshake is how long after its latest handshake a tunnel
+// is considered down. Peers handshake every two minutes while they talk.
+const WireGuardStaleHandshake = 3 * time.Minute
+
+var (
+	wireGuardMetadata = report.MetadataTemplates{
+		WireGuardInterface:  {ID: WireGuardInterface, Label: "Interface", From: report.FromLatest, Priority: 1},
+		WireGuardPublicKey:  {ID: WireGuardPublicKey, Label: "Public Key", From: report.FromLatest, Priority: 2},
+		WireGuardListenPort: {ID: WireGuardListenPort, Label: "Listen Port", From: report.FromLatest, Datatype: report.Number, Priority: 3},
+		WireGuardPeerCount:  {ID: WireGuardPeerCount, Label: "Peers", From: report.FromLatest, Datatype: report.Number, Priority: 4},
+	}
+
+	wireGuardTableTemplates = report.TableTemplates{
+		WireGuardPeersTablePrefix: {
+			ID:     WireGuardPeersTablePrefix,
+			Label:  "Peers",
+			Type:   report.MulticolumnTableType,
+			Prefix: WireGuardPeersTablePrefix,
+			Columns: []report.Column{
+				{ID: WireGuardPeerEndpoint, Label: "Endpoint"},
+				{ID: WireGuardPeerAllowedIPs, Label: "Allowed IPs"},
+				{ID: WireGuardPeerHandshake, Label: "Latest Handshake"},
+				{ID: WireGuardPeerReceived, Label: "Received"},
+				{ID: WireGuardPeerSent, Label: "Sent"},
+			},
+		},
+	}
+)
+
+// WireGuardDevice is a WireGuard interface, with its peers.
+type WireGuardDevice struct {
+	Name       string
+	PublicKey  string
+	ListenPort int
+	Peers      []WireGuardPeer
+}
+
+// WireGuardPeer is a peer of a WireGuard interface, i.e. the other end of
+// a tunnel.
+type WireGuardPeer struct {
+	PublicKey       string
+	Endpoint        string
+	AllowedIPs      []string
+	LatestHandshake time.Time // zero if there never was one
+	ReceiveBytes    int64
+	TransmitBytes   int64
+}
+
+// WireGuardClient lists the WireGuard interfaces of the host.
+type WireGuardClient interface {
+	Devices() ([]WireGuardDevice, error)
+}
+
+type wgTool struct {
+	path string
+}
+
+// NewWireGuardClient returns a WireGuardClient which runs the wg tool at
+// path.
+func NewWireGuardClient(path string) WireGuardClient {
+	return wgTool{path: path}
+}
+
+func (w wgTool) Devices() ([]WireGuardDevice, error) {
+	out, err := exec.Command(w.path, "show", "all", "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("wg: %v", err)
+	}
+	return parseWireGuardDump(string(out))
+}
+
+// parseWireGuardDump parses the output of wg show all dump: a line per
+// interface, with its private key, public key, listen port and fwmark, each
+// followed by a line per peer, with its public key, preshared key,
+// endpoint, allowed IPs, latest handshake, bytes received and sent, and
+// keepalive interval.
+func parseWireGuardDump(out string) ([]WireGuardDevice, error) {
+	var devices []WireGuardDevice
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		switch len(fields) {
+		case 5:
+			port, _ := strconv.Atoi(fields[3])
+			// The private key, in fields[1], stays where it is
+			devices = append(devices, WireGuardDevice{
+				Name:       fields[0],
+				PublicKey:  fields[2],
+				ListenPort: port,
+			})
+		case 9:
+			if len(devices) == 0 || devices[len(devices)-1].Name != fields[0] {
+				return nil, fmt.Errorf("wg: peer of unknown interface %q", fields[0])
+			}
+			peer := WireGuardPeer{PublicKey: fields[1]}
+			if fields[3] != "(none)" {
+				peer.Endpoint = fields[3]
+			}
+			if fields[4] != "(none)" {
+				peer.AllowedIPs = strings.Split(fields[4], ",")
+			}
+			if handshake, err := strconv.ParseInt(fields[5], 10, 64); err == nil && handshake > 0 {
+				peer.LatestHandshake = time.Unix(handshake, 0)
+			}
+			peer.ReceiveBytes, _ = strconv.ParseInt(fields[6], 10, 64)
+			peer.TransmitBytes, _ = strconv.ParseInt(fields[7], 10, 64)
+			device := &devices[len(devices)-1]
+			device.Peers = append(device.Peers, peer)
+		default:
+			return nil, fmt.Errorf("wg: unexpected line %q", line)
+		}
+	}
+	return devices, nil
+}
+
+// WireGuard is a Reporter which reports the WireGuard interfaces of the host
+// in the Overlay topology, adjacent to the interfaces of their peers, so that
+// the tunnels show up as edges between hosts. Tunnels which haven't had a
+// handshake for a while are marked as degraded.
+type WireGuard struct {
+	client WireGuardClient
+	hostID string
+
+	mtx          sync.RWMutex
+	devicesCache []WireGuardDevice
+
+	backoff backoff.Interface
+}
+
+// NewWireGuard returns a new WireGuard reporter.
+func NewWireGuard(hostID string, client WireGuardClient) *WireGuard {
+	w := &WireGuard{
+		client: client,
+		hostID: hostID,
+	}
+	w.backoff = backoff.New(w.devices, "collecting wireguard interfaces")
+	w.backoff.SetInitialBackoff(10 * time.Second)
+	go w.backoff.Start()
+	return w
+}
+
+// Name of this reporter, for metrics gathering
+func (*WireGuard) Name() string { return "WireGuard" }
+
+// Stop gathering the state of the interfaces.
+func (w *WireGuard) Stop() {
+	w.backoff.Stop()
+}
+
+func (w *WireGuard) devices() (bool, error) {
+	devices, err := w.client.Devices()
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err != nil {
+		w.devicesCache = nil
+	} else {
+		w.devicesCache = devices
+	}
+	return false, err
+}
+
+// Report implements Reporter.
+func (w *WireGuard) Report() (report.Report, error) {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+
+	rpt := report.MakeReport()
+	rpt.Overlay = rpt.Overlay.WithMetadataTemplates(wireGuardMetadata).WithTableTemplates(wireGuardTableTemplates)
+
+	now := mtime.Now()
+	hostNodeID := report.MakeHostNodeID(w.hostID)
+	for _, device := range w.devicesCache {
+		node := report.MakeNodeWith(report.MakeOverlayNodeID(report.WireGuardOverlayPeerPrefix, device.PublicKey), map[string]string{
+			WireGuardInterface:  device.Name,
+			WireGuardPublicKey:  device.PublicKey,
+			WireGuardListenPort: strconv.Itoa(device.ListenPort),
+			WireGuardPeerCount:  strconv.Itoa(len(device.Peers)),
+			report.HostNodeID:   hostNodeID,
+		}).WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(hostNodeID)))
+
+		degraded := report.MakeStringSet()
+		rows := make([]report.Row, 0, len(device.Peers))
+		for _, peer := range device.Peers {
+			peerID := report.MakeOverlayNodeID(report.WireGuardOverlayPeerPrefix, peer.PublicKey)
+			node = node.WithAdjacent(peerID)
+			handshake := "never"
+			if !peer.LatestHandshake.IsZero() {
+				handshake = humanize.RelTime(peer.LatestHandshake, now, "ago", "from now")
+			}
+			if peer.LatestHandshake.IsZero() || now.Sub(peer.LatestHandshake) > WireGuardStaleHandshake {
+				degraded = degraded.Add(peerID)
+			}
+			rows = append(rows, report.Row{
+				ID: peer.PublicKey,
+				Entries: map[string]string{
+					WireGuardPeerEndpoint:   peer.Endpoint,
+					WireGuardPeerAllowedIPs: strings.Join(peer.AllowedIPs, ", "),
+					WireGuardPeerHandshake:  handshake,
+					WireGuardPeerReceived:   humanize.Bytes(uint64(peer.ReceiveBytes)),
+					WireGuardPeerSent:       humanize.Bytes(uint64(peer.TransmitBytes)),
+				},
+			})
+		}
+		if len(degraded) > 0 {
+			node = node.WithSet(report.DegradedAdjacency, degraded)
+		}
+		rpt.Overlay.AddNode(node.AddPrefixMulticolumnTable(WireGuardPeersTablePrefix, rows))
+	}
+	return rpt, nil
+}
@@ -0,0 +1,101 @@
+package overlay_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/overlay"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+// fakeWG answers like wg show all dump would, with tabs between the fields.
+const fakeWG = "#!/bin/sh\n" +
+	"printf 'wg0\\tcHJpdmF0ZQ==\\tbG9jYWw=\\t51820\\toff\\n'\n" +
+	"printf 'wg0\\tcGVlcjE=\\t(none)\\t203.0.113.1:51820\\t10.8.0.1/32,10.9.0.0/24\\t1500000000\\t1024\\t2048\\t25\\n'\n" +
+	"printf 'wg0\\tcGVlcjI=\\t(none)\\t(none)\\t10.8.0.2/32\\t0\\t0\\t0\\toff\\n'\n"
+
+func TestWireGuardClient(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wg")
+	if err := ioutil.WriteFile(path, []byte(fakeWG), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := overlay.NewWireGuardClient(path).Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []overlay.WireGuardDevice{{
+		Name:       "wg0",
+		PublicKey:  "bG9jYWw=",
+		ListenPort: 51820,
+		Peers: []overlay.WireGuardPeer{
+			{
+				PublicKey:       "cGVlcjE=",
+				Endpoint:        "203.0.113.1:51820",
+				AllowedIPs:      []string{"10.8.0.1/32", "10.9.0.0/24"},
+				LatestHandshake: time.Unix(1500000000, 0),
+				ReceiveBytes:    1024,
+				TransmitBytes:   2048,
+			},
+			{
+				PublicKey:  "cGVlcjI=",
+				AllowedIPs: []string{"10.8.0.2/32"},
+			},
+		},
+	}}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+}
+
+type mockWireGuardClient []overlay.WireGuardDevice
+
+func (m mockWireGuardClient) Devices() ([]overlay.WireGuardDevice, error) { return m, nil }
+
+func TestWireGuardReporter(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	w := overlay.NewWireGuard(mockHostID, mockWireGuardClient{{
+		Name:      "wg0",
+		PublicKey: "local",
+		Peers: []overlay.WireGuardPeer{
+			{PublicKey: "fresh", LatestHandshake: now.Add(-time.Minute)},
+			{PublicKey: "stale", LatestHandshake: now.Add(-time.Hour)},
+			{PublicKey: "never"},
+		},
+	}})
+	defer w.Stop()
+
+	nodeID := report.MakeOverlayNodeID(report.WireGuardOverlayPeerPrefix, "local")
+	test.Poll(t, 300*time.Millisecond, true, func() interface{} {
+		rpt, _ := w.Report()
+		_, ok := rpt.Overlay.Nodes[nodeID]
+		return ok
+	})
+
+	rpt, err := w.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rpt.Overlay.Nodes[nodeID]
+	peerID := func(key string) string { return report.MakeOverlayNodeID(report.WireGuardOverlayPeerPrefix, key) }
+	if want := report.MakeIDList(peerID("fresh"), peerID("stale"), peerID("never")); !reflect.DeepEqual(want, node.Adjacency) {
+		t.Errorf("Expected adjacency %v, got %v", want, node.Adjacency)
+	}
+	if have, _ := node.Sets.Lookup(report.DegradedAdjacency); !reflect.DeepEqual(report.MakeStringSet(peerID("stale"), peerID("never")), have) {
+		t.Errorf("Expected stale tunnels to be degraded, got %v", have)
+	}
+	if have, ok := node.Latest.Lookup(overlay.WireGuardPeerCount); !ok || have != "3" {
+		t.Errorf("Expected 3 peers, got %q", have)
+	}
+}
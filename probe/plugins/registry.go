@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,20 +20,30 @@ import (
 	"github.com/ugorji/go/codec"
 	"golang.org/x/net/context"
 	"golang.org/x/net/context/ctxhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 
 	"github.com/weaveworks/common/backoff"
 	"github.com/weaveworks/common/fs"
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/plugins/wasm"
 	"github.com/weaveworks/scope/report"
 )
 
 // Exposed for testing
 var (
 	transport                 = makeUnixRoundTripper
+	newWatcher                = newInotifyWatcher
 	maxResponseBytes    int64 = 50 * 1024 * 1024
-	errResponseTooLarge       = fmt.Errorf("response must be shorter than 50MB")
+	errResponseTooLarge       = malformedError{fmt.Errorf("response must be shorter than 50MB")}
 	validPluginName           = regexp.MustCompile("^[A-Za-z0-9]+([-][A-Za-z0-9]+)*$")
+
+	// Plugins failing this many reports in a row are disabled for a while,
+	// rather than slowing down every report of the probe.
+	maxConsecutiveErrors = 3
+	disableDuration      = 1 * time.Minute
 )
 
 const (
@@ -39,6 +51,89 @@ const (
 	scanningInterval = 5 * time.Second
 )
 
+// Kinds of plugin errors, counted separately
+const (
+	ErrorTimeout     = "timeout"
+	ErrorMalformed   = "malformed"
+	ErrorUnavailable = "unavailable"
+)
+
+// Keys for use in Node
+const (
+	PluginsTablePrefix = "plugins_table_"
+	PluginStatus       = "plugin_status"
+	PluginAPIVersion   = "plugin_api_version"
+	PluginTimeouts     = "plugin_timeouts"
+	PluginMalformed    = "plugin_malformed"
+	PluginUnavailable  = "plugin_unavailable"
+)
+
+// PluginsTableTemplates describes the state of the plugins of a probe, on
+// its host.
+var PluginsTableTemplates = report.TableTemplates{
+	PluginsTablePrefix: {
+		ID:     PluginsTablePrefix,
+		Label:  "Plugins",
+		Type:   report.MulticolumnTableType,
+		Prefix: PluginsTablePrefix,
+		Columns: []report.Column{
+			{ID: PluginStatus, Label: "Status"},
+			{ID: PluginAPIVersion, Label: "API Version"},
+			{ID: PluginTimeouts, Label: "Timeouts", DataType: report.Number},
+			{ID: PluginMalformed, Label: "Malformed", DataType: report.Number},
+			{ID: PluginUnavailable, Label: "Unavailable", DataType: report.Number},
+		},
+	},
+}
+
+// malformedError is an error in what the plugin said, rather than in
+// getting it to say it.
+type malformedError struct {
+	error
+}
+
+func malformedf(format string, args ...interface{}) error {
+	return malformedError{fmt.Errorf(format, args...)}
+}
+
+// statusError is an HTTP response other than 200 OK.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("plugin returned non-200 status code: %s", e.status)
+}
+
+// errorKind tells which counter err goes to.
+func errorKind(err error) string {
+	switch e := err.(type) {
+	case malformedError:
+		return ErrorMalformed
+	case wasm.Trap:
+		if e == wasm.ErrFuelExhausted {
+			return ErrorTimeout
+		}
+		return ErrorMalformed
+	case net.Error:
+		if e.Timeout() {
+			return ErrorTimeout
+		}
+	}
+	if err == context.DeadlineExceeded || grpc.Code(err) == codes.DeadlineExceeded {
+		return ErrorTimeout
+	}
+	return ErrorUnavailable
+}
+
+// watcher tells when entries come and go in the directories added to it.
+type watcher interface {
+	Add(path string) error
+	Events() <-chan struct{}
+	Close() error
+}
+
 // ReportPublisher is an interface for publishing reports immediately
 type ReportPublisher interface {
 	Publish(rpt report.Report)
@@ -46,6 +141,7 @@ type ReportPublisher interface {
 
 // Registry maintains a list of available plugins by name.
 type Registry struct {
+	hostID            string
 	rootPath          string
 	apiVersion        string
 	handshakeMetadata map[string]string
@@ -57,13 +153,18 @@ type Registry struct {
 	pluginsByID       map[string]*Plugin
 	handlerRegistry   *controls.HandlerRegistry
 	publisher         ReportPublisher
+	watcher           watcher
+	wasmLimits        wasm.Limits
 }
 
 // NewRegistry creates a new registry which watches the given dir root for new
-// plugins, and adds them.
-func NewRegistry(rootPath, apiVersion string, handshakeMetadata map[string]string, handlerRegistry *controls.HandlerRegistry, publisher ReportPublisher) (*Registry, error) {
+// plugins, and adds them. Where inotify is available, plugins are picked up
+// as soon as their sockets appear; elsewhere, on the next periodic scan. WASM
+// plugins found there run within wasmLimits.
+func NewRegistry(hostID, rootPath, apiVersion string, handshakeMetadata map[string]string, wasmLimits wasm.Limits, handlerRegistry *controls.HandlerRegistry, publisher ReportPublisher) (*Registry, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	r := &Registry{
+		hostID:            hostID,
 		rootPath:          rootPath,
 		apiVersion:        apiVersion,
 		handshakeMetadata: handshakeMetadata,
@@ -74,6 +175,12 @@ func NewRegistry(rootPath, apiVersion string, handshakeMetadata map[string]strin
 		pluginsByID:       map[string]*Plugin{},
 		handlerRegistry:   handlerRegistry,
 		publisher:         publisher,
+		wasmLimits:        wasmLimits,
+	}
+	if w, err := newWatcher(); err != nil {
+		log.Infof("plugins: not watching %s, falling back to scanning every %s: %v", rootPath, scanningInterval, err)
+	} else {
+		r.watcher = w
 	}
 	if err := r.scan(); err != nil {
 		r.Close()
@@ -83,19 +190,30 @@ func NewRegistry(rootPath, apiVersion string, handshakeMetadata map[string]strin
 	return r, nil
 }
 
-// loop periodically rescans for plugins
+// loop rescans for plugins whenever the watcher sees a change, and
+// periodically, in case it missed any.
 func (r *Registry) loop() {
 	ticker := time.NewTicker(scanningInterval)
 	defer ticker.Stop()
+	var changes <-chan struct{}
+	if r.watcher != nil {
+		changes = r.watcher.Events()
+	}
 	for {
 		select {
 		case <-r.context.Done():
 			return
+		case _, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			log.Debugf("plugins: rescanning after a change...")
 		case <-ticker.C:
 			log.Debugf("plugins: scanning...")
-			if err := r.scan(); err != nil {
-				log.Warningf("plugins: error: %v", err)
-			}
+		}
+		if err := r.scan(); err != nil {
+			log.Warningf("plugins: error: %v", err)
 		}
 	}
 }
@@ -118,13 +236,7 @@ func (r *Registry) scan() error {
 			pluginsByID[plugin.PluginSpec.ID] = plugin
 			continue
 		}
-		tr, err := transport(path, pluginTimeout)
-		if err != nil {
-			log.Warningf("plugins: error loading plugin %s: %v", path, err)
-			continue
-		}
-		client := &http.Client{Transport: tr, Timeout: pluginTimeout}
-		plugin, err := NewPlugin(r.context, path, client, r.apiVersion, r.handshakeMetadata)
+		plugin, err := r.loadPlugin(path)
 		if err != nil {
 			log.Warningf("plugins: error loading plugin %s: %v", path, err)
 			continue
@@ -147,7 +259,26 @@ func (r *Registry) scan() error {
 	return nil
 }
 
-// sockets recursively finds all unix sockets under the path provided
+// loadPlugin connects to the plugin listening on the socket at path. Plugins
+// speaking the v2 API listen on sockets with the .grpc extension, and WASM
+// plugins are modules with the .wasm extension, loaded in the probe.
+func (r *Registry) loadPlugin(path string) (*Plugin, error) {
+	switch filepath.Ext(path) {
+	case v2SocketExt:
+		return NewPluginV2(r.context, path, r.handshakeMetadata)
+	case wasmExt:
+		return NewWASMPlugin(r.context, path, r.wasmLimits)
+	}
+	tr, err := transport(path, pluginTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: tr, Timeout: pluginTimeout}
+	return NewPlugin(r.context, path, client, r.apiVersion, r.handshakeMetadata)
+}
+
+// sockets recursively finds all unix sockets, and WASM modules, under the
+// path provided
 func (r *Registry) sockets(path string) ([]string, error) {
 	var (
 		result []string
@@ -159,6 +290,11 @@ func (r *Registry) sockets(path string) ([]string, error) {
 	}
 	switch statT.Mode & syscall.S_IFMT {
 	case syscall.S_IFDIR:
+		if r.watcher != nil {
+			if err := r.watcher.Add(path); err != nil {
+				log.Debugf("plugins: cannot watch %s: %v", path, err)
+			}
+		}
 		files, err := fs.ReadDir(path)
 		if err != nil {
 			return nil, err
@@ -173,6 +309,10 @@ func (r *Registry) sockets(path string) ([]string, error) {
 		}
 	case syscall.S_IFSOCK:
 		result = append(result, path)
+	case syscall.S_IFREG:
+		if filepath.Ext(path) == wasmExt {
+			result = append(result, path)
+		}
 	}
 	return result, nil
 }
@@ -213,6 +353,7 @@ func (r *Registry) Name() string { return "plugins" }
 // Report implements the Reporter interface
 func (r *Registry) Report() (report.Report, error) {
 	rpt := report.MakeReport()
+	var rows []report.Row
 	// All plugins are assumed to (and must) implement reporter
 	r.forEach(&r.lock, func(plugin *Plugin) {
 		pluginReport, err := plugin.Report()
@@ -223,6 +364,28 @@ func (r *Registry) Report() (report.Report, error) {
 			r.updateAndRegisterControlsInReport(&pluginReport)
 		}
 		rpt = rpt.Merge(pluginReport)
+		rows = append(rows, plugin.row())
+	})
+	if len(rows) > 0 {
+		rpt.Host = rpt.Host.WithTableTemplates(PluginsTableTemplates)
+		rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID(r.hostID)).AddPrefixMulticolumnTable(PluginsTablePrefix, rows))
+	}
+	return rpt, nil
+}
+
+// Tag implements the Tagger interface, running the WASM plugins over the
+// report.
+func (r *Registry) Tag(rpt report.Report) (report.Report, error) {
+	r.forEach(&r.lock, func(plugin *Plugin) {
+		if plugin.module == nil || plugin.disabled() {
+			return
+		}
+		tagged, err := plugin.tag(rpt)
+		if err != nil {
+			log.Errorf("plugins: %s: tag error: %v", plugin.socket, err)
+			return
+		}
+		rpt = tagged
 	})
 	return rpt, nil
 }
@@ -319,6 +482,9 @@ func realPluginAndControlID(fakeID string) (string, string) {
 // out of date.
 func (r *Registry) Close() {
 	r.cancel()
+	if r.watcher != nil {
+		r.watcher.Close()
+	}
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	r.closePlugins(r.pluginsByID)
@@ -358,6 +524,27 @@ type Plugin struct {
 	client             *http.Client
 	cancel             context.CancelFunc
 	backoff            backoff.Interface
+	apiVersions        []string
+	negotiated         bool
+
+	errors            map[string]int
+	consecutiveErrors int
+	disabledUntil     time.Time
+	lastError         error
+
+	// v2 plugins only
+	conn       *grpc.ClientConn
+	v2Metadata map[string]string
+	unhealthy  string
+	mtx        sync.Mutex
+	handshake  *HandshakeResponse
+	latest     *report.Report
+	streamErr  error
+
+	// WASM plugins only
+	module     *wasm.Module
+	wasmSpec   wasmSpec
+	wasmLimits wasm.Limits
 }
 
 // NewPlugin loads and initializes a new plugin. If client is nil,
@@ -382,14 +569,23 @@ func NewPlugin(ctx context.Context, socket string, client *http.Client, expected
 		handshakeMetadata:  params,
 		client:             client,
 		cancel:             cancel,
+		apiVersions:        []string{expectedAPIVersion},
+		errors:             map[string]int{},
 	}
 	return plugin, nil
 }
 
-// Report gets the latest report from the plugin
+// Report gets the latest report from the plugin. Plugins which keep failing
+// are disabled for a while, during which their reports are empty, as are
+// those of WASM plugins, which only tag.
 func (p *Plugin) Report() (result report.Report, err error) {
 	result = report.MakeReport()
+	if p.module != nil || p.disabled() {
+		result.Plugins = xfer.MakePluginSpecs(p.PluginSpec)
+		return result, nil
+	}
 	defer func() {
+		p.countError(err)
 		p.setStatus(err)
 		result.Plugins = result.Plugins.Add(p.PluginSpec)
 		if err != nil {
@@ -398,32 +594,131 @@ func (p *Plugin) Report() (result report.Report, err error) {
 		}
 	}()
 
+	if p.conn != nil {
+		return p.reportV2()
+	}
+	if !p.negotiated {
+		if err := p.negotiate(); err != nil {
+			return result, err
+		}
+	}
 	if err := p.get("/report", p.handshakeMetadata, &result); err != nil {
 		return result, err
 	}
 	if result.Plugins.Size() != 1 {
-		return result, fmt.Errorf("report must contain exactly one plugin (found %d)", result.Plugins.Size())
+		return result, malformedf("report must contain exactly one plugin (found %d)", result.Plugins.Size())
 	}
 
 	key := result.Plugins.Keys()[0]
 	spec, _ := result.Plugins.Lookup(key)
 	if spec.ID != p.PluginSpec.ID {
-		return result, fmt.Errorf("plugin must not change its id (is %q, should be %q)", spec.ID, p.PluginSpec.ID)
+		return result, malformedf("plugin must not change its id (is %q, should be %q)", spec.ID, p.PluginSpec.ID)
 	}
 	p.PluginSpec = spec
 
 	switch {
 	case spec.APIVersion != p.expectedAPIVersion:
-		err = fmt.Errorf("incorrect API version: expected %q, got %q", p.expectedAPIVersion, spec.APIVersion)
+		err = malformedf("incorrect API version: expected %q, got %q", p.expectedAPIVersion, spec.APIVersion)
 	case spec.Label == "":
-		err = fmt.Errorf("spec must contain a label")
+		err = malformedf("spec must contain a label")
 	case !p.Implements("reporter"):
-		err = fmt.Errorf("spec must implement the \"reporter\" interface")
+		err = malformedf("spec must implement the \"reporter\" interface")
+	default:
+		err = checkPluginTopologies(result)
 	}
 
 	return result, err
 }
 
+// negotiate does the handshake with v1 plugins: the probe offers the API
+// versions it speaks, and the plugin answers with its spec, in the version
+// it picked. Plugins which predate the handshake, and don't answer with a
+// spec, are left to speak the version the probe expects.
+func (p *Plugin) negotiate() error {
+	params := url.Values{}
+	for k, v := range p.handshakeMetadata {
+		params[k] = v
+	}
+	params.Set("api_versions", strings.Join(p.apiVersions, ","))
+
+	var spec xfer.PluginSpec
+	err := p.get("/handshake", params, &spec)
+	if e, ok := err.(statusError); ok && e.code == http.StatusNotFound {
+		p.negotiated = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if spec.ID == "" {
+		// Some answer whatever they are asked with their report
+		p.negotiated = true
+		return nil
+	}
+
+	if spec.ID != p.PluginSpec.ID {
+		return malformedf("plugin must not change its id (is %q, should be %q)", spec.ID, p.PluginSpec.ID)
+	}
+	supported := false
+	for _, version := range p.apiVersions {
+		supported = supported || version == spec.APIVersion
+	}
+	if !supported {
+		return malformedf("unsupported API version: expected one of %q, got %q", p.apiVersions, spec.APIVersion)
+	}
+	p.expectedAPIVersion = spec.APIVersion
+	p.negotiated = true
+	return nil
+}
+
+// countError keeps track of errors by kind, and disables the plugin once
+// too many reports in a row have failed.
+func (p *Plugin) countError(err error) {
+	if err == errNoReportYet {
+		return
+	}
+	if err == nil {
+		p.consecutiveErrors = 0
+		return
+	}
+	p.errors[errorKind(err)]++
+	p.consecutiveErrors++
+	p.lastError = err
+	if p.consecutiveErrors >= maxConsecutiveErrors {
+		log.Warningf("plugins: disabling %s for %s after %d errors in a row: %v", p.socket, disableDuration, p.consecutiveErrors, err)
+		p.disabledUntil = mtime.Now().Add(disableDuration)
+		p.consecutiveErrors = 0
+	}
+}
+
+func (p *Plugin) disabled() bool {
+	return mtime.Now().Before(p.disabledUntil)
+}
+
+// row describes the state of the plugin in the plugins table of the host.
+func (p *Plugin) row() report.Row {
+	return report.Row{
+		ID: p.PluginSpec.ID,
+		Entries: map[string]string{
+			PluginStatus:      p.Status,
+			PluginAPIVersion:  p.PluginSpec.APIVersion,
+			PluginTimeouts:    strconv.Itoa(p.errors[ErrorTimeout]),
+			PluginMalformed:   strconv.Itoa(p.errors[ErrorMalformed]),
+			PluginUnavailable: strconv.Itoa(p.errors[ErrorUnavailable]),
+		},
+	}
+}
+
+// checkPluginTopologies makes sure the topologies a plugin brings along
+// don't take the place of built-in ones.
+func checkPluginTopologies(rpt report.Report) error {
+	for name := range rpt.PluginTopologies {
+		if !rpt.IsPluginTopology(name) {
+			return fmt.Errorf("plugin topology %q must not have the name of a built-in topology", name)
+		}
+	}
+	return nil
+}
+
 // Control sends a control message to a plugin
 func (p *Plugin) Control(request xfer.Request) (res PluginResponse) {
 	var err error
@@ -434,9 +729,14 @@ func (p *Plugin) Control(request xfer.Request) (res PluginResponse) {
 		}
 	}()
 
-	if p.Implements("controller") {
+	switch {
+	case p.disabled():
+		err = fmt.Errorf("the %s plugin is disabled: %v", p.PluginSpec.Label, p.lastError)
+	case p.conn != nil:
+		res, err = p.controlV2(request)
+	case p.Implements("controller"):
 		err = p.post("/control", p.handshakeMetadata, request, &res)
-	} else {
+	default:
 		err = fmt.Errorf("the %s plugin does not implement the controller interface", p.PluginSpec.Label)
 	}
 	return res
@@ -453,10 +753,15 @@ func (p *Plugin) Implements(iface string) bool {
 }
 
 func (p *Plugin) setStatus(err error) {
-	if err == nil {
-		p.Status = "ok"
-	} else {
+	switch {
+	case err != nil && p.disabled():
+		p.Status = fmt.Sprintf("disabled: %v", err)
+	case err != nil:
 		p.Status = fmt.Sprintf("error: %v", err)
+	case p.unhealthy != "":
+		p.Status = fmt.Sprintf("unhealthy: %s", p.unhealthy)
+	default:
+		p.Status = "ok"
 	}
 }
 
@@ -470,7 +775,7 @@ func (p *Plugin) get(path string, params url.Values, result interface{}) error {
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("plugin returned non-200 status code: %s", resp.Status)
+		return statusError{code: resp.StatusCode, status: resp.Status}
 	}
 	return getResult(resp.Body, result)
 }
@@ -489,7 +794,7 @@ func (p *Plugin) post(path string, params url.Values, data interface{}, result i
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("plugin returned non-200 status code: %s", resp.Status)
+		return statusError{code: resp.StatusCode, status: resp.Status}
 	}
 	return getResult(resp.Body, result)
 }
@@ -500,15 +805,19 @@ func getResult(body io.ReadCloser, result interface{}) error {
 		return err
 	}
 	if err != nil {
-		return fmt.Errorf("decoding error: %s", err)
+		return malformedf("decoding error: %s", err)
 	}
 	return nil
 }
 
 // Close closes the client
 func (p *Plugin) Close() {
+	// Cancel first, so a v2 report stream lets the backoff stop
+	p.cancel()
 	if p.backoff != nil {
 		p.backoff.Stop()
 	}
-	p.cancel()
+	if p.conn != nil {
+		p.conn.Close()
+	}
 }
@@ -10,6 +10,8 @@ import (
 	"net/http/httputil"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -19,6 +21,7 @@ import (
 	"github.com/ugorji/go/codec"
 
 	fs_hook "github.com/weaveworks/common/fs"
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/common/test/fs"
 	"github.com/weaveworks/scope/common/xfer"
@@ -30,7 +33,7 @@ import (
 func testRegistry(t *testing.T, apiVersion string) *Registry {
 	handlerRegistry := controls.NewDefaultHandlerRegistry()
 	root := "/plugins"
-	r, err := NewRegistry(root, apiVersion, nil, handlerRegistry, nil)
+	r, err := NewRegistry("", root, apiVersion, nil, DefaultWASMLimits, handlerRegistry, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -781,7 +784,7 @@ func TestRegistryRegistersHandlers(t *testing.T) {
 	testBackend := newTestHandlerRegistryBackend(t)
 	handlerRegistry := controls.NewHandlerRegistry(testBackend)
 	root := "/plugins"
-	r, err := NewRegistry(root, "1", nil, handlerRegistry, nil)
+	r, err := NewRegistry("", root, "1", nil, DefaultWASMLimits, handlerRegistry, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -831,7 +834,7 @@ func TestRegistryHandlersCallPlugins(t *testing.T) {
 
 	handlerRegistry := controls.NewDefaultHandlerRegistry()
 	root := "/plugins"
-	r, err := NewRegistry(root, "1", nil, handlerRegistry, nil)
+	r, err := NewRegistry("", root, "1", nil, DefaultWASMLimits, handlerRegistry, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -845,3 +848,117 @@ func TestRegistryHandlersCallPlugins(t *testing.T) {
 		t.Fatalf("Got unexpected response: %#v", res)
 	}
 }
+
+func TestRegistryNegotiatesAPIVersion(t *testing.T) {
+	var handshake string
+	setup(
+		t,
+		mockPlugin{
+			t:    t,
+			Name: "testPlugin",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/handshake":
+					handshake = r.URL.Query().Get("api_versions")
+					fmt.Fprint(w, mustMarshal(pluginSpec("testPlugin", "reporter")))
+				case "/report":
+					fmt.Fprint(w, mustMarshal(testReport(report.MakeTopology().WithLabel("host", ""), pluginSpec("testPlugin", "reporter"))))
+				default:
+					http.NotFound(w, r)
+				}
+			}),
+		}.file(),
+		mockPlugin{
+			t:    t,
+			Name: "testPluginFromTheFuture",
+			Handler: mapStringHandler(testResponseMap{
+				"/handshake": {http.StatusOK, mustMarshal(xfer.PluginSpec{ID: "testPluginFromTheFuture", Label: "testPluginFromTheFuture", APIVersion: "3"})},
+			}),
+		}.file(),
+	)
+	defer restore(t)
+
+	r := testRegistry(t, "1")
+	defer r.Close()
+
+	r.Report()
+	if handshake != "1" {
+		t.Errorf("Expected to be offered API version %q, got %q", "1", handshake)
+	}
+	r.ForEach(func(p *Plugin) {
+		switch p.ID {
+		case "testPlugin":
+			if p.Status != "ok" {
+				t.Errorf("Expected status ok, got %q", p.Status)
+			}
+		case "testPluginFromTheFuture":
+			if want := `error: unsupported API version: expected one of ["1"], got "3"`; p.Status != want {
+				t.Errorf("Expected status %q, got %q", want, p.Status)
+			}
+		}
+	})
+}
+
+func TestRegistryDisablesFailingPlugins(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	setup(
+		t,
+		mockPlugin{
+			t:    t,
+			Name: "testPlugin",
+			Handler: mapStringHandler(testResponseMap{
+				"/report":  {http.StatusInternalServerError, ""},
+				"/control": {http.StatusOK, mustMarshal(PluginResponse{})},
+			}),
+		}.file(),
+	)
+	defer restore(t)
+
+	r := testRegistry(t, "1")
+	defer r.Close()
+
+	plugin := func() *Plugin {
+		var result *Plugin
+		r.ForEach(func(p *Plugin) { result = p })
+		return result
+	}
+	for i := 0; i < maxConsecutiveErrors; i++ {
+		r.Report()
+	}
+	if status := plugin().Status; !strings.HasPrefix(status, "disabled: ") {
+		t.Errorf("Expected the plugin to be disabled, got %q", status)
+	}
+	if res := plugin().Control(xfer.Request{Control: "ctrl"}); res.Error == "" {
+		t.Errorf("Expected controls of a disabled plugin to fail")
+	}
+
+	// Disabled plugins aren't asked for reports
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := rpt.Host.Nodes[report.MakeHostNodeID("")].ExtractMulticolumnTable(PluginsTableTemplates[PluginsTablePrefix])
+	want := []report.Row{{
+		ID: "testPlugin",
+		Entries: map[string]string{
+			PluginStatus:      plugin().Status,
+			PluginAPIVersion:  "",
+			PluginTimeouts:    "0",
+			PluginMalformed:   "0",
+			PluginUnavailable: strconv.Itoa(maxConsecutiveErrors),
+		},
+	}}
+	if !reflect.DeepEqual(want, row) {
+		t.Errorf("Expected plugins table %v, got %v", want, row)
+	}
+
+	// ... until they have been disabled for long enough
+	mtime.NowForce(now.Add(disableDuration))
+	r.Report()
+	if status := plugin().Status; !strings.HasPrefix(status, "error: ") {
+		t.Errorf("Expected the plugin to be tried again, got %q", status)
+	}
+}
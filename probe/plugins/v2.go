@@ -0,0 +1,471 @@
+package plugins
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/weaveworks/common/backoff"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// The v2 plugin API is a gRPC service, served by plugins on unix sockets
+// with the .grpc extension. Where the probe polls v1 plugins for their
+// reports, v2 plugins stream them, either whole or as increments on the
+// previous one. They declare their controls, and the arguments those take,
+// when the probe connects, and answer health checks with their own status.
+//
+// Messages are JSON, encoded the same way as in v1, so there is no protobuf
+// to generate. Plugins written in Go serve the API with NewServer and
+// RegisterPluginServer; others need a gRPC library which takes a custom
+// codec.
+
+// V2APIVersion is the api_version v2 plugins must report in their spec.
+const V2APIVersion = "2"
+
+// errNoReportYet is not counted against plugins, which may take a while to
+// stream their first report.
+var errNoReportYet = fmt.Errorf("waiting for the first report")
+
+const (
+	v2SocketExt     = ".grpc"
+	v2ServiceName   = "scope.plugins.v2.Plugin"
+	v2StreamBackoff = 1 * time.Second
+)
+
+// Types of control arguments
+const (
+	ArgString   = "string"
+	ArgInt      = "int"
+	ArgFloat    = "float"
+	ArgBool     = "bool"
+	ArgDuration = "duration"
+)
+
+// HandshakeRequest is sent by the probe whenever it connects to a plugin.
+type HandshakeRequest struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// HandshakeResponse describes the plugin, and the controls it offers.
+type HandshakeResponse struct {
+	Spec     xfer.PluginSpec `json:"spec"`
+	Controls []ControlSpec   `json:"controls,omitempty"`
+}
+
+// ControlSpec declares a control, offered on nodes of the named topology.
+type ControlSpec struct {
+	Control  report.Control `json:"control"`
+	Topology string         `json:"topology"`
+	Args     []ControlArg   `json:"args,omitempty"`
+}
+
+// ControlArg is an argument of a control. The probe checks requests against
+// it before passing them on to the plugin, and fills in the default of
+// missing arguments.
+type ControlArg struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"`
+}
+
+// ReportsRequest is sent by the probe to open the report stream, and again
+// whenever it needs a whole report to apply further increments to.
+type ReportsRequest struct {
+	Resync bool `json:"resync,omitempty"`
+}
+
+// ReportMessage is a report streamed by the plugin. Incremental reports are
+// merged into the previous one; others replace it.
+type ReportMessage struct {
+	Report      report.Report `json:"report"`
+	Incremental bool          `json:"incremental,omitempty"`
+}
+
+// HealthRequest asks the plugin how it is doing.
+type HealthRequest struct{}
+
+// HealthResponse is the plugin's own view of its health. Unhealthy plugins
+// keep reporting, but show up as such in the UI.
+type HealthResponse struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// PluginServer is the API v2 plugins serve.
+type PluginServer interface {
+	Handshake(context.Context, *HandshakeRequest) (*HandshakeResponse, error)
+	Reports(PluginReportsServer) error
+	Control(context.Context, *xfer.Request) (*PluginResponse, error)
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+}
+
+// PluginReportsServer is the plugin's end of the report stream.
+type PluginReportsServer interface {
+	Send(*ReportMessage) error
+	Recv() (*ReportsRequest, error)
+	grpc.ServerStream
+}
+
+type pluginReportsServer struct {
+	grpc.ServerStream
+}
+
+func (s pluginReportsServer) Send(msg *ReportMessage) error {
+	return s.SendMsg(msg)
+}
+
+func (s pluginReportsServer) Recv() (*ReportsRequest, error) {
+	req := &ReportsRequest{}
+	if err := s.RecvMsg(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// NewServer makes a gRPC server which speaks the encoding of the v2 API.
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	return grpc.NewServer(append(opts, grpc.CustomCodec(jsonCodec{}))...)
+}
+
+// RegisterPluginServer registers srv with s, which must come from NewServer.
+func RegisterPluginServer(s *grpc.Server, srv PluginServer) {
+	s.RegisterService(&pluginServiceDesc, srv)
+}
+
+var pluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: v2ServiceName,
+	HandlerType: (*PluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Handshake", Handler: handshakeHandler},
+		{MethodName: "Control", Handler: controlHandler},
+		{MethodName: "Health", Handler: healthHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Reports", Handler: reportsHandler, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+func v2Method(name string) string {
+	return fmt.Sprintf("/%s/%s", v2ServiceName, name)
+}
+
+func handshakeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &HandshakeRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Handshake(ctx, req.(*HandshakeRequest))
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: v2Method("Handshake")}, handler)
+}
+
+func controlHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &xfer.Request{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Control(ctx, req.(*xfer.Request))
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: v2Method("Control")}, handler)
+}
+
+func healthHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &HealthRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Health(ctx, req.(*HealthRequest))
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: v2Method("Health")}, handler)
+}
+
+func reportsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PluginServer).Reports(pluginReportsServer{stream})
+}
+
+// jsonCodec encodes messages the way v1 plugins do.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf []byte
+	err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(v)
+	return buf, err
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, &codec.JsonHandle{}).Decode(v)
+}
+
+func (jsonCodec) String() string { return "json" }
+
+// NewPluginV2 connects to a v2 plugin, and starts streaming its reports.
+func NewPluginV2(ctx context.Context, socket string, handshakeMetadata map[string]string) (*Plugin, error) {
+	id := strings.TrimSuffix(filepath.Base(socket), filepath.Ext(socket))
+	if !validPluginName.MatchString(id) {
+		return nil, fmt.Errorf("invalid plugin id %q", id)
+	}
+
+	conn, err := grpc.Dial(socket,
+		grpc.WithInsecure(),
+		grpc.WithCodec(jsonCodec{}),
+		grpc.WithMaxMsgSize(int(maxResponseBytes)),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	for k, v := range handshakeMetadata {
+		metadata[k] = v
+	}
+	metadata["api_version"] = V2APIVersion
+
+	ctx, cancel := context.WithCancel(ctx)
+	plugin := &Plugin{
+		PluginSpec:         xfer.PluginSpec{ID: id, Label: id},
+		context:            ctx,
+		socket:             socket,
+		expectedAPIVersion: V2APIVersion,
+		cancel:             cancel,
+		conn:               conn,
+		v2Metadata:         metadata,
+		apiVersions:        []string{V2APIVersion},
+		errors:             map[string]int{},
+		streamErr:          errNoReportYet,
+	}
+	plugin.backoff = backoff.New(plugin.streamReports, "streaming plugin reports")
+	plugin.backoff.SetInitialBackoff(v2StreamBackoff)
+	go plugin.backoff.Start()
+	return plugin, nil
+}
+
+// streamReports does the handshake with the plugin, then keeps the latest
+// report it streams until the stream breaks.
+func (p *Plugin) streamReports() (bool, error) {
+	ctx, cancel := context.WithTimeout(p.context, pluginTimeout)
+	handshake := &HandshakeResponse{}
+	err := grpc.Invoke(ctx, v2Method("Handshake"), &HandshakeRequest{Metadata: p.v2Metadata}, handshake, p.conn)
+	cancel()
+	if err != nil {
+		return p.streamFailed(err)
+	}
+	p.mtx.Lock()
+	p.handshake = handshake
+	p.mtx.Unlock()
+
+	ctx, cancel = context.WithCancel(p.context)
+	defer cancel()
+	stream, err := grpc.NewClientStream(ctx, &pluginServiceDesc.Streams[0], p.conn, v2Method("Reports"))
+	if err != nil {
+		return p.streamFailed(err)
+	}
+	if err := stream.SendMsg(&ReportsRequest{}); err != nil {
+		return p.streamFailed(err)
+	}
+	for {
+		msg := &ReportMessage{}
+		if err := stream.RecvMsg(msg); err != nil {
+			return p.streamFailed(err)
+		}
+		p.mtx.Lock()
+		resync := false
+		switch {
+		case !msg.Incremental:
+			p.latest = &msg.Report
+		case p.latest == nil:
+			// Nothing to apply the increment to
+			resync = true
+		default:
+			merged := p.latest.Merge(msg.Report)
+			p.latest = &merged
+		}
+		p.streamErr = nil
+		p.mtx.Unlock()
+		if resync {
+			if err := stream.SendMsg(&ReportsRequest{Resync: true}); err != nil {
+				return p.streamFailed(err)
+			}
+		}
+	}
+}
+
+func (p *Plugin) streamFailed(err error) (bool, error) {
+	if p.context.Err() != nil {
+		// The plugin is being closed
+		return true, nil
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.latest = nil
+	p.streamErr = err
+	return false, err
+}
+
+// reportV2 returns the latest report streamed by the plugin, with the
+// controls it declared, after checking on its health.
+func (p *Plugin) reportV2() (report.Report, error) {
+	p.mtx.Lock()
+	handshake, latest, err := p.handshake, p.latest, p.streamErr
+	p.mtx.Unlock()
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	if handshake == nil || latest == nil {
+		return report.MakeReport(), errNoReportYet
+	}
+
+	spec := handshake.Spec
+	if spec.ID != p.PluginSpec.ID {
+		return report.MakeReport(), malformedf("plugin must not change its id (is %q, should be %q)", spec.ID, p.PluginSpec.ID)
+	}
+	p.PluginSpec = spec
+	switch {
+	case spec.APIVersion != p.expectedAPIVersion:
+		return report.MakeReport(), malformedf("incorrect API version: expected %q, got %q", p.expectedAPIVersion, spec.APIVersion)
+	case spec.Label == "":
+		return report.MakeReport(), malformedf("spec must contain a label")
+	case !p.Implements("reporter"):
+		return report.MakeReport(), malformedf("spec must implement the \"reporter\" interface")
+	case len(handshake.Controls) > 0 && !p.Implements("controller"):
+		return report.MakeReport(), malformedf("spec must implement the \"controller\" interface to declare controls")
+	}
+
+	if err := checkPluginTopologies(*latest); err != nil {
+		return report.MakeReport(), err
+	}
+
+	result := latest.Copy()
+	result.Plugins = xfer.MakePluginSpecs(spec)
+	for _, control := range handshake.Controls {
+		result.WalkNamedTopologies(func(name string, topology *report.Topology) {
+			if name != control.Topology {
+				return
+			}
+			if topology.Controls == nil {
+				topology.Controls = report.Controls{}
+			}
+			topology.Controls.AddControl(control.Control)
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(p.context, pluginTimeout)
+	defer cancel()
+	health := &HealthResponse{}
+	if err := grpc.Invoke(ctx, v2Method("Health"), &HealthRequest{}, health, p.conn); err != nil {
+		return result, err
+	}
+	p.unhealthy = ""
+	if !health.Healthy {
+		p.unhealthy = health.Message
+		if p.unhealthy == "" {
+			p.unhealthy = "no reason given"
+		}
+	}
+	return result, nil
+}
+
+// controlV2 checks the arguments of the request against those the control
+// was declared with, and passes it on to the plugin.
+func (p *Plugin) controlV2(request xfer.Request) (PluginResponse, error) {
+	p.mtx.Lock()
+	handshake := p.handshake
+	p.mtx.Unlock()
+	if handshake == nil {
+		return PluginResponse{}, fmt.Errorf("the %s plugin is not connected", p.PluginSpec.Label)
+	}
+
+	var spec *ControlSpec
+	for i := range handshake.Controls {
+		if handshake.Controls[i].Control.ID == request.Control {
+			spec = &handshake.Controls[i]
+		}
+	}
+	if spec == nil {
+		return PluginResponse{}, fmt.Errorf("the %s plugin has no control %q", p.PluginSpec.Label, request.Control)
+	}
+	args, err := spec.checkArgs(request.ControlArgs)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	request.ControlArgs = args
+
+	ctx, cancel := context.WithTimeout(p.context, pluginTimeout)
+	defer cancel()
+	res := PluginResponse{}
+	err = grpc.Invoke(ctx, v2Method("Control"), &request, &res, p.conn)
+	return res, err
+}
+
+// checkArgs returns args, with the defaults of missing arguments filled in,
+// or an error if they don't fit the spec.
+func (s ControlSpec) checkArgs(args map[string]string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, arg := range s.Args {
+		value, ok := args[arg.Name]
+		if !ok {
+			if arg.Required {
+				return nil, fmt.Errorf("missing argument %q", arg.Name)
+			}
+			if arg.Default == "" {
+				continue
+			}
+			value = arg.Default
+		}
+		if err := arg.check(value); err != nil {
+			return nil, fmt.Errorf("argument %q: %v", arg.Name, err)
+		}
+		result[arg.Name] = value
+	}
+	for name := range args {
+		if _, ok := result[name]; !ok {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+	}
+	return result, nil
+}
+
+func (a ControlArg) check(value string) error {
+	var err error
+	switch a.Type {
+	case ArgString, "":
+	case ArgInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ArgFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ArgBool:
+		_, err = strconv.ParseBool(value)
+	case ArgDuration:
+		_, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("unknown type %q", a.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a %s", value, a.Type)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+type mockPluginServer struct {
+	reports  chan ReportMessage
+	resyncs  chan struct{}
+	requests chan xfer.Request
+
+	mtx     sync.Mutex
+	healthy bool
+}
+
+func (s *mockPluginServer) Handshake(_ context.Context, req *HandshakeRequest) (*HandshakeResponse, error) {
+	return &HandshakeResponse{
+		Spec: xfer.PluginSpec{
+			ID:         "testPlugin",
+			Label:      "Test Plugin",
+			Interfaces: []string{"reporter", "controller"},
+			APIVersion: req.Metadata["api_version"],
+		},
+		Controls: []ControlSpec{{
+			Control:  report.Control{ID: "restart", Human: "Restart", Icon: "fa-repeat"},
+			Topology: report.Host,
+			Args: []ControlArg{
+				{Name: "timeout", Type: ArgDuration, Default: "10s"},
+				{Name: "force", Type: ArgBool, Required: true},
+			},
+		}},
+	}, nil
+}
+
+func (s *mockPluginServer) Reports(stream PluginReportsServer) error {
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if req.Resync {
+				s.resyncs <- struct{}{}
+			}
+		}
+	}()
+	for msg := range s.reports {
+		msg := msg
+		if err := stream.Send(&msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mockPluginServer) Control(_ context.Context, req *xfer.Request) (*PluginResponse, error) {
+	s.requests <- *req
+	return &PluginResponse{Response: xfer.Response{Value: "restarted"}}, nil
+}
+
+func (s *mockPluginServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.healthy {
+		return &HealthResponse{Healthy: true}, nil
+	}
+	return &HealthResponse{Message: "disk full"}, nil
+}
+
+func reportWithHost(id string) report.Report {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID(id)))
+	return rpt
+}
+
+func TestPluginV2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "testPlugin.grpc")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockPluginServer{
+		reports:  make(chan ReportMessage),
+		resyncs:  make(chan struct{}, 1),
+		healthy:  true,
+		requests: make(chan xfer.Request, 1),
+	}
+	server := NewServer()
+	RegisterPluginServer(server, mock)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	plugin, err := NewPluginV2(context.Background(), socket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Close()
+
+	// Increments without a whole report to apply them to ask for one
+	mock.reports <- ReportMessage{Report: reportWithHost("a"), Incremental: true}
+	select {
+	case <-mock.resyncs:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a resync")
+	}
+	mock.reports <- ReportMessage{Report: reportWithHost("a")}
+	mock.reports <- ReportMessage{Report: reportWithHost("b"), Incremental: true}
+
+	test.Poll(t, time.Second, 2, func() interface{} {
+		rpt, _ := plugin.Report()
+		return len(rpt.Host.Nodes)
+	})
+	rpt, err := plugin.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin.Status != "ok" {
+		t.Errorf("Expected status ok, got %q", plugin.Status)
+	}
+	if _, ok := rpt.Host.Controls["restart"]; !ok {
+		t.Errorf("Expected the declared control on hosts, got %v", rpt.Host.Controls)
+	}
+
+	// Replacing the report drops what was there
+	mock.reports <- ReportMessage{Report: reportWithHost("c")}
+	test.Poll(t, time.Second, 1, func() interface{} {
+		rpt, _ := plugin.Report()
+		return len(rpt.Host.Nodes)
+	})
+
+	mock.mtx.Lock()
+	mock.healthy = false
+	mock.mtx.Unlock()
+	if _, err := plugin.Report(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "unhealthy: disk full"; plugin.Status != want {
+		t.Errorf("Expected status %q, got %q", want, plugin.Status)
+	}
+
+	// Control arguments are checked, and defaults filled in
+	for _, args := range []map[string]string{
+		{},
+		{"force": "maybe"},
+		{"force": "true", "unknown": "x"},
+	} {
+		res := plugin.Control(xfer.Request{Control: "restart", ControlArgs: args})
+		if res.Error == "" {
+			t.Errorf("Expected an error for arguments %v", args)
+		}
+	}
+	res := plugin.Control(xfer.Request{Control: "restart", ControlArgs: map[string]string{"force": "true"}})
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	if res.Value != "restarted" {
+		t.Errorf("Expected the plugin's response, got %v", res.Value)
+	}
+	want := map[string]string{"force": "true", "timeout": "10s"}
+	if have := (<-mock.requests).ControlArgs; !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected arguments %v, got %v", want, have)
+	}
+}
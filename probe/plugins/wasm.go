@@ -0,0 +1,205 @@
+package plugins
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/common/fs"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/plugins/wasm"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	wasmExt = ".wasm"
+	// wasmSpecSection is the custom section WASM plugins describe
+	// themselves in.
+	wasmSpecSection = "scope_plugin"
+)
+
+// DefaultWASMLimits are 10 million instructions per report, and 16MB of
+// memory.
+var DefaultWASMLimits = wasm.Limits{Fuel: 10 * 1000 * 1000, MaxPages: 256}
+
+// wasmSpec is what WASM plugins say about themselves: which topologies they
+// want to see the nodes of, and the metadata they add to those.
+type wasmSpec struct {
+	Label             string                   `json:"label"`
+	Description       string                   `json:"description"`
+	Topologies        []string                 `json:"topologies"`
+	MetadataTemplates report.MetadataTemplates `json:"metadata_templates"`
+}
+
+// wasmNode is what WASM plugins are given of each node.
+type wasmNode struct {
+	Topology string            `json:"topology"`
+	ID       string            `json:"id"`
+	Latest   map[string]string `json:"latest"`
+}
+
+// NewWASMPlugin loads the WASM module at path as a plugin. WASM plugins don't
+// report anything themselves, but tag the nodes of the probe's report with
+// metadata they extract from them. They run in the probe, sandboxed: they
+// can't reach anything outside of their memory, and both the instructions
+// they run and their memory are limited.
+func NewWASMPlugin(ctx context.Context, path string, limits wasm.Limits) (*Plugin, error) {
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if !validPluginName.MatchString(id) {
+		return nil, fmt.Errorf("invalid plugin id %q", id)
+	}
+	buf, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	module, err := wasm.Decode(buf)
+	if err != nil {
+		return nil, err
+	}
+	if !module.ExportsMemory("memory") {
+		return nil, fmt.Errorf("module must export its memory")
+	}
+	for name, want := range map[string][2][]byte{
+		"alloc": {{wasm.I32}, {wasm.I32}},
+		"tag":   {{wasm.I32, wasm.I32}, {wasm.I64}},
+	} {
+		params, results, ok := module.Exports(name)
+		if !ok || !bytes.Equal(params, want[0]) || !bytes.Equal(results, want[1]) {
+			return nil, fmt.Errorf("module must export alloc(i32) i32 and tag(i32, i32) i64 functions")
+		}
+	}
+
+	var spec wasmSpec
+	section, ok := module.Custom[wasmSpecSection]
+	if !ok {
+		return nil, fmt.Errorf("module must have a %s custom section", wasmSpecSection)
+	}
+	if err := codec.NewDecoderBytes(section, &codec.JsonHandle{}).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("decoding %s section: %v", wasmSpecSection, err)
+	}
+	if spec.Label == "" {
+		return nil, fmt.Errorf("spec must contain a label")
+	}
+	if len(spec.Topologies) == 0 {
+		return nil, fmt.Errorf("spec must name the topologies to tag")
+	}
+	for _, name := range spec.Topologies {
+		if _, ok := report.MakeReport().Topology(name); !ok {
+			return nil, fmt.Errorf("unknown topology %q", name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &Plugin{
+		PluginSpec: xfer.PluginSpec{
+			ID:          id,
+			Label:       spec.Label,
+			Description: spec.Description,
+			Interfaces:  []string{"tagger"},
+		},
+		context:    ctx,
+		socket:     path,
+		cancel:     cancel,
+		errors:     map[string]int{},
+		module:     module,
+		wasmSpec:   spec,
+		wasmLimits: limits,
+	}, nil
+}
+
+// tag runs the module over the nodes of the topologies it asked for, in a
+// fresh instance each time, so that nothing builds up from one report to the
+// next. Nothing is tagged unless all the nodes were.
+func (p *Plugin) tag(rpt report.Report) (result report.Report, err error) {
+	defer func() {
+		p.countError(err)
+		p.setStatus(err)
+	}()
+
+	instance, err := wasm.Instantiate(p.module, p.wasmLimits)
+	if err != nil {
+		return rpt, malformedError{err}
+	}
+	tagged := map[string]report.Nodes{}
+	for _, name := range p.wasmSpec.Topologies {
+		topology, _ := rpt.Topology(name)
+		nodes := report.Nodes{}
+		for id, node := range topology.Nodes {
+			latests, err := p.tagNode(instance, name, node)
+			if err != nil {
+				return rpt, err
+			}
+			if len(latests) > 0 {
+				nodes[id] = node.WithLatests(latests)
+			}
+		}
+		tagged[name] = nodes
+	}
+
+	rpt.WalkNamedTopologies(func(name string, t *report.Topology) {
+		nodes, ok := tagged[name]
+		if !ok {
+			return
+		}
+		*t = t.WithMetadataTemplates(p.wasmSpec.MetadataTemplates)
+		for id, node := range nodes {
+			t.Nodes[id] = node
+		}
+	})
+	return rpt, nil
+}
+
+// tagNode hands the node to the module's tag function, in memory it got
+// from its alloc function, and returns the latest values the module found.
+// The module answers with where the JSON of those is in its memory, as a
+// pointer in the high 32 bits and a length in the low ones.
+func (p *Plugin) tagNode(instance *wasm.Instance, topology string, node report.Node) (map[string]string, error) {
+	in := wasmNode{Topology: topology, ID: node.ID, Latest: map[string]string{}}
+	node.Latest.ForEach(func(k string, _ time.Time, v string) {
+		in.Latest[k] = v
+	})
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(in); err != nil {
+		return nil, err
+	}
+
+	res, err := instance.Call("alloc", uint64(len(buf)))
+	if err != nil {
+		return nil, err
+	} else if len(res) != 1 {
+		return nil, malformedf("alloc returned %d values", len(res))
+	}
+	ptr := res[0]
+	if ptr+uint64(len(buf)) > uint64(len(instance.Memory())) {
+		return nil, malformedf("alloc returned memory out of bounds")
+	}
+	copy(instance.Memory()[ptr:], buf)
+
+	if res, err = instance.Call("tag", ptr, uint64(len(buf))); err != nil {
+		return nil, err
+	} else if len(res) != 1 {
+		return nil, malformedf("tag returned %d values", len(res))
+	}
+	outPtr, outLen := res[0]>>32, res[0]&0xFFFFFFFF
+	if outLen == 0 {
+		return nil, nil
+	}
+	if outPtr+outLen > uint64(len(instance.Memory())) {
+		return nil, malformedf("tag returned memory out of bounds")
+	}
+	var latests map[string]string
+	if err := codec.NewDecoderBytes(instance.Memory()[outPtr:outPtr+outLen], &codec.JsonHandle{}).Decode(&latests); err != nil {
+		return nil, malformedf("decoding error: %s", err)
+	}
+	for k := range latests {
+		if _, ok := p.wasmSpec.MetadataTemplates[k]; !ok {
+			return nil, malformedf("plugin must declare the metadata it adds (%q isn't)", k)
+		}
+	}
+	return latests, nil
+}
@@ -0,0 +1,614 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	maxCallDepth = 1000
+	maxStackSize = 1 << 20
+)
+
+// Trap is an error raised by a running module. The instance can't be relied
+// upon after one.
+type Trap struct {
+	Reason string
+}
+
+func (t Trap) Error() string { return "wasm: " + t.Reason }
+
+// Limits bound what an instance can do.
+type Limits struct {
+	// Fuel is how many instructions the instance may run between refuels.
+	Fuel int64
+	// MaxPages caps the memory of the instance, in 64KiB pages.
+	MaxPages uint32
+}
+
+// ErrFuelExhausted is the trap of instances which ran out of fuel.
+var ErrFuelExhausted = Trap{"out of fuel"}
+
+// Instance is an instantiated module, with its own memory and globals.
+type Instance struct {
+	module  *Module
+	limits  Limits
+	fuel    int64
+	memory  []byte
+	maxMem  uint32
+	globals []uint64
+	table   []int
+	stack   []uint64
+	depth   int
+}
+
+type label struct {
+	cont   int
+	arity  int
+	height int
+	loop   bool
+}
+
+// Instantiate creates an instance of the module, with its memory and table
+// initialised, and runs its start function, if any.
+func Instantiate(m *Module, limits Limits) (*Instance, error) {
+	i := &Instance{
+		module:  m,
+		limits:  limits,
+		fuel:    limits.Fuel,
+		maxMem:  limits.MaxPages,
+		globals: make([]uint64, len(m.globals)),
+	}
+	for j, g := range m.globals {
+		i.globals[j] = g.init
+	}
+	if m.memory != nil {
+		if m.memory.max != nil && *m.memory.max < i.maxMem {
+			i.maxMem = *m.memory.max
+		}
+		if m.memory.min > i.maxMem {
+			return nil, fmt.Errorf("module needs %d pages of memory, more than the %d allowed", m.memory.min, i.maxMem)
+		}
+		i.memory = make([]byte, int(m.memory.min)*pageSize)
+	}
+	if m.table != nil {
+		i.table = make([]int, m.table.min)
+		for j := range i.table {
+			i.table[j] = -1
+		}
+	}
+	for _, s := range m.elements {
+		if uint64(s.offset)+uint64(len(s.funcs)) > uint64(len(i.table)) {
+			return nil, errors.New("element segment out of bounds")
+		}
+		for j, f := range s.funcs {
+			i.table[int(s.offset)+j] = int(f)
+		}
+	}
+	for _, s := range m.data {
+		if uint64(s.offset)+uint64(len(s.data)) > uint64(len(i.memory)) {
+			return nil, errors.New("data segment out of bounds")
+		}
+		copy(i.memory[s.offset:], s.data)
+	}
+	if m.start != nil {
+		if _, err := i.run(int(*m.start), nil); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// Refuel resets the fuel of the instance to its limit.
+func (i *Instance) Refuel() { i.fuel = i.limits.Fuel }
+
+// Memory is the memory of the instance. It is only valid until the next
+// call, as the module may grow it.
+func (i *Instance) Memory() []byte { return i.memory }
+
+// Call calls the exported function name with the given arguments, and
+// returns its results. Integers are passed as they are, zero-extended for
+// i32.
+func (i *Instance) Call(name string, args ...uint64) ([]uint64, error) {
+	e, ok := i.module.exports[name]
+	if !ok || e.kind != 0 {
+		return nil, fmt.Errorf("wasm: no function %q exported", name)
+	}
+	t := i.module.types[i.module.funcs[e.index].typ]
+	if len(args) != len(t.params) {
+		return nil, fmt.Errorf("wasm: %s takes %d arguments, got %d", name, len(t.params), len(args))
+	}
+	args = append([]uint64(nil), args...)
+	for j, vt := range t.params {
+		if vt == I32 {
+			args[j] = uint64(uint32(args[j]))
+		}
+	}
+	return i.run(int(e.index), args)
+}
+
+func (i *Instance) run(f int, args []uint64) (results []uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// Modules are validated as they're decoded, so what goes wrong in
+			// there is out of bounds memory accesses, the module's fault
+			results, err = nil, Trap{fmt.Sprint(r)}
+			i.stack, i.depth = i.stack[:0], 0
+		}
+	}()
+	i.stack = append(i.stack[:0], args...)
+	if err := i.call(f); err != nil {
+		i.stack, i.depth = i.stack[:0], 0
+		return nil, err
+	}
+	results = append([]uint64(nil), i.stack...)
+	i.stack = i.stack[:0]
+	return results, nil
+}
+
+func (i *Instance) push(v uint64) {
+	i.stack = append(i.stack, v)
+}
+
+func (i *Instance) pop() uint64 {
+	v := i.stack[len(i.stack)-1]
+	i.stack = i.stack[:len(i.stack)-1]
+	return v
+}
+
+func (i *Instance) pop32() uint32 {
+	return uint32(i.pop())
+}
+
+func b2i(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// address checks an access of size bytes at base+offset is within memory.
+func (i *Instance) address(offset uint64, size uint64) uint64 {
+	ea := uint64(i.pop32()) + offset
+	if ea+size > uint64(len(i.memory)) {
+		panic("out of bounds memory access")
+	}
+	return ea
+}
+
+func (i *Instance) grow(delta uint32) uint64 {
+	pages := uint32(len(i.memory) / pageSize)
+	if uint64(pages)+uint64(delta) > uint64(i.maxMem) {
+		return uint64(uint32(0xFFFFFFFF))
+	}
+	i.memory = append(i.memory, make([]byte, int(delta)*pageSize)...)
+	return uint64(pages)
+}
+
+// call runs function f, taking its arguments from the stack, and leaving
+// its results there.
+func (i *Instance) call(f int) error {
+	i.depth++
+	defer func() { i.depth-- }()
+	if i.depth > maxCallDepth {
+		return Trap{"call stack exhausted"}
+	}
+	if len(i.stack) > maxStackSize {
+		return Trap{"value stack exhausted"}
+	}
+
+	fn := &i.module.funcs[f]
+	t := i.module.types[fn.typ]
+	locals := make([]uint64, len(t.params)+len(fn.locals))
+	base := len(i.stack) - len(t.params)
+	copy(locals, i.stack[base:])
+	i.stack = i.stack[:base]
+
+	labels := []label{{cont: len(fn.code), arity: len(t.results), height: base}}
+	code := fn.code
+	pc := 0
+
+	// branch leaves the depth-th enclosing block, keeping the values it
+	// results in, and tells whether that was the function itself.
+	branch := func(depth int) bool {
+		l := labels[len(labels)-1-depth]
+		copy(i.stack[l.height:], i.stack[len(i.stack)-l.arity:])
+		i.stack = i.stack[:l.height+l.arity]
+		pc = l.cont
+		if l.loop {
+			labels = labels[:len(labels)-depth]
+		} else {
+			labels = labels[:len(labels)-1-depth]
+		}
+		return len(labels) == 0
+	}
+
+	for {
+		i.fuel--
+		if i.fuel < 0 {
+			return ErrFuelExhausted
+		}
+		in := &code[pc]
+		pc++
+		switch in.op {
+		case 0x00:
+			return Trap{"unreachable"}
+		case 0x01:
+		case 0x02:
+			labels = append(labels, label{cont: in.end + 1, arity: in.results, height: len(i.stack) - in.params})
+		case 0x03:
+			labels = append(labels, label{cont: pc, arity: in.params, height: len(i.stack) - in.params, loop: true})
+		case 0x04:
+			cond := i.pop32()
+			switch {
+			case cond != 0:
+			case in.els != 0:
+				pc = in.els + 1
+			default:
+				pc = in.end + 1
+				continue
+			}
+			labels = append(labels, label{cont: in.end + 1, arity: in.results, height: len(i.stack) - in.params})
+		case 0x05:
+			// The end of the then branch of an if
+			pc = in.end + 1
+			labels = labels[:len(labels)-1]
+		case 0x0B:
+			labels = labels[:len(labels)-1]
+			if len(labels) == 0 {
+				return nil
+			}
+		case 0x0C:
+			if branch(int(in.imm)) {
+				return nil
+			}
+		case 0x0D:
+			if i.pop32() != 0 && branch(int(in.imm)) {
+				return nil
+			}
+		case 0x0E:
+			index := i.pop32()
+			depth := in.table[len(in.table)-1]
+			if int(index) < len(in.table)-1 {
+				depth = in.table[index]
+			}
+			if branch(int(depth)) {
+				return nil
+			}
+		case 0x0F:
+			branch(len(labels) - 1)
+			return nil
+		case 0x10:
+			if err := i.call(int(in.imm)); err != nil {
+				return err
+			}
+		case 0x11:
+			index := i.pop32()
+			if int(index) >= len(i.table) || i.table[index] < 0 {
+				return Trap{"undefined element"}
+			}
+			callee := i.table[index]
+			if !i.module.types[i.module.funcs[callee].typ].equal(i.module.types[in.imm]) {
+				return Trap{"indirect call type mismatch"}
+			}
+			if err := i.call(callee); err != nil {
+				return err
+			}
+		case 0x1A:
+			i.pop()
+		case 0x1B:
+			cond := i.pop32()
+			b, a := i.pop(), i.pop()
+			if cond != 0 {
+				i.push(a)
+			} else {
+				i.push(b)
+			}
+		case 0x20:
+			i.push(locals[in.imm])
+		case 0x21:
+			locals[in.imm] = i.pop()
+		case 0x22:
+			locals[in.imm] = i.stack[len(i.stack)-1]
+		case 0x23:
+			i.push(i.globals[in.imm])
+		case 0x24:
+			i.globals[in.imm] = i.pop()
+
+		// Loads
+		case 0x28, 0x2A:
+			i.push(uint64(binary.LittleEndian.Uint32(i.memory[i.address(in.imm, 4):])))
+		case 0x29, 0x2B:
+			i.push(binary.LittleEndian.Uint64(i.memory[i.address(in.imm, 8):]))
+		case 0x2C:
+			i.push(uint64(uint32(int32(int8(i.memory[i.address(in.imm, 1)])))))
+		case 0x2D:
+			i.push(uint64(i.memory[i.address(in.imm, 1)]))
+		case 0x2E:
+			i.push(uint64(uint32(int32(int16(binary.LittleEndian.Uint16(i.memory[i.address(in.imm, 2):]))))))
+		case 0x2F:
+			i.push(uint64(binary.LittleEndian.Uint16(i.memory[i.address(in.imm, 2):])))
+		case 0x30:
+			i.push(uint64(int64(int8(i.memory[i.address(in.imm, 1)]))))
+		case 0x31:
+			i.push(uint64(i.memory[i.address(in.imm, 1)]))
+		case 0x32:
+			i.push(uint64(int64(int16(binary.LittleEndian.Uint16(i.memory[i.address(in.imm, 2):])))))
+		case 0x33:
+			i.push(uint64(binary.LittleEndian.Uint16(i.memory[i.address(in.imm, 2):])))
+		case 0x34:
+			i.push(uint64(int64(int32(binary.LittleEndian.Uint32(i.memory[i.address(in.imm, 4):])))))
+		case 0x35:
+			i.push(uint64(binary.LittleEndian.Uint32(i.memory[i.address(in.imm, 4):])))
+
+		// Stores
+		case 0x36, 0x38, 0x3E:
+			v := i.pop()
+			binary.LittleEndian.PutUint32(i.memory[i.address(in.imm, 4):], uint32(v))
+		case 0x37, 0x39:
+			v := i.pop()
+			binary.LittleEndian.PutUint64(i.memory[i.address(in.imm, 8):], v)
+		case 0x3A, 0x3C:
+			v := i.pop()
+			i.memory[i.address(in.imm, 1)] = byte(v)
+		case 0x3B, 0x3D:
+			v := i.pop()
+			binary.LittleEndian.PutUint16(i.memory[i.address(in.imm, 2):], uint16(v))
+		case 0x3F:
+			i.push(uint64(len(i.memory) / pageSize))
+		case 0x40:
+			i.push(i.grow(i.pop32()))
+		case opMemoryCopy:
+			n, src, dst := uint64(i.pop32()), uint64(i.pop32()), uint64(i.pop32())
+			if src+n > uint64(len(i.memory)) || dst+n > uint64(len(i.memory)) {
+				return Trap{"out of bounds memory access"}
+			}
+			copy(i.memory[dst:dst+n], i.memory[src:src+n])
+		case opMemoryFill:
+			n, v, dst := uint64(i.pop32()), byte(i.pop32()), uint64(i.pop32())
+			if dst+n > uint64(len(i.memory)) {
+				return Trap{"out of bounds memory access"}
+			}
+			for j := dst; j < dst+n; j++ {
+				i.memory[j] = v
+			}
+
+		// Constants
+		case 0x41, 0x42:
+			i.push(in.imm)
+
+		// i32 comparisons
+		case 0x45:
+			i.push(b2i(i.pop32() == 0))
+		case 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F:
+			b, a := i.pop32(), i.pop32()
+			i.push(b2i(compare32(in.op, a, b)))
+
+		// i64 comparisons
+		case 0x50:
+			i.push(b2i(i.pop() == 0))
+		case 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A:
+			b, a := i.pop(), i.pop()
+			i.push(b2i(compare64(in.op, a, b)))
+
+		// i32 arithmetic
+		case 0x67:
+			i.push(uint64(bits.LeadingZeros32(i.pop32())))
+		case 0x68:
+			i.push(uint64(bits.TrailingZeros32(i.pop32())))
+		case 0x69:
+			i.push(uint64(bits.OnesCount32(i.pop32())))
+		case 0x6A, 0x6B, 0x6C, 0x6D, 0x6E, 0x6F, 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78:
+			b, a := i.pop32(), i.pop32()
+			v, err := arith32(in.op, a, b)
+			if err != nil {
+				return err
+			}
+			i.push(uint64(v))
+
+		// i64 arithmetic
+		case 0x79:
+			i.push(uint64(bits.LeadingZeros64(i.pop())))
+		case 0x7A:
+			i.push(uint64(bits.TrailingZeros64(i.pop())))
+		case 0x7B:
+			i.push(uint64(bits.OnesCount64(i.pop())))
+		case 0x7C, 0x7D, 0x7E, 0x7F, 0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8A:
+			b, a := i.pop(), i.pop()
+			v, err := arith64(in.op-0x12, a, b)
+			if err != nil {
+				return err
+			}
+			i.push(v)
+
+		// Conversions
+		case 0xA7:
+			i.push(uint64(i.pop32()))
+		case 0xAC:
+			i.push(uint64(int64(int32(i.pop32()))))
+		case 0xAD:
+			i.push(uint64(i.pop32()))
+		case 0xBC, 0xBD, 0xBE, 0xBF:
+			// Reinterpretations keep the bits as they are
+		case 0xC0:
+			i.push(uint64(uint32(int32(int8(i.pop32())))))
+		case 0xC1:
+			i.push(uint64(uint32(int32(int16(i.pop32())))))
+		case 0xC2:
+			i.push(uint64(int64(int8(i.pop()))))
+		case 0xC3:
+			i.push(uint64(int64(int16(i.pop()))))
+		case 0xC4:
+			i.push(uint64(int64(int32(i.pop()))))
+
+		default:
+			return Trap{fmt.Sprintf("unsupported instruction 0x%x", in.op)}
+		}
+	}
+}
+
+// compare32 runs the binary i32 comparison op.
+func compare32(op uint16, a, b uint32) bool {
+	switch op {
+	case 0x46:
+		return a == b
+	case 0x47:
+		return a != b
+	case 0x48:
+		return int32(a) < int32(b)
+	case 0x49:
+		return a < b
+	case 0x4A:
+		return int32(a) > int32(b)
+	case 0x4B:
+		return a > b
+	case 0x4C:
+		return int32(a) <= int32(b)
+	case 0x4D:
+		return a <= b
+	case 0x4E:
+		return int32(a) >= int32(b)
+	default:
+		return a >= b
+	}
+}
+
+func compare64(op uint16, a, b uint64) bool {
+	switch op {
+	case 0x51:
+		return a == b
+	case 0x52:
+		return a != b
+	case 0x53:
+		return int64(a) < int64(b)
+	case 0x54:
+		return a < b
+	case 0x55:
+		return int64(a) > int64(b)
+	case 0x56:
+		return a > b
+	case 0x57:
+		return int64(a) <= int64(b)
+	case 0x58:
+		return a <= b
+	case 0x59:
+		return int64(a) >= int64(b)
+	default:
+		return a >= b
+	}
+}
+
+var (
+	errDivideByZero = Trap{"integer divide by zero"}
+	errOverflow     = Trap{"integer overflow"}
+)
+
+// arith32 runs the binary i32 operator op. The i64 ones are 0x12 opcodes
+// up, and arith64 takes the same opcodes.
+func arith32(op uint16, a, b uint32) (uint32, error) {
+	switch op {
+	case 0x6A:
+		return a + b, nil
+	case 0x6B:
+		return a - b, nil
+	case 0x6C:
+		return a * b, nil
+	case 0x6D:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		if int32(a) == -1<<31 && int32(b) == -1 {
+			return 0, errOverflow
+		}
+		return uint32(int32(a) / int32(b)), nil
+	case 0x6E:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a / b, nil
+	case 0x6F:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		if int32(b) == -1 {
+			return 0, nil
+		}
+		return uint32(int32(a) % int32(b)), nil
+	case 0x70:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a % b, nil
+	case 0x71:
+		return a & b, nil
+	case 0x72:
+		return a | b, nil
+	case 0x73:
+		return a ^ b, nil
+	case 0x74:
+		return a << (b % 32), nil
+	case 0x75:
+		return uint32(int32(a) >> (b % 32)), nil
+	case 0x76:
+		return a >> (b % 32), nil
+	case 0x77:
+		return bits.RotateLeft32(a, int(b%32)), nil
+	default:
+		return bits.RotateLeft32(a, -int(b%32)), nil
+	}
+}
+
+func arith64(op uint16, a, b uint64) (uint64, error) {
+	switch op {
+	case 0x6A:
+		return a + b, nil
+	case 0x6B:
+		return a - b, nil
+	case 0x6C:
+		return a * b, nil
+	case 0x6D:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		if int64(a) == -1<<63 && int64(b) == -1 {
+			return 0, errOverflow
+		}
+		return uint64(int64(a) / int64(b)), nil
+	case 0x6E:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a / b, nil
+	case 0x6F:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		if int64(b) == -1 {
+			return 0, nil
+		}
+		return uint64(int64(a) % int64(b)), nil
+	case 0x70:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a % b, nil
+	case 0x71:
+		return a & b, nil
+	case 0x72:
+		return a | b, nil
+	case 0x73:
+		return a ^ b, nil
+	case 0x74:
+		return a << (b % 64), nil
+	case 0x75:
+		return uint64(int64(a) >> (b % 64)), nil
+	case 0x76:
+		return a >> (b % 64), nil
+	case 0x77:
+		return bits.RotateLeft64(a, int(b%64)), nil
+	default:
+		return bits.RotateLeft64(a, -int(b%64)), nil
+	}
+}
@@ -0,0 +1,959 @@
+// Package wasm runs WebAssembly modules in a sandbox: they can't import
+// anything from the host, they run for a bounded number of instructions, and
+// their memory is capped. Only the integer subset of WebAssembly 1.0 (plus
+// sign extension and bulk memory.copy/fill) is supported, which is all the
+// report transforms plugins do need. Modules are validated, function bodies
+// type-checked as the spec says, as they are decoded.
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Value types
+const (
+	I32 byte = 0x7F
+	I64 byte = 0x7E
+	F32 byte = 0x7D
+	F64 byte = 0x7C
+)
+
+const (
+	pageSize      = 64 * 1024
+	maxPages      = 65536
+	funcRef       = 0x70
+	emptyBlock    = 0x40
+	opMemoryCopy  = 0xFC0A
+	opMemoryFill  = 0xFC0B
+	maxLocals     = 50000
+	maxTableSize  = 1 << 20
+	maxBodyInstrs = 1 << 20
+)
+
+var errUnexpectedEnd = errors.New("unexpected end of module")
+
+type funcType struct {
+	params, results []byte
+}
+
+func (t funcType) equal(o funcType) bool {
+	return bytes.Equal(t.params, o.params) && bytes.Equal(t.results, o.results)
+}
+
+type function struct {
+	typ    uint32
+	locals []byte
+	code   []instr
+}
+
+// instr is a decoded instruction, with its immediates, and with where its
+// block ends (and, for if, where its else is) worked out ahead of time.
+type instr struct {
+	op      uint16
+	imm     uint64
+	end     int
+	els     int
+	params  int
+	results int
+	table   []uint32
+}
+
+type global struct {
+	typ     byte
+	mutable bool
+	init    uint64
+}
+
+type segment struct {
+	offset uint32
+	data   []byte
+	funcs  []uint32
+}
+
+type export struct {
+	kind  byte
+	index uint32
+}
+
+// Module is a decoded WASM module, ready to be instantiated.
+type Module struct {
+	types    []funcType
+	funcs    []function
+	table    *limits
+	memory   *limits
+	globals  []global
+	exports  map[string]export
+	start    *uint32
+	elements []segment
+	data     []segment
+
+	// Custom sections, by name
+	Custom map[string][]byte
+}
+
+type limits struct {
+	min uint32
+	max *uint32
+}
+
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) eof() bool { return r.pos >= len(r.buf) }
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errUnexpectedEnd
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n uint32) ([]byte, error) {
+	if uint64(r.pos)+uint64(n) > uint64(len(r.buf)) {
+		return nil, errUnexpectedEnd
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	var result uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+	return 0, errors.New("integer representation too long")
+}
+
+func (r *reader) signed(size uint) (int64, error) {
+	var result int64
+	var shift uint
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		result |= int64(b&0x7F) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				result |= -1 << shift
+			}
+			return result, nil
+		}
+		if shift >= size {
+			return 0, errors.New("integer representation too long")
+		}
+	}
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+func (r *reader) valueType() (byte, error) {
+	t, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t {
+	case I32, I64, F32, F64:
+		return t, nil
+	}
+	return 0, fmt.Errorf("unknown value type 0x%x", t)
+}
+
+func (r *reader) limits() (*limits, error) {
+	flags, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	min, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	l := &limits{min: min}
+	switch flags {
+	case 0:
+	case 1:
+		max, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, errors.New("maximum size smaller than the minimum")
+		}
+		l.max = &max
+	default:
+		return nil, fmt.Errorf("unsupported limits flags 0x%x", flags)
+	}
+	return l, nil
+}
+
+// Decode decodes a binary WASM module.
+func Decode(b []byte) (*Module, error) {
+	if len(b) < 8 || !bytes.Equal(b[:4], []byte("\x00asm")) {
+		return nil, errors.New("not a WASM module")
+	}
+	if version := binary.LittleEndian.Uint32(b[4:8]); version != 1 {
+		return nil, fmt.Errorf("unsupported WASM version %d", version)
+	}
+	m := &Module{
+		exports: map[string]export{},
+		Custom:  map[string][]byte{},
+	}
+	var funcTypes []uint32
+	r := &reader{buf: b, pos: 8}
+	for !r.eof() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		body, err := r.bytes(size)
+		if err != nil {
+			return nil, err
+		}
+		s := &reader{buf: body}
+		switch id {
+		case 0:
+			err = m.decodeCustom(s)
+		case 1:
+			err = m.decodeTypes(s)
+		case 2:
+			err = errors.New("imports are not supported: modules must be self-contained")
+		case 3:
+			funcTypes, err = m.decodeFunctions(s)
+		case 4:
+			err = m.decodeTable(s)
+		case 5:
+			err = m.decodeMemory(s)
+		case 6:
+			err = m.decodeGlobals(s)
+		case 7:
+			err = m.decodeExports(s)
+		case 8:
+			var start uint32
+			start, err = s.u32()
+			m.start = &start
+		case 9:
+			err = m.decodeElements(s)
+		case 10:
+			err = m.decodeCode(s, funcTypes)
+		case 11:
+			err = m.decodeData(s)
+		case 12:
+			_, err = s.u32()
+		default:
+			err = fmt.Errorf("unknown section %d", id)
+		}
+		if err == nil && id != 0 && !s.eof() {
+			err = errors.New("section size mismatch")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %v", id, err)
+		}
+	}
+	if len(funcTypes) != len(m.funcs) {
+		return nil, errors.New("function and code sections don't match")
+	}
+	return m, m.validate()
+}
+
+func (m *Module) decodeCustom(r *reader) error {
+	name, err := r.name()
+	if err != nil {
+		return err
+	}
+	m.Custom[name] = r.buf[r.pos:]
+	return nil
+}
+
+func (m *Module) decodeTypes(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if form, err := r.byte(); err != nil {
+			return err
+		} else if form != 0x60 {
+			return fmt.Errorf("unknown type form 0x%x", form)
+		}
+		var t funcType
+		for _, types := range []*[]byte{&t.params, &t.results} {
+			count, err := r.u32()
+			if err != nil {
+				return err
+			}
+			for j := uint32(0); j < count; j++ {
+				vt, err := r.valueType()
+				if err != nil {
+					return err
+				}
+				*types = append(*types, vt)
+			}
+		}
+		m.types = append(m.types, t)
+	}
+	return nil
+}
+
+func (m *Module) decodeFunctions(r *reader) ([]uint32, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	var result []uint32
+	for i := uint32(0); i < n; i++ {
+		typ, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if int(typ) >= len(m.types) {
+			return nil, fmt.Errorf("unknown type %d", typ)
+		}
+		result = append(result, typ)
+	}
+	return result, nil
+}
+
+func (m *Module) decodeTable(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if m.table != nil {
+			return errors.New("multiple tables")
+		}
+		if t, err := r.byte(); err != nil {
+			return err
+		} else if t != funcRef {
+			return fmt.Errorf("unsupported table type 0x%x", t)
+		}
+		if m.table, err = r.limits(); err != nil {
+			return err
+		}
+		if m.table.min > maxTableSize {
+			return errors.New("table too large")
+		}
+	}
+	return nil
+}
+
+func (m *Module) decodeMemory(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if m.memory != nil {
+			return errors.New("multiple memories")
+		}
+		if m.memory, err = r.limits(); err != nil {
+			return err
+		}
+		if m.memory.min > maxPages || (m.memory.max != nil && *m.memory.max > maxPages) {
+			return errors.New("memory too large")
+		}
+	}
+	return nil
+}
+
+// constExpr decodes the constant expressions initialising globals and
+// giving the offsets of segments, of type typ.
+func (m *Module) constExpr(r *reader, typ byte) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		value  uint64
+		actual byte
+	)
+	switch op {
+	case 0x41:
+		v, err := r.signed(32)
+		if err != nil {
+			return 0, err
+		}
+		value, actual = uint64(uint32(v)), I32
+	case 0x42:
+		v, err := r.signed(64)
+		if err != nil {
+			return 0, err
+		}
+		value, actual = uint64(v), I64
+	case 0x23:
+		index, err := r.u32()
+		if err != nil {
+			return 0, err
+		}
+		if int(index) >= len(m.globals) {
+			return 0, fmt.Errorf("unknown global %d", index)
+		}
+		g := m.globals[index]
+		if g.mutable {
+			return 0, errors.New("constant expression required")
+		}
+		value, actual = g.init, g.typ
+	default:
+		return 0, fmt.Errorf("unsupported constant expression 0x%x", op)
+	}
+	if actual != typ {
+		return 0, fmt.Errorf("type mismatch: expected %s, got %s", typeName(typ), typeName(actual))
+	}
+	if end, err := r.byte(); err != nil {
+		return 0, err
+	} else if end != 0x0B {
+		return 0, errors.New("constant expression too long")
+	}
+	return value, nil
+}
+
+func (m *Module) decodeGlobals(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		var g global
+		if g.typ, err = r.valueType(); err != nil {
+			return err
+		}
+		mutable, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if mutable > 1 {
+			return errors.New("malformed mutability")
+		}
+		g.mutable = mutable == 1
+		if g.init, err = m.constExpr(r, g.typ); err != nil {
+			return err
+		}
+		m.globals = append(m.globals, g)
+	}
+	return nil
+}
+
+func (m *Module) decodeExports(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		var e export
+		if e.kind, err = r.byte(); err != nil {
+			return err
+		}
+		if e.index, err = r.u32(); err != nil {
+			return err
+		}
+		if _, ok := m.exports[name]; ok {
+			return fmt.Errorf("duplicate export %q", name)
+		}
+		m.exports[name] = e
+	}
+	return nil
+}
+
+func (m *Module) decodeElements(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if flags, err := r.u32(); err != nil {
+			return err
+		} else if flags != 0 {
+			return fmt.Errorf("unsupported element segment flags %d", flags)
+		}
+		offset, err := m.constExpr(r, I32)
+		if err != nil {
+			return err
+		}
+		count, err := r.u32()
+		if err != nil {
+			return err
+		}
+		s := segment{offset: uint32(offset)}
+		for j := uint32(0); j < count; j++ {
+			index, err := r.u32()
+			if err != nil {
+				return err
+			}
+			s.funcs = append(s.funcs, index)
+		}
+		m.elements = append(m.elements, s)
+	}
+	return nil
+}
+
+func (m *Module) decodeData(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if flags, err := r.u32(); err != nil {
+			return err
+		} else if flags != 0 {
+			return fmt.Errorf("unsupported data segment flags %d", flags)
+		}
+		offset, err := m.constExpr(r, I32)
+		if err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		data, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		m.data = append(m.data, segment{offset: uint32(offset), data: data})
+	}
+	return nil
+}
+
+func (m *Module) decodeCode(r *reader, funcTypes []uint32) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if int(n) != len(funcTypes) {
+		return errors.New("function and code sections don't match")
+	}
+	// All the functions are known before any is decoded, for calls to later
+	// ones to be checked
+	m.funcs = make([]function, n)
+	for i := range m.funcs {
+		m.funcs[i].typ = funcTypes[i]
+	}
+	for i := uint32(0); i < n; i++ {
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		body, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		f := &m.funcs[i]
+		b := &reader{buf: body}
+		groups, err := b.u32()
+		if err != nil {
+			return err
+		}
+		for j := uint32(0); j < groups; j++ {
+			count, err := b.u32()
+			if err != nil {
+				return err
+			}
+			vt, err := b.valueType()
+			if err != nil {
+				return err
+			}
+			if len(f.locals)+int(count) > maxLocals {
+				return errors.New("too many locals")
+			}
+			for k := uint32(0); k < count; k++ {
+				f.locals = append(f.locals, vt)
+			}
+		}
+		if f.code, err = m.decodeBody(b, f.typ, f.locals); err != nil {
+			return fmt.Errorf("function %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (m *Module) blockType(r *reader) (funcType, error) {
+	b, err := r.byte()
+	if err != nil {
+		return funcType{}, err
+	}
+	switch b {
+	case emptyBlock:
+		return funcType{}, nil
+	case I32, I64, F32, F64:
+		return funcType{results: []byte{b}}, nil
+	}
+	r.pos--
+	index, err := r.signed(33)
+	if err != nil {
+		return funcType{}, err
+	}
+	if index < 0 || int(index) >= len(m.types) {
+		return funcType{}, fmt.Errorf("unknown block type %d", index)
+	}
+	return m.types[index], nil
+}
+
+// decodeBody decodes the instructions of a function, checking the indices
+// they refer to and matching blocks with their ends. They are type-checked
+// as they are, so running them needn't check the stack.
+func (m *Module) decodeBody(r *reader, typ uint32, locals []byte) ([]instr, error) {
+	var (
+		code   []instr
+		blocks []int
+		t      = m.types[typ]
+		types  = append(append([]byte(nil), t.params...), locals...)
+		v      = &validator{}
+	)
+	// The function is a block of its own, which branches leave by returning
+	v.pushCtrl(0x02, nil, t.results)
+	for {
+		if r.eof() {
+			return nil, errUnexpectedEnd
+		}
+		if len(code) >= maxBodyInstrs {
+			return nil, errors.New("function too long")
+		}
+		op, _ := r.byte()
+		in := instr{op: uint16(op)}
+		var err error
+		switch {
+		case op == 0x00:
+			v.unreachable()
+		case op == 0x01:
+		case op == 0x02 || op == 0x03 || op == 0x04:
+			var bt funcType
+			if bt, err = m.blockType(r); err != nil {
+				break
+			}
+			in.params, in.results = len(bt.params), len(bt.results)
+			if op == 0x04 {
+				if _, err = v.popType(I32); err != nil {
+					break
+				}
+			}
+			if err = v.pops(bt.params); err == nil {
+				v.pushCtrl(op, bt.params, bt.results)
+				blocks = append(blocks, len(code))
+			}
+		case op == 0x05:
+			if len(blocks) == 0 || code[blocks[len(blocks)-1]].op != 0x04 || code[blocks[len(blocks)-1]].els != 0 {
+				return nil, errors.New("else without if")
+			}
+			var f ctrlFrame
+			if f, err = v.popCtrl(); err == nil {
+				v.pushCtrl(op, f.start, f.end)
+				code[blocks[len(blocks)-1]].els = len(code)
+			}
+		case op == 0x0B:
+			var f ctrlFrame
+			if f, err = v.popCtrl(); err != nil {
+				break
+			}
+			if f.op == 0x04 && !bytes.Equal(f.start, f.end) {
+				return nil, errors.New("type mismatch: if without else must leave what it takes")
+			}
+			v.pushes(f.end)
+			if len(blocks) == 0 {
+				code = append(code, in)
+				if !r.eof() {
+					return nil, errors.New("instructions after the end of the function")
+				}
+				return code, nil
+			}
+			start := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			code[start].end = len(code)
+			if els := code[start].els; els != 0 {
+				code[els].end = len(code)
+			}
+		case op == 0x0C:
+			if in.imm, err = m.index(r, uint64(len(blocks))+1, "label"); err == nil {
+				err = v.pops(v.labelTypes(in.imm))
+				v.unreachable()
+			}
+		case op == 0x0D:
+			if in.imm, err = m.index(r, uint64(len(blocks))+1, "label"); err != nil {
+				break
+			}
+			if _, err = v.popType(I32); err == nil {
+				err = v.branch(in.imm)
+			}
+		case op == 0x0E:
+			var n uint32
+			if n, err = r.u32(); err != nil {
+				break
+			}
+			if n > uint32(len(r.buf)) {
+				return nil, errUnexpectedEnd
+			}
+			for j := uint32(0); j <= n && err == nil; j++ {
+				var depth uint64
+				depth, err = m.index(r, uint64(len(blocks))+1, "label")
+				in.table = append(in.table, uint32(depth))
+			}
+			if err != nil {
+				break
+			}
+			if _, err = v.popType(I32); err != nil {
+				break
+			}
+			types := v.labelTypes(uint64(in.table[n]))
+			for _, depth := range in.table[:n] {
+				if len(v.labelTypes(uint64(depth))) != len(types) {
+					return nil, errors.New("type mismatch: br_table labels of different arities")
+				}
+				if err = v.branch(uint64(depth)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = v.pops(types)
+				v.unreachable()
+			}
+		case op == 0x0F:
+			err = v.pops(t.results)
+			v.unreachable()
+		case op == 0x10:
+			if in.imm, err = m.index(r, uint64(len(m.funcs)), "function"); err == nil {
+				callee := m.types[m.funcs[in.imm].typ]
+				if err = v.pops(callee.params); err == nil {
+					v.pushes(callee.results)
+				}
+			}
+		case op == 0x11:
+			if m.table == nil {
+				return nil, errors.New("call_indirect without a table")
+			}
+			if in.imm, err = m.index(r, uint64(len(m.types)), "type"); err != nil {
+				break
+			}
+			var table byte
+			if table, err = r.byte(); err == nil && table != 0 {
+				err = errors.New("unknown table")
+			}
+			if err != nil {
+				break
+			}
+			callee := m.types[in.imm]
+			if _, err = v.popType(I32); err == nil {
+				if err = v.pops(callee.params); err == nil {
+					v.pushes(callee.results)
+				}
+			}
+		case op == 0x1A:
+			_, err = v.pop()
+		case op == 0x1B:
+			err = v.selects(unknown)
+		case op == 0x1C:
+			var n uint32
+			var vt byte
+			if n, err = r.u32(); err == nil && n != 1 {
+				err = errors.New("invalid select arity")
+			} else if err == nil {
+				if vt, err = r.valueType(); err == nil {
+					err = v.selects(vt)
+				}
+			}
+			in.op = 0x1B
+		case op >= 0x20 && op <= 0x22:
+			if in.imm, err = m.index(r, uint64(len(types)), "local"); err != nil {
+				break
+			}
+			if op == 0x20 {
+				v.push(types[in.imm])
+			} else if _, err = v.popType(types[in.imm]); err == nil && op == 0x22 {
+				v.push(types[in.imm])
+			}
+		case op == 0x23 || op == 0x24:
+			if in.imm, err = m.index(r, uint64(len(m.globals)), "global"); err != nil {
+				break
+			}
+			g := m.globals[in.imm]
+			if op == 0x23 {
+				v.push(g.typ)
+			} else if !g.mutable {
+				err = errors.New("global is immutable")
+			} else {
+				_, err = v.popType(g.typ)
+			}
+		case op >= 0x28 && op <= 0x3E:
+			if m.memory == nil {
+				return nil, errors.New("memory access without a memory")
+			}
+			mo := memoryOps[op-0x28]
+			var align, offset uint32
+			if align, err = r.u32(); err != nil {
+				break
+			}
+			if align > 3 || 1<<align > mo.size {
+				return nil, errors.New("alignment must not be larger than natural")
+			}
+			if offset, err = r.u32(); err != nil {
+				break
+			}
+			in.imm = uint64(offset)
+			if mo.store {
+				err = v.pops([]byte{I32, mo.typ})
+			} else if _, err = v.popType(I32); err == nil {
+				v.push(mo.typ)
+			}
+		case op == 0x3F || op == 0x40:
+			if m.memory == nil {
+				return nil, errors.New("memory access without a memory")
+			}
+			var zero byte
+			if zero, err = r.byte(); err == nil && zero != 0 {
+				err = errors.New("zero byte expected")
+			}
+			if err == nil && op == 0x40 {
+				_, err = v.popType(I32)
+			}
+			v.push(I32)
+		case op == 0x41:
+			var i int64
+			i, err = r.signed(32)
+			in.imm = uint64(uint32(i))
+			v.push(I32)
+		case op == 0x42:
+			var i int64
+			i, err = r.signed(64)
+			in.imm = uint64(i)
+			v.push(I64)
+		case op == 0xFC:
+			var sub uint32
+			if sub, err = r.u32(); err != nil {
+				break
+			}
+			if m.memory == nil {
+				return nil, errors.New("memory access without a memory")
+			}
+			in.op = 0xFC00 | uint16(sub)
+			var zeros []byte
+			switch in.op {
+			case opMemoryCopy:
+				zeros, err = r.bytes(2)
+			case opMemoryFill:
+				zeros, err = r.bytes(1)
+			default:
+				return nil, fmt.Errorf("unsupported instruction 0xfc %d", sub)
+			}
+			if err == nil && !bytes.Equal(zeros, make([]byte, len(zeros))) {
+				err = errors.New("zero byte expected")
+			}
+			if err == nil {
+				err = v.pops([]byte{I32, I32, I32})
+			}
+		default:
+			params, results, ok := signature(op)
+			if !ok {
+				return nil, fmt.Errorf("unsupported instruction 0x%x", op)
+			}
+			if err = v.pops(params); err == nil {
+				v.pushes(results)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		code = append(code, in)
+	}
+}
+
+func (m *Module) index(r *reader, n uint64, what string) (uint64, error) {
+	index, err := r.u32()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(index) >= n {
+		return 0, fmt.Errorf("unknown %s %d", what, index)
+	}
+	return uint64(index), nil
+}
+
+func (m *Module) validate() error {
+	for name, e := range m.exports {
+		var n int
+		switch e.kind {
+		case 0:
+			n = len(m.funcs)
+		case 1:
+			if m.table != nil {
+				n = 1
+			}
+		case 2:
+			if m.memory != nil {
+				n = 1
+			}
+		case 3:
+			n = len(m.globals)
+		}
+		if int(e.index) >= n {
+			return fmt.Errorf("export %q: unknown index %d", name, e.index)
+		}
+	}
+	if m.start != nil {
+		if int(*m.start) >= len(m.funcs) {
+			return fmt.Errorf("unknown start function %d", *m.start)
+		}
+		if t := m.types[m.funcs[*m.start].typ]; len(t.params) > 0 || len(t.results) > 0 {
+			return errors.New("start function must take and return nothing")
+		}
+	}
+	for _, s := range m.elements {
+		if m.table == nil {
+			return errors.New("element segment without a table")
+		}
+		for _, f := range s.funcs {
+			if int(f) >= len(m.funcs) {
+				return fmt.Errorf("element segment: unknown function %d", f)
+			}
+		}
+	}
+	if len(m.data) > 0 && m.memory == nil {
+		return errors.New("data segment without a memory")
+	}
+	return nil
+}
+
+// Exports tells whether the module exports a function called name, and
+// with which parameter and result types.
+func (m *Module) Exports(name string) (params, results []byte, ok bool) {
+	e, ok := m.exports[name]
+	if !ok || e.kind != 0 {
+		return nil, nil, false
+	}
+	t := m.types[m.funcs[e.index].typ]
+	return t.params, t.results, true
+}
+
+// ExportsMemory tells whether the module exports its memory as name.
+func (m *Module) ExportsMemory(name string) bool {
+	e, ok := m.exports[name]
+	return ok && e.kind == 2
+}
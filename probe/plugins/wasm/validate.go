@@ -0,0 +1,214 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// unknown is the type of values popped off the stack after an
+// unconditional branch, which may be of any type.
+const unknown byte = 0
+
+// memoryOps are the loads (0x28 to 0x35) and stores (0x36 to 0x3E), by
+// opcode: how many bytes they access, and the type of their value.
+var memoryOps = [...]struct {
+	size  uint32
+	typ   byte
+	store bool
+}{
+	{4, I32, false}, {8, I64, false}, {4, F32, false}, {8, F64, false},
+	{1, I32, false}, {1, I32, false}, {2, I32, false}, {2, I32, false},
+	{1, I64, false}, {1, I64, false}, {2, I64, false}, {2, I64, false}, {4, I64, false}, {4, I64, false},
+	{4, I32, true}, {8, I64, true}, {4, F32, true}, {8, F64, true},
+	{1, I32, true}, {2, I32, true},
+	{1, I64, true}, {2, I64, true}, {4, I64, true},
+}
+
+// signature is the types of what the instructions without immediates,
+// other than those of control and the stack, pop and push.
+func signature(op byte) (params, results []byte, ok bool) {
+	switch {
+	case op == 0x45: // i32.eqz
+		return []byte{I32}, []byte{I32}, true
+	case op >= 0x46 && op <= 0x4F:
+		return []byte{I32, I32}, []byte{I32}, true
+	case op == 0x50: // i64.eqz
+		return []byte{I64}, []byte{I32}, true
+	case op >= 0x51 && op <= 0x5A:
+		return []byte{I64, I64}, []byte{I32}, true
+	case op >= 0x67 && op <= 0x69:
+		return []byte{I32}, []byte{I32}, true
+	case op >= 0x6A && op <= 0x78:
+		return []byte{I32, I32}, []byte{I32}, true
+	case op >= 0x79 && op <= 0x7B:
+		return []byte{I64}, []byte{I64}, true
+	case op >= 0x7C && op <= 0x8A:
+		return []byte{I64, I64}, []byte{I64}, true
+	case op == 0xA7: // i32.wrap_i64
+		return []byte{I64}, []byte{I32}, true
+	case op == 0xAC || op == 0xAD: // i64.extend_i32_s and _u
+		return []byte{I32}, []byte{I64}, true
+	case op == 0xBC:
+		return []byte{F32}, []byte{I32}, true
+	case op == 0xBD:
+		return []byte{F64}, []byte{I64}, true
+	case op == 0xBE:
+		return []byte{I32}, []byte{F32}, true
+	case op == 0xBF:
+		return []byte{I64}, []byte{F64}, true
+	case op == 0xC0 || op == 0xC1:
+		return []byte{I32}, []byte{I32}, true
+	case op >= 0xC2 && op <= 0xC4:
+		return []byte{I64}, []byte{I64}, true
+	}
+	return nil, nil, false
+}
+
+// ctrlFrame is a block being validated: the types it takes and leaves, and
+// the height of the stack below it.
+type ctrlFrame struct {
+	op          byte
+	start, end  []byte
+	height      int
+	unreachable bool
+}
+
+// validator type-checks function bodies, keeping the types of the values
+// on the stack, as in the validation algorithm of the WebAssembly spec.
+type validator struct {
+	vals  []byte
+	ctrls []ctrlFrame
+}
+
+func typeName(t byte) string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	}
+	return "unknown"
+}
+
+func (v *validator) push(t byte) {
+	v.vals = append(v.vals, t)
+}
+
+func (v *validator) pushes(ts []byte) {
+	v.vals = append(v.vals, ts...)
+}
+
+func (v *validator) pop() (byte, error) {
+	f := &v.ctrls[len(v.ctrls)-1]
+	if len(v.vals) == f.height {
+		if f.unreachable {
+			return unknown, nil
+		}
+		return 0, errors.New("type mismatch: stack underflow")
+	}
+	t := v.vals[len(v.vals)-1]
+	v.vals = v.vals[:len(v.vals)-1]
+	return t, nil
+}
+
+func (v *validator) popType(expected byte) (byte, error) {
+	actual, err := v.pop()
+	if err != nil {
+		return 0, err
+	}
+	if actual == unknown {
+		return expected, nil
+	}
+	if actual != expected {
+		return 0, fmt.Errorf("type mismatch: expected %s, got %s", typeName(expected), typeName(actual))
+	}
+	return actual, nil
+}
+
+func (v *validator) pops(ts []byte) error {
+	for j := len(ts) - 1; j >= 0; j-- {
+		if _, err := v.popType(ts[j]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *validator) pushCtrl(op byte, start, end []byte) {
+	v.ctrls = append(v.ctrls, ctrlFrame{op: op, start: start, end: end, height: len(v.vals)})
+	v.pushes(start)
+}
+
+func (v *validator) popCtrl() (ctrlFrame, error) {
+	f := v.ctrls[len(v.ctrls)-1]
+	if err := v.pops(f.end); err != nil {
+		return f, err
+	}
+	if len(v.vals) != f.height {
+		return f, errors.New("type mismatch: values left on the stack at the end of a block")
+	}
+	v.ctrls = v.ctrls[:len(v.ctrls)-1]
+	return f, nil
+}
+
+// labelTypes are the types a branch to the depth-th enclosing block takes:
+// loops are branched back to their start.
+func (v *validator) labelTypes(depth uint64) []byte {
+	f := v.ctrls[len(v.ctrls)-1-int(depth)]
+	if f.op == 0x03 {
+		return f.start
+	}
+	return f.end
+}
+
+// unreachable makes the rest of the block polymorphic in the stack, as
+// after an unconditional branch.
+func (v *validator) unreachable() {
+	f := &v.ctrls[len(v.ctrls)-1]
+	v.vals = v.vals[:f.height]
+	f.unreachable = true
+}
+
+// branch checks the stack has what the depth-th enclosing block takes.
+func (v *validator) branch(depth uint64) error {
+	types := v.labelTypes(depth)
+	if err := v.pops(types); err != nil {
+		return err
+	}
+	v.pushes(types)
+	return nil
+}
+
+// selects type-checks select, of the operands of type t if given.
+func (v *validator) selects(t byte) error {
+	if _, err := v.popType(I32); err != nil {
+		return err
+	}
+	if t != unknown {
+		if err := v.pops([]byte{t, t}); err != nil {
+			return err
+		}
+		v.push(t)
+		return nil
+	}
+	t1, err := v.pop()
+	if err != nil {
+		return err
+	}
+	t2, err := v.pop()
+	if err != nil {
+		return err
+	}
+	if t1 != unknown && t2 != unknown && t1 != t2 {
+		return fmt.Errorf("type mismatch: select of %s and %s", typeName(t2), typeName(t1))
+	}
+	if t1 == unknown {
+		t1 = t2
+	}
+	v.push(t1)
+	return nil
+}
@@ -0,0 +1,245 @@
+package wasm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/plugins/wasm"
+)
+
+func leb(v uint32) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+func vec(items ...[]byte) []byte {
+	return concat(leb(uint32(len(items))), concat(items...))
+}
+
+func sized(b []byte) []byte {
+	return concat(leb(uint32(len(b))), b)
+}
+
+func section(id byte, items ...[]byte) []byte {
+	return concat([]byte{id}, sized(vec(items...)))
+}
+
+func module(sections ...[]byte) []byte {
+	return concat([]byte("\x00asm\x01\x00\x00\x00"), concat(sections...))
+}
+
+func export(name string, index byte) []byte {
+	return concat(sized([]byte(name)), []byte{0x00, index})
+}
+
+var (
+	i64ToI64 = []byte{0x60, 0x01, 0x7E, 0x01, 0x7E}
+	void     = []byte{0x60, 0x00, 0x00}
+	i32ToI32 = []byte{0x60, 0x01, 0x7F, 0x01, 0x7F}
+
+	testModule = module(
+		section(1, i64ToI64, void, i32ToI32),
+		section(3, []byte{0}, []byte{1}, []byte{2}, []byte{2}, []byte{2}, []byte{2}),
+		section(5, []byte{0x01, 0x01, 0x04}),
+		section(7,
+			export("fac", 0),
+			export("spin", 1),
+			export("grow", 2),
+			export("load", 3),
+			export("switch", 4),
+			export("sum", 5),
+		),
+		section(10,
+			// if n == 0 { 1 } else { n * fac(n-1) }
+			sized([]byte{0x00, 0x20, 0x00, 0x50, 0x04, 0x7E, 0x42, 0x01, 0x05, 0x20, 0x00, 0x20, 0x00, 0x42, 0x01, 0x7D, 0x10, 0x00, 0x7E, 0x0B, 0x0B}),
+			// loop forever
+			sized([]byte{0x00, 0x03, 0x40, 0x0C, 0x00, 0x0B, 0x0B}),
+			// memory.grow n
+			sized([]byte{0x00, 0x20, 0x00, 0x40, 0x00, 0x0B}),
+			// i32.load n
+			sized([]byte{0x00, 0x20, 0x00, 0x28, 0x02, 0x00, 0x0B}),
+			// 10, 11 or 12, depending on n
+			sized([]byte{0x00, 0x02, 0x40, 0x02, 0x40, 0x02, 0x40, 0x20, 0x00, 0x0E, 0x02, 0x00, 0x01, 0x02, 0x0B, 0x41, 0x0A, 0x0F, 0x0B, 0x41, 0x0B, 0x0F, 0x0B, 0x41, 0x0C, 0x0B}),
+			// sum of 1..n
+			sized([]byte{0x01, 0x01, 0x7F, 0x02, 0x40, 0x03, 0x40, 0x20, 0x00, 0x45, 0x0D, 0x01, 0x20, 0x01, 0x20, 0x00, 0x6A, 0x21, 0x01, 0x20, 0x00, 0x41, 0x01, 0x6B, 0x21, 0x00, 0x0C, 0x00, 0x0B, 0x0B, 0x20, 0x01, 0x0B}),
+		),
+		section(11, []byte{0x00, 0x41, 0x00, 0x0B, 0x02, 'h', 'i'}),
+	)
+)
+
+func instantiate(t *testing.T, limits wasm.Limits) *wasm.Instance {
+	m, err := wasm.Decode(testModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := wasm.Instantiate(m, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestCall(t *testing.T) {
+	i := instantiate(t, wasm.Limits{Fuel: 100000, MaxPages: 2})
+	for _, c := range []struct {
+		name string
+		arg  uint64
+		want uint64
+	}{
+		{"fac", 0, 1},
+		{"fac", 10, 3628800},
+		{"sum", 100, 5050},
+		{"switch", 0, 10},
+		{"switch", 1, 11},
+		{"switch", 7, 12},
+		{"load", 0, 'h' | 'i'<<8},
+	} {
+		have, err := i.Call(c.name, c.arg)
+		if err != nil {
+			t.Fatalf("%s(%d): %v", c.name, c.arg, err)
+		}
+		if len(have) != 1 || have[0] != c.want {
+			t.Errorf("%s(%d): expected %d, got %v", c.name, c.arg, c.want, have)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	i := instantiate(t, wasm.Limits{Fuel: 1000, MaxPages: 2})
+	if _, err := i.Call("spin"); err != wasm.ErrFuelExhausted {
+		t.Errorf("Expected to run out of fuel, got %v", err)
+	}
+
+	i.Refuel()
+	if have, _ := i.Call("grow", 1); len(have) != 1 || have[0] != 1 {
+		t.Errorf("Expected to grow from 1 page, got %v", have)
+	}
+	if have, _ := i.Call("grow", 1); len(have) != 1 || have[0] != 0xFFFFFFFF {
+		t.Errorf("Expected not to grow past the limit, got %v", have)
+	}
+	if _, err := i.Call("load", 2*64*1024-2); err == nil || !strings.Contains(err.Error(), "out of bounds") {
+		t.Errorf("Expected an out of bounds trap, got %v", err)
+	}
+
+	m, err := wasm.Decode(testModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wasm.Instantiate(m, wasm.Limits{MaxPages: 0}); err == nil {
+		t.Errorf("Expected modules needing more memory than allowed to be refused")
+	}
+}
+
+func TestDecodeRefusesImports(t *testing.T) {
+	_, err := wasm.Decode(module(
+		section(1, void),
+		section(2, concat(sized([]byte("env")), sized([]byte("exit")), []byte{0x00, 0x00})),
+	))
+	if err == nil || !strings.Contains(err.Error(), "imports are not supported") {
+		t.Errorf("Expected imports to be refused, got %v", err)
+	}
+}
+
+// decodeFunc decodes a module of a function of type (i32) -> i32, with an
+// i64 local and the given body, and a table, a memory and an immutable i32
+// global for it to use.
+func decodeFunc(body ...byte) error {
+	_, err := wasm.Decode(module(
+		section(1, void, i32ToI32),
+		section(3, []byte{1}),
+		section(4, []byte{0x70, 0x00, 0x01}),
+		section(5, []byte{0x00, 0x01}),
+		section(6, []byte{0x7F, 0x00, 0x41, 0x00, 0x0B}),
+		section(10, sized(concat([]byte{0x01, 0x01, 0x7E}, body))),
+	))
+	return err
+}
+
+// The cases are of the spec test suite, of the .wast files named.
+func TestDecodeValidatesFunctions(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		body []byte
+		err  string
+	}{
+		// unreached-valid.wast
+		{"polymorphic after unreachable", []byte{0x00, 0x6A, 0x0B}, ""},
+		{"polymorphic after return", []byte{0x20, 0x00, 0x0F, 0x42, 0x00, 0x1A, 0x0B}, ""},
+		{"polymorphic select after br", []byte{0x02, 0x7F, 0x20, 0x00, 0x0C, 0x00, 0x1B, 0x0B, 0x0B}, ""},
+		// loop.wast
+		{"loop result", []byte{0x03, 0x7F, 0x41, 0x01, 0x0B, 0x0B}, ""},
+		// select.wast
+		{"select", []byte{0x20, 0x00, 0x20, 0x00, 0x20, 0x00, 0x1B, 0x0B}, ""},
+		{"select of different types", []byte{0x41, 0x00, 0x42, 0x00, 0x41, 0x01, 0x1B, 0x1A, 0x20, 0x00, 0x0B}, "type mismatch"},
+		// i32.wast
+		{"operand missing", []byte{0x41, 0x00, 0x6A, 0x0B}, "type mismatch"},
+		// func.wast
+		{"result of the wrong type", []byte{0x42, 0x00, 0x0B}, "type mismatch"},
+		{"results left over", []byte{0x41, 0x00, 0x41, 0x00, 0x0B}, "type mismatch"},
+		// local_set.wast
+		{"local of the wrong type", []byte{0x41, 0x00, 0x21, 0x01, 0x20, 0x00, 0x0B}, "type mismatch"},
+		// block.wast
+		{"block without its result", []byte{0x02, 0x7F, 0x0B, 0x0B}, "type mismatch"},
+		// if.wast
+		{"if without else with a result", []byte{0x20, 0x00, 0x04, 0x7F, 0x41, 0x01, 0x0B, 0x0B}, "type mismatch"},
+		{"else of the wrong type", []byte{0x20, 0x00, 0x04, 0x7F, 0x41, 0x00, 0x05, 0x42, 0x00, 0x0B, 0x0B}, "type mismatch"},
+		{"if without a condition", []byte{0x04, 0x40, 0x0B, 0x20, 0x00, 0x0B}, "type mismatch"},
+		// br.wast
+		{"br with the wrong type", []byte{0x02, 0x7F, 0x42, 0x01, 0x0C, 0x00, 0x0B, 0x0B}, "type mismatch"},
+		// br_table.wast
+		{"br_table of different arities", []byte{0x02, 0x40, 0x02, 0x7F, 0x41, 0x00, 0x41, 0x00, 0x0E, 0x01, 0x00, 0x01, 0x0B, 0x1A, 0x0B, 0x20, 0x00, 0x0B}, "type mismatch"},
+		// call.wast
+		{"call without arguments", []byte{0x10, 0x00, 0x0B}, "type mismatch"},
+		// call_indirect.wast
+		{"call_indirect without an index", []byte{0x11, 0x00, 0x00, 0x20, 0x00, 0x0B}, "type mismatch"},
+		// memory_grow.wast
+		{"memory.grow of i64", []byte{0x42, 0x01, 0x40, 0x00, 0x0B}, "type mismatch"},
+		// align.wast
+		{"alignment over natural", []byte{0x20, 0x00, 0x28, 0x03, 0x00, 0x0B}, "alignment must not be larger than natural"},
+		// global.wast
+		{"global.set of immutable", []byte{0x41, 0x00, 0x24, 0x00, 0x20, 0x00, 0x0B}, "global is immutable"},
+	} {
+		err := decodeFunc(c.body...)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: expected to be valid, got %v", c.name, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestDecodeValidatesModules(t *testing.T) {
+	// global.wast
+	_, err := wasm.Decode(module(
+		section(6, []byte{0x7F, 0x00, 0x42, 0x00, 0x0B}),
+	))
+	if err == nil || !strings.Contains(err.Error(), "type mismatch") {
+		t.Errorf("Expected globals initialised with the wrong type to be refused, got %v", err)
+	}
+
+	// start.wast
+	_, err = wasm.Decode(module(
+		section(1, i32ToI32),
+		section(3, []byte{0}),
+		concat([]byte{8}, sized(leb(0))),
+		section(10, sized([]byte{0x00, 0x20, 0x00, 0x0B})),
+	))
+	if err == nil || !strings.Contains(err.Error(), "start function") {
+		t.Errorf("Expected start functions with parameters to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package plugins
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/weaveworks/common/test/fs"
+	"github.com/weaveworks/scope/report"
+)
+
+// sized prefixes b with its length, as an unsigned LEB128.
+func sized(b []byte) []byte {
+	var size []byte
+	for n := len(b); ; n >>= 7 {
+		if n < 0x80 {
+			return append(append(size, byte(n)), b...)
+		}
+		size = append(size, byte(n&0x7F|0x80))
+	}
+}
+
+// wasmModule assembles a module with the given spec, alloc always handing
+// out memory at 1024, and tag running the given code.
+func wasmModule(spec string, tag []byte) string {
+	section := func(id byte, contents ...byte) []byte {
+		return append([]byte{id}, sized(contents)...)
+	}
+	var b []byte
+	for _, s := range [][]byte{
+		[]byte("\x00asm\x01\x00\x00\x00"),
+		section(0, append(sized([]byte(wasmSpecSection)), spec...)...),
+		section(1, 0x02, 0x60, 0x01, 0x7F, 0x01, 0x7F, 0x60, 0x02, 0x7F, 0x7F, 0x01, 0x7E),
+		section(3, 0x02, 0x00, 0x01),
+		section(5, 0x01, 0x00, 0x01),
+		section(7, append(append(append([]byte{0x03},
+			append(sized([]byte("memory")), 0x02, 0x00)...),
+			append(sized([]byte("alloc")), 0x00, 0x00)...),
+			append(sized([]byte("tag")), 0x00, 0x01)...)...),
+		section(10, append([]byte{0x02, 0x05, 0x00, 0x41, 0x80, 0x08, 0x0B}, sized(append([]byte{0x00}, tag...))...)...),
+		section(11, append([]byte{0x01, 0x00, 0x41, 0x00, 0x0B}, sized([]byte(`{"greeting":"hello"}`))...)...),
+	} {
+		b = append(b, s...)
+	}
+	return string(b)
+}
+
+const greeterSpec = `{
+	"label": "Greeter",
+	"topologies": ["container"],
+	"metadata_templates": {"greeting": {"id": "greeting", "label": "Greeting", "from": "latest"}}
+}`
+
+var (
+	// tag returns the greeting in the data segment, at 0
+	greet = []byte{0x42, 0x14, 0x0B}
+	// tag loops forever
+	spin = []byte{0x03, 0x40, 0x0C, 0x00, 0x0B, 0x42, 0x00, 0x0B}
+)
+
+func wasmFile(name, contents string) fs.File {
+	return fs.File{
+		FName:     name,
+		FContents: contents,
+		FStat:     syscall.Stat_t{Mode: syscall.S_IFREG},
+	}
+}
+
+func TestRegistryRunsWASMPlugins(t *testing.T) {
+	setup(
+		t,
+		wasmFile("greeter.wasm", wasmModule(greeterSpec, greet)),
+		wasmFile("spinner.wasm", wasmModule(greeterSpec, spin)),
+		wasmFile("rude.wasm", wasmModule(`{"label": "Rude", "topologies": ["container"]}`, greet)),
+		wasmFile("not-wasm.txt", "hello"),
+	)
+	defer restore(t)
+
+	r := testRegistry(t, "1")
+	defer r.Close()
+	checkLoadedPluginIDs(t, r.ForEach, []string{"greeter", "rude", "spinner"})
+
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(report.MakeNode("c1"))
+	rpt, err := r.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, ok := rpt.Container.Nodes["c1"].Latest.Lookup("greeting"); !ok || have != "hello" {
+		t.Errorf("Expected the container to be greeted, got %q", have)
+	}
+	if _, ok := rpt.Container.MetadataTemplates["greeting"]; !ok {
+		t.Errorf("Expected the greeting to be in the metadata templates")
+	}
+
+	r.ForEach(func(p *Plugin) {
+		switch p.ID {
+		case "greeter":
+			if p.Status != "ok" {
+				t.Errorf("Expected status ok, got %q", p.Status)
+			}
+		case "rude":
+			if !strings.Contains(p.Status, `"greeting" isn't`) || p.errors[ErrorMalformed] != 1 {
+				t.Errorf("Expected undeclared metadata to be refused, got %q", p.Status)
+			}
+		case "spinner":
+			if !strings.Contains(p.Status, "out of fuel") || p.errors[ErrorTimeout] != 1 {
+				t.Errorf("Expected to run out of fuel, got %q", p.Status)
+			}
+		}
+	})
+}
@@ -0,0 +1,9 @@
+package plugins
+
+import (
+	"fmt"
+)
+
+func newInotifyWatcher() (watcher, error) {
+	return nil, fmt.Errorf("inotify is not supported on darwin")
+}
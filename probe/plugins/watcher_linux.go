@@ -0,0 +1,61 @@
+package plugins
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF
+
+// inotifyWatcher tells when entries come and go in the directories it
+// watches.
+type inotifyWatcher struct {
+	fd     int
+	file   *os.File
+	events chan struct{}
+}
+
+func newInotifyWatcher() (watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		fd: fd,
+		// Non-blocking, so Close interrupts the Read in loop
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Add(path string) error {
+	_, err := unix.InotifyAddWatch(w.fd, path, inotifyMask)
+	return err
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+// loop turns inotify events into (coalesced) notifications; which entries
+// changed doesn't matter, as the registry rescans everything anyway.
+func (w *inotifyWatcher) loop() {
+	defer close(w.events)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		if _, err := w.file.Read(buf); err != nil {
+			return
+		}
+		select {
+		case w.events <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -6,7 +6,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/armon/go-metrics"
+	opentracing "github.com/opentracing/opentracing-go"
+	"golang.org/x/net/context"
 
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/probe/appclient"
 	"github.com/weaveworks/scope/report"
 )
@@ -17,8 +20,19 @@ const (
 
 // Probe sits there, generating and publishing reports.
 type Probe struct {
-	spyInterval, publishInterval time.Duration
-	publisher                    *appclient.ReportPublisher
+	publisher *appclient.ReportPublisher
+
+	mtx     sync.Mutex
+	flags   Config            // as configured by flags
+	configs map[string]Config // by source
+	config  Config            // as applied
+
+	fidelityReduced bool // while over the CPU budget
+
+	lastReports map[int]lastReport // by index in reporters
+	stats       stats
+
+	spyReconfigured, publishReconfigured chan struct{}
 
 	tickers   []Ticker
 	reporters []Reporter
@@ -27,8 +41,31 @@ type Probe struct {
 	quit chan struct{}
 	done sync.WaitGroup
 
-	spiedReports    chan report.Report
-	shortcutReports chan report.Report
+	spiedReports    chan tracedReport
+	shortcutReports chan tracedReport
+}
+
+// tracedReport is a report waiting to be published, with the span of
+// making it, if there is one, for publishing it to follow from.
+type tracedReport struct {
+	rpt   report.Report
+	trace opentracing.SpanContext
+}
+
+// lastReport is the last report of a reporter, standing in for it until
+// its interval is up.
+type lastReport struct {
+	rpt report.Report
+	at  time.Time
+}
+
+// stats are how the probe is doing, as the SelfReporter reports.
+type stats struct {
+	reportLatency    time.Duration
+	reporterLatency  map[string]time.Duration // by name
+	publishErrors    int
+	lastPublishError string
+	droppedReports   int
 }
 
 // Tagger tags nodes with value-add node metadata.
@@ -70,13 +107,19 @@ func New(
 	publisher appclient.Publisher,
 	noControls bool,
 ) *Probe {
+	flags := Config{SpyInterval: spyInterval, PublishInterval: publishInterval}
 	result := &Probe{
-		spyInterval:     spyInterval,
-		publishInterval: publishInterval,
-		publisher:       appclient.NewReportPublisher(publisher, noControls),
-		quit:            make(chan struct{}),
-		spiedReports:    make(chan report.Report, reportBufferSize),
-		shortcutReports: make(chan report.Report, reportBufferSize),
+		publisher:           appclient.NewReportPublisher(publisher, noControls),
+		flags:               flags,
+		configs:             map[string]Config{},
+		config:              flags,
+		lastReports:         map[int]lastReport{},
+		stats:               stats{reporterLatency: map[string]time.Duration{}},
+		spyReconfigured:     make(chan struct{}, 1),
+		publishReconfigured: make(chan struct{}, 1),
+		quit:                make(chan struct{}),
+		spiedReports:        make(chan tracedReport, reportBufferSize),
+		shortcutReports:     make(chan tracedReport, reportBufferSize),
 	}
 	return result
 }
@@ -113,22 +156,45 @@ func (p *Probe) Stop() {
 // bypassing the spy tick
 func (p *Probe) Publish(rpt report.Report) {
 	rpt = p.tag(rpt)
-	p.shortcutReports <- rpt
+	p.shortcutReports <- tracedReport{rpt: rpt}
 }
 
 func (p *Probe) spyLoop() {
 	defer p.done.Done()
-	spyTick := time.Tick(p.spyInterval)
+	spyTick := time.NewTicker(p.Config().SpyInterval)
+	defer func() { spyTick.Stop() }()
 
 	for {
 		select {
-		case <-spyTick:
+		case <-spyTick.C:
 			t := time.Now()
+			config := p.Config()
+			span, ctx := opentracing.StartSpanFromContext(context.Background(), "probe.report")
 			p.tick()
-			rpt := p.report()
+			rpt := p.report(ctx, config)
+			tagSpan, _ := opentracing.StartSpanFromContext(ctx, "probe.tag")
 			rpt = p.tag(rpt)
-			p.spiedReports <- rpt
+			tagSpan.Finish()
+			if len(config.Topologies) > 0 {
+				rpt = rpt.OnlyTopologies(config.Topologies)
+			}
+			span.Finish()
+			// Rather than holding up ticks while publishing is stuck
+			select {
+			case p.spiedReports <- tracedReport{rpt: rpt, trace: span.Context()}:
+			default:
+				log.Warnf("Dropped report, as %d are waiting to be published", reportBufferSize)
+				p.mtx.Lock()
+				p.stats.droppedReports++
+				p.mtx.Unlock()
+			}
 			metrics.MeasureSince([]string{"Report Generaton"}, t)
+			p.mtx.Lock()
+			p.stats.reportLatency = time.Since(t)
+			p.mtx.Unlock()
+		case <-p.spyReconfigured:
+			spyTick.Stop()
+			spyTick = time.NewTicker(p.Config().SpyInterval)
 		case <-p.quit:
 			return
 		}
@@ -146,27 +212,65 @@ func (p *Probe) tick() {
 	}
 }
 
-func (p *Probe) report() report.Report {
-	reports := make(chan report.Report, len(p.reporters))
-	for _, rep := range p.reporters {
-		go func(rep Reporter) {
+func (p *Probe) report(ctx context.Context, config Config) report.Report {
+	disabled := map[string]bool{}
+	for _, name := range config.DisabledReporters {
+		disabled[name] = true
+	}
+	var (
+		reporters = map[int]Reporter{}
+		reports   = make(chan report.Report, len(p.reporters))
+		cached    = 0
+		now       = time.Now()
+	)
+	p.mtx.Lock()
+	for i, rep := range p.reporters {
+		if disabled[rep.Name()] {
+			delete(p.lastReports, i)
+			delete(p.stats.reporterLatency, rep.Name())
+			continue
+		}
+		last, ok := p.lastReports[i]
+		if interval := config.ReporterIntervals[rep.Name()]; ok && now.Sub(last.at) < interval {
+			reports <- last.rpt
+			cached++
+			continue
+		}
+		reporters[i] = rep
+	}
+	p.mtx.Unlock()
+
+	for i, rep := range reporters {
+		go func(i int, rep Reporter) {
 			t := time.Now()
-			timer := time.AfterFunc(p.spyInterval, func() { log.Warningf("%v reporter took longer than %v", rep.Name(), p.spyInterval) })
+			span, _ := opentracing.StartSpanFromContext(ctx, "probe.reporter")
+			span.SetTag("reporter", rep.Name())
+			timer := time.AfterFunc(config.SpyInterval, func() { log.Warningf("%v reporter took longer than %v", rep.Name(), config.SpyInterval) })
 			newReport, err := rep.Report()
+			tracing.SetError(span, err)
+			span.Finish()
 			if !timer.Stop() {
-				log.Warningf("%v reporter took %v (longer than %v)", rep.Name(), time.Now().Sub(t), p.spyInterval)
+				log.Warningf("%v reporter took %v (longer than %v)", rep.Name(), time.Now().Sub(t), config.SpyInterval)
 			}
 			metrics.MeasureSince([]string{rep.Name(), "reporter"}, t)
+			p.mtx.Lock()
+			p.stats.reporterLatency[rep.Name()] = time.Since(t)
+			p.mtx.Unlock()
 			if err != nil {
 				log.Errorf("error generating report: %v", err)
 				newReport = report.MakeReport() // empty is OK to merge
+			} else if _, ok := config.ReporterIntervals[rep.Name()]; ok {
+				p.mtx.Lock()
+				p.lastReports[i] = lastReport{rpt: newReport, at: t}
+				p.mtx.Unlock()
 			}
 			reports <- newReport
-		}(rep)
+		}(i, rep)
 	}
 
 	result := report.MakeReport()
-	for i := 0; i < cap(reports); i++ {
+	result.Schema = report.RegisteredMetadataSchema()
+	for i := 0; i < cached+len(reporters); i++ {
 		result = result.Merge(<-reports)
 	}
 	return result
@@ -174,12 +278,13 @@ func (p *Probe) report() report.Report {
 
 func (p *Probe) tag(r report.Report) report.Report {
 	var err error
+	spyInterval := p.Config().SpyInterval
 	for _, tagger := range p.taggers {
 		t := time.Now()
-		timer := time.AfterFunc(p.spyInterval, func() { log.Warningf("%v tagger took longer than %v", tagger.Name(), p.spyInterval) })
+		timer := time.AfterFunc(spyInterval, func() { log.Warningf("%v tagger took longer than %v", tagger.Name(), spyInterval) })
 		r, err = tagger.Tag(r)
 		if !timer.Stop() {
-			log.Warningf("%v tagger took %v (longer than %v)", tagger.Name(), time.Now().Sub(t), p.spyInterval)
+			log.Warningf("%v tagger took %v (longer than %v)", tagger.Name(), time.Now().Sub(t), spyInterval)
 		}
 		metrics.MeasureSince([]string{tagger.Name(), "tagger"}, t)
 		if err != nil {
@@ -189,33 +294,46 @@ func (p *Probe) tag(r report.Report) report.Report {
 	return r
 }
 
-func (p *Probe) drainAndPublish(rpt report.Report, rs chan report.Report) {
+func (p *Probe) drainAndPublish(rpt report.Report, rs chan tracedReport) {
+	traces := []opentracing.SpanContext{}
 ForLoop:
 	for {
 		select {
 		case r := <-rs:
-			rpt = rpt.Merge(r)
+			rpt = rpt.Merge(r.rpt)
+			if r.trace != nil {
+				traces = append(traces, r.trace)
+			}
 		default:
 			break ForLoop
 		}
 	}
 
-	if err := p.publisher.Publish(rpt.BackwardCompatible()); err != nil {
+	if err := p.publisher.Publish(rpt, traces...); err != nil {
 		log.Infof("publish: %v", err)
+		p.mtx.Lock()
+		p.stats.publishErrors++
+		p.stats.lastPublishError = err.Error()
+		p.mtx.Unlock()
 	}
 }
 
 func (p *Probe) publishLoop() {
 	defer p.done.Done()
-	pubTick := time.Tick(p.publishInterval)
+	pubTick := time.NewTicker(p.Config().PublishInterval)
+	defer func() { pubTick.Stop() }()
 
 	for {
 		select {
-		case <-pubTick:
+		case <-pubTick.C:
 			p.drainAndPublish(report.MakeReport(), p.spiedReports)
 
-		case rpt := <-p.shortcutReports:
-			p.drainAndPublish(rpt, p.shortcutReports)
+		case <-p.publishReconfigured:
+			pubTick.Stop()
+			pubTick = time.NewTicker(p.Config().PublishInterval)
+
+		case r := <-p.shortcutReports:
+			p.drainAndPublish(r.rpt, p.shortcutReports)
 
 		case <-p.quit:
 			return
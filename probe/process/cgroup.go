@@ -0,0 +1,50 @@
+package process
+
+import (
+	"strings"
+)
+
+// containerCgroupPrefixes are those the cgroups of containers are named
+// with by the systemd cgroup drivers of container runtimes, as in
+// docker-<id>.scope.
+var containerCgroupPrefixes = []string{"docker-", "cri-containerd-", "crio-", "libpod-"}
+
+// ContainerIDFromCgroup returns the ID of the container of a process, from
+// its /proc/<pid>/cgroup, or "" if it isn't in one. Container runtimes put
+// the processes of containers in cgroups named after them, as in
+// /docker/<id> or /kubepods/burstable/pod<uid>/<id>, whatever namespaces
+// they share with the host, as processes of host-network pods do.
+func ContainerIDFromCgroup(cgroup string) string {
+	id := ""
+	for _, line := range strings.Split(cgroup, "\n") {
+		// hierarchy-ID:controllers:path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, name := range strings.Split(fields[2], "/") {
+			name = strings.TrimSuffix(name, ".scope")
+			for _, prefix := range containerCgroupPrefixes {
+				name = strings.TrimPrefix(name, prefix)
+			}
+			if isContainerID(name) {
+				id = name
+			}
+		}
+	}
+	return id
+}
+
+// isContainerID tells whether s is the full ID of a container: 64 hex
+// digits.
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package process_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/process"
+)
+
+func TestContainerIDFromCgroup(t *testing.T) {
+	const id = "3f2a9c1b7e4d5a6b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b"
+	for _, tc := range []struct {
+		name, cgroup, want string
+	}{
+		{"docker", "12:memory:/docker/" + id + "\n11:cpu:/docker/" + id + "\n", id},
+		{"kubernetes", "4:cpu,cpuacct:/kubepods/burstable/pod8d9e-11e9/" + id + "\n", id},
+		{"systemd", "0::/system.slice/docker-" + id + ".scope\n", id},
+		{"containerd", "0::/kubepods.slice/kubepods-besteffort.slice/cri-containerd-" + id + ".scope\n", id},
+		{"host", "12:memory:/user.slice\n0::/init.scope\n", ""},
+		{"short", "0::/docker/3f2a9c1b7e4d\n", ""},
+		{"empty", "", ""},
+	} {
+		if have := process.ContainerIDFromCgroup(tc.cgroup); have != tc.want {
+			t.Errorf("%s: want %q, have %q", tc.name, tc.want, have)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package process
+
+import "sync/atomic"
+
+// fidelityReduced is non-zero while the probe is over its CPU budget.
+var fidelityReduced int32
+
+// ReduceFidelity has processes walked for less while reduce is set: their
+// file descriptors aren't walked, neither to count them nor to find their
+// connections, and their command line arguments are left out.
+func ReduceFidelity(reduce bool) {
+	var value int32
+	if reduce {
+		value = 1
+	}
+	atomic.StoreInt32(&fidelityReduced, value)
+}
+
+// FidelityReduced tells whether processes are walked for less.
+func FidelityReduced() bool {
+	return atomic.LoadInt32(&fidelityReduced) != 0
+}
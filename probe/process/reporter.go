@@ -36,6 +36,17 @@ var (
 	}
 )
 
+// MetadataSchema describes the metadata keys of processes
+var MetadataSchema = report.MetadataSchema{
+	PID:     {Type: report.Number},
+	PPID:    {Type: report.Number},
+	Threads: {Type: report.Number},
+}
+
+func init() {
+	report.RegisterMetadataSchema(MetadataSchema)
+}
+
 // Reporter generates Reports containing the Process topology.
 type Reporter struct {
 	scope                  string
@@ -96,7 +107,7 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 		}
 
 		if p.Cmdline != "" {
-			if r.noCommandLineArguments {
+			if r.noCommandLineArguments || FidelityReduced() {
 				node = node.WithLatests(map[string]string{Cmdline: strings.Split(p.Cmdline, " ")[0]})
 			} else {
 				node = node.WithLatests(map[string]string{Cmdline: p.Cmdline})
@@ -113,7 +124,9 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 		}
 
 		node = node.WithMetric(MemoryUsage, report.MakeSingletonMetric(now, float64(p.RSSBytes)).WithMax(float64(p.RSSBytesLimit)))
-		node = node.WithMetric(OpenFilesCount, report.MakeSingletonMetric(now, float64(p.OpenFilesCount)).WithMax(float64(p.OpenFilesLimit)))
+		if p.OpenFilesCount >= 0 {
+			node = node.WithMetric(OpenFilesCount, report.MakeSingletonMetric(now, float64(p.OpenFilesCount)).WithMax(float64(p.OpenFilesLimit)))
+		}
 
 		t.AddNode(node)
 	})
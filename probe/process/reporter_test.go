@@ -134,3 +134,18 @@ func TestCmdlineRemoval(t *testing.T) {
 	}
 	testReporter(t, true, test)
 }
+
+func TestReducedFidelity(t *testing.T) {
+	process.ReduceFidelity(true)
+	defer process.ReduceFidelity(false)
+	test := func(rpt report.Report) {
+		node, ok := rpt.Process.Nodes[report.MakeProcessNodeID("", "4")]
+		if !ok {
+			t.Errorf("Expected report to include the pid 4 ping")
+		}
+		if cmdline, ok := node.Latest.Lookup(process.Cmdline); !ok || cmdline != "ping" {
+			t.Errorf("Expected %q got %q", "ping", cmdline)
+		}
+	}
+	testReporter(t, false, test)
+}
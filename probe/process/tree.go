@@ -8,6 +8,7 @@ import (
 type Tree interface {
 	GetParent(pid int) (int, error)
 	GetChildren(pid int) ([]int, error)
+	GetContainerID(pid int) string
 }
 
 type tree struct {
@@ -34,6 +35,12 @@ func (pt *tree) GetParent(pid int) (int, error) {
 	return proc.PPID, nil
 }
 
+// GetContainerID returns the ID of the container of a given pid, from its
+// cgroup, or "" if it isn't known to be in one.
+func (pt *tree) GetContainerID(pid int) string {
+	return pt.processes[pid].ContainerID
+}
+
 // GetChildren
 func (pt *tree) GetChildren(pid int) ([]int, error) {
 	_, ok := pt.processes[pid]
@@ -11,9 +11,10 @@ type Process struct {
 	Jiffies           uint64
 	RSSBytes          uint64
 	RSSBytesLimit     uint64
-	OpenFilesCount    int
+	OpenFilesCount    int // -1 if file descriptors weren't walked
 	OpenFilesLimit    uint64
 	IsWaitingInAccept bool
+	ContainerID       string // from its cgroup, "" if not in a container
 }
 
 // Walker is something that walks the /proc directory
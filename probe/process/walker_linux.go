@@ -31,11 +31,17 @@ var (
 	// key: filename in /proc. Example: "42"
 	// value: two strings separated by a '\0'
 	cmdlineCache = freecache.NewCache(1024 * 16)
+
+	// cgroupCache caches the container IDs of /proc/<pid>/cgroup
+	// key: filename in /proc. Example: "42"
+	// value: the container ID, empty if not in a container
+	cgroupCache = freecache.NewCache(1024 * 16)
 )
 
 const (
 	limitsCacheTimeout  = 60
 	cmdlineCacheTimeout = 60
+	cgroupCacheTimeout  = 60
 )
 
 // NewWalker creates a new process Walker.
@@ -215,9 +221,11 @@ func (w *walker) Walk(f func(Process, Process)) error {
 			continue
 		}
 
-		openFilesCount, err := fs.ReadDirCount(path.Join(w.procRoot, filename, "fd"))
-		if err != nil {
-			continue
+		openFilesCount := -1
+		if !FidelityReduced() {
+			if openFilesCount, err = fs.ReadDirCount(path.Join(w.procRoot, filename, "fd")); err != nil {
+				continue
+			}
 		}
 
 		var openFilesLimit uint64
@@ -243,6 +251,16 @@ func (w *walker) Walk(f func(Process, Process)) error {
 			cmdlineCache.Set([]byte(filename), []byte(fmt.Sprintf("%s\x00%s", cmdline, name)), cmdlineCacheTimeout)
 		}
 
+		var containerID string
+		if v, err := cgroupCache.Get([]byte(filename)); err == nil {
+			containerID = string(v)
+		} else {
+			if buf, err := fs.ReadFile(path.Join(w.procRoot, filename, "cgroup")); err == nil {
+				containerID = ContainerIDFromCgroup(string(buf))
+			}
+			cgroupCache.Set([]byte(filename), []byte(containerID), cgroupCacheTimeout)
+		}
+
 		isWaitingInAccept := false
 		if w.gatheringWaitingInAccept {
 			isWaitingInAccept = IsProcInAccept(w.procRoot, filename)
@@ -260,6 +278,7 @@ func (w *walker) Walk(f func(Process, Process)) error {
 			OpenFilesCount:    openFilesCount,
 			OpenFilesLimit:    openFilesLimit,
 			IsWaitingInAccept: isWaitingInAccept,
+			ContainerID:       containerID,
 		}, Process{})
 	}
 
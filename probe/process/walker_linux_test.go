@@ -10,6 +10,8 @@ import (
 	"github.com/weaveworks/scope/probe/process"
 )
 
+const containerID = "3f2a9c1b7e4d5a6b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b"
+
 var mockFS = fs.Dir("",
 	fs.Dir("proc",
 		fs.Dir("3",
@@ -55,6 +57,10 @@ var mockFS = fs.Dir("",
 				FName:     "limits",
 				FContents: ``,
 			},
+			fs.File{
+				FName:     "cgroup",
+				FContents: "0::/system.slice/docker-" + containerID + ".scope\n",
+			},
 			fs.Dir("fd", fs.File{FName: "0"}),
 		),
 		fs.Dir("notapid"),
@@ -83,7 +89,7 @@ func TestWalker(t *testing.T) {
 	want := map[int]process.Process{
 		3: {PID: 3, PPID: 2, Name: "curl", Cmdline: "curl google.com", Threads: 1, RSSBytes: 8192, RSSBytesLimit: 2048, OpenFilesCount: 3, OpenFilesLimit: 32768},
 		2: {PID: 2, PPID: 1, Name: "bash", Cmdline: "bash", Threads: 1, OpenFilesCount: 2},
-		4: {PID: 4, PPID: 3, Name: "apache", Cmdline: "apache", Threads: 1, OpenFilesCount: 1},
+		4: {PID: 4, PPID: 3, Name: "apache", Cmdline: "apache", Threads: 1, OpenFilesCount: 1, ContainerID: containerID},
 		1: {PID: 1, PPID: 0, Name: "init", Cmdline: "init", Threads: 1, OpenFilesCount: 0},
 	}
 
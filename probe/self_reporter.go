@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Version          = report.ScopeProbeVersion
+	Hostname         = report.ScopeProbeHostname
+	PublishErrors    = report.ScopeProbePublishErrors
+	LastPublishError = report.ScopeProbeLastPublishError
+	DroppedReports   = report.ScopeProbeDroppedReports
+	Reporters        = report.ScopeProbeReporters
+
+	MemoryUsage   = "scope_probe_memory_usage_bytes"
+	CPUUsage      = "scope_probe_cpu_usage_percent"
+	Goroutines    = "scope_probe_goroutines"
+	ReportLatency = "scope_probe_report_latency_ms"
+
+	// ReporterLatencyPrefix is the prefix of the metrics of how long each
+	// reporter takes, by its name.
+	ReporterLatencyPrefix = "scope_probe_reporter_latency_ms_"
+)
+
+// Exposed for testing
+var (
+	SelfMetadataTemplates = report.MetadataTemplates{
+		Hostname:         {ID: Hostname, Label: "Host", From: report.FromLatest, Priority: 1},
+		Version:          {ID: Version, Label: "Version", From: report.FromLatest, Priority: 2},
+		PublishErrors:    {ID: PublishErrors, Label: "Publish Errors", From: report.FromLatest, Datatype: report.Number, Priority: 3},
+		DroppedReports:   {ID: DroppedReports, Label: "Dropped Reports", From: report.FromLatest, Datatype: report.Number, Priority: 4},
+		LastPublishError: {ID: LastPublishError, Label: "Last Publish Error", From: report.FromLatest, Priority: 5},
+		Reporters:        {ID: Reporters, Label: "Reporters", From: report.FromLatest, Priority: 6},
+	}
+
+	SelfMetricTemplates = report.MetricTemplates{
+		CPUUsage:      {ID: CPUUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage:   {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		Goroutines:    {ID: Goroutines, Label: "Goroutines", Format: report.IntegerFormat, Priority: 3},
+		ReportLatency: {ID: ReportLatency, Label: "Report (ms)", Format: report.DefaultFormat, Priority: 4},
+	}
+)
+
+// SelfReporter reports the probe itself, in the ScopeProbe topology: how
+// long reports, and each of its reporters, take, how publishing them goes,
+// and the memory and CPU the probe uses, to troubleshoot probes from scope.
+type SelfReporter struct {
+	probe                     *Probe
+	probeID, hostID, hostname string
+	version                   string
+
+	cpu cpuMeter
+}
+
+// NewSelfReporter makes a new SelfReporter of the probe.
+func NewSelfReporter(p *Probe, probeID, hostID, hostname, version string) *SelfReporter {
+	return &SelfReporter{
+		probe:    p,
+		probeID:  probeID,
+		hostID:   hostID,
+		hostname: hostname,
+		version:  version,
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*SelfReporter) Name() string { return "Scope" }
+
+// Report implements Reporter.
+func (r *SelfReporter) Report() (report.Report, error) {
+	r.probe.mtx.Lock()
+	stats := r.probe.stats
+	reporterLatency := make(map[string]time.Duration, len(stats.reporterLatency))
+	for name, latency := range stats.reporterLatency {
+		reporterLatency[name] = latency
+	}
+	reporters := r.probe.enabledReporters()
+	r.probe.mtx.Unlock()
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	now := mtime.Now()
+	metricTemplates := report.MetricTemplates{}
+	for id, template := range SelfMetricTemplates {
+		metricTemplates[id] = template
+	}
+	metrics := report.Metrics{
+		MemoryUsage:   report.MakeSingletonMetric(now, float64(memStats.Sys)),
+		Goroutines:    report.MakeSingletonMetric(now, float64(runtime.NumGoroutine())),
+		ReportLatency: report.MakeSingletonMetric(now, milliseconds(stats.reportLatency)),
+	}
+	if cpuUsage, ok := r.cpu.usage(now); ok {
+		metrics[CPUUsage] = report.MakeSingletonMetric(now, cpuUsage).WithMax(100 * float64(runtime.NumCPU()))
+	}
+	for name, latency := range reporterLatency {
+		id := ReporterLatencyPrefix + name
+		metrics[id] = report.MakeSingletonMetric(now, milliseconds(latency))
+		metricTemplates[id] = report.MetricTemplate{ID: id, Label: name + " Reporter (ms)", Format: report.DefaultFormat, Priority: 10}
+	}
+
+	latest := map[string]string{
+		Hostname:          r.hostname,
+		Version:           r.version,
+		PublishErrors:     strconv.Itoa(stats.publishErrors),
+		DroppedReports:    strconv.Itoa(stats.droppedReports),
+		Reporters:         strings.Join(reporters, ","),
+		report.HostNodeID: report.MakeHostNodeID(r.hostID),
+	}
+	if stats.lastPublishError != "" {
+		latest[LastPublishError] = stats.lastPublishError
+	}
+
+	result := report.MakeReport()
+	result.ScopeProbe = result.ScopeProbe.
+		WithMetadataTemplates(SelfMetadataTemplates).
+		WithMetricTemplates(metricTemplates)
+	result.ScopeProbe.AddNode(
+		report.MakeNodeWith(report.MakeScopeProbeNodeID(r.probeID), latest).
+			WithMetrics(metrics).
+			WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet(report.MakeHostNodeID(r.hostID)))),
+	)
+	return result, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestSelfReporter(t *testing.T) {
+	p := New(time.Second, time.Second, nil, false)
+	p.stats.reporterLatency["Docker"] = 20 * time.Millisecond
+	p.stats.publishErrors = 2
+	p.stats.lastPublishError = "app unreachable"
+
+	r := NewSelfReporter(p, "probe-id", "host-id", "hostname", "1.2.3")
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, ok := rpt.ScopeProbe.Nodes[report.MakeScopeProbeNodeID("probe-id")]
+	if !ok {
+		t.Fatalf("probe not reported: %v", rpt.ScopeProbe.Nodes)
+	}
+	for key, want := range map[string]string{
+		Hostname:          "hostname",
+		Version:           "1.2.3",
+		PublishErrors:     "2",
+		LastPublishError:  "app unreachable",
+		DroppedReports:    "0",
+		report.HostNodeID: report.MakeHostNodeID("host-id"),
+	} {
+		if have, _ := node.Latest.Lookup(key); have != want {
+			t.Errorf("%s: want %q, have %q", key, want, have)
+		}
+	}
+	for _, id := range []string{MemoryUsage, Goroutines, ReportLatency, ReporterLatencyPrefix + "Docker"} {
+		if _, ok := node.Metrics[id]; !ok {
+			t.Errorf("missing metric %s", id)
+		}
+		if _, ok := rpt.ScopeProbe.MetricTemplates[id]; !ok {
+			t.Errorf("missing metric template %s", id)
+		}
+	}
+	if have, _ := node.Metrics[ReporterLatencyPrefix+"Docker"].LastSample(); have.Value != 20 {
+		t.Errorf("Docker reporter latency %v", have.Value)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizerFactoryNeedsProbesToAuthenticate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name": "alice", "role": "admin", "password": "secret"}]`), 0600))
+
+	flags := appFlags{authMode: "static", authUsersPath: path}
+	_, _, err = authorizerFactory(flags, nil)
+	assert.Error(t, err, "Anonymous probes not refused")
+
+	flags.authProbeToken = "token"
+	_, _, err = authorizerFactory(flags, nil)
+	assert.NoError(t, err)
+
+	flags.authProbeToken = ""
+	flags.tls.CAFile = filepath.Join(dir, "ca.pem")
+	_, _, err = authorizerFactory(flags, nil)
+	assert.NoError(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"regexp"
@@ -21,7 +22,10 @@ import (
 	"github.com/weaveworks/scope/probe/appclient"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/overlay"
+	"github.com/weaveworks/scope/probe/plugins"
 	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/weave/common"
 )
 
@@ -33,11 +37,15 @@ var (
 	probeTokenFlag         = "probe.token"
 	kubernetesPasswordFlag = "probe.kubernetes.password"
 	kubernetesTokenFlag    = "probe.kubernetes.token"
+	probeAdminTokenFlag    = "probe.admin.token"
+	appAdminTokenFlag      = "app.admin.token"
 	sensitiveFlags         = []string{
 		serviceTokenFlag,
 		probeTokenFlag,
 		kubernetesPasswordFlag,
 		kubernetesTokenFlag,
+		probeAdminTokenFlag,
+		appAdminTokenFlag,
 	}
 	colonFinder         = regexp.MustCompile(`[^\\](:)`)
 	unescapeBackslashes = regexp.MustCompile(`\\(.)`)
@@ -95,10 +103,28 @@ type flags struct {
 type probeFlags struct {
 	token                  string
 	httpListen             string
+	adminListen            string
+	adminToken             string
+	adminDumpDir           string
+	tracingURL             string
 	publishInterval        time.Duration
+	publishStream          bool
+	publishCompression     string
+	spillDir               string
+	configFile             string
+	disabledReporters      string
+	reporterIntervals      namedDurationsFlag
+	spillBytes             int64
+	spillMaxAge            time.Duration
 	spyInterval            time.Duration
+	cpuBudget              float64
 	pluginsRoot            string
+	pluginsWASMFuel        int64
+	pluginsWASMMemory      int
 	insecure               bool
+	tls                    xfer.TLSConfig
+	tlsPeerIDs             string
+	signingKeyPath         string
 	logPrefix              string
 	logLevel               string
 	resolver               string
@@ -106,9 +132,19 @@ type probeFlags struct {
 	noControls             bool
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
-
-	useConntrack        bool // Use conntrack for endpoint topo
-	conntrackBufferSize int  // Sie of kernel buffer for conntrack
+	envVarsAllow           string
+	envVarsDeny            string
+	envVarsMaskSecrets     bool
+	clusterName            string
+	externalIPs            string
+	cloudMetadata          bool
+	sensorsEnabled         bool
+	sensorsIPMI            bool
+	diagnosticCommands     diagnosticCommandsFlag
+
+	useConntrack         bool // Use conntrack for endpoint topo
+	conntrackBufferSize  int  // Sie of kernel buffer for conntrack
+	connectionSampleSize int  // Connections of each class to report, 0 for all
 
 	spyProcs    bool // Associate endpoints with processes (must be root)
 	procEnabled bool // Produce process topology & process nodes in endpoint
@@ -123,20 +159,43 @@ type probeFlags struct {
 	kubernetesNodeName     string
 	kubernetesClientConfig kubernetes.ClientConfig
 	kubernetesKubeletPort  uint
+	kubernetesSidecarStats bool
 
 	ecsEnabled       bool
 	ecsCacheSize     int
 	ecsCacheExpiry   time.Duration
 	ecsClusterRegion string
+	ecsAgentURL      string
+
+	nomadEnabled bool
+	nomadAddr    string
+
+	gpuEnabled   bool
+	gpuNvidiaSMI string
 
 	weaveEnabled  bool
 	weaveAddr     string
 	weaveHostname string
+
+	cniCalico            bool
+	cniCalicoctl         string
+	cniCilium            bool
+	cniCiliumSocket      string
+	cniFlannel           bool
+	cniFlannelSubnetFile string
+
+	wireGuardEnabled bool
+	wireGuardTool    string
 }
 
 type appFlags struct {
 	window         time.Duration
 	listen         string
+	streamListen   string
+	adminListen    string
+	adminToken     string
+	adminDumpDir   string
+	tracingURL     string
 	stopTimeout    time.Duration
 	logLevel       string
 	logPrefix      string
@@ -151,8 +210,16 @@ type appFlags struct {
 
 	collectorURL              string
 	s3URL                     string
+	collectorRingURL          string
 	controlRouterURL          string
 	pipeRouterURL             string
+	clusterPeers              string
+	clusterGossipPort         int
+	clusterAPIPort            int
+	clusterAdvertise          string
+	clusterSecretPath         string
+	viewStoreURL              string
+	annotationStoreURL        string
 	natsHostname              string
 	memcachedHostname         string
 	memcachedTimeout          time.Duration
@@ -162,6 +229,50 @@ type appFlags struct {
 	userIDHeader              string
 	externalUI                bool
 	metricsGraphURL           string
+	prometheusRemoteReadURL   string
+	prometheusHistory         time.Duration
+	tracesWindow              time.Duration
+	statsdAddr                string
+	awsELBEnabled             bool
+	awsELBRegion              string
+	awsELBInterval            time.Duration
+	auditWebhookURL           string
+	clockSkewThreshold        time.Duration
+	probeStaleAfter           time.Duration
+	reportLimits              app.ReportLimits
+	maxReportsInFlight        int
+	maxReportsQueued          int
+	controlTimeout            time.Duration
+	controlTimeouts           namedDurationsFlag
+	reportTopologies          string
+	renderWorkers             int
+	anomalySigma              float64
+	externalServicesPath      string
+	alertRulesPath            string
+	alertInterval             time.Duration
+	catalogExportPath         string
+	catalogExportFormat       string
+	catalogExportInterval     time.Duration
+	recordingsDir             string
+	recordingsRetention       time.Duration
+	recordingsMaxSize         int64
+	recordingsInput           bool
+	authMode                  string
+	authUsersPath             string
+	authDefaultRole           string
+	authProbeToken            string
+	oidc                      app.OIDCConfig
+	probeTokensPath           string
+	probeKeysPath             string
+	tls                       xfer.TLSConfig
+	tlsPeerIDs                string
+
+	snapshotsURL                   string
+	snapshotsResolution            time.Duration
+	snapshotsDownsampleAfter       time.Duration
+	snapshotsDownsampledResolution time.Duration
+	snapshotsRetention             time.Duration
+	snapshotsCompaction            time.Duration
 
 	blockProfileRate int
 
@@ -220,6 +331,43 @@ func (c *containerLabelFiltersFlag) toAPITopologyOption(flagValue string, filter
 	return app.MakeAPITopologyOption(filterID, containerFilterTitle, filterFunction(labelKeyValuePair[0], labelKeyValuePair[1]), false), nil
 }
 
+type diagnosticCommandsFlag []host.DiagnosticCommand
+
+func (d *diagnosticCommandsFlag) String() string {
+	return fmt.Sprint([]host.DiagnosticCommand(*d))
+}
+
+func (d *diagnosticCommandsFlag) Set(flagValue string) error {
+	command, err := host.ParseDiagnosticCommand(flagValue)
+	if err != nil {
+		return err
+	}
+	*d = append(*d, command)
+	return nil
+}
+
+type namedDurationsFlag map[string]time.Duration
+
+func (c *namedDurationsFlag) String() string {
+	return fmt.Sprint(map[string]time.Duration(*c))
+}
+
+func (c *namedDurationsFlag) Set(flagValue string) error {
+	nameDuration := strings.SplitN(flagValue, "=", 2)
+	if len(nameDuration) != 2 {
+		return fmt.Errorf("%q isn't in the name=duration format", flagValue)
+	}
+	duration, err := time.ParseDuration(nameDuration[1])
+	if err != nil {
+		return err
+	}
+	if *c == nil {
+		*c = namedDurationsFlag{}
+	}
+	(*c)[nameDuration[0]] = duration
+	return nil
+}
+
 func logCensoredArgs() {
 	var prettyPrintedArgs string
 	// We show the flags followed by the args. This may change the original
@@ -276,14 +424,44 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.probe.token, serviceTokenFlag, "", "Token to authenticate with cloud.weave.works")
 	flag.StringVar(&flags.probe.token, probeTokenFlag, "", "Token to authenticate with cloud.weave.works")
 	flag.StringVar(&flags.probe.httpListen, "probe.http.listen", "", "listen address for HTTP profiling and instrumentation server")
+	flag.StringVar(&flags.probe.adminListen, "probe.admin.address", "", "Listen address of the admin server, serving pprof, expvar and goroutine and heap dumps to those with probe.admin.token, instead of on probe.http.listen (disabled if empty)")
+	flag.StringVar(&flags.probe.adminToken, probeAdminTokenFlag, "", "Token the admin server requires, as a bearer token or basic auth password")
+	flag.StringVar(&flags.probe.adminDumpDir, "probe.admin.dump-dir", "", "Directory to write the dumps the admin server triggers to (sent back if empty)")
+	flag.StringVar(&flags.probe.tracingURL, "probe.tracing.endpoint", "", "OTLP/HTTP endpoint to export spans of generating and publishing reports to, as in http://otel-collector:4318/v1/traces (disabled if empty)")
 	flag.DurationVar(&flags.probe.publishInterval, "probe.publish.interval", 3*time.Second, "publish (output) interval")
+	flag.BoolVar(&flags.probe.publishStream, "probe.publish.stream", false, "Publish reports over a gRPC stream, to apps which offer one, rather than POSTing each of them")
+	flag.StringVar(&flags.probe.publishCompression, "probe.publish.compression", report.SnappyEncoding, "Compression of published reports, for apps which take it (gzip or snappy); others get gzip")
+	flag.StringVar(&flags.probe.spillDir, "probe.spill.dir", "", "Directory to keep reports which couldn't be published in, to replay them once the app is reachable again (disabled if empty)")
+	flag.Int64Var(&flags.probe.spillBytes, "probe.spill.max-bytes", appclient.DefaultSpillBytes, "Bytes of reports to keep in probe.spill.dir per app, dropping the oldest beyond")
+	flag.DurationVar(&flags.probe.spillMaxAge, "probe.spill.max-age", appclient.DefaultSpillMaxAge, "Age of reports kept in probe.spill.dir beyond which they are dropped rather than replayed")
+	flag.StringVar(&flags.probe.disabledReporters, "probe.reporters.disabled", "", "Comma-separated names of reporters to leave out of reports, as in Process,Endpoint")
+	flag.Var(&flags.probe.reporterIntervals, "probe.reporters.interval", "How often a reporter reports, if less often than probe.spy.interval, specified as name=duration. Multiple flags are accepted. Example: --probe.reporters.interval=Docker=1m")
+	flag.StringVar(&flags.probe.configFile, "probe.config.file", "", "JSON file of config applied as it changes, without restarting, overriding flags: spyInterval, publishInterval, disabledReporters and topologies")
 	flag.DurationVar(&flags.probe.spyInterval, "probe.spy.interval", time.Second, "spy (scan) interval")
+	flag.Float64Var(&flags.probe.cpuBudget, "probe.cpu-budget", 0, "Percentage of one CPU the probe may use, beyond which it spies less often, skips walking file descriptors and drops command-line arguments, until its usage subsides (0 to disable)")
 	flag.StringVar(&flags.probe.pluginsRoot, "probe.plugins.root", "/var/run/scope/plugins", "Root directory to search for plugins")
+	flag.Int64Var(&flags.probe.pluginsWASMFuel, "probe.plugins.wasm.fuel", plugins.DefaultWASMLimits.Fuel, "Instructions WASM plugins may run to tag each report")
+	flag.IntVar(&flags.probe.pluginsWASMMemory, "probe.plugins.wasm.memory", int(plugins.DefaultWASMLimits.MaxPages/16), "Memory each WASM plugin may use, in MB")
 	flag.BoolVar(&flags.probe.noControls, "probe.no-controls", false, "Disable controls (e.g. start/stop containers, terminals, logs ...)")
 	flag.BoolVar(&flags.probe.noCommandLineArguments, "probe.omit.cmd-args", false, "Disable collection of command-line arguments")
 	flag.BoolVar(&flags.probe.noEnvironmentVariables, "probe.omit.env-vars", false, "Disable collection of environment variables")
+	flag.StringVar(&flags.probe.envVarsAllow, "probe.env-vars.allow", "", "Only collect the environment variables of containers with names matching these comma separated patterns, e.g. 'JAVA_*,PATH' (empty for all)")
+	flag.StringVar(&flags.probe.envVarsDeny, "probe.env-vars.deny", "", "Don't collect the environment variables of containers with names matching these comma separated patterns, e.g. 'AWS_*'")
+	flag.BoolVar(&flags.probe.envVarsMaskSecrets, "probe.env-vars.mask-secrets", true, "Mask the values of environment variables of containers which look like secrets: passwords, tokens, keys and the passwords of URLs")
+	flag.StringVar(&flags.probe.clusterName, "probe.cluster-name", "", "Name of the cluster this probe runs in, used to group hosts when one app receives reports from several clusters")
+	flag.StringVar(&flags.probe.externalIPs, "probe.external-ips", "", "Comma-separated list of IPs other clusters see this host connecting from, used to stitch cross-cluster connections")
+	flag.BoolVar(&flags.probe.sensorsEnabled, "probe.sensors", false, "Report the temperature, fan and power sensors of the host, from hwmon")
+	flag.BoolVar(&flags.probe.sensorsIPMI, "probe.sensors.ipmi", false, "Also read sensors from the BMC, with ipmitool (requires -probe.sensors)")
+	flag.Var(&flags.probe.diagnosticCommands, "probe.host.diagnostic", "Allow a diagnostic command to be run on the host from the UI, specified as name=command. Multiple flags are accepted. Example: --probe.host.diagnostic='dmesg=dmesg | tail -n 50'")
+	flag.BoolVar(&flags.probe.cloudMetadata, "probe.cloud-metadata", true, "Tag the host with the region, zone and instance type from the EC2, GCE or Azure instance metadata service")
 
 	flag.BoolVar(&flags.probe.insecure, "probe.insecure", false, "(SSL) explicitly allow \"insecure\" SSL connections and transfers")
+	flag.StringVar(&flags.probe.tls.CertFile, "probe.tls.cert", "", "Client certificate (PEM) to present to apps, for mutual TLS. Reloaded when it changes")
+	flag.StringVar(&flags.probe.tls.KeyFile, "probe.tls.key", "", "Key (PEM) of probe.tls.cert")
+	flag.StringVar(&flags.probe.tls.CAFile, "probe.tls.ca", "", "CA bundle (PEM) apps' certificates must be issued by, rather than the usual CAs. Reloaded when it changes")
+	flag.StringVar(&flags.probe.tlsPeerIDs, "probe.tls.app-ids", "", "Comma-separated SPIFFE IDs or trust domains apps' certificates must have, rather than their hostnames. Example: --probe.tls.app-ids=spiffe://example.org/scope-app")
+	flag.DurationVar(&flags.probe.tls.ReloadInterval, "probe.tls.reload", xfer.DefaultTLSReloadInterval, "How often to check the TLS certificate, key and CAs for changes")
+	flag.StringVar(&flags.probe.signingKeyPath, "probe.signing-key", "", "Sign reports and control responses with the ed25519 private key (PEM) in this file, as made by 'openssl genpkey -algorithm ed25519', for apps to verify with app.probe-keys")
 	flag.StringVar(&flags.probe.resolver, "probe.resolver", "", "IP address & port of resolver to use.  Default is to use system resolver.")
 	flag.StringVar(&flags.probe.logPrefix, "probe.log.prefix", "<probe>", "prefix for each log line")
 	flag.StringVar(&flags.probe.logLevel, "probe.log.level", "info", "logging threshold level: debug|info|warn|error|fatal|panic")
@@ -291,6 +469,7 @@ func setupFlags(flags *flags) {
 	// Proc & endpoint
 	flag.BoolVar(&flags.probe.useConntrack, "probe.conntrack", true, "also use conntrack to track connections")
 	flag.IntVar(&flags.probe.conntrackBufferSize, "probe.conntrack.buffersize", 4096*1024, "conntrack buffer size")
+	flag.IntVar(&flags.probe.connectionSampleSize, "probe.connections.sample-size", 0, "Only report a random sample of this many of the connections between each pair of addresses to each port, which the app scales the connection counts it shows back up from (0 to report all)")
 	flag.BoolVar(&flags.probe.spyProcs, "probe.proc.spy", true, "associate endpoints with processes (needs root)")
 	flag.StringVar(&flags.probe.procRoot, "probe.proc.root", "/proc", "location of the proc filesystem")
 	flag.BoolVar(&flags.probe.procEnabled, "probe.processes", true, "produce process topology & include procspied connections")
@@ -319,20 +498,54 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.probe.kubernetesClientConfig.Username, "probe.kubernetes.username", "", "Username for basic authentication to the API server")
 	flag.StringVar(&flags.probe.kubernetesNodeName, "probe.kubernetes.node-name", "", "Name of this node, for filtering pods")
 	flag.UintVar(&flags.probe.kubernetesKubeletPort, "probe.kubernetes.kubelet-port", 10255, "Node-local TCP port for contacting kubelet")
+	flag.BoolVar(&flags.probe.kubernetesClientConfig.LeaderElection, "probe.kubernetes.leader-election", false, "elect a single probe in the cluster, through a Lease, to watch cluster-scoped resources; the others only watch and report the pods on their node")
+	flag.StringVar(&flags.probe.kubernetesClientConfig.LeaseNamespace, "probe.kubernetes.lease-namespace", "weave", "Namespace of the Lease used for leader election")
+	flag.BoolVar(&flags.probe.kubernetesSidecarStats, "probe.kubernetes.sidecar-stats", false, "scrape Istio/Linkerd sidecar proxies for request rate, error rate and latency metrics")
 
 	// AWS ECS
 	flag.BoolVar(&flags.probe.ecsEnabled, "probe.ecs", false, "Collect ecs-related attributes for containers on this node")
 	flag.IntVar(&flags.probe.ecsCacheSize, "probe.ecs.cache.size", 1024*1024, "Max size of cached info for each ECS cluster")
 	flag.DurationVar(&flags.probe.ecsCacheExpiry, "probe.ecs.cache.expiry", time.Hour, "How long to keep cached ECS info")
 	flag.StringVar(&flags.probe.ecsClusterRegion, "probe.ecs.cluster.region", "", "ECS Cluster Region")
+	flag.StringVar(&flags.probe.ecsAgentURL, "probe.ecs.agent", "http://localhost:51678", "URL of the ECS agent introspection API, used to find tasks of containers without ECS labels (empty to disable)")
+
+	// HashiCorp Nomad
+	flag.BoolVar(&flags.probe.nomadEnabled, "probe.nomad", false, "Collect Nomad-related attributes for containers, from the local Nomad agent")
+	flag.StringVar(&flags.probe.nomadAddr, "probe.nomad.addr", "http://localhost:4646", "Address of the local Nomad agent's HTTP API")
+
+	// GPUs
+	flag.BoolVar(&flags.probe.gpuEnabled, "probe.gpu", false, "Report NVIDIA GPUs, and the processes and containers using them")
+	flag.StringVar(&flags.probe.gpuNvidiaSMI, "probe.gpu.nvidia-smi", "nvidia-smi", "Path to the nvidia-smi binary, used to query the NVIDIA driver")
 
 	// Weave
 	flag.StringVar(&flags.probe.weaveAddr, "probe.weave.addr", "127.0.0.1:6784", "IP address & port of the Weave router")
 	flag.StringVar(&flags.probe.weaveHostname, "probe.weave.hostname", "", "Hostname to lookup in WeaveDNS")
 
+	// WireGuard
+	flag.BoolVar(&flags.probe.wireGuardEnabled, "probe.wireguard", false, "Report WireGuard interfaces, and their tunnels as edges between hosts")
+	flag.StringVar(&flags.probe.wireGuardTool, "probe.wireguard.wg", "wg", "Path to the wg binary, used to query WireGuard interfaces")
+
+	// CNI plugins
+	flag.BoolVar(&flags.probe.cniCalico, "probe.cni.calico", false, "Report the IP pools and BGP peers of Calico")
+	flag.StringVar(&flags.probe.cniCalicoctl, "probe.cni.calico.calicoctl", "calicoctl", "Path to the calicoctl binary, used to query Calico")
+	flag.BoolVar(&flags.probe.cniCilium, "probe.cni.cilium", false, "Report the allocation range of Cilium, and the identities of its endpoints")
+	flag.StringVar(&flags.probe.cniCiliumSocket, "probe.cni.cilium.socket", overlay.DefaultCiliumSocket, "Path to the socket of the Cilium agent API")
+	flag.BoolVar(&flags.probe.cniFlannel, "probe.cni.flannel", false, "Report the subnet lease of Flannel")
+	flag.StringVar(&flags.probe.cniFlannelSubnetFile, "probe.cni.flannel.subnet-file", overlay.DefaultFlannelSubnetFile, "Path to the file Flannel writes the subnet lease of the host to")
+
 	// App flags
 	flag.DurationVar(&flags.app.window, "app.window", 15*time.Second, "window")
 	flag.StringVar(&flags.app.listen, "app.http.address", ":"+strconv.Itoa(xfer.AppPort), "webserver listen address")
+	flag.StringVar(&flags.app.adminListen, "app.admin.address", "", "Listen address of the admin server, serving pprof, expvar and goroutine and heap dumps to those with app.admin.token, instead of on the app listener (disabled if empty)")
+	flag.StringVar(&flags.app.adminToken, appAdminTokenFlag, "", "Token the admin server requires, as a bearer token or basic auth password")
+	flag.StringVar(&flags.app.adminDumpDir, "app.admin.dump-dir", "", "Directory to write the dumps the admin server triggers to (sent back if empty)")
+	flag.StringVar(&flags.app.tracingURL, "app.tracing.endpoint", "", "OTLP/HTTP endpoint to export spans of decoding, merging and rendering reports to, as in http://otel-collector:4318/v1/traces (disabled if empty)")
+	flag.StringVar(&flags.app.streamListen, "app.stream.address", "", "Offer probes a gRPC stream to publish their reports on, at this listen address. Example: --app.stream.address=:4041")
+	flag.StringVar(&flags.app.tls.CertFile, "app.tls.cert", "", "Serve HTTPS (and the report stream over TLS) with this certificate (PEM). Reloaded when it changes")
+	flag.StringVar(&flags.app.tls.KeyFile, "app.tls.key", "", "Key (PEM) of app.tls.cert")
+	flag.StringVar(&flags.app.tls.CAFile, "app.tls.client-ca", "", "CA bundle (PEM) probes' client certificates must be issued by, for mutual TLS: probes without one can't publish reports or take controls. Reloaded when it changes")
+	flag.StringVar(&flags.app.tlsPeerIDs, "app.tls.probe-ids", "", "Comma-separated SPIFFE IDs or trust domains probes' client certificates must have. Example: --app.tls.probe-ids=spiffe://example.org")
+	flag.DurationVar(&flags.app.tls.ReloadInterval, "app.tls.reload", xfer.DefaultTLSReloadInterval, "How often to check the TLS certificate, key and client CAs for changes")
 	flag.DurationVar(&flags.app.stopTimeout, "app.stopTimeout", 5*time.Second, "How long to wait for http requests to finish when shutting down")
 	flag.StringVar(&flags.app.logLevel, "app.log.level", "info", "logging threshold level: debug|info|warn|error|fatal|panic")
 	flag.StringVar(&flags.app.logPrefix, "app.log.prefix", "<app>", "prefix for each log line")
@@ -346,10 +559,18 @@ func setupFlags(flags *flags) {
 	flag.Var(&flags.containerLabelFilterFlags, "app.container-label-filter", "Add container label-based view filter, specified as title:label. Multiple flags are accepted. Example: --app.container-label-filter='Database Containers:role=db'")
 	flag.Var(&flags.containerLabelFilterFlagsExclude, "app.container-label-filter-exclude", "Add container label-based view filter that excludes containers with the given label, specified as title:label. Multiple flags are accepted. Example: --app.container-label-filter-exclude='Database Containers:role=db'")
 
-	flag.StringVar(&flags.app.collectorURL, "app.collector", "local", "Collector to use (local, dynamodb, or file/directory)")
+	flag.StringVar(&flags.app.collectorURL, "app.collector", "local", "Collector to use (local, dynamodb, s3, cassandra, postgres, or file/directory)")
 	flag.StringVar(&flags.app.s3URL, "app.collector.s3", "local", "S3 URL to use (when collector is dynamodb)")
+	flag.StringVar(&flags.app.collectorRingURL, "app.collector.ring", "", "Consul URL of the ring to shard reports across replicas by (e.g. consul://consul:8500/collectors), advertising the address of app.consul.inf")
 	flag.StringVar(&flags.app.controlRouterURL, "app.control.router", "local", "Control router to use (local or sqs)")
 	flag.StringVar(&flags.app.pipeRouterURL, "app.pipe.router", "local", "Pipe router to use (local)")
+	flag.StringVar(&flags.app.clusterPeers, "app.cluster.peers", "", "Comma-separated gossip addresses (host:port) of app replicas to cluster with, forwarding controls and pipes to the replica of their probe, so a load balancer needs no sticky sessions (disabled if empty)")
+	flag.IntVar(&flags.app.clusterGossipPort, "app.cluster.gossip-port", app.DefaultClusterGossipPort, "Port app replicas gossip on")
+	flag.IntVar(&flags.app.clusterAPIPort, "app.cluster.api-port", app.DefaultClusterAPIPort, "Port app replicas forward controls and pipes to each other on")
+	flag.StringVar(&flags.app.clusterAdvertise, "app.cluster.advertise", "", "Address other app replicas reach this one on (default a private address of its own)")
+	flag.StringVar(&flags.app.clusterSecretPath, "app.cluster.secret-file", "", "File with the secret app replicas share, to encrypt their gossip and authenticate their calls to each other with (required to cluster apps)")
+	flag.StringVar(&flags.app.viewStoreURL, "app.views", "local", "Where to keep the views users save (local, dynamodb, or file:///directory)")
+	flag.StringVar(&flags.app.annotationStoreURL, "app.annotations", "local", "Where to keep the annotations users leave on nodes and edges (local, or file:///directory)")
 	flag.StringVar(&flags.app.natsHostname, "app.nats", "", "Hostname for NATS service to use for shortcut reports.  If empty, shortcut reporting will be disabled.")
 	flag.StringVar(&flags.app.memcachedHostname, "app.memcached.hostname", "", "Hostname for memcached service to use when caching reports.  If empty, no memcached will be used.")
 	flag.DurationVar(&flags.app.memcachedTimeout, "app.memcached.timeout", 100*time.Millisecond, "Maximum time to wait before giving up on memcached requests.")
@@ -358,11 +579,61 @@ func setupFlags(flags *flags) {
 	flag.IntVar(&flags.app.memcachedCompressionLevel, "app.memcached.compression", gzip.DefaultCompression, "How much to compress reports stored in memcached.")
 	flag.StringVar(&flags.app.userIDHeader, "app.userid.header", "", "HTTP header to use as userid")
 	flag.BoolVar(&flags.app.externalUI, "app.externalUI", false, "Point to externally hosted static UI assets")
+	flag.DurationVar(&flags.app.probeStaleAfter, "app.probe.stale-after", app.DefaultProbeStaleAfter, "Report probes which haven't reported for this long as stale, in their health")
+	flag.DurationVar(&flags.app.clockSkewThreshold, "app.clock-skew-threshold", 10*time.Second, "Flag hosts whose clock is off by more than this, and correct the timestamps of their metrics (0 to disable)")
+	flag.IntVar(&flags.app.reportLimits.MaxSize, "app.reports.max-size", 0, "Reject reports of more than this many bytes, gzipped msgpack (0 for no limit)")
+	flag.IntVar(&flags.app.reportLimits.MaxDecompressedSize, "app.reports.max-decompressed-size", 1<<30, "Reject reports decompressing to more than this many bytes (0 for no limit)")
+	flag.IntVar(&flags.app.reportLimits.MaxNodes, "app.reports.max-nodes", 0, "Reject reports of probes with more than this many nodes (0 for no limit)")
+	flag.IntVar(&flags.app.reportLimits.MaxIDLength, "app.reports.max-id-length", 1024, "Drop nodes of reports with IDs longer than this (0 for no limit)")
+	flag.IntVar(&flags.app.maxReportsInFlight, "app.reports.max-in-flight", 0, "Add at most this many reports at once, queueing the others (0 for no limit)")
+	flag.IntVar(&flags.app.maxReportsQueued, "app.reports.max-queued", 100, "Turn reports away with 429s, asking probes to back off, once this many are queued")
+	flag.DurationVar(&flags.app.controlTimeout, "app.control.timeout", app.DefaultControlTimeout, "How long to retry controls for, as probes reconnect, before giving up")
+	flag.Var(&flags.app.controlTimeouts, "app.control.timeouts", "How long to retry a control for, specified as name=duration, overriding -app.control.timeout. Multiple flags are accepted. Example: --app.control.timeouts=docker_stop_container=1m")
+	flag.StringVar(&flags.app.reportTopologies, "app.reports.topologies", "", "Comma-separated topologies, plugin topologies included, reports may have nodes in; others are dropped (empty for any). Example: --app.reports.topologies=endpoint,process,container,host")
+	flag.StringVar(&flags.app.externalServicesPath, "app.external-services", "", "JSON file listing external services, as {name, cidrs, hostnames}, to render the endpoints they have as nodes of their own, ahead of the built-in cloud services")
+	flag.IntVar(&flags.app.renderWorkers, "app.render.workers", 0, "How many goroutines may render stages of topologies in parallel (0 for as many as there are CPUs)")
+	flag.Float64Var(&flags.app.anomalySigma, "app.anomalies.sigma", 0, "Mark nodes whose CPU, memory or connection count deviates by more than this many standard deviations from its baseline as anomalous (0 to disable)")
+	flag.StringVar(&flags.app.auditWebhookURL, "app.audit.webhook", "", "URL to POST an audit record to, as JSON, for every Kubernetes control executed through the app")
+	flag.StringVar(&flags.app.alertRulesPath, "app.alerts.rules", "", "Keep alerting rules in this JSON file, rather than just in memory")
+	flag.DurationVar(&flags.app.alertInterval, "app.alerts.interval", 15*time.Second, "How often to evaluate alerting rules (0 to disable alerting)")
+	flag.StringVar(&flags.app.catalogExportPath, "app.catalog-export.path", "", "Export the dependency graph of the services seen to this file, or POST it to this http(s) URL, for service catalogs")
+	flag.StringVar(&flags.app.catalogExportFormat, "app.catalog-export.format", app.CatalogFormatBackstage, "Format of the exported service dependency graph: backstage (catalog-info entities) or json")
+	flag.DurationVar(&flags.app.catalogExportInterval, "app.catalog-export.interval", 5*time.Minute, "How often to export the service dependency graph (0 to disable exporting)")
+	flag.StringVar(&flags.app.recordingsDir, "app.recordings", "", "Record the terminal sessions of container attach and exec as asciicasts in this directory (needs the local pipe router)")
+	flag.DurationVar(&flags.app.recordingsRetention, "app.recordings.retention", 30*24*time.Hour, "Delete recorded terminal sessions older than this (0 to keep them forever)")
+	flag.Int64Var(&flags.app.recordingsMaxSize, "app.recordings.max-size", 64<<20, "Stop recording terminal sessions at this many bytes (0 for no limit)")
+	flag.BoolVar(&flags.app.recordingsInput, "app.recordings.input", false, "Record what users type in terminal sessions, as well as the output (passwords included)")
+	flag.StringVar(&flags.app.authMode, "app.auth", "", "Make users authenticate, and only let them do what their roles allow: static (HTTP basic authentication with the passwords in app.auth.users) or oidc (log in with an OpenID Connect provider). Only for a single tenant")
+	flag.StringVar(&flags.app.authUsersPath, "app.auth.users", "users.json", "JSON file of the users, their roles (viewer, operator or admin) and passwords, which admins manage through /api/users. Passwords in clear are hashed on loading")
+	flag.StringVar(&flags.app.authDefaultRole, "app.auth.default-role", "", "Role of users authenticated by the OpenID Connect provider but not in app.auth.users (empty to deny them)")
+	flag.StringVar(&flags.app.authProbeToken, "app.auth.probe-token", "", "Token probes need to authenticate with (their probe.token), when users need to authenticate. Needed unless probes have tokens from app.probe-tokens or client certificates")
+	flag.StringVar(&flags.app.oidc.IssuerURL, "app.auth.oidc.issuer", "", "URL of the OpenID Connect provider")
+	flag.StringVar(&flags.app.oidc.ClientID, "app.auth.oidc.client-id", "", "Client ID of the app with the OpenID Connect provider")
+	flag.StringVar(&flags.app.oidc.ClientSecret, "app.auth.oidc.client-secret", "", "Client secret of the app with the OpenID Connect provider")
+	flag.StringVar(&flags.app.oidc.RedirectURL, "app.auth.oidc.redirect-url", "", "URL of /oidc/callback on the app, as users reach it. Example: --app.auth.oidc.redirect-url=https://scope.example.com/oidc/callback")
+	flag.StringVar(&flags.app.oidc.Claim, "app.auth.oidc.claim", "email", "Claim of the OpenID Connect provider naming users in app.auth.users")
+	flag.DurationVar(&flags.app.oidc.SessionLength, "app.auth.oidc.session", 12*time.Hour, "How long users stay logged in")
+	flag.StringVar(&flags.app.oidc.SessionKey, "app.auth.oidc.session-key", "", "Secret signing session cookies, for users to stay logged in when the app restarts (random if empty)")
+	flag.StringVar(&flags.app.probeTokensPath, "app.probe-tokens", "", "Let admins mint tokens for probes on some hosts or in some clusters through /api/probe-tokens, kept in this JSON file, and reject reports published with them once revoked or expired. Only for a single tenant")
+	flag.StringVar(&flags.app.probeKeysPath, "app.probe-keys", "", "Only take reports and control responses signed by one of the ed25519 public keys (PEM) in this file, as made by 'openssl pkey -pubout' from probes' probe.signing-key")
 	flag.StringVar(&flags.app.metricsGraphURL, "app.metrics-graph", "", "Enable extended metrics graph by providing a templated URL (supports :orgID and :query). Example: --app.metric-graph=/prom/:orgID/notebook/new")
+	flag.StringVar(&flags.app.prometheusRemoteReadURL, "app.prometheus.remote-read", "", "Backfill the metrics of nodes from the remote read API of a Prometheus at this URL. Example: --app.prometheus.remote-read=http://prometheus:9090/api/v1/read")
+	flag.DurationVar(&flags.app.prometheusHistory, "app.prometheus.history", 1*time.Hour, "How much history to backfill the metrics of nodes with, from Prometheus")
+	flag.StringVar(&flags.app.statsdAddr, "app.statsd.addr", "", "Listen for StatsD/DogStatsD metrics on this UDP address, and show those tagged with container_id or pod_uid on their container or pod. Example: --app.statsd.addr=:8125")
+	flag.StringVar(&flags.app.snapshotsURL, "app.snapshots", "", "Snapshot merged reports into a directory (file:///path) or S3 bucket (s3://key:secret@host/bucket), so the UI can travel back in time through them. Examples: --app.snapshots=file:///var/lib/scope/snapshots --app.snapshots=s3://abc:123@s3.amazonaws.com/scope-snapshots")
+	flag.DurationVar(&flags.app.snapshotsResolution, "app.snapshots.resolution", 1*time.Minute, "How often to snapshot reports into app.snapshots")
+	flag.DurationVar(&flags.app.snapshotsDownsampleAfter, "app.snapshots.downsample-after", 24*time.Hour, "Downsample snapshots older than this, to their edges and the last samples of their metrics (0 to disable)")
+	flag.DurationVar(&flags.app.snapshotsDownsampledResolution, "app.snapshots.downsampled-resolution", 1*time.Hour, "Keep one downsampled snapshot every this")
+	flag.DurationVar(&flags.app.snapshotsRetention, "app.snapshots.retention", 0, "Delete snapshots older than this (0 to keep them forever)")
+	flag.DurationVar(&flags.app.snapshotsCompaction, "app.snapshots.compaction-interval", 1*time.Hour, "How often to downsample and delete snapshots")
+	flag.BoolVar(&flags.app.awsELBEnabled, "app.aws-elb", false, "Render the inbound connections of AWS load balancers (classic, application and network) as the load balancers, with their listeners, target health and Route53 hostnames, rather than the Internet. Not for multitenant apps")
+	flag.StringVar(&flags.app.awsELBRegion, "app.aws-elb.region", "", "Region of the load balancers (default: the region of the instance)")
+	flag.DurationVar(&flags.app.awsELBInterval, "app.aws-elb.interval", time.Minute, "How often to list the load balancers")
+	flag.DurationVar(&flags.app.tracesWindow, "app.traces.window", 0, "Accept OpenTelemetry traces (OTLP/HTTP, JSON encoded) on /v1/traces, and show the request rate and latency of the last window of them on edges (0 to disable)")
 
 	flag.IntVar(&flags.app.blockProfileRate, "app.block.profile.rate", 0, "If more than 0, enable block profiling. The profiler aims to sample an average of one blocking event per rate nanoseconds spent blocked.")
 
-	flag.BoolVar(&flags.app.awsCreateTables, "app.aws.create.tables", false, "Create the tables in DynamoDB")
+	flag.BoolVar(&flags.app.awsCreateTables, "app.aws.create.tables", false, "Create the tables in DynamoDB, Cassandra or Postgres")
 	flag.StringVar(&flags.app.consulInf, "app.consul.inf", "", "The interface who's address I should advertise myself under in consul")
 }
 
@@ -403,6 +674,24 @@ func main() {
 			log.Fatalf("Invalid value for -probe.http.address: %v", err)
 		}
 	}
+	if flags.probe.adminListen != "" && flags.probe.adminToken == "" {
+		log.Fatalf("-probe.admin.address needs -%s", probeAdminTokenFlag)
+	}
+	if flags.app.adminListen != "" && flags.app.adminToken == "" {
+		log.Fatalf("-app.admin.address needs -%s", appAdminTokenFlag)
+	}
+	if flags.probe.tlsPeerIDs != "" {
+		flags.probe.tls.PeerIDs = strings.Split(flags.probe.tlsPeerIDs, ",")
+	}
+	if flags.app.tlsPeerIDs != "" {
+		flags.app.tls.PeerIDs = strings.Split(flags.app.tlsPeerIDs, ",")
+	}
+	if flags.app.reportTopologies != "" {
+		flags.app.reportLimits.Topologies = strings.Split(flags.app.reportTopologies, ",")
+	}
+	if _, err := report.NewCompressor(ioutil.Discard, flags.probe.publishCompression); err != nil {
+		log.Fatalf("Invalid value for -probe.publish.compression: %v", err)
+	}
 
 	// Special case probe push address parsing
 	targets := []appclient.Target{}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
 	"net"
 	"net/http"
@@ -8,16 +9,20 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/armon/go-metrics"
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/weaveworks/common/network"
 	"github.com/weaveworks/common/sanitize"
 	"github.com/weaveworks/go-checkpoint"
+	"github.com/weaveworks/scope/common/diagnostics"
 	"github.com/weaveworks/scope/common/hostname"
+	"github.com/weaveworks/scope/common/tracing"
 	"github.com/weaveworks/scope/common/weave"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe"
@@ -26,10 +31,13 @@ import (
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/gpu"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/nomad"
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/plugins"
+	"github.com/weaveworks/scope/probe/plugins/wasm"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/weave/common"
@@ -78,17 +86,52 @@ func checkNewScopeVersion(flags probeFlags) {
 func maybeExportProfileData(flags probeFlags) {
 	if flags.httpListen != "" {
 		go func() {
-			http.Handle("/metrics", prometheus.Handler())
-			log.Infof("Profiling data being exported to %s", flags.httpListen)
-			log.Infof("go tool pprof http://%s/debug/pprof/{profile,heap,block}", flags.httpListen)
-			log.Infof("Profiling endpoint %s terminated: %v", flags.httpListen, http.ListenAndServe(flags.httpListen, nil))
+			// Profiling data is only served here, by the pprof routes on the
+			// http.DefaultServeMux, when there's no admin listener to serve
+			// it to those with its token
+			mux := http.DefaultServeMux
+			if flags.adminListen != "" {
+				mux = http.NewServeMux()
+			}
+			mux.Handle("/metrics", prometheus.Handler())
+			if flags.adminListen == "" {
+				log.Infof("Profiling data being exported to %s", flags.httpListen)
+				log.Infof("go tool pprof http://%s/debug/pprof/{profile,heap,block}", flags.httpListen)
+			}
+			log.Infof("Profiling endpoint %s terminated: %v", flags.httpListen, http.ListenAndServe(flags.httpListen, mux))
 		}()
 	}
+	if flags.adminListen != "" {
+		go func() {
+			log.Errorf("Admin server %s terminated: %v", flags.adminListen, diagnostics.ListenAndServe(flags.adminListen, flags.adminToken, flags.adminDumpDir))
+		}()
+	}
+}
+
+// parseExternalIPs parses the comma-separated IPs of probe.external-ips.
+func parseExternalIPs(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ips []string
+	for _, ip := range strings.Split(s, ",") {
+		ip = strings.TrimSpace(ip)
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid IP %q", ip)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
 }
 
 // Main runs the probe
 func probeMain(flags probeFlags, targets []appclient.Target) {
 	setLogLevel(flags.logLevel)
+	externalIPs, err := parseExternalIPs(flags.externalIPs)
+	if err != nil {
+		log.Fatalf("Error parsing probe.external-ips: %v", err)
+		return
+	}
 	setLogFormatter(flags.logPrefix)
 
 	// Setup in memory metrics sink
@@ -110,8 +153,40 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 		hostID   = hostName // TODO(pb): we should sanitize the hostname
 	)
 	log.Infof("probe starting, version %s, ID %s", version, probeID)
+	if flags.tracingURL != "" {
+		tracer := tracing.NewTracer(flags.tracingURL, map[string]string{
+			"service.name":        "scope-probe",
+			"service.version":     version,
+			"service.instance.id": probeID,
+			"host.name":           hostName,
+		})
+		opentracing.InitGlobalTracer(tracer)
+		defer tracer.Close()
+	}
 	checkNewScopeVersion(flags)
 
+	// Probes present the same certificate to all apps
+	var tlsCerts *xfer.TLSCertificates
+	if flags.tls.CertFile != "" || flags.tls.CAFile != "" || len(flags.tls.PeerIDs) > 0 {
+		var err error
+		tlsCerts, err = xfer.NewTLSCertificates(flags.tls)
+		if err != nil {
+			log.Fatalf("Error loading TLS certificates: %v", err)
+			return
+		}
+		defer tlsCerts.Stop()
+	}
+
+	var signer *xfer.Signer
+	if flags.signingKeyPath != "" {
+		var err error
+		signer, err = xfer.LoadSigner(flags.signingKeyPath)
+		if err != nil {
+			log.Fatalf("Error loading signing key: %v", err)
+			return
+		}
+	}
+
 	handlerRegistry := controls.NewDefaultHandlerRegistry()
 	clientFactory := func(hostname string, url url.URL) (appclient.AppClient, error) {
 		token := flags.token
@@ -124,6 +199,13 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 			ProbeVersion: version,
 			ProbeID:      probeID,
 			Insecure:     flags.insecure,
+			ReportStream: flags.publishStream,
+			Encoding:     flags.publishCompression,
+			TLS:          tlsCerts,
+			Signer:       signer,
+			SpillDir:     flags.spillDir,
+			SpillBytes:   flags.spillBytes,
+			SpillMaxAge:  flags.spillMaxAge,
 		}
 		return appclient.NewAppClient(
 			probeConfig, hostname, url,
@@ -134,13 +216,27 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	defer clients.Stop()
 
 	dnsLookupFn := net.LookupIP
+	var srvLookupFn func(string) ([]*net.SRV, error)
 	if flags.resolver != "" {
 		dnsLookupFn = appclient.LookupUsing(flags.resolver)
+		srvLookupFn = appclient.LookupSRVUsing(flags.resolver)
+	}
+	var serviceEndpoints kubernetes.ServiceEndpoints
+	for _, t := range targets {
+		if t.Discovery() == appclient.KubernetesDiscovery {
+			var err error
+			if serviceEndpoints, err = kubernetes.NewServiceEndpoints(flags.kubernetesClientConfig); err != nil {
+				log.Fatalf("Failed to discover apps in Kubernetes: %v", err)
+			}
+			break
+		}
 	}
 	resolver, err := appclient.NewResolver(appclient.ResolverConfig{
-		Targets: targets,
-		Lookup:  dnsLookupFn,
-		Set:     clients.Set,
+		Targets:       targets,
+		Lookup:        dnsLookupFn,
+		LookupSRV:     srvLookupFn,
+		LookupService: serviceEndpoints,
+		Set:           clients.Set,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create resolver: %v", err)
@@ -149,11 +245,43 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	defer resolver.Stop()
 
 	p := probe.New(flags.spyInterval, flags.publishInterval, clients, flags.noControls)
+	handlerRegistry.Register(probe.ConfigureControl, p.ConfigureControl)
+	if flags.disabledReporters != "" || len(flags.reporterIntervals) > 0 {
+		var disabled []string
+		if flags.disabledReporters != "" {
+			disabled = strings.Split(flags.disabledReporters, ",")
+		}
+		p.ConfigureReporters(disabled, flags.reporterIntervals)
+	}
+	if flags.configFile != "" {
+		configFile, err := probe.NewConfigFile(flags.configFile, p)
+		if err != nil {
+			log.Fatalf("Error applying probe config: %v", err)
+			return
+		}
+		defer configFile.Stop()
+	}
+	if flags.cpuBudget > 0 {
+		p.AddTicker(probe.NewCPUBudget(p, flags.cpuBudget, process.ReduceFidelity))
+	}
 
-	hostReporter := host.NewReporter(hostID, hostName, probeID, version, clients, handlerRegistry)
+	hostReporter := host.NewReporter(hostID, hostName, probeID, version, flags.clusterName, externalIPs, clients, handlerRegistry)
 	defer hostReporter.Stop()
-	p.AddReporter(hostReporter)
+	p.AddReporter(hostReporter, probe.NewSelfReporter(p, probeID, hostID, hostName, version))
 	p.AddTagger(probe.NewTopologyTagger(), host.NewTagger(hostID))
+	if len(flags.diagnosticCommands) > 0 {
+		diagnosticsReporter := host.NewDiagnosticsReporter(hostID, flags.diagnosticCommands, clients, handlerRegistry)
+		defer diagnosticsReporter.Stop()
+		p.AddReporter(diagnosticsReporter)
+	}
+	if flags.sensorsEnabled {
+		p.AddReporter(host.NewSensorReporter(hostID, flags.sensorsIPMI))
+	}
+	if flags.cloudMetadata {
+		cloudTagger := host.NewCloudTagger(hostID)
+		defer cloudTagger.Stop()
+		p.AddTagger(cloudTagger)
+	}
 
 	var processCache *process.CachingWalker
 	if flags.procEnabled {
@@ -180,6 +308,7 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 		BufferSize:   flags.conntrackBufferSize,
 		ProcessCache: processCache,
 		DNSSnooper:   dnsSnooper,
+		SampleSize:   flags.connectionSampleSize,
 	})
 	defer endpointReporter.Stop()
 	p.AddReporter(endpointReporter)
@@ -192,6 +321,10 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 				log.Errorf("Docker: problem with bridge %s: %v", flags.dockerBridge, err)
 			}
 		}
+		envFilter, err := docker.NewEnvFilter(flags.envVarsAllow, flags.envVarsDeny, flags.envVarsMaskSecrets)
+		if err != nil {
+			log.Fatalf("Docker: %v", err)
+		}
 		options := docker.RegistryOptions{
 			Interval:               flags.dockerInterval,
 			Pipes:                  clients,
@@ -200,6 +333,8 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 			HandlerRegistry:        handlerRegistry,
 			NoCommandLineArguments: flags.noCommandLineArguments,
 			NoEnvironmentVariables: flags.noEnvironmentVariables,
+			EnvFilter:              envFilter,
+			ShortLived:             flags.publishInterval,
 		}
 		if registry, err := docker.NewRegistry(options); err == nil {
 			defer registry.Stop()
@@ -207,18 +342,30 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 				p.AddTagger(docker.NewTagger(registry, processCache))
 			}
 			p.AddReporter(docker.NewReporter(registry, hostID, probeID, p))
+			if swarmClient, err := docker.NewSwarmClientStub(""); err == nil {
+				swarmReporter := docker.NewSwarmReporter(swarmClient, probeID, handlerRegistry)
+				defer swarmReporter.Stop()
+				p.AddReporter(swarmReporter)
+			} else {
+				log.Errorf("Docker: failed to start swarm client: %v", err)
+			}
 		} else {
 			log.Errorf("Docker: failed to start registry: %v", err)
 		}
 	}
 
 	if flags.kubernetesEnabled {
+		flags.kubernetesClientConfig.NodeName = flags.kubernetesNodeName
+		flags.kubernetesClientConfig.Identity = probeID
 		if client, err := kubernetes.NewClient(flags.kubernetesClientConfig); err == nil {
 			defer client.Stop()
 			reporter := kubernetes.NewReporter(client, clients, probeID, hostID, p, handlerRegistry, flags.kubernetesNodeName, flags.kubernetesKubeletPort)
 			defer reporter.Stop()
 			p.AddReporter(reporter)
 			p.AddTagger(reporter)
+			if flags.kubernetesSidecarStats {
+				p.AddReporter(kubernetes.NewSidecarStatsReporter(client, flags.kubernetesNodeName))
+			}
 		} else {
 			log.Errorf("Kubernetes: failed to start client: %v", err)
 			log.Errorf("Kubernetes: make sure to run Scope inside a POD with a service account or provide valid probe.kubernetes.* flags")
@@ -226,12 +373,24 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	}
 
 	if flags.ecsEnabled {
-		reporter := awsecs.Make(flags.ecsCacheSize, flags.ecsCacheExpiry, flags.ecsClusterRegion, handlerRegistry, probeID)
+		reporter := awsecs.Make(flags.ecsCacheSize, flags.ecsCacheExpiry, flags.ecsClusterRegion, handlerRegistry, probeID, flags.ecsAgentURL)
 		defer reporter.Stop()
 		p.AddReporter(reporter)
 		p.AddTagger(reporter)
 	}
 
+	if flags.nomadEnabled {
+		reporter := nomad.NewReporter(nomad.NewClient(flags.nomadAddr))
+		p.AddReporter(reporter)
+		p.AddTagger(reporter)
+	}
+
+	if flags.gpuEnabled {
+		reporter := gpu.NewReporter(gpu.NewClient(flags.gpuNvidiaSMI), hostID)
+		p.AddReporter(reporter)
+		p.AddTagger(reporter)
+	}
+
 	if flags.weaveEnabled {
 		client := weave.NewClient(sanitize.URL("http://", 6784, "")(flags.weaveAddr))
 		weave, err := overlay.NewWeave(hostID, client)
@@ -268,13 +427,41 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 		}
 	}
 
+	if flags.wireGuardEnabled {
+		wireGuard := overlay.NewWireGuard(hostID, overlay.NewWireGuardClient(flags.wireGuardTool))
+		defer wireGuard.Stop()
+		p.AddReporter(wireGuard)
+	}
+
+	var cnis []overlay.CNI
+	if flags.cniCalico {
+		cnis = append(cnis, overlay.NewCalico(flags.cniCalicoctl))
+	}
+	if flags.cniCilium {
+		cnis = append(cnis, overlay.NewCilium(flags.cniCiliumSocket))
+	}
+	if flags.cniFlannel {
+		cnis = append(cnis, overlay.NewFlannel(flags.cniFlannelSubnetFile))
+	}
+	for _, cni := range cnis {
+		cniReporter := overlay.NewCNIReporter(hostID, cni)
+		defer cniReporter.Stop()
+		p.AddTagger(cniReporter)
+		p.AddReporter(cniReporter)
+	}
+
 	pluginRegistry, err := plugins.NewRegistry(
+		hostID,
 		flags.pluginsRoot,
 		pluginAPIVersion,
 		map[string]string{
 			"probe_id":    probeID,
 			"api_version": pluginAPIVersion,
 		},
+		wasm.Limits{
+			Fuel:     flags.pluginsWASMFuel,
+			MaxPages: uint32(flags.pluginsWASMMemory * 16),
+		},
 		handlerRegistry,
 		p,
 	)
@@ -283,6 +470,7 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	} else {
 		defer pluginRegistry.Close()
 		p.AddReporter(pluginRegistry)
+		p.AddTagger(pluginRegistry)
 	}
 
 	maybeExportProfileData(flags)
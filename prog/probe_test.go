@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExternalIPs(t *testing.T) {
+	ips, err := parseExternalIPs("")
+	assert.NoError(t, err)
+	assert.Empty(t, ips)
+
+	ips, err = parseExternalIPs("203.0.113.1, 2001:db8::1 ")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.1", "2001:db8::1"}, ips)
+
+	_, err = parseExternalIPs("203.0.113.1,example.com")
+	assert.Error(t, err, "Invalid external IP not detected")
+
+	_, err = parseExternalIPs("203.0.113.1,")
+	assert.Error(t, err, "Empty external IP not detected")
+}
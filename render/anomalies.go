@@ -0,0 +1,247 @@
+package render
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// Anomalies is the set of rendered nodes naming what of them deviates from
+// its baseline: AnomalyCPU, AnomalyMemory and AnomalyConnections.
+const Anomalies = "anomalies"
+
+// What of nodes can be anomalous
+const (
+	AnomalyCPU         = "cpu"
+	AnomalyMemory      = "memory"
+	AnomalyConnections = "connections"
+)
+
+const (
+	// anomalyAlpha is the weight of each report window in baselines.
+	anomalyAlpha = 0.1
+	// anomalyWarmup is how many windows make a baseline before values
+	// are told anomalous by it.
+	anomalyWarmup = 5
+	// anomalyMinDeviation is the least deviation of baselines, relative
+	// to their mean, so steady values aren't anomalous for any change.
+	anomalyMinDeviation = 0.05
+	// anomalyStaleWindows is how many windows baselines of nodes not
+	// rendered are kept for.
+	anomalyStaleWindows = 10
+	// anomalyStaleScope is how long baselines of scopes not rendered
+	// are kept for.
+	anomalyStaleScope = time.Hour
+)
+
+var (
+	cpuMetrics    = map[string]bool{process.CPUUsage: true, docker.CPUTotalUsage: true, host.CPUUsage: true}
+	memoryMetrics = map[string]bool{process.MemoryUsage: true, docker.MemoryUsage: true, host.MemoryUsage: true}
+)
+
+// baseline is the exponentially weighted moving mean and variance of a
+// value of a node, over report windows. The value of the current window
+// is only folded in once the window is over, so a window rendered again is
+// told anomalous the same way.
+type baseline struct {
+	mean, variance float64
+	windows        int
+	value          float64
+	window         int // of value
+}
+
+func (b *baseline) observe(value float64, window int) {
+	if b.window != window && b.window > 0 {
+		b.fold(b.value)
+	}
+	b.value, b.window = value, window
+}
+
+func (b *baseline) fold(value float64) {
+	if b.windows == 0 {
+		b.mean = value
+	} else {
+		diff := value - b.mean
+		incr := anomalyAlpha * diff
+		b.mean += incr
+		b.variance = (1 - anomalyAlpha) * (b.variance + diff*incr)
+	}
+	b.windows++
+}
+
+func (b *baseline) anomalous(sigma float64) bool {
+	return b.deviates(b.value, sigma)
+}
+
+// deviates tells whether value is anomalous by the baseline, without
+// folding it in.
+func (b *baseline) deviates(value, sigma float64) bool {
+	if b.windows < anomalyWarmup {
+		return false
+	}
+	deviation := math.Max(math.Sqrt(b.variance), anomalyMinDeviation*math.Abs(b.mean))
+	return math.Abs(value-b.mean) > sigma*deviation
+}
+
+// AnomalyDetector keeps the baselines of the nodes of a topology, of each
+// scope, as of each tenant, apart, so nodes of one are never told
+// anomalous by the values of another's.
+type AnomalyDetector struct {
+	sigma float64
+
+	mtx    sync.Mutex
+	scopes map[string]*anomalyScope
+}
+
+// anomalyScope is the baselines of a scope, and the live report windows
+// they are of.
+type anomalyScope struct {
+	reportID  string
+	window    int
+	rendered  time.Time
+	baselines map[string]*baseline // by node ID and what of it
+	seen      map[string]int       // window each node was last rendered in
+}
+
+// NewAnomalyDetector makes a new AnomalyDetector, telling values which
+// deviate by more than sigma standard deviations from their baselines
+// anomalous.
+func NewAnomalyDetector(sigma float64) *AnomalyDetector {
+	return &AnomalyDetector{sigma: sigma, scopes: map[string]*anomalyScope{}}
+}
+
+// Detect marks the nodes r renders whose CPU, memory or connection count
+// is anomalous by its baseline in scope, in the Anomalies set. Each live
+// report rendered, by ID, is a window of the baselines; reports which
+// aren't, as those of the past, are only compared to them.
+func (d *AnomalyDetector) Detect(r Renderer, scope string, live bool) Renderer {
+	return anomalyRenderer{renderer: r, detector: d, scope: scope, live: live}
+}
+
+// scope returns the baselines of scope, with a window begun for rpt if
+// it's live and a new report, or nil if there are none to compare with.
+// d.mtx must be held.
+func (d *AnomalyDetector) scope(scope string, rpt report.Report, live bool) *anomalyScope {
+	s, ok := d.scopes[scope]
+	if !live {
+		return s
+	}
+	now := time.Now()
+	if !ok {
+		s = &anomalyScope{baselines: map[string]*baseline{}, seen: map[string]int{}}
+		d.scopes[scope] = s
+	}
+	s.rendered = now
+	if rpt.ID == s.reportID {
+		return s
+	}
+	s.reportID = rpt.ID
+	s.window++
+	for id, window := range s.seen {
+		if s.window-window > anomalyStaleWindows {
+			delete(s.seen, id)
+			for _, what := range []string{AnomalyCPU, AnomalyMemory, AnomalyConnections} {
+				delete(s.baselines, id+"/"+what)
+			}
+		}
+	}
+	for id, other := range d.scopes {
+		if now.Sub(other.rendered) > anomalyStaleScope {
+			delete(d.scopes, id)
+		}
+	}
+	return s
+}
+
+type anomalyRenderer struct {
+	renderer Renderer
+	detector *AnomalyDetector
+	scope    string
+	live     bool
+}
+
+func (r anomalyRenderer) Render(rpt report.Report) Nodes {
+	nodes := r.renderer.Render(rpt)
+	defer timeStage("anomalies", time.Now())
+
+	connections := map[string]int{}
+	for id, n := range nodes.Nodes {
+		for _, adjacent := range n.Adjacency {
+			if adjacent != id {
+				connections[id]++
+				connections[adjacent]++
+			}
+		}
+	}
+
+	d := r.detector
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	s := d.scope(r.scope, rpt, r.live)
+	if s == nil {
+		return nodes
+	}
+
+	var output report.Nodes
+	for id, n := range nodes.Nodes {
+		if n.Topology == Pseudo {
+			continue
+		}
+		if r.live {
+			s.seen[id] = s.window
+		}
+		values := map[string]float64{AnomalyConnections: float64(connections[id])}
+		for metricID, metric := range n.Metrics {
+			if sample, ok := metric.LastSample(); ok {
+				if cpuMetrics[metricID] {
+					values[AnomalyCPU] = sample.Value
+				} else if memoryMetrics[metricID] {
+					values[AnomalyMemory] = sample.Value
+				}
+			}
+		}
+		var anomalies []string
+		for what, value := range values {
+			b, ok := s.baselines[id+"/"+what]
+			if !r.live {
+				if ok && b.deviates(value, d.sigma) {
+					anomalies = append(anomalies, what)
+				}
+				continue
+			}
+			if !ok {
+				b = &baseline{}
+				s.baselines[id+"/"+what] = b
+			}
+			b.observe(value, s.window)
+			if b.anomalous(d.sigma) {
+				anomalies = append(anomalies, what)
+			}
+		}
+		if len(anomalies) == 0 {
+			continue
+		}
+		if output == nil {
+			output = make(report.Nodes, len(nodes.Nodes))
+			for id, n := range nodes.Nodes {
+				output[id] = n
+			}
+		}
+		output[id] = n.WithSet(Anomalies, report.MakeStringSet(anomalies...))
+	}
+	if output == nil {
+		return nodes
+	}
+	return Nodes{Nodes: output, Filtered: nodes.Filtered}
+}
+
+// IsAnomalous checks if the node was marked anomalous by an AnomalyDetector.
+func IsAnomalous(n report.Node) bool {
+	anomalies, ok := n.Sets.Lookup(Anomalies)
+	return ok && len(anomalies) > 0
+}
@@ -0,0 +1,70 @@
+package render_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	now := time.Now()
+	hostReport := func(window int, cpu float64) report.Report {
+		rpt := report.MakeReport()
+		rpt.ID = fmt.Sprint(window)
+		rpt.Host.AddNode(report.MakeNode("host1").WithTopology(report.Host).
+			WithMetric(host.CPUUsage, report.MakeSingletonMetric(now, cpu)))
+		rpt.Host.AddNode(report.MakeNode("host2").WithTopology(report.Host))
+		return rpt
+	}
+	detector := render.NewAnomalyDetector(3)
+	renderer := detector.Detect(render.TopologySelector(report.Host), "alice", true)
+
+	// Steady, if noisy, CPU makes the baseline
+	for window := 0; window < 10; window++ {
+		have := renderer.Render(hostReport(window, 10+float64(window%2))).Nodes
+		if render.IsAnomalous(have["host1"]) {
+			t.Fatalf("Expected no anomaly in window %d, got %v", window, have["host1"])
+		}
+	}
+
+	// A spike is anomalous, however often its window is rendered
+	for i := 0; i < 2; i++ {
+		have := renderer.Render(hostReport(10, 90)).Nodes
+		anomalies, _ := have["host1"].Sets.Lookup(render.Anomalies)
+		if want := report.MakeStringSet(render.AnomalyCPU); !reflect.DeepEqual(want, anomalies) {
+			t.Errorf("Expected %v, got %v", want, anomalies)
+		}
+		if render.IsAnomalous(have["host2"]) {
+			t.Errorf("Expected no anomaly on host2, got %v", have["host2"])
+		}
+	}
+
+	// Reports which aren't live are told anomalous the same way, but don't
+	// make the baseline, however many there are
+	historic := detector.Detect(render.TopologySelector(report.Host), "alice", false)
+	for window := 11; window < 30; window++ {
+		have := historic.Render(hostReport(window, 90)).Nodes
+		if !render.IsAnomalous(have["host1"]) {
+			t.Fatalf("Expected an anomaly in past window %d, got %v", window, have["host1"])
+		}
+	}
+	if have := renderer.Render(hostReport(11, 10)).Nodes; render.IsAnomalous(have["host1"]) {
+		t.Errorf("Expected no anomaly back at the baseline, got %v", have["host1"])
+	}
+
+	// Nor do the reports of other scopes, with nodes of the same IDs
+	other := detector.Detect(render.TopologySelector(report.Host), "bob", true)
+	for window := 0; window < 10; window++ {
+		if have := other.Render(hostReport(window, 90)).Nodes; render.IsAnomalous(have["host1"]) {
+			t.Fatalf("Expected no anomaly in bob's window %d, got %v", window, have["host1"])
+		}
+	}
+	if have := renderer.Render(hostReport(12, 10)).Nodes; render.IsAnomalous(have["host1"]) {
+		t.Errorf("Expected no anomaly at alice's baseline, got %v", have["host1"])
+	}
+}
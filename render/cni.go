@@ -0,0 +1,26 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// CNIRenderer is a Renderer which produces a renderable topology of the
+// peers of the CNI plugins, one per host.
+//
+// not memoised
+var CNIRenderer = MakeMap(
+	MapCNIIdentity,
+	SelectOverlay,
+)
+
+// MapCNIIdentity maps an overlay topology node to a CNI topology node, if
+// it is the peer of a CNI plugin.
+func MapCNIIdentity(m report.Node) report.Nodes {
+	peerPrefix, _ := report.ParseOverlayNodeID(m.ID)
+	for _, prefix := range report.CNIOverlayPeerPrefixes {
+		if peerPrefix == prefix {
+			return report.Nodes{m.ID: m}
+		}
+	}
+	return nil
+}
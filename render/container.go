@@ -2,8 +2,10 @@ package render
 
 import (
 	"regexp"
+	"time"
 
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -95,6 +97,10 @@ func (c connectionJoin) Render(rpt report.Report) Nodes {
 		}, c.topology).Render(rpt)
 }
 
+func (c connectionJoin) readTopologies() ([]string, bool) {
+	return mapEndpoints{topology: c.topology}.readTopologies()
+}
+
 // FilterEmpty is a Renderer which filters out nodes which have no children
 // from the specified topology.
 func FilterEmpty(topology string, r Renderer) Renderer {
@@ -124,6 +130,7 @@ type containerWithImageNameRenderer struct {
 func (r containerWithImageNameRenderer) Render(rpt report.Report) Nodes {
 	containers := r.Renderer.Render(rpt)
 	images := SelectContainerImage.Render(rpt)
+	defer timeStage("image_names", time.Now())
 
 	outputs := make(report.Nodes, len(containers.Nodes))
 	for id, c := range containers.Nodes {
@@ -155,10 +162,81 @@ func (r containerWithImageNameRenderer) Render(rpt report.Report) Nodes {
 	return Nodes{Nodes: outputs, Filtered: containers.Filtered}
 }
 
+func (r containerWithImageNameRenderer) readTopologies() ([]string, bool) {
+	return readTopologies(r.Renderer, SelectContainerImage)
+}
+
 // ContainerWithImageNameRenderer is a Renderer which produces a container
 // graph where the ranks are the image names, not their IDs
 var ContainerWithImageNameRenderer = Memoise(containerWithImageNameRenderer{ContainerRenderer})
 
+// ContainerWithSidecarsCollapsedRenderer is a Renderer which produces the
+// container graph, with service mesh sidecar proxies folded into the
+// application container of their pod. All traffic in and out of a meshed
+// pod goes through the sidecar, so this puts the edges back where users
+// expect them.
+var ContainerWithSidecarsCollapsedRenderer = CustomRenderer{
+	RenderFunc: collapseSidecars,
+	Renderer:   ContainerWithImageNameRenderer,
+}
+
+func isSidecarProxy(n report.Node) bool {
+	name, ok := n.Latest.Lookup(docker.LabelPrefix + "io.kubernetes.container.name")
+	return ok && kubernetes.IsSidecarProxy(name)
+}
+
+// collapseSidecars maps sidecar containers onto the first (by ID)
+// container of the same pod which makes connections, taking their
+// connections with them.
+func collapseSidecars(nodes Nodes) Nodes {
+	apps := map[string]string{} // pod ID -> app container ID
+	for id, n := range nodes.Nodes {
+		if n.Topology != report.Container || isSidecarProxy(n) {
+			continue
+		}
+		if _, ok := n.Latest.Lookup(report.DoesNotMakeConnections); ok {
+			continue
+		}
+		podIDs, _ := n.Parents.Lookup(report.Pod)
+		for _, podID := range podIDs {
+			if existing, ok := apps[podID]; !ok || id < existing {
+				apps[podID] = id
+			}
+		}
+	}
+	if len(apps) == 0 {
+		return nodes
+	}
+
+	ret := newJoinResults(nil)
+	sidecars := []report.Node{}
+	for _, n := range nodes.Nodes {
+		if n.Topology == report.Container && isSidecarProxy(n) {
+			sidecars = append(sidecars, n)
+			continue
+		}
+		ret.passThrough(n)
+	}
+	for _, n := range sidecars {
+		podIDs, _ := n.Parents.Lookup(report.Pod)
+		appID := ""
+		for _, podID := range podIDs {
+			if id, ok := apps[podID]; ok {
+				appID = id
+				break
+			}
+		}
+		if appID == "" {
+			ret.passThrough(n)
+			continue
+		}
+		ret.addChild(n, appID, report.Container)
+	}
+	result := ret.result(nodes)
+	result.Filtered = nodes.Filtered
+	return result
+}
+
 // ContainerImageRenderer is a Renderer which produces a renderable container
 // image graph by merging the container graph and the container image topology.
 var ContainerImageRenderer = Memoise(FilterEmpty(report.Container,
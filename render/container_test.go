@@ -112,3 +112,42 @@ func TestContainerImageFilterRenderer(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestContainerWithSidecarsCollapsedRenderer(t *testing.T) {
+	var (
+		podID     = report.MakePodNodeID("pod1")
+		appID     = report.MakeContainerNodeID("app")
+		sidecarID = report.MakeContainerNodeID("sidecar")
+		clientID  = report.MakeContainerNodeID("client")
+		clientEP  = report.MakeScopedEndpointNodeID("", "10.0.0.1", "54001")
+		sidecarEP = report.MakeScopedEndpointNodeID("", "10.0.0.2", "80")
+		hostID    = report.MakeHostNodeID("host1")
+		container = func(id, name, ip string) report.Node {
+			return report.MakeNodeWith(id, map[string]string{
+				docker.LabelPrefix + "io.kubernetes.container.name": name,
+			}).WithTopology(report.Container).
+				WithParents(report.MakeSets().Add(report.Pod, report.MakeStringSet(podID))).
+				WithSets(report.MakeSets().Add(docker.ContainerIPsWithScopes, report.MakeStringSet(report.MakeScopedAddressNodeID("", ip))))
+		}
+	)
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(container(appID, "app", "10.0.0.3"))
+	rpt.Container.AddNode(container(sidecarID, "istio-proxy", "10.0.0.2"))
+	rpt.Container.AddNode(report.MakeNode(clientID).WithTopology(report.Container).
+		WithSets(report.MakeSets().Add(docker.ContainerIPsWithScopes, report.MakeStringSet(report.MakeScopedAddressNodeID("", "10.0.0.1")))))
+	rpt.Endpoint.AddNode(report.MakeNodeWith(clientEP, map[string]string{report.HostNodeID: hostID}).
+		WithTopology(report.Endpoint).WithAdjacent(sidecarEP))
+	rpt.Endpoint.AddNode(report.MakeNodeWith(sidecarEP, map[string]string{report.HostNodeID: hostID}).
+		WithTopology(report.Endpoint))
+
+	have := render.ContainerWithSidecarsCollapsedRenderer.Render(rpt).Nodes
+	if _, ok := have[sidecarID]; ok {
+		t.Errorf("Expected sidecar to be collapsed, got %v", have)
+	}
+	if _, ok := have[appID].Children.Lookup(sidecarID); !ok {
+		t.Errorf("Expected sidecar to be a child of the app container, got %v", have[appID].Children)
+	}
+	if want, adjacency := report.MakeIDList(appID), have[clientID].Adjacency; !reflect.DeepEqual(want, adjacency) {
+		t.Error(test.Diff(want, adjacency))
+	}
+}
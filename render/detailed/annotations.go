@@ -0,0 +1,57 @@
+package detailed
+
+import (
+	"sort"
+	"time"
+)
+
+// Severities of annotations.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Annotation is a note users leave on a node, or on the edge from it to
+// another, for whoever looks at it next.
+type Annotation struct {
+	ID         string `json:"id"`
+	TopologyID string `json:"topologyId"`
+	NodeID     string `json:"nodeId"`
+	// AdjacentID is the other end of annotated edges.
+	AdjacentID string    `json:"adjacentId,omitempty"`
+	Text       string    `json:"text"`
+	Links      []string  `json:"links,omitempty"`
+	Severity   string    `json:"severity,omitempty"`
+	Author     string    `json:"author,omitempty"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Annotate adds the annotations of nodes of the topology to their
+// summaries. Annotations on edges are on the nodes they come from, and
+// only kept while the edge is there. Annotations go oldest first.
+func Annotate(topologyID string, nodes NodeSummaries, annotations []Annotation) {
+	sorted := make([]Annotation, len(annotations))
+	copy(sorted, annotations)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Created.Equal(sorted[j].Created) {
+			return sorted[i].Created.Before(sorted[j].Created)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	for _, annotation := range sorted {
+		if annotation.TopologyID != topologyID {
+			continue
+		}
+		node, ok := nodes[annotation.NodeID]
+		if !ok {
+			continue
+		}
+		if annotation.AdjacentID != "" && !node.Adjacency.Contains(annotation.AdjacentID) {
+			continue
+		}
+		node.Annotations = append(node.Annotations, annotation)
+		nodes[annotation.NodeID] = node
+	}
+}
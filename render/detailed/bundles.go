@@ -0,0 +1,156 @@
+package detailed
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// What edges can be bundled by: the group of the nodes they go to.
+const (
+	BundleByNamespace = "namespace"
+	BundleBySubnet    = "subnet"
+	BundleByService   = "service"
+)
+
+// DefaultBundleThreshold is how many edges a node has before its edges
+// are bundled, unless asked otherwise.
+const DefaultBundleThreshold = 100
+
+// EdgeBundle stands for the edges of a node to the nodes of a group.
+// ExpandBundle gives the edges back.
+type EdgeBundle struct {
+	ID    string `json:"id"`
+	Group string `json:"group"`
+	Count int    `json:"count"`
+}
+
+var bundleGroups = map[string]func(report.Node) (string, bool){
+	BundleByNamespace: render.NamespaceOf,
+	BundleBySubnet:    subnetOf,
+	BundleByService:   serviceOf,
+}
+
+// CheckBundleBy returns an error if edges can't be bundled by by.
+func CheckBundleBy(by string) error {
+	if _, ok := bundleGroups[by]; !ok {
+		return fmt.Errorf("can't bundle edges by %q, expected %q, %q or %q", by, BundleByNamespace, BundleBySubnet, BundleByService)
+	}
+	return nil
+}
+
+func makeBundleID(by, group string) string {
+	return by + ":" + group
+}
+
+func parseBundleID(id string) (string, string, bool) {
+	parts := strings.SplitN(id, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// BundleEdges bundles the edges of the summaries with more than threshold
+// edges by the group of the nodes they go to. Edges to nodes in no group,
+// or alone in theirs, are kept as they are. nodes are the rendered nodes
+// the summaries were made of.
+func BundleEdges(summaries NodeSummaries, nodes report.Nodes, by string, threshold int) NodeSummaries {
+	groupOf, ok := bundleGroups[by]
+	if !ok {
+		return summaries
+	}
+	result := make(NodeSummaries, len(summaries))
+	for id, summary := range summaries {
+		if len(summary.Adjacency) <= threshold {
+			result[id] = summary
+			continue
+		}
+		groups := map[string]report.IDList{}
+		for _, adjacent := range summary.Adjacency {
+			if group, ok := groupOf(nodes[adjacent]); ok {
+				groups[group] = append(groups[group], adjacent)
+			}
+		}
+		var (
+			adjacency = report.MakeIDList()
+			bundled   = map[string]struct{}{}
+			bundles   []EdgeBundle
+		)
+		for group, ids := range groups {
+			if len(ids) < 2 {
+				continue
+			}
+			for _, adjacent := range ids {
+				bundled[adjacent] = struct{}{}
+			}
+			bundles = append(bundles, EdgeBundle{ID: makeBundleID(by, group), Group: group, Count: len(ids)})
+		}
+		for _, adjacent := range summary.Adjacency {
+			if _, ok := bundled[adjacent]; !ok {
+				adjacency = adjacency.Add(adjacent)
+			}
+		}
+		sort.Slice(bundles, func(i, j int) bool { return bundles[i].ID < bundles[j].ID })
+		summary.Adjacency = adjacency
+		summary.EdgeBundles = bundles
+		result[id] = summary
+	}
+	return result
+}
+
+// ExpandBundle returns the nodes the edges of node in the bundle go to.
+func ExpandBundle(node report.Node, nodes report.Nodes, bundleID string) (report.IDList, error) {
+	by, group, ok := parseBundleID(bundleID)
+	if !ok {
+		return nil, fmt.Errorf("invalid edge bundle %q", bundleID)
+	}
+	if err := CheckBundleBy(by); err != nil {
+		return nil, err
+	}
+	adjacency := report.MakeIDList()
+	for _, adjacent := range node.Adjacency {
+		if g, ok := bundleGroups[by](nodes[adjacent]); ok && g == group {
+			adjacency = adjacency.Add(adjacent)
+		}
+	}
+	return adjacency, nil
+}
+
+// subnetOf returns the /24 (or, for IPv6, the /64) the address of the
+// node is in.
+func subnetOf(n report.Node) (string, bool) {
+	var addr string
+	if _, a, _, ok := report.ParseEndpointNodeID(n.ID); ok {
+		addr = a
+	} else if ips, ok := n.Sets.Lookup(docker.ContainerIPs); ok && len(ips) > 0 {
+		addr = ips[0]
+	} else if id, ok := render.ParsePseudoNodeID(n.ID); ok {
+		addr = id
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", false
+	}
+	mask := net.CIDRMask(64, 128)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(24, 32)
+	}
+	subnet := net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	return subnet.String(), true
+}
+
+// serviceOf returns the Kubernetes, ECS or Swarm service of the node.
+func serviceOf(n report.Node) (string, bool) {
+	for _, topology := range []string{report.Service, report.ECSService, report.SwarmService} {
+		if ids, ok := n.Parents.Lookup(topology); ok && len(ids) > 0 {
+			return ids[0], true
+		}
+	}
+	return "", false
+}
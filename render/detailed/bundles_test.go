@@ -0,0 +1,70 @@
+package detailed_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestBundleEdges(t *testing.T) {
+	nodes := report.Nodes{}
+	source := report.MakeNode("source")
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("default%d", i)
+		nodes[id] = report.MakeNodeWith(id, map[string]string{kubernetes.Namespace: "default"})
+		source = source.WithAdjacent(id)
+	}
+	nodes["kube-system0"] = report.MakeNodeWith("kube-system0", map[string]string{kubernetes.Namespace: "kube-system"})
+	nodes["nowhere"] = report.MakeNode("nowhere")
+	source = source.WithAdjacent("kube-system0", "nowhere")
+	nodes["source"] = source
+	summaries := detailed.NodeSummaries{
+		"source": {BasicNodeSummary: detailed.BasicNodeSummary{ID: "source"}, Adjacency: source.Adjacency},
+	}
+
+	if have := detailed.BundleEdges(summaries, nodes, detailed.BundleByNamespace, 6); !reflect.DeepEqual(summaries, have) {
+		t.Errorf("Expected nodes with few edges to be left alone, got %v", have)
+	}
+
+	have := detailed.BundleEdges(summaries, nodes, detailed.BundleByNamespace, 5)["source"]
+	if want := report.MakeIDList("kube-system0", "nowhere"); !reflect.DeepEqual(want, have.Adjacency) {
+		t.Errorf("Expected %v to be left, got %v", want, have.Adjacency)
+	}
+	if want := []detailed.EdgeBundle{{ID: "namespace:default", Group: "default", Count: 4}}; !reflect.DeepEqual(want, have.EdgeBundles) {
+		t.Errorf("Expected %v, got %v", want, have.EdgeBundles)
+	}
+
+	expanded, err := detailed.ExpandBundle(source, nodes, "namespace:default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := report.MakeIDList("default0", "default1", "default2", "default3"); !reflect.DeepEqual(want, expanded) {
+		t.Errorf("Expected %v, got %v", want, expanded)
+	}
+	for _, id := range []string{"namespace", "rack:a"} {
+		if _, err := detailed.ExpandBundle(source, nodes, id); err == nil {
+			t.Errorf("Expected an error expanding %q", id)
+		}
+	}
+}
+
+func TestBundleEdgesBySubnet(t *testing.T) {
+	nodes := report.Nodes{}
+	source := report.MakeNode("source")
+	for _, addr := range []string{"10.0.1.1", "10.0.1.2", "10.0.2.1"} {
+		id := report.MakeEndpointNodeID("", "", addr, "80")
+		nodes[id] = report.MakeNode(id)
+		source = source.WithAdjacent(id)
+	}
+	summaries := detailed.NodeSummaries{
+		"source": {BasicNodeSummary: detailed.BasicNodeSummary{ID: "source"}, Adjacency: source.Adjacency},
+	}
+	have := detailed.BundleEdges(summaries, nodes, detailed.BundleBySubnet, 0)["source"]
+	if want := []detailed.EdgeBundle{{ID: "subnet:10.0.1.0/24", Group: "10.0.1.0/24", Count: 2}}; !reflect.DeepEqual(want, have.EdgeBundles) {
+		t.Errorf("Expected %v, got %v", want, have.EdgeBundles)
+	}
+}
@@ -2,8 +2,10 @@ package detailed
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/render"
@@ -40,6 +42,12 @@ type ConnectionsSummary struct {
 	Label       string       `json:"label"`
 	Columns     []Column     `json:"columns"`
 	Connections []Connection `json:"connections"`
+	// Total is how many connections there are, of which Connections are
+	// those on the page, when they were queried.
+	Total int `json:"total,omitempty"`
+	// Cursor is where the next page of connections starts, when they were
+	// limited and there are more.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 // Connection is a row in the connections table.
@@ -57,6 +65,126 @@ func (s connectionsByID) Len() int           { return len(s) }
 func (s connectionsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s connectionsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
 
+// ConnectionsQuery is what a client asks of a connections table, so as not
+// to be sent thousands of connections it won't show: only those whose
+// labels or fields contain Filter, case-insensitively, sorted by SortBy,
+// one of the columns, and only Limit of them, from Offset on. Connections
+// are sorted by count greatest first, and by port and remote least first,
+// unless Order says otherwise.
+type ConnectionsQuery struct {
+	Filter string
+	SortBy string // "" to sort by ID
+	Order  string // "" for the order of the column
+	Offset int
+	Limit  int // 0 for all connections
+}
+
+// Orders of sorting connections
+const (
+	Ascending  = "asc"
+	Descending = "desc"
+)
+
+// CheckConnectionsSortBy checks connections can be sorted by the column.
+func CheckConnectionsSortBy(by string) error {
+	switch by {
+	case countKey, portKey, remoteKey:
+		return nil
+	}
+	return fmt.Errorf("unknown connections sort_by %q: expected %s, %s or %s", by, countKey, portKey, remoteKey)
+}
+
+// CheckConnectionsOrder checks connections can be sorted in the order.
+func CheckConnectionsOrder(order string) error {
+	switch order {
+	case Ascending, Descending:
+		return nil
+	}
+	return fmt.Errorf("unknown connections order %q: expected %s or %s", order, Ascending, Descending)
+}
+
+// Query returns the table, with only the connections the query asks for.
+func (s ConnectionsSummary) Query(q ConnectionsQuery) ConnectionsSummary {
+	connections := s.Connections
+	if q.Filter != "" {
+		filter := strings.ToLower(q.Filter)
+		connections = make([]Connection, 0, len(s.Connections))
+		for _, c := range s.Connections {
+			if c.matches(filter) {
+				connections = append(connections, c)
+			}
+		}
+	} else {
+		connections = append([]Connection{}, connections...)
+	}
+	if q.SortBy != "" {
+		sortConnections(connections, q.SortBy, q.Order)
+	}
+
+	s.Total = len(connections)
+	s.Cursor = ""
+	if q.Offset > len(connections) {
+		q.Offset = len(connections)
+	}
+	connections = connections[q.Offset:]
+	if q.Limit > 0 && len(connections) > q.Limit {
+		connections = connections[:q.Limit]
+		s.Cursor = strconv.Itoa(q.Offset + q.Limit)
+	}
+	s.Connections = connections
+	return s
+}
+
+// matches tells whether the labels or fields of the connection contain
+// filter, which is lower case.
+func (c Connection) matches(filter string) bool {
+	if strings.Contains(strings.ToLower(c.Label), filter) || strings.Contains(strings.ToLower(c.LabelMinor), filter) {
+		return true
+	}
+	for _, row := range c.Metadata {
+		if strings.Contains(strings.ToLower(row.Value), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Connection) field(id string) string {
+	for _, row := range c.Metadata {
+		if row.ID == id {
+			return row.Value
+		}
+	}
+	return ""
+}
+
+func sortConnections(connections []Connection, by, order string) {
+	// less compares a and b in the natural order of the column, or tells
+	// they're equal.
+	var less func(a, b Connection) (bool, bool)
+	switch by {
+	case countKey, portKey:
+		less = func(a, b Connection) (bool, bool) {
+			x, _ := strconv.ParseFloat(a.field(by), 64)
+			y, _ := strconv.ParseFloat(b.field(by), 64)
+			return x < y, x == y
+		}
+	default:
+		less = func(a, b Connection) (bool, bool) {
+			x, y := a.Label+" "+a.LabelMinor, b.Label+" "+b.LabelMinor
+			return x < y, x == y
+		}
+	}
+	descending := order == Descending || (order == "" && by == countKey)
+	sort.SliceStable(connections, func(i, j int) bool {
+		a, b := connections[i], connections[j]
+		if lt, eq := less(a, b); !eq {
+			return lt != descending
+		}
+		return a.ID < b.ID
+	})
+}
+
 // Intermediate type used as a key to dedupe rows
 type connection struct {
 	remoteNodeID          string
@@ -64,13 +192,15 @@ type connection struct {
 	port                  string // destination port
 }
 
+// connectionCounters count connections, estimating how many there are
+// of those probes reported a sample of.
 type connectionCounters struct {
 	counted map[string]struct{}
-	counts  map[connection]int
+	counts  map[connection]float64
 }
 
 func newConnectionCounters() *connectionCounters {
-	return &connectionCounters{counted: map[string]struct{}{}, counts: map[connection]int{}}
+	return &connectionCounters{counted: map[string]struct{}{}, counts: map[connection]float64{}}
 }
 
 func (c *connectionCounters) add(outgoing bool, localNode, remoteNode, localEndpoint, remoteEndpoint report.Node) {
@@ -102,7 +232,18 @@ func (c *connectionCounters) add(outgoing bool, localNode, remoteNode, localEndp
 	}
 
 	c.counted[connectionID] = struct{}{}
-	c.counts[conn]++
+	c.counts[conn] += sampleWeight(srcEndpoint)
+}
+
+// sampleWeight returns how many connections that of the source endpoint
+// stands for, of those the probe sampled.
+func sampleWeight(srcEndpoint report.Node) float64 {
+	if value, ok := srcEndpoint.Latest.Lookup(endpoint.SampleWeight); ok {
+		if weight, err := strconv.ParseFloat(value, 64); err == nil && weight > 1 {
+			return weight
+		}
+	}
+	return 1
 }
 
 func internetAddr(node report.Node, ep report.Node) (string, bool) {
@@ -150,7 +291,7 @@ func (c *connectionCounters) rows(r report.Report, ns report.Nodes, includeLocal
 			},
 			report.MetadataRow{
 				ID:    countKey,
-				Value: strconv.Itoa(count),
+				Value: strconv.Itoa(int(math.Floor(count + 0.5))),
 			},
 		)
 		output = append(output, connection)
@@ -190,6 +331,36 @@ func incomingConnectionsSummary(topologyID string, r report.Report, n report.Nod
 }
 
 func outgoingConnectionsSummary(topologyID string, r report.Report, n report.Node, ns report.Nodes) ConnectionsSummary {
+	counts := outgoingConnectionCounters(r, n, ns)
+	columnHeaders := NormalColumns
+	if render.IsInternetNode(n) {
+		columnHeaders = InternetColumns
+	}
+	return ConnectionsSummary{
+		ID:          "outgoing-connections",
+		TopologyID:  topologyID,
+		Label:       "Outbound",
+		Columns:     columnHeaders,
+		Connections: counts.rows(r, ns, render.IsInternetNode(n)),
+	}
+}
+
+// OutgoingConnectionCounts returns the number of connections from n to each
+// of the nodes it has an edge to, as counted in its connections table:
+// estimated, for connections probes sampled.
+func OutgoingConnectionCounts(r report.Report, n report.Node, ns report.Nodes) map[string]int {
+	counts := map[string]float64{}
+	for conn, count := range outgoingConnectionCounters(r, n, ns).counts {
+		counts[conn.remoteNodeID] += count
+	}
+	result := make(map[string]int, len(counts))
+	for id, count := range counts {
+		result[id] = int(math.Floor(count + 0.5))
+	}
+	return result
+}
+
+func outgoingConnectionCounters(r report.Report, n report.Node, ns report.Nodes) *connectionCounters {
 	localEndpoints := endpointChildrenOf(n)
 	counts := newConnectionCounters()
 
@@ -207,18 +378,7 @@ func outgoingConnectionsSummary(topologyID string, r report.Report, n report.Nod
 			}
 		}
 	}
-
-	columnHeaders := NormalColumns
-	if render.IsInternetNode(n) {
-		columnHeaders = InternetColumns
-	}
-	return ConnectionsSummary{
-		ID:          "outgoing-connections",
-		TopologyID:  topologyID,
-		Label:       "Outbound",
-		Columns:     columnHeaders,
-		Connections: counts.rows(r, ns, render.IsInternetNode(n)),
-	}
+	return counts
 }
 
 func endpointChildrenOf(n report.Node) []report.Node {
@@ -0,0 +1,69 @@
+package detailed_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func connection(id, label, port, count string) detailed.Connection {
+	return detailed.Connection{
+		ID:    id,
+		Label: label,
+		Metadata: []report.MetadataRow{
+			{ID: "port", Value: port},
+			{ID: "count", Value: count},
+		},
+	}
+}
+
+func TestConnectionsQuery(t *testing.T) {
+	summary := detailed.ConnectionsSummary{
+		ID: "incoming-connections",
+		Connections: []detailed.Connection{
+			connection("a", "alpha", "80", "2"),
+			connection("b", "bravo", "443", "10"),
+			connection("c", "charlie", "8080", "1"),
+			connection("d", "delta", "22", "10"),
+		},
+	}
+	ids := func(s detailed.ConnectionsSummary) []string {
+		result := []string{}
+		for _, c := range s.Connections {
+			result = append(result, c.ID)
+		}
+		return result
+	}
+
+	for _, tc := range []struct {
+		name   string
+		query  detailed.ConnectionsQuery
+		want   []string
+		total  int
+		cursor string
+	}{
+		{"all", detailed.ConnectionsQuery{}, []string{"a", "b", "c", "d"}, 4, ""},
+		{"count", detailed.ConnectionsQuery{SortBy: "count"}, []string{"b", "d", "a", "c"}, 4, ""},
+		{"port", detailed.ConnectionsQuery{SortBy: "port"}, []string{"d", "a", "b", "c"}, 4, ""},
+		{"remote descending", detailed.ConnectionsQuery{SortBy: "remote", Order: detailed.Descending}, []string{"d", "c", "b", "a"}, 4, ""},
+		{"first page", detailed.ConnectionsQuery{SortBy: "count", Limit: 3}, []string{"b", "d", "a"}, 4, "3"},
+		{"last page", detailed.ConnectionsQuery{SortBy: "count", Limit: 3, Offset: 3}, []string{"c"}, 4, ""},
+		{"past the end", detailed.ConnectionsQuery{Limit: 3, Offset: 7}, []string{}, 4, ""},
+		{"filter", detailed.ConnectionsQuery{Filter: "A", SortBy: "port"}, []string{"d", "a", "b", "c"}, 4, ""},
+		{"filter port", detailed.ConnectionsQuery{Filter: "80"}, []string{"a", "c"}, 2, ""},
+	} {
+		have := summary.Query(tc.query)
+		if !reflect.DeepEqual(tc.want, ids(have)) {
+			t.Errorf("%s: %s", tc.name, test.Diff(tc.want, ids(have)))
+		}
+		if have.Total != tc.total || have.Cursor != tc.cursor {
+			t.Errorf("%s: want total %d and cursor %q, have %d and %q", tc.name, tc.total, tc.cursor, have.Total, have.Cursor)
+		}
+	}
+	if !reflect.DeepEqual([]string{"a", "b", "c", "d"}, ids(summary)) {
+		t.Errorf("query changed the connections: %v", ids(summary))
+	}
+}
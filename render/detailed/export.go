@@ -0,0 +1,93 @@
+package detailed
+
+import (
+	"strconv"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// ExportedTable is a table of the details of a node, its rows flattened
+// into values by column ID, to be exported for offline analysis.
+type ExportedTable struct {
+	ID      string
+	Label   string
+	Columns []Column
+	Rows    []map[string]string
+}
+
+// The column of the label of the nodes of children and connections.
+var nodeColumn = Column{ID: "node", Label: "Node"}
+
+// ExportTable returns the table of the details of the node with the ID:
+// one of its Tables, by ID, Children, by the ID of their topology, as in
+// processes, or Connections, as in incoming-connections.
+func (n Node) ExportTable(id string) (ExportedTable, bool) {
+	for _, table := range n.Tables {
+		if table.ID == id {
+			return exportTable(table), true
+		}
+	}
+	for _, group := range n.Children {
+		if group.TopologyID == id {
+			return exportChildren(group), true
+		}
+	}
+	for _, connections := range n.Connections {
+		if connections.ID == id {
+			return exportConnections(connections), true
+		}
+	}
+	return ExportedTable{}, false
+}
+
+func exportTable(table report.Table) ExportedTable {
+	result := ExportedTable{ID: table.ID, Label: table.Label}
+	if table.Type == report.MulticolumnTableType {
+		for _, c := range table.Columns {
+			result.Columns = append(result.Columns, Column{ID: c.ID, Label: c.Label, Datatype: c.DataType})
+		}
+	} else {
+		result.Columns = []Column{{ID: "label", Label: "Label"}, {ID: "value", Label: "Value"}}
+	}
+	for _, row := range table.Rows {
+		result.Rows = append(result.Rows, row.Entries)
+	}
+	return result
+}
+
+func exportChildren(group NodeSummaryGroup) ExportedTable {
+	result := ExportedTable{
+		ID:      group.TopologyID,
+		Label:   group.Label,
+		Columns: append([]Column{nodeColumn}, group.Columns...),
+	}
+	for _, node := range group.Nodes {
+		row := map[string]string{nodeColumn.ID: node.Label}
+		for _, m := range node.Metadata {
+			row[m.ID] = m.Value
+		}
+		for _, m := range node.Metrics {
+			if !m.ValueEmpty {
+				row[m.ID] = strconv.FormatFloat(m.Value, 'f', -1, 64)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result
+}
+
+func exportConnections(connections ConnectionsSummary) ExportedTable {
+	result := ExportedTable{
+		ID:      connections.ID,
+		Label:   connections.Label,
+		Columns: append([]Column{nodeColumn}, connections.Columns...),
+	}
+	for _, c := range connections.Connections {
+		row := map[string]string{nodeColumn.ID: c.Label}
+		for _, m := range c.Metadata {
+			row[m.ID] = m.Value
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package detailed_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestExportTable(t *testing.T) {
+	node := detailed.Node{
+		NodeSummary: detailed.NodeSummary{
+			Tables: []report.Table{
+				{
+					ID:   "env_",
+					Type: report.PropertyListType,
+					Rows: []report.Row{{ID: "label_PATH", Entries: map[string]string{"label": "PATH", "value": "/bin"}}},
+				},
+				{
+					ID:      "ports_",
+					Type:    report.MulticolumnTableType,
+					Columns: []report.Column{{ID: "port", Label: "Port", DataType: report.Number}},
+					Rows:    []report.Row{{ID: "80", Entries: map[string]string{"port": "80"}}},
+				},
+			},
+		},
+		Children: []detailed.NodeSummaryGroup{{
+			TopologyID: "processes",
+			Label:      "Processes",
+			Columns:    []detailed.Column{{ID: "pid", Label: "PID"}, {ID: "cpu", Label: "CPU"}},
+			Nodes: []detailed.NodeSummary{{
+				BasicNodeSummary: detailed.BasicNodeSummary{Label: "nginx"},
+				Metadata:         []report.MetadataRow{{ID: "pid", Value: "1"}},
+				Metrics:          []report.MetricRow{{ID: "cpu", Value: 0.5}, {ID: "memory", ValueEmpty: true}},
+			}},
+		}},
+		Connections: []detailed.ConnectionsSummary{{
+			ID:          "incoming-connections",
+			Columns:     detailed.NormalColumns,
+			Connections: []detailed.Connection{{Label: "client", Metadata: []report.MetadataRow{{ID: "port", Value: "80"}, {ID: "count", Value: "3"}}}},
+		}},
+	}
+
+	for _, tc := range []struct {
+		id      string
+		columns []string
+		rows    []map[string]string
+	}{
+		{"env_", []string{"label", "value"}, []map[string]string{{"label": "PATH", "value": "/bin"}}},
+		{"ports_", []string{"port"}, []map[string]string{{"port": "80"}}},
+		{"processes", []string{"node", "pid", "cpu"}, []map[string]string{{"node": "nginx", "pid": "1", "cpu": "0.5"}}},
+		{"incoming-connections", []string{"node", "port", "count"}, []map[string]string{{"node": "client", "port": "80", "count": "3"}}},
+	} {
+		table, ok := node.ExportTable(tc.id)
+		if !ok {
+			t.Errorf("%s: not found", tc.id)
+			continue
+		}
+		columns := []string{}
+		for _, c := range table.Columns {
+			columns = append(columns, c.ID)
+		}
+		if !reflect.DeepEqual(tc.columns, columns) {
+			t.Errorf("%s: %s", tc.id, test.Diff(tc.columns, columns))
+		}
+		if !reflect.DeepEqual(tc.rows, table.Rows) {
+			t.Errorf("%s: %s", tc.id, test.Diff(tc.rows, table.Rows))
+		}
+	}
+
+	if _, ok := node.ExportTable("outgoing-connections"); ok {
+		t.Error("expected no outgoing connections")
+	}
+}
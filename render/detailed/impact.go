@@ -0,0 +1,97 @@
+package detailed
+
+import (
+	"sort"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Bounds of the depth of impact queries.
+const (
+	DefaultImpactDepth = 3
+	MaxImpactDepth     = 10
+)
+
+// Impact is the blast radius of a node: the nodes depending on it,
+// transitively connecting to it (upstream), which may break if it does,
+// and the nodes it depends on, transitively connected to by it
+// (downstream).
+type Impact struct {
+	ID         string         `json:"id"`
+	Depth      int            `json:"depth"`
+	Upstream   []ImpactedNode `json:"upstream"`
+	Downstream []ImpactedNode `json:"downstream"`
+}
+
+// ImpactedNode is a node in the blast radius of another, Depth hops away,
+// through Via, the node one hop closer, if any.
+type ImpactedNode struct {
+	BasicNodeSummary
+	Depth int    `json:"depth"`
+	Via   string `json:"via,omitempty"`
+}
+
+// MakeImpact computes the blast radius of the node with the ID, among the
+// rendered nodes, up to depth hops away. Nodes are ordered by how close
+// they are, then by label.
+func MakeImpact(r report.Report, nodes report.Nodes, id string, depth int) Impact {
+	incoming := map[string][]string{}
+	for _, n := range nodes {
+		for _, adjacent := range n.Adjacency {
+			incoming[adjacent] = append(incoming[adjacent], n.ID)
+		}
+	}
+	for _, ids := range incoming {
+		sort.Strings(ids)
+	}
+	return Impact{
+		ID:         id,
+		Depth:      depth,
+		Upstream:   impacted(r, nodes, id, depth, func(id string) []string { return incoming[id] }),
+		Downstream: impacted(r, nodes, id, depth, func(id string) []string { return nodes[id].Adjacency }),
+	}
+}
+
+// impacted walks the graph of next from id, breadth first, so every node
+// is found at the fewest hops it is.
+func impacted(r report.Report, nodes report.Nodes, id string, depth int, next func(string) []string) []ImpactedNode {
+	result := []ImpactedNode{}
+	seen := map[string]struct{}{id: {}}
+	frontier := []string{id}
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var nextFrontier []string
+		for _, from := range frontier {
+			for _, to := range next(from) {
+				if _, ok := seen[to]; ok {
+					continue
+				}
+				seen[to] = struct{}{}
+				n, ok := nodes[to]
+				if !ok {
+					continue
+				}
+				summary, ok := MakeBasicNodeSummary(r, n)
+				if !ok {
+					continue
+				}
+				in := ImpactedNode{BasicNodeSummary: summary, Depth: d}
+				if from != id {
+					in.Via = from
+				}
+				result = append(result, in)
+				nextFrontier = append(nextFrontier, to)
+			}
+		}
+		frontier = nextFrontier
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Depth != result[j].Depth {
+			return result[i].Depth < result[j].Depth
+		}
+		if result[i].Label != result[j].Label {
+			return result[i].Label < result[j].Label
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
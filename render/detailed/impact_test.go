@@ -0,0 +1,71 @@
+package detailed_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestMakeImpact(t *testing.T) {
+	// web -> api -> db -> disk, cron -> api, and api -> cache -> api
+	nodes := report.Nodes{}
+	for id, adjacency := range map[string][]string{
+		"web":   {"api"},
+		"cron":  {"api"},
+		"api":   {"db", "cache"},
+		"cache": {"api"},
+		"db":    {"disk"},
+		"disk":  nil,
+	} {
+		nodeID := report.MakeHostNodeID(id)
+		n := report.MakeNode(nodeID).WithTopology(report.Host)
+		for _, adjacent := range adjacency {
+			n = n.WithAdjacent(report.MakeHostNodeID(adjacent))
+		}
+		nodes[nodeID] = n
+	}
+	ids := func(impacted []detailed.ImpactedNode) map[string]int {
+		result := map[string]int{}
+		for _, n := range impacted {
+			result[n.ID] = n.Depth
+		}
+		return result
+	}
+
+	impact := detailed.MakeImpact(report.MakeReport(), nodes, report.MakeHostNodeID("api"), 1)
+	if want, have := map[string]int{
+		report.MakeHostNodeID("cache"): 1,
+		report.MakeHostNodeID("cron"):  1,
+		report.MakeHostNodeID("web"):   1,
+	}, ids(impact.Upstream); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected upstream %v, got %v", want, have)
+	}
+	if want, have := map[string]int{
+		report.MakeHostNodeID("cache"): 1,
+		report.MakeHostNodeID("db"):    1,
+	}, ids(impact.Downstream); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected downstream %v, got %v", want, have)
+	}
+
+	impact = detailed.MakeImpact(report.MakeReport(), nodes, report.MakeHostNodeID("disk"), 3)
+	if want, have := map[string]int{
+		report.MakeHostNodeID("db"):    1,
+		report.MakeHostNodeID("api"):   2,
+		report.MakeHostNodeID("cache"): 3,
+		report.MakeHostNodeID("cron"):  3,
+		report.MakeHostNodeID("web"):   3,
+	}, ids(impact.Upstream); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected upstream %v, got %v", want, have)
+	}
+	if len(impact.Downstream) != 0 {
+		t.Errorf("Expected nothing downstream, got %v", impact.Downstream)
+	}
+	if last := impact.Upstream[len(impact.Upstream)-1]; last.Via != report.MakeHostNodeID("api") {
+		t.Errorf("Expected %s to be impacted via api, got %q", last.ID, last.Via)
+	}
+	if first := impact.Upstream[0]; first.Via != "" {
+		t.Errorf("Expected %s to be impacted directly, got %q", first.ID, first.Via)
+	}
+}
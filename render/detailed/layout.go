@@ -0,0 +1,299 @@
+package detailed
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/bluele/gcache"
+)
+
+// Layouts nodes can be placed by before they are sent, for graphs too big
+// for browsers to lay out quickly.
+const (
+	ForceLayout   = "force"
+	LayeredLayout = "layered"
+)
+
+// nodeSpacing is roughly how far apart layouts place nodes.
+const nodeSpacing = 100.0
+
+// forceIterations is how many times the force-directed layout moves the
+// nodes.
+const forceIterations = 50
+
+// Position is where a layout placed a node.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Layout is the positions of nodes, by ID.
+type Layout map[string]Position
+
+// graph is what layouts place: nodes by index, in ID order, and the
+// nodes each is adjacent to.
+type graph struct {
+	ids   []string
+	edges [][]int
+}
+
+type layoutFunc func(graph) []Position
+
+var layouts = map[string]layoutFunc{
+	ForceLayout:   forceLayout,
+	LayeredLayout: layeredLayout,
+}
+
+// layoutCache is keyed on the layout and the hash of the shape of a
+// graph, and contains the Layout of the graph, so topologies whose nodes
+// and edges didn't change aren't laid out again.
+var layoutCache = gcache.New(100).LRU().Build()
+
+// CheckLayout returns an error if there is no layout of the name.
+func CheckLayout(name string) error {
+	if _, ok := layouts[name]; !ok {
+		return fmt.Errorf("unknown layout %q, expected %q or %q", name, ForceLayout, LayeredLayout)
+	}
+	return nil
+}
+
+// MakeLayout places the nodes by the named layout. Only the IDs and
+// adjacency of the nodes are taken into account, so graphs of the same
+// shape are laid out the same way, and only once.
+func MakeLayout(name string, nodes NodeSummaries) Layout {
+	f, ok := layouts[name]
+	if !ok {
+		return nil
+	}
+	g := makeGraph(nodes)
+	key := fmt.Sprintf("%s-%x", name, g.hash())
+	if v, err := layoutCache.Get(key); err == nil {
+		return v.(Layout)
+	}
+	positions := f(g)
+	layout := make(Layout, len(g.ids))
+	for i, id := range g.ids {
+		layout[id] = positions[i]
+	}
+	layoutCache.Set(key, layout)
+	return layout
+}
+
+func makeGraph(nodes NodeSummaries) graph {
+	g := graph{ids: make([]string, 0, len(nodes))}
+	for id := range nodes {
+		g.ids = append(g.ids, id)
+	}
+	sort.Strings(g.ids)
+	index := make(map[string]int, len(g.ids))
+	for i, id := range g.ids {
+		index[id] = i
+	}
+	g.edges = make([][]int, len(g.ids))
+	for i, id := range g.ids {
+		for _, adjacent := range nodes[id].Adjacency {
+			if j, ok := index[adjacent]; ok && j != i {
+				g.edges[i] = append(g.edges[i], j)
+			}
+		}
+		sort.Ints(g.edges[i])
+	}
+	return g
+}
+
+func (g graph) hash() uint64 {
+	h := fnv.New64a()
+	for i, id := range g.ids {
+		fmt.Fprintf(h, "%s\x00%v\x00", id, g.edges[i])
+	}
+	return h.Sum64()
+}
+
+// layeredLayout places nodes in rows, each node below the nodes it is
+// adjacent from, ordering the nodes of each row so as to keep nodes near
+// the nodes they are adjacent to. Cycles are broken at the edges going
+// back up.
+func layeredLayout(g graph) []Position {
+	n := len(g.ids)
+
+	// Order the nodes such that edges go forward, but for the ones
+	// closing cycles, by depth-first search.
+	var (
+		order   = make([]int, 0, n)
+		visited = make([]bool, n)
+		visit   func(int)
+	)
+	visit = func(i int) {
+		visited[i] = true
+		for _, j := range g.edges[i] {
+			if !visited[j] {
+				visit(j)
+			}
+		}
+		order = append(order, i)
+	}
+	for i := range g.ids {
+		if !visited[i] {
+			visit(i)
+		}
+	}
+	rank := make([]int, n)
+	for r, i := range order {
+		rank[i] = n - 1 - r
+	}
+
+	// Each node is a row below the lowest of the nodes adjacent to it.
+	layer := make([]int, n)
+	layers := 0
+	for r := n - 1; r >= 0; r-- {
+		i := order[r]
+		for _, j := range g.edges[i] {
+			if rank[j] > rank[i] && layer[j] < layer[i]+1 {
+				layer[j] = layer[i] + 1
+			}
+		}
+		if layer[i]+1 > layers {
+			layers = layer[i] + 1
+		}
+	}
+	rows := make([][]int, layers)
+	for i := range g.ids {
+		rows[layer[i]] = append(rows[layer[i]], i)
+	}
+
+	// Order each row by the mean position of the nodes' neighbours, in
+	// sweeps down and up the rows.
+	neighbours := make([][]int, n)
+	for i, edges := range g.edges {
+		for _, j := range edges {
+			neighbours[i] = append(neighbours[i], j)
+			neighbours[j] = append(neighbours[j], i)
+		}
+	}
+	column := make([]float64, n)
+	for _, row := range rows {
+		for c, i := range row {
+			column[i] = float64(c)
+		}
+	}
+	for sweep := 0; sweep < 4; sweep++ {
+		for r := range rows {
+			if sweep%2 == 1 {
+				r = len(rows) - 1 - r
+			}
+			row := rows[r]
+			barycentre := make(map[int]float64, len(row))
+			for _, i := range row {
+				sum, count := 0.0, 0
+				for _, j := range neighbours[i] {
+					if layer[j] != layer[i] {
+						sum += column[j]
+						count++
+					}
+				}
+				if count > 0 {
+					barycentre[i] = sum / float64(count)
+				} else {
+					barycentre[i] = column[i]
+				}
+			}
+			sort.SliceStable(row, func(a, b int) bool { return barycentre[row[a]] < barycentre[row[b]] })
+			for c, i := range row {
+				column[i] = float64(c)
+			}
+		}
+	}
+
+	positions := make([]Position, n)
+	for _, row := range rows {
+		offset := float64(len(row)-1) / 2
+		for c, i := range row {
+			positions[i] = Position{X: (float64(c) - offset) * nodeSpacing, Y: float64(layer[i]) * nodeSpacing}
+		}
+	}
+	return positions
+}
+
+// forceLayout places nodes by Fruchterman and Reingold's force-directed
+// algorithm: nodes push each other away, and edges pull the nodes they
+// join together. Nodes only push the nodes near them, which are found in
+// a grid, so large graphs are laid out in linear time.
+func forceLayout(g graph) []Position {
+	n := len(g.ids)
+	positions := make([]Position, n)
+	if n == 0 {
+		return positions
+	}
+
+	// Start on a spiral, so the layout is the same every time
+	for i := range positions {
+		angle := float64(i) * 2.399963 // the golden angle
+		radius := nodeSpacing * math.Sqrt(float64(i))
+		positions[i] = Position{X: radius * math.Cos(angle), Y: radius * math.Sin(angle)}
+	}
+
+	type cell struct{ x, y int }
+	var (
+		k            = nodeSpacing
+		cellSize     = 2 * k
+		temperature  = nodeSpacing * math.Sqrt(float64(n)) / 10
+		cooling      = temperature / forceIterations
+		displacement = make([]Position, n)
+	)
+	cellOf := func(p Position) cell {
+		return cell{int(math.Floor(p.X / cellSize)), int(math.Floor(p.Y / cellSize))}
+	}
+	for iteration := 0; iteration < forceIterations; iteration++ {
+		grid := map[cell][]int{}
+		for i, p := range positions {
+			c := cellOf(p)
+			grid[c] = append(grid[c], i)
+		}
+		for i := range displacement {
+			displacement[i] = Position{}
+		}
+
+		for i, p := range positions {
+			c := cellOf(p)
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					for _, j := range grid[cell{c.x + dx, c.y + dy}] {
+						if j == i {
+							continue
+						}
+						x, y := p.X-positions[j].X, p.Y-positions[j].Y
+						d := math.Max(math.Hypot(x, y), 0.01)
+						if d > cellSize {
+							continue
+						}
+						force := k * k / d
+						displacement[i].X += x / d * force
+						displacement[i].Y += y / d * force
+					}
+				}
+			}
+		}
+		for i, edges := range g.edges {
+			for _, j := range edges {
+				x, y := positions[i].X-positions[j].X, positions[i].Y-positions[j].Y
+				d := math.Max(math.Hypot(x, y), 0.01)
+				force := d * d / k
+				displacement[i].X -= x / d * force
+				displacement[i].Y -= y / d * force
+				displacement[j].X += x / d * force
+				displacement[j].Y += y / d * force
+			}
+		}
+
+		for i, d := range displacement {
+			length := math.Max(math.Hypot(d.X, d.Y), 0.01)
+			step := math.Min(length, temperature)
+			positions[i].X += d.X / length * step
+			positions[i].Y += d.Y / length * step
+		}
+		temperature -= cooling
+	}
+	return positions
+}
@@ -0,0 +1,60 @@
+package detailed_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func makeChain(n int) detailed.NodeSummaries {
+	nodes := detailed.NodeSummaries{}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("node%03d", i)
+		summary := detailed.NodeSummary{BasicNodeSummary: detailed.BasicNodeSummary{ID: id}}
+		if i+1 < n {
+			summary.Adjacency = report.MakeIDList(fmt.Sprintf("node%03d", i+1))
+		}
+		nodes[id] = summary
+	}
+	return nodes
+}
+
+func TestLayout(t *testing.T) {
+	if err := detailed.CheckLayout("circular"); err == nil {
+		t.Error("Expected an error for an unknown layout")
+	}
+
+	nodes := makeChain(3)
+	// a cycle
+	last := nodes["node002"]
+	last.Adjacency = report.MakeIDList("node000")
+	nodes["node002"] = last
+
+	layered := detailed.MakeLayout(detailed.LayeredLayout, nodes)
+	if len(layered) != 3 {
+		t.Fatalf("Expected all nodes to be placed, got %v", layered)
+	}
+	for i, id := range []string{"node000", "node001", "node002"} {
+		if layered[id].Y != float64(i)*100 {
+			t.Errorf("Expected %s in row %d, got %v", id, i, layered[id])
+		}
+	}
+
+	for _, name := range []string{detailed.ForceLayout, detailed.LayeredLayout} {
+		layout := detailed.MakeLayout(name, makeChain(200))
+		seen := map[detailed.Position]bool{}
+		for id, p := range layout {
+			if seen[p] {
+				t.Errorf("%s: expected %s to have a place of its own, got %v", name, id, p)
+			}
+			seen[p] = true
+		}
+		// Graphs of the same shape are laid out once
+		if again := detailed.MakeLayout(name, makeChain(200)); reflect.ValueOf(again).Pointer() != reflect.ValueOf(layout).Pointer() {
+			t.Errorf("%s: expected the cached layout", name)
+		}
+	}
+}
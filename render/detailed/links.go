@@ -45,27 +45,35 @@ var (
 		},
 	}
 
-	// Queries on pod names of the format `name-<id>-<hash>`
+	// Filters on pod names of the format `name-<id>-<hash>`
 	// See also:  https://kubernetes.io/docs/concepts/workloads/controllers/deployment/#pod-template-hash-label
-	podIDHashQueries = formatMetricQueries(`pod_name=~"^{{label}}-[^-]+-[^-]+$",namespace="{{namespace}}"`, []string{docker.MemoryUsage, docker.CPUTotalUsage})
+	podIDHashFilter = `pod_name=~"^{{label}}-[^-]+-[^-]+$",namespace="{{namespace}}"`
+
+	// Filters on the cAdvisor series of the containers of topologies
+	topologyFilters = map[string]string{
+		report.Container:      `name="{{containerName}}"`,
+		report.ContainerImage: `image="{{label}}"`,
+		report.Pod:            `pod_name="{{label}}",namespace="{{namespace}}"`,
+		report.DaemonSet:      `pod_name=~"^{{label}}-[^-]+$",namespace="{{namespace}}"`,
+		report.Deployment:     podIDHashFilter,
+		report.StatefulSet:    podIDHashFilter,
+		report.CronJob:        podIDHashFilter,
+	}
 
 	// Prometheus queries for topologies
 	topologyQueries = map[string]map[string]string{
 		// Containers
 
-		report.Container:      formatMetricQueries(`name="{{containerName}}"`, []string{docker.MemoryUsage, docker.CPUTotalUsage}),
-		report.ContainerImage: formatMetricQueries(`image="{{label}}"`, []string{docker.MemoryUsage, docker.CPUTotalUsage}),
+		report.Container:      formatMetricQueries(topologyFilters[report.Container], []string{docker.MemoryUsage, docker.CPUTotalUsage}),
+		report.ContainerImage: formatMetricQueries(topologyFilters[report.ContainerImage], []string{docker.MemoryUsage, docker.CPUTotalUsage}),
 
 		// Kubernetes topologies
 
-		report.Pod: formatMetricQueries(
-			`pod_name="{{label}}",namespace="{{namespace}}"`,
-			[]string{docker.MemoryUsage, docker.CPUTotalUsage},
-		),
-		report.DaemonSet:   formatMetricQueries(`pod_name=~"^{{label}}-[^-]+$",namespace="{{namespace}}"`, []string{docker.MemoryUsage, docker.CPUTotalUsage}),
-		report.Deployment:  podIDHashQueries,
-		report.StatefulSet: podIDHashQueries,
-		report.CronJob:     podIDHashQueries,
+		report.Pod:         formatMetricQueries(topologyFilters[report.Pod], []string{docker.MemoryUsage, docker.CPUTotalUsage}),
+		report.DaemonSet:   formatMetricQueries(topologyFilters[report.DaemonSet], []string{docker.MemoryUsage, docker.CPUTotalUsage}),
+		report.Deployment:  formatMetricQueries(podIDHashFilter, []string{docker.MemoryUsage, docker.CPUTotalUsage}),
+		report.StatefulSet: formatMetricQueries(podIDHashFilter, []string{docker.MemoryUsage, docker.CPUTotalUsage}),
+		report.CronJob:     formatMetricQueries(podIDHashFilter, []string{docker.MemoryUsage, docker.CPUTotalUsage}),
 		report.Service: {
 			// These recording rules must be defined in the prometheus config.
 			// NB: Pods need to be labeled and selected by their respective Service name, meaning:
@@ -100,6 +108,41 @@ func formatMetricQueries(filter string, ids []string) map[string]string {
 	return queries
 }
 
+// HistoryQuery is how to get the history of a metric from Prometheus remote
+// read, which only selects series: the series to read, and how to combine
+// them into the metric, in the way the query of the metric does.
+type HistoryQuery struct {
+	// Series is a series selector, e.g. container_memory_usage_bytes{name="foo"}
+	Series string
+	// Rate is whether the series are counters, whose rate makes the metric
+	Rate bool
+	// Mean is whether the series are averaged, rather than added up
+	Mean bool
+	// Scale multiplies the metric, if set
+	Scale float64
+}
+
+// MetricHistoryQuery returns how to get the history of the given metric of a
+// node, for the topologies with cAdvisor series.
+func MetricHistoryQuery(summary NodeSummary, n report.Node, metricID string) (HistoryQuery, bool) {
+	filter, ok := topologyFilters[n.Topology]
+	if !ok {
+		return HistoryQuery{}, false
+	}
+	filter = queryReplacer(summary, n).Replace(filter)
+	switch metricID {
+	case docker.MemoryUsage:
+		return HistoryQuery{Series: fmt.Sprintf("container_memory_usage_bytes{%s}", filter)}, true
+	case docker.CPUTotalUsage:
+		return HistoryQuery{Series: fmt.Sprintf("container_cpu_usage_seconds_total{%s}", filter), Rate: true, Mean: true, Scale: 100}, true
+	case idReceiveBytes:
+		return HistoryQuery{Series: fmt.Sprintf("container_network_receive_bytes_total{%s}", filter), Rate: true}, true
+	case idTransmitBytes:
+		return HistoryQuery{Series: fmt.Sprintf("container_network_transmit_bytes_total{%s}", filter), Rate: true}, true
+	}
+	return HistoryQuery{}, false
+}
+
 // RenderMetricURLs sets respective URLs for metrics in a node summary. Missing metrics
 // where we have a query for will be appended as an empty metric (no values or samples).
 func RenderMetricURLs(summary NodeSummary, n report.Node, metricsGraphURL string) NodeSummary {
@@ -161,14 +204,18 @@ func metricQuery(summary NodeSummary, n report.Node, metricID string) string {
 		return ""
 	}
 
+	return queryReplacer(summary, n).Replace(queries[metricID])
+}
+
+// queryReplacer fills in the variables of queries for the given node.
+func queryReplacer(summary NodeSummary, n report.Node) *strings.Replacer {
 	namespace, _ := n.Latest.Lookup(kubernetes.Namespace)
 	name, _ := n.Latest.Lookup(docker.ContainerName)
-	r := strings.NewReplacer(
+	return strings.NewReplacer(
 		"{{label}}", summary.Label,
 		"{{namespace}}", namespace,
 		"{{containerName}}", name,
 	)
-	return r.Replace(queries[metricID])
 }
 
 // metricURL builds the URL by embedding it into the configured `metricsGraphURL`.
@@ -8,6 +8,7 @@ import (
 
 	"github.com/weaveworks/scope/probe/awsecs"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/gpu"
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
@@ -82,6 +83,7 @@ func (c *ControlInstance) CodecDecodeSelf(decoder *codec.Decoder) {
 type RenderContext struct {
 	report.Report
 	MetricsGraphURL string
+	Traces          Traces
 }
 
 // MakeNode transforms a renderable node to a detailed node. It uses
@@ -92,10 +94,16 @@ func MakeNode(topologyID string, rc RenderContext, ns report.Nodes, n report.Nod
 		NodeSummary: summary,
 		Controls:    controls(rc.Report, n),
 		Children:    children(rc, n),
-		Connections: []ConnectionsSummary{
-			incomingConnectionsSummary(topologyID, rc.Report, n, ns),
-			outgoingConnectionsSummary(topologyID, rc.Report, n, ns),
-		},
+		Connections: MakeConnections(topologyID, rc, ns, n),
+	}
+}
+
+// MakeConnections makes the tables of the connections to and from a node,
+// as in its details, for them to be asked for on their own.
+func MakeConnections(topologyID string, rc RenderContext, ns report.Nodes, n report.Node) []ConnectionsSummary {
+	return []ConnectionsSummary{
+		incomingConnectionsSummary(topologyID, rc.Report, n, ns),
+		outgoingConnectionsSummary(topologyID, rc.Report, n, ns),
 	}
 }
 
@@ -157,6 +165,16 @@ var nodeSummaryGroupSpecs = []struct {
 			},
 		},
 	},
+	{
+		topologyID: report.GPU,
+		NodeSummaryGroup: NodeSummaryGroup{
+			Label: "GPUs",
+			Columns: []Column{
+				{ID: gpu.Utilization, Label: "Utilization", Datatype: report.Number},
+				{ID: gpu.MemoryUsage, Label: "Memory", Datatype: report.Number},
+			},
+		},
+	},
 	{
 		topologyID: report.Container,
 		NodeSummaryGroup: NodeSummaryGroup{
@@ -226,7 +244,7 @@ func children(rc RenderContext, n report.Node) []NodeSummaryGroup {
 		if !ok {
 			continue
 		}
-		apiTopology, ok := primaryAPITopology[topologyID]
+		apiTopology, ok := apiTopologyID(rc.Report, topologyID)
 		if !ok {
 			continue
 		}
@@ -234,6 +252,7 @@ func children(rc RenderContext, n report.Node) []NodeSummaryGroup {
 		group := NodeSummaryGroup{
 			TopologyID: apiTopology,
 			Label:      topology.LabelPlural,
+			Nodes:      nodeSummaries,
 			Columns:    []Column{},
 		}
 		nodeSummaryGroups = append(nodeSummaryGroups, group)
@@ -24,6 +24,10 @@ var parentTopologies = []string{
 	report.ECSTask,
 	report.ECSService,
 	report.SwarmService,
+	report.NomadAllocation,
+	report.NomadTaskGroup,
+	report.NomadJob,
+	report.GPU,
 	report.Host,
 }
 
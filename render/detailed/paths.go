@@ -0,0 +1,176 @@
+package detailed
+
+import (
+	"sort"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Bounds of path queries.
+const (
+	DefaultPathLength = 4
+	MaxPathLength     = 8
+	MaxPaths          = 100
+	MaxPathVisits     = 100000
+)
+
+// Paths are the ways one node reaches another, through the connections of
+// the nodes of a topology, as processes, those they are made of or part
+// of. Truncated is set if there were more than MaxPaths.
+type Paths struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Via       string `json:"via"`
+	MaxLength int    `json:"maxLength"`
+	Paths     []Path `json:"paths"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Path is a way from one node to another, hop by hop, first to last.
+type Path struct {
+	Nodes []PathNode `json:"nodes"`
+}
+
+// PathNode is a hop of a path, with its parents, as the container and host
+// of a process.
+type PathNode struct {
+	BasicNodeSummary
+	Parents []Parent `json:"parents,omitempty"`
+}
+
+// RelatedNodes returns the IDs of the nodes which are n, are part of n, or
+// n is part of, among nodes of another topology, sorted. This is how nodes
+// of one topology are found in another.
+func RelatedNodes(nodes report.Nodes, n report.Node) []string {
+	result := []string{}
+	for id, candidate := range nodes {
+		if id == n.ID || isPartOf(candidate, n) || isPartOf(n, candidate) {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func isPartOf(child, parent report.Node) bool {
+	if _, ok := parent.Children.Lookup(child.ID); ok {
+		return true
+	}
+	parents, ok := child.Parents.Lookup(parent.Topology)
+	return ok && parents.Contains(parent.ID)
+}
+
+// FindPaths finds the simple paths, of at most maxLength connections,
+// from any of the from nodes to any of the to nodes, among nodes. It gives
+// up after maxPaths, or after visiting MaxPathVisits nodes, returning true
+// if there may have been more.
+func FindPaths(nodes report.Nodes, from, to []string, maxLength, maxPaths int) ([][]string, bool) {
+	var (
+		distances = distancesTo(nodes, to, maxLength)
+		result    [][]string
+		truncated bool
+		visits    int
+		path      []string
+		onPath    = map[string]struct{}{}
+		walk      func(id string)
+	)
+	walk = func(id string) {
+		if truncated {
+			return
+		}
+		if visits++; visits > MaxPathVisits {
+			truncated = true
+			return
+		}
+		path = append(path, id)
+		onPath[id] = struct{}{}
+		defer func() {
+			path = path[:len(path)-1]
+			delete(onPath, id)
+		}()
+
+		if distances[id] == 0 && len(path) > 1 {
+			if len(result) == maxPaths {
+				truncated = true
+				return
+			}
+			result = append(result, append([]string{}, path...))
+			return
+		}
+		// Only go where a target can still be reached from
+		remaining := maxLength - len(path)
+		for _, next := range nodes[id].Adjacency {
+			if _, ok := onPath[next]; ok {
+				continue
+			}
+			if distance, ok := distances[next]; ok && distance <= remaining {
+				walk(next)
+			}
+		}
+	}
+	for _, id := range from {
+		if _, ok := distances[id]; ok {
+			walk(id)
+		}
+	}
+	// Shortest first
+	sort.SliceStable(result, func(i, j int) bool { return len(result[i]) < len(result[j]) })
+	return result, truncated
+}
+
+// distancesTo returns the fewest connections each of nodes is from any of
+// the to nodes, breadth first along connections backwards, for those at
+// most maxLength from them.
+func distancesTo(nodes report.Nodes, to []string, maxLength int) map[string]int {
+	inbound := map[string][]string{}
+	for id, n := range nodes {
+		for _, next := range n.Adjacency {
+			if _, ok := nodes[next]; ok {
+				inbound[next] = append(inbound[next], id)
+			}
+		}
+	}
+	distances := map[string]int{}
+	queue := []string{}
+	for _, id := range to {
+		if _, ok := nodes[id]; ok {
+			distances[id] = 0
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if distances[id] == maxLength {
+			continue
+		}
+		for _, prev := range inbound[id] {
+			if _, ok := distances[prev]; !ok {
+				distances[prev] = distances[id] + 1
+				queue = append(queue, prev)
+			}
+		}
+	}
+	return distances
+}
+
+// MakePaths finds the paths from the node from, to the node to, of other
+// topologies maybe, through nodes, of the via topology.
+func MakePaths(r report.Report, nodes report.Nodes, from, to report.Node, via string, maxLength int) Paths {
+	result := Paths{From: from.ID, To: to.ID, Via: via, MaxLength: maxLength, Paths: []Path{}}
+	paths, truncated := FindPaths(nodes, RelatedNodes(nodes, from), RelatedNodes(nodes, to), maxLength, MaxPaths)
+	result.Truncated = truncated
+	for _, ids := range paths {
+		path := Path{Nodes: make([]PathNode, 0, len(ids))}
+		for _, id := range ids {
+			n := nodes[id]
+			summary, ok := MakeBasicNodeSummary(r, n)
+			if !ok {
+				summary = BasicNodeSummary{ID: id, Label: id}
+			}
+			path.Nodes = append(path.Nodes, PathNode{BasicNodeSummary: summary, Parents: Parents(r, n)})
+		}
+		result.Paths = append(result.Paths, path)
+	}
+	return result
+}
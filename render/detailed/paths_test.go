@@ -0,0 +1,97 @@
+package detailed_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestFindPaths(t *testing.T) {
+	// a -> b -> d, a -> c -> d, c -> a, d -> e
+	nodes := report.Nodes{
+		"a": report.MakeNode("a").WithAdjacent("b", "c"),
+		"b": report.MakeNode("b").WithAdjacent("d"),
+		"c": report.MakeNode("c").WithAdjacent("a", "d"),
+		"d": report.MakeNode("d").WithAdjacent("e"),
+		"e": report.MakeNode("e"),
+	}
+	for _, c := range []struct {
+		from, to  []string
+		maxLength int
+		maxPaths  int
+		want      [][]string
+		truncated bool
+	}{
+		{[]string{"a"}, []string{"d"}, 2, 10, [][]string{{"a", "b", "d"}, {"a", "c", "d"}}, false},
+		{[]string{"a"}, []string{"d"}, 1, 10, nil, false},
+		{[]string{"a"}, []string{"e"}, 3, 10, [][]string{{"a", "b", "d", "e"}, {"a", "c", "d", "e"}}, false},
+		{[]string{"a"}, []string{"d"}, 2, 1, [][]string{{"a", "b", "d"}}, true},
+		{[]string{"c"}, []string{"b", "d"}, 4, 10, [][]string{{"c", "d"}, {"c", "a", "b"}}, false},
+		{[]string{"e"}, []string{"a"}, 4, 10, nil, false},
+	} {
+		have, truncated := detailed.FindPaths(nodes, c.from, c.to, c.maxLength, c.maxPaths)
+		if !reflect.DeepEqual(c.want, have) || c.truncated != truncated {
+			t.Errorf("From %v to %v in %d: expected %v (truncated: %v), got %v (truncated: %v)", c.from, c.to, c.maxLength, c.want, c.truncated, have, truncated)
+		}
+	}
+}
+
+func TestFindPathsDense(t *testing.T) {
+	// Every node connects to every other, and to a, which connects to t
+	nodes := report.Nodes{"t": report.MakeNode("t")}
+	ids := []string{}
+	for i := 0; i < 30; i++ {
+		ids = append(ids, fmt.Sprintf("n%d", i))
+	}
+	for _, id := range ids {
+		nodes[id] = report.MakeNode(id).WithAdjacent(append(ids, "a")...)
+	}
+	nodes["a"] = report.MakeNode("a").WithAdjacent("t")
+
+	// There are too many paths to visit them all
+	have, truncated := detailed.FindPaths(nodes, []string{"n0"}, []string{"n1", "t"}, detailed.MaxPathLength, 1<<30)
+	if len(have) == 0 || !truncated {
+		t.Errorf("Expected truncated paths, got %d (truncated: %v)", len(have), truncated)
+	}
+
+	// Nodes from which the targets can't be reached aren't walked
+	have, truncated = detailed.FindPaths(nodes, []string{"t"}, []string{"n0"}, detailed.MaxPathLength, 1<<30)
+	if have != nil || truncated {
+		t.Errorf("Expected no paths, got %v (truncated: %v)", have, truncated)
+	}
+
+	// Nor is further than the targets can be reached in the length left
+	have, truncated = detailed.FindPaths(nodes, []string{"n0"}, []string{"t"}, 2, 1<<30)
+	if want := [][]string{{"n0", "a", "t"}}; !reflect.DeepEqual(want, have) || truncated {
+		t.Errorf("Expected %v, got %v (truncated: %v)", want, have, truncated)
+	}
+}
+
+func TestRelatedNodes(t *testing.T) {
+	process := report.MakeNode(report.MakeProcessNodeID("host", "1")).WithTopology(report.Process).
+		WithParents(report.MakeSets().Add(report.Container, report.MakeStringSet(report.MakeContainerNodeID("c1"))))
+	other := report.MakeNode(report.MakeProcessNodeID("host", "2")).WithTopology(report.Process)
+	container := report.MakeNode(report.MakeContainerNodeID("c2")).WithTopology(report.Container).
+		WithChild(other)
+	processes := report.Nodes{process.ID: process, other.ID: other}
+
+	// A container is related to the processes in it, by their parents or
+	// its children
+	if want, have := []string{process.ID}, detailed.RelatedNodes(processes, report.MakeNode(report.MakeContainerNodeID("c1")).WithTopology(report.Container)); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if want, have := []string{other.ID}, detailed.RelatedNodes(processes, container); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	// A process is related to the container it is in, and itself
+	containers := report.Nodes{container.ID: container}
+	if want, have := []string{container.ID}, detailed.RelatedNodes(containers, other); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if want, have := []string{process.ID}, detailed.RelatedNodes(processes, process); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
@@ -0,0 +1,73 @@
+package detailed
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultScaleBuckets is how many quantile buckets nodes are scaled into,
+// unless asked otherwise.
+const DefaultScaleBuckets = 5
+
+// ScaledValue is the value of a field of a node, scaled against the other
+// nodes' for coloring or sizing the node: Normalized from 0, for the least
+// value, to 1, for the greatest, and in Bucket 0 to n-1 of n quantiles.
+type ScaledValue struct {
+	Value      float64 `json:"value"`
+	Normalized float64 `json:"normalized"`
+	Bucket     int     `json:"bucket"`
+}
+
+// NodeField returns the value of the metric, or numeric metadata, of the
+// node named by ID or label.
+func NodeField(node NodeSummary, name string) (float64, bool) {
+	for _, metric := range node.Metrics {
+		if !metric.ValueEmpty && (metric.ID == name || strings.EqualFold(metric.Label, name)) {
+			return metric.Value, true
+		}
+	}
+	for _, row := range node.Metadata {
+		if row.ID == name || strings.EqualFold(row.Label, name) {
+			value, err := strconv.ParseFloat(row.Value, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+// Scale scales the field of the summaries having it into buckets
+// quantiles, by node ID. Nodes with the same value are in the same bucket.
+func Scale(summaries NodeSummaries, field string, buckets int) map[string]ScaledValue {
+	var (
+		ids    []string
+		values []float64
+	)
+	for id, summary := range summaries {
+		if value, ok := NodeField(summary, field); ok {
+			ids = append(ids, id)
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	min, max := sorted[0], sorted[len(sorted)-1]
+
+	result := make(map[string]ScaledValue, len(ids))
+	for i, id := range ids {
+		value := values[i]
+		scaled := ScaledValue{Value: value}
+		if max > min {
+			scaled.Normalized = (value - min) / (max - min)
+		}
+		if buckets > 0 {
+			rank := sort.SearchFloat64s(sorted, value)
+			scaled.Bucket = rank * buckets / len(sorted)
+		}
+		result[id] = scaled
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package detailed_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestScale(t *testing.T) {
+	summaries := detailed.NodeSummaries{}
+	for id, value := range map[string]float64{"a": 0, "b": 10, "c": 10, "d": 30, "e": 40} {
+		summaries[id] = detailed.NodeSummary{Metrics: []report.MetricRow{{ID: "cpu", Label: "CPU", Value: value}}}
+	}
+	summaries["f"] = detailed.NodeSummary{Metadata: []report.MetadataRow{{ID: "restarts", Value: "40"}}}
+	summaries["g"] = detailed.NodeSummary{}
+
+	have := detailed.Scale(summaries, "cpu", 5)
+	want := map[string]detailed.ScaledValue{
+		"a": {Value: 0, Normalized: 0, Bucket: 0},
+		"b": {Value: 10, Normalized: 0.25, Bucket: 1},
+		"c": {Value: 10, Normalized: 0.25, Bucket: 1},
+		"d": {Value: 30, Normalized: 0.75, Bucket: 3},
+		"e": {Value: 40, Normalized: 1, Bucket: 4},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+	if have := detailed.Scale(summaries, "CPU", 2)["d"].Bucket; have != 1 {
+		t.Errorf("Expected bucket 1 by label, got %d", have)
+	}
+	if have := detailed.Scale(summaries, "restarts", 5); !reflect.DeepEqual(map[string]detailed.ScaledValue{"f": {Value: 40}}, have) {
+		t.Errorf("Expected the metadata field scaled, got %v", have)
+	}
+	if have := detailed.Scale(summaries, "memory", 5); have != nil {
+		t.Errorf("Expected nothing scaled, got %v", have)
+	}
+}
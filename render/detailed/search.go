@@ -0,0 +1,407 @@
+package detailed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// A Search is a parsed search query, as typed in the UI, which nodes are
+// matched against by their summaries. Queries are made of terms:
+//
+//   - text, or "quoted text": the label, minor label, metadata, parents or
+//     property lists of the node contain the text.
+//   - field:text: the field, named by its ID or label, contains the text.
+//     Fields are metadata, property list rows, label and labelMinor, and
+//     parents, by the ID of their topology.
+//   - metric > 80, and <, >=, <=, = and !=: the metric, named by its ID or
+//     label, compares so with the value. Values may be given in KB, MB, GB
+//     or TB.
+//   - key=value and key!=value: the node has, or hasn't, the Docker or
+//     Kubernetes label. = and != compare metrics instead if the value is a
+//     number and the node has such a metric.
+//
+// Terms are matched case-insensitively, and combined with AND (or just by
+// being next to each other), OR and NOT, grouped with parentheses.
+type Search interface {
+	Match(NodeSummary) bool
+}
+
+// ParseSearch parses the query. The empty query matches everything.
+func ParseSearch(query string) (Search, error) {
+	p := searchParser{tokens: searchTokens(query)}
+	if len(p.tokens) == 0 {
+		return searchAll{}, nil
+	}
+	search, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return search, nil
+}
+
+// SearchFilter returns a filter for the nodes matching the search, as they
+// are summarised in rc.
+func SearchFilter(rc RenderContext, search Search) render.FilterFunc {
+	return func(n report.Node) bool {
+		summary, ok := MakeNodeSummary(rc, n)
+		return ok && search.Match(summary)
+	}
+}
+
+type searchAll struct{}
+
+func (searchAll) Match(NodeSummary) bool { return true }
+
+type searchAnd []Search
+
+func (s searchAnd) Match(n NodeSummary) bool {
+	for _, search := range s {
+		if !search.Match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+type searchOr []Search
+
+func (s searchOr) Match(n NodeSummary) bool {
+	for _, search := range s {
+		if search.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+type searchNot struct{ Search }
+
+func (s searchNot) Match(n NodeSummary) bool { return !s.Search.Match(n) }
+
+// searchText is a text term, of a field if it is given.
+type searchText struct {
+	field string // slugified
+	text  string // lower case
+}
+
+func (s searchText) Match(n NodeSummary) bool {
+	match := func(id, label, value string) bool {
+		if s.field != "" && slugify(id) != s.field && !strings.Contains(slugify(label), s.field) {
+			return false
+		}
+		return strings.Contains(strings.ToLower(value), s.text)
+	}
+	if match("label", "label", n.Label) || match("labelMinor", "labelMinor", n.LabelMinor) {
+		return true
+	}
+	for _, row := range n.Metadata {
+		if match(row.ID, row.Label, row.Value) {
+			return true
+		}
+	}
+	for _, parent := range n.Parents {
+		if match(parent.TopologyID, parent.TopologyID, parent.Label) {
+			return true
+		}
+	}
+	for _, table := range n.Tables {
+		if table.Type != report.PropertyListType {
+			continue
+		}
+		for _, row := range table.Rows {
+			if match(row.ID, row.Entries["label"], row.Entries["value"]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchComparison compares a metric, or for = and !=, a label.
+type searchComparison struct {
+	name   string // of the metric, or the label
+	op     string
+	value  string
+	number float64
+	isNum  bool
+}
+
+func (s searchComparison) Match(n NodeSummary) bool {
+	if s.isNum {
+		for _, metric := range n.Metrics {
+			if metric.ValueEmpty || (metric.ID != s.name && slugify(metric.Label) != slugify(s.name)) {
+				continue
+			}
+			switch s.op {
+			case ">":
+				return metric.Value > s.number
+			case ">=":
+				return metric.Value >= s.number
+			case "<":
+				return metric.Value < s.number
+			case "<=":
+				return metric.Value <= s.number
+			case "=":
+				return metric.Value == s.number
+			case "!=":
+				return metric.Value != s.number
+			}
+		}
+	}
+	if s.op != "=" && s.op != "!=" {
+		return false
+	}
+	value, ok := nodeLabel(n, s.name)
+	if s.op == "=" {
+		return ok && value == s.value
+	}
+	return !ok || value != s.value
+}
+
+// nodeLabel returns the value of the Docker or Kubernetes label key of the
+// node.
+func nodeLabel(n NodeSummary, key string) (string, bool) {
+	for _, table := range n.Tables {
+		if table.ID != docker.LabelPrefix && table.ID != kubernetes.LabelPrefix {
+			continue
+		}
+		for _, row := range table.Rows {
+			if row.Entries["label"] == key {
+				return row.Entries["value"], true
+			}
+		}
+	}
+	return "", false
+}
+
+// slugify lowers the case of label, and drops all but letters and digits,
+// as the UI does to match field names.
+func slugify(label string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return -1
+	}, label)
+}
+
+var searchOperators = []string{">=", "<=", "!=", ">", "<", "="}
+
+// searchUnits are what values in comparisons may be given in.
+var searchUnits = map[string]float64{
+	"":   1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"t":  1 << 40,
+	"tb": 1 << 40,
+	"%":  1,
+}
+
+// parseSearchValue parses a number, with a unit, as 2KB.
+func parseSearchValue(value string) (float64, bool) {
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+')
+	})
+	if i < 0 {
+		i = len(value)
+	}
+	multiplier, ok := searchUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	return number * multiplier, true
+}
+
+// searchToken is a word, parenthesis or quoted text of a query.
+type searchToken struct {
+	text   string
+	quoted bool
+}
+
+func (t searchToken) String() string { return t.text }
+
+func (t searchToken) is(keyword string) bool { return !t.quoted && t.text == keyword }
+
+// searchTokens splits the query into tokens. Quotes in the middle of
+// words, as in field:"some text", are kept, to be unquoted later.
+func searchTokens(query string) []searchToken {
+	var tokens []searchToken
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, searchToken{text: string(c)})
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				end = len(query) - i - 1
+			}
+			tokens = append(tokens, searchToken{text: query[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		default:
+			start, quoted := i, false
+			for ; i < len(query); i++ {
+				c := query[i]
+				if c == '"' {
+					quoted = !quoted
+				} else if !quoted && (c == ' ' || c == '\t' || c == '\n' || c == '(' || c == ')') {
+					break
+				}
+			}
+			tokens = append(tokens, searchToken{text: query[start:i]})
+		}
+	}
+	return tokens
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+func (p *searchParser) peek() (searchToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return searchToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *searchParser) or() (Search, error) {
+	var or searchOr
+	for {
+		and, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, and)
+		if tok, ok := p.peek(); !ok || !tok.is("OR") {
+			break
+		}
+		p.pos++
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *searchParser) and() (Search, error) {
+	var and searchAnd
+	for {
+		not, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, not)
+		tok, ok := p.peek()
+		if !ok || tok.is("OR") || tok.is(")") {
+			break
+		}
+		if tok.is("AND") {
+			p.pos++
+		}
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *searchParser) not() (Search, error) {
+	if tok, ok := p.peek(); ok && tok.is("NOT") {
+		p.pos++
+		search, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return searchNot{search}, nil
+	}
+	return p.term()
+}
+
+func (p *searchParser) term() (Search, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expected a term at the end of the query")
+	}
+	if tok.is("AND") || tok.is("OR") || tok.is(")") {
+		return nil, fmt.Errorf("expected a term, found %q", tok)
+	}
+	p.pos++
+	if tok.is("(") {
+		search, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok := p.peek(); !ok || !tok.is(")") {
+			return nil, fmt.Errorf("expected \")\"")
+		}
+		p.pos++
+		return search, nil
+	}
+	if tok.quoted {
+		return searchText{text: strings.ToLower(tok.text)}, nil
+	}
+
+	// Comparisons may be split across tokens, as cpu > 80
+	text := tok.text
+	for p.startsWithOperator() || (endsWithOperator(text) && p.pos < len(p.tokens) && !p.tokens[p.pos].is(")")) {
+		text += p.tokens[p.pos].text
+		p.pos++
+	}
+
+	if i := strings.IndexByte(text, ':'); i > 0 && strings.IndexAny(text[:i], "<>=!") < 0 {
+		return searchText{field: slugify(text[:i]), text: strings.ToLower(unquote(text[i+1:]))}, nil
+	}
+	for _, op := range searchOperators {
+		if i := strings.Index(text, op); i > 0 {
+			name, value := text[:i], unquote(text[i+len(op):])
+			if value == "" {
+				return nil, fmt.Errorf("expected a value after %q", text)
+			}
+			number, isNum := parseSearchValue(value)
+			if !isNum && op != "=" && op != "!=" {
+				return nil, fmt.Errorf("expected a number after %q", name+op)
+			}
+			return searchComparison{name: name, op: op, value: value, number: number, isNum: isNum}, nil
+		}
+	}
+	return searchText{text: strings.ToLower(unquote(text))}, nil
+}
+
+// startsWithOperator tells whether the next token starts with a comparison
+// operator.
+func (p *searchParser) startsWithOperator() bool {
+	tok, ok := p.peek()
+	return ok && !tok.quoted && strings.IndexAny(tok.text, "<>=!") == 0
+}
+
+func endsWithOperator(text string) bool {
+	return text != "" && strings.IndexAny(text[len(text)-1:], "<>=") == 0
+}
+
+func unquote(s string) string {
+	return strings.Replace(s, `"`, "", -1)
+}
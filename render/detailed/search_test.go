@@ -0,0 +1,81 @@
+package detailed_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestSearch(t *testing.T) {
+	node := detailed.NodeSummary{
+		BasicNodeSummary: detailed.BasicNodeSummary{ID: "web", Label: "web-1", LabelMinor: "host-a"},
+		Metadata: []report.MetadataRow{
+			{ID: "docker_image_name", Label: "Image", Value: "nginx:1.13"},
+			{ID: "docker_container_restart_count", Label: "Restart #", Value: "4"},
+		},
+		Parents: []detailed.Parent{{ID: "pod", Label: "web-pod", TopologyID: "pods"}},
+		Metrics: []report.MetricRow{
+			{ID: "docker_cpu_total_usage", Label: "CPU", Value: 85},
+			{ID: "docker_memory_usage", Label: "Memory", Value: 3 << 20},
+		},
+		Tables: []report.Table{{
+			ID:   docker.LabelPrefix,
+			Type: report.PropertyListType,
+			Rows: []report.Row{{ID: "label_app", Entries: map[string]string{"label": "app", "value": "frontend"}}},
+		}},
+	}
+
+	for _, c := range []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"web", true},
+		{"WEB", true},
+		{"host-a", true},
+		{"db", false},
+		{"image:nginx", true},
+		{`image:"nginx:1.13"`, true},
+		{"image:redis", false},
+		{"pods:web-pod", true},
+		{"label:web", true},
+		{"app:front", true},
+		{"cpu > 80", true},
+		{"cpu>80", true},
+		{"cpu >90", false},
+		{"cpu <= 85", true},
+		{"memory > 2MB", true},
+		{"memory < 2MB", false},
+		{"docker_memory_usage >= 3m", true},
+		{"app=frontend", true},
+		{"app = backend", false},
+		{"app!=backend", true},
+		{"tier!=web", true},
+		{"tier=web", false},
+		{"web AND cpu > 80", true},
+		{"web cpu > 90", false},
+		{"db OR cpu > 80", true},
+		{"db OR redis", false},
+		{"NOT db", true},
+		{"NOT (web OR db)", false},
+		{"(db OR nginx) AND NOT app=backend", true},
+		{`"NOT"`, false},
+	} {
+		search, err := detailed.ParseSearch(c.query)
+		if err != nil {
+			t.Errorf("%q: %v", c.query, err)
+			continue
+		}
+		if have := search.Match(node); have != c.want {
+			t.Errorf("%q: want %v, have %v", c.query, c.want, have)
+		}
+	}
+
+	for _, query := range []string{"web OR", "NOT", "(web", "web)", "cpu >", "cpu > lots", "AND web"} {
+		if _, err := detailed.ParseSearch(query); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/weaveworks/scope/probe"
 	"github.com/weaveworks/scope/probe/awsecs"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/gpu"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/nomad"
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/render"
@@ -61,42 +64,92 @@ type NodeSummary struct {
 	Metrics   []report.MetricRow   `json:"metrics,omitempty"`
 	Tables    []report.Table       `json:"tables,omitempty"`
 	Adjacency report.IDList        `json:"adjacency,omitempty"`
+	// DegradedAdjacency are the nodes in Adjacency whose connection to this
+	// node is unhealthy.
+	DegradedAdjacency report.IDList `json:"degradedAdjacency,omitempty"`
+	// EdgeStats are the stats of the requests to nodes in Adjacency, from
+	// tracing, by node ID.
+	EdgeStats map[string]EdgeStats `json:"edgeStats,omitempty"`
+	// Alerts are the names of the alerting rules firing on this node.
+	Alerts []string `json:"alerts,omitempty"`
+	// Annotations are the notes users left on this node, and on the edges
+	// from it.
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// EdgeBundles stand for the edges to nodes in the same group, taken
+	// out of Adjacency, when the node has too many edges to show.
+	EdgeBundles []EdgeBundle `json:"edgeBundles,omitempty"`
+	// Anomalies are what of the node deviates from its baseline, when
+	// the topology is rendered with anomaly detection.
+	Anomalies []string `json:"anomalies,omitempty"`
+	// Color and Size are the fields nodes are colored and sized by, when
+	// asked for, scaled against the other nodes'.
+	Color *ScaledValue `json:"color,omitempty"`
+	Size  *ScaledValue `json:"size,omitempty"`
 }
 
 var renderers = map[string]func(BasicNodeSummary, report.Node) BasicNodeSummary{
-	render.Pseudo:         pseudoNodeSummary,
-	report.Process:        processNodeSummary,
-	report.Container:      containerNodeSummary,
-	report.ContainerImage: containerImageNodeSummary,
-	report.Pod:            podNodeSummary,
-	report.Service:        podGroupNodeSummary,
-	report.Deployment:     podGroupNodeSummary,
-	report.DaemonSet:      podGroupNodeSummary,
-	report.StatefulSet:    podGroupNodeSummary,
-	report.CronJob:        podGroupNodeSummary,
-	report.ECSTask:        ecsTaskNodeSummary,
-	report.ECSService:     ecsServiceNodeSummary,
-	report.SwarmService:   swarmServiceNodeSummary,
-	report.Host:           hostNodeSummary,
-	report.Overlay:        weaveNodeSummary,
-	report.Endpoint:       nil, // Do not render
+	render.Pseudo:          pseudoNodeSummary,
+	report.Process:         processNodeSummary,
+	report.Container:       containerNodeSummary,
+	report.ContainerImage:  containerImageNodeSummary,
+	report.Pod:             podNodeSummary,
+	report.Service:         podGroupNodeSummary,
+	report.Deployment:      podGroupNodeSummary,
+	report.DaemonSet:       podGroupNodeSummary,
+	report.StatefulSet:     podGroupNodeSummary,
+	report.CronJob:         podGroupNodeSummary,
+	report.Autoscaler:      autoscalerNodeSummary,
+	report.Namespace:       namespaceNodeSummary,
+	report.ECSTask:         ecsTaskNodeSummary,
+	report.ECSService:      ecsServiceNodeSummary,
+	report.SwarmService:    swarmServiceNodeSummary,
+	report.NomadJob:        nomadJobNodeSummary,
+	report.NomadTaskGroup:  nomadTaskGroupNodeSummary,
+	report.NomadAllocation: nomadAllocationNodeSummary,
+	report.GPU:             gpuNodeSummary,
+	report.ScopeProbe:      scopeProbeNodeSummary,
+	report.Host:            hostNodeSummary,
+	report.Overlay:         weaveNodeSummary,
+	report.Endpoint:        nil, // Do not render
 }
 
 // For each report.Topology, map to a 'primary' API topology. This can then be used in a variety of places.
 var primaryAPITopology = map[string]string{
-	report.Process:        "processes",
-	report.Container:      "containers",
-	report.ContainerImage: "containers-by-image",
-	report.Pod:            "pods",
-	report.Deployment:     "kube-controllers",
-	report.DaemonSet:      "kube-controllers",
-	report.StatefulSet:    "kube-controllers",
-	report.CronJob:        "kube-controllers",
-	report.Service:        "services",
-	report.ECSTask:        "ecs-tasks",
-	report.ECSService:     "ecs-services",
-	report.SwarmService:   "swarm-services",
-	report.Host:           "hosts",
+	report.Process:         "processes",
+	report.Container:       "containers",
+	report.ContainerImage:  "containers-by-image",
+	report.Pod:             "pods",
+	report.Deployment:      "kube-controllers",
+	report.DaemonSet:       "kube-controllers",
+	report.StatefulSet:     "kube-controllers",
+	report.CronJob:         "kube-controllers",
+	report.Autoscaler:      "kube-controllers",
+	report.Namespace:       "namespaces",
+	report.Service:         "services",
+	report.ECSTask:         "ecs-tasks",
+	report.ECSService:      "ecs-services",
+	report.SwarmService:    "swarm-services",
+	report.NomadJob:        "nomad-jobs",
+	report.NomadTaskGroup:  "nomad-task-groups",
+	report.NomadAllocation: "nomad-allocations",
+	report.GPU:             "gpus",
+	report.ScopeProbe:      "scope-probes",
+	report.Host:            "hosts",
+}
+
+// Keys plugins can set on the nodes of their own topologies, to label them.
+const (
+	PluginNodeLabel      = "label"
+	PluginNodeLabelMinor = "label_minor"
+)
+
+// apiTopologyID maps a report topology to its primary API topology. Plugin
+// topologies are served under their own names.
+func apiTopologyID(r report.Report, topologyID string) (string, bool) {
+	if apiTopology, ok := primaryAPITopology[topologyID]; ok {
+		return apiTopology, true
+	}
+	return topologyID, r.IsPluginTopology(topologyID)
 }
 
 // MakeBasicNodeSummary returns a basic summary of a node, if
@@ -124,6 +177,11 @@ func MakeBasicNodeSummary(r report.Report, n report.Node) (BasicNodeSummary, boo
 		return groupNodeSummary(summary, r, n), true
 	}
 
+	// Is it a plugin topology?
+	if r.IsPluginTopology(n.Topology) {
+		return pluginNodeSummary(summary, n), true
+	}
+
 	// Is it any known topology?
 	if _, ok := r.Topology(n.Topology); ok {
 		// We should never get here, since all known topologies are in
@@ -146,10 +204,20 @@ func MakeNodeSummary(rc RenderContext, n report.Node) (NodeSummary, bool) {
 		Parents:          Parents(rc.Report, n),
 		Adjacency:        n.Adjacency,
 	}
+	if degraded, ok := n.Sets.Lookup(report.DegradedAdjacency); ok {
+		for _, id := range n.Adjacency {
+			if degraded.Contains(id) {
+				summary.DegradedAdjacency = summary.DegradedAdjacency.Add(id)
+			}
+		}
+	}
+	if anomalies, ok := n.Sets.Lookup(render.Anomalies); ok {
+		summary.Anomalies = anomalies
+	}
 	// Only include metadata, metrics, tables when it's not a group node
 	if _, ok := n.Counters.Lookup(n.Topology); !ok {
 		if topology, ok := rc.Topology(n.Topology); ok {
-			summary.Metadata = topology.MetadataTemplates.MetadataRows(n)
+			summary.Metadata = rc.Report.Schema.MetadataRows(topology.MetadataTemplates.MetadataRows(n))
 			summary.Metrics = topology.MetricTemplates.MetricRows(n)
 			summary.Tables = topology.TableTemplates.Tables(n)
 		}
@@ -189,6 +257,17 @@ func pseudoNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
 		base.Label = n.ID[len(render.ServiceNodeIDPrefix):]
 		base.LabelMinor = ""
 		base.Shape = report.Cloud
+	case strings.HasPrefix(n.ID, render.LoadBalancerNodeIDPrefix):
+		// render as the inbound connections of a load balancer
+		name, listeners, hostname, _ := render.ParseLoadBalancerNodeID(n.ID)
+		base.Label = name
+		base.LabelMinor = listeners
+		if hostname != "" && listeners != "" {
+			base.LabelMinor = fmt.Sprintf("%s (%s)", listeners, hostname)
+		} else if hostname != "" {
+			base.LabelMinor = hostname
+		}
+		base.Shape = report.Cloud
 	case strings.HasPrefix(n.ID, render.UncontainedIDPrefix):
 		// render as an uncontained node
 		base.Label = render.UncontainedMajor
@@ -201,6 +280,12 @@ func pseudoNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
 		base.LabelMinor = n.ID[len(render.UnmanagedIDPrefix):]
 		base.Shape = report.Square
 		base.Stack = true
+	case strings.HasPrefix(n.ID, render.UngroupedIDPrefix):
+		// render as the nodes not in any group
+		base.Label = render.UngroupedMajor
+		base.LabelMinor = n.ID[len(render.UngroupedIDPrefix):]
+		base.Shape = report.Square
+		base.Stack = true
 	default:
 		// try rendering it as an endpoint
 		if _, addr, _, ok := report.ParseEndpointNodeID(n.ID); ok {
@@ -298,6 +383,9 @@ func addKubernetesLabelAndRank(base BasicNodeSummary, n report.Node) BasicNodeSu
 func podNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
 	base = addKubernetesLabelAndRank(base, n)
 	base.LabelMinor = pluralize(n.Counters, report.Container, "container", "containers")
+	if _, ok := n.Latest.Lookup(kubernetes.PlacementWarning); ok {
+		base.LabelMinor += ", misplaced"
+	}
 	return base
 }
 
@@ -319,6 +407,28 @@ func podGroupNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary
 	} else {
 		base.LabelMinor = count
 	}
+	if _, ok := n.Latest.Lookup(kubernetes.PlacementWarning); ok {
+		base.LabelMinor += ", unevenly spread"
+	}
+	return base
+}
+
+func autoscalerNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base = addKubernetesLabelAndRank(base, n)
+	typeName, _ := n.Latest.Lookup(kubernetes.NodeType)
+	if target, ok := n.Latest.Lookup(kubernetes.ScaleTarget); ok {
+		base.LabelMinor = fmt.Sprintf("%s of %s", typeName, target)
+	} else {
+		base.LabelMinor = typeName
+	}
+	return base
+}
+
+func namespaceNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base = addKubernetesLabelAndRank(base, n)
+	if warning, ok := n.Latest.Lookup(kubernetes.QuotaWarning); ok {
+		base.LabelMinor = "near quota (" + warning + ")"
+	}
 	return base
 }
 
@@ -336,11 +446,70 @@ func ecsServiceNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummar
 	return base
 }
 
+func nomadJobNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base.Label, _ = n.Latest.Lookup(nomad.JobID)
+	base.LabelMinor, _ = n.Latest.Lookup(nomad.JobType)
+	base.Stack = true
+	return base
+}
+
+func nomadTaskGroupNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base.Label, _ = n.Latest.Lookup(nomad.TaskGroupName)
+	base.LabelMinor, _ = n.Latest.Lookup(nomad.JobID)
+	base.Stack = true
+	return base
+}
+
+func nomadAllocationNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base.Label, _ = n.Latest.Lookup(nomad.AllocationName)
+	if base.Label == "" {
+		base.Label, _ = report.ParseNomadAllocationNodeID(n.ID)
+	}
+	base.LabelMinor, _ = n.Latest.Lookup(nomad.ClientStatus)
+	return base
+}
+
+func gpuNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	model, _ := n.Latest.Lookup(gpu.Name)
+	if index, ok := n.Latest.Lookup(gpu.Index); ok {
+		base.Label = "GPU " + index
+	} else {
+		base.Label, _ = report.ParseGPUNodeID(n.ID)
+	}
+	base.LabelMinor = model
+	if hostNodeID, ok := n.Latest.Lookup(report.HostNodeID); ok {
+		if hostname, ok := report.ParseHostNodeID(hostNodeID); ok {
+			base.LabelMinor = fmt.Sprintf("%s (%s)", hostname, model)
+		}
+	}
+	return base
+}
+
+func scopeProbeNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base.Label, _ = report.ParseScopeProbeNodeID(n.ID)
+	base.Label = "probe " + base.Label
+	base.LabelMinor, _ = n.Latest.Lookup(probe.Hostname)
+	return base
+}
+
+func pluginNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	if label, ok := n.Latest.Lookup(PluginNodeLabel); ok {
+		base.Label = label
+	}
+	base.LabelMinor, _ = n.Latest.Lookup(PluginNodeLabelMinor)
+	base.Rank = n.ID
+	return base
+}
+
 func swarmServiceNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
 	base.Label, _ = n.Latest.Lookup(docker.ServiceName)
 	if base.Label == "" {
 		base.Label, _ = report.ParseSwarmServiceNodeID(n.ID)
 	}
+	if desired, ok := n.Latest.Lookup(docker.DesiredReplicas); ok {
+		running, _ := n.Latest.Lookup(docker.RunningReplicas)
+		base.LabelMinor = fmt.Sprintf("%s of %s replicas", running, desired)
+	}
 	return base
 }
 
@@ -368,6 +537,15 @@ func weaveNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
 		base.Label = peerName
 	}
 	base.LabelMinor = peerName
+	if plugin, ok := n.Latest.Lookup(overlay.CNIPlugin); ok {
+		base.LabelMinor = plugin
+	}
+	// WireGuard interfaces are named by their public key
+	if iface, ok := n.Latest.Lookup(overlay.WireGuardInterface); ok {
+		hostNodeID, _ := n.Latest.Lookup(report.HostNodeID)
+		base.Label = iface
+		base.LabelMinor, _ = report.ParseHostNodeID(hostNodeID)
+	}
 	return base
 }
 
@@ -419,6 +597,14 @@ func Summaries(rc RenderContext, rns report.Nodes) NodeSummaries {
 			result[id] = summary
 		}
 	}
+	if rc.Traces != nil {
+		for id, stats := range rc.Traces.EdgeStats(rns) {
+			if summary, ok := result[id]; ok {
+				summary.EdgeStats = stats
+				result[id] = summary
+			}
+		}
+	}
 	return result
 }
 
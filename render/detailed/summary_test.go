@@ -236,6 +236,25 @@ func TestMakeNodeSummaryNoMetadata(t *testing.T) {
 	}
 }
 
+func TestMakeNodeSummaryLoadBalancer(t *testing.T) {
+	for _, c := range []struct {
+		listeners, hostname, labelMinor string
+	}{
+		{"HTTP:80->8080", "shop.example.com", "HTTP:80->8080 (shop.example.com)"},
+		{"HTTP:80->8080", "", "HTTP:80->8080"},
+		{"", "shop.example.com", "shop.example.com"},
+	} {
+		id := render.MakeLoadBalancerNodeID("shop", c.listeners, c.hostname)
+		summary, ok := detailed.MakeBasicNodeSummary(report.MakeReport(), report.MakeNode(id).WithTopology(render.Pseudo))
+		if !ok {
+			t.Fatalf("Node Summary missing for %s", id)
+		}
+		if summary.Label != "shop" || summary.LabelMinor != c.labelMinor || summary.Shape != report.Cloud {
+			t.Errorf("Expected shop, %q as a cloud, got %s, %q as a %s", c.labelMinor, summary.Label, summary.LabelMinor, summary.Shape)
+		}
+	}
+}
+
 func TestNodeMetadata(t *testing.T) {
 	inputs := []struct {
 		name string
@@ -274,6 +293,21 @@ func TestNodeMetadata(t *testing.T) {
 	}
 }
 
+func TestNodeMetadataSchema(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	rpt.Schema = docker.MetadataSchema
+	node := report.MakeNodeWith(fixture.ClientContainerNodeID, map[string]string{
+		docker.ContainerUptime: "90",
+	}).WithTopology(report.Container)
+	summary, _ := detailed.MakeNodeSummary(detailed.RenderContext{Report: rpt}, node)
+	want := []report.MetadataRow{
+		{ID: docker.ContainerUptime, Label: "Uptime", Value: "90", Priority: 4, Datatype: report.Duration, Unit: "s"},
+	}
+	if !reflect.DeepEqual(want, summary.Metadata) {
+		t.Error(test.Diff(want, summary.Metadata))
+	}
+}
+
 func TestNodeMetrics(t *testing.T) {
 	inputs := []struct {
 		name string
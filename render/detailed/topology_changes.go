@@ -0,0 +1,123 @@
+package detailed
+
+import (
+	"sort"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Changes is returned by TopoChanges. It is what changed in a topology
+// between two points in time, for people to read, say after a deployment.
+type Changes struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Added   []NodeSummary `json:"added"`
+	Removed []NodeSummary `json:"removed"`
+	Changed []NodeChange  `json:"changed"`
+}
+
+// NodeChange is how a node there at both points in time changed.
+type NodeChange struct {
+	BasicNodeSummary
+	EdgesAdded   report.IDList    `json:"edgesAdded,omitempty"`
+	EdgesRemoved report.IDList    `json:"edgesRemoved,omitempty"`
+	Metadata     []MetadataChange `json:"metadata,omitempty"`
+	Metrics      []MetricChange   `json:"metrics,omitempty"`
+}
+
+// MetadataChange is a metadata row whose value changed.
+type MetadataChange struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// MetricChange is a metric whose value changed.
+type MetricChange struct {
+	ID     string  `json:"id"`
+	Label  string  `json:"label"`
+	Format string  `json:"format,omitempty"`
+	From   float64 `json:"from"`
+	To     float64 `json:"to"`
+	Delta  float64 `json:"delta"`
+}
+
+// TopoChanges gives you what changed from a, at from, to b, at to. Nodes
+// come sorted by ID. Metadata and metrics only there at one of the points
+// in time don't count.
+func TopoChanges(from, to time.Time, a, b NodeSummaries) Changes {
+	changes := Changes{From: from, To: to}
+	for id, node := range b {
+		old, ok := a[id]
+		if !ok {
+			changes.Added = append(changes.Added, node)
+			continue
+		}
+		if change, ok := nodeChange(old, node); ok {
+			changes.Changed = append(changes.Changed, change)
+		}
+	}
+	for id, node := range a {
+		if _, ok := b[id]; !ok {
+			changes.Removed = append(changes.Removed, node)
+		}
+	}
+	sort.Slice(changes.Added, func(i, j int) bool { return changes.Added[i].ID < changes.Added[j].ID })
+	sort.Slice(changes.Removed, func(i, j int) bool { return changes.Removed[i].ID < changes.Removed[j].ID })
+	sort.Slice(changes.Changed, func(i, j int) bool { return changes.Changed[i].ID < changes.Changed[j].ID })
+	return changes
+}
+
+func nodeChange(a, b NodeSummary) (NodeChange, bool) {
+	change := NodeChange{BasicNodeSummary: b.BasicNodeSummary}
+	for _, id := range b.Adjacency {
+		if !a.Adjacency.Contains(id) {
+			change.EdgesAdded = append(change.EdgesAdded, id)
+		}
+	}
+	for _, id := range a.Adjacency {
+		if !b.Adjacency.Contains(id) {
+			change.EdgesRemoved = append(change.EdgesRemoved, id)
+		}
+	}
+
+	metadata := map[string]report.MetadataRow{}
+	for _, row := range a.Metadata {
+		metadata[row.ID] = row
+	}
+	for _, row := range b.Metadata {
+		if old, ok := metadata[row.ID]; ok && old.Value != row.Value {
+			change.Metadata = append(change.Metadata, MetadataChange{
+				ID:    row.ID,
+				Label: row.Label,
+				From:  old.Value,
+				To:    row.Value,
+			})
+		}
+	}
+
+	metrics := map[string]report.MetricRow{}
+	for _, row := range a.Metrics {
+		metrics[row.ID] = row
+	}
+	for _, row := range b.Metrics {
+		old, ok := metrics[row.ID]
+		if !ok || old.ValueEmpty || row.ValueEmpty || old.Value == row.Value {
+			continue
+		}
+		change.Metrics = append(change.Metrics, MetricChange{
+			ID:     row.ID,
+			Label:  row.Label,
+			Format: row.Format,
+			From:   old.Value,
+			To:     row.Value,
+			Delta:  row.Value - old.Value,
+		})
+	}
+
+	changed := len(change.EdgesAdded) > 0 || len(change.EdgesRemoved) > 0 ||
+		len(change.Metadata) > 0 || len(change.Metrics) > 0
+	return change, changed
+}
@@ -0,0 +1,52 @@
+package detailed_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestTopoChanges(t *testing.T) {
+	from := time.Unix(1500000000, 0).UTC()
+	to := from.Add(time.Hour)
+	node := func(id, image string, cpu float64, adjacent ...string) detailed.NodeSummary {
+		return detailed.NodeSummary{
+			BasicNodeSummary: detailed.BasicNodeSummary{ID: id, Label: id},
+			Metadata:         []report.MetadataRow{{ID: "image", Label: "Image", Value: image}},
+			Metrics:          []report.MetricRow{{ID: "cpu", Label: "CPU", Format: "percent", Value: cpu}},
+			Adjacency:        report.MakeIDList(adjacent...),
+		}
+	}
+	a := detailed.NodeSummaries{
+		"web":  node("web", "web:1", 10, "db"),
+		"db":   node("db", "db:1", 20),
+		"gone": node("gone", "gone:1", 0),
+	}
+	b := detailed.NodeSummaries{
+		"web": node("web", "web:2", 15, "cache"),
+		"db":  node("db", "db:1", 20),
+		"new": node("new", "new:1", 0),
+	}
+
+	want := detailed.Changes{
+		From:    from,
+		To:      to,
+		Added:   []detailed.NodeSummary{b["new"]},
+		Removed: []detailed.NodeSummary{a["gone"]},
+		Changed: []detailed.NodeChange{{
+			BasicNodeSummary: b["web"].BasicNodeSummary,
+			EdgesAdded:       report.IDList{"cache"},
+			EdgesRemoved:     report.IDList{"db"},
+			Metadata:         []detailed.MetadataChange{{ID: "image", Label: "Image", From: "web:1", To: "web:2"}},
+			Metrics:          []detailed.MetricChange{{ID: "cpu", Label: "CPU", Format: "percent", From: 10, To: 15, Delta: 5}},
+		}},
+	}
+	have := detailed.TopoChanges(from, to, a, b)
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
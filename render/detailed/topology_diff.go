@@ -11,6 +11,12 @@ type Diff struct {
 	Update []NodeSummary `json:"update"`
 	Remove []string      `json:"remove"`
 	Reset  bool          `json:"reset,omitempty"`
+	// Layout is where all the nodes are placed, if a layout was asked for
+	// and the nodes or edges changed.
+	Layout Layout `json:"layout,omitempty"`
+	// Cursor is where the next page of nodes starts, when the nodes were
+	// limited and there are more.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 // TopoDiff gives you the diff to get from A to B.
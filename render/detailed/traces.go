@@ -0,0 +1,20 @@
+package detailed
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// EdgeStats are the stats of the requests along an edge, from tracing.
+type EdgeStats struct {
+	// RequestRate is in requests per second
+	RequestRate float64 `json:"requestRate"`
+	// LatencyP99 is in milliseconds
+	LatencyP99 float64 `json:"latencyP99"`
+}
+
+// Traces joins traces to rendered nodes.
+type Traces interface {
+	// EdgeStats returns the stats of the edges between the nodes, by the
+	// IDs of the nodes at either end.
+	EdgeStats(report.Nodes) map[string]map[string]EdgeStats
+}
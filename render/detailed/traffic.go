@@ -0,0 +1,129 @@
+package detailed
+
+import (
+	"sort"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// Groupings of traffic matrices other than by a label.
+const (
+	TrafficByNamespace = "namespace"
+	TrafficByService   = "service"
+	TrafficBySubnet    = "subnet"
+)
+
+// TrafficMatrix counts the connections between groups of nodes: from the
+// nodes of each of the Rows, grouped By, to the nodes of each of the
+// Columns, grouped ToBy. Connections[i][j] are those from Rows[i] to
+// Columns[j]. Nodes in no group are in render.UngroupedMajor, and the
+// Internet and other pseudo nodes are groups of their own.
+type TrafficMatrix struct {
+	By          string   `json:"by"`
+	ToBy        string   `json:"toBy"`
+	Rows        []string `json:"rows"`
+	Columns     []string `json:"columns"`
+	Connections [][]int  `json:"connections"`
+	Total       int      `json:"total"`
+}
+
+// trafficGroupOf returns how nodes are grouped by by: the built in
+// groupings, or else the value of a label, as in "team".
+func trafficGroupOf(r report.Report, by string) func(report.Node) (string, bool) {
+	switch by {
+	case TrafficByNamespace:
+		return render.NamespaceOf
+	case TrafficBySubnet:
+		return subnetOf
+	case TrafficByService:
+		return func(n report.Node) (string, bool) {
+			id, ok := serviceOf(n)
+			if !ok {
+				return "", false
+			}
+			for _, topology := range []string{report.Service, report.ECSService, report.SwarmService} {
+				if t, ok := r.Topology(topology); ok {
+					if service, ok := t.Nodes[id]; ok {
+						if summary, ok := MakeBasicNodeSummary(r, service); ok {
+							return summary.Label, true
+						}
+					}
+				}
+			}
+			return id, true
+		}
+	default:
+		return func(n report.Node) (string, bool) {
+			return render.GroupValue(n, by)
+		}
+	}
+}
+
+// MakeTrafficMatrix counts the connections between the rendered nodes,
+// as in their connections tables, by the groups of the nodes they are
+// from and to. Only the rows and columns asked for are kept, if any are.
+func MakeTrafficMatrix(r report.Report, nodes report.Nodes, by, toBy string, rows, columns []string) TrafficMatrix {
+	var (
+		fromGroupOf = trafficGroupOf(r, by)
+		toGroupOf   = trafficGroupOf(r, toBy)
+		counts      = map[[2]string]int{}
+		rowSet      = map[string]struct{}{}
+		columnSet   = map[string]struct{}{}
+	)
+	groupOf := func(n report.Node, f func(report.Node) (string, bool)) string {
+		if n.Topology == render.Pseudo {
+			if summary, ok := MakeBasicNodeSummary(r, n); ok {
+				return summary.Label
+			}
+			return n.ID
+		}
+		if group, ok := f(n); ok && group != "" {
+			return group
+		}
+		return render.UngroupedMajor
+	}
+	for _, n := range nodes {
+		if len(n.Adjacency) == 0 {
+			continue
+		}
+		from := groupOf(n, fromGroupOf)
+		for id, count := range OutgoingConnectionCounts(r, n, nodes) {
+			to := groupOf(nodes[id], toGroupOf)
+			counts[[2]string{from, to}] += count
+			rowSet[from] = struct{}{}
+			columnSet[to] = struct{}{}
+		}
+	}
+
+	result := TrafficMatrix{
+		By:      by,
+		ToBy:    toBy,
+		Rows:    selectGroups(rowSet, rows),
+		Columns: selectGroups(columnSet, columns),
+	}
+	result.Connections = make([][]int, len(result.Rows))
+	for i, row := range result.Rows {
+		result.Connections[i] = make([]int, len(result.Columns))
+		for j, column := range result.Columns {
+			count := counts[[2]string{row, column}]
+			result.Connections[i][j] = count
+			result.Total += count
+		}
+	}
+	return result
+}
+
+// selectGroups returns the groups asked for, in that order, or else all
+// of them, sorted.
+func selectGroups(groups map[string]struct{}, selected []string) []string {
+	if len(selected) > 0 {
+		return selected
+	}
+	result := make([]string, 0, len(groups))
+	for group := range groups {
+		result = append(result, group)
+	}
+	sort.Strings(result)
+	return result
+}
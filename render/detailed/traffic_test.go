@@ -0,0 +1,38 @@
+package detailed_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestMakeTrafficMatrix(t *testing.T) {
+	nodes := render.ContainerWithImageNameRenderer.Render(fixture.Report).Nodes
+
+	// From namespaces to the containers' roles, and the Internet
+	have := detailed.MakeTrafficMatrix(fixture.Report, nodes, detailed.TrafficByNamespace, fixture.TestLabelKey2, nil, nil)
+	want := detailed.TrafficMatrix{
+		By:      detailed.TrafficByNamespace,
+		ToBy:    fixture.TestLabelKey2,
+		Rows:    []string{render.InboundMajor, render.UncontainedMajor, fixture.KubernetesNamespace},
+		Columns: []string{render.OutboundMajor, fixture.ApplicationLabelValue2},
+		Connections: [][]int{
+			{0, 1},
+			{1, 0},
+			{0, 2},
+		},
+		Total: 4,
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+
+	// Only the rows and columns asked for, in that order
+	have = detailed.MakeTrafficMatrix(fixture.Report, nodes, detailed.TrafficByNamespace, fixture.TestLabelKey2, []string{fixture.KubernetesNamespace, "nowhere"}, []string{fixture.ApplicationLabelValue2})
+	if want := [][]int{{2}, {0}}; !reflect.DeepEqual(want, have.Connections) || have.Total != 2 {
+		t.Errorf("Expected %v, got %v (total %d)", want, have.Connections, have.Total)
+	}
+}
@@ -0,0 +1,104 @@
+package detailed
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// OtherNodesID is the ID of the node standing for the nodes Truncate
+// leaves out.
+var OtherNodesID = render.MakePseudoNodeID("other")
+
+// Truncate returns the limit summaries from offset on, ranked by the
+// field, greatest first, or by ID without a field, and a cursor to the
+// next page, the offset it starts at, "" for the last page. Nodes without
+// the field rank last. The nodes left out are aggregated into a node of
+// their own, OtherNodesID, which edges to and from them go to and from
+// instead.
+func Truncate(summaries NodeSummaries, field string, offset, limit int) (NodeSummaries, string) {
+	if offset == 0 && len(summaries) <= limit {
+		return summaries, ""
+	}
+	type ranked struct {
+		id    string
+		value float64
+		ok    bool
+	}
+	ranking := make([]ranked, 0, len(summaries))
+	for id, summary := range summaries {
+		r := ranked{id: id}
+		if field != "" {
+			r.value, r.ok = NodeField(summary, field)
+		}
+		ranking = append(ranking, r)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		a, b := ranking[i], ranking[j]
+		if a.ok != b.ok {
+			return a.ok
+		}
+		if a.value != b.value {
+			return a.value > b.value
+		}
+		return a.id < b.id
+	})
+
+	start, end := offset, offset+limit
+	if start > len(ranking) {
+		start = len(ranking)
+	}
+	if end > len(ranking) {
+		end = len(ranking)
+	}
+	result := make(NodeSummaries, end-start+1)
+	for _, r := range ranking[start:end] {
+		result[r.id] = summaries[r.id]
+	}
+	var cursor string
+	if end < len(ranking) {
+		cursor = strconv.Itoa(end)
+	}
+
+	other := NodeSummary{
+		BasicNodeSummary: BasicNodeSummary{
+			ID:         OtherNodesID,
+			Label:      fmt.Sprintf("%d other nodes", len(ranking)-(end-start)),
+			LabelMinor: "not on this page",
+			Rank:       "other",
+			Shape:      report.Square,
+			Stack:      true,
+			Pseudo:     true,
+		},
+	}
+	for id, summary := range summaries {
+		if _, ok := result[id]; ok {
+			continue
+		}
+		for _, adjacent := range summary.Adjacency {
+			if _, ok := result[adjacent]; ok {
+				other.Adjacency = other.Adjacency.Add(adjacent)
+			}
+		}
+	}
+	for id, summary := range result {
+		var adjacency, degraded report.IDList
+		for _, adjacent := range summary.Adjacency {
+			isDegraded := summary.DegradedAdjacency.Contains(adjacent)
+			if _, ok := result[adjacent]; !ok {
+				adjacent = OtherNodesID
+			}
+			adjacency = adjacency.Add(adjacent)
+			if isDegraded {
+				degraded = degraded.Add(adjacent)
+			}
+		}
+		summary.Adjacency, summary.DegradedAdjacency = adjacency, degraded
+		result[id] = summary
+	}
+	result[OtherNodesID] = other
+	return result, cursor
+}
@@ -0,0 +1,62 @@
+package detailed_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestTruncate(t *testing.T) {
+	summaries := detailed.NodeSummaries{}
+	for id, cpu := range map[string]float64{"a": 10, "b": 40, "c": 30, "d": 20} {
+		summaries[id] = detailed.NodeSummary{
+			BasicNodeSummary: detailed.BasicNodeSummary{ID: id},
+			Metrics:          []report.MetricRow{{ID: "cpu", Value: cpu}},
+		}
+	}
+	summaries["e"] = detailed.NodeSummary{BasicNodeSummary: detailed.BasicNodeSummary{ID: "e"}}
+	b := summaries["b"]
+	b.Adjacency = report.MakeIDList("a", "c", "d")
+	b.DegradedAdjacency = report.MakeIDList("d")
+	summaries["b"] = b
+	a := summaries["a"]
+	a.Adjacency = report.MakeIDList("c")
+	summaries["a"] = a
+
+	// The top two by CPU, the others aggregated
+	have, cursor := detailed.Truncate(summaries, "cpu", 0, 2)
+	if cursor != "2" {
+		t.Errorf("Expected cursor 2, got %q", cursor)
+	}
+	if len(have) != 3 {
+		t.Fatalf("Expected b, c and the other nodes, got %v", have)
+	}
+	equals := func(want, have report.IDList) {
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("Expected %v, got %v", want, have)
+		}
+	}
+	equals(report.MakeIDList("c", detailed.OtherNodesID), have["b"].Adjacency)
+	equals(report.MakeIDList(detailed.OtherNodesID), have["b"].DegradedAdjacency)
+	equals(report.MakeIDList("c"), have[detailed.OtherNodesID].Adjacency)
+	if have[detailed.OtherNodesID].Label != "3 other nodes" {
+		t.Errorf("Expected 3 other nodes, got %q", have[detailed.OtherNodesID].Label)
+	}
+
+	// The last page, with the node without CPU last
+	have, cursor = detailed.Truncate(summaries, "cpu", 4, 2)
+	if _, ok := have["e"]; !ok || cursor != "" || len(have) != 2 {
+		t.Errorf("Expected e on the last page, got %v, %q", have, cursor)
+	}
+
+	// By ID, and not at all when all fit
+	have, _ = detailed.Truncate(summaries, "", 0, 1)
+	if _, ok := have["a"]; !ok {
+		t.Errorf("Expected a first by ID, got %v", have)
+	}
+	if have, cursor := detailed.Truncate(summaries, "cpu", 0, 5); len(have) != 5 || cursor != "" {
+		t.Errorf("Expected all the nodes, got %v, %q", have, cursor)
+	}
+}
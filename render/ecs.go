@@ -5,7 +5,7 @@ import (
 )
 
 // ECSTaskRenderer is a Renderer for Amazon ECS tasks.
-var ECSTaskRenderer = Memoise(ConditionalRenderer(renderECSTopologies,
+var ECSTaskRenderer = Memoise(renderIfAnyNodes(ecsTopologies,
 	renderParents(
 		report.Container, []string{report.ECSTask}, UnmanagedID,
 		MakeFilter(
@@ -18,13 +18,11 @@ var ECSTaskRenderer = Memoise(ConditionalRenderer(renderECSTopologies,
 // ECSServiceRenderer is a Renderer for Amazon ECS services.
 //
 // not memoised
-var ECSServiceRenderer = ConditionalRenderer(renderECSTopologies,
+var ECSServiceRenderer = renderIfAnyNodes(ecsTopologies,
 	renderParents(
 		report.ECSTask, []string{report.ECSService}, "",
 		ECSTaskRenderer,
 	),
 )
 
-func renderECSTopologies(rpt report.Report) bool {
-	return len(rpt.ECSTask.Nodes)+len(rpt.ECSService.Nodes) >= 1
-}
+var ecsTopologies = []string{report.ECSTask, report.ECSService}
@@ -1,6 +1,9 @@
 package render
 
 import (
+	"time"
+
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -28,7 +31,9 @@ func MapEndpoints(f endpointMapFunc, topology string) Renderer {
 }
 
 func (e mapEndpoints) Render(rpt report.Report) Nodes {
+	defer timeStage("endpoints", time.Now())
 	local := LocalNetworks(rpt)
+	external := ExternalIPs(rpt)
 	endpoints := SelectEndpoint.Render(rpt)
 	ret := newJoinResults(TopologySelector(e.topology).Render(rpt).Nodes)
 
@@ -36,6 +41,15 @@ func (e mapEndpoints) Render(rpt report.Report) Nodes {
 		// Nodes without a hostid are mapped to pseudo nodes, if
 		// possible.
 		if _, ok := n.Latest.Lookup(report.HostNodeID); !ok {
+			// Connections to the external IP of a host in another
+			// cluster are stitched to that host, if the mapping
+			// function can make sense of it.
+			if id, ok := externalHostNodeID(n, external); ok {
+				if id := e.f(n.WithLatest(report.HostNodeID, mtime.Now(), id)); id != "" {
+					ret.addChild(n, id, e.topology)
+					continue
+				}
+			}
 			if id, ok := pseudoNodeID(n, local); ok {
 				ret.addChild(n, id, Pseudo)
 				continue
@@ -47,3 +61,22 @@ func (e mapEndpoints) Render(rpt report.Report) Nodes {
 	}
 	return ret.result(endpoints)
 }
+
+func (e mapEndpoints) readTopologies() ([]string, bool) {
+	// LocalNetworks and ExternalIPs read the hosts and overlay
+	return []string{report.Endpoint, report.Host, report.Overlay, e.topology}, true
+}
+
+// externalHostNodeID returns the ID of the host owning the address of
+// endpoint n, if that address is one of the hosts' external IPs.
+func externalHostNodeID(n report.Node, external map[string]string) (string, bool) {
+	if len(external) == 0 {
+		return "", false
+	}
+	_, addr, _, ok := report.ParseEndpointNodeID(n.ID)
+	if !ok {
+		return "", false
+	}
+	id, ok := external[addr]
+	return id, ok
+}
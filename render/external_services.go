@@ -0,0 +1,197 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/camlistore/camlistore/pkg/lru"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// ExternalService names the endpoints outside of the cluster in some
+// networks, or with some hostnames, so they are rendered as a node of
+// their own rather than as the Internet. Hostnames are either exact, or
+// begin with "*." to match all the names in a domain.
+type ExternalService struct {
+	Name      string   `json:"name"`
+	CIDRs     []string `json:"cidrs,omitempty"`
+	Hostnames []string `json:"hostnames,omitempty"`
+}
+
+// BuiltinExternalServices are the services of the big clouds that are
+// told apart without being configured: by the hostnames they are
+// addressed by, and by the few address ranges the clouds document as
+// being theirs for good. The full, changing ranges of the clouds (e.g.
+// AWS' ip-ranges.json) can be loaded as services of their own.
+var BuiltinExternalServices = []ExternalService{
+	{Name: "AWS S3", Hostnames: []string{"s3.amazonaws.com", "*.s3.amazonaws.com", "*.s3-external-1.amazonaws.com"}, CIDRs: []string{"52.216.0.0/15", "54.231.0.0/16"}},
+	{Name: "AWS DynamoDB", Hostnames: []string{"dynamodb.amazonaws.com", "*.dynamodb.amazonaws.com"}},
+	{Name: "AWS SQS", Hostnames: []string{"sqs.amazonaws.com", "*.sqs.amazonaws.com", "*.queue.amazonaws.com"}},
+	{Name: "AWS ECR", Hostnames: []string{"*.ecr.amazonaws.com"}},
+	{Name: "GCP Cloud Storage", Hostnames: []string{"storage.googleapis.com", "*.storage.googleapis.com"}},
+	{Name: "GCP Pub/Sub", Hostnames: []string{"pubsub.googleapis.com"}},
+	{Name: "GCP APIs", Hostnames: []string{"private.googleapis.com", "restricted.googleapis.com"}, CIDRs: []string{"199.36.153.4/30", "199.36.153.8/30"}},
+	{Name: "Azure Blob Storage", Hostnames: []string{"*.blob.core.windows.net"}},
+	{Name: "Azure SQL Database", Hostnames: []string{"*.database.windows.net"}},
+	{Name: "Azure Platform", CIDRs: []string{"168.63.129.16/32"}},
+}
+
+// externalServiceTable finds the services of endpoints. Networks are
+// kept longest prefix first, so the most specific wins.
+type externalServiceTable struct {
+	networks  []externalNetwork
+	hostnames map[string]string // exact hostname, or ".domain", -> name
+}
+
+type externalNetwork struct {
+	net  *net.IPNet
+	name string
+}
+
+var (
+	externalServicesMtx sync.RWMutex
+	externalServices    = mustMakeExternalServiceTable(BuiltinExternalServices)
+
+	// Memoization for externalServiceName, as isKnownService
+	externalServiceCache = lru.New(10000)
+)
+
+func makeExternalServiceTable(services []ExternalService) (*externalServiceTable, error) {
+	table := &externalServiceTable{hostnames: map[string]string{}}
+	for _, service := range services {
+		if service.Name == "" {
+			return nil, fmt.Errorf("external service without a name")
+		}
+		for _, cidr := range service.CIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("external service %s: %v", service.Name, err)
+			}
+			table.networks = append(table.networks, externalNetwork{ipNet, service.Name})
+		}
+		for _, hostname := range service.Hostnames {
+			hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+			if strings.HasPrefix(hostname, "*.") {
+				hostname = hostname[1:]
+			}
+			if hostname == "" || hostname == "." {
+				return nil, fmt.Errorf("external service %s: empty hostname", service.Name)
+			}
+			// Earlier services take precedence, as the configured ones
+			// come ahead of the built-in ones
+			if _, ok := table.hostnames[hostname]; !ok {
+				table.hostnames[hostname] = service.Name
+			}
+		}
+	}
+	sort.SliceStable(table.networks, func(i, j int) bool {
+		a, _ := table.networks[i].net.Mask.Size()
+		b, _ := table.networks[j].net.Mask.Size()
+		return a > b
+	})
+	return table, nil
+}
+
+func mustMakeExternalServiceTable(services []ExternalService) *externalServiceTable {
+	table, err := makeExternalServiceTable(services)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// SetExternalServices sets the services external endpoints are told
+// apart by, ahead of the built-in ones.
+func SetExternalServices(services []ExternalService) error {
+	table, err := makeExternalServiceTable(append(append([]ExternalService{}, services...), BuiltinExternalServices...))
+	if err != nil {
+		return err
+	}
+	externalServicesMtx.Lock()
+	externalServices = table
+	externalServiceCache = lru.New(10000)
+	externalServicesMtx.Unlock()
+	ResetCache()
+	return nil
+}
+
+// LoadExternalServices sets the services external endpoints are told
+// apart by to the ones in the JSON file at path, a list of
+// ExternalServices.
+func LoadExternalServices(path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var services []ExternalService
+	if err := json.Unmarshal(buf, &services); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return SetExternalServices(services)
+}
+
+func (t *externalServiceTable) hostnameService(hostname string) (string, bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if name, ok := t.hostnames[hostname]; ok {
+		return name, true
+	}
+	for i := strings.Index(hostname, "."); i >= 0; {
+		if name, ok := t.hostnames[hostname[i:]]; ok {
+			return name, true
+		}
+		next := strings.Index(hostname[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return "", false
+}
+
+func (t *externalServiceTable) addressService(addr string) (string, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", false
+	}
+	for _, network := range t.networks {
+		if network.net.Contains(ip) {
+			return network.name, true
+		}
+	}
+	return "", false
+}
+
+// externalServiceName returns the name of the external service the
+// endpoint n, with address addr, is of: by its DNS names first, then by
+// its address.
+func externalServiceName(n report.Node, addr string) (string, bool) {
+	externalServicesMtx.RLock()
+	table, cache := externalServices, externalServiceCache
+	externalServicesMtx.RUnlock()
+
+	lookup := func(key string, f func(string) (string, bool)) (string, bool) {
+		if v, ok := cache.Get(key); ok {
+			name := v.(string)
+			return name, name != ""
+		}
+		name, _ := f(key[1:])
+		cache.Add(key, name)
+		return name, name != ""
+	}
+
+	var name string
+	if _, found := DNSFirstMatch(n, func(hostname string) bool {
+		var ok bool
+		name, ok = lookup("h"+hostname, table.hostnameService)
+		return ok
+	}); found {
+		return name, true
+	}
+	return lookup("a"+addr, table.addressService)
+}
@@ -0,0 +1,107 @@
+package render_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestExternalServices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external-services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	if err := ioutil.WriteFile(path, []byte(`[
+		{"name": "Corp LDAP", "cidrs": ["10.20.0.0/16"], "hostnames": ["*.ldap.corp"]},
+		{"name": "Corp DynamoDB", "hostnames": ["*.dynamodb.amazonaws.com"]}
+	]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := render.LoadExternalServices(path); err != nil {
+		t.Fatal(err)
+	}
+	defer render.SetExternalServices(nil)
+	if err := render.SetExternalServices([]render.ExternalService{{Name: "bad", CIDRs: []string{"10.0.0.0/33"}}}); err == nil {
+		t.Error("Expected an error for a bad CIDR")
+	}
+
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID("host")).
+		WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet("10.0.0.0/8"))))
+	for _, n := range []report.Node{
+		// Corp LDAP, though in a local network, by address and by name
+		report.MakeNode(report.MakeEndpointNodeID("", "", "10.20.1.5", "389")),
+		report.MakeNode(report.MakeEndpointNodeID("", "", "192.0.2.1", "636")).
+			WithSet(endpoint.SnoopedDNSNames, report.MakeStringSet("dc1.ldap.corp")),
+		// AWS S3, built in, by name and by address
+		report.MakeNode(report.MakeEndpointNodeID("", "", "198.51.100.1", "443")).
+			WithSet(endpoint.SnoopedDNSNames, report.MakeStringSet("bucket.s3.amazonaws.com")),
+		report.MakeNode(report.MakeEndpointNodeID("", "", "54.231.1.1", "443")),
+		// Configured hostnames take precedence over the built-in ones
+		report.MakeNode(report.MakeEndpointNodeID("", "", "198.51.100.2", "443")).
+			WithSet(endpoint.SnoopedDNSNames, report.MakeStringSet("eu-west-1.dynamodb.amazonaws.com")),
+		// The rest of the Internet
+		report.MakeNode(report.MakeEndpointNodeID("", "", "203.0.113.1", "443")),
+	} {
+		rpt.Endpoint.AddNode(n.WithTopology(report.Endpoint))
+	}
+
+	have := render.MapEndpoints(func(report.Node) string { return "" }, report.Host).Render(rpt).Nodes
+	for id, children := range map[string]int{
+		render.ServiceNodeIDPrefix + "Corp LDAP":     2,
+		render.ServiceNodeIDPrefix + "AWS S3":        2,
+		render.ServiceNodeIDPrefix + "Corp DynamoDB": 1,
+		render.OutgoingInternetID:                    1,
+	} {
+		if n, ok := have[id]; !ok || n.Children.Size() != children {
+			t.Errorf("Expected %s with %d endpoints, got %v", id, children, have)
+		}
+	}
+}
+
+func TestLoadBalancers(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID("host")).
+		WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet("10.0.0.0/8"))))
+	local := report.MakeEndpointNodeID("host", "", "10.0.2.7", "8080")
+	lb := map[string]string{
+		report.LoadBalancerName:     "shop",
+		report.LoadBalancerListener: "HTTP:80->8080",
+		report.LoadBalancerHostname: "shop.example.com",
+	}
+	for _, n := range []report.Node{
+		// Both addresses of the load balancer, though one is local
+		report.MakeNodeWith(report.MakeEndpointNodeID("", "", "10.0.1.5", "41234"), lb).WithAdjacent(local),
+		report.MakeNodeWith(report.MakeEndpointNodeID("", "", "203.0.113.5", "41235"), lb).WithAdjacent(local),
+		// The rest of the Internet
+		report.MakeNode(report.MakeEndpointNodeID("", "", "203.0.113.1", "41236")).WithAdjacent(local),
+	} {
+		rpt.Endpoint.AddNode(n.WithTopology(report.Endpoint))
+	}
+
+	have := render.MapEndpoints(func(report.Node) string { return "" }, report.Host).Render(rpt).Nodes
+	for id, children := range map[string]int{
+		render.MakeLoadBalancerNodeID("shop", "HTTP:80->8080", "shop.example.com"): 2,
+		render.IncomingInternetID: 1,
+	} {
+		if n, ok := have[id]; !ok || n.Children.Size() != children {
+			t.Errorf("Expected %s with %d endpoints, got %v", id, children, have)
+		}
+	}
+
+	name, listeners, hostname, ok := render.ParseLoadBalancerNodeID(render.MakeLoadBalancerNodeID("shop", "HTTP:80->8080", "shop.example.com"))
+	if !ok || name != "shop" || listeners != "HTTP:80->8080" || hostname != "shop.example.com" {
+		t.Errorf("Expected to parse the ID of a load balancer, got %q, %q, %q", name, listeners, hostname)
+	}
+	if _, _, _, ok := render.ParseLoadBalancerNodeID(render.IncomingInternetID); ok {
+		t.Errorf("Expected not to parse the ID of the Internet")
+	}
+}
@@ -2,6 +2,7 @@ package render
 
 import (
 	"strings"
+	"time"
 
 	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/docker"
@@ -24,7 +25,13 @@ type CustomRenderer struct {
 
 // Render implements Renderer
 func (c CustomRenderer) Render(rpt report.Report) Nodes {
-	return c.RenderFunc(c.Renderer.Render(rpt))
+	input := c.Renderer.Render(rpt)
+	defer timeStage("custom", time.Now())
+	return c.RenderFunc(input)
+}
+
+func (c CustomRenderer) readTopologies() ([]string, bool) {
+	return readTopologies(c.Renderer)
 }
 
 // FilterFunc is the function type used by Filters
@@ -113,7 +120,13 @@ func MakeFilterPseudo(f FilterFunc, r Renderer) Renderer {
 
 // Render implements Renderer
 func (f Filter) Render(rpt report.Report) Nodes {
-	return f.FilterFunc.Transform(f.Renderer.Render(rpt))
+	input := f.Renderer.Render(rpt)
+	defer timeStage("filter", time.Now())
+	return f.FilterFunc.Transform(input)
+}
+
+func (f Filter) readTopologies() ([]string, bool) {
+	return readTopologies(f.Renderer)
 }
 
 // IsConnectedMark is the key added to Node.Metadata by
@@ -268,22 +281,15 @@ func DoesNotHaveLabel(labelKey string, labelValue string) FilterFunc {
 }
 
 // IsNotPseudo returns true if the node is not a pseudo node
-// or internet/service nodes.
+// or internet/service/load balancer nodes.
 func IsNotPseudo(n report.Node) bool {
-	return n.Topology != Pseudo || IsInternetNode(n) || strings.HasPrefix(n.ID, ServiceNodeIDPrefix)
+	return n.Topology != Pseudo || IsInternetNode(n) || strings.HasPrefix(n.ID, ServiceNodeIDPrefix) || strings.HasPrefix(n.ID, LoadBalancerNodeIDPrefix)
 }
 
 // IsNamespace checks if the node is a pod/service in the specified namespace
 func IsNamespace(namespace string) FilterFunc {
 	return func(n report.Node) bool {
-		tryKeys := []string{kubernetes.Namespace, docker.LabelPrefix + k8sNamespaceLabel, docker.StackNamespace, docker.LabelPrefix + swarmNamespaceLabel}
-		gotNamespace := ""
-		for _, key := range tryKeys {
-			if value, ok := n.Latest.Lookup(key); ok {
-				gotNamespace = value
-				break
-			}
-		}
+		gotNamespace, _ := NamespaceOf(n)
 		// Special case for docker
 		if namespace == docker.DefaultNamespace && gotNamespace == "" {
 			return true
@@ -292,6 +298,18 @@ func IsNamespace(namespace string) FilterFunc {
 	}
 }
 
+// NamespaceOf returns the Kubernetes namespace or Docker stack the node
+// is in, if any.
+func NamespaceOf(n report.Node) (string, bool) {
+	tryKeys := []string{kubernetes.Namespace, docker.LabelPrefix + k8sNamespaceLabel, docker.StackNamespace, docker.LabelPrefix + swarmNamespaceLabel}
+	for _, key := range tryKeys {
+		if value, ok := n.Latest.Lookup(key); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
 // IsTopology checks if the node is from a particular report topology
 func IsTopology(topology string) FilterFunc {
 	return func(n report.Node) bool {
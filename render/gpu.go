@@ -0,0 +1,17 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// GPURenderer is a Renderer for the GPUs of hosts, with the processes and
+// containers using them as children.
+//
+// not memoised
+var GPURenderer = renderIfAnyNodes([]string{report.GPU},
+	MakeReduce(
+		SelectGPU,
+		MakeMap(Map2Parent([]string{report.GPU}, ""), SelectProcess),
+		MakeMap(Map2Parent([]string{report.GPU}, ""), SelectContainer),
+	),
+)
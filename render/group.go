@@ -0,0 +1,63 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+// Constants are used in the tests.
+const (
+	UngroupedID    = "ungrouped"
+	UngroupedMajor = "Ungrouped"
+)
+
+// UngroupedIDPrefix is the prefix of the pseudo nodes of nodes GroupBy
+// found no value to group by for.
+var UngroupedIDPrefix = MakePseudoNodeID(UngroupedID, "")
+
+// GroupBy is a Renderer which groups the nodes rendered by r by the value
+// they have for key, making a node for each value with the nodes having
+// it as children, the way ContainerHostnameRenderer groups containers by
+// hostname. The key is looked up in the nodes' metadata, then in their
+// Docker and Kubernetes labels, so both "team" and
+// "app.kubernetes.io/part-of" work. Nodes without it are grouped into a
+// pseudo node.
+//
+// not memoised
+func GroupBy(key string, r Renderer) Renderer {
+	return MakeMap(MapGroupBy(key), r)
+}
+
+// MapGroupBy maps nodes to the nodes of the groups they are in by key.
+func MapGroupBy(key string) MapFunc {
+	return func(n report.Node) report.Nodes {
+		// Propagate all pseudo nodes
+		if n.Topology == Pseudo {
+			return report.Nodes{n.ID: n}
+		}
+
+		value, ok := GroupValue(n, key)
+		if !ok {
+			id := MakePseudoNodeID(UngroupedID, key)
+			node := NewDerivedPseudoNode(id, n)
+			node.Counters = node.Counters.Add(n.Topology, 1)
+			return report.Nodes{id: node}
+		}
+
+		node := NewDerivedNode(value, n).WithTopology(MakeGroupNodeTopology(n.Topology, key))
+		node.Counters = node.Counters.Add(n.Topology, 1)
+		return report.Nodes{value: node}
+	}
+}
+
+// GroupValue returns the value the node has for key, as GroupBy groups
+// nodes by it.
+func GroupValue(n report.Node, key string) (string, bool) {
+	for _, k := range []string{key, docker.LabelPrefix + key, kubernetes.LabelPrefix + key} {
+		if value, ok := n.Latest.Lookup(k); ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
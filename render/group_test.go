@@ -0,0 +1,50 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestGroupBy(t *testing.T) {
+	rpt := report.MakeReport()
+	for id, labels := range map[string]map[string]string{
+		"c1": {docker.LabelPrefix + "team": "web"},
+		"c2": {kubernetes.LabelPrefix + "team": "web"},
+		"c3": {"team": "db"},
+		"c4": {},
+	} {
+		rpt.Container.AddNode(report.MakeNodeWith(id, labels).WithTopology(report.Container))
+	}
+	rpt.Container.AddNode(report.MakeNode("internet").WithTopology(render.Pseudo))
+
+	have := render.GroupBy("team", render.SelectContainer).Render(rpt).Nodes
+	if len(have) != 4 {
+		t.Fatalf("Expected 4 nodes, got %v", have)
+	}
+	web := have["web"]
+	if web.Topology != render.MakeGroupNodeTopology(report.Container, "team") {
+		t.Errorf("Expected a group node, got %s", web.Topology)
+	}
+	if count, _ := web.Counters.Lookup(report.Container); count != 2 {
+		t.Errorf("Expected 2 containers in web, got %d", count)
+	}
+	if _, ok := have["db"]; !ok {
+		t.Errorf("Expected a db node, got %v", have)
+	}
+	ungrouped := have[render.MakePseudoNodeID(render.UngroupedID, "team")]
+	if ungrouped.Topology != render.Pseudo || ungrouped.Children.Size() != 1 {
+		t.Errorf("Expected ungrouped containers in a pseudo node, got %v", ungrouped)
+	}
+	if _, ok := have["internet"]; !ok {
+		t.Errorf("Expected pseudo nodes to be propagated, got %v", have)
+	}
+
+	topology, key, ok := render.ParseGroupNodeTopology(render.MakeGroupNodeTopology(report.Pod, "example.com/team:v1"))
+	if !ok || topology != report.Pod || key != "example.com/team:v1" {
+		t.Errorf("Expected keys with colons to parse, got %s, %s, %v", topology, key, ok)
+	}
+}
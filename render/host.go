@@ -1,6 +1,7 @@
 package render
 
 import (
+	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -13,9 +14,65 @@ var HostRenderer = MakeReduce(
 	CustomRenderer{RenderFunc: nodes2Hosts, Renderer: ContainerRenderer},
 	CustomRenderer{RenderFunc: nodes2Hosts, Renderer: ContainerImageRenderer},
 	CustomRenderer{RenderFunc: nodes2Hosts, Renderer: PodRenderer},
+	CustomRenderer{RenderFunc: nodes2Hosts, Renderer: SelectGPU},
+	CustomRenderer{RenderFunc: overlayPeers2Hosts, Renderer: SelectOverlay},
 	MapEndpoints(endpoint2Host, report.Host),
 )
 
+// ClusterRenderer is a Renderer which produces a renderable cluster
+// graph, grouping hosts by the cluster name their probes were given.
+//
+// not memoised
+var ClusterRenderer = MakeMap(
+	MapHost2Cluster,
+	HostRenderer,
+)
+
+// ZoneRenderer is a Renderer which produces a renderable zone graph,
+// grouping hosts by the cloud availability zone they run in.
+//
+// not memoised
+var ZoneRenderer = MakeMap(
+	MapHost2Zone,
+	HostRenderer,
+)
+
+var (
+	clusterTopology = MakeGroupNodeTopology(report.Host, host.ClusterName)
+	zoneTopology    = MakeGroupNodeTopology(report.Host, host.CloudZone)
+)
+
+// MapHost2Cluster maps host Nodes to cluster Nodes.
+//
+// Hosts without a cluster name (e.g. from probes which weren't told
+// which cluster they are in) are dropped; pseudo nodes are propagated.
+func MapHost2Cluster(n report.Node) report.Nodes {
+	return mapHost2Group(n, host.ClusterName, clusterTopology)
+}
+
+// MapHost2Zone maps host Nodes to zone Nodes.
+//
+// Hosts which aren't running in a cloud we know the metadata service of
+// are dropped; pseudo nodes are propagated.
+func MapHost2Zone(n report.Node) report.Nodes {
+	return mapHost2Group(n, host.CloudZone, zoneTopology)
+}
+
+func mapHost2Group(n report.Node, key, topology string) report.Nodes {
+	if n.Topology == Pseudo {
+		return report.Nodes{n.ID: n}
+	}
+
+	id, ok := n.Latest.Lookup(key)
+	if !ok {
+		return report.Nodes{}
+	}
+
+	node := NewDerivedNode(id, n).WithTopology(topology)
+	node.Counters = node.Counters.Add(n.Topology, 1)
+	return report.Nodes{id: node}
+}
+
 // nodes2Hosts maps any Nodes to host Nodes.
 //
 // If this function is given a node without a hostname
@@ -56,3 +113,55 @@ func endpoint2Host(n report.Node) string {
 	}
 	return ""
 }
+
+// tunnelPeerPrefixes are the prefixes of the overlay peers which connect
+// directly to each other, with tunnels between their hosts.
+var tunnelPeerPrefixes = map[string]bool{
+	report.WeaveOverlayPeerPrefix:     true,
+	report.WireGuardOverlayPeerPrefix: true,
+}
+
+// overlayPeers2Hosts maps the tunnels between the overlay peers monitored
+// by Scope to edges between their hosts, carrying over which of those are
+// unhealthy. Peers without a probe have no host to map to.
+func overlayPeers2Hosts(nodes Nodes) Nodes {
+	peerHosts := map[string]string{}
+	for id, n := range nodes.Nodes {
+		if peerPrefix, _ := report.ParseOverlayNodeID(id); !tunnelPeerPrefixes[peerPrefix] {
+			continue
+		}
+		if hostID, ok := n.Latest.Lookup(report.HostNodeID); ok {
+			// The weave reporter puts the bare host ID on its peer
+			if _, ok := report.ParseHostNodeID(hostID); !ok {
+				hostID = report.MakeHostNodeID(hostID)
+			}
+			peerHosts[id] = hostID
+		}
+	}
+
+	result := report.Nodes{}
+	for id, hostID := range peerHosts {
+		n := nodes.Nodes[id]
+		degraded, _ := n.Sets.Lookup(report.DegradedAdjacency)
+		host := report.MakeNode(hostID).WithTopology(report.Host)
+		degradedHosts := report.MakeStringSet()
+		for _, peerID := range n.Adjacency {
+			peerHostID, ok := peerHosts[peerID]
+			if !ok || peerHostID == hostID {
+				continue
+			}
+			host = host.WithAdjacent(peerHostID)
+			if degraded.Contains(peerID) {
+				degradedHosts = degradedHosts.Add(peerHostID)
+			}
+		}
+		if len(degradedHosts) > 0 {
+			host = host.WithSet(report.DegradedAdjacency, degradedHosts)
+		}
+		if existing, ok := result[hostID]; ok {
+			host = existing.Merge(host)
+		}
+		result[hostID] = host
+	}
+	return Nodes{Nodes: result}
+}
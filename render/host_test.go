@@ -4,8 +4,10 @@ import (
 	"testing"
 
 	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/expected"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
 	"github.com/weaveworks/scope/test/reflect"
 	"github.com/weaveworks/scope/test/utils"
@@ -18,3 +20,99 @@ func TestHostRenderer(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestClusterRenderer(t *testing.T) {
+	var (
+		hostA       = report.MakeHostNodeID("host-a")
+		hostB       = report.MakeHostNodeID("host-b")
+		hostC       = report.MakeHostNodeID("host-c")
+		clientEP    = report.MakeEndpointNodeID("host-a", "", "10.0.0.1", "54001")
+		externalEP  = report.MakeEndpointNodeID("", "", "203.0.113.7", "80")
+		internetEP  = report.MakeEndpointNodeID("", "", "198.51.100.1", "80")
+		hostAClient = report.MakeNodeWith(clientEP, map[string]string{report.HostNodeID: hostA}).
+				WithTopology(report.Endpoint).WithAdjacent(externalEP).WithAdjacent(internetEP)
+	)
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(hostA, map[string]string{host.ClusterName: "cluster-a"}).
+		WithSets(report.MakeSets().Add(host.LocalNetworks, report.MakeStringSet("10.0.0.0/8"))))
+	rpt.Host.AddNode(report.MakeNodeWith(hostB, map[string]string{host.ClusterName: "cluster-b"}).
+		WithSets(report.MakeSets().Add(host.ExternalIPs, report.MakeStringSet("203.0.113.7"))))
+	rpt.Host.AddNode(report.MakeNode(hostC))
+	rpt.Endpoint.AddNode(hostAClient)
+	rpt.Endpoint.AddNode(report.MakeNode(externalEP).WithTopology(report.Endpoint))
+	rpt.Endpoint.AddNode(report.MakeNode(internetEP).WithTopology(report.Endpoint))
+
+	have := render.ClusterRenderer.Render(rpt).Nodes
+	for _, id := range []string{"cluster-a", "cluster-b", render.OutgoingInternetID} {
+		if _, ok := have[id]; !ok {
+			t.Errorf("Expected node %q, got %v", id, have)
+		}
+	}
+	if len(have) != 3 {
+		t.Errorf("Expected host without cluster to be dropped, got %v", have)
+	}
+	// The connection to host-b's external IP is stitched to cluster-b,
+	// rather than attributed to the Internet.
+	want := report.MakeIDList("cluster-b", render.OutgoingInternetID)
+	if adjacency := have["cluster-a"].Adjacency; !reflect.DeepEqual(want, adjacency) {
+		t.Error(test.Diff(want, adjacency))
+	}
+}
+
+func TestZoneRenderer(t *testing.T) {
+	var (
+		hostA = report.MakeHostNodeID("host-a")
+		hostB = report.MakeHostNodeID("host-b")
+		hostC = report.MakeHostNodeID("host-c")
+	)
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(hostA, map[string]string{host.CloudZone: "us-east-1a"}))
+	rpt.Host.AddNode(report.MakeNodeWith(hostB, map[string]string{host.CloudZone: "us-east-1a"}))
+	rpt.Host.AddNode(report.MakeNode(hostC))
+
+	have := render.ZoneRenderer.Render(rpt).Nodes
+	if len(have) != 1 {
+		t.Fatalf("Expected host without zone to be dropped, got %v", have)
+	}
+	zone, ok := have["us-east-1a"]
+	if !ok {
+		t.Fatalf("Expected node %q, got %v", "us-east-1a", have)
+	}
+	for _, id := range []string{hostA, hostB} {
+		if _, ok := zone.Children.Lookup(id); !ok {
+			t.Errorf("Expected host %q in zone, got %v", id, zone.Children)
+		}
+	}
+}
+
+func TestHostRendererWeaveEdges(t *testing.T) {
+	var (
+		peerA = report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, "peer-a")
+		peerB = report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, "peer-b")
+		peerC = report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, "peer-c")
+		// Not monitored by Scope
+		peerD = report.MakeOverlayNodeID(report.WeaveOverlayPeerPrefix, "peer-d")
+		hostA = report.MakeHostNodeID("host-a")
+		hostB = report.MakeHostNodeID("host-b")
+		hostC = report.MakeHostNodeID("host-c")
+	)
+	rpt := report.MakeReport()
+	rpt.Overlay.AddNode(report.MakeNodeWith(peerA, map[string]string{report.HostNodeID: "host-a"}).
+		WithAdjacent(peerB).WithAdjacent(peerC).WithAdjacent(peerD).
+		WithSet(report.DegradedAdjacency, report.MakeStringSet(peerC, peerD)))
+	rpt.Overlay.AddNode(report.MakeNodeWith(peerB, map[string]string{report.HostNodeID: "host-b"}))
+	rpt.Overlay.AddNode(report.MakeNodeWith(peerC, map[string]string{report.HostNodeID: "host-c"}))
+	rpt.Overlay.AddNode(report.MakeNode(peerD))
+
+	have := render.HostRenderer.Render(rpt).Nodes
+	node, ok := have[hostA]
+	if !ok {
+		t.Fatalf("Expected node %q, got %v", hostA, have)
+	}
+	if want := report.MakeIDList(hostB, hostC); !reflect.DeepEqual(want, node.Adjacency) {
+		t.Errorf("Expected adjacency %v, got %v", want, node.Adjacency)
+	}
+	if degraded, _ := node.Sets.Lookup(report.DegradedAdjacency); !reflect.DeepEqual(report.MakeStringSet(hostC), degraded) {
+		t.Errorf("Expected degraded adjacency %v, got %v", []string{hostC}, degraded)
+	}
+}
@@ -37,6 +37,26 @@ func ParsePseudoNodeID(nodeID string) (string, bool) {
 	return nodeID[pos+1:], true
 }
 
+// MakeLoadBalancerNodeID makes the ID of the pseudo node of the
+// connections through the listeners of a load balancer, addressed by
+// hostname. Listeners and hostname may be empty.
+func MakeLoadBalancerNodeID(name, listeners, hostname string) string {
+	return LoadBalancerNodeIDPrefix + strings.Join([]string{name, listeners, hostname}, ";")
+}
+
+// ParseLoadBalancerNodeID returns the name, listeners and hostname of the
+// load balancer of a pseudo node.
+func ParseLoadBalancerNodeID(nodeID string) (name, listeners, hostname string, ok bool) {
+	if !strings.HasPrefix(nodeID, LoadBalancerNodeIDPrefix) {
+		return "", "", "", false
+	}
+	parts := strings.SplitN(nodeID[len(LoadBalancerNodeIDPrefix):], ";", 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
 // MakeGroupNodeTopology joins the parts of a group topology into the topology of a group node
 func MakeGroupNodeTopology(originalTopology, key string) string {
 	return strings.Join([]string{"group", originalTopology, key}, ":")
@@ -44,7 +64,8 @@ func MakeGroupNodeTopology(originalTopology, key string) string {
 
 // ParseGroupNodeTopology returns the parts of a group topology.
 func ParseGroupNodeTopology(topology string) (string, string, bool) {
-	parts := strings.Split(topology, ":")
+	// The key may have colons of its own
+	parts := strings.SplitN(topology, ":", 3)
 	if len(parts) != 3 || parts[0] != "group" {
 		return "", "", false
 	}
@@ -79,7 +100,22 @@ func pseudoNodeID(n report.Node, local report.Networks) (string, bool) {
 
 // figure out if a node should be considered external and returns an ID which can be used to create a pseudo node
 func externalNodeID(n report.Node, addr string, local report.Networks) (string, bool) {
-	// First, check if it's a known service and emit a a specific node if it
+	// Load balancers the probes know of are told apart from the clients
+	// they forward connections of, wherever they are.
+	if name, ok := n.Latest.Lookup(report.LoadBalancerName); ok {
+		listeners, _ := n.Latest.Lookup(report.LoadBalancerListener)
+		hostname, _ := n.Latest.Lookup(report.LoadBalancerHostname)
+		return MakeLoadBalancerNodeID(name, listeners, hostname), true
+	}
+
+	// First, check if it's one of the services configured or built in, by
+	// hostname or address. Those can be in local networks too, e.g. the
+	// corporate LDAP servers.
+	if name, found := externalServiceName(n, addr); found {
+		return ServiceNodeIDPrefix + name, true
+	}
+
+	// Then, check if it's a known service and emit a a specific node if it
 	// is. This needs to be done before checking IPs since known services can
 	// live in the same network, see https://github.com/weaveworks/scope/issues/2163
 	if hostname, found := DNSFirstMatch(n, isKnownService); found {
@@ -1,8 +1,11 @@
 package render
 
 import (
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"sort"
 	"sync"
 
 	"github.com/bluele/gcache"
@@ -10,19 +13,29 @@ import (
 	"github.com/weaveworks/scope/report"
 )
 
-// renderCache is keyed on the combination of Memoiser and report
-// id. It contains promises of report.Nodes, which result from
-// rendering the report with the Memoiser's renderer.
+// renderCache is keyed on the combination of Memoiser and what it
+// renders of the report: the fingerprints of the topologies it reads
+// when it knows which those are, the report id otherwise. It contains
+// promises of report.Nodes, which result from rendering the report
+// with the Memoiser's renderer.
 //
 // The use of promises ensures that in the absence of cache evictions
 // a memoiser will only ever render a report once, even when Render()
-// is invoked concurrently.
+// is invoked concurrently. Keying on fingerprints means it only renders
+// a topology again once it changed, whatever else in the report did.
 var renderCache = gcache.New(100).LRU().Build()
 
+// fingerprintCache is keyed on report id, and contains the
+// *topologyFingerprints of the report, so every Memoiser rendering the
+// report shares them.
+var fingerprintCache = gcache.New(100).LRU().Build()
+
 type memoise struct {
 	sync.Mutex
 	Renderer
-	id string
+	id         string
+	topologies []string // the topologies Renderer reads, if known
+	known      bool
 }
 
 // Memoise wraps the renderer in a loving embrace of caching.
@@ -30,10 +43,32 @@ func Memoise(r Renderer) Renderer {
 	if _, ok := r.(*memoise); ok {
 		return r // fixpoint
 	}
+	topologies, known := readTopologies(r)
 	return &memoise{
-		Renderer: r,
-		id:       fmt.Sprintf("%x", rand.Int63()),
+		Renderer:   r,
+		id:         fmt.Sprintf("%x", rand.Int63()),
+		topologies: topologies,
+		known:      known,
+	}
+}
+
+func (m *memoise) readTopologies() ([]string, bool) {
+	return m.topologies, m.known
+}
+
+// key is what the cached rendering of rpt is keyed on.
+func (m *memoise) key(rpt report.Report) string {
+	if !m.known {
+		return fmt.Sprintf("%s-%s", rpt.ID, m.id)
 	}
+	fingerprints := fingerprintsOf(rpt)
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, topology := range m.topologies {
+		binary.LittleEndian.PutUint64(buf[:], fingerprints.get(rpt, topology))
+		h.Write(buf[:])
+	}
+	return fmt.Sprintf("%x-%s", h.Sum64(), m.id)
 }
 
 // Render produces a set of Nodes given a Report.  Ideally, it just
@@ -41,7 +76,7 @@ func Memoise(r Renderer) Renderer {
 // it stores a new promise and fulfils it by calling through to
 // m.Renderer.
 func (m *memoise) Render(rpt report.Report) Nodes {
-	key := fmt.Sprintf("%s-%s", rpt.ID, m.id)
+	key := m.key(rpt)
 
 	m.Lock()
 	v, err := renderCache.Get(key)
@@ -78,3 +113,64 @@ func (p *promise) Get() Nodes {
 	<-p.done
 	return p.val
 }
+
+// topologyReader is implemented by Renderers which know which
+// topologies of the report they read, so what they render only depends
+// on the nodes of those.
+type topologyReader interface {
+	readTopologies() ([]string, bool)
+}
+
+// readTopologies returns the sorted topologies the renderers read, and
+// whether they could all tell.
+func readTopologies(rs ...Renderer) ([]string, bool) {
+	seen := map[string]struct{}{}
+	for _, r := range rs {
+		tr, ok := r.(topologyReader)
+		if !ok {
+			return nil, false
+		}
+		topologies, ok := tr.readTopologies()
+		if !ok {
+			return nil, false
+		}
+		for _, topology := range topologies {
+			seen[topology] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(seen))
+	for topology := range seen {
+		result = append(result, topology)
+	}
+	sort.Strings(result)
+	return result, true
+}
+
+// topologyFingerprints are the fingerprints of the nodes of the
+// topologies of a report, worked out as they are asked for.
+type topologyFingerprints struct {
+	sync.Mutex
+	fingerprints map[string]uint64
+}
+
+func fingerprintsOf(rpt report.Report) *topologyFingerprints {
+	v, err := fingerprintCache.Get(rpt.ID)
+	if err == nil {
+		return v.(*topologyFingerprints)
+	}
+	f := &topologyFingerprints{fingerprints: map[string]uint64{}}
+	fingerprintCache.Set(rpt.ID, f)
+	return f
+}
+
+func (f *topologyFingerprints) get(rpt report.Report, name string) uint64 {
+	f.Lock()
+	defer f.Unlock()
+	fingerprint, ok := f.fingerprints[name]
+	if !ok {
+		topology, _ := rpt.Topology(name)
+		fingerprint = topology.Nodes.Fingerprint()
+		f.fingerprints[name] = fingerprint
+	}
+	return fingerprint
+}
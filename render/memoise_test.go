@@ -2,7 +2,9 @@ package render_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
@@ -62,3 +64,42 @@ func TestMemoise(t *testing.T) {
 		t.Errorf("Expected renderer to have been called again after cache reset")
 	}
 }
+
+func TestMemoiseOnTopologies(t *testing.T) {
+	calls := 0
+	m := render.Memoise(render.MakeMap(func(n report.Node) report.Nodes {
+		calls++
+		return report.Nodes{n.ID: n}
+	}, render.SelectContainer))
+
+	mtime.NowForce(time.Now())
+	defer mtime.NowReset()
+	makeReport := func(containerName, hostName string) report.Report {
+		rpt := report.MakeReport()
+		rpt.Container.AddNode(report.MakeNodeWith("c1", map[string]string{"name": containerName}))
+		rpt.Host.AddNode(report.MakeNodeWith("h1", map[string]string{"name": hostName}))
+		return rpt
+	}
+
+	result1 := m.Render(makeReport("foo", "bar"))
+	if calls != 1 {
+		t.Errorf("Expected renderer to have been called the first time")
+	}
+
+	// Another report, with the same containers
+	result2 := m.Render(makeReport("foo", "baz"))
+	if !reflect.DeepEqual(result1, result2) {
+		t.Errorf("Expected memoised result to be returned: %s", test.Diff(result1, result2))
+	}
+	if calls != 1 {
+		t.Errorf("Expected renderer to not have been called for unchanged containers")
+	}
+
+	result3 := m.Render(makeReport("qux", "bar"))
+	if reflect.DeepEqual(result1, result3) {
+		t.Errorf("Expected different result for different containers, but were the same")
+	}
+	if calls != 2 {
+		t.Errorf("Expected renderer to have been called again for different containers")
+	}
+}
@@ -1,6 +1,8 @@
 package render
 
 import (
+	"time"
+
 	"github.com/weaveworks/scope/report"
 )
 
@@ -19,6 +21,7 @@ type propagateSingleMetrics struct {
 
 func (p propagateSingleMetrics) Render(rpt report.Report) Nodes {
 	nodes := p.r.Render(rpt)
+	defer timeStage("propagate_metrics", time.Now())
 	outputs := make(report.Nodes, len(nodes.Nodes))
 	for id, n := range nodes.Nodes {
 		var first report.Node
@@ -40,3 +43,7 @@ func (p propagateSingleMetrics) Render(rpt report.Report) Nodes {
 	}
 	return Nodes{Nodes: outputs, Filtered: nodes.Filtered}
 }
+
+func (p propagateSingleMetrics) readTopologies() ([]string, bool) {
+	return readTopologies(p.r)
+}
@@ -0,0 +1,36 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// NomadAllocationRenderer is a Renderer for HashiCorp Nomad allocations.
+var NomadAllocationRenderer = Memoise(renderIfAnyNodes(nomadTopologies,
+	renderParents(
+		report.Container, []string{report.NomadAllocation}, UnmanagedID,
+		MakeFilter(
+			IsRunning,
+			ContainerWithImageNameRenderer,
+		),
+	),
+))
+
+// NomadTaskGroupRenderer is a Renderer for the task groups of Nomad jobs.
+var NomadTaskGroupRenderer = Memoise(renderIfAnyNodes(nomadTopologies,
+	renderParents(
+		report.NomadAllocation, []string{report.NomadTaskGroup}, "",
+		NomadAllocationRenderer,
+	),
+))
+
+// NomadJobRenderer is a Renderer for Nomad jobs.
+//
+// not memoised
+var NomadJobRenderer = renderIfAnyNodes(nomadTopologies,
+	renderParents(
+		report.NomadTaskGroup, []string{report.NomadJob}, "",
+		NomadTaskGroupRenderer,
+	),
+)
+
+var nomadTopologies = []string{report.NomadAllocation, report.NomadTaskGroup, report.NomadJob}
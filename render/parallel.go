@@ -0,0 +1,66 @@
+package render
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "scope",
+	Name:      "render_stage_duration_seconds",
+	Help:      "Time in seconds spent in each stage of rendering, not counting the stages it renders from.",
+	Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+}, []string{"stage"})
+
+func init() {
+	prometheus.MustRegister(stageDuration)
+}
+
+// timeStage records how long a stage of rendering took since start.
+func timeStage(stage string, start time.Time) {
+	stageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// workers bounds how many goroutines render stages besides the ones
+// rendering for requests. A stage finding no worker free is rendered by
+// the goroutine which wanted it, so stages waiting on the stages they
+// render from can't deadlock waiting for workers.
+var workers = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// SetWorkers sets how many goroutines may render stages concurrently,
+// GOMAXPROCS if n isn't positive. It must be called before rendering.
+func SetWorkers(n int) {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	workers = make(chan struct{}, n)
+}
+
+// Parallel calls f with each of 0 to n-1, concurrently on as many
+// workers as are free, and returns once all calls did.
+func Parallel(n int, f func(int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if i == n-1 {
+			f(i)
+			break
+		}
+		select {
+		case workers <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				f(i)
+			}(i)
+		default:
+			f(i)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,40 @@
+package render_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+)
+
+func TestParallel(t *testing.T) {
+	render.SetWorkers(2)
+	defer render.SetWorkers(0)
+
+	var (
+		calls             [10]int32
+		running, mostSeen int32
+	)
+	render.Parallel(len(calls), func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&mostSeen)
+			if n <= seen || atomic.CompareAndSwapInt32(&mostSeen, seen, n) {
+				break
+			}
+		}
+		// Nested calls find no workers free, and so mustn't wait for them
+		render.Parallel(len(calls), func(int) {})
+		atomic.AddInt32(&calls[i], 1)
+	})
+	for i, n := range calls {
+		if n != 1 {
+			t.Errorf("Expected %d to be called once, got %d", i, n)
+		}
+	}
+	// The two workers, and the caller
+	if mostSeen > 3 {
+		t.Errorf("Expected at most 3 calls at once, got %d", mostSeen)
+	}
+}
@@ -17,22 +17,15 @@ const (
 // UnmanagedIDPrefix is the prefix of unmanaged pseudo nodes
 var UnmanagedIDPrefix = MakePseudoNodeID(UnmanagedID, "")
 
-func renderKubernetesTopologies(rpt report.Report) bool {
-	// Render if any k8s topology has any nodes
-	topologies := []*report.Topology{
-		&rpt.Pod,
-		&rpt.Service,
-		&rpt.Deployment,
-		&rpt.DaemonSet,
-		&rpt.StatefulSet,
-		&rpt.CronJob,
-	}
-	for _, t := range topologies {
-		if len(t.Nodes) > 0 {
-			return true
-		}
-	}
-	return false
+// Render if any k8s topology has any nodes
+var kubernetesTopologies = []string{
+	report.Pod,
+	report.Service,
+	report.Deployment,
+	report.DaemonSet,
+	report.StatefulSet,
+	report.CronJob,
+	report.Autoscaler,
 }
 
 func isPauseContainer(n report.Node) bool {
@@ -42,7 +35,7 @@ func isPauseContainer(n report.Node) bool {
 
 // PodRenderer is a Renderer which produces a renderable kubernetes
 // graph by merging the container graph and the pods topology.
-var PodRenderer = Memoise(ConditionalRenderer(renderKubernetesTopologies,
+var PodRenderer = Memoise(renderIfAnyNodes(kubernetesTopologies,
 	MakeFilter(
 		func(n report.Node) bool {
 			state, ok := n.Latest.Lookup(kubernetes.State)
@@ -70,7 +63,7 @@ var PodRenderer = Memoise(ConditionalRenderer(renderKubernetesTopologies,
 // graph by merging the pods graph and the services topology.
 //
 // not memoised
-var PodServiceRenderer = ConditionalRenderer(renderKubernetesTopologies,
+var PodServiceRenderer = renderIfAnyNodes(kubernetesTopologies,
 	renderParents(
 		report.Pod, []string{report.Service}, "",
 		PodRenderer,
@@ -81,15 +74,27 @@ var PodServiceRenderer = ConditionalRenderer(renderKubernetesTopologies,
 // Pods with no controller are mapped to 'Unmanaged'
 // We can't simply combine the rendered graphs of the high level objects as they would never
 // have connections to each other.
+// Autoscalers are included as-is, with edges to the controllers they scale.
 //
 // not memoised
-var KubeControllerRenderer = ConditionalRenderer(renderKubernetesTopologies,
-	renderParents(
-		report.Pod, []string{report.Deployment, report.DaemonSet, report.StatefulSet, report.CronJob}, UnmanagedID,
-		PodRenderer,
+var KubeControllerRenderer = renderIfAnyNodes(kubernetesTopologies,
+	MakeReduce(
+		SelectAutoscaler,
+		renderParents(
+			report.Pod, []string{report.Deployment, report.DaemonSet, report.StatefulSet, report.CronJob}, UnmanagedID,
+			PodRenderer,
+		),
 	),
 )
 
+// NamespaceRenderer is a Renderer which produces a renderable kubernetes
+// namespaces graph, showing the resource quota utilization of each.
+//
+// not memoised
+var NamespaceRenderer = renderIfAnyNodes(kubernetesTopologies,
+	SelectNamespace,
+)
+
 // renderParents produces a 'standard' renderer for mapping from some child topology to some parent topologies,
 // by taking a child renderer, mapping to parents, propagating single metrics, and joining with full parent topology.
 // Other options are as per Map2Parent.
@@ -1,6 +1,8 @@
 package render
 
 import (
+	"time"
+
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/probe/process"
@@ -34,6 +36,7 @@ type processWithContainerNameRenderer struct {
 func (r processWithContainerNameRenderer) Render(rpt report.Report) Nodes {
 	processes := r.Renderer.Render(rpt)
 	containers := SelectContainer.Render(rpt)
+	defer timeStage("container_names", time.Now())
 
 	outputs := make(report.Nodes, len(processes.Nodes))
 	for id, p := range processes.Nodes {
@@ -52,6 +55,10 @@ func (r processWithContainerNameRenderer) Render(rpt report.Report) Nodes {
 	return Nodes{Nodes: outputs, Filtered: processes.Filtered}
 }
 
+func (r processWithContainerNameRenderer) readTopologies() ([]string, bool) {
+	return readTopologies(r.Renderer, SelectContainer)
+}
+
 // ProcessWithContainerNameRenderer is a Renderer which produces a process
 // graph enriched with container names where appropriate
 //
@@ -91,6 +98,10 @@ func (e endpoints2Processes) Render(rpt report.Report) Nodes {
 		}, report.Process).Render(rpt)
 }
 
+func (e endpoints2Processes) readTopologies() ([]string, bool) {
+	return mapEndpoints{topology: report.Process}.readTopologies()
+}
+
 // When there is more than one connection originating from a source
 // endpoint, we cannot be sure that its pid is associated with all of
 // them, since the source endpoint may have been re-used by a
@@ -1,6 +1,8 @@
 package render
 
 import (
+	"time"
+
 	"github.com/weaveworks/scope/report"
 )
 
@@ -60,27 +62,34 @@ func MakeReduce(renderers ...Renderer) Renderer {
 	return Reduce(renderers)
 }
 
-// Render produces a set of Nodes given a Report.
+// Render produces a set of Nodes given a Report, rendering with the
+// renderers in parallel, and merging their outputs pairwise in parallel.
 func (r Reduce) Render(rpt report.Report) Nodes {
-	l := len(r)
-	switch l {
-	case 0:
+	if len(r) == 0 {
 		return Nodes{}
 	}
-	c := make(chan Nodes, l)
-	for _, renderer := range r {
-		renderer := renderer // Pike!!
-		go func() {
-			c <- renderer.Render(rpt)
-		}()
-	}
-	for ; l > 1; l-- {
-		left, right := <-c, <-c
-		go func() {
-			c <- left.Merge(right)
-		}()
+	outputs := make([]Nodes, len(r))
+	Parallel(len(r), func(i int) {
+		outputs[i] = r[i].Render(rpt)
+	})
+
+	defer timeStage("reduce", time.Now())
+	for len(outputs) > 1 {
+		merged := make([]Nodes, (len(outputs)+1)/2)
+		Parallel(len(merged), func(i int) {
+			if 2*i+1 < len(outputs) {
+				merged[i] = outputs[2*i].Merge(outputs[2*i+1])
+			} else {
+				merged[i] = outputs[2*i]
+			}
+		})
+		outputs = merged
 	}
-	return <-c
+	return outputs[0]
+}
+
+func (r Reduce) readTopologies() ([]string, bool) {
+	return readTopologies(r...)
 }
 
 // Map is a Renderer which produces a set of Nodes from the set of
@@ -98,8 +107,10 @@ func MakeMap(f MapFunc, r Renderer) Renderer {
 // Render transforms a set of Nodes produces by another Renderer.
 // using a map function
 func (m Map) Render(rpt report.Report) Nodes {
+	input := m.Renderer.Render(rpt)
+	defer timeStage("map", time.Now())
+
 	var (
-		input       = m.Renderer.Render(rpt)
 		output      = report.Nodes{}
 		mapped      = map[string]report.IDList{} // input node ID -> output node IDs
 		adjacencies = map[string]report.IDList{} // output node ID -> input node Adjacencies
@@ -132,6 +143,10 @@ func (m Map) Render(rpt report.Report) Nodes {
 	return Nodes{Nodes: output}
 }
 
+func (m Map) readTopologies() ([]string, bool) {
+	return readTopologies(m.Renderer)
+}
+
 func propagateLatest(key string, from, to report.Node) report.Node {
 	if value, timestamp, ok := from.Latest.LookupEntry(key); ok {
 		to.Latest = to.Latest.Set(key, timestamp, value)
@@ -145,12 +160,30 @@ type Condition func(report.Report) bool
 type conditionalRenderer struct {
 	Condition
 	Renderer
+	topologies []string // the topologies Condition reads, if known
 }
 
 // ConditionalRenderer renders nothing if the condition is false, otherwise it defers
 // to the wrapped Renderer.
 func ConditionalRenderer(c Condition, r Renderer) Renderer {
-	return conditionalRenderer{c, r}
+	return conditionalRenderer{Condition: c, Renderer: r}
+}
+
+// renderIfAnyNodes renders nothing unless any of the topologies has
+// nodes, otherwise it defers to the wrapped Renderer.
+func renderIfAnyNodes(topologies []string, r Renderer) Renderer {
+	return conditionalRenderer{
+		Condition: func(rpt report.Report) bool {
+			for _, name := range topologies {
+				if topology, _ := rpt.Topology(name); len(topology.Nodes) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+		Renderer:   r,
+		topologies: topologies,
+	}
 }
 
 func (cr conditionalRenderer) Render(rpt report.Report) Nodes {
@@ -160,6 +193,14 @@ func (cr conditionalRenderer) Render(rpt report.Report) Nodes {
 	return Nodes{}
 }
 
+func (cr conditionalRenderer) readTopologies() ([]string, bool) {
+	topologies, ok := readTopologies(cr.Renderer)
+	if !ok || cr.topologies == nil {
+		return nil, false
+	}
+	return append(topologies, cr.topologies...), true
+}
+
 // joinResults is used by Renderers that join sets of nodes
 type joinResults struct {
 	nodes  report.Nodes
@@ -255,5 +296,6 @@ func (ret *joinResults) rewriteAdjacency(outID string, adjacency report.IDList)
 // cache.
 func ResetCache() {
 	renderCache.Purge()
+	fingerprintCache.Purge()
 	purgeKnownServiceCache()
 }
@@ -0,0 +1,11 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// ScopeProbeRenderer is a Renderer for the probes themselves, as they
+// report how they are doing.
+//
+// not memoised
+var ScopeProbeRenderer = renderIfAnyNodes([]string{report.ScopeProbe}, SelectScopeProbe)
@@ -14,22 +14,33 @@ func (t TopologySelector) Render(r report.Report) Nodes {
 	return Nodes{Nodes: topology.Nodes}
 }
 
+func (t TopologySelector) readTopologies() ([]string, bool) {
+	return []string{string(t)}, true
+}
+
 // The topology selectors implement a Renderer which fetch the nodes from the
 // various report topologies.
 var (
-	SelectEndpoint       = TopologySelector(report.Endpoint)
-	SelectProcess        = TopologySelector(report.Process)
-	SelectContainer      = TopologySelector(report.Container)
-	SelectContainerImage = TopologySelector(report.ContainerImage)
-	SelectHost           = TopologySelector(report.Host)
-	SelectPod            = TopologySelector(report.Pod)
-	SelectService        = TopologySelector(report.Service)
-	SelectDeployment     = TopologySelector(report.Deployment)
-	SelectDaemonSet      = TopologySelector(report.DaemonSet)
-	SelectStatefulSet    = TopologySelector(report.StatefulSet)
-	SelectCronJob        = TopologySelector(report.CronJob)
-	SelectECSTask        = TopologySelector(report.ECSTask)
-	SelectECSService     = TopologySelector(report.ECSService)
-	SelectSwarmService   = TopologySelector(report.SwarmService)
-	SelectOverlay        = TopologySelector(report.Overlay)
+	SelectEndpoint        = TopologySelector(report.Endpoint)
+	SelectProcess         = TopologySelector(report.Process)
+	SelectContainer       = TopologySelector(report.Container)
+	SelectContainerImage  = TopologySelector(report.ContainerImage)
+	SelectHost            = TopologySelector(report.Host)
+	SelectPod             = TopologySelector(report.Pod)
+	SelectService         = TopologySelector(report.Service)
+	SelectDeployment      = TopologySelector(report.Deployment)
+	SelectDaemonSet       = TopologySelector(report.DaemonSet)
+	SelectStatefulSet     = TopologySelector(report.StatefulSet)
+	SelectCronJob         = TopologySelector(report.CronJob)
+	SelectAutoscaler      = TopologySelector(report.Autoscaler)
+	SelectNamespace       = TopologySelector(report.Namespace)
+	SelectECSTask         = TopologySelector(report.ECSTask)
+	SelectECSService      = TopologySelector(report.ECSService)
+	SelectSwarmService    = TopologySelector(report.SwarmService)
+	SelectNomadJob        = TopologySelector(report.NomadJob)
+	SelectNomadTaskGroup  = TopologySelector(report.NomadTaskGroup)
+	SelectNomadAllocation = TopologySelector(report.NomadAllocation)
+	SelectGPU             = TopologySelector(report.GPU)
+	SelectScopeProbe      = TopologySelector(report.ScopeProbe)
+	SelectOverlay         = TopologySelector(report.Overlay)
 )
@@ -7,7 +7,7 @@ import (
 // SwarmServiceRenderer is a Renderer for Docker Swarm services
 //
 // not memoised
-var SwarmServiceRenderer = ConditionalRenderer(renderSwarmTopologies,
+var SwarmServiceRenderer = renderIfAnyNodes(swarmTopologies,
 	renderParents(
 		report.Container, []string{report.SwarmService}, UnmanagedID,
 		MakeFilter(
@@ -17,6 +17,4 @@ var SwarmServiceRenderer = ConditionalRenderer(renderSwarmTopologies,
 	),
 )
 
-func renderSwarmTopologies(rpt report.Report) bool {
-	return len(rpt.SwarmService.Nodes) >= 1
-}
+var swarmTopologies = []string{report.SwarmService}
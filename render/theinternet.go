@@ -14,6 +14,10 @@ var (
 	// ServiceNodeIDPrefix is how the ID of all service pseudo nodes begin
 	ServiceNodeIDPrefix = "service-"
 
+	// LoadBalancerNodeIDPrefix is how the ID of all load balancer pseudo
+	// nodes begin
+	LoadBalancerNodeIDPrefix = "lb-"
+
 	knownServiceMatcher = regexp.MustCompile(`^.+\.(` + strings.Join([]string{
 		// See http://docs.aws.amazon.com/general/latest/gr/rande.html
 		// for finer grained details
@@ -83,3 +87,19 @@ func LocalNetworks(r report.Report) report.Networks {
 	}
 	return networks
 }
+
+// ExternalIPs returns a map from the externally visible IPs reported by
+// hosts (e.g. the address a host in one cluster appears to connect from
+// when talking to another cluster) to the ID of the host owning them. It
+// is used to attribute connections to those IPs to the right host, rather
+// than to the Internet.
+func ExternalIPs(r report.Report) map[string]string {
+	result := map[string]string{}
+	for id, n := range r.Host.Nodes {
+		ips, _ := n.Sets.Lookup(host.ExternalIPs)
+		for _, ip := range ips {
+			result[ip] = id
+		}
+	}
+	return result
+}
@@ -0,0 +1,23 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// WireGuardRenderer is a Renderer which produces a renderable topology of
+// the WireGuard interfaces, with edges for their tunnels.
+//
+// not memoised
+var WireGuardRenderer = MakeMap(
+	MapWireGuardIdentity,
+	SelectOverlay,
+)
+
+// MapWireGuardIdentity maps an overlay topology node to a WireGuard topology
+// node, if it is a WireGuard interface.
+func MapWireGuardIdentity(m report.Node) report.Nodes {
+	if peerPrefix, _ := report.ParseOverlayNodeID(m.ID); peerPrefix != report.WireGuardOverlayPeerPrefix {
+		return nil
+	}
+	return report.Nodes{m.ID: m}
+}
@@ -0,0 +1,103 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+)
+
+// The encodings reports may be compressed with, named as in
+// Content-Encoding. Gzip is what all apps take; snappy costs probes nearly
+// three times less CPU to compress with (see BenchmarkCompression), for
+// reports two thirds larger.
+const (
+	GzipEncoding   = "gzip"
+	SnappyEncoding = "snappy"
+)
+
+// Encodings are the encodings reports may be compressed with.
+var Encodings = []string{GzipEncoding, SnappyEncoding}
+
+// maxSnappyLen bounds what a snappy report decompresses to.
+const maxSnappyLen = 1 << 30
+
+// errTooLarge is returned when a report decompresses to more than allowed.
+type errTooLarge struct {
+	maxSize int
+}
+
+func (e errTooLarge) Error() string {
+	return fmt.Sprintf("report decompresses to more than %d bytes", e.maxSize)
+}
+
+// NewCompressor returns a writer compressing what is written to it with
+// the named encoding, onto w. It must be closed to flush it.
+func NewCompressor(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case GzipEncoding:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case SnappyEncoding:
+		return &snappyWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %q", encoding)
+}
+
+// decompress returns buf, compressed with the named encoding, or not at
+// all if it's empty, decompressed. It refuses to decompress to more than
+// maxSize bytes, unless that's 0.
+func decompress(buf []byte, encoding string, maxSize int) ([]byte, error) {
+	switch encoding {
+	case "", "identity":
+		if maxSize > 0 && len(buf) > maxSize {
+			return nil, errTooLarge{maxSize}
+		}
+		return buf, nil
+	case GzipEncoding:
+		r, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		if maxSize <= 0 {
+			return ioutil.ReadAll(r)
+		}
+		if buf, err = ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1)); err != nil {
+			return nil, err
+		} else if len(buf) > maxSize {
+			return nil, errTooLarge{maxSize}
+		}
+		return buf, nil
+	case SnappyEncoding:
+		// Snappy blocks are decompressed whole
+		limit := maxSnappyLen
+		if maxSize > 0 && maxSize < limit {
+			limit = maxSize
+		}
+		if n, err := snappy.DecodedLen(buf); err != nil {
+			return nil, err
+		} else if n > limit {
+			return nil, errTooLarge{limit}
+		}
+		return snappy.Decode(nil, buf)
+	}
+	return nil, fmt.Errorf("unsupported encoding: %q", encoding)
+}
+
+// snappyWriter compresses all that's written to it as one snappy block, on
+// Close.
+type snappyWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (s *snappyWriter) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *snappyWriter) Close() error {
+	_, err := s.w.Write(snappy.Encode(nil, s.buf.Bytes()))
+	return err
+}
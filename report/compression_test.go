@@ -0,0 +1,84 @@
+package report_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// makeBigReport makes a report of n containers, with the sort of metadata
+// and metrics probes report for them.
+func makeBigReport(n int) report.Report {
+	t1 := time.Unix(1500000000, 0).UTC()
+	rpt := report.MakeReport()
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%064x;<container>", i*7919)
+		rpt.Container.AddNode(report.MakeNodeWith(id, map[string]string{
+			"docker_container_id":      id[:64],
+			"docker_container_name":    fmt.Sprintf("service-%d", i%50),
+			"docker_image_id":          fmt.Sprintf("sha256:%064x", i%20),
+			"docker_container_state":   "running",
+			"docker_container_command": "/bin/server --listen=:8080",
+		}).WithMetrics(report.Metrics{
+			"docker_cpu_total_usage": report.MakeSingletonMetric(t1, float64(i)/float64(n)),
+			"docker_memory_usage":    report.MakeSingletonMetric(t1, float64(i*1024)),
+		}).WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet("host;<host>"))))
+	}
+	return rpt
+}
+
+func TestCompression(t *testing.T) {
+	rpt := makeBigReport(100)
+	for _, encoding := range report.Encodings {
+		for _, contentType := range []string{report.MsgpackContentType, report.ProtobufContentType} {
+			var buf bytes.Buffer
+			if err := rpt.WriteEncoded(&buf, contentType, encoding); err != nil {
+				t.Fatal(err)
+			}
+			have, err := report.MakeFromEncodedBytes(buf.Bytes(), contentType, encoding, 0)
+			if err != nil {
+				t.Fatalf("%s %s: %v", contentType, encoding, err)
+			}
+			if len(have.Container.Nodes) != 100 {
+				t.Errorf("%s %s: expected 100 containers, got %d", contentType, encoding, len(have.Container.Nodes))
+			}
+		}
+	}
+
+	if _, err := report.NewCompressor(&bytes.Buffer{}, "zip"); err == nil {
+		t.Errorf("Expected unknown encodings to be refused")
+	}
+}
+
+// BenchmarkCompression compares what it costs probes to compress a report
+// with each of the encodings. Run with -v for the sizes.
+func BenchmarkCompression(b *testing.B) {
+	rpt := makeBigReport(1000)
+	var raw []byte
+	if err := codec.NewEncoderBytes(&raw, &codec.MsgpackHandle{}).Encode(&rpt); err != nil {
+		b.Fatal(err)
+	}
+	for _, encoding := range report.Encodings {
+		b.Run(encoding, func(b *testing.B) {
+			var buf bytes.Buffer
+			b.SetBytes(int64(len(raw)))
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				w, err := report.NewCompressor(&buf, encoding)
+				if err != nil {
+					b.Fatal(err)
+				}
+				w.Write(raw)
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.Logf("%d bytes from %d", buf.Len(), len(raw))
+		})
+	}
+}
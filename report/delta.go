@@ -0,0 +1,169 @@
+package report
+
+import (
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Delta is the difference between two reports of a probe. Nodes which were
+// added or changed come whole, but nodes whose metrics alone changed only
+// come with those, and nodes which went away only by ID. Everything else
+// about the topologies, and the report, comes whole.
+//
+// Changes to the timestamps of latest values don't count, so a report with
+// a delta applied has the timestamps of when the values last changed.
+type Delta struct {
+	Report  Report
+	Metrics map[string]map[string]Metrics // by topology, then node ID
+	Removed map[string][]string           // node IDs, by topology
+}
+
+// MakeDelta returns the delta which takes previous to next.
+func MakeDelta(previous, next Report) Delta {
+	d := Delta{
+		Report:  next,
+		Metrics: map[string]map[string]Metrics{},
+		Removed: map[string][]string{},
+	}
+	// Don't let the walk write to the plugin topologies of next
+	if next.PluginTopologies != nil {
+		d.Report.PluginTopologies = make(map[string]Topology, len(next.PluginTopologies))
+		for name, topology := range next.PluginTopologies {
+			d.Report.PluginTopologies[name] = topology
+		}
+	}
+	d.Report.WalkNamedTopologies(func(name string, t *Topology) {
+		nodes := t.Nodes
+		t.Nodes = Nodes{}
+		before, _ := previous.Topology(name)
+		for id, node := range nodes {
+			old, ok := before.Nodes[id]
+			switch {
+			case !ok || nodeChanged(old, node):
+				t.Nodes[id] = node
+			case !reflect.DeepEqual(old.Metrics, node.Metrics):
+				if d.Metrics[name] == nil {
+					d.Metrics[name] = map[string]Metrics{}
+				}
+				d.Metrics[name][id] = node.Metrics
+			}
+		}
+		for id := range before.Nodes {
+			if _, ok := nodes[id]; !ok {
+				d.Removed[name] = append(d.Removed[name], id)
+			}
+		}
+	})
+	return d
+}
+
+// Apply returns the report the delta takes previous to. previous is not
+// modified.
+func (d Delta) Apply(previous Report) Report {
+	result := d.Report.Copy()
+	result.Shortcut = d.Report.Shortcut
+	result.WalkNamedTopologies(func(name string, t *Topology) {
+		before, ok := previous.Topology(name)
+		if !ok {
+			return
+		}
+		removed := MakeIDList(d.Removed[name]...)
+		metrics := d.Metrics[name]
+		for id, node := range before.Nodes {
+			if _, ok := t.Nodes[id]; ok || removed.Contains(id) {
+				continue
+			}
+			if m, ok := metrics[id]; ok {
+				node.Metrics = m
+			}
+			t.Nodes[id] = node
+		}
+	})
+	return result
+}
+
+// nodeChanged tells whether anything but the metrics, and the timestamps
+// of the latest values, differs between two versions of a node.
+func nodeChanged(a, b Node) bool {
+	return a.Topology != b.Topology ||
+		!a.Counters.DeepEqual(b.Counters) ||
+		!a.Sets.DeepEqual(b.Sets) ||
+		!stringsEqual(a.Adjacency, b.Adjacency) ||
+		!stringsEqual(a.Controls.Controls, b.Controls.Controls) ||
+		!latestControlValuesEqual(a.LatestControls, b.LatestControls) ||
+		!latestValuesEqual(a.Latest, b.Latest) ||
+		!a.Parents.DeepEqual(b.Parents) ||
+		!a.Children.DeepEqual(b.Children)
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func latestValuesEqual(a, b StringLatestMap) bool {
+	if a.Size() != b.Size() {
+		return false
+	}
+	equal := true
+	a.ForEach(func(key string, _ time.Time, value string) {
+		if other, ok := b.Lookup(key); !ok || other != value {
+			equal = false
+		}
+	})
+	return equal
+}
+
+func latestControlValuesEqual(a, b NodeControlDataLatestMap) bool {
+	if a.Size() != b.Size() {
+		return false
+	}
+	equal := true
+	a.ForEach(func(key string, _ time.Time, value NodeControlData) {
+		if other, ok := b.Lookup(key); !ok || other != value {
+			equal = false
+		}
+	})
+	return equal
+}
+
+// WriteEncoded writes a Delta as msgpack, compressed with the named
+// encoding.
+func (d Delta) WriteEncoded(w io.Writer, encoding string) error {
+	cw, err := NewCompressor(w, encoding)
+	if err != nil {
+		return err
+	}
+	if err = codec.NewEncoder(cw, &codec.MsgpackHandle{}).Encode(&d); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// MakeDeltaFromBytes constructs a Delta from msgpack, compressed with the
+// named encoding, migrating its report from the version it was made at. It
+// refuses deltas decompressing to more than maxSize bytes, unless that's 0.
+func MakeDeltaFromBytes(buf []byte, encoding string, maxSize int) (*Delta, error) {
+	buf, err := decompress(buf, encoding, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	d := Delta{}
+	if err := codec.NewDecoderBytes(buf, &codec.MsgpackHandle{}).Decode(&d); err != nil {
+		return nil, err
+	}
+	if d.Report, err = d.Report.migrate(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,79 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestDelta(t *testing.T) {
+	var (
+		t1 = time.Unix(1500000000, 0).UTC()
+		t2 = t1.Add(3 * time.Second)
+	)
+
+	previous := report.MakeReport()
+	previous.Container.AddNode(report.MakeNode("unchanged").WithLatest("name", t1, "a"))
+	previous.Container.AddNode(report.MakeNode("changed").WithLatest("state", t1, "running"))
+	previous.Container.AddNode(report.MakeNode("metrics").WithMetrics(report.Metrics{
+		"cpu": report.MakeSingletonMetric(t1, 1),
+	}))
+	previous.Container.AddNode(report.MakeNode("removed"))
+	previous.Endpoint.AddNode(report.MakeNode("edge").WithAdjacent("a"))
+
+	next := report.MakeReport()
+	next.Container.AddNode(report.MakeNode("unchanged").WithLatest("name", t2, "a"))
+	next.Container.AddNode(report.MakeNode("changed").WithLatest("state", t2, "stopped"))
+	next.Container.AddNode(report.MakeNode("metrics").WithMetrics(report.Metrics{
+		"cpu": report.MakeSingletonMetric(t2, 2),
+	}))
+	next.Container.AddNode(report.MakeNode("added"))
+	next.Endpoint.AddNode(report.MakeNode("edge").WithAdjacent("b"))
+
+	delta := report.MakeDelta(previous, next)
+	if have, want := len(delta.Report.Container.Nodes), 2; have != want {
+		t.Errorf("Expected %d whole containers in the delta, got %d", want, have)
+	}
+	if _, ok := delta.Report.Container.Nodes["unchanged"]; ok {
+		t.Errorf("Expected a change of timestamps alone not to count")
+	}
+	if _, ok := delta.Metrics[report.Container]["metrics"]; !ok {
+		t.Errorf("Expected the metrics of nodes whose metrics alone changed")
+	}
+	if _, ok := delta.Report.Endpoint.Nodes["edge"]; !ok {
+		t.Errorf("Expected a change of edges to count")
+	}
+	if want := []string{"removed"}; !reflect.DeepEqual(want, delta.Removed[report.Container]) {
+		t.Errorf("Expected %v removed, got %v", want, delta.Removed[report.Container])
+	}
+
+	have := delta.Apply(previous)
+	want := next.Copy()
+	want.Container.Nodes["unchanged"] = previous.Container.Nodes["unchanged"]
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// Deltas survive the wire
+	var buf bytes.Buffer
+	if err := delta.WriteEncoded(&buf, report.SnappyEncoding); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := report.MakeDeltaFromBytes(buf.Bytes(), report.SnappyEncoding, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := decoded.Apply(previous)
+	for _, id := range []string{"unchanged", "changed", "metrics", "added"} {
+		if _, ok := applied.Container.Nodes[id]; !ok {
+			t.Errorf("Expected container %q after applying the decoded delta", id)
+		}
+	}
+	if len(applied.Container.Nodes) != 4 {
+		t.Errorf("Expected 4 containers after applying the decoded delta, got %v", applied.Container.Nodes)
+	}
+}
@@ -0,0 +1,277 @@
+package report
+
+import (
+	"sort"
+	"time"
+)
+
+// Histogram is a distribution of observations, as latencies, counted into
+// buckets as Prometheus does: Bounds are the ascending upper bounds of the
+// buckets, and Counts the observations in each, with one more for the
+// observations above the last bound. Sum is of all the observations.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+}
+
+// MakeHistogram makes an empty histogram with buckets of the bounds.
+func MakeHistogram(bounds ...float64) Histogram {
+	bounds = append([]float64{}, bounds...)
+	sort.Float64s(bounds)
+	return Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)}
+}
+
+// Observe returns a copy of the histogram with the value counted. The
+// zero Histogram has the one bucket, of all observations.
+func (h Histogram) Observe(value float64) Histogram {
+	counts := make([]uint64, len(h.Bounds)+1)
+	copy(counts, h.Counts)
+	counts[sort.SearchFloat64s(h.Bounds, value)]++
+	return Histogram{Bounds: h.Bounds, Counts: counts, Sum: h.Sum + value}
+}
+
+// Count returns how many observations the histogram counts.
+func (h Histogram) Count() uint64 {
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	return count
+}
+
+// Mean returns the mean of the observations, 0 for none.
+func (h Histogram) Mean() float64 {
+	if count := h.Count(); count > 0 {
+		return h.Sum / float64(count)
+	}
+	return 0
+}
+
+// Quantile estimates the q-quantile of the observations, interpolating
+// linearly within buckets, as Prometheus' histogram_quantile does. The
+// first bucket is taken to start from 0, and observations above the last
+// bound to be at it.
+func (h Histogram) Quantile(q float64) float64 {
+	count := h.Count()
+	if count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	rank := q * float64(count)
+	var seen float64
+	for i, c := range h.Counts {
+		if i == len(h.Bounds) {
+			break
+		}
+		if seen+float64(c) >= rank && c > 0 {
+			lower := 0.0
+			if i > 0 {
+				lower = h.Bounds[i-1]
+			}
+			return lower + (h.Bounds[i]-lower)*(rank-seen)/float64(c)
+		}
+		seen += float64(c)
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// Merge returns the histogram of the observations of both. Histograms of
+// different buckets are merged into buckets of all their bounds, each
+// bucket's count going to the bucket of the same upper bound.
+func (h *Histogram) Merge(other *Histogram) *Histogram {
+	switch {
+	case h == nil:
+		return other
+	case other == nil:
+		return h
+	}
+	bounds := h.Bounds
+	if !floatsEqual(h.Bounds, other.Bounds) {
+		bounds = append(append([]float64{}, h.Bounds...), other.Bounds...)
+		sort.Float64s(bounds)
+		bounds = uniqueFloats(bounds)
+	}
+	result := &Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1), Sum: h.Sum + other.Sum}
+	for _, in := range []*Histogram{h, other} {
+		for i, c := range in.Counts {
+			j := len(bounds)
+			if i < len(in.Bounds) {
+				j = sort.SearchFloat64s(bounds, in.Bounds[i])
+			}
+			result.Counts[j] += c
+		}
+	}
+	return result
+}
+
+// div returns a copy of the histogram of the observations divided by n.
+func (h *Histogram) div(n float64) *Histogram {
+	if h == nil {
+		return nil
+	}
+	bounds := make([]float64, len(h.Bounds))
+	for i, b := range h.Bounds {
+		bounds[i] = b / n
+	}
+	return &Histogram{Bounds: bounds, Counts: h.Counts, Sum: h.Sum / n}
+}
+
+// Summary is a distribution of observations known only by some of its
+// quantiles, as of Prometheus summaries, with the Count and Sum of the
+// observations.
+type Summary struct {
+	Quantiles []Quantile `json:"quantiles"`
+	Count     uint64     `json:"count"`
+	Sum       float64    `json:"sum"`
+}
+
+// Quantile is the Value of the Quantile (0 to 1) of a Summary.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// Mean returns the mean of the observations, 0 for none.
+func (s Summary) Mean() float64 {
+	if s.Count > 0 {
+		return s.Sum / float64(s.Count)
+	}
+	return 0
+}
+
+// Quantile returns the value of the q-quantile, if the summary has it.
+func (s Summary) Quantile(q float64) (float64, bool) {
+	for _, quantile := range s.Quantiles {
+		if quantile.Quantile == q {
+			return quantile.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Merge returns the summary of the observations of both. Quantiles can't
+// be merged exactly: those of both are estimated by their means, weighted
+// by the count of observations of each, and the others dropped.
+func (s *Summary) Merge(other *Summary) *Summary {
+	switch {
+	case s == nil:
+		return other
+	case other == nil:
+		return s
+	}
+	result := &Summary{Count: s.Count + other.Count, Sum: s.Sum + other.Sum}
+	for _, quantile := range s.Quantiles {
+		value, ok := other.Quantile(quantile.Quantile)
+		if !ok {
+			continue
+		}
+		if result.Count > 0 {
+			value = (quantile.Value*float64(s.Count) + value*float64(other.Count)) / float64(result.Count)
+		}
+		result.Quantiles = append(result.Quantiles, Quantile{Quantile: quantile.Quantile, Value: value})
+	}
+	return result
+}
+
+// div returns a copy of the summary of the observations divided by n.
+func (s *Summary) div(n float64) *Summary {
+	if s == nil {
+		return nil
+	}
+	result := &Summary{Quantiles: make([]Quantile, len(s.Quantiles)), Count: s.Count, Sum: s.Sum / n}
+	for i, quantile := range s.Quantiles {
+		result.Quantiles[i] = Quantile{Quantile: quantile.Quantile, Value: quantile.Value / n}
+	}
+	return result
+}
+
+// count returns how many observations the distribution of the metric
+// counts, 0 if it isn't of one.
+func (m Metric) count() uint64 {
+	switch {
+	case m.Histogram != nil:
+		return m.Histogram.Count()
+	case m.Summary != nil:
+		return m.Summary.Count
+	}
+	return 0
+}
+
+// latestDistribution returns the distribution of whichever of the metrics
+// was sampled last. Distributions are cumulative, as of the Prometheus
+// metrics they come from, so the latest holds all the observations there
+// are, and merging a metric with itself, or with an earlier copy of
+// itself, doesn't count observations twice.
+func (m Metric) latestDistribution(other Metric) (*Histogram, *Summary) {
+	switch {
+	case other.Histogram == nil && other.Summary == nil:
+		return m.Histogram, m.Summary
+	case m.Histogram == nil && m.Summary == nil,
+		other.Last.After(m.Last),
+		other.Last.Equal(m.Last) && other.count() > m.count():
+		return other.Histogram, other.Summary
+	}
+	return m.Histogram, m.Summary
+}
+
+// MakeHistogramMetric makes a metric of the histogram, with its mean as
+// the sample at t.
+func MakeHistogramMetric(t time.Time, h Histogram) Metric {
+	m := MakeSingletonMetric(t, h.Mean())
+	m.Histogram = &h
+	return m
+}
+
+// MakeSummaryMetric makes a metric of the summary, with its mean as the
+// sample at t.
+func MakeSummaryMetric(t time.Time, s Summary) Metric {
+	m := MakeSingletonMetric(t, s.Mean())
+	m.Summary = &s
+	return m
+}
+
+// Quantile returns the q-quantile of the distribution of the metric, if it
+// is of one, and it is known.
+func (m Metric) Quantile(q float64) (float64, bool) {
+	switch {
+	case m.Histogram != nil:
+		return m.Histogram.Quantile(q), true
+	case m.Summary != nil:
+		return m.Summary.Quantile(q)
+	}
+	return 0, false
+}
+
+// quantiles returns those of the qs of the distribution of the metric
+// which are known.
+func (m *Metric) quantiles(qs []float64) []Quantile {
+	var result []Quantile
+	for _, q := range qs {
+		if value, ok := m.Quantile(q); ok {
+			result = append(result, Quantile{Quantile: q, Value: value})
+		}
+	}
+	return result
+}
+
+func floatsEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueFloats(sorted []float64) []float64 {
+	result := sorted[:0]
+	for i, f := range sorted {
+		if i == 0 || f != sorted[i-1] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
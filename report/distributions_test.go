@@ -0,0 +1,114 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestHistogram(t *testing.T) {
+	h := report.MakeHistogram(0.1, 0.01, 1)
+	for _, v := range []float64{0.005, 0.02, 0.05, 0.08, 0.5, 2} {
+		h = h.Observe(v)
+	}
+	if want := []uint64{1, 3, 1, 1}; !reflect.DeepEqual(want, h.Counts) {
+		t.Errorf("Expected counts %v, got %v", want, h.Counts)
+	}
+	if have := h.Count(); have != 6 {
+		t.Errorf("Expected 6 observations, got %d", have)
+	}
+	for q, want := range map[float64]float64{0: 0, 0.5: 0.07, 0.75: 0.55, 1: 1} {
+		if have := h.Quantile(q); have < want-1e-9 || have > want+1e-9 {
+			t.Errorf("Expected %v-quantile %v, got %v", q, want, have)
+		}
+	}
+
+	// Same buckets add up, others go in buckets of both bounds
+	same := h.Merge(&h)
+	if want := []uint64{2, 6, 2, 2}; !reflect.DeepEqual(want, same.Counts) || same.Sum != 2*h.Sum {
+		t.Errorf("Expected counts %v, got %v", want, same.Counts)
+	}
+	other := report.MakeHistogram(0.1, 0.5).Observe(0.3).Observe(5)
+	merged := h.Merge(&other)
+	if want := []float64{0.01, 0.1, 0.5, 1}; !reflect.DeepEqual(want, merged.Bounds) {
+		t.Errorf("Expected bounds %v, got %v", want, merged.Bounds)
+	}
+	if want := []uint64{1, 3, 1, 1, 2}; !reflect.DeepEqual(want, merged.Counts) {
+		t.Errorf("Expected counts %v, got %v", want, merged.Counts)
+	}
+}
+
+func TestSummaryMerge(t *testing.T) {
+	a := &report.Summary{Quantiles: []report.Quantile{{Quantile: 0.5, Value: 1}, {Quantile: 0.99, Value: 10}}, Count: 1, Sum: 1}
+	b := &report.Summary{Quantiles: []report.Quantile{{Quantile: 0.5, Value: 4}}, Count: 3, Sum: 12}
+	want := &report.Summary{Quantiles: []report.Quantile{{Quantile: 0.5, Value: 3.25}}, Count: 4, Sum: 13}
+	if have := a.Merge(b); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
+
+func TestDistributionMetrics(t *testing.T) {
+	t1, t2 := time.Unix(1500000000, 0).UTC(), time.Unix(1500000015, 0).UTC()
+	m1 := report.MakeHistogramMetric(t1, report.MakeHistogram(1, 2).Observe(0.5))
+	m2 := report.MakeHistogramMetric(t2, report.MakeHistogram(1, 2).Observe(1.5))
+	merged := m1.Merge(m2)
+	if merged.Len() != 2 || !reflect.DeepEqual(m2.Histogram, merged.Histogram) {
+		t.Errorf("Expected both samples, and the latest observations, got %v", merged)
+	}
+	if have := m2.Merge(m1); !reflect.DeepEqual(merged, have) {
+		t.Errorf("Expected merges either way round to be the same, got %v", have)
+	}
+	if have := merged.Merge(merged).Merge(m1); !reflect.DeepEqual(merged, have) {
+		t.Errorf("Expected merges to be repeatable, got %v", have)
+	}
+	if have, ok := merged.Quantile(0.5); !ok || have != 1.5 {
+		t.Errorf("Expected median 1.5, got %v", have)
+	}
+	if have := (report.Histogram{}).Observe(3).Observe(4); have.Count() != 2 || have.Sum != 7 {
+		t.Errorf("Expected the zero histogram to count observations, got %v", have)
+	}
+	if have := merged.Div(2).Histogram.Bounds; !reflect.DeepEqual([]float64{0.5, 1}, have) {
+		t.Errorf("Expected bounds halved, got %v", have)
+	}
+	if _, ok := report.MakeSingletonMetric(t1, 1).Quantile(0.5); ok {
+		t.Error("Expected no quantiles of gauges")
+	}
+
+	summary := report.MakeSummaryMetric(t1, report.Summary{Quantiles: []report.Quantile{{Quantile: 0.99, Value: 3}}, Count: 2, Sum: 4})
+	for _, want := range []report.Metric{merged, summary} {
+		for _, h := range []codec.Handle{&codec.MsgpackHandle{}, &codec.JsonHandle{}} {
+			buf := &bytes.Buffer{}
+			if err := codec.NewEncoder(buf, h).Encode(want); err != nil {
+				t.Fatal(err)
+			}
+			var have report.Metric
+			if err := codec.NewDecoder(buf, h).Decode(&have); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(want, have) {
+				t.Error(test.Diff(want, have))
+			}
+		}
+	}
+
+	// Rows carry the quantiles
+	buf := &bytes.Buffer{}
+	if err := codec.NewEncoder(buf, &codec.JsonHandle{}).Encode(report.MetricRow{ID: "latency", Metric: &summary}); err != nil {
+		t.Fatal(err)
+	}
+	var row struct {
+		Quantiles []report.Quantile `json:"quantiles"`
+	}
+	if err := codec.NewDecoder(buf, &codec.JsonHandle{}).Decode(&row); err != nil {
+		t.Fatal(err)
+	}
+	if want := []report.Quantile{{Quantile: 0.99, Value: 3}}; !reflect.DeepEqual(want, row.Quantiles) {
+		t.Errorf("Expected %v, got %v", want, row.Quantiles)
+	}
+}
@@ -0,0 +1,63 @@
+package report
+
+// What is kept of endpoints in downsampled reports: what rendering joins
+// them to processes and hosts by, counts connections by, and names pseudo
+// nodes with.
+var (
+	downsampledEndpointLatest = []string{PID, HostNodeID, CopyOf, SampleWeight}
+	downsampledEndpointSets   = []string{ReverseDNSNames, SnoopedDNSNames}
+)
+
+// Downsample returns the report without the detail which isn't worth
+// keeping of reports from long ago. Metrics are cut to their last sample,
+// keeping their min and max. Endpoints which aren't part of a connection
+// are dropped, and the rest are cut to what joins them up, so the edges
+// between processes, containers and so on are kept.
+func (r Report) Downsample() Report {
+	cp := r.Copy()
+	cp.WalkTopologies(func(t *Topology) {
+		for id, n := range t.Nodes {
+			if len(n.Metrics) == 0 {
+				continue
+			}
+			metrics := make(Metrics, len(n.Metrics))
+			for key, metric := range n.Metrics {
+				if sample, ok := metric.LastSample(); ok {
+					metric.Samples = []Sample{sample}
+				}
+				metrics[key] = metric
+			}
+			n.Metrics = metrics
+			t.Nodes[id] = n
+		}
+	})
+
+	connected := map[string]bool{}
+	for id, n := range cp.Endpoint.Nodes {
+		for _, adjacent := range n.Adjacency {
+			connected[id] = true
+			connected[adjacent] = true
+		}
+	}
+	endpoints := make(Nodes, len(connected))
+	for id, n := range cp.Endpoint.Nodes {
+		if !connected[id] {
+			continue
+		}
+		endpoint := MakeNode(id).WithTopology(n.Topology)
+		endpoint.Adjacency = n.Adjacency
+		for _, key := range downsampledEndpointLatest {
+			if value, timestamp, ok := n.Latest.LookupEntry(key); ok {
+				endpoint.Latest = endpoint.Latest.Set(key, timestamp, value)
+			}
+		}
+		for _, key := range downsampledEndpointSets {
+			if values, ok := n.Sets.Lookup(key); ok {
+				endpoint.Sets = endpoint.Sets.Add(key, values)
+			}
+		}
+		endpoints[id] = endpoint
+	}
+	cp.Endpoint.Nodes = endpoints
+	return cp
+}
@@ -0,0 +1,44 @@
+package report_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestDownsample(t *testing.T) {
+	t1 := time.Unix(1500000000, 0).UTC()
+	rpt := report.MakeReport()
+	rpt.Endpoint.AddNode(report.MakeNode("client").
+		WithLatests(map[string]string{report.PID: "1", "conntracked": "true"}).
+		WithAdjacent("server"))
+	rpt.Endpoint.AddNode(report.MakeNode("server").
+		WithSets(report.MakeSets().Add(report.ReverseDNSNames, report.MakeStringSet("server.local"))))
+	rpt.Endpoint.AddNode(report.MakeNode("listening"))
+	rpt.Host.AddNode(report.MakeNode("host").WithMetrics(report.Metrics{
+		"load": report.MakeMetric([]report.Sample{{Timestamp: t1, Value: 3}, {Timestamp: t1.Add(time.Second), Value: 1}}),
+	}))
+
+	have := rpt.Downsample()
+	if _, ok := have.Endpoint.Nodes["listening"]; ok || len(have.Endpoint.Nodes) != 2 {
+		t.Errorf("Expected only connected endpoints, got %v", have.Endpoint.Nodes)
+	}
+	client := have.Endpoint.Nodes["client"]
+	if _, ok := client.Latest.Lookup("conntracked"); ok || !client.Adjacency.Contains("server") {
+		t.Errorf("Expected the client endpoint cut to its PID and adjacency, got %v", client)
+	}
+	if pid, _ := client.Latest.Lookup(report.PID); pid != "1" {
+		t.Errorf("Expected the client endpoint to keep its PID, got %v", client)
+	}
+	if _, ok := have.Endpoint.Nodes["server"].Sets.Lookup(report.ReverseDNSNames); !ok {
+		t.Errorf("Expected the server endpoint to keep its DNS names")
+	}
+	load := have.Host.Nodes["host"].Metrics["load"]
+	if load.Len() != 1 || load.Min != 1 || load.Max != 3 {
+		t.Errorf("Expected the last sample, and the min and max, of the metric, got %v", load)
+	}
+	if rpt.Host.Nodes["host"].Metrics["load"].Len() != 2 {
+		t.Errorf("Expected the report not to be modified")
+	}
+}
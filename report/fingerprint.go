@@ -0,0 +1,144 @@
+package report
+
+import (
+	"math"
+	"time"
+)
+
+// Fingerprints are 64-bit FNV-1a hashes of the content of nodes, so that
+// renderers can tell whether what they are given changed since they last
+// rendered it without comparing it. Maps are hashed entry by entry, and the
+// entries combined by addition, so their order doesn't matter.
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+type fingerprint uint64
+
+func newFingerprint() fingerprint {
+	return fnvOffset64
+}
+
+func (f fingerprint) string(s string) fingerprint {
+	for i := 0; i < len(s); i++ {
+		f ^= fingerprint(s[i])
+		f *= fnvPrime64
+	}
+	// Terminate, so ("ab", "c") and ("a", "bc") differ
+	f ^= 0xff
+	f *= fnvPrime64
+	return f
+}
+
+func (f fingerprint) uint64(v uint64) fingerprint {
+	for i := uint(0); i < 64; i += 8 {
+		f ^= fingerprint(byte(v >> i))
+		f *= fnvPrime64
+	}
+	return f
+}
+
+func (f fingerprint) time(t time.Time) fingerprint {
+	return f.uint64(uint64(t.UnixNano()))
+}
+
+func (f fingerprint) float64(v float64) fingerprint {
+	return f.uint64(math.Float64bits(v))
+}
+
+func (f fingerprint) strings(ss []string) fingerprint {
+	f = f.uint64(uint64(len(ss)))
+	for _, s := range ss {
+		f = f.string(s)
+	}
+	return f
+}
+
+// Fingerprint returns a hash of everything in the node, its children
+// included. Nodes with the same content have the same fingerprint.
+func (n Node) Fingerprint() uint64 {
+	f := newFingerprint().string(n.ID).string(n.Topology)
+
+	var counters uint64
+	if n.Counters.psMap != nil {
+		n.Counters.psMap.ForEach(func(key string, val interface{}) {
+			counters += uint64(newFingerprint().string(key).uint64(uint64(val.(int))))
+		})
+	}
+	f = f.uint64(counters)
+	f = f.uint64(fingerprintSets(n.Sets))
+	f = f.strings(n.Adjacency)
+	f = f.time(n.Controls.Timestamp).strings(n.Controls.Controls)
+
+	n.LatestControls.ForEach(func(key string, ts time.Time, data NodeControlData) {
+		f = f.string(key).time(ts)
+		if data.Dead {
+			f = f.uint64(1)
+		} else {
+			f = f.uint64(0)
+		}
+	})
+	n.Latest.ForEach(func(key string, ts time.Time, val string) {
+		f = f.string(key).time(ts).string(val)
+	})
+
+	var metrics uint64
+	for key, metric := range n.Metrics {
+		m := newFingerprint().string(key).
+			float64(metric.Min).float64(metric.Max).
+			time(metric.First).time(metric.Last).
+			uint64(uint64(len(metric.Samples)))
+		for _, sample := range metric.Samples {
+			m = m.time(sample.Timestamp).float64(sample.Value)
+		}
+		if h := metric.Histogram; h != nil {
+			m = m.float64(h.Sum).uint64(uint64(len(h.Bounds)))
+			for _, b := range h.Bounds {
+				m = m.float64(b)
+			}
+			for _, c := range h.Counts {
+				m = m.uint64(c)
+			}
+		}
+		if s := metric.Summary; s != nil {
+			m = m.float64(s.Sum).uint64(s.Count)
+			for _, q := range s.Quantiles {
+				m = m.float64(q.Quantile).float64(q.Value)
+			}
+		}
+		if metric.Counter {
+			m = m.uint64(1).uint64(uint64(metric.Resets))
+		}
+		metrics += uint64(m)
+	}
+	f = f.uint64(metrics)
+	f = f.uint64(fingerprintSets(n.Parents))
+
+	var children uint64
+	n.Children.ForEach(func(child Node) {
+		children += child.Fingerprint()
+	})
+	return uint64(f.uint64(children))
+}
+
+func fingerprintSets(s Sets) uint64 {
+	var sum uint64
+	if s.psMap != nil {
+		s.psMap.ForEach(func(key string, val interface{}) {
+			sum += uint64(newFingerprint().string(key).strings(val.(StringSet)))
+		})
+	}
+	return sum
+}
+
+// Fingerprint returns a hash of all the nodes, such that the same nodes
+// have the same fingerprint whatever order they are in.
+func (n Nodes) Fingerprint() uint64 {
+	var sum uint64
+	for _, node := range n {
+		sum += node.Fingerprint()
+	}
+	return uint64(newFingerprint().uint64(uint64(len(n))).uint64(sum))
+}
@@ -0,0 +1,47 @@
+package report_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestNodeFingerprint(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+	node := report.MakeNodeWith("foo", map[string]string{"name": "foo"}).
+		WithSet("addrs", report.MakeStringSet("1.2.3.4")).
+		WithAdjacent("bar").
+		WithMetrics(report.Metrics{"cpu": report.MakeSingletonMetric(now, 0.5)}).
+		WithChild(report.MakeNode("baz"))
+
+	same := report.MakeNodeWith("foo", map[string]string{"name": "foo"}).
+		WithChild(report.MakeNode("baz")).
+		WithMetrics(report.Metrics{"cpu": report.MakeSingletonMetric(now, 0.5)}).
+		WithAdjacent("bar").
+		WithSet("addrs", report.MakeStringSet("1.2.3.4"))
+	if node.Fingerprint() != same.Fingerprint() {
+		t.Errorf("Expected the same node to have the same fingerprint")
+	}
+
+	for name, other := range map[string]report.Node{
+		"latest":    node.WithLatests(map[string]string{"name": "bar"}),
+		"sets":      node.WithSet("addrs", report.MakeStringSet("5.6.7.8")),
+		"adjacency": node.WithAdjacent("qux"),
+		"metrics":   node.WithMetrics(report.Metrics{"cpu": report.MakeSingletonMetric(now, 0.6)}),
+		"children":  node.WithChild(report.MakeNode("qux")),
+		"counters":  node.WithCounters(map[string]int{"pods": 1}),
+	} {
+		if node.Fingerprint() == other.Fingerprint() {
+			t.Errorf("Expected a node with other %s to have another fingerprint", name)
+		}
+	}
+
+	nodes := report.Nodes{"foo": node, "bar": report.MakeNode("bar")}
+	if nodes.Fingerprint() == (report.Nodes{"foo": node}).Fingerprint() {
+		t.Errorf("Expected other nodes to have another fingerprint")
+	}
+}
@@ -25,8 +25,29 @@ const (
 
 	// DockerOverlayPeerPrefix is the prefix for docker peers in the overlay network
 	DockerOverlayPeerPrefix = "docker_peer_"
+
+	// CalicoOverlayPeerPrefix is the prefix for calico nodes in the overlay network
+	CalicoOverlayPeerPrefix = "calico_peer_"
+
+	// CiliumOverlayPeerPrefix is the prefix for cilium agents in the overlay network
+	CiliumOverlayPeerPrefix = "cilium_peer_"
+
+	// FlannelOverlayPeerPrefix is the prefix for flannel daemons in the overlay network
+	FlannelOverlayPeerPrefix = "flannel_peer_"
+
+	// WireGuardOverlayPeerPrefix is the prefix for wireguard interfaces in the
+	// overlay network, which are named by their public key
+	WireGuardOverlayPeerPrefix = "wireguard_peer_"
 )
 
+// CNIOverlayPeerPrefixes are the prefixes of the peers of the CNI plugins
+// in the overlay network.
+var CNIOverlayPeerPrefixes = []string{
+	CalicoOverlayPeerPrefix,
+	CiliumOverlayPeerPrefix,
+	FlannelOverlayPeerPrefix,
+}
+
 // MakeEndpointNodeID produces an endpoint node ID from its composite parts.
 func MakeEndpointNodeID(hostID, namespaceID, address, port string) string {
 	return makeAddressID(hostID, namespaceID, address) + ScopeDelim + port
@@ -79,6 +100,16 @@ func MakeECSServiceNodeID(cluster, serviceName string) string {
 	return cluster + ScopeDelim + serviceName
 }
 
+// MakeNomadJobNodeID produces a Nomad Job node ID from its composite parts.
+func MakeNomadJobNodeID(namespace, jobID string) string {
+	return namespace + ScopeDelim + jobID
+}
+
+// MakeNomadTaskGroupNodeID produces a Nomad Task Group node ID from its composite parts.
+func MakeNomadTaskGroupNodeID(namespace, jobID, taskGroup string) string {
+	return namespace + ScopeDelim + jobID + ScopeDelim + taskGroup
+}
+
 var (
 	// MakeHostNodeID produces a host node ID from its composite parts.
 	MakeHostNodeID = makeSingleComponentID("host")
@@ -140,12 +171,36 @@ var (
 	// ParseCronJobNodeID parses a cronjob node ID
 	ParseCronJobNodeID = parseSingleComponentID("cronjob")
 
+	// MakeAutoscalerNodeID produces an autoscaler node ID from its composite parts.
+	MakeAutoscalerNodeID = makeSingleComponentID("autoscaler")
+
+	// ParseAutoscalerNodeID parses an autoscaler node ID
+	ParseAutoscalerNodeID = parseSingleComponentID("autoscaler")
+
 	// MakeNamespaceNodeID produces a namespace node ID from its composite parts.
 	MakeNamespaceNodeID = makeSingleComponentID("namespace")
 
 	// ParseNamespaceNodeID parses a namespace set node ID
 	ParseNamespaceNodeID = parseSingleComponentID("namespace")
 
+	// MakeNomadAllocationNodeID produces a Nomad Allocation node ID from its composite parts.
+	MakeNomadAllocationNodeID = makeSingleComponentID("nomad_allocation")
+
+	// ParseNomadAllocationNodeID parses a Nomad Allocation node ID
+	ParseNomadAllocationNodeID = parseSingleComponentID("nomad_allocation")
+
+	// MakeGPUNodeID produces a GPU node ID from its composite parts.
+	MakeGPUNodeID = makeSingleComponentID("gpu")
+
+	// ParseGPUNodeID parses a GPU node ID
+	ParseGPUNodeID = parseSingleComponentID("gpu")
+
+	// MakeScopeProbeNodeID produces a probe node ID from its composite parts.
+	MakeScopeProbeNodeID = makeSingleComponentID("scope_probe")
+
+	// ParseScopeProbeNodeID parses a probe node ID
+	ParseScopeProbeNodeID = parseSingleComponentID("scope_probe")
+
 	// MakeECSTaskNodeID produces a ECSTask node ID from its composite parts.
 	MakeECSTaskNodeID = makeSingleComponentID("ecs_task")
 
@@ -197,6 +252,16 @@ func ParseOverlayNodeID(id string) (overlayPrefix string, peerName string) {
 		return DockerOverlayPeerPrefix, id[len(DockerOverlayPeerPrefix):]
 	}
 
+	if strings.HasPrefix(id, WireGuardOverlayPeerPrefix) {
+		return WireGuardOverlayPeerPrefix, id[len(WireGuardOverlayPeerPrefix):]
+	}
+
+	for _, prefix := range CNIOverlayPeerPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return prefix, id[len(prefix):]
+		}
+	}
+
 	return WeaveOverlayPeerPrefix, id
 }
 
@@ -0,0 +1,83 @@
+package report
+
+import (
+	"sync"
+)
+
+// maxInterned is how many strings are interned before the interned are
+// forgotten, so strings of nodes long gone aren't kept forever. Strings
+// already interned stay shared by the reports holding them.
+const maxInterned = 1 << 20
+
+// interner keeps one copy of equal strings, so reports decoded apart don't
+// each hold their own copies of the node IDs, metadata keys and values,
+// such as image names, they repeat.
+type interner struct {
+	mtx     sync.Mutex
+	strings map[string]string
+}
+
+var decodeInterner = &interner{strings: map[string]string{}}
+
+func (in *interner) intern(s string) string {
+	if s == "" {
+		return s
+	}
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+	if interned, ok := in.strings[s]; ok {
+		return interned
+	}
+	if len(in.strings) >= maxInterned {
+		in.strings = map[string]string{}
+	}
+	in.strings[s] = s
+	return s
+}
+
+func (in *interner) internAll(ss []string) {
+	for i, s := range ss {
+		ss[i] = in.intern(s)
+	}
+}
+
+// intern interns the strings of the report, which must have just been
+// decoded, in place. Merging reports shares the strings of the nodes
+// merged, so reports merged from interned reports are interned too.
+func (r *Report) intern(in *interner) {
+	r.WalkTopologies(func(t *Topology) {
+		nodes := make(Nodes, len(t.Nodes))
+		for id, n := range t.Nodes {
+			nodes[in.intern(id)] = n.intern(in)
+		}
+		t.Nodes = nodes
+	})
+}
+
+func (n Node) intern(in *interner) Node {
+	n.ID = in.intern(n.ID)
+	n.Topology = in.intern(n.Topology)
+	in.internAll(n.Adjacency)
+	for i, e := range n.Latest {
+		n.Latest[i].key, n.Latest[i].Value = in.intern(e.key), in.intern(e.Value)
+	}
+	for i, e := range n.LatestControls {
+		n.LatestControls[i].key = in.intern(e.key)
+	}
+	n.Sets = n.Sets.intern(in)
+	n.Parents = n.Parents.intern(in)
+	return n
+}
+
+func (s Sets) intern(in *interner) Sets {
+	if s.Size() == 0 {
+		return s
+	}
+	result := MakeSets()
+	s.psMap.ForEach(func(key string, value interface{}) {
+		set := value.(StringSet)
+		in.internAll(set)
+		result = result.Add(in.intern(key), set)
+	})
+	return result
+}
@@ -0,0 +1,63 @@
+package report
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// sameString checks a and b are the same copy of a string
+func sameString(a, b string) bool {
+	return (*reflect.StringHeader)(unsafe.Pointer(&a)).Data == (*reflect.StringHeader)(unsafe.Pointer(&b)).Data && a == b
+}
+
+func TestReportIntern(t *testing.T) {
+	// Strings built apart, as decoding does
+	image := func() string { return strings.Repeat("weaveworks/scope", 1) + ":latest" }
+	t1 := time.Unix(1500000000, 0).UTC()
+	rpt := MakeReport()
+	rpt.Container.AddNode(MakeNode("a").WithLatest("image", t1, image()))
+	rpt.Container.AddNode(MakeNode("b").WithLatest("image", t1, image()))
+
+	rpt.intern(&interner{strings: map[string]string{}})
+	a, _ := rpt.Container.Nodes["a"].Latest.Lookup("image")
+	b, _ := rpt.Container.Nodes["b"].Latest.Lookup("image")
+	if a != image() || !sameString(a, b) {
+		t.Errorf("Expected the images to be interned: %q, %q", a, b)
+	}
+}
+
+func TestProtobufDictionary(t *testing.T) {
+	t1 := time.Unix(1500000000, 0).UTC()
+	rpt := MakeReport()
+	for _, id := range []string{"a", "b", "c"} {
+		rpt.Container.AddNode(MakeNode(id).WithTopology(Container).
+			WithLatest("docker_image_name", t1, "weaveworks/scope").
+			WithLatest("name", t1, id))
+	}
+
+	msg := rpt.toProto()
+	msg.compress()
+	if want := []string{"docker_image_name", "weaveworks/scope", "name"}; len(msg.Strings) != len(want) {
+		t.Errorf("Expected dictionary of %v, got %v", want, msg.Strings)
+	}
+	if err := msg.expand(); err != nil {
+		t.Fatal(err)
+	}
+	have := msg.toReport()
+	for _, id := range []string{"a", "b", "c"} {
+		if image, _ := have.Container.Nodes[id].Latest.Lookup("docker_image_name"); image != "weaveworks/scope" {
+			t.Errorf("Expected image of %s, got %q", id, image)
+		}
+		if name, _ := have.Container.Nodes[id].Latest.Lookup("name"); name != id {
+			t.Errorf("Expected name %s, got %q", id, name)
+		}
+	}
+
+	msg.Topologies[0].Nodes = []*protoNode{{ID: "a", Latest: []*protoLatest{{KeyRef: 5}}}}
+	if err := msg.expand(); err == nil {
+		t.Error("Expected an error for a reference out of the dictionary")
+	}
+}
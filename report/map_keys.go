@@ -6,6 +6,11 @@ const (
 	ReverseDNSNames = "reverse_dns_names"
 	SnoopedDNSNames = "snooped_dns_names"
 	CopyOf          = "copy_of"
+	SampleWeight    = "sample_weight"
+	// app/awselb
+	LoadBalancerName     = "load_balancer_name"
+	LoadBalancerListener = "load_balancer_listener"
+	LoadBalancerHostname = "load_balancer_hostname"
 	// probe/process
 	PID     = "pid"
 	Name    = "name" // also used by probe/docker
@@ -21,6 +26,12 @@ const (
 	DockerIsInHostNetwork        = "docker_is_in_host_network"
 	DockerServiceName            = "service_name"
 	DockerStackNamespace         = "stack_namespace"
+	DockerServiceMode            = "docker_service_mode"
+	DockerServiceImage           = "docker_service_image"
+	DockerServiceDesiredReplicas = "docker_service_desired_replicas"
+	DockerServiceRunningReplicas = "docker_service_running_replicas"
+	DockerServiceScaleUp         = "docker_service_scale_up"
+	DockerServiceScaleDown       = "docker_service_scale_down"
 	DockerStopContainer          = "docker_stop_container"
 	DockerStartContainer         = "docker_start_container"
 	DockerRestartContainer       = "docker_restart_container"
@@ -29,6 +40,7 @@ const (
 	DockerRemoveContainer        = "docker_remove_container"
 	DockerAttachContainer        = "docker_attach_container"
 	DockerExecContainer          = "docker_exec_container"
+	DockerPullImage              = "docker_pull_image"
 	DockerContainerName          = "docker_container_name"
 	DockerContainerCommand       = "docker_container_command"
 	DockerContainerPorts         = "docker_container_ports"
@@ -42,6 +54,7 @@ const (
 	DockerContainerUptime        = "docker_container_uptime"
 	DockerContainerRestartCount  = "docker_container_restart_count"
 	DockerContainerNetworkMode   = "docker_container_network_mode"
+	DockerContainerExitCode      = "docker_container_exit_code"
 	// probe/kubernetes
 	KubernetesName                 = "kubernetes_name"
 	KubernetesNamespace            = "kubernetes_namespace"
@@ -55,6 +68,9 @@ const (
 	KubernetesDeletePod            = "kubernetes_delete_pod"
 	KubernetesScaleUp              = "kubernetes_scale_up"
 	KubernetesScaleDown            = "kubernetes_scale_down"
+	KubernetesCordonNode           = "kubernetes_cordon_node"
+	KubernetesUncordonNode         = "kubernetes_uncordon_node"
+	KubernetesDrainNode            = "kubernetes_drain_node"
 	KubernetesUpdatedReplicas      = "kubernetes_updated_replicas"
 	KubernetesAvailableReplicas    = "kubernetes_available_replicas"
 	KubernetesUnavailableReplicas  = "kubernetes_unavailable_replicas"
@@ -69,6 +85,27 @@ const (
 	KubernetesSuspended            = "kubernetes_suspended"
 	KubernetesLastScheduled        = "kubernetes_last_scheduled"
 	KubernetesActiveJobs           = "kubernetes_active_jobs"
+	KubernetesScaleTarget          = "kubernetes_scale_target"
+	KubernetesHPAMinReplicas       = "kubernetes_hpa_min_replicas"
+	KubernetesHPAMaxReplicas       = "kubernetes_hpa_max_replicas"
+	KubernetesHPACurrentReplicas   = "kubernetes_hpa_current_replicas"
+	KubernetesHPADesiredReplicas   = "kubernetes_hpa_desired_replicas"
+	KubernetesHPATargetMetrics     = "kubernetes_hpa_target_metrics"
+	KubernetesHPACurrentMetrics    = "kubernetes_hpa_current_metrics"
+	KubernetesHPALastScaleTime     = "kubernetes_hpa_last_scale_time"
+	KubernetesVPAUpdateMode        = "kubernetes_vpa_update_mode"
+	KubernetesVPARecommendation    = "kubernetes_vpa_recommendation"
+	KubernetesQuotaCPU             = "kubernetes_quota_cpu"
+	KubernetesQuotaMemory          = "kubernetes_quota_memory"
+	KubernetesQuotaWarning         = "kubernetes_quota_warning"
+	KubernetesLimitRanges          = "kubernetes_limit_ranges"
+	KubernetesSidecarProxy         = "kubernetes_sidecar_proxy"
+	KubernetesNodeConditions       = "kubernetes_node_conditions"
+	KubernetesNodeTaints           = "kubernetes_node_taints"
+	KubernetesNodeCordoned         = "kubernetes_node_cordoned"
+	KubernetesAffinity             = "kubernetes_affinity"
+	KubernetesTopologySpread       = "kubernetes_topology_spread"
+	KubernetesPlacementWarning     = "kubernetes_placement_warning"
 	KubernetesStateDeleted         = "deleted"
 	// probe/awsecs
 	ECSCluster             = "ecs_cluster"
@@ -76,8 +113,37 @@ const (
 	ECSTaskFamily          = "ecs_task_family"
 	ECSServiceDesiredCount = "ecs_service_desired_count"
 	ECSServiceRunningCount = "ecs_service_running_count"
+	ECSServicePendingCount = "ecs_service_pending_count"
+	ECSServiceDeployment   = "ecs_service_deployment"
+	ECSTaskKnownStatus     = "ecs_task_known_status"
+	ECSTaskDesiredStatus   = "ecs_task_desired_status"
 	ECSScaleUp             = "ecs_scale_up"
 	ECSScaleDown           = "ecs_scale_down"
+	// probe/nomad
+	NomadNamespace      = "nomad_namespace"
+	NomadJobID          = "nomad_job_id"
+	NomadJobType        = "nomad_job_type"
+	NomadJobStatus      = "nomad_job_status"
+	NomadDatacenters    = "nomad_datacenters"
+	NomadTaskGroupName  = "nomad_task_group_name"
+	NomadTaskGroupCount = "nomad_task_group_count"
+	NomadAllocationName = "nomad_allocation_name"
+	NomadClientStatus   = "nomad_client_status"
+	NomadDesiredStatus  = "nomad_desired_status"
+	NomadNodeName       = "nomad_node_name"
+	NomadCreatedAt      = "nomad_created_at"
+	// probe/gpu
+	GPUIndex         = "gpu_index"
+	GPUName          = "gpu_name"
+	GPUUUID          = "gpu_uuid"
+	GPUDriverVersion = "gpu_driver_version"
+	// probe
+	ScopeProbeVersion          = "scope_probe_version"
+	ScopeProbeHostname         = "scope_probe_hostname"
+	ScopeProbePublishErrors    = "scope_probe_publish_errors"
+	ScopeProbeLastPublishError = "scope_probe_last_publish_error"
+	ScopeProbeDroppedReports   = "scope_probe_dropped_reports"
+	ScopeProbeReporters        = "scope_probe_reporters"
 )
 
 /* Lookup table to allow msgpack/json decoder to avoid heap allocation
@@ -86,22 +152,28 @@ const (
    getting clogged with values that are only used once.
 */
 var commonKeys = map[string]string{
-	Endpoint:       Endpoint,
-	Process:        Process,
-	Container:      Container,
-	Pod:            Pod,
-	Service:        Service,
-	Deployment:     Deployment,
-	ReplicaSet:     ReplicaSet,
-	DaemonSet:      DaemonSet,
-	StatefulSet:    StatefulSet,
-	CronJob:        CronJob,
-	ContainerImage: ContainerImage,
-	Host:           Host,
-	Overlay:        Overlay,
-	ECSService:     ECSService,
-	ECSTask:        ECSTask,
-	SwarmService:   SwarmService,
+	Endpoint:        Endpoint,
+	Process:         Process,
+	Container:       Container,
+	Pod:             Pod,
+	Service:         Service,
+	Deployment:      Deployment,
+	ReplicaSet:      ReplicaSet,
+	DaemonSet:       DaemonSet,
+	StatefulSet:     StatefulSet,
+	CronJob:         CronJob,
+	Autoscaler:      Autoscaler,
+	ContainerImage:  ContainerImage,
+	Host:            Host,
+	Overlay:         Overlay,
+	ECSService:      ECSService,
+	ECSTask:         ECSTask,
+	SwarmService:    SwarmService,
+	NomadJob:        NomadJob,
+	NomadTaskGroup:  NomadTaskGroup,
+	NomadAllocation: NomadAllocation,
+	GPU:             GPU,
+	ScopeProbe:      ScopeProbe,
 
 	HostNodeID:             HostNodeID,
 	ControlProbeID:         ControlProbeID,
@@ -110,6 +182,11 @@ var commonKeys = map[string]string{
 	ReverseDNSNames: ReverseDNSNames,
 	SnoopedDNSNames: SnoopedDNSNames,
 	CopyOf:          CopyOf,
+	SampleWeight:    SampleWeight,
+
+	LoadBalancerName:     LoadBalancerName,
+	LoadBalancerListener: LoadBalancerListener,
+	LoadBalancerHostname: LoadBalancerHostname,
 
 	PID:     PID,
 	Name:    Name,
@@ -125,6 +202,12 @@ var commonKeys = map[string]string{
 	DockerIsInHostNetwork:        DockerIsInHostNetwork,
 	DockerServiceName:            DockerServiceName,
 	DockerStackNamespace:         DockerStackNamespace,
+	DockerServiceMode:            DockerServiceMode,
+	DockerServiceImage:           DockerServiceImage,
+	DockerServiceDesiredReplicas: DockerServiceDesiredReplicas,
+	DockerServiceRunningReplicas: DockerServiceRunningReplicas,
+	DockerServiceScaleUp:         DockerServiceScaleUp,
+	DockerServiceScaleDown:       DockerServiceScaleDown,
 	DockerStopContainer:          DockerStopContainer,
 	DockerStartContainer:         DockerStartContainer,
 	DockerRestartContainer:       DockerRestartContainer,
@@ -133,6 +216,7 @@ var commonKeys = map[string]string{
 	DockerRemoveContainer:        DockerRemoveContainer,
 	DockerAttachContainer:        DockerAttachContainer,
 	DockerExecContainer:          DockerExecContainer,
+	DockerPullImage:              DockerPullImage,
 	DockerContainerName:          DockerContainerName,
 	DockerContainerCommand:       DockerContainerCommand,
 	DockerContainerPorts:         DockerContainerPorts,
@@ -146,6 +230,7 @@ var commonKeys = map[string]string{
 	DockerContainerUptime:        DockerContainerUptime,
 	DockerContainerRestartCount:  DockerContainerRestartCount,
 	DockerContainerNetworkMode:   DockerContainerNetworkMode,
+	DockerContainerExitCode:      DockerContainerExitCode,
 
 	KubernetesName:                 KubernetesName,
 	KubernetesNamespace:            KubernetesNamespace,
@@ -159,6 +244,9 @@ var commonKeys = map[string]string{
 	KubernetesDeletePod:            KubernetesDeletePod,
 	KubernetesScaleUp:              KubernetesScaleUp,
 	KubernetesScaleDown:            KubernetesScaleDown,
+	KubernetesCordonNode:           KubernetesCordonNode,
+	KubernetesUncordonNode:         KubernetesUncordonNode,
+	KubernetesDrainNode:            KubernetesDrainNode,
 	KubernetesUpdatedReplicas:      KubernetesUpdatedReplicas,
 	KubernetesAvailableReplicas:    KubernetesAvailableReplicas,
 	KubernetesUnavailableReplicas:  KubernetesUnavailableReplicas,
@@ -173,14 +261,64 @@ var commonKeys = map[string]string{
 	KubernetesSuspended:            KubernetesSuspended,
 	KubernetesLastScheduled:        KubernetesLastScheduled,
 	KubernetesActiveJobs:           KubernetesActiveJobs,
+	KubernetesScaleTarget:          KubernetesScaleTarget,
+	KubernetesHPAMinReplicas:       KubernetesHPAMinReplicas,
+	KubernetesHPAMaxReplicas:       KubernetesHPAMaxReplicas,
+	KubernetesHPACurrentReplicas:   KubernetesHPACurrentReplicas,
+	KubernetesHPADesiredReplicas:   KubernetesHPADesiredReplicas,
+	KubernetesHPATargetMetrics:     KubernetesHPATargetMetrics,
+	KubernetesHPACurrentMetrics:    KubernetesHPACurrentMetrics,
+	KubernetesHPALastScaleTime:     KubernetesHPALastScaleTime,
+	KubernetesVPAUpdateMode:        KubernetesVPAUpdateMode,
+	KubernetesVPARecommendation:    KubernetesVPARecommendation,
+	KubernetesQuotaCPU:             KubernetesQuotaCPU,
+	KubernetesQuotaMemory:          KubernetesQuotaMemory,
+	KubernetesQuotaWarning:         KubernetesQuotaWarning,
+	KubernetesLimitRanges:          KubernetesLimitRanges,
+	KubernetesSidecarProxy:         KubernetesSidecarProxy,
+	KubernetesNodeConditions:       KubernetesNodeConditions,
+	KubernetesNodeTaints:           KubernetesNodeTaints,
+	KubernetesNodeCordoned:         KubernetesNodeCordoned,
+	KubernetesAffinity:             KubernetesAffinity,
+	KubernetesTopologySpread:       KubernetesTopologySpread,
+	KubernetesPlacementWarning:     KubernetesPlacementWarning,
 
 	ECSCluster:             ECSCluster,
 	ECSCreatedAt:           ECSCreatedAt,
 	ECSTaskFamily:          ECSTaskFamily,
 	ECSServiceDesiredCount: ECSServiceDesiredCount,
 	ECSServiceRunningCount: ECSServiceRunningCount,
+	ECSServicePendingCount: ECSServicePendingCount,
+	ECSServiceDeployment:   ECSServiceDeployment,
+	ECSTaskKnownStatus:     ECSTaskKnownStatus,
+	ECSTaskDesiredStatus:   ECSTaskDesiredStatus,
 	ECSScaleUp:             ECSScaleUp,
 	ECSScaleDown:           ECSScaleDown,
+
+	NomadNamespace:      NomadNamespace,
+	NomadJobID:          NomadJobID,
+	NomadJobType:        NomadJobType,
+	NomadJobStatus:      NomadJobStatus,
+	NomadDatacenters:    NomadDatacenters,
+	NomadTaskGroupName:  NomadTaskGroupName,
+	NomadTaskGroupCount: NomadTaskGroupCount,
+	NomadAllocationName: NomadAllocationName,
+	NomadClientStatus:   NomadClientStatus,
+	NomadDesiredStatus:  NomadDesiredStatus,
+	NomadNodeName:       NomadNodeName,
+	NomadCreatedAt:      NomadCreatedAt,
+
+	GPUIndex:         GPUIndex,
+	GPUName:          GPUName,
+	GPUUUID:          GPUUUID,
+	GPUDriverVersion: GPUDriverVersion,
+
+	ScopeProbeVersion:          ScopeProbeVersion,
+	ScopeProbeHostname:         ScopeProbeHostname,
+	ScopeProbePublishErrors:    ScopeProbePublishErrors,
+	ScopeProbeLastPublishError: ScopeProbeLastPublishError,
+	ScopeProbeDroppedReports:   ScopeProbeDroppedReports,
+	ScopeProbeReporters:        ScopeProbeReporters,
 }
 
 func lookupCommonKey(b []byte) string {
@@ -97,9 +97,21 @@ func MakeFromBinary(r io.Reader) (*Report, error) {
 	return &rep, nil
 }
 
-// ReadBytes reads bytes into a Report, using a codecHandle.
+// ReadBytes reads bytes into a Report, using a codecHandle, migrating it
+// from the version it was made at, and interning its strings.
 func (rep *Report) ReadBytes(buf []byte, codecHandle codec.Handle) error {
-	return codec.NewDecoderBytes(buf, codecHandle).Decode(&rep)
+	// Reports from before versioning don't say what version they are
+	rep.Version = 0
+	if err := codec.NewDecoderBytes(buf, codecHandle).Decode(&rep); err != nil {
+		return err
+	}
+	migrated, err := rep.migrate()
+	if err != nil {
+		return err
+	}
+	migrated.intern(decodeInterner)
+	*rep = migrated
+	return nil
 }
 
 // MakeFromBytes constructs a Report from a gzipped msgpack.
@@ -127,6 +139,68 @@ func MakeFromBytes(buf []byte) (*Report, error) {
 	return &rep, nil
 }
 
+// The content types reports may come in, besides ProtobufContentType.
+const (
+	MsgpackContentType = "application/msgpack"
+	JSONContentType    = "application/json"
+)
+
+// WriteEncoded writes a Report as msgpack or protobuf, as contentType says,
+// compressed with the named encoding.
+func (rep Report) WriteEncoded(w io.Writer, contentType, encoding string) error {
+	cw, err := NewCompressor(w, encoding)
+	if err != nil {
+		return err
+	}
+	switch contentType {
+	case MsgpackContentType:
+		err = codec.NewEncoder(cw, &codec.MsgpackHandle{}).Encode(&rep)
+	case ProtobufContentType:
+		var buf []byte
+		if buf, err = rep.marshalProtobuf(); err == nil {
+			_, err = cw.Write(buf)
+		}
+	default:
+		err = fmt.Errorf("unsupported content type: %q", contentType)
+	}
+	if err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// MakeFromEncodedBytes constructs a Report from msgpack, JSON or protobuf,
+// as contentType says, compressed with the named encoding, if any. It
+// refuses reports decompressing to more than maxSize bytes, unless that's 0.
+func MakeFromEncodedBytes(buf []byte, contentType, encoding string, maxSize int) (*Report, error) {
+	compressedSize := len(buf)
+	buf, err := decompress(buf, encoding, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf(
+		"Received report sizes: %s %d bytes, uncompressed %d bytes",
+		encoding,
+		compressedSize,
+		len(buf),
+	)
+	rep := MakeReport()
+	switch contentType {
+	case MsgpackContentType:
+		err = rep.ReadBytes(buf, &codec.MsgpackHandle{})
+	case JSONContentType:
+		err = rep.ReadBytes(buf, &codec.JsonHandle{})
+	case ProtobufContentType:
+		rep, err = makeFromProtobuf(buf)
+	default:
+		err = fmt.Errorf("unsupported content type: %q", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
 // MakeFromFile construct a Report from a file, with the encoding
 // determined by the extension (".msgpack" or ".json", with an
 // optional ".gz").
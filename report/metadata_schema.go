@@ -0,0 +1,137 @@
+package report
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of metadata values beside the datatypes, which have no datatype
+// of their own
+const (
+	String = "string"
+	Bool   = "bool"
+)
+
+// MetadataKeySchema describes the values of a metadata key: their Type,
+// one of String (the default), Bool, Number, Duration, DateTime or IP, the
+// Unit Numbers are in, if any, and hints on displaying them: the Format
+// of Numbers, as for metrics, and how long to Truncate them to.
+type MetadataKeySchema struct {
+	Type     string `json:"type,omitempty"`
+	Unit     string `json:"unit,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Truncate int    `json:"truncate,omitempty"`
+}
+
+// MetadataSchema describes metadata keys, so their values, all strings,
+// needn't be parsed by guesswork. Probes send the schema of the keys they
+// report with their reports.
+type MetadataSchema map[string]MetadataKeySchema
+
+var (
+	registeredSchemaMtx sync.RWMutex
+	registeredSchema    = MetadataSchema{}
+)
+
+// RegisterMetadataSchema registers the schema of some metadata keys, for
+// RegisteredMetadataSchema. Probes register the keys they report, as
+// they are initialised.
+func RegisterMetadataSchema(schema MetadataSchema) {
+	registeredSchemaMtx.Lock()
+	defer registeredSchemaMtx.Unlock()
+	for key, s := range schema {
+		registeredSchema[key] = s
+	}
+}
+
+// RegisteredMetadataSchema returns the schema of all the registered
+// metadata keys.
+func RegisteredMetadataSchema() MetadataSchema {
+	registeredSchemaMtx.RLock()
+	defer registeredSchemaMtx.RUnlock()
+	return registeredSchema.Copy()
+}
+
+// Copy returns a value copy of the schema
+func (s MetadataSchema) Copy() MetadataSchema {
+	if s == nil {
+		return nil
+	}
+	result := make(MetadataSchema, len(s))
+	for k, v := range s {
+		result[k] = v
+	}
+	return result
+}
+
+// Merge merges two schemas. Keys in both keep the description of the
+// receiver.
+func (s MetadataSchema) Merge(other MetadataSchema) MetadataSchema {
+	if len(other) == 0 {
+		return s
+	}
+	if len(s) == 0 {
+		return other
+	}
+	result := s.Copy()
+	for k, v := range other {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// Parse returns the value of the key as its type: a bool, float64,
+// time.Duration (from seconds), time.Time, net.IP, or the string itself
+// for Strings and keys without a schema.
+func (s MetadataSchema) Parse(key, value string) (interface{}, error) {
+	switch s[key].Type {
+	case Bool:
+		return strconv.ParseBool(value)
+	case Number:
+		return strconv.ParseFloat(value, 64)
+	case Duration:
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	case DateTime:
+		return time.Parse(time.RFC3339Nano, value)
+	case IP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP: %q", value)
+		}
+		return ip, nil
+	}
+	return value, nil
+}
+
+// MetadataRows returns the rows described by the schema of their keys:
+// typed, in units, and formatted as it says, where their templates
+// didn't say otherwise.
+func (s MetadataSchema) MetadataRows(rows []MetadataRow) []MetadataRow {
+	if len(s) == 0 {
+		return rows
+	}
+	for i, row := range rows {
+		schema, ok := s[row.ID]
+		if !ok {
+			continue
+		}
+		if row.Datatype == "" && schema.Type != String {
+			row.Datatype = schema.Type
+		}
+		if row.Truncate == 0 {
+			row.Truncate = schema.Truncate
+		}
+		row.Unit, row.Format = schema.Unit, schema.Format
+		rows[i] = row
+	}
+	return rows
+}
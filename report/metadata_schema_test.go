@@ -0,0 +1,67 @@
+package report_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestMetadataSchemaParse(t *testing.T) {
+	schema := report.MetadataSchema{
+		"up":      {Type: report.Duration, Unit: "s"},
+		"created": {Type: report.DateTime},
+		"ip":      {Type: report.IP},
+		"count":   {Type: report.Number},
+		"ready":   {Type: report.Bool},
+	}
+	created := time.Date(2017, 7, 3, 9, 45, 0, 329067309, time.UTC)
+	for key, c := range map[string]struct {
+		value string
+		want  interface{}
+	}{
+		"up":      {"90", 90 * time.Second},
+		"created": {"2017-07-03T09:45:00.329067309Z", created},
+		"ip":      {"10.0.0.1", net.ParseIP("10.0.0.1")},
+		"count":   {"2.5", 2.5},
+		"ready":   {"true", true},
+		"name":    {"a", "a"},
+	} {
+		have, err := schema.Parse(key, c.value)
+		if err != nil {
+			t.Errorf("%s: %v", key, err)
+		} else if !reflect.DeepEqual(c.want, have) {
+			t.Errorf("%s: expected %v, got %v", key, c.want, have)
+		}
+	}
+	if _, err := schema.Parse("ip", "nope"); err == nil {
+		t.Error("Expected an error parsing an invalid IP")
+	}
+}
+
+func TestMetadataSchemaRows(t *testing.T) {
+	a := report.MetadataSchema{"up": {Type: report.Duration, Unit: "s"}, "id": {Type: report.String, Truncate: 12}}
+	b := report.MetadataSchema{"up": {Type: report.Number}, "mem": {Type: report.Number, Format: report.FilesizeFormat}}
+	schema := a.Merge(b)
+	if want := (report.MetadataKeySchema{Type: report.Duration, Unit: "s"}); schema["up"] != want {
+		t.Errorf("Expected %v, got %v", want, schema["up"])
+	}
+
+	have := schema.MetadataRows([]report.MetadataRow{
+		{ID: "up", Value: "90"},
+		{ID: "id", Value: "0123456789abcdef"},
+		{ID: "mem", Value: "1024", Datatype: "size"},
+		{ID: "other", Value: "a"},
+	})
+	want := []report.MetadataRow{
+		{ID: "up", Value: "90", Datatype: report.Duration, Unit: "s"},
+		{ID: "id", Value: "0123456789abcdef", Truncate: 12},
+		{ID: "mem", Value: "1024", Datatype: "size", Format: report.FilesizeFormat},
+		{ID: "other", Value: "a"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
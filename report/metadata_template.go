@@ -83,6 +83,8 @@ type MetadataRow struct {
 	Priority float64 `json:"priority,omitempty"`
 	Datatype string  `json:"dataType,omitempty"`
 	Truncate int     `json:"truncate,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+	Format   string  `json:"format,omitempty"`
 }
 
 // MetadataTemplates is a mergeable set of metadata templates
@@ -64,8 +64,18 @@ type wiredMetricRow struct {
 	First      string   `json:"first,omitempty"`
 	Last       string   `json:"last,omitempty"`
 	URL        string   `json:"url"`
+
+	Histogram *Histogram `json:"histogram,omitempty"`
+	Summary   *Summary   `json:"summary,omitempty"`
+	// Quantiles are the RowQuantiles of metrics of distributions, where
+	// known, so the UI needn't estimate them.
+	Quantiles []Quantile `json:"quantiles,omitempty"`
 }
 
+// RowQuantiles are the quantiles of metrics of distributions sent with
+// their rows.
+var RowQuantiles = []float64{0.5, 0.9, 0.99}
+
 // CodecEncodeSelf marshals this MetricRow. It takes the basic Metric
 // rendering, then adds some row-specific fields.
 func (m *MetricRow) CodecEncodeSelf(encoder *codec.Encoder) {
@@ -84,6 +94,9 @@ func (m *MetricRow) CodecEncodeSelf(encoder *codec.Encoder) {
 		Max:        in.Max,
 		First:      in.First,
 		Last:       in.Last,
+		Histogram:  in.Histogram,
+		Summary:    in.Summary,
+		Quantiles:  m.Metric.quantiles(RowQuantiles),
 	})
 }
 
@@ -92,11 +105,13 @@ func (m *MetricRow) CodecDecodeSelf(decoder *codec.Decoder) {
 	var in wiredMetricRow
 	decoder.Decode(&in)
 	w := WireMetrics{
-		Samples: in.Samples,
-		Min:     in.Min,
-		Max:     in.Max,
-		First:   in.First,
-		Last:    in.Last,
+		Samples:   in.Samples,
+		Min:       in.Min,
+		Max:       in.Max,
+		First:     in.First,
+		Last:      in.Last,
+		Histogram: in.Histogram,
+		Summary:   in.Summary,
 	}
 	metric := w.FromIntermediate()
 	*m = MetricRow{
@@ -14,12 +14,16 @@ type MetricTemplate struct {
 	Priority float64 `json:"priority,omitempty"`
 }
 
-// MetricRow returns the row for a node
+// MetricRow returns the row for a node. Counter metrics are shown by their
+// rate.
 func (t MetricTemplate) MetricRow(n Node) (MetricRow, bool) {
 	metric, ok := n.Metrics.Lookup(t.ID)
 	if !ok {
 		return MetricRow{}, false
 	}
+	if metric.Counter {
+		metric = metric.Rate()
+	}
 	row := MetricRow{
 		ID:       t.ID,
 		Label:    t.Label,
@@ -17,8 +17,15 @@ func (m Metrics) Lookup(key string) (Metric, bool) {
 }
 
 // Merge merges two sets maps into a fresh set, performing set-union merges as
-// appropriate.
+// appropriate. Metrics are immutable, so merging with none returns the
+// other as is.
 func (m Metrics) Merge(other Metrics) Metrics {
+	switch {
+	case len(other) == 0 && m != nil:
+		return m
+	case len(m) == 0 && other != nil:
+		return other
+	}
 	if len(other) > len(m) {
 		m, other = other, m
 	}
@@ -43,11 +50,23 @@ func (m Metrics) Copy() Metrics {
 }
 
 // Metric is a list of timeseries data with some metadata. Clients must use the
-// Add method to add values.  Metrics are immutable.
+// Add method to add values.  Metrics are immutable. Metrics are gauges but
+// for those with a Histogram or Summary, which are merged with them, and
+// Counters.
 type Metric struct {
 	Samples     []Sample
 	Min, Max    float64
 	First, Last time.Time
+
+	// Histogram or Summary are the distribution of the observations of
+	// metrics of distributions, as latencies, whose samples are means.
+	Histogram *Histogram
+	Summary   *Summary
+
+	// Counter metrics are of counts only ever incremented but when reset,
+	// Resets times over the samples. They are shown by their Rate.
+	Counter bool
+	Resets  int
 }
 
 // Sample is a single datapoint of a metric.
@@ -102,11 +121,15 @@ func MakeMetric(samples []Sample) Metric {
 // WithMax returns a fresh copy of m, with Max set to max
 func (m Metric) WithMax(max float64) Metric {
 	return Metric{
-		Samples: m.Samples,
-		Max:     max,
-		Min:     m.Min,
-		First:   m.First,
-		Last:    m.Last,
+		Samples:   m.Samples,
+		Max:       max,
+		Min:       m.Min,
+		First:     m.First,
+		Last:      m.Last,
+		Histogram: m.Histogram,
+		Summary:   m.Summary,
+		Counter:   m.Counter,
+		Resets:    m.Resets,
 	}
 }
 
@@ -129,7 +152,9 @@ func last(t1, t2 time.Time) time.Time {
 	return t2
 }
 
-// Merge combines the two Metrics and returns a new result.
+// Merge combines the two Metrics and returns a new result. The resets of
+// counters are counted anew from the merged samples, and the distribution
+// is the latest of the two.
 func (m Metric) Merge(other Metric) Metric {
 
 	// Optimize the empty and non-overlapping case since they are very common
@@ -142,24 +167,30 @@ func (m Metric) Merge(other Metric) Metric {
 		samplesOut := make([]Sample, len(m.Samples)+len(other.Samples))
 		copy(samplesOut, m.Samples)
 		copy(samplesOut[len(m.Samples):], other.Samples)
+		histogram, summary := m.latestDistribution(other)
 		return Metric{
-			Samples: samplesOut,
-			Max:     math.Max(m.Max, other.Max),
-			Min:     math.Min(m.Min, other.Min),
-			First:   m.First,
-			Last:    other.Last,
-		}
+			Samples:   samplesOut,
+			Max:       math.Max(m.Max, other.Max),
+			Min:       math.Min(m.Min, other.Min),
+			First:     m.First,
+			Last:      other.Last,
+			Histogram: histogram,
+			Summary:   summary,
+		}.withCounter(m.Counter || other.Counter)
 	case m.First.After(other.Last):
 		samplesOut := make([]Sample, len(m.Samples)+len(other.Samples))
 		copy(samplesOut, other.Samples)
 		copy(samplesOut[len(other.Samples):], m.Samples)
+		histogram, summary := m.latestDistribution(other)
 		return Metric{
-			Samples: samplesOut,
-			Max:     math.Max(m.Max, other.Max),
-			Min:     math.Min(m.Min, other.Min),
-			First:   other.First,
-			Last:    m.Last,
-		}
+			Samples:   samplesOut,
+			Max:       math.Max(m.Max, other.Max),
+			Min:       math.Min(m.Min, other.Min),
+			First:     other.First,
+			Last:      m.Last,
+			Histogram: histogram,
+			Summary:   summary,
+		}.withCounter(m.Counter || other.Counter)
 	}
 
 	// Merge two lists of Samples in O(n)
@@ -187,13 +218,16 @@ func (m Metric) Merge(other Metric) Metric {
 		}
 	}
 
+	histogram, summary := m.latestDistribution(other)
 	return Metric{
-		Samples: samplesOut,
-		Max:     math.Max(m.Max, other.Max),
-		Min:     math.Min(m.Min, other.Min),
-		First:   first(m.First, other.First),
-		Last:    last(m.Last, other.Last),
-	}
+		Samples:   samplesOut,
+		Max:       math.Max(m.Max, other.Max),
+		Min:       math.Min(m.Min, other.Min),
+		First:     first(m.First, other.First),
+		Last:      last(m.Last, other.Last),
+		Histogram: histogram,
+		Summary:   summary,
+	}.withCounter(m.Counter || other.Counter)
 }
 
 // Div returns a new copy of the metric, with each value divided by n.
@@ -205,11 +239,36 @@ func (m Metric) Div(n float64) Metric {
 		samplesOut[i].Timestamp = m.Samples[i].Timestamp
 	}
 	return Metric{
-		Samples: samplesOut,
-		Max:     m.Max / n,
-		Min:     m.Min / n,
-		First:   m.First,
-		Last:    m.Last,
+		Samples:   samplesOut,
+		Max:       m.Max / n,
+		Min:       m.Min / n,
+		First:     m.First,
+		Last:      m.Last,
+		Histogram: m.Histogram.div(n),
+		Summary:   m.Summary.div(n),
+		Counter:   m.Counter,
+		Resets:    m.Resets,
+	}
+}
+
+// Shift returns a new copy of the metric, with each sample moved by d.
+func (m Metric) Shift(d time.Duration) Metric {
+	samplesOut := make([]Sample, len(m.Samples), len(m.Samples))
+
+	for i := range m.Samples {
+		samplesOut[i].Value = m.Samples[i].Value
+		samplesOut[i].Timestamp = m.Samples[i].Timestamp.Add(d)
+	}
+	return Metric{
+		Samples:   samplesOut,
+		Max:       m.Max,
+		Min:       m.Min,
+		First:     m.First.Add(d),
+		Last:      m.Last.Add(d),
+		Histogram: m.Histogram,
+		Summary:   m.Summary,
+		Counter:   m.Counter,
+		Resets:    m.Resets,
 	}
 }
 
@@ -230,6 +289,11 @@ type WireMetrics struct {
 	Max     float64  `json:"max"`
 	First   string   `json:"first,omitempty"`
 	Last    string   `json:"last,omitempty"`
+
+	Histogram *Histogram `json:"histogram,omitempty"`
+	Summary   *Summary   `json:"summary,omitempty"`
+	Counter   bool       `json:"counter,omitempty"`
+	Resets    int        `json:"resets,omitempty"`
 	dummySelfer
 }
 
@@ -252,11 +316,15 @@ func parseTime(s string) time.Time {
 // for serialization.
 func (m Metric) ToIntermediate() WireMetrics {
 	return WireMetrics{
-		Samples: m.Samples,
-		Max:     m.Max,
-		Min:     m.Min,
-		First:   renderTime(m.First),
-		Last:    renderTime(m.Last),
+		Samples:   m.Samples,
+		Max:       m.Max,
+		Min:       m.Min,
+		First:     renderTime(m.First),
+		Last:      renderTime(m.Last),
+		Histogram: m.Histogram,
+		Summary:   m.Summary,
+		Counter:   m.Counter,
+		Resets:    m.Resets,
 	}
 }
 
@@ -264,11 +332,15 @@ func (m Metric) ToIntermediate() WireMetrics {
 // for serialization.
 func (m WireMetrics) FromIntermediate() Metric {
 	return Metric{
-		Samples: m.Samples,
-		Max:     m.Max,
-		Min:     m.Min,
-		First:   parseTime(m.First),
-		Last:    parseTime(m.Last),
+		Samples:   m.Samples,
+		Max:       m.Max,
+		Min:       m.Min,
+		First:     parseTime(m.First),
+		Last:      parseTime(m.Last),
+		Histogram: m.Histogram,
+		Summary:   m.Summary,
+		Counter:   m.Counter,
+		Resets:    m.Resets,
 	}
 }
 
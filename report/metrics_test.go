@@ -137,6 +137,21 @@ func TestMetricDiv(t *testing.T) {
 	checkMetric(t, beforeDiv, t1, t2, -2048, 2048)
 }
 
+func TestMetricShift(t *testing.T) {
+	t1 := time.Now()
+	t2 := time.Now().Add(1 * time.Minute)
+
+	want := report.MakeMetric([]report.Sample{{Timestamp: t1, Value: -2}, {Timestamp: t2, Value: 2}})
+	beforeShift := report.MakeMetric([]report.Sample{{Timestamp: t1.Add(time.Hour), Value: -2}, {Timestamp: t2.Add(time.Hour), Value: 2}})
+	have := beforeShift.Shift(-time.Hour)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("diff: %s", test.Diff(want, have))
+	}
+
+	// Check the original was unmodified
+	checkMetric(t, beforeShift, t1.Add(time.Hour), t2.Add(time.Hour), -2, 2)
+}
+
 func TestMetricMarshalling(t *testing.T) {
 	t1 := time.Now().UTC()
 	t2 := time.Now().UTC().Add(1 * time.Minute)
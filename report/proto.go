@@ -0,0 +1,699 @@
+package report
+
+import (
+	"fmt"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// ProtobufContentType is the content type of reports encoded as protobuf,
+// which apps may accept alongside msgpack and JSON.
+const ProtobufContentType = "application/x-protobuf"
+
+func (rep Report) marshalProtobuf() ([]byte, error) {
+	msg := rep.toProto()
+	msg.compress()
+	return proto.Marshal(msg)
+}
+
+func makeFromProtobuf(buf []byte) (Report, error) {
+	msg := &protoReport{}
+	if err := proto.Unmarshal(buf, msg); err != nil {
+		return Report{}, err
+	}
+	if err := msg.expand(); err != nil {
+		return Report{}, err
+	}
+	rep, err := msg.toReport().migrate()
+	if err != nil {
+		return Report{}, err
+	}
+	rep.intern(decodeInterner)
+	return rep, nil
+}
+
+// minDictionaryLen is the least length of strings worth putting in the
+// dictionary of a report, rather than repeating them.
+const minDictionaryLen = 4
+
+// compress moves the latest keys and values repeated in the report into
+// its dictionary, Strings, the entries referring to them by their index
+// in it, from 1.
+func (msg *protoReport) compress() {
+	counts := map[string]int{}
+	msg.walkLatest(func(e *protoLatest) {
+		counts[e.Key]++
+		counts[e.Value]++
+	})
+	refs := map[string]int64{}
+	ref := func(s string) int64 {
+		if len(s) < minDictionaryLen || counts[s] < 2 {
+			return 0
+		}
+		if _, ok := refs[s]; !ok {
+			msg.Strings = append(msg.Strings, s)
+			refs[s] = int64(len(msg.Strings))
+		}
+		return refs[s]
+	}
+	msg.walkLatest(func(e *protoLatest) {
+		if e.KeyRef = ref(e.Key); e.KeyRef > 0 {
+			e.Key = ""
+		}
+		if e.ValueRef = ref(e.Value); e.ValueRef > 0 {
+			e.Value = ""
+		}
+	})
+}
+
+// expand resolves the references of latest entries to the dictionary of
+// the report. Entries referring to the same string share it.
+func (msg *protoReport) expand() error {
+	var err error
+	lookup := func(ref int64) string {
+		if ref < 1 || ref > int64(len(msg.Strings)) {
+			err = fmt.Errorf("invalid string reference: %d", ref)
+			return ""
+		}
+		return msg.Strings[ref-1]
+	}
+	msg.walkLatest(func(e *protoLatest) {
+		if e.KeyRef != 0 {
+			e.Key, e.KeyRef = lookup(e.KeyRef), 0
+		}
+		if e.ValueRef != 0 {
+			e.Value, e.ValueRef = lookup(e.ValueRef), 0
+		}
+	})
+	msg.Strings = nil
+	return err
+}
+
+func (msg *protoReport) walkLatest(f func(*protoLatest)) {
+	var walk func(*protoNode)
+	walk = func(n *protoNode) {
+		for _, e := range n.Latest {
+			f(e)
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	for _, t := range msg.Topologies {
+		for _, n := range t.Nodes {
+			walk(n)
+		}
+	}
+}
+
+func protoTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromProtoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
+
+func (rep Report) toProto() *protoReport {
+	msg := &protoReport{
+		SamplingCount: rep.Sampling.Count,
+		SamplingTotal: rep.Sampling.Total,
+		Window:        int64(rep.Window),
+		Shortcut:      rep.Shortcut,
+		ID:            rep.ID,
+		Version:       int64(rep.Version),
+	}
+	for _, name := range topologyNames {
+		msg.Topologies = append(msg.Topologies, rep.topology(name).toProto(name, false))
+	}
+	for name, topology := range rep.PluginTopologies {
+		msg.Topologies = append(msg.Topologies, topology.toProto(name, true))
+	}
+	if len(rep.Schema) > 0 {
+		msg.Schema = make(map[string]*protoMetadataKeySchema, len(rep.Schema))
+		for key, s := range rep.Schema {
+			msg.Schema[key] = &protoMetadataKeySchema{Type: s.Type, Unit: s.Unit, Format: s.Format, Truncate: int64(s.Truncate)}
+		}
+	}
+	rep.Plugins.ForEach(func(spec xfer.PluginSpec) {
+		msg.Plugins = append(msg.Plugins, &protoPluginSpec{
+			ID:          spec.ID,
+			Label:       spec.Label,
+			Description: spec.Description,
+			Interfaces:  spec.Interfaces,
+			APIVersion:  spec.APIVersion,
+			Status:      spec.Status,
+		})
+	})
+	return msg
+}
+
+func (msg *protoReport) toReport() Report {
+	rep := MakeReport()
+	rep.Sampling = Sampling{Count: msg.SamplingCount, Total: msg.SamplingTotal}
+	rep.Window = time.Duration(msg.Window)
+	rep.Shortcut = msg.Shortcut
+	rep.Version = int(msg.Version)
+	if msg.ID != "" {
+		rep.ID = msg.ID
+	}
+	for _, t := range msg.Topologies {
+		if t.Plugin {
+			if rep.PluginTopologies == nil {
+				rep.PluginTopologies = map[string]Topology{}
+			}
+			rep.PluginTopologies[t.Name] = t.toTopology()
+		} else if topology := rep.topology(t.Name); topology != nil {
+			// Topologies we don't know of, from newer probes, are dropped
+			*topology = t.toTopology()
+		}
+	}
+	specs := make([]xfer.PluginSpec, 0, len(msg.Plugins))
+	for _, spec := range msg.Plugins {
+		specs = append(specs, xfer.PluginSpec{
+			ID:          spec.ID,
+			Label:       spec.Label,
+			Description: spec.Description,
+			Interfaces:  spec.Interfaces,
+			APIVersion:  spec.APIVersion,
+			Status:      spec.Status,
+		})
+	}
+	rep.Plugins = xfer.MakePluginSpecs(specs...)
+	if len(msg.Schema) > 0 {
+		rep.Schema = make(MetadataSchema, len(msg.Schema))
+		for key, s := range msg.Schema {
+			rep.Schema[key] = MetadataKeySchema{Type: s.Type, Unit: s.Unit, Format: s.Format, Truncate: int(s.Truncate)}
+		}
+	}
+	return rep
+}
+
+func (t *Topology) toProto(name string, plugin bool) *protoTopology {
+	msg := &protoTopology{
+		Name:        name,
+		Plugin:      plugin,
+		Shape:       t.Shape,
+		Label:       t.Label,
+		LabelPlural: t.LabelPlural,
+		Nodes:       make([]*protoNode, 0, len(t.Nodes)),
+	}
+	for _, node := range t.Nodes {
+		msg.Nodes = append(msg.Nodes, node.toProto())
+	}
+	if len(t.Controls) > 0 {
+		msg.Controls = make(map[string]*protoControl, len(t.Controls))
+		for id, c := range t.Controls {
+			msg.Controls[id] = &protoControl{ID: c.ID, Human: c.Human, Icon: c.Icon, Rank: int32(c.Rank)}
+		}
+	}
+	if len(t.MetadataTemplates) > 0 {
+		msg.MetadataTemplates = make(map[string]*protoMetadataTemplate, len(t.MetadataTemplates))
+		for id, m := range t.MetadataTemplates {
+			msg.MetadataTemplates[id] = &protoMetadataTemplate{
+				ID:       m.ID,
+				Label:    m.Label,
+				Truncate: int32(m.Truncate),
+				Datatype: m.Datatype,
+				Priority: m.Priority,
+				From:     m.From,
+			}
+		}
+	}
+	if len(t.MetricTemplates) > 0 {
+		msg.MetricTemplates = make(map[string]*protoMetricTemplate, len(t.MetricTemplates))
+		for id, m := range t.MetricTemplates {
+			msg.MetricTemplates[id] = &protoMetricTemplate{
+				ID:       m.ID,
+				Label:    m.Label,
+				Format:   m.Format,
+				Group:    m.Group,
+				Priority: m.Priority,
+			}
+		}
+	}
+	if len(t.TableTemplates) > 0 {
+		msg.TableTemplates = make(map[string]*protoTableTemplate, len(t.TableTemplates))
+		for id, tt := range t.TableTemplates {
+			template := &protoTableTemplate{
+				ID:        tt.ID,
+				Label:     tt.Label,
+				Prefix:    tt.Prefix,
+				Type:      tt.Type,
+				FixedRows: tt.FixedRows,
+				Priority:  tt.Priority,
+			}
+			for _, c := range tt.Columns {
+				template.Columns = append(template.Columns, &protoColumn{ID: c.ID, Label: c.Label, DataType: c.DataType})
+			}
+			msg.TableTemplates[id] = template
+		}
+	}
+	return msg
+}
+
+func (msg *protoTopology) toTopology() Topology {
+	t := MakeTopology()
+	t.Shape = msg.Shape
+	t.Label = msg.Label
+	t.LabelPlural = msg.LabelPlural
+	for _, node := range msg.Nodes {
+		t.Nodes[node.ID] = node.toNode()
+	}
+	for id, c := range msg.Controls {
+		t.Controls[id] = Control{ID: c.ID, Human: c.Human, Icon: c.Icon, Rank: int(c.Rank)}
+	}
+	if len(msg.MetadataTemplates) > 0 {
+		t.MetadataTemplates = make(MetadataTemplates, len(msg.MetadataTemplates))
+		for id, m := range msg.MetadataTemplates {
+			t.MetadataTemplates[id] = MetadataTemplate{
+				ID:       m.ID,
+				Label:    m.Label,
+				Truncate: int(m.Truncate),
+				Datatype: m.Datatype,
+				Priority: m.Priority,
+				From:     m.From,
+			}
+		}
+	}
+	if len(msg.MetricTemplates) > 0 {
+		t.MetricTemplates = make(MetricTemplates, len(msg.MetricTemplates))
+		for id, m := range msg.MetricTemplates {
+			t.MetricTemplates[id] = MetricTemplate{
+				ID:       m.ID,
+				Label:    m.Label,
+				Format:   m.Format,
+				Group:    m.Group,
+				Priority: m.Priority,
+			}
+		}
+	}
+	if len(msg.TableTemplates) > 0 {
+		t.TableTemplates = make(TableTemplates, len(msg.TableTemplates))
+		for id, tt := range msg.TableTemplates {
+			template := TableTemplate{
+				ID:        tt.ID,
+				Label:     tt.Label,
+				Prefix:    tt.Prefix,
+				Type:      tt.Type,
+				FixedRows: tt.FixedRows,
+				Priority:  tt.Priority,
+			}
+			for _, c := range tt.Columns {
+				template.Columns = append(template.Columns, Column{ID: c.ID, Label: c.Label, DataType: c.DataType})
+			}
+			t.TableTemplates[id] = template
+		}
+	}
+	return t
+}
+
+func (n Node) toProto() *protoNode {
+	msg := &protoNode{
+		ID:        n.ID,
+		Topology:  n.Topology,
+		Adjacency: []string(n.Adjacency),
+		Sets:      setsToProto(n.Sets),
+		Parents:   setsToProto(n.Parents),
+	}
+	if n.Counters.Size() > 0 {
+		msg.Counters = make(map[string]int64, n.Counters.Size())
+		n.Counters.psMap.ForEach(func(key string, value interface{}) {
+			msg.Counters[key] = int64(value.(int))
+		})
+	}
+	if !n.Controls.Timestamp.IsZero() || len(n.Controls.Controls) > 0 {
+		msg.Controls = &protoNodeControls{
+			Timestamp: protoTime(n.Controls.Timestamp),
+			Controls:  []string(n.Controls.Controls),
+		}
+	}
+	for _, e := range n.LatestControls {
+		msg.LatestControls = append(msg.LatestControls, &protoLatestControl{
+			Key:       e.key,
+			Timestamp: protoTime(e.Timestamp),
+			Dead:      e.Value.Dead,
+		})
+	}
+	for _, e := range n.Latest {
+		msg.Latest = append(msg.Latest, &protoLatest{
+			Key:       e.key,
+			Timestamp: protoTime(e.Timestamp),
+			Value:     e.Value,
+		})
+	}
+	if len(n.Metrics) > 0 {
+		msg.Metrics = make(map[string]*protoMetric, len(n.Metrics))
+		for id, m := range n.Metrics {
+			metric := &protoMetric{
+				Min:   m.Min,
+				Max:   m.Max,
+				First: protoTime(m.First),
+				Last:  protoTime(m.Last),
+			}
+			if m.Counter {
+				metric.Counter, metric.Resets = true, int64(m.Resets)
+			}
+			for _, s := range m.Samples {
+				metric.Samples = append(metric.Samples, &protoSample{Timestamp: protoTime(s.Timestamp), Value: s.Value})
+			}
+			if h := m.Histogram; h != nil {
+				metric.Histogram = &protoHistogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum}
+			}
+			if s := m.Summary; s != nil {
+				metric.Summary = &protoSummary{Count: s.Count, Sum: s.Sum}
+				for _, q := range s.Quantiles {
+					metric.Summary.Quantiles = append(metric.Summary.Quantiles, &protoQuantile{Quantile: q.Quantile, Value: q.Value})
+				}
+			}
+			msg.Metrics[id] = metric
+		}
+	}
+	n.Children.ForEach(func(child Node) {
+		msg.Children = append(msg.Children, child.toProto())
+	})
+	return msg
+}
+
+func (msg *protoNode) toNode() Node {
+	n := MakeNode(msg.ID)
+	n.Topology = msg.Topology
+	n.Adjacency = MakeIDList(msg.Adjacency...)
+	n.Sets = setsFromProto(msg.Sets)
+	n.Parents = setsFromProto(msg.Parents)
+	for key, value := range msg.Counters {
+		n.Counters = n.Counters.Add(key, int(value))
+	}
+	if msg.Controls != nil {
+		n.Controls = NodeControls{
+			Timestamp: fromProtoTime(msg.Controls.Timestamp),
+			Controls:  MakeStringSet(msg.Controls.Controls...),
+		}
+	}
+	// Latest entries are sorted by key on the wire, as they are in the maps
+	for _, e := range msg.LatestControls {
+		n.LatestControls = append(n.LatestControls, nodeControlDataLatestEntry{
+			key:       e.Key,
+			Timestamp: fromProtoTime(e.Timestamp),
+			Value:     NodeControlData{Dead: e.Dead},
+		})
+	}
+	for _, e := range msg.Latest {
+		n.Latest = append(n.Latest, stringLatestEntry{
+			key:       e.Key,
+			Timestamp: fromProtoTime(e.Timestamp),
+			Value:     e.Value,
+		})
+	}
+	for id, m := range msg.Metrics {
+		metric := Metric{
+			Min:   m.Min,
+			Max:   m.Max,
+			First: fromProtoTime(m.First),
+			Last:  fromProtoTime(m.Last),
+		}
+		if m.Counter {
+			metric.Counter, metric.Resets = true, int(m.Resets)
+		}
+		for _, s := range m.Samples {
+			metric.Samples = append(metric.Samples, Sample{Timestamp: fromProtoTime(s.Timestamp), Value: s.Value})
+		}
+		if h := m.Histogram; h != nil {
+			metric.Histogram = &Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum}
+		}
+		if s := m.Summary; s != nil {
+			metric.Summary = &Summary{Count: s.Count, Sum: s.Sum}
+			for _, q := range s.Quantiles {
+				metric.Summary.Quantiles = append(metric.Summary.Quantiles, Quantile{Quantile: q.Quantile, Value: q.Value})
+			}
+		}
+		n.Metrics[id] = metric
+	}
+	if len(msg.Children) > 0 {
+		children := make([]Node, 0, len(msg.Children))
+		for _, child := range msg.Children {
+			children = append(children, child.toNode())
+		}
+		n.Children = MakeNodeSet(children...)
+	}
+	return n
+}
+
+func setsToProto(s Sets) map[string]*protoStrings {
+	if s.Size() == 0 {
+		return nil
+	}
+	msg := make(map[string]*protoStrings, s.Size())
+	s.psMap.ForEach(func(key string, value interface{}) {
+		msg[key] = &protoStrings{Values: []string(value.(StringSet))}
+	})
+	return msg
+}
+
+func setsFromProto(msg map[string]*protoStrings) Sets {
+	s := MakeSets()
+	for key, values := range msg {
+		s = s.Add(key, MakeStringSet(values.Values...))
+	}
+	return s
+}
+
+// The messages of report.proto, as protoc-gen-go would have them.
+
+type protoReport struct {
+	Topologies    []*protoTopology                   `protobuf:"bytes,1,rep,name=topologies" json:"topologies,omitempty"`
+	SamplingCount uint64                             `protobuf:"varint,2,opt,name=sampling_count,json=samplingCount" json:"sampling_count,omitempty"`
+	SamplingTotal uint64                             `protobuf:"varint,3,opt,name=sampling_total,json=samplingTotal" json:"sampling_total,omitempty"`
+	Window        int64                              `protobuf:"varint,4,opt,name=window" json:"window,omitempty"`
+	Shortcut      bool                               `protobuf:"varint,5,opt,name=shortcut" json:"shortcut,omitempty"`
+	Plugins       []*protoPluginSpec                 `protobuf:"bytes,6,rep,name=plugins" json:"plugins,omitempty"`
+	ID            string                             `protobuf:"bytes,7,opt,name=id" json:"id,omitempty"`
+	Version       int64                              `protobuf:"varint,8,opt,name=version" json:"version,omitempty"`
+	Schema        map[string]*protoMetadataKeySchema `protobuf:"bytes,9,rep,name=schema" json:"schema,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Strings       []string                           `protobuf:"bytes,10,rep,name=strings" json:"strings,omitempty"`
+}
+
+func (m *protoReport) Reset()         { *m = protoReport{} }
+func (m *protoReport) String() string { return proto.CompactTextString(m) }
+func (*protoReport) ProtoMessage()    {}
+
+type protoTopology struct {
+	Name              string                            `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Plugin            bool                              `protobuf:"varint,2,opt,name=plugin" json:"plugin,omitempty"`
+	Shape             string                            `protobuf:"bytes,3,opt,name=shape" json:"shape,omitempty"`
+	Label             string                            `protobuf:"bytes,4,opt,name=label" json:"label,omitempty"`
+	LabelPlural       string                            `protobuf:"bytes,5,opt,name=label_plural,json=labelPlural" json:"label_plural,omitempty"`
+	Nodes             []*protoNode                      `protobuf:"bytes,6,rep,name=nodes" json:"nodes,omitempty"`
+	Controls          map[string]*protoControl          `protobuf:"bytes,7,rep,name=controls" json:"controls,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	MetadataTemplates map[string]*protoMetadataTemplate `protobuf:"bytes,8,rep,name=metadata_templates,json=metadataTemplates" json:"metadata_templates,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	MetricTemplates   map[string]*protoMetricTemplate   `protobuf:"bytes,9,rep,name=metric_templates,json=metricTemplates" json:"metric_templates,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	TableTemplates    map[string]*protoTableTemplate    `protobuf:"bytes,10,rep,name=table_templates,json=tableTemplates" json:"table_templates,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *protoTopology) Reset()         { *m = protoTopology{} }
+func (m *protoTopology) String() string { return proto.CompactTextString(m) }
+func (*protoTopology) ProtoMessage()    {}
+
+type protoNode struct {
+	ID             string                   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Topology       string                   `protobuf:"bytes,2,opt,name=topology" json:"topology,omitempty"`
+	Counters       map[string]int64         `protobuf:"bytes,3,rep,name=counters" json:"counters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Sets           map[string]*protoStrings `protobuf:"bytes,4,rep,name=sets" json:"sets,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Adjacency      []string                 `protobuf:"bytes,5,rep,name=adjacency" json:"adjacency,omitempty"`
+	Controls       *protoNodeControls       `protobuf:"bytes,6,opt,name=controls" json:"controls,omitempty"`
+	LatestControls []*protoLatestControl    `protobuf:"bytes,7,rep,name=latest_controls,json=latestControls" json:"latest_controls,omitempty"`
+	Latest         []*protoLatest           `protobuf:"bytes,8,rep,name=latest" json:"latest,omitempty"`
+	Metrics        map[string]*protoMetric  `protobuf:"bytes,9,rep,name=metrics" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Parents        map[string]*protoStrings `protobuf:"bytes,10,rep,name=parents" json:"parents,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Children       []*protoNode             `protobuf:"bytes,11,rep,name=children" json:"children,omitempty"`
+}
+
+func (m *protoNode) Reset()         { *m = protoNode{} }
+func (m *protoNode) String() string { return proto.CompactTextString(m) }
+func (*protoNode) ProtoMessage()    {}
+
+type protoStrings struct {
+	Values []string `protobuf:"bytes,1,rep,name=values" json:"values,omitempty"`
+}
+
+func (m *protoStrings) Reset()         { *m = protoStrings{} }
+func (m *protoStrings) String() string { return proto.CompactTextString(m) }
+func (*protoStrings) ProtoMessage()    {}
+
+type protoNodeControls struct {
+	Timestamp int64    `protobuf:"varint,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	Controls  []string `protobuf:"bytes,2,rep,name=controls" json:"controls,omitempty"`
+}
+
+func (m *protoNodeControls) Reset()         { *m = protoNodeControls{} }
+func (m *protoNodeControls) String() string { return proto.CompactTextString(m) }
+func (*protoNodeControls) ProtoMessage()    {}
+
+type protoLatest struct {
+	Key       string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Value     string `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	KeyRef    int64  `protobuf:"varint,4,opt,name=key_ref,json=keyRef" json:"key_ref,omitempty"`
+	ValueRef  int64  `protobuf:"varint,5,opt,name=value_ref,json=valueRef" json:"value_ref,omitempty"`
+}
+
+func (m *protoLatest) Reset()         { *m = protoLatest{} }
+func (m *protoLatest) String() string { return proto.CompactTextString(m) }
+func (*protoLatest) ProtoMessage()    {}
+
+type protoLatestControl struct {
+	Key       string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Dead      bool   `protobuf:"varint,3,opt,name=dead" json:"dead,omitempty"`
+}
+
+func (m *protoLatestControl) Reset()         { *m = protoLatestControl{} }
+func (m *protoLatestControl) String() string { return proto.CompactTextString(m) }
+func (*protoLatestControl) ProtoMessage()    {}
+
+type protoMetric struct {
+	Samples   []*protoSample  `protobuf:"bytes,1,rep,name=samples" json:"samples,omitempty"`
+	Min       float64         `protobuf:"fixed64,2,opt,name=min" json:"min,omitempty"`
+	Max       float64         `protobuf:"fixed64,3,opt,name=max" json:"max,omitempty"`
+	First     int64           `protobuf:"varint,4,opt,name=first" json:"first,omitempty"`
+	Last      int64           `protobuf:"varint,5,opt,name=last" json:"last,omitempty"`
+	Histogram *protoHistogram `protobuf:"bytes,6,opt,name=histogram" json:"histogram,omitempty"`
+	Summary   *protoSummary   `protobuf:"bytes,7,opt,name=summary" json:"summary,omitempty"`
+	Counter   bool            `protobuf:"varint,8,opt,name=counter" json:"counter,omitempty"`
+	Resets    int64           `protobuf:"varint,9,opt,name=resets" json:"resets,omitempty"`
+}
+
+func (m *protoMetric) Reset()         { *m = protoMetric{} }
+func (m *protoMetric) String() string { return proto.CompactTextString(m) }
+func (*protoMetric) ProtoMessage()    {}
+
+type protoHistogram struct {
+	Bounds []float64 `protobuf:"fixed64,1,rep,packed,name=bounds" json:"bounds,omitempty"`
+	Counts []uint64  `protobuf:"varint,2,rep,packed,name=counts" json:"counts,omitempty"`
+	Sum    float64   `protobuf:"fixed64,3,opt,name=sum" json:"sum,omitempty"`
+}
+
+func (m *protoHistogram) Reset()         { *m = protoHistogram{} }
+func (m *protoHistogram) String() string { return proto.CompactTextString(m) }
+func (*protoHistogram) ProtoMessage()    {}
+
+type protoSummary struct {
+	Quantiles []*protoQuantile `protobuf:"bytes,1,rep,name=quantiles" json:"quantiles,omitempty"`
+	Count     uint64           `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+	Sum       float64          `protobuf:"fixed64,3,opt,name=sum" json:"sum,omitempty"`
+}
+
+func (m *protoSummary) Reset()         { *m = protoSummary{} }
+func (m *protoSummary) String() string { return proto.CompactTextString(m) }
+func (*protoSummary) ProtoMessage()    {}
+
+type protoQuantile struct {
+	Quantile float64 `protobuf:"fixed64,1,opt,name=quantile" json:"quantile,omitempty"`
+	Value    float64 `protobuf:"fixed64,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *protoQuantile) Reset()         { *m = protoQuantile{} }
+func (m *protoQuantile) String() string { return proto.CompactTextString(m) }
+func (*protoQuantile) ProtoMessage()    {}
+
+type protoSample struct {
+	Timestamp int64   `protobuf:"varint,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	Value     float64 `protobuf:"fixed64,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *protoSample) Reset()         { *m = protoSample{} }
+func (m *protoSample) String() string { return proto.CompactTextString(m) }
+func (*protoSample) ProtoMessage()    {}
+
+type protoControl struct {
+	ID    string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Human string `protobuf:"bytes,2,opt,name=human" json:"human,omitempty"`
+	Icon  string `protobuf:"bytes,3,opt,name=icon" json:"icon,omitempty"`
+	Rank  int32  `protobuf:"varint,4,opt,name=rank" json:"rank,omitempty"`
+}
+
+func (m *protoControl) Reset()         { *m = protoControl{} }
+func (m *protoControl) String() string { return proto.CompactTextString(m) }
+func (*protoControl) ProtoMessage()    {}
+
+type protoMetadataTemplate struct {
+	ID       string  `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Label    string  `protobuf:"bytes,2,opt,name=label" json:"label,omitempty"`
+	Truncate int32   `protobuf:"varint,3,opt,name=truncate" json:"truncate,omitempty"`
+	Datatype string  `protobuf:"bytes,4,opt,name=datatype" json:"datatype,omitempty"`
+	Priority float64 `protobuf:"fixed64,5,opt,name=priority" json:"priority,omitempty"`
+	From     string  `protobuf:"bytes,6,opt,name=from" json:"from,omitempty"`
+}
+
+func (m *protoMetadataTemplate) Reset()         { *m = protoMetadataTemplate{} }
+func (m *protoMetadataTemplate) String() string { return proto.CompactTextString(m) }
+func (*protoMetadataTemplate) ProtoMessage()    {}
+
+type protoMetricTemplate struct {
+	ID       string  `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Label    string  `protobuf:"bytes,2,opt,name=label" json:"label,omitempty"`
+	Format   string  `protobuf:"bytes,3,opt,name=format" json:"format,omitempty"`
+	Group    string  `protobuf:"bytes,4,opt,name=group" json:"group,omitempty"`
+	Priority float64 `protobuf:"fixed64,5,opt,name=priority" json:"priority,omitempty"`
+}
+
+func (m *protoMetricTemplate) Reset()         { *m = protoMetricTemplate{} }
+func (m *protoMetricTemplate) String() string { return proto.CompactTextString(m) }
+func (*protoMetricTemplate) ProtoMessage()    {}
+
+type protoTableTemplate struct {
+	ID        string            `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Label     string            `protobuf:"bytes,2,opt,name=label" json:"label,omitempty"`
+	Prefix    string            `protobuf:"bytes,3,opt,name=prefix" json:"prefix,omitempty"`
+	Type      string            `protobuf:"bytes,4,opt,name=type" json:"type,omitempty"`
+	Columns   []*protoColumn    `protobuf:"bytes,5,rep,name=columns" json:"columns,omitempty"`
+	FixedRows map[string]string `protobuf:"bytes,6,rep,name=fixed_rows,json=fixedRows" json:"fixed_rows,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Priority  float64           `protobuf:"fixed64,7,opt,name=priority" json:"priority,omitempty"`
+}
+
+func (m *protoTableTemplate) Reset()         { *m = protoTableTemplate{} }
+func (m *protoTableTemplate) String() string { return proto.CompactTextString(m) }
+func (*protoTableTemplate) ProtoMessage()    {}
+
+type protoColumn struct {
+	ID       string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Label    string `protobuf:"bytes,2,opt,name=label" json:"label,omitempty"`
+	DataType string `protobuf:"bytes,3,opt,name=data_type,json=dataType" json:"data_type,omitempty"`
+}
+
+func (m *protoColumn) Reset()         { *m = protoColumn{} }
+func (m *protoColumn) String() string { return proto.CompactTextString(m) }
+func (*protoColumn) ProtoMessage()    {}
+
+type protoPluginSpec struct {
+	ID          string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Label       string   `protobuf:"bytes,2,opt,name=label" json:"label,omitempty"`
+	Description string   `protobuf:"bytes,3,opt,name=description" json:"description,omitempty"`
+	Interfaces  []string `protobuf:"bytes,4,rep,name=interfaces" json:"interfaces,omitempty"`
+	APIVersion  string   `protobuf:"bytes,5,opt,name=api_version,json=apiVersion" json:"api_version,omitempty"`
+	Status      string   `protobuf:"bytes,6,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *protoPluginSpec) Reset()         { *m = protoPluginSpec{} }
+func (m *protoPluginSpec) String() string { return proto.CompactTextString(m) }
+func (*protoPluginSpec) ProtoMessage()    {}
+
+type protoMetadataKeySchema struct {
+	Type     string `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
+	Unit     string `protobuf:"bytes,2,opt,name=unit" json:"unit,omitempty"`
+	Format   string `protobuf:"bytes,3,opt,name=format" json:"format,omitempty"`
+	Truncate int64  `protobuf:"varint,4,opt,name=truncate" json:"truncate,omitempty"`
+}
+
+func (m *protoMetadataKeySchema) Reset()         { *m = protoMetadataKeySchema{} }
+func (m *protoMetadataKeySchema) String() string { return proto.CompactTextString(m) }
+func (*protoMetadataKeySchema) ProtoMessage()    {}
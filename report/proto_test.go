@@ -0,0 +1,60 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestProtobufRoundtrip(t *testing.T) {
+	t1 := time.Unix(1500000000, 0).UTC()
+
+	r1 := report.MakeReport()
+	r1.Window = 15 * time.Second
+	r1.Sampling = report.Sampling{Count: 1, Total: 2}
+	r1.Plugins = xfer.MakePluginSpecs(xfer.PluginSpec{ID: "plugin", Label: "Plugin", Interfaces: []string{"reporter"}})
+	r1.Schema = report.MetadataSchema{"uptime": {Type: report.Duration, Unit: "s", Truncate: 8}}
+	r1.Container = r1.Container.
+		WithMetadataTemplates(report.MetadataTemplates{"name": {ID: "name", Label: "Name", From: report.FromLatest}}).
+		WithMetricTemplates(report.MetricTemplates{"cpu": {ID: "cpu", Label: "CPU", Format: "percent"}}).
+		WithTableTemplates(report.TableTemplates{"labels": {ID: "labels", Prefix: "label_", FixedRows: map[string]string{"a": "A"}}})
+	r1.Container.Controls.AddControl(report.Control{ID: "stop", Human: "Stop", Icon: "fa-stop", Rank: 1})
+	r1.Container.AddNode(report.MakeNode("a").
+		WithTopology(report.Container).
+		WithLatest("name", t1, "a").
+		WithLatestControl("stop", t1, report.NodeControlData{}).
+		WithCounters(map[string]int{"restarts": 2}).
+		WithSets(report.MakeSets().Add("ips", report.MakeStringSet("10.0.0.1"))).
+		WithParents(report.MakeSets().Add(report.Host, report.MakeStringSet("host"))).
+		WithAdjacent("b").
+		WithMetrics(report.Metrics{
+			"cpu":     report.MakeSingletonMetric(t1, 0.5),
+			"latency": report.MakeHistogramMetric(t1, report.MakeHistogram(0.01, 0.1).Observe(0.05)),
+			"bytes":   report.MakeCounterMetric([]report.Sample{{Timestamp: t1, Value: 10}}),
+			"rtt":     report.MakeSummaryMetric(t1, report.Summary{Quantiles: []report.Quantile{{Quantile: 0.5, Value: 0.02}}, Count: 1, Sum: 0.02}),
+		}).
+		WithChild(report.MakeNode("child").WithLatest("name", t1, "child")))
+	r1.PluginTopologies = map[string]report.Topology{
+		"plugin_things": report.MakeTopology().AddNode(report.MakeNode("thing")),
+	}
+
+	var buf bytes.Buffer
+	if err := r1.WriteEncoded(&buf, report.ProtobufContentType, report.GzipEncoding); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := report.MakeFromEncodedBytes(buf.Bytes(), report.ProtobufContentType, report.GzipEncoding, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r1, *r2) {
+		t.Error(test.Diff(r1, *r2))
+	}
+	if r1.ID != r2.ID {
+		t.Errorf("Expected ID %q, got %q", r1.ID, r2.ID)
+	}
+}
@@ -0,0 +1,59 @@
+package report
+
+// MakeCounterMetric makes a counter metric from unique samples
+// incrementally ordered in time, of a count only ever incremented but when
+// reset, as of bytes sent.
+func MakeCounterMetric(samples []Sample) Metric {
+	m := MakeMetric(samples)
+	m.Counter = true
+	m.Resets = resets(m.Samples)
+	return m
+}
+
+// resets returns how many times the counter of the samples was reset: the
+// times its value decreased. Merges count them anew from the merged
+// samples, so merging samples of the same counter twice counts no more.
+func resets(samples []Sample) int {
+	var count int
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Value < samples[i-1].Value {
+			count++
+		}
+	}
+	return count
+}
+
+// withCounter returns the metric as a counter, if either of the metrics it
+// was made of was one, with its resets counted.
+func (m Metric) withCounter(counter bool) Metric {
+	if counter {
+		m.Counter = true
+		m.Resets = resets(m.Samples)
+	}
+	return m
+}
+
+// Rate returns the rate per second of a counter metric, between each of
+// its samples and the one before, at the later. A counter decreasing was
+// reset, as when its container restarted, and counted from 0 again, so
+// its increase since is its value. Metrics of less than two samples have
+// no rate.
+func (m Metric) Rate() Metric {
+	if len(m.Samples) < 2 {
+		return emptyMetric
+	}
+	samples := make([]Sample, 0, len(m.Samples)-1)
+	for i := 1; i < len(m.Samples); i++ {
+		prev, cur := m.Samples[i-1], m.Samples[i]
+		elapsed := cur.Timestamp.Sub(prev.Timestamp)
+		if elapsed <= 0 {
+			continue
+		}
+		increase := cur.Value - prev.Value
+		if increase < 0 {
+			increase = cur.Value
+		}
+		samples = append(samples, Sample{Timestamp: cur.Timestamp, Value: increase / elapsed.Seconds()})
+	}
+	return MakeMetric(samples)
+}
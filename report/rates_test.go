@@ -0,0 +1,49 @@
+package report_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestCounterMetricRate(t *testing.T) {
+	t0 := time.Unix(1500000000, 0).UTC()
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+
+	// The container restarts between 20s and 30s, its counter going back to 0
+	before := report.MakeCounterMetric([]report.Sample{{Timestamp: at(0), Value: 100}, {Timestamp: at(10), Value: 200}, {Timestamp: at(20), Value: 300}})
+	after := report.MakeCounterMetric([]report.Sample{{Timestamp: at(30), Value: 50}, {Timestamp: at(40), Value: 150}})
+	merged := after.Merge(before)
+	if !merged.Counter || merged.Resets != 1 {
+		t.Errorf("Expected a counter reset once, got %v", merged)
+	}
+	if again := merged.Merge(before); again.Resets != 1 {
+		t.Errorf("Expected merging the same samples again not to count resets, got %d", again.Resets)
+	}
+
+	want := report.MakeMetric([]report.Sample{
+		{Timestamp: at(10), Value: 10},
+		{Timestamp: at(20), Value: 10},
+		{Timestamp: at(30), Value: 5},
+		{Timestamp: at(40), Value: 10},
+	})
+	if have := merged.Rate(); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected rate %v, got %v", want, have)
+	}
+	if have := report.MakeCounterMetric([]report.Sample{{Timestamp: at(0), Value: 1}}).Rate(); have.Len() != 0 {
+		t.Errorf("Expected no rate of one sample, got %v", have)
+	}
+}
+
+func TestCounterMetricRow(t *testing.T) {
+	t0 := time.Unix(1500000000, 0).UTC()
+	node := report.MakeNode("a").WithMetrics(report.Metrics{
+		"bytes": report.MakeCounterMetric([]report.Sample{{Timestamp: t0, Value: 1000}, {Timestamp: t0.Add(10 * time.Second), Value: 3000}}),
+	})
+	row, ok := report.MetricTemplate{ID: "bytes", Label: "Bytes/s"}.MetricRow(node)
+	if !ok || row.Value != 200 || row.Metric.Counter {
+		t.Errorf("Expected a row of the rate, got %v", row)
+	}
+}
@@ -3,6 +3,7 @@ package report
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,23 +13,29 @@ import (
 
 // Names of the various topologies.
 const (
-	Endpoint       = "endpoint"
-	Process        = "process"
-	Container      = "container"
-	Pod            = "pod"
-	Service        = "service"
-	Deployment     = "deployment"
-	ReplicaSet     = "replica_set"
-	DaemonSet      = "daemon_set"
-	StatefulSet    = "stateful_set"
-	CronJob        = "cron_job"
-	Namespace      = "namespace"
-	ContainerImage = "container_image"
-	Host           = "host"
-	Overlay        = "overlay"
-	ECSService     = "ecs_service"
-	ECSTask        = "ecs_task"
-	SwarmService   = "swarm_service"
+	Endpoint        = "endpoint"
+	Process         = "process"
+	Container       = "container"
+	Pod             = "pod"
+	Service         = "service"
+	Deployment      = "deployment"
+	ReplicaSet      = "replica_set"
+	DaemonSet       = "daemon_set"
+	StatefulSet     = "stateful_set"
+	CronJob         = "cron_job"
+	Autoscaler      = "autoscaler"
+	Namespace       = "namespace"
+	ContainerImage  = "container_image"
+	Host            = "host"
+	Overlay         = "overlay"
+	ECSService      = "ecs_service"
+	ECSTask         = "ecs_task"
+	SwarmService    = "swarm_service"
+	NomadJob        = "nomad_job"
+	NomadTaskGroup  = "nomad_task_group"
+	NomadAllocation = "nomad_allocation"
+	GPU             = "gpu"
+	ScopeProbe      = "scope_probe"
 
 	// Shapes used for different nodes
 	Circle   = "circle"
@@ -57,12 +64,18 @@ var topologyNames = []string{
 	DaemonSet,
 	StatefulSet,
 	CronJob,
+	Autoscaler,
 	Namespace,
 	Host,
 	Overlay,
 	ECSTask,
 	ECSService,
 	SwarmService,
+	NomadJob,
+	NomadTaskGroup,
+	NomadAllocation,
+	GPU,
+	ScopeProbe,
 }
 
 // Report is the core data type. It's produced by probes, and consumed and
@@ -117,8 +130,14 @@ type Report struct {
 	// present.
 	CronJob Topology
 
+	// Autoscaler nodes represent all Kubernetes Horizontal and Vertical Pod
+	// Autoscalers. Metadata includes things like autoscaler id, name, scale
+	// target, etc. Edges are present, pointing at the scaled workload.
+	Autoscaler Topology
+
 	// Namespace nodes represent all Kubernetes Namespaces running on hosts running probes.
-	// Metadata includes things like Namespace id, name, etc. Edges are not
+	// Metadata includes things like Namespace id, name, resource quota
+	// utilization and limit ranges, etc. Edges are not
 	// present.
 	Namespace Topology
 
@@ -146,11 +165,36 @@ type Report struct {
 	// Edges are not present.
 	SwarmService Topology
 
+	// Nomad Job nodes are HashiCorp Nomad jobs, which declare one or more
+	// task groups. Edges are not present.
+	NomadJob Topology
+
+	// Nomad Task Group nodes are the task groups of Nomad jobs, which specify
+	// a desired count of allocations. Edges are not present.
+	NomadTaskGroup Topology
+
+	// Nomad Allocation nodes are instances of a Nomad task group placed on
+	// a client, which represent a group of containers. Edges are not present.
+	NomadAllocation Topology
+
+	// GPU nodes are the GPUs of hosts, with their utilization. Processes
+	// and containers using a GPU have it as a parent. Edges are not present.
+	GPU Topology
+
+	// ScopeProbe nodes are the probes themselves, with how they are doing,
+	// to troubleshoot them from scope. Edges are not present.
+	ScopeProbe Topology
+
 	// Overlay nodes are active peers in any software-defined network that's
 	// overlaid on the infrastructure. The information is scraped by polling
 	// their status endpoints. Edges are present.
 	Overlay Topology
 
+	// PluginTopologies are topologies of plugins' own making, keyed by name.
+	// The app serves each of them as a view of its own. Their names must not
+	// be those of the topologies above.
+	PluginTopologies map[string]Topology
+
 	// Sampling data for this report.
 	Sampling Sampling
 
@@ -168,6 +212,13 @@ type Report struct {
 
 	Plugins xfer.PluginSpecs
 
+	// Schema describes the metadata keys of the nodes of the report.
+	Schema MetadataSchema
+
+	// Version is the SchemaVersion of the code which made the report.
+	// Reports from before versioning are version 0.
+	Version int
+
 	// ID a random identifier for this report, used when caching
 	// rendered views of the report.  Reports with the same id
 	// must be equal, but we don't require that equal reports have
@@ -224,7 +275,13 @@ func MakeReport() Report {
 			WithShape(Triangle).
 			WithLabel("cron job", "cron jobs"),
 
-		Namespace: MakeTopology(),
+		Autoscaler: MakeTopology().
+			WithShape(Pentagon).
+			WithLabel("autoscaler", "autoscalers"),
+
+		Namespace: MakeTopology().
+			WithShape(Cloud).
+			WithLabel("namespace", "namespaces"),
 
 		Overlay: MakeTopology().
 			WithShape(Circle).
@@ -242,9 +299,30 @@ func MakeReport() Report {
 			WithShape(Heptagon).
 			WithLabel("service", "services"),
 
+		NomadJob: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("job", "jobs"),
+
+		NomadTaskGroup: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("task group", "task groups"),
+
+		NomadAllocation: MakeTopology().
+			WithShape(Octagon).
+			WithLabel("allocation", "allocations"),
+
+		GPU: MakeTopology().
+			WithShape(Square).
+			WithLabel("GPU", "GPUs"),
+
+		ScopeProbe: MakeTopology().
+			WithShape(Pentagon).
+			WithLabel("probe", "probes"),
+
 		Sampling: Sampling{},
 		Window:   0,
 		Plugins:  xfer.MakePluginSpecs(),
+		Version:  SchemaVersion,
 		ID:       fmt.Sprintf("%d", rand.Int63()),
 	}
 }
@@ -255,11 +333,19 @@ func (r Report) Copy() Report {
 		Sampling: r.Sampling,
 		Window:   r.Window,
 		Plugins:  r.Plugins.Copy(),
+		Schema:   r.Schema.Copy(),
+		Version:  r.Version,
 		ID:       fmt.Sprintf("%d", rand.Int63()),
 	}
 	newReport.WalkPairedTopologies(&r, func(newTopology, oldTopology *Topology) {
 		*newTopology = oldTopology.Copy()
 	})
+	if r.PluginTopologies != nil {
+		newReport.PluginTopologies = make(map[string]Topology, len(r.PluginTopologies))
+		for name, topology := range r.PluginTopologies {
+			newReport.PluginTopologies[name] = topology.Copy()
+		}
+	}
 	return newReport
 }
 
@@ -267,33 +353,61 @@ func (r Report) Copy() Report {
 // original is not modified.
 func (r Report) Merge(other Report) Report {
 	newReport := r.Copy()
-	newReport.Sampling = newReport.Sampling.Merge(other.Sampling)
-	newReport.Window = newReport.Window + other.Window
-	newReport.Plugins = newReport.Plugins.Merge(other.Plugins)
-	newReport.WalkPairedTopologies(&other, func(ourTopology, theirTopology *Topology) {
-		*ourTopology = ourTopology.Merge(*theirTopology)
-	})
+	newReport.UnsafeMerge(other)
 	return newReport
 }
 
+// UnsafeMerge merges another Report into the receiver, modifying it in
+// place, so merging many reports needn't copy the result of each merge.
+// The receiver must not be shared, as by having been made by MakeReport,
+// Copy or Merge; the other report is not modified.
+func (r *Report) UnsafeMerge(other Report) {
+	r.Sampling = r.Sampling.Merge(other.Sampling)
+	r.Window = r.Window + other.Window
+	r.Plugins = r.Plugins.Merge(other.Plugins)
+	r.Schema = r.Schema.Merge(other.Schema)
+	r.WalkPairedTopologies(&other, func(ourTopology, theirTopology *Topology) {
+		ourTopology.UnsafeMerge(*theirTopology)
+	})
+	for name, theirs := range other.PluginTopologies {
+		if r.PluginTopologies == nil {
+			r.PluginTopologies = map[string]Topology{}
+		}
+		if ours, ok := r.PluginTopologies[name]; ok {
+			ours.UnsafeMerge(theirs)
+			r.PluginTopologies[name] = ours
+		} else {
+			r.PluginTopologies[name] = theirs.Copy()
+		}
+	}
+}
+
 // WalkTopologies iterates through the Topologies of the report,
 // potentially modifying them
 func (r *Report) WalkTopologies(f func(*Topology)) {
-	for _, name := range topologyNames {
-		f(r.topology(name))
-	}
+	r.WalkNamedTopologies(func(_ string, t *Topology) { f(t) })
 }
 
 // WalkNamedTopologies iterates through the Topologies of the report,
-// potentially modifying them.
+// potentially modifying them. Plugin topologies come last, by name.
 func (r *Report) WalkNamedTopologies(f func(string, *Topology)) {
 	for _, name := range topologyNames {
 		f(name, r.topology(name))
 	}
+	names := make([]string, 0, len(r.PluginTopologies))
+	for name := range r.PluginTopologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		topology := r.PluginTopologies[name]
+		f(name, &topology)
+		r.PluginTopologies[name] = topology
+	}
 }
 
 // WalkPairedTopologies iterates through the Topologies of this and another report,
-// potentially modifying one or both.
+// potentially modifying one or both. Plugin topologies are not included.
 func (r *Report) WalkPairedTopologies(o *Report, f func(*Topology, *Topology)) {
 	for _, name := range topologyNames {
 		f(r.topology(name), o.topology(name))
@@ -326,6 +440,8 @@ func (r *Report) topology(name string) *Topology {
 		return &r.StatefulSet
 	case CronJob:
 		return &r.CronJob
+	case Autoscaler:
+		return &r.Autoscaler
 	case Namespace:
 		return &r.Namespace
 	case Host:
@@ -338,6 +454,16 @@ func (r *Report) topology(name string) *Topology {
 		return &r.ECSService
 	case SwarmService:
 		return &r.SwarmService
+	case NomadJob:
+		return &r.NomadJob
+	case NomadTaskGroup:
+		return &r.NomadTaskGroup
+	case NomadAllocation:
+		return &r.NomadAllocation
+	case GPU:
+		return &r.GPU
+	case ScopeProbe:
+		return &r.ScopeProbe
 	}
 	return nil
 }
@@ -347,9 +473,46 @@ func (r Report) Topology(name string) (Topology, bool) {
 	if t := r.topology(name); t != nil {
 		return *t, true
 	}
+	if t, ok := r.PluginTopologies[name]; ok {
+		return t, true
+	}
 	return Topology{}, false
 }
 
+// IsPluginTopology tells whether the named topology is one of the plugin
+// topologies of the report.
+func (r Report) IsPluginTopology(name string) bool {
+	if r.topology(name) != nil {
+		return false
+	}
+	_, ok := r.PluginTopologies[name]
+	return ok
+}
+
+// OnlyTopologies returns the report with the nodes of the named topologies
+// only.
+func (r Report) OnlyTopologies(names []string) Report {
+	keep := map[string]bool{}
+	for _, name := range names {
+		keep[name] = true
+	}
+	if r.PluginTopologies != nil {
+		plugins := map[string]Topology{}
+		for name, t := range r.PluginTopologies {
+			if keep[name] {
+				plugins[name] = t
+			}
+		}
+		r.PluginTopologies = plugins
+	}
+	r.WalkNamedTopologies(func(name string, t *Topology) {
+		if !keep[name] {
+			*t = MakeTopology()
+		}
+	})
+	return r
+}
+
 // Validate checks the report for various inconsistencies.
 func (r Report) Validate() error {
 	var errs []string
@@ -358,6 +521,14 @@ func (r Report) Validate() error {
 			errs = append(errs, err.Error())
 		}
 	}
+	for name, t := range r.PluginTopologies {
+		if r.topology(name) != nil {
+			errs = append(errs, fmt.Sprintf("plugin topology %q shadows a built-in one", name))
+		}
+		if err := t.Validate(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
 	if r.Sampling.Count > r.Sampling.Total {
 		errs = append(errs, fmt.Sprintf("sampling count (%d) bigger than total (%d)", r.Sampling.Count, r.Sampling.Total))
 	}
@@ -445,7 +616,7 @@ func (r Report) upgradeNamespaces() Report {
 	}
 
 	namespaces := map[string]struct{}{}
-	for _, t := range []Topology{r.Pod, r.Service, r.Deployment, r.DaemonSet, r.StatefulSet, r.CronJob} {
+	for _, t := range []Topology{r.Pod, r.Service, r.Deployment, r.DaemonSet, r.StatefulSet, r.CronJob, r.Autoscaler} {
 		for _, n := range t.Nodes {
 			if state, ok := n.Latest.Lookup(KubernetesState); ok && state == KubernetesStateDeleted {
 				continue
@@ -473,6 +644,18 @@ func (r Report) upgradeNamespaces() Report {
 //
 // This for now creates node's Controls from LatestControls.
 func (r Report) BackwardCompatible() Report {
+	needed := false
+	r.WalkTopologies(func(topology *Topology) {
+		for _, node := range topology.Nodes {
+			if node.LatestControls.Size() > 0 {
+				needed = true
+			}
+		}
+	})
+	if !needed {
+		return r
+	}
+
 	now := mtime.Now()
 	cp := r.Copy()
 	cp.WalkTopologies(func(topology *Topology) {
@@ -531,4 +714,7 @@ const (
 	HostNodeID = "host_node_id"
 	// ControlProbeID is the random ID of the probe which controls the specific node.
 	ControlProbeID = "control_probe_id"
+	// DegradedAdjacency is a set of the nodes in a node's adjacency whose
+	// connection to it is unhealthy, for the UI to tell those edges apart.
+	DegradedAdjacency = "degraded_adjacency"
 )
@@ -127,3 +127,69 @@ func TestReportUpgrade(t *testing.T) {
 		t.Error(test.Diff(expected, got))
 	}
 }
+
+func TestReportPluginTopologies(t *testing.T) {
+	a := report.MakeReport()
+	a.PluginTopologies = map[string]report.Topology{
+		"queue": report.MakeTopology().WithLabel("queue", "queues").AddNode(report.MakeNode("orders")),
+	}
+	b := report.MakeReport()
+	b.PluginTopologies = map[string]report.Topology{
+		"queue": report.MakeTopology().AddNode(report.MakeNode("payments")),
+		"host":  report.MakeTopology(),
+	}
+
+	merged := a.Merge(b)
+	queue, ok := merged.Topology("queue")
+	if !ok {
+		t.Fatal("Expected the plugin topology to be found")
+	}
+	if want, have := 2, len(queue.Nodes); want != have {
+		t.Errorf("want %d nodes, have %d", want, have)
+	}
+	if want, have := "queues", queue.LabelPlural; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if _, ok := a.PluginTopologies["queue"].Nodes["payments"]; ok {
+		t.Error("Merge must not modify the original")
+	}
+
+	if !merged.IsPluginTopology("queue") {
+		t.Error("Expected queue to be a plugin topology")
+	}
+	if merged.IsPluginTopology(report.Host) {
+		t.Error("Built-in topologies must take precedence over plugin ones")
+	}
+	if err := merged.Validate(); err == nil {
+		t.Error("Expected a plugin topology named after a built-in one not to validate")
+	}
+
+	var names []string
+	merged.WalkNamedTopologies(func(name string, topology *report.Topology) {
+		if merged.IsPluginTopology(name) {
+			names = append(names, name)
+		}
+	})
+	if want := []string{"queue"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("want %v, have %v", want, names)
+	}
+}
+
+func TestReportUnsafeMerge(t *testing.T) {
+	a := report.MakeReport()
+	a.Host.AddNode(report.MakeNode("a").WithMetrics(report.Metrics{"load": report.MakeSingletonMetric(time.Unix(1, 0), 1)}))
+	b := report.MakeReport()
+	b.Host.AddNode(report.MakeNode("a").WithLatest("name", time.Unix(1, 0), "a"))
+	b.Host.AddNode(report.MakeNode("b"))
+
+	want := a.Merge(b)
+	have := a.Copy()
+	have.UnsafeMerge(b)
+	have.ID = want.ID
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if len(b.Host.Nodes) != 2 || len(b.Host.Nodes["a"].Metrics) != 0 {
+		t.Errorf("UnsafeMerge must not modify the other: %v", b.Host.Nodes)
+	}
+}
@@ -2,6 +2,7 @@ package report
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -183,13 +184,19 @@ type Table struct {
 	Columns         []Column `json:"columns"`
 	Rows            []Row    `json:"rows"`
 	TruncationCount int      `json:"truncationCount,omitempty"`
+	Priority        float64  `json:"priority,omitempty"`
 }
 
-type tablesByID []Table
+type tablesByPriority []Table
 
-func (t tablesByID) Len() int           { return len(t) }
-func (t tablesByID) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
-func (t tablesByID) Less(i, j int) bool { return t[i].ID < t[j].ID }
+func (t tablesByPriority) Len() int      { return len(t) }
+func (t tablesByPriority) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t tablesByPriority) Less(i, j int) bool {
+	if t[i].Priority != t[j].Priority {
+		return t[i].Priority < t[j].Priority
+	}
+	return t[i].ID < t[j].ID
+}
 
 // TableTemplate describes how to render a table for the UI.
 type TableTemplate struct {
@@ -202,6 +209,8 @@ type TableTemplate struct {
 	// indexed by the key to extract the row value is mapped to the row
 	// label
 	FixedRows map[string]string `json:"fixedRows"`
+	// Priority orders the tables of a node, lowest first
+	Priority float64 `json:"priority,omitempty"`
 }
 
 // Copy returns a value-copy of the TableTemplate
@@ -244,6 +253,7 @@ func (t TableTemplate) Merge(other TableTemplate) TableTemplate {
 		Type:      max(t.Type, other.Type),
 		Columns:   columns,
 		FixedRows: fixedRows,
+		Priority:  math.Max(t.Priority, other.Priority),
 	}
 }
 
@@ -271,9 +281,10 @@ func (t TableTemplates) Tables(node Node) []Table {
 			Type:            tableType,
 			Rows:            rows,
 			TruncationCount: truncationCount,
+			Priority:        template.Priority,
 		})
 	}
-	sort.Sort(tablesByID(result))
+	sort.Sort(tablesByPriority(result))
 	return result
 }
 
@@ -302,3 +302,25 @@ func TestTables(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestTablesPriority(t *testing.T) {
+	templates := report.TableTemplates{
+		"AAA": {ID: "AAA", Prefix: "aaa_", Priority: 2},
+		"BBB": {ID: "BBB", Prefix: "bbb_", Priority: 1},
+		"CCC": {ID: "CCC", Prefix: "ccc_"},
+		"DDD": {ID: "DDD", Prefix: "ddd_", Priority: 1},
+	}
+	have := []string{}
+	for _, table := range templates.Tables(report.MakeNode("foo")) {
+		have = append(have, table.ID)
+	}
+	want := []string{"CCC", "BBB", "DDD", "AAA"}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	merged := report.TableTemplate{ID: "AAA", Priority: 3}.Merge(templates["AAA"])
+	if merged.Priority != 3 {
+		t.Errorf("want priority 3, have %v", merged.Priority)
+	}
+}
@@ -138,24 +138,29 @@ func (t Topology) Copy() Topology {
 // Merge merges the other object into this one, and returns the result object.
 // The original is not modified.
 func (t Topology) Merge(other Topology) Topology {
-	shape := t.Shape
-	if shape == "" {
-		shape = other.Shape
+	t.Nodes = t.Nodes.Copy()
+	t.UnsafeMerge(other)
+	return t
+}
+
+// UnsafeMerge merges the other object into this one, modifying its nodes
+// in place. The nodes must not be shared; those of the other are not
+// modified.
+func (t *Topology) UnsafeMerge(other Topology) {
+	if t.Shape == "" {
+		t.Shape = other.Shape
 	}
-	label, labelPlural := t.Label, t.LabelPlural
-	if label == "" {
-		label, labelPlural = other.Label, other.LabelPlural
+	if t.Label == "" {
+		t.Label, t.LabelPlural = other.Label, other.LabelPlural
 	}
-	return Topology{
-		Shape:             shape,
-		Label:             label,
-		LabelPlural:       labelPlural,
-		Nodes:             t.Nodes.Merge(other.Nodes),
-		Controls:          t.Controls.Merge(other.Controls),
-		MetadataTemplates: t.MetadataTemplates.Merge(other.MetadataTemplates),
-		MetricTemplates:   t.MetricTemplates.Merge(other.MetricTemplates),
-		TableTemplates:    t.TableTemplates.Merge(other.TableTemplates),
+	if t.Nodes == nil {
+		t.Nodes = Nodes{}
 	}
+	t.Nodes.UnsafeMerge(other.Nodes)
+	t.Controls = t.Controls.Merge(other.Controls)
+	t.MetadataTemplates = t.MetadataTemplates.Merge(other.MetadataTemplates)
+	t.MetricTemplates = t.MetricTemplates.Merge(other.MetricTemplates)
+	t.TableTemplates = t.TableTemplates.Merge(other.TableTemplates)
 }
 
 // Nodes is a collection of nodes in a topology. Keys are node IDs.
@@ -188,6 +193,18 @@ func (n Nodes) Merge(other Nodes) Nodes {
 	return cp
 }
 
+// UnsafeMerge merges the other object into this one, modifying it in
+// place. The other is not modified.
+func (n Nodes) UnsafeMerge(other Nodes) {
+	for k, v := range other {
+		if existing, ok := n[k]; ok { // don't overwrite
+			n[k] = v.Merge(existing)
+		} else {
+			n[k] = v
+		}
+	}
+}
+
 // Validate checks the topology for various inconsistencies.
 func (t Topology) Validate() error {
 	errs := []string{}
@@ -0,0 +1,69 @@
+package report
+
+import (
+	"fmt"
+)
+
+// SchemaVersion is the version of the reports this code makes. Reports of
+// older versions are migrated forward as they are decoded, so apps can
+// take reports from probes older than them. Reports of newer versions are
+// taken as they are: probes leave out of them what the app doesn't list in
+// its ReportFeatures.
+//
+// Bump it, and add a migration from the version before, whenever a change
+// to reports would have older ones misread.
+const SchemaVersion = 1
+
+// migrations take reports from the version they are keyed by to the next.
+// They are applied to the reports in deltas too, so must only look at one
+// node at a time.
+var migrations = map[int]func(Report) Report{
+	// Reports from before versioning may only have Controls on nodes
+	0: Report.upgradeLatestControls,
+}
+
+// migrate brings a report decoded at its own version up to SchemaVersion.
+func (r Report) migrate() (Report, error) {
+	id, shortcut := r.ID, r.Shortcut
+	for r.Version < SchemaVersion {
+		migration, ok := migrations[r.Version]
+		if !ok {
+			return r, fmt.Errorf("no migration from report version %d", r.Version)
+		}
+		r = migration(r)
+		r.Version++
+	}
+	// Migrations may copy the report, which doesn't keep these
+	r.ID, r.Shortcut = id, shortcut
+	return r, nil
+}
+
+// Features of reports which probes only put in the reports they send to
+// apps which list them in their details.
+const (
+	// LatestControlsFeature is taking node controls as LatestControls
+	// alone. Apps which don't are sent them as Controls as well.
+	LatestControlsFeature = "latest_controls"
+
+	// PluginTopologiesFeature is serving the PluginTopologies of reports.
+	PluginTopologiesFeature = "plugin_topologies"
+)
+
+// Features are the features of reports this code takes.
+var Features = []string{LatestControlsFeature, PluginTopologiesFeature}
+
+// ForFeatures returns the report as it should be sent to apps which take
+// the given features.
+func (r Report) ForFeatures(features []string) Report {
+	has := map[string]bool{}
+	for _, feature := range features {
+		has[feature] = true
+	}
+	if !has[LatestControlsFeature] {
+		r = r.BackwardCompatible()
+	}
+	if !has[PluginTopologiesFeature] {
+		r.PluginTopologies = nil
+	}
+	return r
+}
@@ -0,0 +1,63 @@
+package report_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestMigration(t *testing.T) {
+	t1 := time.Unix(1500000000, 0).UTC()
+	for version := 0; version <= report.SchemaVersion; version++ {
+		r1 := report.MakeReport()
+		r1.Version = version
+		r1.Shortcut = true
+		r1.Container.AddNode(report.MakeNode("a").WithControls("stop"))
+		r1.Container.Nodes["a"] = r1.Container.Nodes["a"].WithLatest("name", t1, "a")
+
+		var buf bytes.Buffer
+		if err := r1.WriteBinary(&buf, gzip.DefaultCompression); err != nil {
+			t.Fatal(err)
+		}
+		r2, err := report.MakeFromBytes(buf.Bytes())
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if r2.Version != report.SchemaVersion {
+			t.Errorf("Expected version %d to be migrated to %d, got %d", version, report.SchemaVersion, r2.Version)
+		}
+		if !r2.Shortcut || r2.ID != r1.ID {
+			t.Errorf("Expected migration to keep the shortcut flag and ID")
+		}
+		if version == 0 {
+			if _, ok := r2.Container.Nodes["a"].LatestControls.Lookup("stop"); !ok {
+				t.Errorf("Expected unversioned Controls to be migrated to LatestControls")
+			}
+		}
+	}
+}
+
+func TestForFeatures(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(report.MakeNode("a").WithLatestControls(map[string]report.NodeControlData{"stop": {}}))
+	rpt.PluginTopologies = map[string]report.Topology{"queue": report.MakeTopology()}
+
+	older := rpt.ForFeatures(nil)
+	if !older.Container.Nodes["a"].Controls.Controls.Contains("stop") {
+		t.Errorf("Expected controls as Controls for apps without %s", report.LatestControlsFeature)
+	}
+	if older.PluginTopologies != nil {
+		t.Errorf("Expected no plugin topologies for apps without %s", report.PluginTopologiesFeature)
+	}
+
+	newer := rpt.ForFeatures(report.Features)
+	if len(newer.Container.Nodes["a"].Controls.Controls) != 0 {
+		t.Errorf("Expected no Controls for apps with %s", report.LatestControlsFeature)
+	}
+	if len(newer.PluginTopologies) != 1 {
+		t.Errorf("Expected plugin topologies for apps with %s", report.PluginTopologiesFeature)
+	}
+}
@@ -17,6 +17,8 @@ const (
 	MockHostname           = "hostname.weave.local"
 	MockProxyAddress       = "unix:///foo/bar/weave.sock"
 	MockDriverName         = "weave_mock"
+	MockRemotePeerName     = "airstream"
+	MockRetryingPeerName   = "winnebago2"
 )
 
 // MockClient is a mock version of weave.Client
@@ -31,6 +33,42 @@ func (MockClient) Status() (weave.Status, error) {
 				{
 					Name:     MockWeavePeerName,
 					NickName: MockWeavePeerNickName,
+					Connections: []struct {
+						Name        string
+						NickName    string
+						Address     string
+						Outbound    bool
+						Established bool
+					}{
+						{Name: MockRemotePeerName, Outbound: true, Established: true},
+						{Name: MockRetryingPeerName, Outbound: true, Established: false},
+					},
+				},
+			},
+			Connections: []struct {
+				Address  string
+				Outbound bool
+				State    string
+				Info     string
+				Attrs    map[string]interface{}
+			}{
+				{
+					Address:  "10.0.0.2:6783",
+					Outbound: true,
+					State:    "established",
+					Info:     "fastdp 7a:3c:e6:c6:9d:45(airstream)",
+					Attrs:    map[string]interface{}{"name": "fastdp"},
+				},
+				{
+					Address:  "10.0.0.3:6783",
+					Outbound: true,
+					State:    "retrying",
+					Info:     "dial tcp 10.0.0.3:6783: connect: connection refused",
+				},
+				{
+					Address: "10.0.0.4:6783",
+					State:   "established",
+					Info:    "encrypted sleeve 5e:2a:31:8f:0c:11(motorhome)",
 				},
 			},
 		},